@@ -1,35 +1,58 @@
 package main
 
 import (
+	"bufio"
 	_ "embed"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
-	"errors"
 	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/javanhut/bifrost/internal/archive"
 	"github.com/javanhut/bifrost/internal/auth"
+	"github.com/javanhut/bifrost/internal/changelog"
+	"github.com/javanhut/bifrost/internal/color"
 	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/errcode"
+	"github.com/javanhut/bifrost/internal/freeze"
 	"github.com/javanhut/bifrost/internal/install"
+	"github.com/javanhut/bifrost/internal/integration"
+	"github.com/javanhut/bifrost/internal/journal"
+	"github.com/javanhut/bifrost/internal/licenses"
+	"github.com/javanhut/bifrost/internal/lint"
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/locksign"
 	"github.com/javanhut/bifrost/internal/manifest"
+	"github.com/javanhut/bifrost/internal/migrate"
+	"github.com/javanhut/bifrost/internal/metadata"
+	"github.com/javanhut/bifrost/internal/plugin"
+	"github.com/javanhut/bifrost/internal/policy"
 	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/stats"
+	"github.com/javanhut/bifrost/internal/tlog"
+	"github.com/javanhut/bifrost/internal/trust"
 	"github.com/javanhut/bifrost/internal/uninstall"
+	"github.com/javanhut/bifrost/internal/warn"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 // embeddedManifest will be populated at build time if using go:embed
 // For now, we'll rely on runtime loading
 var embeddedManifest string
 
-func runCommand(cmdStr string) error {
-	cmd := exec.Command("sh", "-c", cmdStr)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
-
 func maskAPIKey(apiKey string) string {
 	if apiKey == "" {
 		return ""
@@ -39,299 +62,3064 @@ func maskAPIKey(apiKey string) string {
 	}
 	return apiKey[:4] + "..." + apiKey[len(apiKey)-4:]
 }
-func validateVersion(s string) error {
-				var versionRegex = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
-				if !versionRegex.MatchString(s){
-					return errors.New("Invalid format must match format: 0.0.0 or Major.Minor.Patch")
-				}
-				return nil
-			}
 
-func main() {
-	// Initialize configuration
-	cfg, err := config.New()
+// packOptions returns the archive options for publishing the package in
+// the current directory: the default excludes, the manifest's exclude
+// patterns, anything listed in .bifrostignore, the --symlinks policy and the
+// --format compression
+func packOptions(cmd *cobra.Command, m *manifest.Manifest) ([]archive.Option, error) {
+	symlinks, _ := cmd.Flags().GetString("symlinks")
+	policy, err := archive.ParseSymlinkPolicy(symlinks)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return nil, err
+	}
+	format, err := publishFormat(cmd)
+	if err != nil {
+		return nil, err
 	}
 
-	// Ensure directories exist
-	if err := cfg.Init(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error initializing config: %v\n", err)
-		os.Exit(1)
+	return []archive.Option{
+		archive.WithExcludes(archive.DefaultExcludes...),
+		archive.WithExcludes(m.Package.Metadata.Exclude...),
+		archive.WithIgnoreFile(archive.IgnoreFileName),
+		archive.WithSymlinks(policy),
+		archive.WithFormat(format),
+	}, nil
+}
+
+// publishFormat returns the archive format chosen with --format
+func publishFormat(cmd *cobra.Command) (archive.Format, error) {
+	format, _ := cmd.Flags().GetString("format")
+	return archive.ParseFormat(format)
+}
+
+// packPackage builds the publish archive for the package in the current
+// directory
+func packPackage(cmd *cobra.Command, m *manifest.Manifest, archivePath string) error {
+	opts, err := packOptions(cmd, m)
+	if err != nil {
+		return err
 	}
+	return archive.Pack(filepath.Dir(manifestPath()), archivePath, opts...)
+}
 
-	root := &cobra.Command{
-		Use:   "bifrost",
-		Short: "Bifrost - Carrion's package manager",
-		Long:  "Bifrost is the package manager for the Carrion programming language",
+// checkArchiveSize warns when the archive is larger than --size-warning and
+// fails when it is larger than the registry's advertised upload limit. Both
+// cases list the largest packed files.
+func checkArchiveSize(cmd *cobra.Command, m *manifest.Manifest, client *registry.Client, archivePath string) error {
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return err
 	}
+	size := info.Size()
 
-	// Init command
-	root.AddCommand(&cobra.Command{
-		Use:   "init",
-		Short: "Create a new Carrion package",
-		Run: func(cmd *cobra.Command, args []string) {
-			var packageName string
-			var versionNumber string
-			if len(args) == 1 {	
-				packageName = args[0]
-			}
-			if len(args) == 2 {
-				packageName = args[0]
-				versionNumber = args[1]
-				err := validateVersion(versionNumber)
-				if err != nil {
-					errorStr := fmt.Sprintf("Error: %v", err)
-					cmd.PrintErrln(errorStr)
-				}
+	sizeWarning, _ := cmd.Flags().GetString("size-warning")
+	warnAt, err := archive.ParseSize(sizeWarning)
+	if err != nil {
+		return err
+	}
 
+	var limit int64
+	if status, err := client.Status(); err == nil {
+		limit = status.MaxUploadSize
+	}
 
+	overLimit := limit > 0 && size > limit
+	if !overLimit && (warnAt == 0 || size <= warnAt) {
+		return nil
+	}
+
+	if overLimit {
+		cmd.PrintErrf("Error: archive is %s, over the registry's limit of %s\n", archive.FormatSize(size), archive.FormatSize(limit))
+	} else {
+		warn.Printf(warn.Package, "archive is %s, over the %s warning threshold", archive.FormatSize(size), archive.FormatSize(warnAt))
+	}
+
+	if opts, err := packOptions(cmd, m); err == nil {
+		if files, err := archive.Files(filepath.Dir(manifestPath()), opts...); err == nil {
+			cmd.PrintErrln("Largest files (uncompressed):")
+			for _, f := range archive.Largest(files, 10) {
+				cmd.PrintErrf("  %10s  %s\n", archive.FormatSize(f.Size), f.Path)
 			}
-			if _, err := os.Stat("Bifrost.toml"); err == nil {
-				cmd.PrintErrln("Error: Bifrost.toml already exists")
-				os.Exit(1)
-			}
-			packageName = strings.ToLower(packageName)
-			makePackage := packageName
-			os.MkdirAll(makePackage, 0755)
-			// Create directory structure
-			tomlPath := fmt.Sprintf("%s/Bifrost.toml", packageName)
-			err := manifest.WriteDefault(tomlPath, packageName, versionNumber)
-			cobra.CheckErr(err)
-			dirs := []string{"src", "appraise", "docs"}
-			for _, dir := range dirs {
-				insidePackage := fmt.Sprintf("%s/%s",packageName, dir)
-				os.MkdirAll(insidePackage, 0755)
-			}
+		}
+	}
+	cmd.PrintErrf("Exclude unneeded files with %s or the manifest's exclude list\n", archive.IgnoreFileName)
 
-			// Create main.crl
-			mainContent := fmt.Sprintf(`grim Main:
-    init():
-        self.name = "%s"
-    spell new():
-        return self.name
-main:
-    m = Main()
-    m.new()
-`, packageName)
-			testContent := fmt.Sprintf(`import "src/main"
+	if overLimit {
+		return fmt.Errorf("archive exceeds the registry upload limit")
+	}
+	return nil
+}
 
-spell appraise_main():
-    m = Main()
-    check(m.new() == "%s")
-`, packageName)
-			readmeInfo := fmt.Sprintf("# %s", packageName)
-			mainFile := fmt.Sprintf("%s/src/main.crl",packageName)
-			testFile := fmt.Sprintf("%s/appraise/appraise_main.crl",packageName)
-			docsFile := fmt.Sprintf("%s/docs/README.md", packageName)
-			os.WriteFile(mainFile, []byte(mainContent), 0644)
-			os.WriteFile(testFile, []byte(testContent),0644)
-			os.WriteFile(docsFile, []byte(readmeInfo), 0644)
-			cmd.Println("Created new Carrion package")
-			cmd.Println("Edit Bifrost.toml to configure your package")
-		},
-	})
+// lintPackage runs the pre-publish checks on the package in the current
+// directory against the files publish would pack
+func lintPackage(cmd *cobra.Command, m *manifest.Manifest, maxFileSize int64) ([]lint.Finding, error) {
+	opts, err := packOptions(cmd, m)
+	if err != nil {
+		return nil, err
+	}
+	files, err := archive.Files(filepath.Dir(manifestPath()), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return lint.Check(m, files, maxFileSize)
+}
 
-	// Install command
-	installCmd := &cobra.Command{
-		Use:   "install [package]",
-		Short: "Install dependencies",
-		Run: func(cmd *cobra.Command, args []string) {
-			installer := install.New(cfg)
-			global, _ := cmd.Flags().GetBool("global")
+// applyDownloadLimits configures the installer's download concurrency and
+// rate from the install config, with --max-concurrent-downloads and
+// --limit-rate taking precedence
+func applyDownloadLimits(cmd *cobra.Command, cfg *config.Config, installer *install.Installer) error {
+	userConfig, err := cfg.LoadUserConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
 
-			if len(args) == 0 {
-				// Install from Bifrost.toml
-				_, err := manifest.Load("Bifrost.toml")
-				if err != nil {
-					cmd.PrintErrf("Error loading Bifrost.toml: %v\n", err)
-					os.Exit(1)
-				}
+	concurrent := userConfig.Install.MaxConcurrentDownloads
+	if cmd.Flags().Changed("max-concurrent-downloads") {
+		concurrent, _ = cmd.Flags().GetInt("max-concurrent-downloads")
+	}
+	if concurrent > 0 {
+		installer.SetMaxConcurrentDownloads(concurrent)
+	}
 
-				// TODO: Load available packages from registry
-				cmd.Println("Installing dependencies from Bifrost.toml...")
-				cmd.Println("Registry integration not yet implemented")
+	rate := userConfig.Install.LimitRate
+	if cmd.Flags().Changed("limit-rate") {
+		rate, _ = cmd.Flags().GetString("limit-rate")
+	}
+	if rate != "" {
+		bytesPerSecond, err := archive.ParseSize(rate)
+		if err != nil {
+			return fmt.Errorf("invalid download rate: %w", err)
+		}
+		installer.SetLimitRate(bytesPerSecond)
+	}
+	return nil
+}
 
-				// For now, just install local package
-				err = installer.InstallLocal("Bifrost.toml")
-				cobra.CheckErr(err)
-			} else {
-				// Install specific package
-				packageName := args[0]
-				version := ""
+// applyScriptPolicy configures whether the installer refuses packages with
+// install scripts, from install.strict with --strict taking precedence, and
+// how long the scripts may run, from install.script-timeout with
+// --script-timeout taking precedence
+func applyScriptPolicy(cmd *cobra.Command, cfg *config.Config, installer *install.Installer) error {
+	userConfig, err := cfg.LoadUserConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
 
-				// Parse package@version format
-				if idx := strings.Index(packageName, "@"); idx != -1 {
-					version = packageName[idx+1:]
-					packageName = packageName[:idx]
-				}
+	strict := userConfig.Install.Strict
+	if cmd.Flags().Changed("strict") {
+		strict, _ = cmd.Flags().GetBool("strict")
+	}
+	allowScripts, _ := cmd.Flags().GetBool("allow-scripts")
+	installer.SetStrict(strict)
+	installer.SetAllowScripts(allowScripts)
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		installer.SetScriptPrompt(promptScripts(cmd))
+	}
 
-				cmd.Printf("Installing %s", packageName)
-				if version != "" {
-					cmd.Printf("@%s", version)
-				}
-				cmd.Println("...")
+	timeout := userConfig.Install.ScriptTimeout
+	if cmd.Flags().Changed("script-timeout") {
+		timeout, _ = cmd.Flags().GetString("script-timeout")
+	}
+	if timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid script timeout %q: expected a duration such as 10m, or 0 for none", timeout)
+		}
+		installer.SetScriptTimeout(d)
+	}
+	return nil
+}
 
-				err := installer.InstallPackageByName(packageName, version, global)
-				if err != nil {
-					cmd.PrintErrf("Error installing package: %v\n", err)
-					os.Exit(1)
-				}
-			}
-		},
+// promptScripts returns the prompt asking on the terminal whether a package
+// may run its install scripts
+func promptScripts(cmd *cobra.Command) install.ScriptPrompt {
+	reader := bufio.NewReader(os.Stdin)
+	return func(name, version string) (bool, error) {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Allow %s@%s to run its install scripts? The answer is remembered. [y/N] ", name, version)
+		answer, err := reader.ReadString('\n')
+		if err != nil && answer == "" {
+			return false, fmt.Errorf("failed to read answer: %w", err)
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true, nil
+		}
+		return false, nil
 	}
-	installCmd.Flags().BoolP("global", "g", false, "Install package globally")
-	root.AddCommand(installCmd)
+}
 
-	// Uninstall command
-	uninstallCmd := &cobra.Command{
-		Use:   "uninstall [package]",
-		Short: "Uninstall packages",
-		Run: func(cmd *cobra.Command, args []string) {
-			uninstaller := uninstall.New(cfg)
-			global, _ := cmd.Flags().GetBool("global")
-			all, _ := cmd.Flags().GetBool("all")
-			clean, _ := cmd.Flags().GetBool("clean")
+// applyTimeouts sets how long registry requests may take, per kind of
+// operation from the timeouts in config, or with --timeout the same bound
+// for every operation
+func applyTimeouts(cmd *cobra.Command, cfg *config.Config) error {
+	if cmd.Flags().Changed("timeout") {
+		value, _ := cmd.Flags().GetString("timeout")
+		d, err := parseTimeout(value)
+		if err != nil {
+			return err
+		}
+		registry.SetTimeouts(registry.Uniform(d))
+		return nil
+	}
 
-			if clean {
-				err := uninstaller.CleanCache()
-				if err != nil {
-					cmd.PrintErrf("Error cleaning cache: %v\n", err)
-					os.Exit(1)
-				}
+	userConfig, err := cfg.LoadUserConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	timeouts := registry.DefaultTimeouts
+	for _, t := range []struct {
+		value string
+		d     *time.Duration
+	}{
+		{userConfig.Timeouts.Query, &timeouts.Query},
+		{userConfig.Timeouts.Download, &timeouts.Download},
+		{userConfig.Timeouts.Publish, &timeouts.Publish},
+	} {
+		if t.value == "" {
+			continue
+		}
+		if *t.d, err = parseTimeout(t.value); err != nil {
+			return err
+		}
+	}
+	registry.SetTimeouts(timeouts)
+	return nil
+}
+
+// parseTimeout parses a request timeout, where 0 means no limit
+func parseTimeout(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid timeout %q: expected a duration such as 30s, or 0 for none", value)
+	}
+	return d, nil
+}
+
+// applyFileModes configures the permissions of extracted packages from
+// install.dir-mode and install.file-mode, and the scanner their archives
+// are checked with from install.scanner
+func applyFileModes(cfg *config.Config, installer *install.Installer) error {
+	userConfig, err := cfg.LoadUserConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	var dirMode, fileMode os.FileMode
+	if userConfig.Install.DirMode != "" {
+		if dirMode, err = config.ParseMode(userConfig.Install.DirMode); err != nil {
+			return fmt.Errorf("install.dir-mode: %w", err)
+		}
+	}
+	if userConfig.Install.FileMode != "" {
+		if fileMode, err = config.ParseMode(userConfig.Install.FileMode); err != nil {
+			return fmt.Errorf("install.file-mode: %w", err)
+		}
+	}
+	installer.SetModes(dirMode, fileMode)
+	installer.SetScanner(userConfig.Install.Scanner)
+	return nil
+}
+
+// applyTransparencyLog makes the installer look archives up in the
+// transparency log configured under tlog, if any
+func applyTransparencyLog(cfg *config.Config, installer *install.Installer) error {
+	log, err := transparencyLog(cfg)
+	if err != nil || log == nil {
+		return err
+	}
+	installer.SetTransparencyLog(log)
+	return nil
+}
+
+// transparencyLog returns a client of the transparency log configured
+// under tlog, nil when tlog.url is not set
+func transparencyLog(cfg *config.Config) (*tlog.Client, error) {
+	userConfig, err := cfg.LoadUserConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	logConfig := userConfig.TransparencyLog
+	if logConfig.URL == "" {
+		return nil, nil
+	}
+	if logConfig.Key == "" {
+		warn.Printf(warn.Integrity, "tlog.key is not set, so transparency log entries are not verified: their inclusion proofs are only checked against a root from the same unsigned response. Set tlog.key to the log's public key")
+		return tlog.New(logConfig.URL, nil), nil
+	}
+	key, err := tlog.LoadKey(logConfig.Key)
+	if err != nil {
+		return nil, err
+	}
+	return tlog.New(logConfig.URL, key), nil
+}
+
+// installProgress renders install events as the installer's text lines,
+// and on a terminal also shows how far each download is, redrawn in place
+func installProgress(out *os.File) install.EventHandler {
+	text := install.TextEvents(out)
+	if !term.IsTerminal(int(out.Fd())) {
+		return text
+	}
+	drawn := false
+	return func(e install.Event) {
+		if e.Kind == install.EventDownloading && e.Bytes > 0 {
+			if percent := e.Percent(); percent >= 0 && percent < 100 {
+				fmt.Fprintf(out, "\r\033[K  %s %d%%", color.For(out).Ref(e.Package, e.Version), percent)
+				drawn = true
 				return
 			}
+		}
+		if drawn {
+			fmt.Fprint(out, "\r\033[K")
+			drawn = false
+		}
+		text(e)
+	}
+}
 
-			if len(args) == 0 {
-				if all {
-					cmd.PrintErrln("Error: --all flag requires specifying a package name")
-					os.Exit(1)
-				}
-				
-				// Uninstall from Bifrost.toml
-				_, err := manifest.Load("Bifrost.toml")
-				if err != nil {
-					cmd.PrintErrf("Error loading Bifrost.toml: %v\n", err)
-					os.Exit(1)
-				}
+// printPlan writes an install plan to stdout, as a readable list for dry
+// runs and as indented JSON otherwise
+func printPlan(cmd *cobra.Command, plan *install.Plan, dryRun bool) {
+	if dryRun {
+		fmt.Println("Dry run, nothing will be changed. The install would:")
+		plan.Print(os.Stdout)
+		return
+	}
+
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(plan); err != nil {
+		cmd.PrintErrf("Error encoding plan: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// manifestPathFlag holds the global --manifest-path flag, made absolute
+var manifestPathFlag string
+
+// profileFlag holds the global --profile flag
+var profileFlag string
+
+// orgPolicy is the organization policy file, loaded before every command
+var orgPolicy *policy.Policy
+
+// manifestPath returns the manifest named by --manifest-path, or
+// Bifrost.toml in the working directory
+func manifestPath() string {
+	if manifestPathFlag != "" {
+		return manifestPathFlag
+	}
+	return manifest.FileName
+}
+
+// projectLockPath returns the lockfile next to the manifest for the profile
+// selected with --profile
+func projectLockPath() string {
+	return filepath.Join(filepath.Dir(manifestPath()), lockfile.FileNameFor(profileFlag))
+}
+
+// applyProfile selects the manifest profile named by --profile, installing
+// from its registry unless --registry is given
+func applyProfile(cmd *cobra.Command, cfg *config.Config) error {
+	path, err := findManifest()
+	if err != nil {
+		return fmt.Errorf("--profile needs a project: %w", err)
+	}
+	m, err := manifest.Load(path)
+	if err != nil {
+		return fmt.Errorf("failed to load manifest: %w", err)
+	}
+	if _, err := m.WithProfile(profileFlag); err != nil {
+		return err
+	}
+	cfg.Profile = profileFlag
+	if registryURL := m.Profiles[profileFlag].Registry; registryURL != "" && !cmd.Flags().Changed("registry") {
+		if err := cfg.OverrideRegistryURL(registryURL); err != nil {
+			return fmt.Errorf("profile %s: %w", profileFlag, err)
+		}
+	}
+	return nil
+}
+
+// findManifest returns the manifest named by --manifest-path, or the nearest
+// one in the working directory or its parents
+func findManifest() (string, error) {
+	if manifestPathFlag != "" {
+		return manifestPathFlag, nil
+	}
+	return manifest.Find(".")
+}
+
+// projectDir returns the directory of the project containing the working
+// directory (or named by --manifest-path), or "" outside a project
+func projectDir() string {
+	path, err := findManifest()
+	if err != nil {
+		return ""
+	}
+	return filepath.Dir(path)
+}
+
+// collectLicenses returns the license information of the current project's
+// installed dependencies, warning about dependencies that are not installed
+func collectLicenses(cmd *cobra.Command, cfg *config.Config) []licenses.Package {
+	manifestPath, err := findManifest()
+	if err != nil {
+		cmd.PrintErrf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	pkgs, missing, err := licenses.Collect(cfg, manifestPath)
+	if err != nil {
+		cmd.PrintErrf("Error collecting licenses: %v\n", err)
+		os.Exit(1)
+	}
+	for _, name := range missing {
+		warn.Printf(warn.Package, "%s is not installed; run 'bifrost install' first", name)
+	}
+	return pkgs
+}
+
+// printChangelog prints the changelog entries of a package from one version
+// to another
+func printChangelog(cmd *cobra.Command, name, from, to string, entries []changelog.Entry) {
+	if from == "" {
+		cmd.Printf("Changelog for %s@%s:\n", name, to)
+	} else {
+		cmd.Printf("Changelog for %s %s -> %s:\n", name, from, to)
+	}
+	if len(entries) == 0 {
+		cmd.Println("  No entries")
+		return
+	}
+	for _, e := range entries {
+		cmd.Printf("\n## %s\n", e.Heading)
+		if e.Body != "" {
+			cmd.Println(e.Body)
+		}
+	}
+}
+
+// keepUpgrade keeps the upgrade staged for the project at path, exiting on
+// failure
+func keepUpgrade(cmd *cobra.Command, cfg *config.Config, installer *install.Installer, path string) {
+	lock, err := installer.ConfirmUpgrade(path)
+	if err != nil {
+		cmd.PrintErrf("Error: %v\n%s", err, explainHint(err))
+		os.Exit(1)
+	}
+	cmd.Printf("Kept the upgrade: updated %s and locked %d package(s) in %s\n", manifest.FileName, len(lock.Packages), lockfile.FileNameFor(profileFlag))
+	refreshEnvFiles(cmd, cfg, path)
+}
+
+// dropUpgrade abandons the upgrade staged for the project at path, exiting
+// on failure
+func dropUpgrade(cmd *cobra.Command, cfg *config.Config, installer *install.Installer, path string) {
+	if err := installer.AbandonUpgrade(path); err != nil {
+		cmd.PrintErrf("Error: %v\n%s", err, explainHint(err))
+		os.Exit(1)
+	}
+	cmd.Printf("Dropped the upgrade; %s and %s are unchanged\n", manifest.FileName, lockfile.FileNameFor(profileFlag))
+	refreshEnvFiles(cmd, cfg, path)
+}
+
+// orDash returns s, or "-" when it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// formatSizeChange renders the difference between two byte counts with a
+// sign, e.g. "+1.5 MB"
+func formatSizeChange(from, to int64) string {
+	switch {
+	case to > from:
+		return "+" + archive.FormatSize(to-from)
+	case to < from:
+		return "-" + archive.FormatSize(from-to)
+	}
+	return "no change"
+}
+
+// printStats writes the summary of 'bifrost stats', listing at most top
+// dependencies
+func printStats(out io.Writer, s *stats.Stats, projectsRoot string, top int) {
+	fmt.Fprintf(out, "Cache: %d file(s), %s\n", s.CacheFiles, archive.FormatSize(s.CacheBytes))
+
+	fmt.Fprintln(out, "\nInstalled packages:")
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, l := range s.Locations {
+		fmt.Fprintf(w, "  %s\t%d package(s)\t%d version(s)\t%s\t%s\n", l.Name, l.Packages, l.Versions, archive.FormatSize(l.Bytes), l.Path)
+	}
+	w.Flush()
+
+	if projectsRoot != "" {
+		fmt.Fprintf(out, "\nMost used dependencies (%d project(s) under %s):\n", s.Projects, projectsRoot)
+		if len(s.Dependencies) == 0 {
+			fmt.Fprintln(out, "  none")
+		}
+		w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for i, dep := range s.Dependencies {
+			if i == top {
+				break
+			}
+			fmt.Fprintf(w, "  %s\t%d project(s)\t%s\n", dep.Name, dep.Projects, strings.Join(dep.Versions, ", "))
+		}
+		w.Flush()
+	}
+
+	if len(s.History) > 0 {
+		fmt.Fprintln(out, "\nDisk usage trend:")
+		w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  DATE\tCACHE\tINSTALLED")
+		history := s.History
+		if len(history) > 5 {
+			history = history[len(history)-5:]
+		}
+		for _, snap := range history {
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", snap.Time.Local().Format("2006-01-02 15:04"), archive.FormatSize(snap.CacheBytes), archive.FormatSize(snap.InstalledBytes))
+		}
+		fmt.Fprintf(w, "  now\t%s\t%s\n", archive.FormatSize(s.CacheBytes), archive.FormatSize(s.InstalledBytes()))
+		w.Flush()
+		first := s.History[0]
+		fmt.Fprintf(out, "Since %s: cache %s, installed %s\n", first.Time.Local().Format("2006-01-02"),
+			formatSizeChange(first.CacheBytes, s.CacheBytes), formatSizeChange(first.InstalledBytes, s.InstalledBytes()))
+	}
+}
+
+// authorizeClient sets the credentials from the registry configuration on
+// client, falling back to those stored by 'bifrost login'
+func authorizeClient(cfg *config.Config, client *registry.Client, registryConfig *config.RegistryConfig) {
+	switch registryConfig.AuthType {
+	case "token":
+		client.SetAPIKey(registryConfig.APIKey)
+		return
+	case "basic":
+		client.SetBasicAuth(registryConfig.Username, registryConfig.Password)
+		return
+	}
+
+	authConfig, err := auth.New(cfg).GetAuthConfig()
+	if err != nil {
+		return
+	}
+	if authConfig.AuthType == "token" {
+		client.SetAPIKey(authConfig.APIKey)
+	} else if authConfig.AuthType == "basic" {
+		client.SetBasicAuth(authConfig.Username, authConfig.Password)
+	}
+}
+
+// completeVersions completes a "name@" argument with the dist-tags and
+// newest versions of name in the registry
+func completeVersions(cmd *cobra.Command, cfg *config.Config, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	name, prefix := splitPackageRef(toComplete)
+	if strings.LastIndex(toComplete, "@") <= 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	if registryURL, _ := cmd.Flags().GetString("registry"); registryURL != "" {
+		if err := cfg.OverrideRegistryURL(registryURL); err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+	}
+
+	versions, err := install.New(cfg).CompleteVersions(name)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	var completions []string
+	for _, v := range versions {
+		if strings.HasPrefix(v, prefix) {
+			completions = append(completions, name+"@"+v)
+		}
+	}
+	// Keep the newest versions first rather than sorted as strings
+	return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveKeepOrder
+}
+
+// namedRegistryClient returns a client for a configured registry with its
+// credentials. Only the default registry falls back to those stored by
+// 'bifrost login'.
+func namedRegistryClient(cfg *config.Config, r config.NamedRegistry) *registry.Client {
+	client := registry.NewClient(r.URL)
+	if r.Name == config.DefaultRegistryName {
+		authorizeClient(cfg, client, &r.RegistryConfig)
+		return client
+	}
+	switch r.AuthType {
+	case "token":
+		client.SetAPIKey(r.APIKey)
+	case "basic":
+		client.SetBasicAuth(r.Username, r.Password)
+	}
+	return client
+}
+
+// parseRegistriesKey splits a "registries.<name>.<field>" config key. The
+// field is empty for "registries.<name>".
+func parseRegistriesKey(key string) (name, field string, ok bool) {
+	rest, ok := strings.CutPrefix(key, "registries.")
+	if !ok || rest == "" {
+		return "", "", false
+	}
+	for _, f := range []string{"url", "username", "password", "api-key", "auth-type", "index", "index-key"} {
+		if n, found := strings.CutSuffix(rest, "."+f); found && n != "" {
+			return n, f, true
+		}
+	}
+	if strings.Contains(rest, ".") {
+		return "", "", false
+	}
+	return rest, "", true
+}
+
+// splitPackageRef splits a "name@version" argument. The "@" starting a
+// scoped name such as "@acme/utils" is part of the name.
+func splitPackageRef(ref string) (name, version string) {
+	if idx := strings.LastIndex(ref, "@"); idx > 0 {
+		return ref[:idx], ref[idx+1:]
+	}
+	return ref, ""
+}
+
+// packageRequests parses "name@version" arguments into install requests
+func packageRequests(args []string) []install.PackageRequest {
+	requests := make([]install.PackageRequest, 0, len(args))
+	for _, arg := range args {
+		name, version := splitPackageRef(arg)
+		requests = append(requests, install.PackageRequest{Name: name, Version: version})
+	}
+	return requests
+}
+
+// setScope routes packages of scope to value, the name of a configured
+// registry or a registry URL
+// scopeLocation returns the location the --local, --user and --global flags
+// of cmd select, empty when none of them is given
+func scopeLocation(cmd *cobra.Command) (uninstall.Location, error) {
+	var selected []uninstall.Location
+	for _, loc := range []uninstall.Location{uninstall.LocationLocal, uninstall.LocationUser, uninstall.LocationGlobal} {
+		if on, _ := cmd.Flags().GetBool(string(loc)); on {
+			selected = append(selected, loc)
+		}
+	}
+	switch len(selected) {
+	case 0:
+		return "", nil
+	case 1:
+		return selected[0], nil
+	}
+	return "", fmt.Errorf("--%s and --%s cannot be combined", selected[0], selected[1])
+}
+
+func setScope(userConfig *config.UserConfig, scope, value string) error {
+	if err := manifest.ValidateScope(scope); err != nil {
+		return err
+	}
+	if strings.Contains(value, "://") {
+		var rc config.RegistryConfig
+		if err := setRegistryField(&rc, "url", value); err != nil {
+			return err
+		}
+		value = rc.URL
+	} else if _, ok := userConfig.Registries[value]; !ok && value != config.DefaultRegistryName {
+		return fmt.Errorf("no registry named %q is configured; add it with 'bifrost config set registries.%s.url <url>' or give a URL", value, value)
+	}
+	if userConfig.Scopes == nil {
+		userConfig.Scopes = make(map[string]string)
+	}
+	userConfig.Scopes[scope] = value
+	return nil
+}
+
+// setRegistryField sets a field of a registry configuration the way the
+// registry.* config keys do
+func setRegistryField(rc *config.RegistryConfig, field, value string) error {
+	switch field {
+	case "url":
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid registry URL %q: expected http:// or https:// followed by a host", value)
+		}
+		rc.URL = strings.TrimRight(value, "/")
+	case "username":
+		rc.Username = value
+		if rc.AuthType == "" {
+			rc.AuthType = "basic"
+		}
+	case "password":
+		rc.Password = value
+		if rc.AuthType == "" {
+			rc.AuthType = "basic"
+		}
+	case "api-key":
+		rc.APIKey = value
+		rc.AuthType = "token"
+	case "auth-type":
+		if value != "basic" && value != "token" && value != "none" {
+			return fmt.Errorf("auth-type must be 'basic', 'token', or 'none'")
+		}
+		rc.AuthType = value
+	case "index":
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid index URL %q: expected http:// or https:// followed by a host", value)
+		}
+		rc.Index = value
+	case "index-key":
+		if _, err := locksign.ParsePublicKey(value); err != nil {
+			return fmt.Errorf("invalid index key: %w", err)
+		}
+		rc.IndexKey = strings.TrimSpace(value)
+	default:
+		return fmt.Errorf("unknown registry field %q", field)
+	}
+	return nil
+}
+
+// verifyLockSignature checks the signature of the lockfile at lockPath when
+// the project signs its lockfile, printing which key was trusted. The key
+// must be pinned in the environment or under lock.keys, not only committed.
+func verifyLockSignature(cmd *cobra.Command, cfg *config.Config, lockPath string) error {
+	userConfig, err := cfg.LoadUserConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	pub, err := locksign.LoadTrustedKey(lockPath, userConfig.Lock.Keys)
+	if err != nil {
+		return err
+	}
+	if pub == nil {
+		return nil
+	}
+	if err := locksign.Verify(lockPath, pub); err != nil {
+		return fmt.Errorf("%s: %w", lockPath, err)
+	}
+	cmd.Printf("Verified %s signature (key %s)\n", lockfile.FileName, locksign.Fingerprint(pub))
+	return nil
+}
+
+// explainHint points at 'bifrost explain' for an error with a code, so the
+// message itself can stay short
+func explainHint(err error) string {
+	code := errcode.Of(err)
+	if code == "" {
+		return ""
+	}
+	return fmt.Sprintf("Run 'bifrost explain %s' for likely causes and how to fix it.\n", code)
+}
+
+// printRegistryStatus writes what a registry reports about itself, with
+// times relative to now
+func printRegistryStatus(w io.Writer, url string, status *registry.HealthResponse, now time.Time) {
+	fmt.Fprintf(w, "Registry: %s\n", url)
+	fmt.Fprintf(w, "Status:   %s\n", status.Status)
+	if status.Version != "" {
+		fmt.Fprintf(w, "Version:  %s\n", status.Version)
+	} else {
+		fmt.Fprintln(w, "Version:  not reported")
+	}
+
+	if status.AdvertisesFeatures() {
+		fmt.Fprintln(w, "Features:")
+		for _, f := range registry.KnownFeatures {
+			state := "not supported"
+			if status.Supports(f) {
+				state = "supported"
+			}
+			fmt.Fprintf(w, "  %-12s %s\n", f, state)
+		}
+		var other []string
+		for _, f := range status.Features {
+			if !slices.Contains(registry.KnownFeatures, f) {
+				other = append(other, f)
+			}
+		}
+		if len(other) > 0 {
+			fmt.Fprintf(w, "  Also: %s\n", strings.Join(other, ", "))
+		}
+	} else {
+		fmt.Fprintln(w, "Features: not advertised; optional features may or may not work")
+	}
+
+	if rl := status.RateLimit; rl != nil {
+		fmt.Fprintf(w, "Rate limit: %d of %d requests left", rl.Remaining, rl.Limit)
+		if rl.Reset != nil && rl.Reset.After(now) {
+			fmt.Fprintf(w, ", resets in %s", rl.Reset.Sub(now).Round(time.Second))
+		}
+		fmt.Fprintln(w)
+	} else {
+		fmt.Fprintln(w, "Rate limit: not reported")
+	}
+	if updated := status.IndexUpdatedAt; updated != nil {
+		fmt.Fprintf(w, "Index updated: %s", updated.Local().Format(time.RFC3339))
+		// A registry clock ahead of ours would make the age negative
+		if age := now.Sub(*updated); age >= 0 {
+			fmt.Fprintf(w, " (%s ago)", age.Round(time.Second))
+		}
+		fmt.Fprintln(w)
+	} else {
+		fmt.Fprintln(w, "Index updated: not reported")
+	}
+	if status.MaxUploadSize > 0 {
+		fmt.Fprintf(w, "Max upload size: %s\n", archive.FormatSize(status.MaxUploadSize))
+	}
+}
+
+// formatPhase formats a ping phase duration in milliseconds, or "-" for a
+// phase that did not happen
+func formatPhase(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
+
+// resolveManifestPath makes a --manifest-path value absolute, accepting a
+// project directory in place of its manifest
+func resolveManifestPath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("manifest not found: %w", err)
+	}
+	if info.IsDir() {
+		path = filepath.Join(path, manifest.FileName)
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("manifest not found: %w", err)
+		}
+	}
+	return path, nil
+}
+
+// printRemovals lists what a dry-run uninstall would delete
+func printRemovals(removals []uninstall.Removal) {
+	if len(removals) == 0 {
+		fmt.Println("Dry run: nothing would be removed.")
+		return
+	}
+	fmt.Println("Dry run, nothing will be changed. The uninstall would remove:")
+	uninstall.PrintRemovals(os.Stdout, removals)
+}
+
+// confirmRemovals lists what is about to be deleted and asks the user to
+// confirm, exiting unless they agree. Without a terminal to ask on, it
+// exits and points at --yes.
+func confirmRemovals(cmd *cobra.Command, action string, removals []uninstall.Removal) {
+	if len(removals) == 0 {
+		return
+	}
+
+	cmd.Printf("%s? This will remove:\n", action)
+	uninstall.PrintRemovals(cmd.ErrOrStderr(), removals)
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		cmd.PrintErrln("Error: refusing to remove without confirmation; pass --yes to proceed")
+		os.Exit(1)
+	}
+
+	cmd.Print("Proceed? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return
+	}
+	cmd.Println("Aborted.")
+	os.Exit(1)
+}
+
+// printVerifyResults writes how each installed package compares with its
+// archive
+func printVerifyResults(w io.Writer, results []*install.VerifyResult) {
+	c := color.For(w)
+	for _, r := range results {
+		ref := c.Ref(r.Name, r.Version)
+		switch {
+		case r.Error != "":
+			fmt.Fprintf(w, "%s: %s\n", ref, c.Error("error: "+r.Error))
+		case r.NotInstalled:
+			fmt.Fprintf(w, "%s: %s\n", ref, c.Error("not installed"))
+		case r.OK():
+			fmt.Fprintf(w, "%s: ok\n", ref)
+		default:
+			fmt.Fprintf(w, "%s: %s\n", ref, c.Error("differs"))
+		}
+		if r.Republished {
+			fmt.Fprintf(w, "  republished: locked as %s, the registry now serves %s\n", r.LockedChecksum, r.RegistryChecksum)
+		}
+		for _, f := range r.Modified {
+			fmt.Fprintf(w, "  modified: %s\n", f)
+		}
+		for _, f := range r.Missing {
+			fmt.Fprintf(w, "  missing:  %s\n", f)
+		}
+		for _, f := range r.Extra {
+			fmt.Fprintf(w, "  extra:    %s (not in the archive)\n", f)
+		}
+	}
+}
+
+// printReport writes an install summary to stdout, as JSON if asJSON is set,
+// and saves it to the --report file
+func printReport(cmd *cobra.Command, report *install.Report, asJSON bool) {
+	saveReport(cmd, report, nil)
+	if !asJSON {
+		fmt.Println()
+		report.Print(os.Stdout, 5)
+		return
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		cmd.PrintErrf("Error encoding report: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// saveReport writes the install report to the file given with --report, if
+// any, recording err when the install failed
+func saveReport(cmd *cobra.Command, report *install.Report, err error) {
+	path, _ := cmd.Flags().GetString("report")
+	if path == "" || report == nil {
+		return
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	if err := report.Save(path); err != nil {
+		warn.Printf(warn.FileError(err), "%v", err)
+	}
+}
+
+// refreshEnvFiles rewrites the .env and .envrc files 'bifrost env' generated
+// for the project whose manifest is at path
+func refreshEnvFiles(cmd *cobra.Command, cfg *config.Config, path string) {
+	refreshed, err := integration.New(cfg).RefreshEnvFiles(filepath.Dir(path))
+	if err != nil {
+		warn.Printf(warn.FileError(err), "%v", err)
+	}
+	for _, p := range refreshed {
+		cmd.PrintErrf("Refreshed %s\n", p)
+	}
+}
+
+// writeUpdateSummary writes the Markdown summary of what an install changed
+// to path, or stdout for "-"
+func writeUpdateSummary(cmd *cobra.Command, installer *install.Installer, path string) {
+	if path == "-" {
+		fmt.Println()
+		if err := installer.WriteUpdateSummary(os.Stdout, installer.Report()); err != nil {
+			cmd.PrintErrf("Error writing update summary: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var b strings.Builder
+	err := installer.WriteUpdateSummary(&b, installer.Report())
+	if err == nil {
+		err = os.WriteFile(path, []byte(b.String()), 0644)
+	}
+	if err != nil {
+		cmd.PrintErrf("Error writing update summary: %v\n", err)
+		os.Exit(1)
+	}
+	cmd.Printf("Wrote update summary to %s\n", path)
+}
+
+// openURL opens a URL or file with the desktop's default application
+func openURL(target string) error {
+	var opener *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		opener = exec.Command("open", target)
+	case "windows":
+		opener = exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+	default:
+		opener = exec.Command("xdg-open", target)
+	}
+	return opener.Start()
+}
+
+// pluginContext builds the handshake document passed to plugins
+func pluginContext(cfg *config.Config) *plugin.Context {
+	ctx := &plugin.Context{
+		ProtocolVersion: plugin.ProtocolVersion,
+		HomeDir:         cfg.HomeDir,
+		RegistryURL:     cfg.RegistryURL,
+	}
+	if exe, err := os.Executable(); err == nil {
+		ctx.BifrostPath = exe
+	}
+
+	if registryConfig, err := cfg.GetRegistryConfig(); err == nil {
+		ctx.RegistryURL = registryConfig.URL
+		if registryConfig.AuthType == "basic" || registryConfig.AuthType == "token" {
+			ctx.Auth = &plugin.Auth{
+				Type:     registryConfig.AuthType,
+				Username: registryConfig.Username,
+				Password: registryConfig.Password,
+				APIKey:   registryConfig.APIKey,
+			}
+		}
+	}
+	if ctx.Auth == nil {
+		if authConfig, err := auth.New(cfg).GetAuthConfig(); err == nil {
+			ctx.Auth = &plugin.Auth{
+				Type:     authConfig.AuthType,
+				Username: authConfig.Username,
+				Password: authConfig.Password,
+				APIKey:   authConfig.APIKey,
+			}
+		}
+	}
+
+	if manifestPath, err := findManifest(); err == nil {
+		ctx.ManifestPath = manifestPath
+		ctx.ProjectRoot = filepath.Dir(manifestPath)
+	}
+
+	return ctx
+}
+
+func main() {
+	// Initialize configuration
+	cfg, err := config.New()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Ensure directories exist
+	if err := cfg.Init(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing config: %v\n", err)
+		os.Exit(1)
+	}
+
+	root := &cobra.Command{
+		Use:   "bifrost",
+		Short: "Bifrost - Carrion's package manager",
+		Long:  "Bifrost is the package manager for the Carrion programming language",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			colorFlag, _ := cmd.Flags().GetString("color")
+			colorMode, err := color.ParseMode(colorFlag)
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			color.SetMode(colorMode)
+
+			pol, err := policy.Load()
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			orgPolicy = pol
+
+			if registryURL, _ := cmd.Flags().GetString("registry"); registryURL != "" {
+				if err := cfg.OverrideRegistryURL(registryURL); err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			if manifestPathFlag != "" {
+				path, err := resolveManifestPath(manifestPathFlag)
+				if err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				manifestPathFlag = path
+				// Dependencies belong next to the manifest, not in the
+				// working directory
+				cfg.ModulesDir = cfg.ProjectModulesDir(filepath.Dir(path))
+			}
+
+			if profileFlag != "" {
+				if err := applyProfile(cmd, cfg); err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			layout, _ := cmd.Flags().GetString("layout")
+			if userConfig, err := cfg.LoadUserConfig(); err == nil {
+				if layout == "" {
+					layout = userConfig.Install.Layout
+				}
+				cfg.ReadOnlyStore = userConfig.Install.ReadOnlyStore
+			}
+			if allow, _ := cmd.Flags().GetBool("allow-store-write"); allow {
+				cfg.ReadOnlyStore = false
+			}
+			if layout != "" {
+				parsed, err := config.ParseLayout(layout)
+				if err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				cfg.Layout = parsed
+			}
+
+			if err := applyTimeouts(cmd, cfg); err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			if fatal, _ := cmd.Flags().GetBool("fatal-warnings"); fatal {
+				if n := len(warn.Emitted()); n > 0 {
+					cmd.PrintErrf("Error: %d warning(s) printed and --fatal-warnings is set\n", n)
+					os.Exit(1)
+				}
+			}
+		},
+	}
+	root.PersistentFlags().String("registry", "", "Registry URL for this invocation (overrides CARRION_REGISTRY_URL and config)")
+	root.PersistentFlags().StringVar(&manifestPathFlag, "manifest-path", "", "Path to the Bifrost.toml to operate on, or its directory (default: the working directory)")
+	root.PersistentFlags().StringVar(&profileFlag, "profile", "", "Manifest profile to use: its [profile.<name>] dependencies and registry apply, locked in Bifrost.<name>.lock")
+	root.PersistentFlags().String("layout", "", "Layout of carrion_modules: versioned or flat (overrides install.layout)")
+	root.PersistentFlags().Bool("allow-store-write", false, "Allow changes to the user and global package directories when install.read-only-store is set")
+	root.PersistentFlags().String("color", string(color.Auto), "When to color output: auto, always or never (auto honors NO_COLOR)")
+	root.PersistentFlags().Bool("fatal-warnings", false, "Exit with an error if any warning was printed")
+	root.PersistentFlags().String("timeout", "", "Bound every registry request by this duration, e.g. 1m, or 0 for none (overrides timeouts.*)")
+	root.SetErr(color.Labels(os.Stderr))
+	warn.SetOutput(root.ErrOrStderr())
+
+	// Init command
+	root.AddCommand(&cobra.Command{
+		Use:   "init",
+		Short: "Create a new Carrion package",
+		Run: func(cmd *cobra.Command, args []string) {
+			var packageName string
+			var versionNumber string
+			if len(args) == 1 {	
+				packageName = args[0]
+			}
+			if len(args) == 2 {
+				packageName = args[0]
+				versionNumber = args[1]
+				err := manifest.ValidateVersion(versionNumber)
+				if err != nil {
+					errorStr := fmt.Sprintf("Error: %v", err)
+					cmd.PrintErrln(errorStr)
+					os.Exit(1)
+				}
+
+
+			}
+			if _, err := os.Stat("Bifrost.toml"); err == nil {
+				cmd.PrintErrln("Error: Bifrost.toml already exists")
+				os.Exit(1)
+			}
+			packageName = strings.ToLower(packageName)
+			if packageName != "" {
+				if err := manifest.ValidateName(packageName); err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			makePackage := packageName
+			os.MkdirAll(makePackage, 0755)
+			// Create directory structure
+			tomlPath := fmt.Sprintf("%s/Bifrost.toml", packageName)
+			err := manifest.WriteDefault(tomlPath, packageName, versionNumber)
+			cobra.CheckErr(err)
+			dirs := []string{"src", "appraise", "docs"}
+			for _, dir := range dirs {
+				insidePackage := fmt.Sprintf("%s/%s",packageName, dir)
+				os.MkdirAll(insidePackage, 0755)
+			}
+
+			// Create main.crl
+			mainContent := fmt.Sprintf(`grim Main:
+    init():
+        self.name = "%s"
+    spell new():
+        return self.name
+main:
+    m = Main()
+    m.new()
+`, packageName)
+			testContent := fmt.Sprintf(`import "src/main"
+
+spell appraise_main():
+    m = Main()
+    check(m.new() == "%s")
+`, packageName)
+			readmeInfo := fmt.Sprintf("# %s", packageName)
+			mainFile := fmt.Sprintf("%s/src/main.crl",packageName)
+			testFile := fmt.Sprintf("%s/appraise/appraise_main.crl",packageName)
+			docsFile := fmt.Sprintf("%s/docs/README.md", packageName)
+			os.WriteFile(mainFile, []byte(mainContent), 0644)
+			os.WriteFile(testFile, []byte(testContent),0644)
+			os.WriteFile(docsFile, []byte(readmeInfo), 0644)
+			cmd.Println("Created new Carrion package")
+			cmd.Println("Edit Bifrost.toml to configure your package")
+		},
+	})
+
+	// Import command
+	importCmd := &cobra.Command{
+		Use:   "import [dir]",
+		Short: "Create Bifrost.toml from a package.json, Cargo.toml or requirements.txt",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			dir := "."
+			if len(args) == 1 {
+				dir = args[0]
+			}
+			mappingPath, _ := cmd.Flags().GetString("mapping")
+			force, _ := cmd.Flags().GetBool("force")
+
+			target := filepath.Join(dir, manifest.FileName)
+			if _, err := os.Stat(target); err == nil && !force {
+				cmd.PrintErrf("Error: %s already exists; pass --force to overwrite it\n", target)
+				os.Exit(1)
+			}
+
+			if mappingPath == "" {
+				candidate := filepath.Join(dir, migrate.MappingFileName)
+				if _, err := os.Stat(candidate); err == nil {
+					mappingPath = candidate
+				}
+			}
+			var mapping migrate.Mapping
+			if mappingPath != "" {
+				var err error
+				if mapping, err = migrate.LoadMapping(mappingPath); err != nil {
+					cmd.PrintErrf("Error loading mapping: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			result, err := migrate.Import(dir, mapping)
+			if err != nil {
+				cmd.PrintErrf("Error importing: %v\n", err)
+				os.Exit(1)
+			}
+			if err := result.Manifest.Save(target); err != nil {
+				cmd.PrintErrf("Error writing %s: %v\n", target, err)
+				os.Exit(1)
+			}
+
+			cmd.Printf("Created %s from %s with %d dependencies and %d dev dependencies\n", target, result.Source,
+				len(result.Manifest.Dependencies), len(result.Manifest.DevDependencies))
+			for _, w := range result.Warnings {
+				warn.Printf(warn.Package, "%s", w)
+			}
+			if len(result.Unmapped) > 0 {
+				cmd.Printf("No mapping for %d %s dependencies, kept under their own names: %s\n",
+					len(result.Unmapped), result.Ecosystem, strings.Join(result.Unmapped, ", "))
+				cmd.Printf("Map them to Carrion packages in the [%s] table of %s\n", result.Ecosystem, migrate.MappingFileName)
+			}
+		},
+	}
+	importCmd.Flags().String("mapping", "", "Dependency name mapping file (default: "+migrate.MappingFileName+" in the imported directory)")
+	importCmd.Flags().Bool("force", false, "Overwrite an existing Bifrost.toml")
+	root.AddCommand(importCmd)
+
+	// Install command
+	installCmd := &cobra.Command{
+		Use:   "install [package...]",
+		Short: "Install dependencies",
+		Run: func(cmd *cobra.Command, args []string) {
+			installer := install.New(cfg)
+			installer.SetPolicy(orgPolicy)
+			installer.SetProject(projectDir())
+			if from, _ := cmd.Flags().GetString("from"); from != "" {
+				if cmd.Flags().Changed("registry") {
+					cmd.PrintErrln("Error: --from and --registry cannot be combined")
+					os.Exit(1)
+				}
+				registryConfig, err := cfg.GetNamedRegistryConfig(from)
+				if err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				if err := cfg.OverrideRegistryURL(registryConfig.URL); err != nil {
+					cmd.PrintErrf("Error: registry %s: %v\n", from, err)
+					os.Exit(1)
+				}
+				installer.SetClient(namedRegistryClient(cfg, config.NamedRegistry{Name: from, RegistryConfig: *registryConfig}))
+			}
+			location, err := scopeLocation(cmd)
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			global := location == uninstall.LocationGlobal
+			user := location == uninstall.LocationUser
+			planOnly, _ := cmd.Flags().GetBool("plan")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			asJSON, _ := cmd.Flags().GetBool("json")
+			keepGoing, _ := cmd.Flags().GetBool("keep-going")
+			installer.SetKeepGoing(keepGoing)
+			withDocs, _ := cmd.Flags().GetBool("with-docs")
+			installer.SetWithDocs(withDocs)
+			if asOf, _ := cmd.Flags().GetString("as-of"); asOf != "" {
+				if cmd.Flags().Changed("frozen-lockfile") || cmd.Flags().Changed("from-freeze") {
+					cmd.PrintErrln("Error: --as-of resolves versions and cannot be combined with --frozen-lockfile or --from-freeze")
+					os.Exit(1)
+				}
+				t, err := install.ParseAsOf(asOf)
+				if err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				installer.SetAsOf(t)
+			}
+			if target, _ := cmd.Flags().GetString("target"); target != "" {
+				if err := install.ValidateTarget(target); err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				installer.SetTarget(target)
+			}
+			if err := applyDownloadLimits(cmd, cfg, installer); err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if err := applyTransparencyLog(cfg, installer); err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if err := applyScriptPolicy(cmd, cfg, installer); err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if carrionVersion, _ := cmd.Flags().GetString("carrion-version"); carrionVersion != "" {
+				if err := manifest.ValidateVersion(carrionVersion); err != nil {
+					cmd.PrintErrf("Error: --carrion-version: %v\n", err)
+					os.Exit(1)
+				}
+				installer.SetCarrionVersion(carrionVersion)
+			}
+			ignoreCarrion, _ := cmd.Flags().GetBool("ignore-carrion-version")
+			installer.SetIgnoreCarrionVersion(ignoreCarrion)
+			if err := applyFileModes(cfg, installer); err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			progressOut := os.Stdout
+			if asJSON {
+				// Keep stdout for the JSON report
+				progressOut = os.Stderr
+			}
+			installer.SetOutput(progressOut)
+			installer.SetEventHandler(installProgress(progressOut))
+
+			if (user || global) && len(args) == 0 {
+				cmd.PrintErrf("Error: --%s installs named packages; the dependencies in %s are always installed into the project's carrion_modules\n", location, manifest.FileName)
+				os.Exit(1)
+			}
+
+			if stdlib, _ := cmd.Flags().GetBool("stdlib"); stdlib {
+				if len(args) != 1 || user || location == uninstall.LocationLocal || planOnly || dryRun {
+					cmd.PrintErrln("Error: --stdlib installs one named package into the shared global directory and cannot be combined with --local, --user, --plan or --dry-run")
+					os.Exit(1)
+				}
+				packageName, version := splitPackageRef(args[0])
+				cmd.Printf("Installing %s into the standard library...\n", args[0])
+				if err := installer.InstallStdlib(packageName, version); err != nil {
+					saveReport(cmd, installer.Report(), err)
+					cmd.PrintErrf("Error installing package: %v\n%s", err, explainHint(err))
+					os.Exit(1)
+				}
+				printReport(cmd, installer.Report(), asJSON)
+				return
+			}
+
+			if values, _ := cmd.Flags().GetStringArray("override"); len(values) > 0 {
+				if len(args) > 0 || planOnly || dryRun || cmd.Flags().Changed("frozen-lockfile") || cmd.Flags().Changed("from-freeze") {
+					cmd.PrintErrf("Error: --override substitutes dependencies of an install from %s and cannot be combined with a package argument, --plan, --dry-run, --frozen-lockfile or --from-freeze\n", manifest.FileName)
+					os.Exit(1)
+				}
+				var overrides []install.Override
+				for _, value := range values {
+					o, err := install.ParseOverride(value)
+					if err != nil {
+						cmd.PrintErrf("Error: %v\n", err)
+						os.Exit(1)
+					}
+					overrides = append(overrides, o)
+				}
+				installer.SetOverrides(overrides)
+			}
+
+			if cmd.Flags().Changed("changelog-output") && (len(args) > 0 || cmd.Flags().Changed("frozen-lockfile") || cmd.Flags().Changed("from-freeze")) {
+				cmd.PrintErrln("Error: --changelog-output summarizes the changes of an install from Bifrost.toml and cannot be combined with a package argument, --frozen-lockfile or --from-freeze")
+				os.Exit(1)
+			}
+
+			if fromFreeze, _ := cmd.Flags().GetString("from-freeze"); fromFreeze != "" {
+				if len(args) > 0 {
+					cmd.PrintErrln("Error: --from-freeze cannot be combined with a package argument")
+					os.Exit(1)
+				}
+				entries, err := freeze.Load(fromFreeze)
+				if err != nil {
+					cmd.PrintErrf("Error loading freeze file: %v\n", err)
+					os.Exit(1)
+				}
+
+				cmd.Printf("Installing %d pinned package(s) from %s...\n", len(entries), fromFreeze)
+				if err := installer.InstallFrozen(entries); err != nil {
+					if keepGoing {
+						printReport(cmd, installer.Report(), asJSON)
+					}
+					saveReport(cmd, installer.Report(), err)
+					cmd.PrintErrf("Error installing pinned packages: %v\n%s", err, explainHint(err))
+					os.Exit(1)
+				}
+				printReport(cmd, installer.Report(), asJSON)
+				return
+			}
+
+			// Packages installed into a project are recorded in its manifest
+			// and lockfile unless --no-save is given
+			noSave, _ := cmd.Flags().GetBool("no-save")
+			save := len(args) > 0 && !noSave && !user && !global && !planOnly && !dryRun
+			if save {
+				if _, err := os.Stat(manifestPath()); err != nil {
+					save = false
+				}
+			}
+			if forceSave, _ := cmd.Flags().GetBool("save"); forceSave && !save {
+				cmd.PrintErrf("Error: --save needs a %s in the current directory and cannot be combined with --no-save, --user, --global, --plan or --dry-run\n", manifest.FileName)
+				os.Exit(1)
+			}
+
+			if len(args) == 0 {
+				// Install from Bifrost.toml
+				_, err := manifest.Load(manifestPath())
+				if err != nil {
+					cmd.PrintErrf("Error loading %s: %v\n", manifestPath(), err)
+					os.Exit(1)
+				}
+
+				if planOnly || dryRun {
+					plan, err := installer.PlanManifest(manifestPath())
+					if err != nil {
+						cmd.PrintErrf("Error planning install: %v\n%s", err, explainHint(err))
+						os.Exit(1)
+					}
+					printPlan(cmd, plan, dryRun)
+					return
+				}
+
+				if frozen, _ := cmd.Flags().GetBool("frozen-lockfile"); frozen {
+					lockPath := projectLockPath()
+					if err := verifyLockSignature(cmd, cfg, lockPath); err != nil {
+						cmd.PrintErrf("Error: %v\n%s", err, explainHint(err))
+						os.Exit(1)
+					}
+					cmd.Printf("Installing locked dependencies from %s...\n", lockPath)
+					if err := installer.InstallLocked(manifestPath()); err != nil {
+						if keepGoing {
+							printReport(cmd, installer.Report(), asJSON)
+						}
+						saveReport(cmd, installer.Report(), err)
+						cmd.PrintErrf("Error installing dependencies: %v\n%s", err, explainHint(err))
+						os.Exit(1)
+					}
+					printReport(cmd, installer.Report(), asJSON)
+					refreshEnvFiles(cmd, cfg, manifestPath())
+					return
+				}
+
+				cmd.Printf("Installing dependencies from %s...\n", manifestPath())
+				lock, err := installer.InstallManifest(manifestPath())
+				if err != nil {
+					if keepGoing {
+						printReport(cmd, installer.Report(), asJSON)
+					}
+					saveReport(cmd, installer.Report(), err)
+					cmd.PrintErrf("Error installing dependencies: %v\n%s", err, explainHint(err))
+					os.Exit(1)
+				}
+				if !cmd.Flags().Changed("override") {
+					cmd.Printf("Locked %d package(s) in %s\n", len(lock.Packages), lockfile.FileNameFor(profileFlag))
+				}
+
+				err = installer.InstallLocal(manifestPath())
+				cobra.CheckErr(err)
+				printReport(cmd, installer.Report(), asJSON)
+				refreshEnvFiles(cmd, cfg, manifestPath())
+				if output, _ := cmd.Flags().GetString("changelog-output"); output != "" {
+					writeUpdateSummary(cmd, installer, output)
+				}
+			} else if save {
+				// Record the packages in Bifrost.toml, then install it
+				cmd.Printf("Adding %s to %s...\n", strings.Join(args, ", "), manifestPath())
+				lock, err := installer.AddDependencies(manifestPath(), packageRequests(args))
+				if err != nil {
+					if keepGoing {
+						printReport(cmd, installer.Report(), asJSON)
+					}
+					saveReport(cmd, installer.Report(), err)
+					cmd.PrintErrf("Error installing packages: %v\n%s", err, explainHint(err))
+					os.Exit(1)
+				}
+				cmd.Printf("Locked %d package(s) in %s\n", len(lock.Packages), lockfile.FileNameFor(profileFlag))
+				printReport(cmd, installer.Report(), asJSON)
+				refreshEnvFiles(cmd, cfg, manifestPath())
+			} else if len(args) > 1 {
+				// Install several packages, resolved together
+				if user || global {
+					cmd.PrintErrln("Error: installing several packages at once is only supported into the project; install them one at a time with --user or --global")
+					os.Exit(1)
+				}
+				if planOnly || dryRun {
+					cmd.PrintErrln("Error: --plan and --dry-run take a single package")
+					os.Exit(1)
+				}
+
+				cmd.Printf("Installing %s...\n", strings.Join(args, ", "))
+				if err := installer.InstallPackagesLocalByName(packageRequests(args)); err != nil {
+					if keepGoing {
+						printReport(cmd, installer.Report(), asJSON)
+					}
+					saveReport(cmd, installer.Report(), err)
+					cmd.PrintErrf("Error installing packages: %v\n%s", err, explainHint(err))
+					os.Exit(1)
+				}
+				printReport(cmd, installer.Report(), asJSON)
+			} else {
+				// Install specific package
+				packageName := args[0]
+				version := ""
+
+				// Parse package@version format
+				packageName, version = splitPackageRef(packageName)
+
+				if (planOnly || dryRun) && user {
+					cmd.PrintErrln("Error: --plan and --dry-run are not supported with --user")
+					os.Exit(1)
+				}
+				if planOnly || dryRun {
+					plan, err := installer.PlanPackageByName(packageName, version, global)
+					if err != nil {
+						cmd.PrintErrf("Error planning install: %v\n%s", err, explainHint(err))
+						os.Exit(1)
+					}
+					printPlan(cmd, plan, dryRun)
+					return
+				}
+
+				cmd.Printf("Installing %s", packageName)
+				if version != "" {
+					cmd.Printf("@%s", version)
+				}
+				cmd.Println("...")
+
+				var err error
+				if user {
+					err = installer.InstallPackageUserByName(packageName, version)
+				} else {
+					err = installer.InstallPackageByName(packageName, version, global)
+				}
+				if err != nil {
+					saveReport(cmd, installer.Report(), err)
+					cmd.PrintErrf("Error installing package: %v\n%s", err, explainHint(err))
+					os.Exit(1)
+				}
+				printReport(cmd, installer.Report(), asJSON)
+			}
+		},
+	}
+	installCmd.Flags().Bool("local", false, "Install into the project's carrion_modules (the default)")
+	installCmd.Flags().Bool("user", false, "Install package into the user package directory and link it into the project")
+	installCmd.Flags().BoolP("global", "g", false, "Install package into the shared global package directory")
+	installCmd.Flags().Bool("stdlib", false, "Install a Carrion standard library package into the shared global package directory and make the version the active one")
+	installCmd.Flags().Bool("save", false, "Record the named packages in Bifrost.toml and Bifrost.lock (the default inside a project)")
+	installCmd.Flags().Bool("no-save", false, "Install the named packages without recording them in Bifrost.toml and Bifrost.lock")
+	installCmd.Flags().String("from", "", "Install from the configured registry with this name (see 'bifrost search')")
+	installCmd.Flags().Bool("plan", false, "Print the actions the install would perform as JSON without performing them")
+	installCmd.Flags().Bool("json", false, "Print the install summary as JSON on stdout")
+	installCmd.Flags().Bool("with-docs", false, "Also install the README and docs/ directory of packages, left out by default")
+	installCmd.Flags().String("target", "", "Install the prebuilt archives of packages for this platform, e.g. linux-arm64, instead of the current one ("+install.CurrentTarget()+")")
+	installCmd.Flags().String("as-of", "", "Only resolve versions published by this date (YYYY-MM-DD) or RFC 3339 timestamp, to reproduce an earlier build")
+	installCmd.Flags().String("report", "", "Write a JSON report of what was installed, with checksums, sources, timings and warnings, to this file")
+	installCmd.Flags().String("changelog-output", "", "Write a Markdown summary of the updated packages with their changelogs, for a pull request, to this file or - for stdout")
+	installCmd.Flags().Bool("dry-run", false, "Resolve and print what would change without writing anything")
+	installCmd.Flags().Bool("frozen-lockfile", false, "Install exactly the packages in Bifrost.lock, verifying its signature, and fail if it is out of date")
+	installCmd.Flags().String("from-freeze", "", "Install exactly the packages pinned in a file written by bifrost freeze")
+	installCmd.Flags().StringArray("override", nil, "Substitute a dependency for this install only, with name=version or name=path to a local package directory, leaving Bifrost.toml and Bifrost.lock alone (repeatable)")
+	installCmd.Flags().Bool("keep-going", false, "Keep installing after a package fails instead of rolling back, and report failures at the end")
+	installCmd.Flags().Int("max-concurrent-downloads", install.DefaultMaxConcurrentDownloads, "Number of package archives to download at once (overrides install.max-concurrent-downloads)")
+	installCmd.Flags().String("limit-rate", "", "Cap the combined download rate, e.g. 500K or 1M per second (overrides install.limit-rate)")
+	installCmd.Flags().Bool("strict", false, "Refuse packages with install scripts unless --allow-scripts is given (overrides install.strict)")
+	installCmd.Flags().Bool("allow-scripts", false, "Run the install scripts of packages, which are skipped by default")
+	installCmd.Flags().String("carrion-version", "", "Check packages against this Carrion version instead of the output of 'carrion --version'")
+	installCmd.Flags().Bool("ignore-carrion-version", false, "Install packages that require another Carrion version, with a warning")
+	installCmd.Flags().String("script-timeout", "", "Stop install scripts running longer than this, e.g. 10m, or 0 for no limit (overrides install.script-timeout)")
+	installCmd.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeVersions(cmd, cfg, args, toComplete)
+	}
+	root.AddCommand(installCmd)
+
+	// Fetch command
+	fetchCmd := &cobra.Command{
+		Use:   "fetch",
+		Short: "Download the project's dependencies into the cache without installing them",
+		Long: `Resolve the dependencies in Bifrost.toml and download their archives into
+the cache, without touching carrion_modules or Bifrost.lock. The cache is
+shared by every project and checkout, so a later 'bifrost install' of the
+same versions needs no network. Use it to build warm Docker layers and CI
+caches.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			installer := install.New(cfg)
+			installer.SetPolicy(orgPolicy)
+			if err := applyDownloadLimits(cmd, cfg, installer); err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if err := applyTransparencyLog(cfg, installer); err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			asJSON, _ := cmd.Flags().GetBool("json")
+			progressOut := os.Stdout
+			if asJSON {
+				progressOut = os.Stderr
+			}
+			installer.SetOutput(progressOut)
+			installer.SetEventHandler(installProgress(progressOut))
+
+			fetch := installer.Fetch
+			if frozen, _ := cmd.Flags().GetBool("frozen-lockfile"); frozen {
+				lockPath := projectLockPath()
+				if err := verifyLockSignature(cmd, cfg, lockPath); err != nil {
+					cmd.PrintErrf("Error: %v\n%s", err, explainHint(err))
+					os.Exit(1)
+				}
+				fetch = installer.FetchLocked
+			}
+			pkgs, err := fetch(manifestPath())
+			if err != nil {
+				cmd.PrintErrf("Error fetching dependencies: %v\n%s", err, explainHint(err))
+				os.Exit(1)
+			}
+
+			report := installer.Report()
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(report); err != nil {
+					cmd.PrintErrf("Error encoding report: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+			fmt.Printf("\nFetched %d package(s) into %s\n", len(pkgs), cfg.CacheDir)
+			fmt.Printf("Downloaded %s in %d archive(s), %d cache hit(s)\n",
+				archive.FormatSize(report.BytesDownloaded), len(report.Downloads), report.CacheHits)
+		},
+	}
+	fetchCmd.Flags().Bool("frozen-lockfile", false, "Fetch exactly the packages in Bifrost.lock, verifying its signature, and fail if it is out of date")
+	fetchCmd.Flags().Bool("json", false, "Print the download summary as JSON on stdout")
+	fetchCmd.Flags().Int("max-concurrent-downloads", install.DefaultMaxConcurrentDownloads, "Number of package archives to download at once (overrides install.max-concurrent-downloads)")
+	fetchCmd.Flags().String("limit-rate", "", "Cap the combined download rate, e.g. 500K or 1M per second (overrides install.limit-rate)")
+	root.AddCommand(fetchCmd)
+
+	// Cache command
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Share the package cache between machines",
+		Long: `Export package archives from the cache to a bundle and import them on
+another machine, so laptops and build agents can be seeded without
+downloading from the registry. Bundles record the checksum of every archive,
+and imports refuse archives that do not match it.`,
+	}
+
+	cacheExportCmd := &cobra.Command{
+		Use:   "export <file> [package[@version]...]",
+		Short: "Write cached archives to a bundle",
+		Long: `Write cached archives to a gzipped tarball. With packages, only their
+cached archives are exported; with --lockfile, the archives of everything in
+Bifrost.lock, downloading those not cached yet; otherwise the whole cache.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			installer := install.New(cfg)
+			installer.SetPolicy(orgPolicy)
+			installer.SetOutput(os.Stderr)
+
+			var entries []install.CacheEntry
+			var err error
+			if locked, _ := cmd.Flags().GetBool("lockfile"); locked {
+				if len(args) > 1 {
+					cmd.PrintErrln("Error: --lockfile cannot be combined with packages")
+					os.Exit(1)
+				}
+				entries, err = installer.LockedCacheEntries(manifestPath())
+			} else {
+				entries, err = installer.CacheEntries(args[1:]...)
+			}
+			if err != nil {
+				cmd.PrintErrf("Error selecting cache entries: %v\n%s", err, explainHint(err))
+				os.Exit(1)
+			}
+			if len(entries) == 0 {
+				cmd.PrintErrln("Error: the cache is empty")
+				os.Exit(1)
+			}
+			if err := installer.ExportCache(args[0], entries); err != nil {
+				cmd.PrintErrf("Error exporting cache: %v\n", err)
+				os.Exit(1)
+			}
+
+			var size int64
+			for _, entry := range entries {
+				size += entry.Size
+			}
+			fmt.Printf("Exported %d archive(s), %s, to %s\n", len(entries), archive.FormatSize(size), args[0])
+		},
+	}
+	cacheExportCmd.Flags().Bool("lockfile", false, "Export the archives of the packages in Bifrost.lock")
+	cacheCmd.AddCommand(cacheExportCmd)
+
+	cacheImportCmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Copy the archives of a bundle into the cache",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			installer := install.New(cfg)
+			if err := applyTransparencyLog(cfg, installer); err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			imported, existing, err := installer.ImportCache(args[0])
+			if err != nil {
+				cmd.PrintErrf("Error importing cache: %v\n", err)
+				os.Exit(1)
+			}
+			for _, entry := range imported {
+				fmt.Printf("Imported %s\n", entry.File)
+			}
+			fmt.Printf("Imported %d archive(s) into %s, %d already cached\n", len(imported), cfg.CacheDir, len(existing))
+		},
+	}
+	cacheCmd.AddCommand(cacheImportCmd)
+	root.AddCommand(cacheCmd)
+
+	// Lock command
+	lockCmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Sign and verify Bifrost.lock",
+		Long: `Sign Bifrost.lock with a project key so that changes to pinned versions or
+checksums made without the key fail 'bifrost install --frozen-lockfile'.
+The public key is committed as ` + locksign.PublicKeyFileName + ` and the signature as
+` + lockfile.FileName + locksign.SignatureSuffix + `. Installs re-sign the lockfile whenever they change it
+and the private key is available.`,
+	}
+
+	lockKeygenCmd := &cobra.Command{
+		Use:   "keygen",
+		Short: "Create a signing key for this project and sign its lockfile",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			lockPath := projectLockPath()
+			pubPath := locksign.PublicKeyPath(lockPath)
+			if force, _ := cmd.Flags().GetBool("force"); !force {
+				if _, err := os.Stat(pubPath); err == nil {
+					cmd.PrintErrf("Error: %s already exists; pass --force to replace the project key\n", pubPath)
+					os.Exit(1)
+				}
+			}
+
+			pub, priv, err := locksign.GenerateKey()
+			if err != nil {
+				cmd.PrintErrf("Error generating key: %v\n", err)
+				os.Exit(1)
+			}
+			keyPath, err := locksign.SavePrivateKey(cfg, priv)
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if err := os.WriteFile(pubPath, []byte(locksign.Encode(pub)+"\n"), 0644); err != nil {
+				cmd.PrintErrf("Error writing public key: %v\n", err)
+				os.Exit(1)
+			}
+			// Frozen installs here trust the key without taking the
+			// committed copy's word for it
+			userConfig, err := cfg.LoadUserConfig()
+			if err != nil {
+				cmd.PrintErrf("Error loading config: %v\n", err)
+				os.Exit(1)
+			}
+			userConfig.Lock.Keys = append(userConfig.Lock.Keys, locksign.Encode(pub))
+			if err := cfg.SaveUserConfig(userConfig); err != nil {
+				cmd.PrintErrf("Error saving config: %v\n", err)
+				os.Exit(1)
+			}
+			cmd.Printf("Created key %s\n", locksign.Fingerprint(pub))
+			cmd.Printf("  public key:  %s (commit this)\n", pubPath)
+			cmd.Printf("  private key: %s (keep this secret)\n", keyPath)
+			cmd.Printf("  pinned in lock.keys of %s\n", cfg.ConfigFile)
+
+			if _, err := os.Stat(lockPath); err == nil {
+				if err := locksign.Sign(lockPath, priv); err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				cmd.Printf("Signed %s\n", lockPath)
+			}
+			cmd.Printf("\nTo sign in CI, set %s to the contents of the private key.\n", locksign.PrivateKeyEnv)
+			cmd.Printf("Frozen installs only trust %s once the key is pinned outside the project.\n", locksign.PublicKeyFileName)
+			cmd.Printf("Elsewhere, run 'bifrost config set lock.keys %s' or set %s to it.\n",
+				locksign.Encode(pub), locksign.PublicKeyEnv)
+		},
+	}
+	lockKeygenCmd.Flags().Bool("force", false, "Replace an existing project key")
+	lockCmd.AddCommand(lockKeygenCmd)
+
+	lockCmd.AddCommand(&cobra.Command{
+		Use:   "sign",
+		Short: "Sign Bifrost.lock with the project key",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			lockPath := projectLockPath()
+			signed, err := locksign.Resign(cfg, lockPath)
+			if err != nil {
+				cmd.PrintErrf("Error signing %s: %v\n", lockPath, err)
+				os.Exit(1)
+			}
+			if !signed {
+				cmd.PrintErrf("Error: %s not found; create a project key with 'bifrost lock keygen'\n", locksign.PublicKeyPath(lockPath))
+				os.Exit(1)
+			}
+			cmd.Printf("Signed %s\n", lockPath)
+		},
+	})
+
+	lockCmd.AddCommand(&cobra.Command{
+		Use:   "verify",
+		Short: "Verify the signature of Bifrost.lock",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			lockPath := projectLockPath()
+			pub, err := locksign.LoadPublicKey(lockPath)
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if pub == nil {
+				cmd.PrintErrf("Error: %s not found and %s is not set; the lockfile is not signed\n", locksign.PublicKeyPath(lockPath), locksign.PublicKeyEnv)
+				os.Exit(1)
+			}
+			if err := verifyLockSignature(cmd, cfg, lockPath); err != nil {
+				cmd.PrintErrf("Error: %v\n%s", err, explainHint(err))
+				os.Exit(1)
+			}
+		},
+	})
+	root.AddCommand(lockCmd)
+
+	// Trust command
+	trustCmd := &cobra.Command{
+		Use:   "trust",
+		Short: "Manage remembered install script decisions",
+		Long: `Install scripts are skipped unless allowed. In strict mode, installing a
+package with install scripts from a terminal asks whether they may run. The
+answer is remembered per package version in ` + cfg.TrustPath() + `,
+so installing that version again does not ask again, and a denied version is
+refused in any mode until the decision is revoked. --allow-scripts runs scripts regardless of remembered decisions.`,
+	}
+
+	trustListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List remembered install script decisions",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			store, err := trust.Load(cfg.TrustPath())
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				decisions := store.Decisions
+				if decisions == nil {
+					decisions = []trust.Decision{}
+				}
+				if err := enc.Encode(decisions); err != nil {
+					cmd.PrintErrf("Error encoding decisions: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+			if len(store.Decisions) == 0 {
+				cmd.Println("No install script decisions remembered")
+				return
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "PACKAGE\tDECISION\tDECIDED")
+			for _, d := range store.Decisions {
+				decision := "deny"
+				if d.Allow {
+					decision = "allow"
+				}
+				fmt.Fprintf(w, "%s@%s\t%s\t%s\n", d.Package, d.Version, decision, d.DecidedAt.Local().Format("2006-01-02 15:04"))
+			}
+			w.Flush()
+		},
+	}
+	trustListCmd.Flags().Bool("json", false, "Print the decisions as JSON")
+	trustCmd.AddCommand(trustListCmd)
+
+	trustCmd.AddCommand(&cobra.Command{
+		Use:   "revoke <package>[@version]",
+		Short: "Forget install script decisions so the next install asks again",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name, version := splitPackageRef(args[0])
+			store, err := trust.Load(cfg.TrustPath())
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			revoked := store.Revoke(name, version)
+			if len(revoked) == 0 {
+				cmd.PrintErrf("Error: no install script decision remembered for %s\n", args[0])
+				os.Exit(1)
+			}
+			if err := store.Save(cfg.TrustPath()); err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			for _, d := range revoked {
+				cmd.Printf("Revoked decision for %s@%s\n", d.Package, d.Version)
+			}
+		},
+	})
+	root.AddCommand(trustCmd)
+
+	// Verify command
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check installed packages against their archives",
+		Long: `Compare the files of every package in Bifrost.lock, as installed, with the
+archive of its version. By default the archives come from the cache and must
+still match the lockfile's checksums. With --remote they are downloaded from
+the registry again and the checksum the registry lists now is compared with
+the lockfile's, which catches an upload modified after the lockfile was
+written.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			remote, _ := cmd.Flags().GetBool("remote")
+			asJSON, _ := cmd.Flags().GetBool("json")
+
+			installer := install.New(cfg)
+			results, err := installer.Verify(manifestPath(), remote)
+			if err != nil {
+				cmd.PrintErrf("Error verifying packages: %v\n%s", err, explainHint(err))
+				os.Exit(1)
+			}
+
+			failed := 0
+			for _, r := range results {
+				if !r.OK() {
+					failed++
+				}
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(results); err != nil {
+					cmd.PrintErrf("Error encoding results: %v\n", err)
+					os.Exit(1)
+				}
+			} else {
+				printVerifyResults(os.Stdout, results)
+				fmt.Printf("%d of %d package(s) verified\n", len(results)-failed, len(results))
+			}
+			if failed > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+	verifyCmd.Flags().Bool("remote", false, "Compare with the archives the registry serves now instead of the cache")
+	verifyCmd.Flags().Bool("json", false, "Print the results as JSON")
+	root.AddCommand(verifyCmd)
+
+	// Docs command
+	docsCmd := &cobra.Command{
+		Use:   "docs <package>",
+		Short: "Show the documentation of an installed package",
+		Long: `Print the README of a dependency in Bifrost.lock, or docs/index.md when it
+has no README. Packages installed without --with-docs are read from their
+archive. With --open the file is opened in the default viewer instead.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			installer := install.New(cfg)
+			installer.SetPolicy(orgPolicy)
+			installer.SetOutput(os.Stderr)
+			doc, err := installer.Docs(manifestPath(), args[0])
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n%s", err, explainHint(err))
+				os.Exit(1)
+			}
+
+			if open, _ := cmd.Flags().GetBool("open"); !open {
+				os.Stdout.Write(doc.Content)
+				return
+			}
+			path := doc.Path
+			if path == "" {
+				// Not installed, so open a copy taken from the archive
+				dir, err := os.MkdirTemp("", "bifrost-docs-")
+				if err == nil {
+					path = filepath.Join(dir, filepath.Base(doc.Name))
+					err = os.WriteFile(path, doc.Content, 0644)
+				}
+				if err != nil {
+					cmd.PrintErrf("Error writing %s: %v\n", doc.Name, err)
+					os.Exit(1)
+				}
+			}
+			if err := openURL(path); err != nil {
+				cmd.PrintErrf("Error opening %s: %v\n", path, err)
+				os.Exit(1)
+			}
+		},
+	}
+	docsCmd.Flags().Bool("open", false, "Open the documentation in the default viewer instead of printing it")
+	root.AddCommand(docsCmd)
+
+	// Open command
+	openCmd := &cobra.Command{
+		Use:   "open <package>[@version]",
+		Short: "Open the repository or homepage of a package",
+		Long: `Open the repository of a package in the browser, or its homepage when it
+declares no repository. The installed version of a dependency in Bifrost.lock
+is used when no version is given, otherwise the registry is asked.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name, version := splitPackageRef(args[0])
+			installer := install.New(cfg)
+			installer.SetPolicy(orgPolicy)
+			target, err := installer.ProjectURL(manifestPath(), name, version)
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n%s", err, explainHint(err))
+				os.Exit(1)
+			}
+
+			if printOnly, _ := cmd.Flags().GetBool("print"); printOnly {
+				fmt.Println(target)
+				return
+			}
+			if err := openURL(target); err != nil {
+				cmd.PrintErrf("Error opening %s: %v\n", target, err)
+				os.Exit(1)
+			}
+		},
+	}
+	openCmd.Flags().Bool("print", false, "Print the URL instead of opening it")
+	root.AddCommand(openCmd)
+
+	// Grep command
+	grepCmd := &cobra.Command{
+		Use:   "grep <pattern> [package...]",
+		Short: "Search the source of installed dependencies",
+		Long: `Search the files of the dependencies in Bifrost.lock, or only of the packages
+named, for lines matching a regular expression, printing them as
+file:line: text. Hidden and binary files are skipped. Exits with status 1
+when nothing matches.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			pattern := args[0]
+			if fixed, _ := cmd.Flags().GetBool("fixed-strings"); fixed {
+				pattern = regexp.QuoteMeta(pattern)
+			}
+			if ignoreCase, _ := cmd.Flags().GetBool("ignore-case"); ignoreCase {
+				pattern = "(?i)" + pattern
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				cmd.PrintErrf("Error: invalid pattern: %v\n", err)
+				os.Exit(1)
+			}
+
+			installer := install.New(cfg)
+			matches, err := installer.Grep(manifestPath(), re, args[1:]...)
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n%s", err, explainHint(err))
+				os.Exit(1)
+			}
+			for _, m := range matches {
+				fmt.Printf("%s:%d: %s\n", m.File, m.Line, m.Text)
+			}
+			if len(matches) == 0 {
+				os.Exit(1)
+			}
+		},
+	}
+	grepCmd.Flags().BoolP("ignore-case", "i", false, "Match regardless of case")
+	grepCmd.Flags().BoolP("fixed-strings", "F", false, "Treat the pattern as a literal string")
+	root.AddCommand(grepCmd)
+
+	// Freeze command
+	freezeCmd := &cobra.Command{
+		Use:   "freeze",
+		Short: "Print the locked packages as a pinned name==version list",
+		Run: func(cmd *cobra.Command, args []string) {
+			output, _ := cmd.Flags().GetString("output")
+
+			manifestPath, err := findManifest()
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			m, err := manifest.Load(manifestPath)
+			if err == nil {
+				m, err = m.WithProfile(profileFlag)
+			}
+			if err != nil {
+				cmd.PrintErrf("Error loading manifest: %v\n", err)
+				os.Exit(1)
+			}
+			// A pinned list from a lockfile the manifest moved away from
+			// would pin versions the project no longer uses
+			lockPath := filepath.Join(filepath.Dir(manifestPath), lockfile.FileNameFor(profileFlag))
+			lock, err := lockfile.LoadCurrent(lockPath, m)
+			if err != nil {
+				cmd.PrintErrf("Error loading lockfile: %v\n%s", err, explainHint(err))
+				os.Exit(1)
+			}
+			if lock == nil {
+				cmd.PrintErrf("Error: %s not found; run 'bifrost install' first\n", lockPath)
+				os.Exit(1)
+			}
+
+			w := os.Stdout
+			if output != "" {
+				f, err := os.Create(output)
+				if err != nil {
+					cmd.PrintErrf("Error creating %s: %v\n", output, err)
+					os.Exit(1)
+				}
+				defer f.Close()
+				w = f
+			}
+			if err := freeze.Write(w, freeze.FromLockfile(lock)); err != nil {
+				cmd.PrintErrf("Error writing freeze file: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	freezeCmd.Flags().StringP("output", "o", "", "Write the list to a file instead of stdout")
+	root.AddCommand(freezeCmd)
+
+	// Uninstall command
+	uninstallCmd := &cobra.Command{
+		Use:   "uninstall [package]",
+		Short: "Uninstall packages",
+		Run: func(cmd *cobra.Command, args []string) {
+			uninstaller := uninstall.New(cfg)
+			uninstaller.SetProject(projectDir())
+			location, err := scopeLocation(cmd)
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			all, _ := cmd.Flags().GetBool("all")
+			clean, _ := cmd.Flags().GetBool("clean")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			yes, _ := cmd.Flags().GetBool("yes")
+			force, _ := cmd.Flags().GetBool("force")
+			uninstaller.SetForce(force)
+
+			if clean {
+				if dryRun {
+					removals, err := uninstaller.PlanCleanCache()
+					if err != nil {
+						cmd.PrintErrf("Error planning cache clean: %v\n", err)
+						os.Exit(1)
+					}
+					printRemovals(removals)
+					return
+				}
+				if !yes {
+					removals, err := uninstaller.PlanCleanCache()
+					if err != nil {
+						cmd.PrintErrf("Error planning cache clean: %v\n", err)
+						os.Exit(1)
+					}
+					confirmRemovals(cmd, "Clean the package cache", removals)
+				}
+				err := uninstaller.CleanCache()
+				if err != nil {
+					cmd.PrintErrf("Error cleaning cache: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+
+			if len(args) == 0 {
+				if all {
+					cmd.PrintErrln("Error: --all flag requires specifying a package name")
+					os.Exit(1)
+				}
+				if location == uninstall.LocationUser || location == uninstall.LocationGlobal {
+					cmd.PrintErrf("Error: --%s uninstalls named packages; the dependencies in %s are uninstalled from the project's carrion_modules\n", location, manifest.FileName)
+					os.Exit(1)
+				}
+				
+				// Uninstall from Bifrost.toml
+				_, err := manifest.Load(manifestPath())
+				if err != nil {
+					cmd.PrintErrf("Error loading %s: %v\n", manifestPath(), err)
+					os.Exit(1)
+				}
+
+				if dryRun {
+					removals, err := uninstaller.PlanManifest(manifestPath())
+					if err != nil {
+						cmd.PrintErrf("Error planning uninstall: %v\n", err)
+						os.Exit(1)
+					}
+					printRemovals(removals)
+					return
+				}
+				if !yes {
+					removals, err := uninstaller.PlanManifest(manifestPath())
+					if err != nil {
+						cmd.PrintErrf("Error planning uninstall: %v\n", err)
+						os.Exit(1)
+					}
+					confirmRemovals(cmd, "Uninstall all dependencies from "+manifestPath(), removals)
+				}
+
+				cmd.Printf("Uninstalling dependencies from %s...\n", manifestPath())
+				err = uninstaller.UninstallFromManifest(manifestPath())
+				if err != nil {
+					cmd.PrintErrf("Error uninstalling dependencies: %v\n", err)
+					os.Exit(1)
+				}
+			} else {
+				// Uninstall specific package
+				packageName := args[0]
+				version := ""
+
+				if !all {
+					// Parse package@version format
+					packageName, version = splitPackageRef(packageName)
+				}
+
+				if value, _ := cmd.Flags().GetString("location"); value != "" {
+					loc, err := uninstall.ParseLocation(value)
+					if err != nil {
+						cmd.PrintErrf("Error: %v\n", err)
+						os.Exit(1)
+					}
+					if location != "" && loc != location {
+						cmd.PrintErrf("Error: --%s cannot be combined with --location %s\n", location, value)
+						os.Exit(1)
+					}
+					location = loc
+				}
+
+				// Show every installed copy before removing any, so the
+				// wrong one is not removed by surprise
+				removals, planErr := uninstaller.PlanAt(packageName, version, location)
+				if installed := uninstaller.Installed(packageName); len(installed) > 0 {
+					uninstall.PrintInstalled(os.Stdout, packageName, installed, removals)
+				}
+				if dryRun {
+					if planErr != nil {
+						cmd.PrintErrf("Error planning uninstall: %v\n", planErr)
+						os.Exit(1)
+					}
+					printRemovals(removals)
+					return
+				}
+				// Removing every version of a package needs confirmation
+				if version == "" && !yes {
+					if planErr != nil {
+						cmd.PrintErrf("Error uninstalling package: %v\n", planErr)
+						os.Exit(1)
+					}
+					confirmRemovals(cmd, fmt.Sprintf("Uninstall every version of %s", packageName), removals)
+				}
+
+				err := uninstaller.UninstallAt(packageName, version, location)
+				if err != nil {
+					cmd.PrintErrf("Error uninstalling package: %v\n", err)
+					os.Exit(1)
+				}
+			}
+		},
+	}
+	uninstallCmd.Flags().Bool("local", false, "Uninstall from the project's carrion_modules")
+	uninstallCmd.Flags().Bool("user", false, "Uninstall from the user package directory")
+	uninstallCmd.Flags().BoolP("global", "g", false, "Uninstall package globally")
+	uninstallCmd.Flags().BoolP("all", "a", false, "Uninstall all versions of the package")
+	uninstallCmd.Flags().BoolP("clean", "c", false, "Clean package cache")
+	uninstallCmd.Flags().Bool("dry-run", false, "Print what would be removed without removing anything")
+	uninstallCmd.Flags().BoolP("yes", "y", false, "Remove without asking for confirmation")
+	uninstallCmd.Flags().Bool("force", false, "Remove global packages even if other projects still use them")
+	uninstallCmd.Flags().String("location", "", "Where to uninstall from: local, user, global or all (default: carrion_modules, else the user package directory)")
+	root.AddCommand(uninstallCmd)
+
+	// GC command
+	gcCmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove global packages no project uses any more",
+		Long: `Remove global package versions no project references any more, links in
+carrion_modules to package versions that were removed, and package and
+version directories left empty. With --cache, cached archives of package
+versions no configured registry has are removed too.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			uninstaller := uninstall.New(cfg)
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			yes, _ := cmd.Flags().GetBool("yes")
+
+			removals, err := uninstaller.PlanGC()
+			if err != nil {
+				cmd.PrintErrf("Error planning gc: %v\n", err)
+				os.Exit(1)
+			}
+			stale := uninstaller.PlanStale()
+			if checkCache, _ := cmd.Flags().GetBool("cache"); checkCache {
+				registries, err := cfg.GetRegistries()
+				if err != nil {
+					cmd.PrintErrf("Error loading registry config: %v\n", err)
+					os.Exit(1)
+				}
+				clients := make([]*registry.Client, 0, len(registries))
+				for _, r := range registries {
+					clients = append(clients, namedRegistryClient(cfg, r))
+				}
+				orphaned, err := uninstaller.PlanOrphanedCache(clients)
+				if err != nil {
+					cmd.PrintErrf("Error checking the cache: %v\n", err)
+					os.Exit(1)
+				}
+				stale = append(stale, orphaned...)
+			}
+
+			all := append(append([]uninstall.Removal{}, removals...), stale...)
+			if dryRun {
+				printRemovals(all)
+				return
+			}
+			if len(all) == 0 {
+				cmd.Println("No unreferenced global packages or stale entries")
+				return
+			}
+			if err := cfg.CheckStoreWrite(); err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if !yes {
+				confirmRemovals(cmd, "Remove unreferenced global packages and stale entries", all)
+			}
+
+			removed, err := uninstaller.GC()
+			if err != nil {
+				cmd.PrintErrf("Error running gc: %v\n", err)
+				os.Exit(1)
+			}
+			cmd.Printf("Removed %d unreferenced global package version(s)\n", len(removed))
+			if len(stale) > 0 {
+				n, err := uninstaller.RemoveStale(stale)
+				cmd.Printf("Removed %d stale item(s)\n", n)
+				if err != nil {
+					cmd.PrintErrf("Error removing stale entries: %v\n", err)
+					os.Exit(1)
+				}
+			}
+		},
+	}
+	gcCmd.Flags().Bool("dry-run", false, "Print what would be removed without removing anything")
+	gcCmd.Flags().Bool("cache", false, "Also remove cached archives of versions no configured registry has")
+	gcCmd.Flags().BoolP("yes", "y", false, "Remove without asking for confirmation")
+	root.AddCommand(gcCmd)
+
+	// List command
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List installed packages",
+		Run: func(cmd *cobra.Command, args []string) {
+			location, err := scopeLocation(cmd)
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if location == "" {
+				location = uninstall.LocationAll
+			}
+			uninstaller := uninstall.New(cfg)
+			if err := uninstaller.ListInstalledPackages(location); err != nil {
+				cmd.PrintErrf("Error listing packages: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	listCmd.Flags().Bool("local", false, "List only the project's carrion_modules")
+	listCmd.Flags().Bool("user", false, "List only the user package directory")
+	listCmd.Flags().BoolP("global", "g", false, "List globally installed packages")
+	root.AddCommand(listCmd)
+
+	// Stats command
+	statsCmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Summarize local cache and package disk usage",
+		Long: `Summarize the size of the download cache, the packages installed in the
+project, user and global locations, and how disk usage changed since
+earlier runs. With --projects, lockfiles below a directory are scanned for
+the dependencies your projects use most. Everything is computed locally and
+nothing leaves the machine.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			projectsRoot, _ := cmd.Flags().GetString("projects")
+			top, _ := cmd.Flags().GetInt("top")
+			noRecord, _ := cmd.Flags().GetBool("no-record")
+			asJSON, _ := cmd.Flags().GetBool("json")
+
+			s, err := stats.Collect(cfg, projectsRoot)
+			if err != nil {
+				cmd.PrintErrf("Error collecting stats: %v\n", err)
+				os.Exit(1)
+			}
+			if !noRecord {
+				if err := stats.Record(cfg, s, time.Now()); err != nil {
+					warn.Printf(warn.FileError(err), "%v", err)
+				}
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(s); err != nil {
+					cmd.PrintErrf("Error encoding stats: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+			printStats(cmd.OutOrStdout(), s, projectsRoot, top)
+		},
+	}
+	statsCmd.Flags().String("projects", "", "Scan lockfiles of projects below this directory for the most used dependencies")
+	statsCmd.Flags().Int("top", 10, "Number of most used dependencies to show")
+	statsCmd.Flags().Bool("no-record", false, "Do not add this run to the disk usage history")
+	statsCmd.Flags().Bool("json", false, "Output the stats as JSON")
+	root.AddCommand(statsCmd)
+
+	// Paths command
+	pathsCmd := &cobra.Command{
+		Use:   "paths [name]",
+		Short: "Show the directories and files Bifrost uses",
+		Long: `List every directory and file Bifrost uses: its home, configuration and
+credentials, the download cache, user and global packages, the directory
+of the bifrost executable, the organization policy and, inside a project,
+its modules directory. Given a name, print only that path, for scripts.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			locations := cfg.Locations(projectDir())
+			if exe, err := os.Executable(); err == nil {
+				locations = append(locations, config.NewLocation("bin", filepath.Dir(exe), "Directory of the bifrost executable"))
+			}
+			locations = append(locations, config.NewLocation("policy", policy.DefaultPath(), "Organization policy"))
+
+			if len(args) == 1 {
+				for _, l := range locations {
+					if l.Name == args[0] {
+						cmd.Println(l.Path)
+						return
+					}
+				}
+				cmd.PrintErrf("Error: unknown path %q; run 'bifrost paths' to list them\n", args[0])
+				os.Exit(1)
+			}
+
+			if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(locations); err != nil {
+					cmd.PrintErrf("Error encoding paths: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			for _, l := range locations {
+				path := l.Path
+				if !l.Exists {
+					path += " (not created)"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", l.Name, path, l.Description)
+			}
+			w.Flush()
+		},
+	}
+	pathsCmd.Flags().Bool("json", false, "Print the paths as JSON")
+	root.AddCommand(pathsCmd)
+
+	// Env command
+	envCmd := &cobra.Command{
+		Use:   "env",
+		Short: "Print or write the environment for running the project",
+		Long: `Print the environment variables running the current project needs — the
+Carrion home, CARRION_IMPORT_PATH and the Carrion version the manifest
+requires — as export lines for eval "$(bifrost env)". --dotenv writes them
+to .env and --direnv to .envrc in the project directory; 'bifrost install'
+keeps the files it generated up to date.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			dir := projectDir()
+			if dir == "" {
+				dir = "."
+			}
+			ci := integration.New(cfg)
+			vars := ci.Environment(dir)
+
+			dotenv, _ := cmd.Flags().GetBool("dotenv")
+			direnv, _ := cmd.Flags().GetBool("direnv")
+			if !dotenv && !direnv {
+				if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+					enc := json.NewEncoder(cmd.OutOrStdout())
+					enc.SetIndent("", "  ")
+					if err := enc.Encode(vars); err != nil {
+						cmd.PrintErrf("Error encoding environment: %v\n", err)
+						os.Exit(1)
+					}
+					return
+				}
+				for _, v := range vars {
+					cmd.Printf("export %s=%s\n", v.Name, integration.ShellQuote(v.Value))
+				}
+				return
+			}
+
+			force, _ := cmd.Flags().GetBool("force")
+			var files []string
+			if dotenv {
+				files = append(files, integration.DotenvFile)
+			}
+			if direnv {
+				files = append(files, integration.EnvrcFile)
+			}
+			for _, name := range files {
+				path, err := ci.WriteEnvFile(dir, name, vars, force)
+				if err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				cmd.Printf("Wrote %s\n", path)
+			}
+			if direnv {
+				cmd.Println("Run 'direnv allow' to load it")
+			}
+		},
+	}
+	envCmd.Flags().Bool("dotenv", false, "Write the environment to .env in the project directory")
+	envCmd.Flags().Bool("direnv", false, "Write the environment to .envrc in the project directory, for direnv")
+	envCmd.Flags().Bool("force", false, "Replace .env or .envrc files not generated by bifrost")
+	envCmd.Flags().Bool("json", false, "Print the environment as JSON")
+	root.AddCommand(envCmd)
+
+	// Doctor command
+	doctorCmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Clean up installs and uninstalls interrupted by a crash",
+		Run: func(cmd *cobra.Command, args []string) {
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			j := journal.Open(cfg.JournalPath())
+
+			var entries []journal.Entry
+			var err error
+			if dryRun {
+				entries, err = j.Interrupted()
+			} else {
+				entries, err = j.Recover()
+			}
+			if err != nil {
+				cmd.PrintErrf("Error checking the transaction journal: %v\n", err)
+				os.Exit(1)
+			}
+
+			if stale := uninstall.New(cfg).PlanStale(); len(stale) > 0 {
+				cmd.Printf("Found %d stale item(s), dangling links or empty package directories; run 'bifrost gc' to remove them\n", len(stale))
+			}
+			if len(entries) == 0 {
+				cmd.Println("No interrupted operations found")
+				return
+			}
+			for _, e := range entries {
+				cmd.Printf("Interrupted %s started %s:\n", e.Op, e.Time.Local().Format(time.RFC3339))
+				for _, p := range e.Paths {
+					cmd.Printf("  %s\n", p)
+				}
+			}
+			if dryRun {
+				cmd.Printf("%d interrupted operation(s) would be cleaned up\n", len(entries))
+				return
+			}
+			cmd.Printf("Cleaned up %d interrupted operation(s)\n", len(entries))
+		},
+	}
+	doctorCmd.Flags().Bool("dry-run", false, "List interrupted operations without cleaning them up")
+	root.AddCommand(doctorCmd)
+
+	// Ping command
+	pingCmd := &cobra.Command{
+		Use:   "ping [registry-url...]",
+		Short: "Check registry reachability, TLS, credentials and latency",
+		Long: `Time DNS lookup, connection, TLS handshake and a health request against
+the configured registry (or the URLs given), and check the configured
+credentials. Credentials are only sent to the configured registry.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			asJSON, _ := cmd.Flags().GetBool("json")
+
+			registryConfig, err := cfg.GetRegistryConfig()
+			if err != nil {
+				cmd.PrintErrf("Error loading registry config: %v\n", err)
+				os.Exit(1)
+			}
+			urls := args
+			if len(urls) == 0 {
+				urls = []string{registryConfig.URL}
+			}
+
+			var results []*registry.PingResult
+			for _, url := range urls {
+				client := registry.NewClient(url)
+				if strings.TrimRight(url, "/") == strings.TrimRight(registryConfig.URL, "/") {
+					authorizeClient(cfg, client, registryConfig)
+				}
+				results = append(results, client.Ping())
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(results); err != nil {
+					cmd.PrintErrf("Error encoding results: %v\n", err)
+					os.Exit(1)
+				}
+			} else {
+				tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(tw, "REGISTRY\tDNS\tCONNECT\tTLS\tLATENCY\tAUTH\tSTATUS")
+				for _, r := range results {
+					status := r.Status
+					if r.Error != "" {
+						status = "error: " + r.Error
+					}
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.URL,
+						formatPhase(r.DNS), formatPhase(r.Connect), formatPhase(r.TLS), formatPhase(r.Latency), r.Auth, status)
+				}
+				tw.Flush()
+			}
+
+			for _, r := range results {
+				if !r.OK() {
+					os.Exit(1)
+				}
+			}
+		},
+	}
+	pingCmd.Flags().Bool("json", false, "Print the results as JSON")
+	root.AddCommand(pingCmd)
+
+	// Registry command
+	registryCmd := &cobra.Command{
+		Use:   "registry",
+		Short: "Inspect the registry",
+	}
+	registryStatusCmd := &cobra.Command{
+		Use:   "status [registry-url]",
+		Short: "Show what the registry supports",
+		Long: `Show the registry's health, server version, the optional features it
+supports (token auth, yank, dist-tags, signatures), its rate limit and how
+fresh its package index is, as reported by its health endpoint.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			url := cfg.RegistryURL
+			if registryConfig, err := cfg.GetRegistryConfig(); err == nil {
+				url = registryConfig.URL
+			}
+			if len(args) == 1 {
+				url = args[0]
+			}
+
+			status, err := registry.NewClient(url).Status()
+			if err != nil {
+				cmd.PrintErrf("Error checking %s: %v\n", url, err)
+				os.Exit(1)
+			}
+
+			if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				out := struct {
+					URL string `json:"url"`
+					*registry.HealthResponse
+				}{url, status}
+				if err := enc.Encode(out); err != nil {
+					cmd.PrintErrf("Error encoding status: %v\n", err)
+					os.Exit(1)
+				}
+			} else {
+				printRegistryStatus(os.Stdout, url, status, time.Now())
+			}
+			if status.Status != "healthy" {
+				os.Exit(1)
+			}
+		},
+	}
+	registryStatusCmd.Flags().Bool("json", false, "Print the status as JSON")
+	registryCmd.AddCommand(registryStatusCmd)
+	root.AddCommand(registryCmd)
+
+	// Search command
+	searchCmd := &cobra.Command{
+		Use:   "search <query>",
+		Short: "Search for packages",
+		Long: `Search the default registry and every registry configured under
+registries.<name>, in parallel. Results are merged by package name and
+labelled with the registries that have them when more than one is
+configured.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			registries, err := cfg.GetRegistries()
+			if err != nil {
+				cmd.PrintErrf("Error loading registry config: %v\n", err)
+				os.Exit(1)
+			}
+			if from, _ := cmd.Flags().GetString("from"); from != "" {
+				var selected []config.NamedRegistry
+				for _, r := range registries {
+					if r.Name == from {
+						selected = append(selected, r)
+					}
+				}
+				if len(selected) == 0 {
+					cmd.PrintErrf("Error: no registry named %q is configured\n", from)
+					os.Exit(1)
+				}
+				registries = selected
+			}
+
+			sources := make([]registry.Source, 0, len(registries))
+			for _, r := range registries {
+				sources = append(sources, registry.Source{Name: r.Name, Client: namedRegistryClient(cfg, r)})
+			}
+
+			cmd.Printf("Searching for '%s'...\n", args[0])
+			results, errs := registry.SearchAll(sources, args[0])
+			if len(errs) == len(sources) {
+				for _, r := range registries {
+					cmd.PrintErrf("Error searching %s (%s): %v\n", r.Name, r.URL, errs[r.Name])
+				}
+				os.Exit(1)
+			}
+			for _, r := range registries {
+				if err, ok := errs[r.Name]; ok {
+					warn.Printf(warn.Network, "could not search %s (%s): %v", r.Name, r.URL, err)
+				}
+			}
+
+			if len(results) == 0 {
+				cmd.Println("No packages found.")
+				return
+			}
+
+			labelled := len(sources) > 1
+			cmd.Printf("Found %d package(s):\n\n", len(results))
+			for _, pkg := range results {
+				if labelled {
+					cmd.Printf("  %s (%s) [%s]\n", pkg.Name, pkg.Version, strings.Join(pkg.Registries, ", "))
+				} else {
+					cmd.Printf("  %s (%s)\n", pkg.Name, pkg.Version)
+				}
+				if pkg.Description != "" {
+					cmd.Printf("    %s\n", pkg.Description)
+				}
+				if pkg.Downloads > 0 {
+					cmd.Printf("    Downloads: %d\n", pkg.Downloads)
+				}
+				cmd.Println()
+			}
+			if labelled {
+				cmd.Println("Install from a registry other than the default with 'bifrost install <package> --from <registry>'")
+			}
+		},
+	}
+	searchCmd.Flags().String("from", "", "Only search the configured registry with this name")
+	root.AddCommand(searchCmd)
+
+	// Index command
+	indexCmd := &cobra.Command{
+		Use:   "index",
+		Short: "Keep local copies of registry indexes for offline discovery",
+		Long: `Keep a local copy of the package index of the default registry and every
+registry configured under registries.<name> in ` + filepath.Join(cfg.RegistryDir, "index") + `.
+Each registry's index is read from registries.<name>.index, or from
+` + registry.DefaultIndexPath + ` on the registry. Updates only download indexes that changed,
+and installs verifying checksums against an index use the same copies.`,
+	}
 
-				cmd.Println("Uninstalling dependencies from Bifrost.toml...")
-				err = uninstaller.UninstallFromManifest("Bifrost.toml")
-				if err != nil {
-					cmd.PrintErrf("Error uninstalling dependencies: %v\n", err)
+	indexUpdateCmd := &cobra.Command{
+		Use:   "update",
+		Short: "Update the local copies of registry indexes",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			installer := install.New(cfg)
+			if registryConfig, err := cfg.GetRegistryConfig(); err == nil {
+				installer.SetClient(namedRegistryClient(cfg, config.NamedRegistry{Name: config.DefaultRegistryName, RegistryConfig: *registryConfig}))
+			}
+			results, err := installer.UpdateIndexes()
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			failed := 0
+			for _, r := range results {
+				if r.Error != "" {
+					failed++
+				}
+			}
+			if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(results); err != nil {
+					cmd.PrintErrf("Error encoding results: %v\n", err)
 					os.Exit(1)
 				}
 			} else {
-				// Uninstall specific package
-				packageName := args[0]
-				version := ""
-
-				if !all {
-					// Parse package@version format
-					if idx := strings.Index(packageName, "@"); idx != -1 {
-						version = packageName[idx+1:]
-						packageName = packageName[:idx]
+				for _, r := range results {
+					switch {
+					case r.Error != "":
+						cmd.PrintErrf("%s: failed to update %s: %s\n", r.Registry, r.URL, r.Error)
+					case r.Updated:
+						cmd.Printf("%s: updated, %d package(s)\n", r.Registry, r.Packages)
+					default:
+						cmd.Printf("%s: up to date, %d package(s)\n", r.Registry, r.Packages)
 					}
 				}
-
-				err := uninstaller.UninstallPackage(packageName, version, global)
-				if err != nil {
-					cmd.PrintErrf("Error uninstalling package: %v\n", err)
-					os.Exit(1)
-				}
+			}
+			if failed == len(results) {
+				os.Exit(1)
 			}
 		},
 	}
-	uninstallCmd.Flags().BoolP("global", "g", false, "Uninstall package globally")
-	uninstallCmd.Flags().BoolP("all", "a", false, "Uninstall all versions of the package")
-	uninstallCmd.Flags().BoolP("clean", "c", false, "Clean package cache")
-	root.AddCommand(uninstallCmd)
+	indexUpdateCmd.Flags().Bool("json", false, "Print the results as JSON")
+	indexCmd.AddCommand(indexUpdateCmd)
 
-	// List command
-	listCmd := &cobra.Command{
-		Use:   "list",
-		Short: "List installed packages",
+	indexSearchCmd := &cobra.Command{
+		Use:   "search <query>",
+		Short: "Search the local copies of registry indexes, without going online",
+		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			global, _ := cmd.Flags().GetBool("global")
-			uninstaller := uninstall.New(cfg)
+			installer := install.New(cfg)
+			matches, missing, err := installer.SearchIndexes(args[0])
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if len(missing) > 0 {
+				warn.Printf(warn.Network, "no local index for %s; run 'bifrost index update'", strings.Join(missing, ", "))
+			}
 
-			if global {
-				err := uninstaller.ListInstalledPackages(true)
-				if err != nil {
-					cmd.PrintErrf("Error listing global packages: %v\n", err)
-					os.Exit(1)
+			if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+				if matches == nil {
+					matches = []install.IndexMatch{}
 				}
-			} else {
-				err := uninstaller.ListInstalledPackages(false)
-				if err != nil {
-					cmd.PrintErrf("Error listing local packages: %v\n", err)
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(matches); err != nil {
+					cmd.PrintErrf("Error encoding results: %v\n", err)
 					os.Exit(1)
 				}
+				return
+			}
+			if len(matches) == 0 {
+				cmd.Println("No packages found.")
+				return
 			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tLATEST\tVERSIONS\tREGISTRY")
+			for _, m := range matches {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", m.Name, m.Latest, m.Versions, m.Registry)
+			}
+			w.Flush()
 		},
 	}
-	listCmd.Flags().BoolP("global", "g", false, "List globally installed packages")
-	root.AddCommand(listCmd)
+	indexSearchCmd.Flags().Bool("json", false, "Print the matches as JSON")
+	indexCmd.AddCommand(indexSearchCmd)
+	root.AddCommand(indexCmd)
 
-	// Search command
-	root.AddCommand(&cobra.Command{
-		Use:   "search <query>",
-		Short: "Search for packages",
+	// Transparency log commands
+	tlogCmd := &cobra.Command{
+		Use:   "tlog",
+		Short: "Check package checksums against a transparency log",
+		Long: `Check package checksums against the Rekor-style transparency log configured
+with tlog.url. While it is set, installs refuse archives the log does not
+record; with tlog.key, entries must also be signed with the log's key.`,
+	}
+
+	tlogVerifyCmd := &cobra.Command{
+		Use:   "verify <package>[@version]",
+		Short: "Verify that a package version is in the transparency log",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			registryConfig, err := cfg.GetRegistryConfig()
+			log, err := transparencyLog(cfg)
 			if err != nil {
-				cmd.PrintErrf("Error loading registry config: %v\n", err)
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			installer := install.New(cfg)
+			installer.SetPolicy(orgPolicy)
+			if log != nil {
+				installer.SetTransparencyLog(log)
+			}
+			name, version := splitPackageRef(args[0])
+			logged, err := installer.LogEntry(name, version)
+			if logged == nil {
+				cmd.PrintErrf("Error: %v\n%s", err, explainHint(err))
 				os.Exit(1)
 			}
-			
-			client := registry.NewClient(registryConfig.URL)
 
-			// Check registry health first
-			if err := client.Health(); err != nil {
-				cmd.PrintErrf("Error connecting to registry: %v\n", err)
+			if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if encErr := enc.Encode(logged); encErr != nil {
+					cmd.PrintErrf("Error encoding result: %v\n", encErr)
+					os.Exit(1)
+				}
+			} else if logged.Entry != nil {
+				cmd.Printf("%s@%s is in the transparency log at %s\n", logged.Name, logged.Version, log.URL())
+				cmd.Printf("  Checksum:   %s\n", logged.Checksum)
+				cmd.Printf("  Log index:  %d\n", logged.Entry.LogIndex)
+				cmd.Printf("  Integrated: %s\n", logged.Entry.IntegratedTime.Local().Format(time.RFC3339))
+				cmd.Printf("  Entry:      %s\n", logged.Entry.UUID)
+			}
+			if err != nil {
+				cmd.PrintErrf("Error: %s@%s (%s): %v\n%s", logged.Name, logged.Version, logged.Checksum, err, explainHint(err))
 				os.Exit(1)
 			}
+		},
+	}
+	tlogVerifyCmd.Flags().Bool("json", false, "Print the result as JSON")
+	tlogCmd.AddCommand(tlogVerifyCmd)
+	root.AddCommand(tlogCmd)
 
-			cmd.Printf("Searching for '%s'...\n", args[0])
-			results, err := client.Search(args[0])
+	// Browse command
+	browseCmd := &cobra.Command{
+		Use:   "browse",
+		Short: "List packages by category or keyword",
+		Long: `List the packages the registry files under a category or keyword, a page
+at a time, to discover packages without knowing their names. Packages
+choose their categories and keywords in the [package] table of Bifrost.toml.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			var opts registry.BrowseOptions
+			opts.Category, _ = cmd.Flags().GetString("category")
+			opts.Keyword, _ = cmd.Flags().GetString("keyword")
+			opts.Page, _ = cmd.Flags().GetInt("page")
+			opts.PerPage, _ = cmd.Flags().GetInt("per-page")
+			if opts.Page < 1 || opts.PerPage < 1 {
+				cmd.PrintErrln("Error: --page and --per-page must be positive")
+				os.Exit(1)
+			}
+
+			from, _ := cmd.Flags().GetString("from")
+			if from == "" {
+				from = config.DefaultRegistryName
+			}
+			registryConfig, err := cfg.GetNamedRegistryConfig(from)
 			if err != nil {
-				cmd.PrintErrf("Error searching packages: %v\n", err)
+				cmd.PrintErrf("Error loading registry config: %v\n", err)
 				os.Exit(1)
 			}
+			client := namedRegistryClient(cfg, config.NamedRegistry{Name: from, RegistryConfig: *registryConfig})
 
-			if len(results) == 0 {
-				cmd.Println("No packages found.")
+			page, err := client.Browse(opts)
+			if err != nil {
+				cmd.PrintErrf("Error browsing packages: %v\n", err)
+				os.Exit(1)
+			}
+
+			if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(page); err != nil {
+					cmd.PrintErrf("Error encoding packages: %v\n", err)
+					os.Exit(1)
+				}
 				return
 			}
 
-			cmd.Printf("Found %d package(s):\n\n", len(results))
-			for _, pkg := range results {
+			if page.Total == 0 {
+				cmd.Println("No packages found.")
+				return
+			}
+			if len(page.Packages) == 0 {
+				cmd.Printf("No packages on page %d; there are %d package(s)\n", page.Page, page.Total)
+				return
+			}
+			first := (page.Page-1)*page.PerPage + 1
+			cmd.Printf("Packages %d-%d of %d:\n\n", first, first+len(page.Packages)-1, page.Total)
+			for _, pkg := range page.Packages {
 				cmd.Printf("  %s (%s)\n", pkg.Name, pkg.Version)
 				if pkg.Description != "" {
 					cmd.Printf("    %s\n", pkg.Description)
 				}
-				if pkg.Downloads > 0 {
-					cmd.Printf("    Downloads: %d\n", pkg.Downloads)
-				}
-				cmd.Println()
+			}
+			if first+len(page.Packages)-1 < page.Total {
+				cmd.Printf("\nNext page: --page %d\n", page.Page+1)
 			}
 		},
-	})
+	}
+	browseCmd.Flags().String("category", "", "List packages in this category")
+	browseCmd.Flags().String("keyword", "", "List packages with this keyword")
+	browseCmd.Flags().Int("page", 1, "Page to show")
+	browseCmd.Flags().Int("per-page", 20, "Packages per page")
+	browseCmd.Flags().String("from", "", "Browse the configured registry with this name")
+	browseCmd.Flags().Bool("json", false, "Output the page as JSON")
+	root.AddCommand(browseCmd)
 
 	// Info command
 	infoCmd := &cobra.Command{
 		Use:   "info [package]",
 		Short: "Show package information",
 		Run: func(cmd *cobra.Command, args []string) {
+			asJSON, _ := cmd.Flags().GetBool("json")
 			if len(args) == 0 {
 				// Show local package info
-				m, err := manifest.Load("Bifrost.toml")
+				m, err := manifest.Load(manifestPath())
 				if err != nil {
-					cmd.PrintErrf("Error loading Bifrost.toml: %v\n", err)
+					cmd.PrintErrf("Error loading %s: %v\n", manifestPath(), err)
 					os.Exit(1)
 				}
+				if asJSON {
+					info, err := metadata.CollectInfo(cfg, manifestPath())
+					if err != nil {
+						cmd.PrintErrf("Error collecting project info: %v\n", err)
+						os.Exit(1)
+					}
+					enc := json.NewEncoder(cmd.OutOrStdout())
+					enc.SetIndent("", "  ")
+					if err := enc.Encode(info); err != nil {
+						cmd.PrintErrf("Error encoding project info: %v\n", err)
+						os.Exit(1)
+					}
+					return
+				}
 
 				cmd.Printf("Package: %s\n", m.Package.Name)
 				cmd.Printf("Version: %s\n", m.Package.Version)
@@ -342,6 +3130,12 @@ spell appraise_main():
 				if m.Package.License != "" {
 					cmd.Printf("License: %s\n", m.Package.License)
 				}
+				if m.Package.Homepage != "" {
+					cmd.Printf("Homepage: %s\n", m.Package.Homepage)
+				}
+				if m.Package.Repository != "" {
+					cmd.Printf("Repository: %s\n", m.Package.Repository)
+				}
 
 				if len(m.Dependencies) > 0 {
 					cmd.Println("\nDependencies:")
@@ -362,10 +3156,7 @@ spell appraise_main():
 				version := ""
 
 				// Parse package@version format
-				if idx := strings.Index(packageName, "@"); idx != -1 {
-					version = packageName[idx+1:]
-					packageName = packageName[:idx]
-				}
+				packageName, version = splitPackageRef(packageName)
 
 				registryConfig, err := cfg.GetRegistryConfig()
 				if err != nil {
@@ -387,6 +3178,15 @@ spell appraise_main():
 					cmd.PrintErrf("Error fetching package info: %v\n", err)
 					os.Exit(1)
 				}
+				if asJSON {
+					enc := json.NewEncoder(cmd.OutOrStdout())
+					enc.SetIndent("", "  ")
+					if err := enc.Encode(pkgInfo); err != nil {
+						cmd.PrintErrf("Error encoding package info: %v\n", err)
+						os.Exit(1)
+					}
+					return
+				}
 
 				cmd.Printf("Package: %s\n", pkgInfo.Name)
 				cmd.Printf("Version: %s\n", pkgInfo.Version)
@@ -405,13 +3205,423 @@ spell appraise_main():
 				if pkgInfo.Repository != "" {
 					cmd.Printf("Repository: %s\n", pkgInfo.Repository)
 				}
+				if len(pkgInfo.Categories) > 0 {
+					cmd.Printf("Categories: %v\n", pkgInfo.Categories)
+				}
 				if len(pkgInfo.Keywords) > 0 {
 					cmd.Printf("Keywords: %v\n", pkgInfo.Keywords)
 				}
+
+				if showChangelog, _ := cmd.Flags().GetBool("changelog"); showChangelog {
+					// Show what changed since the version the project uses
+					installed := ""
+					if path, err := findManifest(); err == nil {
+						if md, err := metadata.Collect(cfg, path); err == nil {
+							for _, dep := range md.Dependencies {
+								if dep.Name == packageName {
+									installed = dep.Version
+								}
+							}
+						}
+					}
+
+					installer := install.New(cfg)
+					installer.SetPolicy(orgPolicy)
+					installer.SetOutput(os.Stderr)
+					entries, err := installer.Changelog(packageName, installed, pkgInfo.Version)
+					if err != nil {
+						cmd.PrintErrf("Error fetching changelog: %v\n", err)
+						os.Exit(1)
+					}
+					cmd.Println()
+					printChangelog(cmd, packageName, installed, pkgInfo.Version, entries)
+				}
+			}
+		},
+	}
+	infoCmd.Flags().Bool("changelog", false, "Show the changelog entries since the installed version")
+	infoCmd.Flags().Bool("json", false, "Print the information as JSON")
+	root.AddCommand(infoCmd)
+
+	// Outdated command
+	outdatedCmd := &cobra.Command{
+		Use:   "outdated",
+		Short: "List dependencies with newer versions available",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			manifestPath, err := findManifest()
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			installer := install.New(cfg)
+			installer.SetPolicy(orgPolicy)
+			installer.SetOutput(os.Stderr)
+			outdated, err := installer.Outdated(manifestPath)
+			if err != nil {
+				cmd.PrintErrf("Error checking for updates: %v\n", err)
+				os.Exit(1)
+			}
+			if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+				if outdated == nil {
+					outdated = []install.Outdated{}
+				}
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(outdated); err != nil {
+					cmd.PrintErrf("Error encoding updates: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+			if len(outdated) == 0 {
+				cmd.Println("All dependencies are up to date")
+				return
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "PACKAGE\tCURRENT\tWANTED\tLATEST")
+			for _, o := range outdated {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", o.Name, orDash(o.Current), orDash(o.Wanted), o.Latest)
+			}
+			w.Flush()
+
+			if showChangelog, _ := cmd.Flags().GetBool("changelog"); showChangelog {
+				for _, o := range outdated {
+					name := o.Name
+					if o.Package != "" {
+						name = o.Package
+					}
+					cmd.Println()
+					entries, err := installer.Changelog(name, o.Current, o.Latest)
+					if err != nil {
+						cmd.Printf("%s: %v\n", o.Name, err)
+						continue
+					}
+					printChangelog(cmd, o.Name, o.Current, o.Latest, entries)
+				}
+			}
+		},
+	}
+	outdatedCmd.Flags().Bool("changelog", false, "Show the changelog entries between the current and latest versions")
+	outdatedCmd.Flags().Bool("json", false, "Print the outdated dependencies as JSON")
+	root.AddCommand(outdatedCmd)
+
+	// Upgrade command
+	upgradeCmd := &cobra.Command{
+		Use:   "upgrade [package[@version]]",
+		Short: "Upgrade a dependency, reviewing and testing it before keeping it",
+		Long: `Upgrade a dependency to its newest version, or the version given, saving a
+caret constraint on it in Bifrost.toml. Upgrades crossing a major version
+need --major.
+
+The dependency's changelog entries in between are shown, the project's test
+script from [scripts] runs before and after, and the new version is
+installed with its lockfile staged in Bifrost.lock.upgrade. Bifrost.toml and
+Bifrost.lock only change once the upgrade is kept: at the prompt, with --yes
+when the tests pass, or later with --confirm. --abandon drops a staged
+upgrade and installs the locked versions again.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			confirm, _ := cmd.Flags().GetBool("confirm")
+			abandon, _ := cmd.Flags().GetBool("abandon")
+			if (confirm && abandon) || (confirm || abandon) == (len(args) == 1) {
+				cmd.PrintErrln("Error: name a package to upgrade, or pass --confirm or --abandon for a staged upgrade")
+				os.Exit(1)
+			}
+
+			installer := install.New(cfg)
+			installer.SetPolicy(orgPolicy)
+			installer.SetProject(projectDir())
+			if err := applyDownloadLimits(cmd, cfg, installer); err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if err := applyScriptPolicy(cmd, cfg, installer); err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if err := applyFileModes(cfg, installer); err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if err := applyTransparencyLog(cfg, installer); err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			installer.SetEventHandler(installProgress(os.Stdout))
+
+			path := manifestPath()
+			switch {
+			case confirm:
+				keepUpgrade(cmd, cfg, installer, path)
+				return
+			case abandon:
+				dropUpgrade(cmd, cfg, installer, path)
+				return
+			}
+
+			major, _ := cmd.Flags().GetBool("major")
+			name, version := splitPackageRef(args[0])
+			up, err := installer.PlanUpgrade(path, name, version, major)
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n%s", err, explainHint(err))
+				os.Exit(1)
+			}
+			cmd.Printf("Upgrading %s from %s to %s\n\n", up.Name, orDash(up.From), up.To)
+			entries, err := installer.Changelog(up.RegistryName(), up.From, up.To)
+			switch {
+			case errors.Is(err, changelog.ErrNoChangelog):
+				cmd.Printf("%s declares no changelog; check its repository for migration notes\n", up.RegistryName())
+			case err != nil:
+				cmd.Printf("Changelog unavailable: %v\n", err)
+			default:
+				printChangelog(cmd, up.Name, up.From, up.To, entries)
+			}
+
+			noTest, _ := cmd.Flags().GetBool("no-test")
+			runTests := func(when string) error {
+				if noTest {
+					return install.ErrNoTestScript
+				}
+				cmd.Printf("\nRunning tests %s the upgrade...\n", when)
+				err := installer.RunTests(path)
+				switch {
+				case errors.Is(err, install.ErrNoTestScript):
+					cmd.Printf("No test script in the [scripts] of %s; skipping tests\n", manifest.FileName)
+					noTest = true
+				case err != nil:
+					cmd.Printf("Tests failed %s the upgrade: %v\n", when, err)
+				default:
+					cmd.Printf("Tests passed %s the upgrade\n", when)
+				}
+				return err
+			}
+			before := runTests("before")
+
+			cmd.Println()
+			if _, err := installer.StageUpgrade(path, up); err != nil {
+				cmd.PrintErrf("Error staging upgrade: %v\n%s", err, explainHint(err))
+				os.Exit(1)
+			}
+			staged := filepath.Base(installer.StagedLockPath(path))
+			cmd.Printf("Installed %s@%s, staged in %s\n", up.Name, up.To, staged)
+
+			after := runTests("after")
+			failing := after != nil && !errors.Is(after, install.ErrNoTestScript)
+			if failing && before == nil {
+				cmd.Println("The upgrade breaks tests that passed before it")
+			}
+
+			yes, _ := cmd.Flags().GetBool("yes")
+			switch {
+			case yes && !failing:
+				keepUpgrade(cmd, cfg, installer, path)
+			case yes:
+				cmd.PrintErrf("Error: not keeping an upgrade whose tests fail; it stays staged in %s for 'bifrost upgrade --confirm' or '--abandon'\n", staged)
+				os.Exit(1)
+			case term.IsTerminal(int(os.Stdin.Fd())):
+				cmd.Print("\nKeep the upgrade? [y/N] ")
+				answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				switch strings.ToLower(strings.TrimSpace(answer)) {
+				case "y", "yes":
+					keepUpgrade(cmd, cfg, installer, path)
+				default:
+					dropUpgrade(cmd, cfg, installer, path)
+				}
+			default:
+				cmd.Printf("\nThe upgrade is staged in %s; run 'bifrost upgrade --confirm' to keep it or 'bifrost upgrade --abandon' to drop it\n", staged)
+			}
+		},
+	}
+	upgradeCmd.Flags().Bool("major", false, "Allow the upgrade to cross a major version")
+	upgradeCmd.Flags().BoolP("yes", "y", false, "Keep the upgrade without asking when its tests pass")
+	upgradeCmd.Flags().Bool("no-test", false, "Do not run the project's test script")
+	upgradeCmd.Flags().Bool("confirm", false, "Keep the staged upgrade")
+	upgradeCmd.Flags().Bool("abandon", false, "Drop the staged upgrade and install the locked versions again")
+	root.AddCommand(upgradeCmd)
+
+	// Resolve-import command
+	resolveImportCmd := &cobra.Command{
+		Use:   "resolve-import <import>...",
+		Short: "Print the file a Carrion import resolves to",
+		Long: `Resolve Carrion imports the way the interpreter does and print the files
+they refer to, so the interpreter and editors can shell out to bifrost for
+consistent resolution. An import that cannot be found fails with the search
+paths tried; --json reports both outcomes as a JSON document, or an array
+of them for several imports. Resolutions are cached until the project's
+manifest or lockfile changes.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			dir, _ := cmd.Flags().GetString("dir")
+			dir, err := filepath.Abs(dir)
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			resolutions := integration.New(cfg).ResolveImports(args, dir)
+			failed := false
+			for _, r := range resolutions {
+				failed = failed || r.Error != ""
+			}
+
+			if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				var doc any = resolutions
+				if len(resolutions) == 1 {
+					doc = resolutions[0]
+				}
+				if err := enc.Encode(doc); err != nil {
+					cmd.PrintErrf("Error encoding resolution: %v\n", err)
+					os.Exit(1)
+				}
+			} else if len(resolutions) == 1 {
+				r := resolutions[0]
+				if r.Error == "" {
+					cmd.Println(r.Path)
+				} else {
+					cmd.PrintErrf("Error: %s\n", r.Error)
+					if len(r.SearchPaths) > 0 {
+						cmd.PrintErrln("Searched:")
+						for _, p := range r.SearchPaths {
+							cmd.PrintErrf("  %s\n", p)
+						}
+					}
+				}
+			} else {
+				for _, r := range resolutions {
+					if r.Error == "" {
+						cmd.Printf("%s\t%s\n", r.Import, r.Path)
+					} else {
+						cmd.PrintErrf("%s\t%s\n", r.Import, r.Error)
+					}
+				}
+			}
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+	resolveImportCmd.Flags().String("dir", ".", "Directory the import is resolved from")
+	resolveImportCmd.Flags().Bool("json", false, "Print the resolution as JSON")
+	root.AddCommand(resolveImportCmd)
+
+	// Metadata command
+	metadataCmd := &cobra.Command{
+		Use:   "metadata",
+		Short: "Print the project model as JSON",
+		Long: `Print the manifest, lockfile, import search paths and dependency
+locations of the current project as a single JSON document. Intended for
+editors and the Carrion language server; never contacts the registry.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			manifestPath, err := findManifest()
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			md, err := metadata.Collect(cfg, manifestPath)
+			if err != nil {
+				cmd.PrintErrf("Error collecting metadata: %v\n", err)
+				os.Exit(1)
+			}
+
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			if pretty, _ := cmd.Flags().GetBool("pretty"); pretty {
+				enc.SetIndent("", "  ")
+			}
+			if err := enc.Encode(md); err != nil {
+				cmd.PrintErrf("Error encoding metadata: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	metadataCmd.Flags().Bool("pretty", false, "Indent the JSON output")
+	root.AddCommand(metadataCmd)
+
+	// Licenses command
+	licensesCmd := &cobra.Command{
+		Use:   "licenses",
+		Short: "List the licenses of installed dependencies",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			pkgs := collectLicenses(cmd, cfg)
+
+			if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(pkgs); err != nil {
+					cmd.PrintErrf("Error encoding licenses: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+
+			for _, pkg := range pkgs {
+				license := pkg.License
+				if license == "" {
+					license = "(undeclared)"
+				}
+				cmd.Printf("%s@%s: %s", pkg.Name, pkg.Version, license)
+				if len(pkg.Files) == 0 {
+					cmd.Print(" [no license file]")
+				}
+				cmd.Println()
+			}
+		},
+	}
+	licensesCmd.Flags().Bool("json", false, "Print the licenses as JSON")
+
+	licensesBundleCmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Collect the license and notice files of installed dependencies",
+		Long: `Copy the LICENSE, COPYING and NOTICE files of every installed dependency
+into a directory, one subdirectory per package, or concatenate them into a
+single file with --single-file, for shipping alongside an application.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			pkgs := collectLicenses(cmd, cfg)
+
+			if single, _ := cmd.Flags().GetString("single-file"); single != "" {
+				f, err := os.Create(single)
+				if err != nil {
+					cmd.PrintErrf("Error creating %s: %v\n", single, err)
+					os.Exit(1)
+				}
+				err = licenses.Concatenate(pkgs, f)
+				if closeErr := f.Close(); err == nil {
+					err = closeErr
+				}
+				if err != nil {
+					cmd.PrintErrf("Error writing %s: %v\n", single, err)
+					os.Exit(1)
+				}
+				cmd.Printf("Wrote the licenses of %d package(s) to %s\n", len(pkgs), single)
+			} else {
+				output, _ := cmd.Flags().GetString("output")
+				copied, err := licenses.Bundle(pkgs, output)
+				if err != nil {
+					cmd.PrintErrf("Error bundling licenses: %v\n", err)
+					os.Exit(1)
+				}
+				cmd.Printf("Copied %d license file(s) into %s\n", copied, output)
+			}
+
+			for _, pkg := range pkgs {
+				if len(pkg.Files) == 0 {
+					warn.Printf(warn.Package, "%s@%s has no license file", pkg.Name, pkg.Version)
+				}
 			}
 		},
 	}
-	root.AddCommand(infoCmd)
+	licensesBundleCmd.Flags().StringP("output", "o", licenses.DefaultBundleDir, "Directory to copy license files into")
+	licensesBundleCmd.Flags().String("single-file", "", "Concatenate all license files into this file instead")
+	licensesCmd.AddCommand(licensesBundleCmd)
+	root.AddCommand(licensesCmd)
 
 	// Login command
 	loginCmd := &cobra.Command{
@@ -469,6 +3679,7 @@ spell appraise_main():
 					os.Exit(1)
 				}
 				// Use legacy auth
+				warn.Printf(warn.Deprecation, "using credentials from 'bifrost login'; store them with 'bifrost config set registry.username' and 'registry.password' instead")
 				registryConfig.Username = authConfig.Username
 				registryConfig.Password = authConfig.Password
 				registryConfig.APIKey = authConfig.APIKey
@@ -476,21 +3687,36 @@ spell appraise_main():
 			}
 
 			// Load manifest
-			m, err := manifest.Load("Bifrost.toml")
+			m, err := manifest.Load(manifestPath())
+			if err != nil {
+				cmd.PrintErrf("Error loading %s: %v\n", manifestPath(), err)
+				os.Exit(1)
+			}
+			if err := m.Validate(); err != nil {
+				cmd.PrintErrf("Error in %s: %v\n", manifestPath(), err)
+				os.Exit(1)
+			}
+			findings, err := lintPackage(cmd, m, 0)
 			if err != nil {
-				cmd.PrintErrf("Error loading Bifrost.toml: %v\n", err)
+				cmd.PrintErrf("Error checking package: %v\n", err)
 				os.Exit(1)
 			}
+			for _, f := range findings {
+				warn.Printf(warn.Package, "%s", f)
+			}
 
 			// Create archive
-			archiveName := fmt.Sprintf("%s-%s.tar.gz", m.Package.Name, m.Package.Version)
+			format, err := publishFormat(cmd)
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			archiveName := archive.FileName(m.Package.Name, m.Package.Version, format)
 			archivePath := filepath.Join(os.TempDir(), archiveName)
 
 			cmd.Printf("Creating package archive %s...\n", archiveName)
 
-			// Create archive using tar command
-			tarCmd := fmt.Sprintf("tar -czf %s --exclude='.git' --exclude='*.tar.gz' --exclude='bifrost' --exclude='carrion_modules' .", archivePath)
-			if err := runCommand(tarCmd); err != nil {
+			if err := packPackage(cmd, m, archivePath); err != nil {
 				cmd.PrintErrf("Error creating archive: %v\n", err)
 				os.Exit(1)
 			}
@@ -498,17 +3724,27 @@ spell appraise_main():
 
 			// Prepare metadata
 			metadata := &registry.PackageInfo{
-				Name:        m.Package.Name,
-				Version:     m.Package.Version,
-				Description: m.Package.Description,
-				Authors:     m.Package.Authors,
-				License:     m.Package.License,
-				Homepage:    "", // Not in manifest yet
-				Repository:  m.Package.Repository,
-				Keywords:    m.Package.Keywords,
+				Name:         m.Package.Name,
+				Version:      m.Package.Version,
+				Description:  m.Package.Description,
+				Authors:      m.Package.Authors,
+				License:      m.Package.License,
+				Homepage:     m.Package.Homepage,
+				Repository:   m.Package.Repository,
+				Keywords:     m.Package.Keywords,
+				Categories:   m.Package.Categories,
+				Changelog:    m.Package.Changelog,
+				Dependencies: m.Dependencies,
+			}
+			if format != archive.FormatGzip {
+				metadata.Format = string(format)
 			}
 
 			// Publish to registry with authentication
+			if err := orgPolicy.CheckRegistry(registryConfig.URL); err != nil {
+				cmd.PrintErrf("Error: %v\n%s", err, explainHint(err))
+				os.Exit(1)
+			}
 			client := registry.NewClient(registryConfig.URL)
 			if registryConfig.AuthType == "token" {
 				client.SetAPIKey(registryConfig.APIKey)
@@ -516,6 +3752,11 @@ spell appraise_main():
 				client.SetBasicAuth(registryConfig.Username, registryConfig.Password)
 			}
 
+			if err := checkArchiveSize(cmd, m, client, archivePath); err != nil {
+				cmd.PrintErrf("Error checking archive size: %v\n", err)
+				os.Exit(1)
+			}
+
 			cmd.Printf("Publishing %s@%s to %s...\n", m.Package.Name, m.Package.Version, registryConfig.URL)
 			if err := client.Publish(archivePath, metadata); err != nil {
 				cmd.PrintErrf("Error publishing package: %v\n", err)
@@ -525,8 +3766,138 @@ spell appraise_main():
 			cmd.Printf("Successfully published %s@%s!\n", m.Package.Name, m.Package.Version)
 		},
 	}
+	publishCmd.Flags().String("symlinks", "error", "How to pack symlinks: error, skip, or follow (links must stay inside the package)")
+	publishCmd.Flags().String("size-warning", "10MB", "Warn when the archive is larger than this (0 disables)")
+	publishCmd.Flags().String("format", "gzip", "Archive compression: gzip or zstd (zstd is smaller and faster to install, but needs a registry that serves it)")
 	root.AddCommand(publishCmd)
 
+	// Lint package command
+	lintPackageCmd := &cobra.Command{
+		Use:   "lint-package",
+		Short: "Check the package for common mistakes before publishing it",
+		Long: `Check the package in the current directory for common mistakes before
+publishing it: a missing LICENSE or README, an empty description or keyword
+list, a main file that is not packed, tests packed by accident and overly
+large files. Files are checked as publish would pack them. Silence a rule
+for the package by listing it in Bifrost.toml:
+
+  [lint]
+  allow = ["missing-keywords"]
+
+Rules: missing-license, missing-readme, missing-description,
+missing-keywords, missing-main, tests-included, large-file. publish warns
+about the same findings.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			asJSON, _ := cmd.Flags().GetBool("json")
+			m, err := manifest.Load(manifestPath())
+			if err != nil {
+				cmd.PrintErrf("Error loading %s: %v\n", manifestPath(), err)
+				os.Exit(1)
+			}
+			maxFileSizeFlag, _ := cmd.Flags().GetString("max-file-size")
+			maxFileSize, err := archive.ParseSize(maxFileSizeFlag)
+			if err != nil {
+				cmd.PrintErrf("Error: --max-file-size: %v\n", err)
+				os.Exit(1)
+			}
+
+			findings, err := lintPackage(cmd, m, maxFileSize)
+			if err != nil {
+				cmd.PrintErrf("Error checking package: %v\n", err)
+				os.Exit(1)
+			}
+
+			if asJSON {
+				if findings == nil {
+					findings = []lint.Finding{}
+				}
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(findings); err != nil {
+					cmd.PrintErrf("Error encoding findings: %v\n", err)
+					os.Exit(1)
+				}
+			} else if len(findings) == 0 {
+				cmd.Printf("%s@%s: no problems found\n", m.Package.Name, m.Package.Version)
+			} else {
+				for _, f := range findings {
+					cmd.Println(f)
+				}
+				cmd.Printf("%d problem(s) found; silence a rule with allow in the [lint] table of %s\n", len(findings), manifest.FileName)
+			}
+			if len(findings) > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+	lintPackageCmd.Flags().Bool("json", false, "Print the findings as JSON")
+	lintPackageCmd.Flags().String("max-file-size", "1MB", "Report packed files larger than this")
+	lintPackageCmd.Flags().String("symlinks", "error", "How publish packs symlinks: error, skip, or follow")
+	root.AddCommand(lintPackageCmd)
+
+	// Rename command
+	renameCmd := &cobra.Command{
+		Use:   "rename <old-name> <new-name>",
+		Short: "Move a published package to a new name",
+		Long: `Move every version of a package to a new name in the registry. The registry
+keeps a tombstone under the old name, so installs of it warn and resolve to
+the new name, installed under the old one, until its deprecation window ends.
+The name in Bifrost.toml is updated too when it is the old name.`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			oldName, newName := args[0], args[1]
+			asJSON, _ := cmd.Flags().GetBool("json")
+			for _, name := range args {
+				if err := manifest.ValidateName(name); err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			registryConfig, err := cfg.GetRegistryConfig()
+			if err != nil {
+				cmd.PrintErrf("Error loading registry config: %v\n", err)
+				os.Exit(1)
+			}
+			if err := orgPolicy.CheckRegistry(registryConfig.URL); err != nil {
+				cmd.PrintErrf("Error: %v\n%s", err, explainHint(err))
+				os.Exit(1)
+			}
+			client := registry.NewClient(registryConfig.URL)
+			authorizeClient(cfg, client, registryConfig)
+
+			tombstone, err := client.Rename(oldName, newName)
+			if err != nil {
+				cmd.PrintErrf("Error renaming %s: %v\n%s", oldName, err, explainHint(err))
+				os.Exit(1)
+			}
+
+			if m, err := manifest.Load(manifestPath()); err == nil && m.Package.Name == oldName {
+				if err := manifest.EditFile(manifestPath(), manifest.Edit{Table: "package", Key: "name", Value: strconv.Quote(newName)}); err != nil {
+					cmd.PrintErrf("Error updating %s: %v\n", manifestPath(), err)
+					os.Exit(1)
+				}
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(tombstone); err != nil {
+					cmd.PrintErrf("Error encoding rename: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+			cmd.Printf("Renamed %s to %s\n", oldName, newName)
+			if tombstone.RenamedUntil != nil {
+				cmd.Printf("Installs of %s resolve to %s until %s\n", oldName, newName, tombstone.RenamedUntil.Local().Format("2006-01-02"))
+			}
+		},
+	}
+	renameCmd.Flags().Bool("json", false, "Print the tombstone left under the old name as JSON")
+	root.AddCommand(renameCmd)
+
 	// Publish test command
 	publishTestCmd := &cobra.Command{
 		Use:   "publish-test",
@@ -542,21 +3913,36 @@ spell appraise_main():
 			}
 
 			// Load manifest
-			m, err := manifest.Load("Bifrost.toml")
+			m, err := manifest.Load(manifestPath())
+			if err != nil {
+				cmd.PrintErrf("Error loading %s: %v\n", manifestPath(), err)
+				os.Exit(1)
+			}
+			if err := m.Validate(); err != nil {
+				cmd.PrintErrf("Error in %s: %v\n", manifestPath(), err)
+				os.Exit(1)
+			}
+			findings, err := lintPackage(cmd, m, 0)
 			if err != nil {
-				cmd.PrintErrf("Error loading Bifrost.toml: %v\n", err)
+				cmd.PrintErrf("Error checking package: %v\n", err)
 				os.Exit(1)
 			}
+			for _, f := range findings {
+				warn.Printf(warn.Package, "%s", f)
+			}
 
 			// Create archive
-			archiveName := fmt.Sprintf("%s-%s.tar.gz", m.Package.Name, m.Package.Version)
+			format, err := publishFormat(cmd)
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			archiveName := archive.FileName(m.Package.Name, m.Package.Version, format)
 			archivePath := filepath.Join(os.TempDir(), archiveName)
 
 			cmd.Printf("Creating package archive %s...\n", archiveName)
 
-			// Create archive using tar command
-			tarCmd := fmt.Sprintf("tar -czf %s --exclude='.git' --exclude='*.tar.gz' --exclude='bifrost' --exclude='carrion_modules' .", archivePath)
-			if err := runCommand(tarCmd); err != nil {
+			if err := packPackage(cmd, m, archivePath); err != nil {
 				cmd.PrintErrf("Error creating archive: %v\n", err)
 				os.Exit(1)
 			}
@@ -564,17 +3950,27 @@ spell appraise_main():
 
 			// Prepare metadata
 			metadata := &registry.PackageInfo{
-				Name:        m.Package.Name,
-				Version:     m.Package.Version,
-				Description: m.Package.Description,
-				Authors:     m.Package.Authors,
-				License:     m.Package.License,
-				Homepage:    "", // Not in manifest yet
-				Repository:  m.Package.Repository,
-				Keywords:    m.Package.Keywords,
+				Name:         m.Package.Name,
+				Version:      m.Package.Version,
+				Description:  m.Package.Description,
+				Authors:      m.Package.Authors,
+				License:      m.Package.License,
+				Homepage:     m.Package.Homepage,
+				Repository:   m.Package.Repository,
+				Keywords:     m.Package.Keywords,
+				Categories:   m.Package.Categories,
+				Changelog:    m.Package.Changelog,
+				Dependencies: m.Dependencies,
+			}
+			if format != archive.FormatGzip {
+				metadata.Format = string(format)
 			}
 
 			// Publish to registry with authentication
+			if err := orgPolicy.CheckRegistry(cfg.RegistryURL); err != nil {
+				cmd.PrintErrf("Error: %v\n%s", err, explainHint(err))
+				os.Exit(1)
+			}
 			client := registry.NewClient(cfg.RegistryURL)
 			if authConfig.AuthType == "token" {
 				client.SetAPIKey(authConfig.APIKey)
@@ -582,6 +3978,11 @@ spell appraise_main():
 				client.SetBasicAuth(authConfig.Username, authConfig.Password)
 			}
 
+			if err := checkArchiveSize(cmd, m, client, archivePath); err != nil {
+				cmd.PrintErrf("Error checking archive size: %v\n", err)
+				os.Exit(1)
+			}
+
 			cmd.Printf("Publishing %s@%s to %s (test mode)...\n", m.Package.Name, m.Package.Version, cfg.RegistryURL)
 			if err := client.PublishTest(archivePath, metadata); err != nil {
 				cmd.PrintErrf("Error publishing package: %v\n", err)
@@ -591,6 +3992,9 @@ spell appraise_main():
 			cmd.Printf("Successfully published %s@%s (test mode)!\n", m.Package.Name, m.Package.Version)
 		},
 	}
+	publishTestCmd.Flags().String("symlinks", "error", "How to pack symlinks: error, skip, or follow (links must stay inside the package)")
+	publishTestCmd.Flags().String("size-warning", "10MB", "Warn when the archive is larger than this (0 disables)")
+	publishTestCmd.Flags().String("format", "gzip", "Archive compression: gzip or zstd (zstd is smaller and faster to install, but needs a registry that serves it)")
 	root.AddCommand(publishTestCmd)
 
 	// Config command
@@ -610,8 +4014,36 @@ spell appraise_main():
   registry.password  - Registry password for basic auth
   registry.api-key   - API key for token auth
   registry.auth-type - Authentication type (basic, token, none)
+  registry.index     - URL of the registry's package index, whose checksums
+                     downloaded archives must match
+  registry.index-key - Base64 ed25519 key the index checksums must be signed with
   user.name          - Your name
-  user.email         - Your email address`,
+  user.email         - Your email address
+  install.layout     - carrion_modules layout (versioned, flat)
+  install.max-concurrent-downloads - Archives downloaded at once
+  install.limit-rate - Download rate cap per second, e.g. 1M
+  install.strict     - Refuse packages with install scripts (true, false)
+  install.script-timeout - How long install scripts may run, e.g. 10m
+  install.dir-mode   - Permissions of extracted directories, e.g. 0755
+  install.file-mode  - Permissions of extracted files, e.g. 0644
+  install.scanner    - Command archives are scanned with before extraction
+  install.read-only-store - Refuse changes to the user and global package
+                     directories without --allow-store-write (true, false)
+  tlog.url           - Transparency log archives must be recorded in
+  tlog.key           - PEM public key of the transparency log
+  lock.keys          - Comma-separated base64 keys frozen installs trust
+                     signed lockfiles from
+  timeouts.query     - How long searches and metadata lookups may take, e.g. 30s
+  timeouts.download  - How long a download may wait for data, e.g. 10m
+  timeouts.publish   - How long publishing may take, e.g. 10m
+  registries.<name>.url - URL of an additional registry, searched alongside
+                     the default one
+  registries.<name>.username, .password, .api-key, .auth-type
+                     - Credentials of that registry
+  registries.<name>.index, .index-key
+                     - Package index of that registry
+  scopes.@<scope>    - Registry name or URL that packages named
+                     @<scope>/<name> are fetched from, with its credentials`,
 		Args: cobra.ExactArgs(2),
 		Run: func(cmd *cobra.Command, args []string) {
 			key := args[0]
@@ -645,13 +4077,128 @@ spell appraise_main():
 					os.Exit(1)
 				}
 				userConfig.Registry.AuthType = value
+			case "registry.index", "registry.index-key":
+				if err := setRegistryField(&userConfig.Registry, strings.TrimPrefix(key, "registry."), value); err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
 			case "user.name":
 				userConfig.User.Name = value
 			case "user.email":
 				userConfig.User.Email = value
+			case "install.layout":
+				if _, err := config.ParseLayout(value); err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				userConfig.Install.Layout = value
+			case "install.max-concurrent-downloads":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 1 {
+					cmd.PrintErrln("Error: max-concurrent-downloads must be a positive number")
+					os.Exit(1)
+				}
+				userConfig.Install.MaxConcurrentDownloads = n
+			case "install.limit-rate":
+				if _, err := archive.ParseSize(value); err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				userConfig.Install.LimitRate = value
+			case "install.strict":
+				strict, err := strconv.ParseBool(value)
+				if err != nil {
+					cmd.PrintErrln("Error: strict must be true or false")
+					os.Exit(1)
+				}
+				userConfig.Install.Strict = strict
+			case "install.script-timeout":
+				if d, err := time.ParseDuration(value); err != nil || d < 0 {
+					cmd.PrintErrln("Error: script-timeout must be a duration such as 10m, or 0 for no limit")
+					os.Exit(1)
+				}
+				userConfig.Install.ScriptTimeout = value
+			case "timeouts.query", "timeouts.download", "timeouts.publish":
+				if _, err := parseTimeout(value); err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				switch key {
+				case "timeouts.query":
+					userConfig.Timeouts.Query = value
+				case "timeouts.download":
+					userConfig.Timeouts.Download = value
+				default:
+					userConfig.Timeouts.Publish = value
+				}
+			case "install.dir-mode", "install.file-mode":
+				if _, err := config.ParseMode(value); err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				if key == "install.dir-mode" {
+					userConfig.Install.DirMode = value
+				} else {
+					userConfig.Install.FileMode = value
+				}
+			case "install.scanner":
+				userConfig.Install.Scanner = value
+			case "tlog.url":
+				u, err := url.Parse(value)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					cmd.PrintErrf("Error: invalid transparency log URL %q: expected http:// or https:// followed by a host\n", value)
+					os.Exit(1)
+				}
+				userConfig.TransparencyLog.URL = strings.TrimRight(value, "/")
+			case "tlog.key":
+				path, err := filepath.Abs(value)
+				if err == nil {
+					_, err = tlog.LoadKey(path)
+				}
+				if err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				userConfig.TransparencyLog.Key = path
+			case "lock.keys":
+				var keys []string
+				for _, key := range strings.Split(value, ",") {
+					if _, err := locksign.ParsePublicKey(key); err != nil {
+						cmd.PrintErrf("Error: %v\n", err)
+						os.Exit(1)
+					}
+					keys = append(keys, strings.TrimSpace(key))
+				}
+				userConfig.Lock.Keys = keys
+			case "install.read-only-store":
+				readOnly, err := strconv.ParseBool(value)
+				if err != nil {
+					cmd.PrintErrln("Error: read-only-store must be true or false")
+					os.Exit(1)
+				}
+				userConfig.Install.ReadOnlyStore = readOnly
 			default:
-				cmd.PrintErrf("Error: unknown config key '%s'\n", key)
-				os.Exit(1)
+				if scope, ok := strings.CutPrefix(key, "scopes."); ok {
+					if err := setScope(userConfig, scope, value); err != nil {
+						cmd.PrintErrf("Error: %v\n", err)
+						os.Exit(1)
+					}
+					break
+				}
+				name, field, ok := parseRegistriesKey(key)
+				if !ok || field == "" || name == config.DefaultRegistryName {
+					cmd.PrintErrf("Error: unknown config key '%s'\n", key)
+					os.Exit(1)
+				}
+				registryConfig := userConfig.Registries[name]
+				if err := setRegistryField(&registryConfig, field, value); err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				if userConfig.Registries == nil {
+					userConfig.Registries = make(map[string]config.RegistryConfig)
+				}
+				userConfig.Registries[name] = registryConfig
 			}
 
 			if err := cfg.SaveUserConfig(userConfig); err != nil {
@@ -688,6 +4235,12 @@ spell appraise_main():
 				if userConfig.Registry.APIKey != "" {
 					cmd.Printf("  api-key: %s\n", maskAPIKey(userConfig.Registry.APIKey))
 				}
+				if userConfig.Registry.Index != "" {
+					cmd.Printf("  index: %s\n", userConfig.Registry.Index)
+				}
+				if userConfig.Registry.IndexKey != "" {
+					cmd.Printf("  index-key: %s\n", userConfig.Registry.IndexKey)
+				}
 				
 				if userConfig.User.Name != "" || userConfig.User.Email != "" {
 					cmd.Println("\nUser information:")
@@ -698,6 +4251,76 @@ spell appraise_main():
 						cmd.Printf("  email: %s\n", userConfig.User.Email)
 					}
 				}
+
+				if installConfig := userConfig.Install; installConfig != (config.InstallConfig{}) {
+					cmd.Println("\nInstall configuration:")
+					if installConfig.Layout != "" {
+						cmd.Printf("  layout: %s\n", installConfig.Layout)
+					}
+					if installConfig.MaxConcurrentDownloads != 0 {
+						cmd.Printf("  max-concurrent-downloads: %d\n", installConfig.MaxConcurrentDownloads)
+					}
+					if installConfig.LimitRate != "" {
+						cmd.Printf("  limit-rate: %s\n", installConfig.LimitRate)
+					}
+					if installConfig.Strict {
+						cmd.Println("  strict: true")
+					}
+					if installConfig.ScriptTimeout != "" {
+						cmd.Printf("  script-timeout: %s\n", installConfig.ScriptTimeout)
+					}
+				}
+
+				if timeouts := userConfig.Timeouts; timeouts != (config.TimeoutConfig{}) {
+					cmd.Println("\nTimeouts:")
+					if timeouts.Query != "" {
+						cmd.Printf("  query: %s\n", timeouts.Query)
+					}
+					if timeouts.Download != "" {
+						cmd.Printf("  download: %s\n", timeouts.Download)
+					}
+					if timeouts.Publish != "" {
+						cmd.Printf("  publish: %s\n", timeouts.Publish)
+					}
+				}
+
+				registryNames := make([]string, 0, len(userConfig.Registries))
+				for name := range userConfig.Registries {
+					registryNames = append(registryNames, name)
+				}
+				sort.Strings(registryNames)
+				for _, name := range registryNames {
+					registryConfig := userConfig.Registries[name]
+					cmd.Printf("\nRegistry %s:\n", name)
+					cmd.Printf("  url: %s\n", registryConfig.URL)
+					if registryConfig.AuthType != "" {
+						cmd.Printf("  auth-type: %s\n", registryConfig.AuthType)
+					}
+					if registryConfig.Username != "" {
+						cmd.Printf("  username: %s\n", registryConfig.Username)
+					}
+					if registryConfig.APIKey != "" {
+						cmd.Printf("  api-key: %s\n", maskAPIKey(registryConfig.APIKey))
+					}
+					if registryConfig.Index != "" {
+						cmd.Printf("  index: %s\n", registryConfig.Index)
+					}
+					if registryConfig.IndexKey != "" {
+						cmd.Printf("  index-key: %s\n", registryConfig.IndexKey)
+					}
+				}
+
+				if len(userConfig.Scopes) > 0 {
+					cmd.Println("\nScopes:")
+					scopes := make([]string, 0, len(userConfig.Scopes))
+					for scope := range userConfig.Scopes {
+						scopes = append(scopes, scope)
+					}
+					sort.Strings(scopes)
+					for _, scope := range scopes {
+						cmd.Printf("  %s: %s\n", scope, userConfig.Scopes[scope])
+					}
+				}
 			} else {
 				// Show specific key
 				key := args[0]
@@ -714,13 +4337,104 @@ spell appraise_main():
 					value = maskAPIKey(userConfig.Registry.APIKey)
 				case "registry.auth-type":
 					value = userConfig.Registry.AuthType
+				case "registry.index":
+					value = userConfig.Registry.Index
+				case "registry.index-key":
+					value = userConfig.Registry.IndexKey
 				case "user.name":
 					value = userConfig.User.Name
 				case "user.email":
 					value = userConfig.User.Email
+				case "install.layout":
+					value = userConfig.Install.Layout
+					if value == "" {
+						value = string(config.LayoutVersioned)
+					}
+				case "install.max-concurrent-downloads":
+					n := userConfig.Install.MaxConcurrentDownloads
+					if n == 0 {
+						n = install.DefaultMaxConcurrentDownloads
+					}
+					value = strconv.Itoa(n)
+				case "install.limit-rate":
+					value = userConfig.Install.LimitRate
+					if value == "" {
+						value = "unlimited"
+					}
+				case "install.strict":
+					value = strconv.FormatBool(userConfig.Install.Strict)
+				case "install.script-timeout":
+					value = userConfig.Install.ScriptTimeout
+					if value == "" {
+						value = install.DefaultScriptTimeout.String()
+					}
+				case "timeouts.query":
+					value = userConfig.Timeouts.Query
+					if value == "" {
+						value = registry.DefaultTimeouts.Query.String()
+					}
+				case "timeouts.download":
+					value = userConfig.Timeouts.Download
+					if value == "" {
+						value = registry.DefaultTimeouts.Download.String()
+					}
+				case "timeouts.publish":
+					value = userConfig.Timeouts.Publish
+					if value == "" {
+						value = registry.DefaultTimeouts.Publish.String()
+					}
+				case "install.dir-mode":
+					value = userConfig.Install.DirMode
+					if value == "" {
+						value = fmt.Sprintf("%04o", install.DefaultDirMode)
+					}
+				case "install.file-mode":
+					value = userConfig.Install.FileMode
+					if value == "" {
+						value = fmt.Sprintf("%04o", install.DefaultFileMode)
+					}
+				case "install.scanner":
+					value = userConfig.Install.Scanner
+				case "install.read-only-store":
+					value = strconv.FormatBool(userConfig.Install.ReadOnlyStore)
+				case "tlog.url":
+					value = userConfig.TransparencyLog.URL
+				case "tlog.key":
+					value = userConfig.TransparencyLog.Key
+				case "lock.keys":
+					value = strings.Join(userConfig.Lock.Keys, ",")
 				default:
-					cmd.PrintErrf("Error: unknown config key '%s'\n", key)
-					os.Exit(1)
+					if scope, ok := strings.CutPrefix(key, "scopes."); ok {
+						target, found := userConfig.Scopes[scope]
+						if !found {
+							cmd.PrintErrf("Error: unknown config key '%s'\n", key)
+							os.Exit(1)
+						}
+						value = target
+						break
+					}
+					name, field, ok := parseRegistriesKey(key)
+					registryConfig, found := userConfig.Registries[name]
+					if !ok || field == "" || !found {
+						cmd.PrintErrf("Error: unknown config key '%s'\n", key)
+						os.Exit(1)
+					}
+					switch field {
+					case "url":
+						value = registryConfig.URL
+					case "username":
+						value = registryConfig.Username
+					case "password":
+						value = "***" // Never show password
+					case "api-key":
+						value = maskAPIKey(registryConfig.APIKey)
+					case "auth-type":
+						value = registryConfig.AuthType
+					case "index":
+						value = registryConfig.Index
+					case "index-key":
+						value = registryConfig.IndexKey
+					}
 				}
 				
 				cmd.Printf("%s = %s\n", key, value)
@@ -750,13 +4464,78 @@ spell appraise_main():
 				userConfig.Registry.Password = ""
 			case "registry.api-key":
 				userConfig.Registry.APIKey = ""
+			case "registry.index":
+				userConfig.Registry.Index = ""
+			case "registry.index-key":
+				userConfig.Registry.IndexKey = ""
 			case "user.name":
 				userConfig.User.Name = ""
 			case "user.email":
 				userConfig.User.Email = ""
+			case "install.layout":
+				userConfig.Install.Layout = ""
+			case "install.max-concurrent-downloads":
+				userConfig.Install.MaxConcurrentDownloads = 0
+			case "install.limit-rate":
+				userConfig.Install.LimitRate = ""
+			case "install.strict":
+				userConfig.Install.Strict = false
+			case "install.script-timeout":
+				userConfig.Install.ScriptTimeout = ""
+			case "timeouts.query":
+				userConfig.Timeouts.Query = ""
+			case "timeouts.download":
+				userConfig.Timeouts.Download = ""
+			case "timeouts.publish":
+				userConfig.Timeouts.Publish = ""
+			case "install.dir-mode":
+				userConfig.Install.DirMode = ""
+			case "install.file-mode":
+				userConfig.Install.FileMode = ""
+			case "install.scanner":
+				userConfig.Install.Scanner = ""
+			case "install.read-only-store":
+				userConfig.Install.ReadOnlyStore = false
+			case "tlog.url":
+				userConfig.TransparencyLog.URL = ""
+			case "tlog.key":
+				userConfig.TransparencyLog.Key = ""
+			case "lock.keys":
+				userConfig.Lock.Keys = nil
 			default:
-				cmd.PrintErrf("Error: cannot unset '%s' or key does not exist\n", key)
-				os.Exit(1)
+				if scope, ok := strings.CutPrefix(key, "scopes."); ok {
+					if _, found := userConfig.Scopes[scope]; !found {
+						cmd.PrintErrf("Error: cannot unset '%s' or key does not exist\n", key)
+						os.Exit(1)
+					}
+					delete(userConfig.Scopes, scope)
+					break
+				}
+				name, field, ok := parseRegistriesKey(key)
+				registryConfig, found := userConfig.Registries[name]
+				if !ok || !found || field == "url" {
+					cmd.PrintErrf("Error: cannot unset '%s' or key does not exist\n", key)
+					os.Exit(1)
+				}
+				switch field {
+				case "":
+					delete(userConfig.Registries, name)
+				case "username":
+					registryConfig.Username = ""
+				case "password":
+					registryConfig.Password = ""
+				case "api-key":
+					registryConfig.APIKey = ""
+				case "auth-type":
+					registryConfig.AuthType = ""
+				case "index":
+					registryConfig.Index = ""
+				case "index-key":
+					registryConfig.IndexKey = ""
+				}
+				if field != "" {
+					userConfig.Registries[name] = registryConfig
+				}
 			}
 
 			if err := cfg.SaveUserConfig(userConfig); err != nil {
@@ -771,6 +4550,168 @@ spell appraise_main():
 
 	root.AddCommand(configCmd)
 
+	// Policy command
+	policyCmd := &cobra.Command{
+		Use:   "policy",
+		Short: "Show the organization policy",
+		Long:  "Show the organization policy file at " + policy.DefaultPath() + ", whose rules user configuration cannot override",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(orgPolicy); err != nil {
+					cmd.PrintErrf("Error encoding policy: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+
+			if orgPolicy.Path() == "" {
+				cmd.Printf("No policy file at %s\n", policy.DefaultPath())
+				return
+			}
+			cmd.Printf("Policy: %s\n", orgPolicy.Path())
+			if len(orgPolicy.AllowedRegistries) > 0 {
+				cmd.Printf("Allowed registries: %s\n", strings.Join(orgPolicy.AllowedRegistries, ", "))
+			} else {
+				cmd.Println("Allowed registries: any")
+			}
+			cmd.Printf("Require signatures: %t\n", orgPolicy.RequireSignatures)
+			cmd.Printf("Forbid install scripts: %t\n", orgPolicy.ForbidInstallScripts)
+			if len(orgPolicy.AllowedLicenses) > 0 {
+				cmd.Printf("Allowed licenses: %s\n", strings.Join(orgPolicy.AllowedLicenses, ", "))
+			}
+			if len(orgPolicy.DeniedLicenses) > 0 {
+				cmd.Printf("Denied licenses: %s\n", strings.Join(orgPolicy.DeniedLicenses, ", "))
+			}
+			if len(orgPolicy.Blocked) > 0 {
+				cmd.Println("Blocked packages:")
+				for _, b := range orgPolicy.Blocked {
+					line := "  " + b.Name
+					if b.Versions != "" {
+						line += " " + b.Versions
+					}
+					if b.Reason != "" {
+						line += " (" + b.Reason + ")"
+					}
+					cmd.Println(line)
+				}
+			}
+		},
+	}
+	policyCmd.Flags().Bool("json", false, "Output the policy as JSON")
+
+	policyReportCmd := &cobra.Command{
+		Use:   "report",
+		Short: "Check the locked packages against the organization policy",
+		Long: `Check every package in Bifrost.lock against the organization policy: allowed
+registries, blocked versions, required signatures and license rules. Each
+violation is listed, and the command exits with status 1 if there is any.
+--report writes the results to a file as JSON, to attach to a release.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			installer := install.New(cfg)
+			installer.SetPolicy(orgPolicy)
+			report, err := installer.PolicyReport(manifestPath())
+			if err != nil {
+				cmd.PrintErrf("Error: %v\n%s", err, explainHint(err))
+				os.Exit(1)
+			}
+			if path, _ := cmd.Flags().GetString("report"); path != "" {
+				if err := report.Save(path); err != nil {
+					cmd.PrintErrf("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(report); err != nil {
+					cmd.PrintErrf("Error encoding report: %v\n", err)
+					os.Exit(1)
+				}
+			} else {
+				if report.Policy == "" {
+					cmd.Printf("No policy file at %s\n", policy.DefaultPath())
+				} else {
+					cmd.Printf("Policy: %s\n", report.Policy)
+				}
+				for _, pkg := range report.Packages {
+					if len(pkg.Violations) == 0 {
+						cmd.Printf("%s@%s: ok\n", pkg.Name, pkg.Version)
+						continue
+					}
+					cmd.Printf("%s@%s: violates the policy\n", pkg.Name, pkg.Version)
+					for _, v := range pkg.Violations {
+						cmd.Printf("  %s: %s\n", v.Rule, v.Message)
+					}
+				}
+				if report.Passed {
+					cmd.Printf("Passed: %d package(s) comply with the policy\n", len(report.Packages))
+				} else {
+					cmd.Printf("Failed: %d of %d package(s) violate the policy\n", len(report.Failed()), len(report.Packages))
+				}
+			}
+			if !report.Passed {
+				os.Exit(1)
+			}
+		},
+	}
+	policyReportCmd.Flags().Bool("json", false, "Print the report as JSON")
+	policyReportCmd.Flags().String("report", "", "Also write the report as JSON to this file")
+	policyCmd.AddCommand(policyReportCmd)
+	root.AddCommand(policyCmd)
+
+	// Explain command
+	explainCmd := &cobra.Command{
+		Use:   "explain [code]",
+		Short: "Explain an error code",
+		Long:  "Describe an error code such as E010, with its likely causes and how to fix it. Without a code, list every code.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			asJSON, _ := cmd.Flags().GetBool("json")
+			var out interface{} = errcode.Entries()
+			var entry errcode.Entry
+			if len(args) == 1 {
+				var ok bool
+				if entry, ok = errcode.Lookup(args[0]); !ok {
+					cmd.PrintErrf("Error: unknown error code %q; run 'bifrost explain' to list them\n", args[0])
+					os.Exit(1)
+				}
+				out = entry
+			}
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(out); err != nil {
+					cmd.PrintErrf("Error encoding explanation: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+
+			if len(args) == 0 {
+				for _, e := range errcode.Entries() {
+					cmd.Printf("%s  %s\n", e.Code, e.Title)
+				}
+				return
+			}
+			cmd.Printf("%s: %s\n\n%s\n", entry.Code, entry.Title, entry.Description)
+			cmd.Println("\nLikely causes:")
+			for _, c := range entry.Causes {
+				cmd.Printf("  - %s\n", c)
+			}
+			cmd.Println("\nHow to fix it:")
+			for _, r := range entry.Remedies {
+				cmd.Printf("  - %s\n", r)
+			}
+		},
+	}
+	explainCmd.Flags().Bool("json", false, "Output the explanation as JSON")
+	root.AddCommand(explainCmd)
+
 	// Version command
 	root.AddCommand(&cobra.Command{
 		Use:   "version",
@@ -835,5 +4776,52 @@ spell appraise_main():
 		},
 	})
 
+	// Plugins command
+	root.AddCommand(&cobra.Command{
+		Use:   "plugins",
+		Short: "List available plugins",
+		Long:  "List bifrost-<name> executables on PATH, which can be run as 'bifrost <name>'",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			names := plugin.List()
+			if len(names) == 0 {
+				cmd.Println("No plugins found on PATH.")
+				return
+			}
+
+			cmd.Printf("Found %d plugin(s):\n\n", len(names))
+			for _, name := range names {
+				path, _ := plugin.Find(name)
+				cmd.Printf("  %s (%s)\n", name, path)
+			}
+		},
+	})
+
+	// Unknown subcommands reach the root command, which dispatches them to
+	// bifrost-<name> plugins on PATH. Global flags before the plugin name
+	// have been applied by then; everything after it is the plugin's.
+	root.Args = cobra.ArbitraryArgs
+	root.Flags().SetInterspersed(false)
+	root.Run = func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Help()
+			return
+		}
+		path, err := plugin.Find(args[0])
+		if err != nil {
+			cmd.PrintErrf("Error: unknown command %q for %q\n", args[0], cmd.CommandPath())
+			if suggestions := cmd.SuggestionsFor(args[0]); len(suggestions) > 0 {
+				cmd.PrintErrf("\nDid you mean this?\n\t%s\n", strings.Join(suggestions, "\n\t"))
+			}
+			cmd.PrintErrf("Run '%s --help' for usage.\n", cmd.CommandPath())
+			os.Exit(1)
+		}
+		code, err := plugin.Run(path, args[1:], pluginContext(cfg))
+		if err != nil {
+			cmd.PrintErrf("Error: %v\n", err)
+		}
+		os.Exit(code)
+	}
+
 	cobra.CheckErr(root.Execute())
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/locksign"
+	"github.com/javanhut/bifrost/internal/manifest"
+)
+
+// TestMain runs main instead of the tests when the test binary is started
+// as bifrost by runBifrost
+func TestMain(m *testing.M) {
+	if os.Getenv("BIFROST_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runBifrost runs bifrost with args in dir, using home as CARRION_HOME
+// and env on top of the test's environment, and returns its combined output
+func runBifrost(t *testing.T, dir, home string, env []string, args ...string) (string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"BIFROST_TEST_MAIN=1",
+		"CARRION_HOME="+home,
+		"CARRION_REGISTRY_URL=",
+		locksign.PublicKeyEnv+"=",
+		locksign.PrivateKeyEnv+"=",
+	)
+	cmd.Env = append(cmd.Env, env...)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+func TestPluginDispatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the plugin in this test is a shell script")
+	}
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho \"registry=$BIFROST_REGISTRY_URL manifest=$BIFROST_MANIFEST args=$*\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "bifrost-hello"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	project := t.TempDir()
+	manifestPath := filepath.Join(project, "Bifrost.toml")
+	if err := os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env := []string{"PATH=" + bin + string(os.PathListSeparator) + os.Getenv("PATH")}
+
+	// Global flags before the plugin name are applied to its context, and
+	// flags after it are passed through
+	out, err := runBifrost(t, t.TempDir(), t.TempDir(), env, "--registry", "https://registry.example.com", "--manifest-path", project, "hello", "--verbose", "world")
+	if err != nil {
+		t.Fatalf("bifrost hello error = %v\n%s", err, out)
+	}
+	want := "registry=https://registry.example.com manifest=" + manifestPath + " args=--verbose world"
+	if strings.TrimSpace(out) != want {
+		t.Errorf("plugin output = %q, want %q", strings.TrimSpace(out), want)
+	}
+
+	// Unknown commands that are not plugins still fail
+	out, err = runBifrost(t, t.TempDir(), t.TempDir(), env, "--registry", "https://registry.example.com", "instal")
+	if err == nil || !strings.Contains(out, `unknown command "instal"`) || !strings.Contains(out, "install") {
+		t.Errorf("bifrost instal = %v\n%s, want an unknown command error suggesting install", err, out)
+	}
+}
+
+func TestFrozenInstallRequiresSignatureWithPinnedKeys(t *testing.T) {
+	home, project := t.TempDir(), t.TempDir()
+	manifestPath := filepath.Join(project, manifest.FileName)
+	if err := os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := manifest.Load(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := lockfile.New()
+	lock.ManifestHash = m.DependencyHash()
+	lockPath := filepath.Join(project, lockfile.FileName)
+	if err := lock.Save(lockPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// keygen signs the lockfile and pins the key in lock.keys
+	if out, err := runBifrost(t, project, home, nil, "lock", "keygen"); err != nil {
+		t.Fatalf("bifrost lock keygen error = %v\n%s", err, out)
+	}
+	out, err := runBifrost(t, project, home, nil, "install", "--frozen-lockfile")
+	if err != nil || !strings.Contains(out, "Verified "+lockfile.FileName+" signature") {
+		t.Fatalf("bifrost install --frozen-lockfile = %v\n%s, want the signature verified", err, out)
+	}
+
+	// Deleting the key and the signature together must not turn the check off
+	for _, path := range []string{locksign.PublicKeyPath(lockPath), lockPath + locksign.SignatureSuffix} {
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, err = runBifrost(t, project, home, nil, "install", "--frozen-lockfile")
+	if err == nil || !strings.Contains(out, "lockfile is not signed") {
+		t.Errorf("bifrost install --frozen-lockfile without key or signature = %v\n%s, want it refused", err, out)
+	}
+}
@@ -3,28 +3,324 @@ package archive
 
 import (
 	"archive/tar"
-	"compress/gzip"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
 )
 
-func Pack(srcDir, destTarGz string) error {
+// Option configures Pack
+type Option func(*packOptions)
+
+type packOptions struct {
+	excludes    []string
+	ignoreFiles []string
+	symlinks    SymlinkPolicy
+	format      Format
+}
+
+// SymlinkPolicy decides what Pack does with symbolic links
+type SymlinkPolicy string
+
+const (
+	// SymlinkError fails the pack when a symlink is found. It is the default.
+	SymlinkError SymlinkPolicy = "error"
+	// SymlinkSkip leaves symlinks out of the archive
+	SymlinkSkip SymlinkPolicy = "skip"
+	// SymlinkFollow stores the file or directory a symlink points at, which
+	// must lie inside the source directory
+	SymlinkFollow SymlinkPolicy = "follow"
+)
+
+// ParseSymlinkPolicy parses "error", "skip" or "follow"
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch p := SymlinkPolicy(s); p {
+	case SymlinkError, SymlinkSkip, SymlinkFollow:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid symlink policy %q: expected error, skip or follow", s)
+}
+
+// WithExcludes leaves out paths matching the given gitignore-style patterns
+func WithExcludes(patterns ...string) Option {
+	return func(o *packOptions) {
+		o.excludes = append(o.excludes, patterns...)
+	}
+}
+
+// WithIgnoreFile reads additional patterns from a gitignore-style file
+// relative to the source directory, such as IgnoreFileName. Patterns in the
+// file take precedence over those given with WithExcludes.
+func WithIgnoreFile(name string) Option {
+	return func(o *packOptions) {
+		o.ignoreFiles = append(o.ignoreFiles, name)
+	}
+}
+
+// WithSymlinks sets how symlinks inside the source directory are handled
+func WithSymlinks(policy SymlinkPolicy) Option {
+	return func(o *packOptions) {
+		o.symlinks = policy
+	}
+}
+
+// WithFormat sets the compression of the archive. The default is FormatGzip.
+func WithFormat(format Format) Option {
+	return func(o *packOptions) {
+		o.format = format
+	}
+}
+
+// Pack writes the contents of srcDir to a compressed tarball at destTarGz,
+// gzipped unless another format is chosen with WithFormat. Entries are
+// stored relative to srcDir in lexical order, with names normalized as
+// described by Names. Symlinks are an error unless another policy is chosen
+// with WithSymlinks.
+func Pack(srcDir, destTarGz string, opts ...Option) error {
+	var o packOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	entries, err := collect(srcDir, destTarGz, opts)
+	if err != nil {
+		return err
+	}
+
 	out, err := os.Create(destTarGz)
 	if err != nil {
 		return err
 	}
 	defer out.Close()
 
-	gw := gzip.NewWriter(out)
-	defer gw.Close()
+	gw, err := newWriter(out, o.format)
+	if err != nil {
+		return err
+	}
 	tw := tar.NewWriter(gw)
-	defer tw.Close()
 
-	// walk srcDir and add files to tw…
-	// (omitted for brevity; use filepath.Walk)
+	for _, e := range entries {
+		if err := writeEntry(tw, e); err != nil {
+			return fmt.Errorf("failed to add %s: %w", e.rel, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// File is a regular file Pack would include
+type File struct {
+	// Path is slash-separated and relative to the source directory
+	Path string
+	Size int64
+}
+
+// Files returns the regular files Pack would include from srcDir
+func Files(srcDir string, opts ...Option) ([]File, error) {
+	entries, err := collect(srcDir, "", opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []File
+	for _, e := range entries {
+		if e.info.Mode().IsRegular() {
+			files = append(files, File{Path: e.rel, Size: e.info.Size()})
+		}
+	}
+	return files, nil
+}
+
+type entry struct {
+	path string
+	rel  string
+	info fs.FileInfo
+}
+
+// collect walks srcDir and returns the entries to pack, skipping ignored
+// paths and the destination archive itself
+func collect(srcDir, destTarGz string, opts []Option) ([]entry, error) {
+	o := &packOptions{symlinks: SymlinkError}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	ignore, err := NewIgnore(o.excludes...)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range o.ignoreFiles {
+		ig, err := LoadIgnore(filepath.Join(srcDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ignore file: %w", err)
+		}
+		ignore.rules = append(ignore.rules, ig.rules...)
+	}
+
+	info, err := os.Stat(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", srcDir)
+	}
+
+	root, err := filepath.Abs(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return nil, err
+	}
+
+	c := &collector{
+		root:     root,
+		ignore:   ignore,
+		symlinks: o.symlinks,
+		names:    NewNames(),
+		active:   make(map[string]bool),
+	}
+	if destTarGz != "" {
+		c.destAbs, _ = filepath.Abs(destTarGz)
+	}
+
+	if err := c.walk(srcDir, ""); err != nil {
+		return nil, err
+	}
+	return c.entries, nil
+}
+
+type collector struct {
+	root     string
+	ignore   *Ignore
+	symlinks SymlinkPolicy
+	destAbs  string
+	names    *Names
+	entries  []entry
+	// active holds the real paths of directories being walked, so that
+	// followed links cannot loop forever
+	active map[string]bool
+}
+
+func (c *collector) walk(dir, relDir string) error {
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if c.active[real] {
+		return fmt.Errorf("symlink cycle at %s", relDir)
+	}
+	c.active[real] = true
+	defer delete(c.active, real)
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range dirEntries {
+		p := filepath.Join(dir, d.Name())
+		rel := path.Join(relDir, d.Name())
+
+		if c.ignore.Match(rel, d.IsDir()) {
+			continue
+		}
+		if abs, _ := filepath.Abs(p); abs == c.destAbs {
+			continue
+		}
+
+		info, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			switch c.symlinks {
+			case SymlinkSkip:
+				continue
+			case SymlinkFollow:
+				target, err := c.resolve(p, rel)
+				if err != nil {
+					return err
+				}
+				if info, err = os.Stat(target); err != nil {
+					return err
+				}
+				if info.IsDir() && c.ignore.Match(rel, true) {
+					continue
+				}
+				p = target
+			default:
+				link, _ := os.Readlink(p)
+				return fmt.Errorf("%s is a symlink to %s; skip or follow symlinks to publish it", rel, link)
+			}
+		}
+
+		if rel, err = c.names.Add(rel); err != nil {
+			return err
+		}
+		c.entries = append(c.entries, entry{path: p, rel: rel, info: info})
+		if info.IsDir() {
+			if err := c.walk(p, rel); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
+// resolve returns the real path a symlink points at, which must lie inside
+// the package root
+func (c *collector) resolve(p, rel string) (string, error) {
+	target, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", fmt.Errorf("%s is a broken symlink: %w", rel, err)
+	}
+
+	inside, err := filepath.Rel(c.root, target)
+	if err != nil || inside == ".." || strings.HasPrefix(inside, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s links to %s, outside the package", rel, target)
+	}
+	return target, nil
+}
+
+func writeEntry(tw *tar.Writer, e entry) error {
+	hdr, err := tar.FileInfoHeader(e.info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = e.rel
+	if e.info.IsDir() {
+		hdr.Name += "/"
+	}
+	// Published archives should not carry the author's account details
+	hdr.Uid, hdr.Gid = 0, 0
+	hdr.Uname, hdr.Gname = "", ""
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !e.info.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(e.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
 func Unpack(tarGzPath, destDir string) error {
 	f, err := os.Open(tarGzPath)
 	if err != nil {
@@ -32,7 +328,7 @@ func Unpack(tarGzPath, destDir string) error {
 	}
 	defer f.Close()
 
-	gr, err := gzip.NewReader(f)
+	gr, err := NewReader(f)
 	if err != nil {
 		return err
 	}
@@ -50,3 +346,33 @@ func Unpack(tarGzPath, destDir string) error {
 	}
 	return nil
 }
+
+// ReadFile returns the contents of the file at name, a slash-separated path
+// relative to the package root, inside the archive at archivePath
+func ReadFile(archivePath, name string) ([]byte, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	want := path.Clean(strings.TrimPrefix(name, "./"))
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in %s", name, filepath.Base(archivePath))
+		} else if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg && path.Clean(strings.TrimPrefix(hdr.Name, "./")) == want {
+			return io.ReadAll(tr)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -81,7 +82,7 @@ func TestPack_Errors(t *testing.T) {
 			name:    "non-existent source",
 			srcDir:  "/non/existent/path",
 			destTar: "test.tar.gz",
-			wantErr: false, // Current implementation doesn't check if srcDir exists
+			wantErr: true,
 		},
 		{
 			name:    "invalid destination",
@@ -292,4 +293,323 @@ func TestArchiveEdgeCases(t *testing.T) {
 			t.Fatalf("Pack() with special filename error = %v", err)
 		}
 	})
-}
\ No newline at end of file
+}
+
+// writeTree creates files under dir from a map of slash-separated paths
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		fullPath := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+}
+
+// archiveEntries returns the names and contents of regular files in a tarball
+func archiveEntries(t *testing.T, archivePath string) map[string]string {
+	t.Helper()
+	f, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	defer f.Close()
+	gr, err := NewReader(f)
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	defer gr.Close()
+
+	entries := make(map[string]string)
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read archive: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", hdr.Name, err)
+		}
+		entries[hdr.Name] = string(data)
+	}
+	return entries
+}
+
+func TestPack_Contents(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	writeTree(t, srcDir, map[string]string{
+		"Bifrost.toml":     "[package]",
+		"src/main.crl":     "grim Main:",
+		"src/lib/util.crl": "spell util():",
+	})
+
+	archivePath := filepath.Join(tempDir, "package.tar.gz")
+	if err := Pack(srcDir, archivePath); err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	got := archiveEntries(t, archivePath)
+	want := map[string]string{
+		"Bifrost.toml":     "[package]",
+		"src/main.crl":     "grim Main:",
+		"src/lib/util.crl": "spell util():",
+	}
+	if len(got) != len(want) {
+		t.Errorf("archive has %d files, want %d: %v", len(got), len(want), got)
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Errorf("%s = %q, want %q", name, got[name], content)
+		}
+	}
+}
+
+func TestPack_PathsWithSpacesAndUnicode(t *testing.T) {
+	tempDir := filepath.Join(t.TempDir(), "my projects", "données")
+	srcDir := filepath.Join(tempDir, "приложение")
+	files := map[string]string{
+		"Bifrost.toml":      "[package]",
+		"src/main file.crl": "grim Main:",
+		"src/été/util.crl":  "spell util():",
+		"docs/読んで.md":       "# docs",
+	}
+	writeTree(t, srcDir, files)
+
+	archivePath := filepath.Join(tempDir, "app 0.1.0.tar.gz")
+	if err := Pack(srcDir, archivePath); err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	got := archiveEntries(t, archivePath)
+	if len(got) != len(files) {
+		t.Errorf("archive has %d files, want %d: %v", len(got), len(files), got)
+	}
+	for name, content := range files {
+		if got[name] != content {
+			t.Errorf("%s = %q, want %q", name, got[name], content)
+		}
+	}
+}
+
+func TestPack_Ignore(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "pkg")
+	writeTree(t, srcDir, map[string]string{
+		"Bifrost.toml":            "[package]",
+		"src/main.crl":            "grim Main:",
+		"src/scratch.tmp":         "notes",
+		"data/large.bin":          "0000",
+		"docs/data/diagram.txt":   "keep",
+		"logs/debug.log":          "log",
+		"logs/keep.log":           "keep",
+		".git/HEAD":               "ref",
+		"carrion_modules/x/a.crl": "dep",
+		"old-0.1.0.tar.gz":        "archive",
+		"notes.md":                "manifest exclude",
+		IgnoreFileName:            "# local files\n/data/\n*.tmp\nlogs/*.log\n!logs/keep.log\n",
+	})
+
+	// The destination lives inside the source directory and must not pack itself
+	archivePath := filepath.Join(srcDir, "out.tgz")
+	opts := []Option{
+		WithExcludes(DefaultExcludes...),
+		WithExcludes("notes.md"),
+		WithIgnoreFile(IgnoreFileName),
+	}
+	if err := Pack(srcDir, archivePath, opts...); err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	got := archiveEntries(t, archivePath)
+	for _, name := range []string{"Bifrost.toml", "src/main.crl", "docs/data/diagram.txt", "logs/keep.log", IgnoreFileName} {
+		if _, ok := got[name]; !ok {
+			t.Errorf("expected %s in archive", name)
+		}
+	}
+	for _, name := range []string{"src/scratch.tmp", "data/large.bin", "logs/debug.log", ".git/HEAD", "carrion_modules/x/a.crl", "old-0.1.0.tar.gz", "notes.md", "out.tgz"} {
+		if _, ok := got[name]; ok {
+			t.Errorf("expected %s to be excluded", name)
+		}
+	}
+
+	files, err := Files(srcDir, opts...)
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	// Files does not know about the archive, so it lists out.tgz as well
+	if len(files) != len(got)+1 {
+		t.Errorf("Files() = %v, want the %d packed files plus out.tgz", files, len(got))
+	}
+	for _, f := range files {
+		if content, ok := got[f.Path]; ok && int64(len(content)) != f.Size {
+			t.Errorf("Files() size of %s = %d, want %d", f.Path, f.Size, len(content))
+		}
+	}
+}
+
+func TestPack_InvalidIgnorePattern(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTree(t, tempDir, map[string]string{IgnoreFileName: "[z-a\n"})
+
+	err := Pack(tempDir, filepath.Join(t.TempDir(), "out.tar.gz"), WithIgnoreFile(IgnoreFileName))
+	if err == nil {
+		t.Fatal("expected an error for a malformed pattern")
+	}
+}
+
+func TestPack_Symlinks(t *testing.T) {
+	outside := t.TempDir()
+	writeTree(t, outside, map[string]string{"secret.txt": "outside"})
+
+	tests := []struct {
+		name      string
+		link      string
+		target    func(srcDir string) string
+		policy    SymlinkPolicy
+		wantErr   string
+		wantFiles map[string]string
+	}{
+		{
+			name:    "error by default",
+			link:    "docs.md",
+			target:  func(string) string { return "README.md" },
+			wantErr: "docs.md is a symlink",
+		},
+		{
+			name:      "skip",
+			link:      "docs.md",
+			target:    func(string) string { return "README.md" },
+			policy:    SymlinkSkip,
+			wantFiles: map[string]string{"README.md": "# pkg"},
+		},
+		{
+			name:      "follow file",
+			link:      "docs.md",
+			target:    func(string) string { return "README.md" },
+			policy:    SymlinkFollow,
+			wantFiles: map[string]string{"docs.md": "# pkg"},
+		},
+		{
+			name:      "follow directory",
+			link:      "lib",
+			target:    func(srcDir string) string { return filepath.Join(srcDir, "src", "lib") },
+			policy:    SymlinkFollow,
+			wantFiles: map[string]string{"lib/util.crl": "spell util():", "src/lib/util.crl": "spell util():"},
+		},
+		{
+			name:    "follow outside the package",
+			link:    "secret.txt",
+			target:  func(string) string { return filepath.Join(outside, "secret.txt") },
+			policy:  SymlinkFollow,
+			wantErr: "outside the package",
+		},
+		{
+			name:    "follow broken link",
+			link:    "missing",
+			target:  func(string) string { return "does-not-exist" },
+			policy:  SymlinkFollow,
+			wantErr: "broken symlink",
+		},
+		{
+			name:    "follow cycle",
+			link:    "src/loop",
+			target:  func(string) string { return ".." },
+			policy:  SymlinkFollow,
+			wantErr: "symlink cycle",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			writeTree(t, srcDir, map[string]string{
+				"src/main.crl":     "grim Main:",
+				"src/lib/util.crl": "spell util():",
+				"README.md":        "# pkg",
+			})
+			if err := os.Symlink(tt.target(srcDir), filepath.Join(srcDir, tt.link)); err != nil {
+				t.Skipf("symlinks not supported: %v", err)
+			}
+
+			var opts []Option
+			if tt.policy != "" {
+				opts = append(opts, WithSymlinks(tt.policy))
+			}
+			archivePath := filepath.Join(t.TempDir(), "package.tar.gz")
+			err := Pack(srcDir, archivePath, opts...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Pack() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
+			}
+
+			got := archiveEntries(t, archivePath)
+			for name, content := range tt.wantFiles {
+				if got[name] != content {
+					t.Errorf("%s = %q, want %q", name, got[name], content)
+				}
+			}
+			if _, ok := got[tt.link]; ok && tt.policy == SymlinkSkip {
+				t.Errorf("skipped symlink %s was packed", tt.link)
+			}
+		})
+	}
+}
+
+func TestParseSymlinkPolicy(t *testing.T) {
+	for _, s := range []string{"error", "skip", "follow"} {
+		if p, err := ParseSymlinkPolicy(s); err != nil || string(p) != s {
+			t.Errorf("ParseSymlinkPolicy(%q) = %q, %v", s, p, err)
+		}
+	}
+	if _, err := ParseSymlinkPolicy("preserve"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, map[string]string{
+		"CHANGELOG.md": "## 1.0.0\n",
+		"docs/notes.md": "notes",
+	})
+	archivePath := filepath.Join(t.TempDir(), "pkg-1.0.0.tar.zst")
+	if err := Pack(srcDir, archivePath, WithFormat(FormatZstd)); err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "CHANGELOG.md", want: "## 1.0.0\n"},
+		{name: "./docs/notes.md", want: "notes"},
+		{name: "missing.md", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ReadFile(archivePath, tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ReadFile(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("ReadFile(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format is the compression of a package archive, named by its file
+// extension
+type Format string
+
+const (
+	// FormatGzip is a gzipped tarball. It is the default and what every
+	// registry serves.
+	FormatGzip Format = "tar.gz"
+	// FormatZstd is a zstd compressed tarball, smaller than gzip and much
+	// faster to decompress
+	FormatZstd Format = "tar.zst"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ParseFormat parses "gzip" or "zstd", also accepting the file extensions
+// "tar.gz" and "tar.zst". An empty string is FormatGzip.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "", "gzip", "gz", "tar.gz", "tgz":
+		return FormatGzip, nil
+	case "zstd", "zst", "tar.zst":
+		return FormatZstd, nil
+	}
+	return "", fmt.Errorf("invalid archive format %q: expected gzip or zstd", s)
+}
+
+// FileName returns the archive file name of a package version. The "/" of
+// a scoped name such as "@acme/utils" becomes "+" to keep it one file.
+func FileName(name, version string, format Format) string {
+	if format == "" {
+		format = FormatGzip
+	}
+	return fmt.Sprintf("%s-%s.%s", strings.ReplaceAll(name, "/", "+"), version, format)
+}
+
+// FormatOf returns the format named by the extension of path, and false if
+// it has none
+func FormatOf(path string) (Format, bool) {
+	switch {
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		return FormatGzip, true
+	case strings.HasSuffix(path, ".tar.zst"):
+		return FormatZstd, true
+	}
+	return "", false
+}
+
+// NewReader returns a reader of the tarball inside a compressed archive,
+// detecting gzip or zstd from the first bytes of r rather than trusting a
+// file name or Content-Type
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		dec, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("not a gzip or zstd archive")
+}
+
+// newWriter returns a writer compressing to w in format
+func newWriter(w io.Writer, format Format) (io.WriteCloser, error) {
+	switch format {
+	case "", FormatGzip:
+		return gzip.NewWriter(w), nil
+	case FormatZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	}
+	return nil, fmt.Errorf("unsupported archive format %q", format)
+}
@@ -0,0 +1,69 @@
+package archive
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Format
+		wantErr bool
+	}{
+		{in: "", want: FormatGzip},
+		{in: "gzip", want: FormatGzip},
+		{in: "tar.gz", want: FormatGzip},
+		{in: "zstd", want: FormatZstd},
+		{in: "tar.zst", want: FormatZstd},
+		{in: "ZSTD", want: FormatZstd},
+		{in: "bzip2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseFormat(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFormat(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFormat(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPack_Zstd(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	writeTree(t, srcDir, map[string]string{
+		"Bifrost.toml": "[package]",
+		"src/main.crl": "grim Main:",
+	})
+
+	archivePath := filepath.Join(tempDir, "package.tar.zst")
+	if err := Pack(srcDir, archivePath, WithFormat(FormatZstd)); err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, zstdMagic) {
+		t.Errorf("archive starts with %x, want the zstd magic number", data[:4])
+	}
+
+	got := archiveEntries(t, archivePath)
+	if got["src/main.crl"] != "grim Main:" || got["Bifrost.toml"] != "[package]" {
+		t.Errorf("archive entries = %v", got)
+	}
+}
+
+func TestNewReader_Unknown(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("PK\x03\x04 a zip file"))); err == nil {
+		t.Error("NewReader() accepted an archive that is neither gzip nor zstd")
+	}
+}
@@ -0,0 +1,179 @@
+package archive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// IgnoreFileName is the gitignore-style file listing paths to leave out of
+// published archives
+const IgnoreFileName = ".bifrostignore"
+
+// DefaultExcludes are left out of every published archive
+var DefaultExcludes = []string{
+	".git/",
+	"*.tar.gz",
+	"*.tar.zst",
+	"bifrost",
+	"carrion_modules/",
+}
+
+// Ignore matches slash-separated paths against gitignore-style patterns
+type Ignore struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// NewIgnore compiles patterns using gitignore syntax: "#" starts a comment,
+// "!" re-includes a path, a trailing "/" matches only directories, a pattern
+// containing "/" is relative to the package root, and "**" matches any
+// number of directories
+func NewIgnore(patterns ...string) (*Ignore, error) {
+	ig := &Ignore{}
+	if err := ig.Add(patterns...); err != nil {
+		return nil, err
+	}
+	return ig, nil
+}
+
+// LoadIgnore reads patterns from an ignore file. A missing file yields an
+// empty matcher.
+func LoadIgnore(filePath string) (*Ignore, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Ignore{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	ig, err := ParseIgnore(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return ig, nil
+}
+
+// ParseIgnore reads patterns, one per line, from r
+func ParseIgnore(r io.Reader) (*Ignore, error) {
+	ig := &Ignore{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if err := ig.Add(scanner.Text()); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ig, nil
+}
+
+// Add appends patterns. Later patterns take precedence over earlier ones.
+func (ig *Ignore) Add(patterns ...string) error {
+	for _, pattern := range patterns {
+		rule, ok, err := parseIgnoreRule(pattern)
+		if err != nil {
+			return err
+		}
+		if ok {
+			ig.rules = append(ig.rules, rule)
+		}
+	}
+	return nil
+}
+
+// Match reports whether relPath, a slash-separated path relative to the
+// package root, is ignored
+func (ig *Ignore) Match(relPath string, isDir bool) bool {
+	if ig == nil {
+		return false
+	}
+
+	parts := strings.Split(strings.Trim(relPath, "/"), "/")
+	ignored := false
+	for _, rule := range ig.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if matchSegments(rule.segments, parts) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+func parseIgnoreRule(pattern string) (ignoreRule, bool, error) {
+	var rule ignoreRule
+
+	pattern = strings.TrimRight(pattern, " \t\r")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return rule, false, nil
+	}
+
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\`) {
+		// "\#" and "\!" match a literal leading character
+		pattern = pattern[1:]
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return rule, false, nil
+	}
+
+	// Patterns without a slash match at any depth
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if !anchored {
+		pattern = "**/" + pattern
+	}
+
+	rule.segments = strings.Split(pattern, "/")
+	for _, seg := range rule.segments {
+		if _, err := path.Match(seg, ""); err != nil {
+			return rule, false, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return rule, true, nil
+}
+
+// matchSegments matches path segments against pattern segments, where "**"
+// stands for zero or more segments
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for skip := 0; skip <= len(parts); skip++ {
+				if matchSegments(pattern[1:], parts[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
@@ -0,0 +1,75 @@
+package archive
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIgnore_Match(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{name: "basename at root", patterns: []string{"*.log"}, path: "debug.log", want: true},
+		{name: "basename at depth", patterns: []string{"*.log"}, path: "a/b/debug.log", want: true},
+		{name: "no match", patterns: []string{"*.log"}, path: "main.crl", want: false},
+		{name: "anchored pattern", patterns: []string{"/build"}, path: "build", isDir: true, want: true},
+		{name: "anchored pattern not nested", patterns: []string{"/build"}, path: "src/build", isDir: true, want: false},
+		{name: "pattern with slash is anchored", patterns: []string{"docs/*.md"}, path: "docs/a.md", want: true},
+		{name: "pattern with slash not nested", patterns: []string{"docs/*.md"}, path: "x/docs/a.md", want: false},
+		{name: "dir only matches dir", patterns: []string{"data/"}, path: "data", isDir: true, want: true},
+		{name: "dir only skips file", patterns: []string{"data/"}, path: "data", isDir: false, want: false},
+		{name: "double star prefix", patterns: []string{"**/fixtures"}, path: "a/b/fixtures", isDir: true, want: true},
+		{name: "double star middle", patterns: []string{"src/**/gen.crl"}, path: "src/gen.crl", want: true},
+		{name: "double star middle nested", patterns: []string{"src/**/gen.crl"}, path: "src/a/b/gen.crl", want: true},
+		{name: "double star suffix", patterns: []string{"tmp/**"}, path: "tmp/a/b", want: true},
+		{name: "negation", patterns: []string{"*.log", "!keep.log"}, path: "keep.log", want: false},
+		{name: "last match wins", patterns: []string{"!keep.log", "*.log"}, path: "keep.log", want: true},
+		{name: "comment", patterns: []string{"# *.log"}, path: "a.log", want: false},
+		{name: "escaped hash", patterns: []string{`\#notes`}, path: "#notes", want: true},
+		{name: "question mark", patterns: []string{"file?.txt"}, path: "file1.txt", want: true},
+		{name: "character class", patterns: []string{"v[0-9].crl"}, path: "v7.crl", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ig, err := NewIgnore(tt.patterns...)
+			if err != nil {
+				t.Fatalf("NewIgnore() error = %v", err)
+			}
+			if got := ig.Match(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("Match(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIgnore(t *testing.T) {
+	ig, err := ParseIgnore(strings.NewReader("# comment\n\n*.tmp   \n!important.tmp\n"))
+	if err != nil {
+		t.Fatalf("ParseIgnore() error = %v", err)
+	}
+	if !ig.Match("a.tmp", false) {
+		t.Error("expected a.tmp to be ignored")
+	}
+	if ig.Match("important.tmp", false) {
+		t.Error("expected important.tmp to be re-included")
+	}
+
+	if _, err := ParseIgnore(strings.NewReader("ok\n[bad\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("ParseIgnore() error = %v, want error on line 2", err)
+	}
+}
+
+func TestLoadIgnore_Missing(t *testing.T) {
+	ig, err := LoadIgnore("/does/not/exist/.bifrostignore")
+	if err != nil {
+		t.Fatalf("LoadIgnore() error = %v", err)
+	}
+	if ig.Match("anything", false) {
+		t.Error("empty matcher should not ignore anything")
+	}
+}
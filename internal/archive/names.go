@@ -0,0 +1,92 @@
+package archive
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// windowsReserved are characters Windows does not allow in file names
+const windowsReserved = `<>:"\|?*`
+
+// Names validates the entry names of one archive. Names are normalized to
+// Unicode NFC, so a file created on macOS (which stores NFD) and one created
+// on Linux get the same name, and two entries that would land on the same
+// file of a case-insensitive filesystem are rejected.
+type Names struct {
+	fold   cases.Caser
+	folded map[string]string
+}
+
+// NewNames returns an empty set of names
+func NewNames() *Names {
+	return &Names{
+		fold:   cases.Fold(),
+		folded: make(map[string]string),
+	}
+}
+
+// Add validates name, a slash-separated path relative to the archive root,
+// and returns it normalized. A trailing slash is dropped.
+func (n *Names) Add(name string) (string, error) {
+	clean, err := CleanName(name)
+	if err != nil {
+		return "", err
+	}
+
+	// Check the parent directories as well, so "SRC/a" collides with "src"
+	for p := clean; p != "."; p = path.Dir(p) {
+		key := n.fold.String(p)
+		if other, ok := n.folded[key]; ok && other != p {
+			return "", fmt.Errorf("%q and %q differ only in case and would collide on macOS and Windows", other, p)
+		}
+		n.folded[key] = p
+	}
+	return clean, nil
+}
+
+// CleanName normalizes an archive entry name to NFC, drops a leading "./"
+// and rejects names that are absolute, escape the archive root, or contain
+// characters some filesystems cannot store
+func CleanName(name string) (string, error) {
+	if !norm.NFC.IsNormalString(name) {
+		name = norm.NFC.String(name)
+	}
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "./"), "/")
+
+	if name == "" || strings.HasPrefix(name, "/") {
+		return "", fmt.Errorf("invalid path %q: must be relative", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if err := checkComponent(part); err != nil {
+			return "", fmt.Errorf("invalid path %q: %w", name, err)
+		}
+	}
+	return name, nil
+}
+
+// checkComponent rejects a single path element CleanName cannot accept
+func checkComponent(part string) error {
+	switch part {
+	case "", ".":
+		return fmt.Errorf("empty path element")
+	case "..":
+		return fmt.Errorf("refers to a parent directory")
+	}
+	for _, r := range part {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("contains control character %U", r)
+		}
+		if strings.ContainsRune(windowsReserved, r) {
+			return fmt.Errorf("contains %q, which Windows does not allow", r)
+		}
+	}
+	if last := part[len(part)-1]; last == '.' || last == ' ' {
+		return fmt.Errorf("%q ends with %q, which Windows drops", part, last)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCleanName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "src/main.crl", want: "src/main.crl"},
+		{name: "src/", want: "src"},
+		{name: "./src/main.crl", want: "src/main.crl"},
+		{name: "docs/cafe\u0301.md", want: "docs/caf\u00e9.md"},
+		{name: "/etc/passwd", wantErr: true},
+		{name: "../outside", wantErr: true},
+		{name: "src/../../outside", wantErr: true},
+		{name: "src//main.crl", wantErr: true},
+		{name: "src/ma\x07in.crl", wantErr: true},
+		{name: "src/what?.crl", wantErr: true},
+		{name: `src\main.crl`, wantErr: true},
+		{name: "src/trailing.", wantErr: true},
+		{name: "src/trailing ", wantErr: true},
+		{name: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CleanName(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CleanName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CleanName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNames_Add(t *testing.T) {
+	names := NewNames()
+	for _, name := range []string{"src/", "src/main.crl", "README.md"} {
+		if _, err := names.Add(name); err != nil {
+			t.Fatalf("Add(%q) error = %v", name, err)
+		}
+	}
+
+	// The same directory can appear again, e.g. with and without a slash
+	if _, err := names.Add("src"); err != nil {
+		t.Errorf("Add(\"src\") error = %v", err)
+	}
+
+	for _, name := range []string{"readme.md", "SRC/util.crl", "Src"} {
+		if _, err := names.Add(name); err == nil || !strings.Contains(err.Error(), "differ only in case") {
+			t.Errorf("Add(%q) error = %v, want a case collision", name, err)
+		}
+	}
+
+	// NFD and NFC spellings of the same name collide too
+	if _, err := names.Add("caf\u00e9.md"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := names.Add("cafe\u0301.md"); err != nil || got != "caf\u00e9.md" {
+		t.Errorf("Add(NFD) = %q, %v, want the NFC name", got, err)
+	}
+}
+
+func TestPack_NormalizesNames(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "pkg")
+	writeTree(t, srcDir, map[string]string{"docs/cafe\u0301.md": "menu"})
+
+	archivePath := filepath.Join(tempDir, "package.tar.gz")
+	if err := Pack(srcDir, archivePath); err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	if got := archiveEntries(t, archivePath); got["docs/caf\u00e9.md"] != "menu" {
+		t.Errorf("archive entries = %q, want the NFC name", got)
+	}
+}
+
+func TestPack_CaseCollision(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "pkg")
+	writeTree(t, srcDir, map[string]string{"README.md": "a"})
+	if err := os.WriteFile(filepath.Join(srcDir, "readme.md"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(srcDir, "README.md")); err == nil && runtime.GOOS != "linux" {
+		t.Skip("filesystem is case-insensitive")
+	}
+
+	err := Pack(srcDir, filepath.Join(t.TempDir(), "package.tar.gz"))
+	if err == nil || !strings.Contains(err.Error(), "differ only in case") {
+		t.Errorf("Pack() error = %v, want a case collision", err)
+	}
+}
@@ -0,0 +1,66 @@
+package archive
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize parses a byte count such as "512", "800KB", "10MB" or "1.5GB".
+// Units are binary and case-insensitive, and the B may be left out, as in
+// "1M".
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		suffix := unit.suffix
+		if !strings.HasSuffix(value, suffix) && len(suffix) > 1 {
+			suffix = suffix[:1]
+		}
+		if strings.HasSuffix(value, suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, suffix))
+			multiplier = unit.bytes
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q: expected a number with an optional B, KB, MB or GB suffix", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// FormatSize renders a byte count with the largest unit that keeps it at
+// or above one
+func FormatSize(n int64) string {
+	for _, unit := range sizeUnits[:len(sizeUnits)-1] {
+		if n >= unit.bytes {
+			return fmt.Sprintf("%.1f %s", float64(n)/float64(unit.bytes), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// Largest returns up to n files ordered from largest to smallest
+func Largest(files []File, n int) []File {
+	sorted := append([]File(nil), files...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Size > sorted[j].Size
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
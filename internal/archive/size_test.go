@@ -0,0 +1,74 @@
+package archive
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "512", want: 512},
+		{in: "512B", want: 512},
+		{in: "800KB", want: 800 << 10},
+		{in: "10MB", want: 10 << 20},
+		{in: "10mb", want: 10 << 20},
+		{in: "1.5 GB", want: 3 << 29},
+		{in: "1M", want: 1 << 20},
+		{in: "256k", want: 256 << 10},
+		{in: "0", want: 0},
+		{in: "", wantErr: true},
+		{in: "ten MB", wantErr: true},
+		{in: "-1MB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseSize(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		0:        "0 B",
+		1023:     "1023 B",
+		1536:     "1.5 KB",
+		10 << 20: "10.0 MB",
+		3 << 29:  "1.5 GB",
+	}
+	for n, want := range tests {
+		if got := FormatSize(n); got != want {
+			t.Errorf("FormatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestLargest(t *testing.T) {
+	files := []File{
+		{Path: "a", Size: 10},
+		{Path: "b", Size: 300},
+		{Path: "c", Size: 20},
+		{Path: "d", Size: 300},
+	}
+
+	got := Largest(files, 3)
+	want := []string{"b", "d", "c"}
+	if len(got) != len(want) {
+		t.Fatalf("Largest() returned %d files, want %d", len(got), len(want))
+	}
+	for i, path := range want {
+		if got[i].Path != path {
+			t.Errorf("Largest()[%d] = %s, want %s", i, got[i].Path, path)
+		}
+	}
+	if files[0].Path != "a" {
+		t.Error("Largest() reordered its input")
+	}
+}
@@ -9,9 +9,9 @@ import (
 	"os"
 	"strings"
 	"syscall"
-	"time"
 
 	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/registry"
 	"golang.org/x/term"
 )
 
@@ -167,7 +167,7 @@ func (s *Service) testBasicAuth(username, password string) error {
 	// Add basic auth header
 	req.SetBasicAuth(username, password)
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := registry.HTTPClient(registry.OperationQuery)
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to connect to registry: %w", err)
@@ -291,7 +291,7 @@ func (s *Service) ValidateAuth() error {
 
 		req.Header.Set("Authorization", "Bearer "+auth.APIKey)
 
-		client := &http.Client{}
+		client := registry.HTTPClient(registry.OperationQuery)
 		resp, err := client.Do(req)
 		if err != nil {
 			return fmt.Errorf("failed to validate authentication: %w", err)
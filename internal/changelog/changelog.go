@@ -0,0 +1,100 @@
+// Package changelog extracts per-version entries from Markdown changelogs
+// such as those following the Keep a Changelog convention
+package changelog
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	ver "github.com/javanhut/bifrost/internal/version"
+)
+
+// ErrNoChangelog is returned when a package does not declare a changelog
+var ErrNoChangelog = errors.New("package does not declare a changelog")
+
+var (
+	headingRegex = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	versionRegex = regexp.MustCompile(`\bv?(\d+\.\d+\.\d+)\b`)
+)
+
+// Entry is the section of a changelog describing one version
+type Entry struct {
+	Version string `json:"version"`
+	// Heading is the heading text, such as "[1.2.0] - 2024-05-01"
+	Heading string `json:"heading"`
+	Body    string `json:"body"`
+}
+
+// Parse splits a Markdown changelog into entries. Every heading naming a
+// version starts an entry, which runs until the next heading of the same or
+// a higher level; text outside entries, such as an "Unreleased" section, is
+// dropped.
+func Parse(text string) []Entry {
+	var entries []Entry
+	var current *Entry
+	var level int
+	var body []string
+
+	flush := func() {
+		if current != nil {
+			current.Body = strings.TrimSpace(strings.Join(body, "\n"))
+			entries = append(entries, *current)
+		}
+		current, body = nil, nil
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if m := headingRegex.FindStringSubmatch(line); m != nil {
+			if v := versionRegex.FindStringSubmatch(m[2]); v != nil {
+				flush()
+				current = &Entry{Version: v[1], Heading: m[2]}
+				level = len(m[1])
+				continue
+			}
+			if current != nil && len(m[1]) <= level {
+				flush()
+				continue
+			}
+		}
+		if current != nil {
+			body = append(body, line)
+		}
+	}
+	flush()
+	return entries
+}
+
+// Between returns the entries for versions newer than from up to and
+// including to, in changelog order. With an empty from only the entry for to
+// is returned. Entries whose version does not parse are skipped.
+func Between(entries []Entry, from, to string) ([]Entry, error) {
+	upper, err := ver.Parse(to)
+	if err != nil {
+		return nil, err
+	}
+	var lower *ver.Version
+	if from != "" {
+		if lower, err = ver.Parse(from); err != nil {
+			return nil, err
+		}
+	}
+
+	var selected []Entry
+	for _, e := range entries {
+		v, err := ver.Parse(e.Version)
+		if err != nil {
+			continue
+		}
+		if lower == nil {
+			if v.Compare(upper) == 0 {
+				selected = append(selected, e)
+			}
+			continue
+		}
+		if v.Compare(lower) > 0 && v.Compare(upper) <= 0 {
+			selected = append(selected, e)
+		}
+	}
+	return selected, nil
+}
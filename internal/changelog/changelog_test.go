@@ -0,0 +1,82 @@
+package changelog
+
+import (
+	"reflect"
+	"testing"
+)
+
+const sample = `# Changelog
+
+All notable changes to this project are documented here.
+
+## [Unreleased]
+- Work in progress
+
+## [1.3.0] - 2024-06-01
+### Added
+- Streaming parser
+
+## [1.2.1] - 2024-05-10
+### Fixed
+- Crash on empty input
+
+## v1.2.0
+- First stable parser
+
+## 1.0.0
+Initial release
+`
+
+func TestParse(t *testing.T) {
+	entries := Parse(sample)
+
+	var versions []string
+	for _, e := range entries {
+		versions = append(versions, e.Version)
+	}
+	if want := []string{"1.3.0", "1.2.1", "1.2.0", "1.0.0"}; !reflect.DeepEqual(versions, want) {
+		t.Fatalf("Parse() versions = %v, want %v", versions, want)
+	}
+	if entries[0].Heading != "[1.3.0] - 2024-06-01" {
+		t.Errorf("Heading = %q", entries[0].Heading)
+	}
+	if entries[0].Body != "### Added\n- Streaming parser" {
+		t.Errorf("Body = %q, want the subsection kept", entries[0].Body)
+	}
+	if entries[3].Body != "Initial release" {
+		t.Errorf("Body = %q", entries[3].Body)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	entries := Parse(sample)
+
+	tests := []struct {
+		name     string
+		from, to string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "range", from: "1.2.0", to: "1.3.0", want: []string{"1.3.0", "1.2.1"}},
+		{name: "single step", from: "1.2.1", to: "1.3.0", want: []string{"1.3.0"}},
+		{name: "no from", from: "", to: "1.2.1", want: []string{"1.2.1"}},
+		{name: "up to date", from: "1.3.0", to: "1.3.0", want: nil},
+		{name: "invalid", from: "1.0", to: "1.3.0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Between(entries, tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Between() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var versions []string
+			for _, e := range got {
+				versions = append(versions, e.Version)
+			}
+			if !reflect.DeepEqual(versions, tt.want) {
+				t.Errorf("Between() = %v, want %v", versions, tt.want)
+			}
+		})
+	}
+}
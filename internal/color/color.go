@@ -0,0 +1,147 @@
+// Package color adds ANSI colors to bifrost's output. Whether colors are
+// used follows the --color flag: "auto" colors only terminals and honors
+// NO_COLOR (https://no-color.org) and TERM=dumb, "always" and "never" do
+// what they say.
+package color
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// Mode is when to use colors
+type Mode string
+
+const (
+	// Auto colors terminals unless NO_COLOR is set
+	Auto Mode = "auto"
+	// Always colors everything, even pipes and files
+	Always Mode = "always"
+	// Never colors nothing
+	Never Mode = "never"
+)
+
+// ParseMode parses a --color value
+func ParseMode(s string) (Mode, error) {
+	switch mode := Mode(s); mode {
+	case Auto, Always, Never:
+		return mode, nil
+	case "":
+		return Auto, nil
+	}
+	return "", fmt.Errorf("invalid color mode %q, expected auto, always or never", s)
+}
+
+// mode is the mode set for this run
+var mode = Auto
+
+// SetMode sets when colors are used
+func SetMode(m Mode) {
+	mode = m
+}
+
+const (
+	reset  = "\033[0m"
+	bold   = "\033[1m"
+	red    = "\033[31m"
+	green  = "\033[32m"
+	yellow = "\033[33m"
+	cyan   = "\033[36m"
+)
+
+// Printer colors text written to one destination. The zero Printer leaves
+// text alone.
+type Printer struct {
+	enabled bool
+}
+
+// For returns the Printer for text written to w. In auto mode only
+// terminals get colors.
+func For(w io.Writer) Printer {
+	switch mode {
+	case Always:
+		return Printer{enabled: true}
+	case Never:
+		return Printer{}
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return Printer{}
+	}
+	f, ok := w.(*os.File)
+	return Printer{enabled: ok && term.IsTerminal(int(f.Fd()))}
+}
+
+// Enabled reports whether the Printer adds colors
+func (p Printer) Enabled() bool {
+	return p.enabled
+}
+
+func (p Printer) paint(code, s string) string {
+	if !p.enabled || s == "" {
+		return s
+	}
+	return code + s + reset
+}
+
+// Package colors a package name
+func (p Printer) Package(name string) string {
+	return p.paint(bold+cyan, name)
+}
+
+// Version colors a version
+func (p Printer) Version(version string) string {
+	return p.paint(green, version)
+}
+
+// Ref colors a name@version reference
+func (p Printer) Ref(name, version string) string {
+	return p.Package(name) + "@" + p.Version(version)
+}
+
+// Warning colors a warning
+func (p Printer) Warning(s string) string {
+	return p.paint(bold+yellow, s)
+}
+
+// Error colors an error
+func (p Printer) Error(s string) string {
+	return p.paint(bold+red, s)
+}
+
+// Labels returns a writer coloring the "Error...:" and "Warning:" labels
+// that start the messages written through it, so commands can keep
+// printing plain messages to stderr
+func Labels(w io.Writer) io.Writer {
+	return &labelWriter{w: w}
+}
+
+type labelWriter struct {
+	w io.Writer
+}
+
+func (l *labelWriter) Write(b []byte) (int, error) {
+	p := For(l.w)
+	if !p.enabled {
+		return l.w.Write(b)
+	}
+
+	paint := p.Error
+	if bytes.HasPrefix(b, []byte("Warning")) {
+		paint = p.Warning
+	} else if !bytes.HasPrefix(b, []byte("Error")) {
+		return l.w.Write(b)
+	}
+	end := bytes.IndexByte(b, ':')
+	if end < 0 || bytes.IndexByte(b[:end], '\n') >= 0 {
+		return l.w.Write(b)
+	}
+	if _, err := io.WriteString(l.w, paint(string(b[:end+1]))); err != nil {
+		return 0, err
+	}
+	n, err := l.w.Write(b[end+1:])
+	return n + end + 1, err
+}
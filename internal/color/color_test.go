@@ -0,0 +1,84 @@
+package color
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Mode
+		wantErr bool
+	}{
+		{in: "auto", want: Auto},
+		{in: "always", want: Always},
+		{in: "never", want: Never},
+		{in: "", want: Auto},
+		{in: "yes", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMode(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseMode(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestFor(t *testing.T) {
+	defer SetMode(Auto)
+	var buf bytes.Buffer
+
+	tests := []struct {
+		name    string
+		mode    Mode
+		noColor string
+		want    bool
+	}{
+		{name: "auto colors only terminals", mode: Auto, want: false},
+		{name: "always", mode: Always, want: true},
+		{name: "always ignores NO_COLOR", mode: Always, noColor: "1", want: true},
+		{name: "never", mode: Never, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColor)
+			SetMode(tt.mode)
+			if got := For(&buf).Enabled(); got != tt.want {
+				t.Errorf("For().Enabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := (Printer{}).Ref("json-utils", "1.0.0"); got != "json-utils@1.0.0" {
+		t.Errorf("Ref() without colors = %q", got)
+	}
+	if got := (Printer{enabled: true}).Version("1.0.0"); got != green+"1.0.0"+reset {
+		t.Errorf("Version() with colors = %q", got)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	defer SetMode(Auto)
+	SetMode(Always)
+	var buf bytes.Buffer
+	w := Labels(&buf)
+
+	fmt.Fprintf(w, "Error installing package: %s\n", "boom")
+	fmt.Fprintf(w, "Warning: %s\n", "careful")
+	fmt.Fprintf(w, "Resolving: %s\n", "json-utils")
+	want := bold + red + "Error installing package:" + reset + " boom\n" +
+		bold + yellow + "Warning:" + reset + " careful\n" +
+		"Resolving: json-utils\n"
+	if got := buf.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	SetMode(Never)
+	buf.Reset()
+	fmt.Fprintf(w, "Error: %s\n", "boom")
+	if got := buf.String(); got != "Error: boom\n" {
+		t.Errorf("output without colors = %q", got)
+	}
+}
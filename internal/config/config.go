@@ -2,9 +2,15 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 type Config struct {
@@ -16,6 +22,23 @@ type Config struct {
 	RegistryURL string
 	AuthFile    string
 	ConfigFile  string
+	// GlobalPackagesDir overrides the shared global packages directory when
+	// set
+	GlobalPackagesDir string
+	// Layout is how packages are arranged in ModulesDir. Empty means
+	// LayoutVersioned.
+	Layout Layout
+	// ReadOnlyStore refuses changes to the user and global package
+	// directories, leaving installs to project modules directories
+	ReadOnlyStore bool
+	// Profile is the manifest profile selected with --profile, whose
+	// dependencies apply to the project and which is locked in its own
+	// lockfile. Empty selects none.
+	Profile string
+
+	// registryOverride is set from the --registry flag and takes precedence
+	// over the environment and the config file
+	registryOverride string
 }
 
 type AuthConfig struct {
@@ -29,6 +52,133 @@ type AuthConfig struct {
 type UserConfig struct {
 	Registry   RegistryConfig `json:"registry"`
 	User       UserInfo       `json:"user,omitempty"`
+	Install    InstallConfig  `json:"install,omitempty"`
+	// Timeouts bound registry requests by kind of operation
+	Timeouts TimeoutConfig `json:"timeouts,omitempty"`
+	// Registries are additional registries by name, searched alongside
+	// the default one
+	Registries map[string]RegistryConfig `json:"registries,omitempty"`
+	// Scopes route scoped packages such as "@acme/utils" to a registry,
+	// keyed by scope ("@acme") and given as a registry name or a URL
+	Scopes map[string]string `json:"scopes,omitempty"`
+	// TransparencyLog is the log package checksums must be recorded in
+	TransparencyLog TransparencyLogConfig `json:"tlog,omitempty"`
+	// Lock holds the keys frozen installs trust lockfile signatures from
+	Lock LockConfig `json:"lock,omitempty"`
+}
+
+// LockConfig pins the keys of signed lockfiles outside the projects
+// committing them
+type LockConfig struct {
+	// Keys are base64 public keys a committed Bifrost.lock.pub must match
+	// for frozen installs to trust it
+	Keys []string `json:"keys,omitempty"`
+}
+
+// TransparencyLogConfig configures a Rekor-style transparency log
+type TransparencyLogConfig struct {
+	// URL is the log's base URL. Empty means archives are not looked up.
+	URL string `json:"url,omitempty"`
+	// Key is the path of the log's PEM public key, which entries must be
+	// signed with, empty to only check inclusion proofs
+	Key string `json:"key,omitempty"`
+}
+
+// DefaultRegistryName is the name of the registry configured under
+// "registry", which GetRegistries lists first
+const DefaultRegistryName = "default"
+
+// NamedRegistry is a configured registry with its name
+type NamedRegistry struct {
+	Name string
+	RegistryConfig
+}
+
+// InstallConfig holds settings for installing into projects
+type InstallConfig struct {
+	Layout string `json:"layout,omitempty"` // "versioned" or "flat"
+	// MaxConcurrentDownloads is how many archives are downloaded at once,
+	// zero for the default
+	MaxConcurrentDownloads int `json:"max_concurrent_downloads,omitempty"`
+	// LimitRate caps the combined download rate, e.g. "1M" for 1 MB per
+	// second. Empty means no limit.
+	LimitRate string `json:"limit_rate,omitempty"`
+	// Strict refuses to install packages with install scripts unless they
+	// are explicitly allowed
+	Strict bool `json:"strict,omitempty"`
+	// ScriptTimeout is how long an install script may run, e.g. "10m".
+	// Empty means the default and "0" no limit.
+	ScriptTimeout string `json:"script_timeout,omitempty"`
+	// DirMode and FileMode are the octal permissions given to extracted
+	// directories and files, e.g. "0755" and "0644", whatever the archive
+	// says. Empty means the defaults.
+	DirMode  string `json:"dir_mode,omitempty"`
+	FileMode string `json:"file_mode,omitempty"`
+	// ReadOnlyStore makes the user and global package directories
+	// read-only unless --allow-store-write is given, for build machines
+	// shared by many jobs
+	ReadOnlyStore bool `json:"read_only_store,omitempty"`
+	// Scanner is a command run on every downloaded archive before it is
+	// cached, with the archive's path as its last argument. An archive it
+	// fails for is quarantined. Empty means no scanning.
+	Scanner string `json:"scanner,omitempty"`
+}
+
+// TimeoutConfig holds how long registry requests may take, per kind of
+// operation, e.g. "30s". Empty means the default and "0" no limit.
+type TimeoutConfig struct {
+	// Query bounds health checks, searches and metadata lookups
+	Query string `json:"query,omitempty"`
+	// Download bounds how long downloads of archives, patches and
+	// changelogs may wait for data
+	Download string `json:"download,omitempty"`
+	// Publish bounds uploads of packages
+	Publish string `json:"publish,omitempty"`
+}
+
+// ParseMode parses an octal permission such as "0644". The owner must be
+// able to read the file, so installed packages stay usable.
+func ParseMode(s string) (os.FileMode, error) {
+	n, err := strconv.ParseUint(strings.TrimPrefix(s, "0o"), 8, 32)
+	if err != nil || n > 0777 {
+		return 0, fmt.Errorf("invalid mode %q: expected octal permissions such as 0644", s)
+	}
+	if n&0400 == 0 {
+		return 0, fmt.Errorf("invalid mode %q: the owner must be able to read", s)
+	}
+	return os.FileMode(n), nil
+}
+
+// Layout is how packages are arranged in the project modules directory
+type Layout string
+
+const (
+	// LayoutVersioned installs every version of a package in its own
+	// <name>/<version> directory. It is the default.
+	LayoutVersioned Layout = "versioned"
+	// LayoutFlat installs a single version of each package directly in
+	// <name>, replacing it when the lockfile pins another version
+	LayoutFlat Layout = "flat"
+)
+
+// VersionFile records which version a flat layout package directory holds
+const VersionFile = ".bifrost-version"
+
+// PackageFile records which registry package an aliased package directory
+// holds, since the directory is named after the alias
+const PackageFile = ".bifrost-package"
+
+// CurrentLink is the link in the shared directory of a standard library
+// package to its active version
+const CurrentLink = "current"
+
+// ParseLayout parses "versioned" or "flat"
+func ParseLayout(s string) (Layout, error) {
+	switch l := Layout(s); l {
+	case LayoutVersioned, LayoutFlat:
+		return l, nil
+	}
+	return "", fmt.Errorf("invalid layout %q: expected versioned or flat", s)
 }
 
 type RegistryConfig struct {
@@ -37,6 +187,12 @@ type RegistryConfig struct {
 	Password string `json:"password,omitempty"`
 	APIKey   string `json:"api_key,omitempty"`
 	AuthType string `json:"auth_type,omitempty"` // "basic", "token", or "none"
+	// Index is the URL of the registry's package index, whose checksums
+	// archives must match wherever they are downloaded from
+	Index string `json:"index,omitempty"`
+	// IndexKey is the base64 ed25519 public key the index checksums must
+	// be signed with, empty to accept them unsigned
+	IndexKey string `json:"index_key,omitempty"`
 }
 
 type UserInfo struct {
@@ -50,6 +206,12 @@ func New() (*Config, error) {
 		return nil, err
 	}
 
+	return NewWithHome(homeDir), nil
+}
+
+// NewWithHome returns a configuration rooted at homeDir instead of the
+// directory named by CARRION_HOME
+func NewWithHome(homeDir string) *Config {
 	registryURL := os.Getenv("CARRION_REGISTRY_URL")
 	if registryURL == "" {
 		registryURL = "https://registry.carrionlang.com"
@@ -64,7 +226,7 @@ func New() (*Config, error) {
 		RegistryURL: registryURL,
 		AuthFile:    filepath.Join(homeDir, "auth.json"),
 		ConfigFile:  filepath.Join(homeDir, "config.json"),
-	}, nil
+	}
 }
 
 func getCarrionHome() (string, error) {
@@ -100,42 +262,100 @@ func (c *Config) Init() error {
 	return nil
 }
 
+// ErrReadOnlyStore is returned for changes to the user or global package
+// directories while they are read-only
+var ErrReadOnlyStore = errors.New("the user and global package directories are read-only (install.read-only-store); install into the project, or pass --allow-store-write")
+
+// CheckStoreWrite returns ErrReadOnlyStore if the user and global package
+// directories may not be changed
+func (c *Config) CheckStoreWrite() error {
+	if c.ReadOnlyStore {
+		return ErrReadOnlyStore
+	}
+	return nil
+}
+
 func (c *Config) PackagePath(name, version string) string {
 	return filepath.Join(c.PackagesDir, name, version)
 }
 
-// LocalPackagePath returns the path for a local project package
+// LocalPackagePath returns the path for a local project package. With the
+// flat layout every version shares the same path.
 func (c *Config) LocalPackagePath(name, version string) string {
+	if c.Layout == LayoutFlat {
+		return filepath.Join(c.ModulesDir, name)
+	}
 	return filepath.Join(c.ModulesDir, name, version)
 }
 
+// LocalPackageInstalled reports whether name@version is installed in the
+// project modules directory
+func (c *Config) LocalPackageInstalled(name, version string) bool {
+	path := c.LocalPackagePath(name, version)
+	if c.Layout == LayoutFlat {
+		return FlatVersion(path) == version
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// FlatVersion returns the version installed in a flat layout package
+// directory, or "" if there is none
+func FlatVersion(packageDir string) string {
+	data, err := os.ReadFile(filepath.Join(packageDir, VersionFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
 func (c *Config) CachePath(filename string) string {
 	return filepath.Join(c.CacheDir, filename)
 }
 
+// JournalPath returns the path of the install/uninstall transaction journal
+func (c *Config) JournalPath() string {
+	return filepath.Join(c.HomeDir, "journal.log")
+}
+
+// QuarantineDir returns the directory archives rejected by the scanner are
+// moved to
+func (c *Config) QuarantineDir() string {
+	return filepath.Join(c.HomeDir, "quarantine")
+}
+
+// TrustPath returns the file remembering which packages may run install
+// scripts
+func (c *Config) TrustPath() string {
+	return filepath.Join(c.HomeDir, "trust.json")
+}
+
 func (c *Config) LocalModulesPath() string {
 	return c.ModulesDir
 }
 
-// GetImportPaths returns the directories to search for imports
+// ProjectModulesDir returns the modules directory of the project rooted at
+// root. An absolute ModulesDir is used as is.
+func (c *Config) ProjectModulesDir(root string) string {
+	if filepath.IsAbs(c.ModulesDir) {
+		return c.ModulesDir
+	}
+	return filepath.Join(root, c.ModulesDir)
+}
+
+// GetImportPaths returns the directories to search for imports, in order.
+// A package installed in more than one of them is imported from the first,
+// so project packages shadow user packages, which shadow global ones.
 func (c *Config) GetImportPaths(workingDir string) []string {
 	paths := []string{
 		// Current working directory
 		workingDir,
 		// Local project modules
-		filepath.Join(workingDir, c.ModulesDir),
+		c.ProjectModulesDir(workingDir),
 		// Global packages (user-specific)
 		c.PackagesDir,
-	}
-
-	// Add platform-specific shared global paths
-	if runtime.GOOS == "windows" {
-		if programData := os.Getenv("ProgramData"); programData != "" {
-			paths = append(paths, filepath.Join(programData, "Carrion", "lib"))
-		}
-	} else {
-		// Unix-like systems - shared global location
-		paths = append(paths, "/usr/local/share/carrion/lib")
+		// Shared global packages, where --global installs
+		c.GetSharedGlobalPackagesDir(),
 	}
 
 	return paths
@@ -143,6 +363,9 @@ func (c *Config) GetImportPaths(workingDir string) []string {
 
 // GetSharedGlobalPackagesDir returns the shared global packages directory
 func (c *Config) GetSharedGlobalPackagesDir() string {
+	if c.GlobalPackagesDir != "" {
+		return c.GlobalPackagesDir
+	}
 	if runtime.GOOS == "windows" {
 		if programData := os.Getenv("ProgramData"); programData != "" {
 			return filepath.Join(programData, "Carrion", "lib")
@@ -241,5 +464,132 @@ func (c *Config) GetRegistryConfig() (*RegistryConfig, error) {
 		registryConfig.URL = envURL
 	}
 
+	// An explicit override beats both
+	if c.registryOverride != "" {
+		registryConfig.URL = c.registryOverride
+	}
+
 	return &registryConfig, nil
 }
+
+// GetRegistries returns the default registry followed by the additional
+// registries in the config file, ordered by name
+func (c *Config) GetRegistries() ([]NamedRegistry, error) {
+	defaultConfig, err := c.GetRegistryConfig()
+	if err != nil {
+		return nil, err
+	}
+	userConfig, err := c.LoadUserConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	registries := []NamedRegistry{{Name: DefaultRegistryName, RegistryConfig: *defaultConfig}}
+	names := make([]string, 0, len(userConfig.Registries))
+	for name := range userConfig.Registries {
+		if name != DefaultRegistryName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		registries = append(registries, NamedRegistry{Name: name, RegistryConfig: userConfig.Registries[name]})
+	}
+	return registries, nil
+}
+
+// GetNamedRegistryConfig returns the configuration of the registry called
+// name, where DefaultRegistryName is the default registry
+func (c *Config) GetNamedRegistryConfig(name string) (*RegistryConfig, error) {
+	registries, err := c.GetRegistries()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range registries {
+		if r.Name == name {
+			registryConfig := r.RegistryConfig
+			return &registryConfig, nil
+		}
+	}
+	return nil, fmt.Errorf("no registry named %q is configured", name)
+}
+
+// ScopeRegistryConfig returns the registry that packages named
+// "<scope>/<name>" are fetched from, and false when the scope is not routed
+// anywhere. A scope routed to a URL uses the credentials of the configured
+// registry with that URL, if there is one.
+func (c *Config) ScopeRegistryConfig(scope string) (*RegistryConfig, bool, error) {
+	userConfig, err := c.LoadUserConfig()
+	if err != nil {
+		return nil, false, err
+	}
+	target, ok := userConfig.Scopes[scope]
+	if !ok || scope == "" {
+		return nil, false, nil
+	}
+	if !strings.Contains(target, "://") {
+		registryConfig, err := c.GetNamedRegistryConfig(target)
+		if err != nil {
+			return nil, false, fmt.Errorf("scope %s: %w", scope, err)
+		}
+		return registryConfig, true, nil
+	}
+
+	registries, err := c.GetRegistries()
+	if err != nil {
+		return nil, false, err
+	}
+	target = strings.TrimRight(target, "/")
+	for _, r := range registries {
+		if strings.TrimRight(r.URL, "/") == target {
+			registryConfig := r.RegistryConfig
+			return &registryConfig, true, nil
+		}
+	}
+	return &RegistryConfig{URL: target}, true, nil
+}
+
+// IndexFor returns the configuration of the registry at baseURL when it has
+// a package index, or nil
+func (c *Config) IndexFor(baseURL string) (*RegistryConfig, error) {
+	registries, err := c.GetRegistries()
+	if err != nil {
+		return nil, err
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+	for _, r := range registries {
+		url := r.URL
+		if url == "" && r.Name == DefaultRegistryName {
+			url = c.RegistryURL
+		}
+		if r.Index != "" && strings.TrimRight(url, "/") == baseURL {
+			registryConfig := r.RegistryConfig
+			return &registryConfig, nil
+		}
+	}
+	return nil, nil
+}
+
+// OverrideRegistryURL makes rawURL the registry for the rest of the process,
+// ahead of CARRION_REGISTRY_URL and the config file
+func (c *Config) OverrideRegistryURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid registry URL %q: expected http:// or https:// followed by a host", rawURL)
+	}
+
+	rawURL = strings.TrimRight(rawURL, "/")
+	c.RegistryURL = rawURL
+	c.registryOverride = rawURL
+	return nil
+}
+
+// EffectiveRegistryURL returns the registry URL after applying the config
+// file, environment and any override, falling back to RegistryURL if the
+// config file cannot be read
+func (c *Config) EffectiveRegistryURL() string {
+	if registryConfig, err := c.GetRegistryConfig(); err == nil && registryConfig.URL != "" {
+		return registryConfig.URL
+	}
+	return c.RegistryURL
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -95,6 +96,11 @@ func TestGetCarrionHome(t *testing.T) {
 			envHome: "/custom/path",
 			want:    "/custom/path",
 		},
+		{
+			name:    "with spaces and non-ASCII characters",
+			envHome: "/custom/Carrion Home/données",
+			want:    "/custom/Carrion Home/données",
+		},
 		{
 			name:    "without CARRION_HOME set",
 			envHome: "",
@@ -127,6 +133,21 @@ func TestGetCarrionHome(t *testing.T) {
 	}
 }
 
+func TestNewWithHome(t *testing.T) {
+	home := filepath.Join(t.TempDir(), "carrion home")
+	cfg := NewWithHome(home)
+
+	if cfg.HomeDir != home {
+		t.Errorf("HomeDir = %s, want %s", cfg.HomeDir, home)
+	}
+	if cfg.CacheDir != filepath.Join(home, "cache") {
+		t.Errorf("CacheDir = %s, want cache under home", cfg.CacheDir)
+	}
+	if cfg.ConfigFile != filepath.Join(home, "config.json") {
+		t.Errorf("ConfigFile = %s, want config.json under home", cfg.ConfigFile)
+	}
+}
+
 func TestConfig_Init(t *testing.T) {
 	// Create a temporary directory for testing
 	tempDir := t.TempDir()
@@ -199,6 +220,41 @@ func TestConfig_LocalPackagePath(t *testing.T) {
 	}
 }
 
+func TestConfig_FlatLayout(t *testing.T) {
+	cfg := &Config{
+		ModulesDir: t.TempDir(),
+		Layout:     LayoutFlat,
+	}
+
+	path := cfg.LocalPackagePath("mypackage", "1.2.3")
+	if want := filepath.Join(cfg.ModulesDir, "mypackage"); path != want {
+		t.Errorf("LocalPackagePath() = %v, want %v", path, want)
+	}
+	if cfg.LocalPackageInstalled("mypackage", "1.2.3") {
+		t.Error("LocalPackageInstalled() = true before install")
+	}
+
+	os.MkdirAll(path, 0755)
+	os.WriteFile(filepath.Join(path, VersionFile), []byte("1.2.3\n"), 0644)
+	if !cfg.LocalPackageInstalled("mypackage", "1.2.3") {
+		t.Error("LocalPackageInstalled(1.2.3) = false")
+	}
+	if cfg.LocalPackageInstalled("mypackage", "1.3.0") {
+		t.Error("LocalPackageInstalled(1.3.0) = true, but 1.2.3 is installed")
+	}
+}
+
+func TestParseLayout(t *testing.T) {
+	for _, s := range []string{"versioned", "flat"} {
+		if got, err := ParseLayout(s); err != nil || string(got) != s {
+			t.Errorf("ParseLayout(%q) = %q, %v", s, got, err)
+		}
+	}
+	if _, err := ParseLayout("nested"); err == nil {
+		t.Error("ParseLayout(\"nested\") succeeded")
+	}
+}
+
 func TestConfig_CachePath(t *testing.T) {
 	cfg := &Config{
 		CacheDir: "/home/user/.carrion/cache",
@@ -595,6 +651,7 @@ func TestConfig_GetRegistryConfig(t *testing.T) {
 		name          string
 		configContent string
 		envURL        string
+		override      string
 		defaultURL    string
 		want          *RegistryConfig
 	}{
@@ -627,6 +684,22 @@ func TestConfig_GetRegistryConfig(t *testing.T) {
 				AuthType: "token",
 			},
 		},
+		{
+			name: "override beats environment and config",
+			configContent: `{
+				"registry": {
+					"url": "https://config.registry.com",
+					"auth_type": "token"
+				}
+			}`,
+			envURL:     "https://env.registry.com",
+			override:   "https://staging.registry.com/",
+			defaultURL: "https://default.registry.com",
+			want: &RegistryConfig{
+				URL:      "https://staging.registry.com",
+				AuthType: "token",
+			},
+		},
 		{
 			name:       "default URL when no config",
 			defaultURL: "https://default.registry.com",
@@ -645,6 +718,11 @@ func TestConfig_GetRegistryConfig(t *testing.T) {
 				ConfigFile:  configFile,
 				RegistryURL: tt.defaultURL,
 			}
+			if tt.override != "" {
+				if err := cfg.OverrideRegistryURL(tt.override); err != nil {
+					t.Fatalf("OverrideRegistryURL() error = %v", err)
+				}
+			}
 
 			if tt.configContent != "" {
 				err := os.WriteFile(configFile, []byte(tt.configContent), 0600)
@@ -667,4 +745,188 @@ func TestConfig_GetRegistryConfig(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestConfig_OverrideRegistryURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "https://staging.registry.com"},
+		{url: "http://localhost:8080/"},
+		{url: "staging.registry.com", wantErr: true},
+		{url: "ftp://registry.com", wantErr: true},
+		{url: "https://", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			cfg := NewWithHome(t.TempDir())
+			before := cfg.RegistryURL
+
+			err := cfg.OverrideRegistryURL(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("OverrideRegistryURL(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if cfg.RegistryURL != before {
+					t.Errorf("RegistryURL changed to %q after a rejected override", cfg.RegistryURL)
+				}
+				return
+			}
+			if got := cfg.EffectiveRegistryURL(); got != strings.TrimRight(tt.url, "/") {
+				t.Errorf("EffectiveRegistryURL() = %q, want %q", got, tt.url)
+			}
+		})
+	}
+}
+
+func TestConfig_GetRegistries(t *testing.T) {
+	t.Setenv("CARRION_REGISTRY_URL", "")
+	cfg := NewWithHome(t.TempDir())
+	cfg.RegistryURL = "https://registry.carrionlang.com"
+	if err := os.MkdirAll(cfg.HomeDir, 0755); err != nil {
+		t.Fatalf("failed to create home: %v", err)
+	}
+	err := os.WriteFile(cfg.ConfigFile, []byte(`{
+		"registry": {"url": "https://registry.carrionlang.com"},
+		"registries": {
+			"mirror": {"url": "https://mirror.example.com"},
+			"acme": {"url": "https://registry.acme.internal", "auth_type": "token", "api_key": "secret"}
+		}
+	}`), 0600)
+	if err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	registries, err := cfg.GetRegistries()
+	if err != nil {
+		t.Fatalf("GetRegistries() error = %v", err)
+	}
+	var names []string
+	for _, r := range registries {
+		names = append(names, r.Name+"="+r.URL)
+	}
+	want := "default=https://registry.carrionlang.com acme=https://registry.acme.internal mirror=https://mirror.example.com"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("GetRegistries() = %s, want %s", got, want)
+	}
+
+	acme, err := cfg.GetNamedRegistryConfig("acme")
+	if err != nil || acme.APIKey != "secret" {
+		t.Errorf("GetNamedRegistryConfig(acme) = %+v, %v", acme, err)
+	}
+	if _, err := cfg.GetNamedRegistryConfig("missing"); err == nil {
+		t.Error("GetNamedRegistryConfig() of an unknown name succeeded")
+	}
+}
+
+func TestConfig_ScopeRegistryConfig(t *testing.T) {
+	t.Setenv("CARRION_REGISTRY_URL", "")
+	cfg := NewWithHome(t.TempDir())
+	if err := os.MkdirAll(cfg.HomeDir, 0755); err != nil {
+		t.Fatalf("failed to create home: %v", err)
+	}
+	err := os.WriteFile(cfg.ConfigFile, []byte(`{
+		"registry": {"url": "https://registry.carrionlang.com"},
+		"registries": {
+			"acme": {"url": "https://registry.acme.internal", "auth_type": "token", "api_key": "secret"}
+		},
+		"scopes": {
+			"@acme": "acme",
+			"@acme-mirror": "https://registry.acme.internal/",
+			"@other": "https://registry.other.internal",
+			"@broken": "missing"
+		}
+	}`), 0600)
+	if err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	tests := []struct {
+		scope      string
+		wantURL    string
+		wantAPIKey string
+		wantScoped bool
+	}{
+		{scope: "@acme", wantURL: "https://registry.acme.internal", wantAPIKey: "secret", wantScoped: true},
+		{scope: "@acme-mirror", wantURL: "https://registry.acme.internal", wantAPIKey: "secret", wantScoped: true},
+		{scope: "@other", wantURL: "https://registry.other.internal", wantScoped: true},
+		{scope: "@unknown"},
+		{scope: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			registryConfig, scoped, err := cfg.ScopeRegistryConfig(tt.scope)
+			if err != nil {
+				t.Fatalf("ScopeRegistryConfig() error = %v", err)
+			}
+			if scoped != tt.wantScoped {
+				t.Fatalf("ScopeRegistryConfig() scoped = %v, want %v", scoped, tt.wantScoped)
+			}
+			if scoped && (registryConfig.URL != tt.wantURL || registryConfig.APIKey != tt.wantAPIKey) {
+				t.Errorf("ScopeRegistryConfig() = %+v", registryConfig)
+			}
+		})
+	}
+
+	if _, _, err := cfg.ScopeRegistryConfig("@broken"); err == nil {
+		t.Error("ScopeRegistryConfig() of a scope routed to an unknown registry succeeded")
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    os.FileMode
+		wantErr bool
+	}{
+		{input: "0755", want: 0755},
+		{input: "644", want: 0644},
+		{input: "0o640", want: 0640},
+		{input: "0999", wantErr: true},
+		{input: "01777", wantErr: true},
+		{input: "0044", wantErr: true},
+		{input: "rw-r--r--", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMode(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseMode(%q) = %04o, %v, want %04o, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestConfig_Locations(t *testing.T) {
+	home := t.TempDir()
+	cfg := NewWithHome(home)
+	cfg.GlobalPackagesDir = filepath.Join(home, "global")
+	os.MkdirAll(cfg.CacheDir, 0755)
+
+	project := t.TempDir()
+	got := make(map[string]Location)
+	var names []string
+	for _, l := range cfg.Locations(project) {
+		got[l.Name] = l
+		names = append(names, l.Name)
+	}
+
+	want := []string{"home", "config", "auth", "cache", "registry", "packages", "global", "keys", "journal", "trust", "modules"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("Locations() names = %v, want %v", names, want)
+	}
+	if got["cache"].Path != cfg.CacheDir || !got["cache"].Exists {
+		t.Errorf("cache location = %+v, want existing %s", got["cache"], cfg.CacheDir)
+	}
+	if got["global"].Path != cfg.GlobalPackagesDir || got["global"].Exists {
+		t.Errorf("global location = %+v, want missing %s", got["global"], cfg.GlobalPackagesDir)
+	}
+	if want := filepath.Join(project, "carrion_modules"); got["modules"].Path != want {
+		t.Errorf("modules location = %s, want %s", got["modules"].Path, want)
+	}
+
+	for _, l := range cfg.Locations("") {
+		if l.Name == "modules" {
+			t.Errorf("Locations(\"\") lists the modules directory outside a project")
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Location is a directory or file Bifrost reads or writes
+type Location struct {
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	Description string `json:"description"`
+	Exists      bool   `json:"exists"`
+}
+
+// NewLocation returns the location named name at path, noting whether
+// anything is there yet
+func NewLocation(name, path, description string) Location {
+	_, err := os.Stat(path)
+	return Location{Name: name, Path: path, Description: description, Exists: err == nil}
+}
+
+// Locations lists the directories and files the configuration points at,
+// followed by the modules directory of the project rooted at projectRoot
+// when it is not empty
+func (c *Config) Locations(projectRoot string) []Location {
+	locations := []Location{
+		NewLocation("home", c.HomeDir, "Bifrost home (CARRION_HOME)"),
+		NewLocation("config", c.ConfigFile, "User configuration"),
+		NewLocation("auth", c.AuthFile, "Registry credentials"),
+		NewLocation("cache", c.CacheDir, "Downloaded archives"),
+		NewLocation("registry", c.RegistryDir, "Registry metadata and index cache"),
+		NewLocation("packages", c.PackagesDir, "User packages (--user)"),
+		NewLocation("global", c.GetSharedGlobalPackagesDir(), "Global packages (--global)"),
+		NewLocation("keys", filepath.Join(c.HomeDir, "keys"), "Lockfile signing keys"),
+		NewLocation("journal", c.JournalPath(), "Install and uninstall transaction journal"),
+		NewLocation("trust", c.TrustPath(), "Remembered install script decisions"),
+	}
+	if projectRoot != "" {
+		locations = append(locations, NewLocation("modules", c.ProjectModulesDir(projectRoot), "Project packages"))
+	}
+	return locations
+}
@@ -0,0 +1,74 @@
+// Package delta creates and applies binary patches between two versions of a
+// package archive. A patch is a zstd stream of the new archive compressed
+// with the old archive as a raw dictionary, the same technique as
+// zstd --patch-from, so unchanged runs of the archive cost a few bytes each.
+package delta
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format names the patch format in registry responses
+const Format = "zstd"
+
+// MaxArchiveSize is the largest archive a patch is applied to. The whole base
+// archive is held in memory while a patch is created or applied.
+const MaxArchiveSize = 512 << 20
+
+// dictID marks patch frames as needing the base archive, so a patch cannot
+// be mistaken for a plain zstd stream
+const dictID = 0x62667374
+
+// Create returns a patch that turns base into target
+func Create(base, target []byte) ([]byte, error) {
+	if len(base) > MaxArchiveSize {
+		return nil, fmt.Errorf("base archive is larger than %d bytes", MaxArchiveSize)
+	}
+	enc, err := zstd.NewWriter(nil,
+		zstd.WithEncoderDictRaw(dictID, base),
+		zstd.WithEncoderLevel(zstd.SpeedBestCompression),
+		zstd.WithWindowSize(windowSize(len(target))))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create patch encoder: %w", err)
+	}
+	defer enc.Close()
+	return enc.EncodeAll(target, nil), nil
+}
+
+// Apply reads a patch from r and writes the archive it produces from base
+// to w. Results larger than MaxArchiveSize are an error.
+func Apply(base []byte, r io.Reader, w io.Writer) error {
+	if len(base) > MaxArchiveSize {
+		return fmt.Errorf("base archive is larger than %d bytes", MaxArchiveSize)
+	}
+	dec, err := zstd.NewReader(r,
+		zstd.WithDecoderDictRaw(dictID, base),
+		zstd.WithDecoderMaxWindow(MaxArchiveSize),
+		zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return fmt.Errorf("failed to read patch: %w", err)
+	}
+	defer dec.Close()
+
+	n, err := io.Copy(w, io.LimitReader(dec, MaxArchiveSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to apply patch: %w", err)
+	}
+	if n > MaxArchiveSize {
+		return fmt.Errorf("patched archive is larger than %d bytes", MaxArchiveSize)
+	}
+	return nil
+}
+
+// windowSize returns a zstd window covering n bytes, within the limits the
+// encoder accepts
+func windowSize(n int) int {
+	size := zstd.MinWindowSize
+	for size < n && size < zstd.MaxWindowSize {
+		size <<= 1
+	}
+	return size
+}
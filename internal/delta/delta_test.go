@@ -0,0 +1,55 @@
+package delta
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestCreateApply(t *testing.T) {
+	base := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(base)
+	target := append([]byte(nil), base...)
+	copy(target[2<<20:], "changed")
+	target = append(target, "appended"...)
+
+	patch, err := Create(base, target)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if len(patch) > 64<<10 {
+		t.Errorf("patch is %d bytes for a small change, want it much smaller than the archive", len(patch))
+	}
+
+	var out bytes.Buffer
+	if err := Apply(base, bytes.NewReader(patch), &out); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), target) {
+		t.Error("Apply() did not reproduce the target archive")
+	}
+}
+
+func TestApply_WrongBase(t *testing.T) {
+	base := []byte("the quick brown fox jumps over the lazy dog, version one")
+	target := []byte("the quick brown fox jumps over the lazy dog, version two")
+	patch, err := Create(base, target)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// A different base decodes to different bytes, which callers catch by
+	// verifying the checksum; it must not be mistaken for the target
+	var out bytes.Buffer
+	other := []byte("a completely different archive of about the same length!")
+	if err := Apply(other, bytes.NewReader(patch), &out); err == nil && bytes.Equal(out.Bytes(), target) {
+		t.Error("Apply() with the wrong base reproduced the target")
+	}
+}
+
+func TestApply_Garbage(t *testing.T) {
+	var out bytes.Buffer
+	if err := Apply([]byte("base"), bytes.NewReader([]byte("not a patch")), &out); err == nil {
+		t.Error("Apply() accepted a patch that is not zstd")
+	}
+}
@@ -0,0 +1,301 @@
+// Package errcode attaches stable codes to common failures, so error output
+// can stay short and 'bifrost explain <code>' can give the details.
+package errcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Code identifies a kind of failure. Codes are never reused for something
+// else once released.
+type Code string
+
+const (
+	// ResolutionConflict is two dependents requiring incompatible versions
+	ResolutionConflict Code = "E001"
+	// NoMatchingVersion is a constraint no published version satisfies
+	NoMatchingVersion Code = "E002"
+	// PackageNotFound is a package the registry does not have
+	PackageNotFound Code = "E003"
+	// CircularDependency is a package that depends on itself
+	CircularDependency Code = "E004"
+	// IncompatibleCarrion is a package requiring another Carrion version
+	// than the installed interpreter
+	IncompatibleCarrion Code = "E005"
+	// ChecksumMismatch is an archive that differs from the expected one
+	ChecksumMismatch Code = "E010"
+	// MislabeledArchive is an archive whose manifest names another package
+	MislabeledArchive Code = "E011"
+	// UnsafeArchive is an archive with entries that cannot be extracted safely
+	UnsafeArchive Code = "E012"
+	// ArchiveQuarantined is an archive the configured scanner rejected
+	ArchiveQuarantined Code = "E013"
+	// UnloggedArchive is an archive whose checksum the configured
+	// transparency log does not record
+	UnloggedArchive Code = "E014"
+	// LockfileOutOfDate is a lockfile that no longer matches the manifest
+	LockfileOutOfDate Code = "E020"
+	// LockfileSignature is a lockfile whose signature is missing or wrong
+	LockfileSignature Code = "E021"
+	// PolicyViolation is an install or publish the organization policy forbids
+	PolicyViolation Code = "E030"
+	// ScriptsRefused is a package with install scripts refused in strict mode
+	ScriptsRefused Code = "E031"
+)
+
+// Error is an error with a code
+type Error struct {
+	Code Code
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errorf formats an error as fmt.Errorf does and gives it code c
+func (c Code) Errorf(format string, args ...interface{}) error {
+	return &Error{Code: c, Err: fmt.Errorf(format, args...)}
+}
+
+// Of returns the code of the first coded error in err's chain, or "" when
+// it has none
+func Of(err error) Code {
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	return ""
+}
+
+// Entry is the explanation of a code
+type Entry struct {
+	Code        Code     `json:"code"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Causes      []string `json:"causes"`
+	Remedies    []string `json:"remedies"`
+}
+
+// Lookup returns the explanation of code, which may be given in lower case
+func Lookup(code string) (Entry, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	for _, e := range entries {
+		if string(e.Code) == code {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Entries returns the explanations of every code, in code order
+func Entries() []Entry {
+	return append([]Entry(nil), entries...)
+}
+
+var entries = []Entry{
+	{
+		Code:        ResolutionConflict,
+		Title:       "Resolution conflict",
+		Description: "Two packages in the dependency tree require versions of the same dependency that no single version satisfies.",
+		Causes: []string{
+			"A dependency was upgraded and now needs a newer or older version of a shared dependency",
+			"Bifrost.toml pins a dependency more tightly than one of its dependents allows",
+		},
+		Remedies: []string{
+			"Read which packages require which versions in the error message",
+			"Loosen or raise the constraint in Bifrost.toml so both requirements overlap",
+			"Upgrade the dependent that requires the older version, if a newer release relaxes it",
+		},
+	},
+	{
+		Code:        NoMatchingVersion,
+		Title:       "No matching version",
+		Description: "No published version of a package satisfies the requested constraint.",
+		Causes: []string{
+			"The constraint has a typo or names a version that was never published",
+			"The matching versions were yanked or are blocked",
+			"The package is published to another registry",
+		},
+		Remedies: []string{
+			"Run 'bifrost info <package>' to list the published versions",
+			"Adjust the constraint in Bifrost.toml or on the command line",
+			"Use --from if the package lives in another configured registry",
+		},
+	},
+	{
+		Code:        PackageNotFound,
+		Title:       "Package not found",
+		Description: "The registry does not know the package.",
+		Causes: []string{
+			"The name is misspelled",
+			"The package is published to a different registry than the one configured",
+			"The package has not been published yet",
+		},
+		Remedies: []string{
+			"Run 'bifrost search <name>' to find the exact name",
+			"Check the registry with 'bifrost config get registry.url'",
+		},
+	},
+	{
+		Code:        CircularDependency,
+		Title:       "Circular dependency",
+		Description: "A package depends on itself, directly or through other packages, so there is no order to install them in.",
+		Causes: []string{
+			"Two packages were published depending on each other",
+		},
+		Remedies: []string{
+			"Report the cycle shown in the error to the package maintainers",
+			"Pin an earlier version of one of the packages that does not have the cycle",
+		},
+	},
+	{
+		Code:        IncompatibleCarrion,
+		Title:       "Incompatible Carrion version",
+		Description: "A package declares the Carrion versions it runs on in the carrion key of its Bifrost.toml, and the interpreter reported by 'carrion --version' is not one of them.",
+		Causes: []string{
+			"The package uses language features of a newer Carrion release",
+			"The package dropped support for an older Carrion release",
+			"Another carrion than the one the project runs with is first on PATH",
+		},
+		Remedies: []string{
+			"Upgrade Carrion, or put the right interpreter first on PATH",
+			"Constrain the dependency in Bifrost.toml to a version that supports your Carrion",
+			"Pass --carrion-version to check against the interpreter the project is deployed with",
+			"Pass --ignore-carrion-version to install it anyway",
+		},
+	},
+	{
+		Code:        ChecksumMismatch,
+		Title:       "Checksum mismatch",
+		Description: "A downloaded or cached archive does not have the checksum recorded in Bifrost.lock, a freeze file, the registry or its package index. It is discarded rather than installed.",
+		Causes: []string{
+			"A proxy or mirror served a different or truncated file",
+			"The package was republished with different contents under the same version",
+			"The archive was tampered with",
+			"The registry's metadata disagrees with the checksums in its package index",
+		},
+		Remedies: []string{
+			"Retry the install; a truncated download is fetched again",
+			"Run 'bifrost uninstall --clean' if a corrupted cached archive keeps being reused",
+			"If the package was republished on purpose, delete its entry from Bifrost.lock and run 'bifrost install', after checking with its maintainer",
+		},
+	},
+	{
+		Code:        MislabeledArchive,
+		Title:       "Mislabeled archive",
+		Description: "The Bifrost.toml inside a downloaded archive names a different package or version than the one requested, so it is not installed.",
+		Causes: []string{
+			"The package was uploaded under the wrong name or version",
+			"The registry served the wrong file",
+		},
+		Remedies: []string{
+			"Report the package to its maintainer or the registry operator",
+			"Install another version until a correct archive is published",
+		},
+	},
+	{
+		Code:        UnsafeArchive,
+		Title:       "Unsafe archive",
+		Description: "An archive contains entries that are absolute, escape the package directory, collide on case-insensitive filesystems or use characters some filesystems cannot store. Nothing is extracted.",
+		Causes: []string{
+			"The package was built with a tool that wrote unusual paths",
+			"The archive was crafted to write outside the package directory",
+		},
+		Remedies: []string{
+			"Report the package to its maintainer",
+			"Do not extract the archive by hand",
+		},
+	},
+	{
+		Code:        ArchiveQuarantined,
+		Title:       "Archive quarantined",
+		Description: "The scanner configured with install.scanner exited with an error for a downloaded archive. The archive was moved to the quarantine directory instead of the cache, and nothing was extracted.",
+		Causes: []string{
+			"The scanner found malware or something else the organization does not allow",
+			"The scanner command is misconfigured or could not run",
+		},
+		Remedies: []string{
+			"Read the scanner's output above the error",
+			"Inspect the quarantined archive with the scanner before deleting it",
+			"Check the command with 'bifrost config get install.scanner'",
+		},
+	},
+	{
+		Code:        UnloggedArchive,
+		Title:       "Archive not in the transparency log",
+		Description: "The transparency log configured with tlog.url has no verifiable entry for the checksum of a package archive, so the archive was not trusted and nothing was installed.",
+		Causes: []string{
+			"The version was published without being recorded in the log",
+			"The registry serves an archive other than the one published",
+			"tlog.url points at another log than the one the registry records to",
+		},
+		Remedies: []string{
+			"Run 'bifrost tlog verify <package>@<version>' to see what the log says",
+			"Ask the package maintainer or registry operator whether the version was logged",
+			"Check the log with 'bifrost config get tlog.url'",
+		},
+	},
+	{
+		Code:        LockfileOutOfDate,
+		Title:       "Lockfile out of date",
+		Description: "Bifrost.lock no longer matches Bifrost.toml: a dependency is not locked, or its locked version or package is not what the manifest asks for.",
+		Causes: []string{
+			"Bifrost.toml was edited without running 'bifrost install'",
+			"A merge kept the manifest of one branch and the lockfile of another",
+		},
+		Remedies: []string{
+			"Run 'bifrost install' to re-resolve and update Bifrost.lock, then commit it",
+		},
+	},
+	{
+		Code:        LockfileSignature,
+		Title:       "Lockfile signature invalid",
+		Description: "The project signs its lockfile, and Bifrost.lock.sig is missing or does not match Bifrost.lock, or the key to check it against is missing or not trusted.",
+		Causes: []string{
+			"Bifrost.lock was changed on a machine without the project's signing key",
+			"Bifrost.lock was edited by hand or by an untrusted change",
+			"Bifrost.lock.pub was removed or replaced",
+			"The project key is not pinned in lock.keys or BIFROST_LOCK_PUBLIC_KEY",
+		},
+		Remedies: []string{
+			"Review the changes to Bifrost.lock",
+			"Run 'bifrost lock sign' where the signing key is available and commit Bifrost.lock.sig",
+			"Pin the project key with 'bifrost config set lock.keys <key>' after checking it with the project",
+		},
+	},
+	{
+		Code:        PolicyViolation,
+		Title:       "Policy violation",
+		Description: "The organization policy forbids the registry, package version or action.",
+		Causes: []string{
+			"The registry is not in allowed_registries",
+			"The version is listed in a [[blocked]] entry, usually for a security advisory",
+			"The policy requires signed packages",
+		},
+		Remedies: []string{
+			"Run 'bifrost policy' to see the rules in effect and where they come from",
+			"Pick a version outside the blocked range",
+			"Ask the policy owners for an exception",
+		},
+	},
+	{
+		Code:        ScriptsRefused,
+		Title:       "Install scripts refused",
+		Description: "A package declares install scripts, which run arbitrary code, and strict mode or the policy does not allow them.",
+		Causes: []string{
+			"install.strict or --strict is set",
+			"The organization policy sets forbid_install_scripts",
+		},
+		Remedies: []string{
+			"Review the scripts printed above the error",
+			"Pass --allow-scripts to run them in strict mode",
+		},
+	},
+}
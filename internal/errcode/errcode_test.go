@@ -0,0 +1,57 @@
+package errcode
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Code
+	}{
+		{name: "coded", err: ChecksumMismatch.Errorf("checksum mismatch"), want: ChecksumMismatch},
+		{name: "wrapped", err: fmt.Errorf("failed to install: %w", ResolutionConflict.Errorf("conflict")), want: ResolutionConflict},
+		{name: "plain", err: errors.New("failed"), want: ""},
+		{name: "nil", err: nil, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Of(tt.err); got != tt.want {
+				t.Errorf("Of() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	inner := errors.New("inner")
+	if err := fmt.Errorf("outer: %w", &Error{Code: UnsafeArchive, Err: inner}); !errors.Is(err, inner) {
+		t.Errorf("coded error does not unwrap to its cause")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, code := range []string{"E010", "e010", " E010 "} {
+		e, ok := Lookup(code)
+		if !ok || e.Code != ChecksumMismatch {
+			t.Errorf("Lookup(%q) = %v, %v", code, e.Code, ok)
+		}
+	}
+	if _, ok := Lookup("E999"); ok {
+		t.Errorf("Lookup() of an unknown code succeeded")
+	}
+}
+
+func TestEntries(t *testing.T) {
+	var last Code
+	for _, e := range Entries() {
+		if e.Code <= last {
+			t.Errorf("%s listed after %s", e.Code, last)
+		}
+		last = e.Code
+		if e.Title == "" || e.Description == "" || len(e.Causes) == 0 || len(e.Remedies) == 0 {
+			t.Errorf("%s is missing part of its explanation", e.Code)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package freeze
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/version"
+)
+
+// Entry is a pinned package. Each is written on its own line as
+//
+//	name==version sha256=<hex>
+//
+// with "package=<name>" before the checksum for aliased dependencies and
+// "format=tar.zst" for packages published as zstd archives.
+type Entry struct {
+	Name    string
+	Version string
+	// Checksum is "sha256:<hex>", as recorded in the lockfile, or empty
+	Checksum string
+	// PackageName is the registry package installed under Name when Name is
+	// an alias
+	PackageName string
+	// Format is the archive format the checksum belongs to, empty for
+	// "tar.gz"
+	Format string
+	// Artifacts are the checksums of the package's prebuilt archives by
+	// platform target, as recorded in the lockfile. Freeze files do not
+	// carry them.
+	Artifacts map[string]string
+}
+
+// FromLockfile returns the packages in l, ordered by name
+func FromLockfile(l *lockfile.Lockfile) []Entry {
+	entries := make([]Entry, 0, len(l.Packages))
+	for _, p := range l.Packages {
+		entries = append(entries, Entry{Name: p.Name, Version: p.Version, Checksum: p.Checksum, PackageName: p.PackageName, Format: p.Format, Artifacts: p.Artifacts})
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].Name < entries[b].Name
+	})
+	return entries
+}
+
+// String formats e as a freeze file line
+func (e Entry) String() string {
+	line := e.Name + "==" + e.Version
+	if e.PackageName != "" {
+		line += " package=" + e.PackageName
+	}
+	if e.Format != "" {
+		line += " format=" + e.Format
+	}
+	if hex, ok := strings.CutPrefix(e.Checksum, "sha256:"); ok {
+		line += " sha256=" + hex
+	}
+	return line
+}
+
+// Write writes entries, one per line
+func Write(w io.Writer, entries []Entry) error {
+	for _, e := range entries {
+		if _, err := fmt.Fprintln(w, e.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load reads a freeze file from path
+func Load(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// Parse reads freeze file lines from r. Blank lines and lines starting with
+// "#" are ignored.
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		e, err := parseLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if seen[e.Name] {
+			return nil, fmt.Errorf("line %d: %s is pinned more than once", line, e.Name)
+		}
+		seen[e.Name] = true
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func parseLine(text string) (Entry, error) {
+	fields := strings.Fields(text)
+
+	name, ver, ok := strings.Cut(fields[0], "==")
+	if !ok || name == "" {
+		return Entry{}, fmt.Errorf("expected name==version, got %q", fields[0])
+	}
+	if _, err := version.Parse(ver); err != nil {
+		return Entry{}, fmt.Errorf("%s: %w", name, err)
+	}
+	e := Entry{Name: name, Version: ver}
+
+	for _, field := range fields[1:] {
+		key, value, _ := strings.Cut(field, "=")
+		switch {
+		case key == "sha256" && value != "":
+			e.Checksum = "sha256:" + value
+		case key == "package" && value != "":
+			e.PackageName = value
+		case key == "format" && (value == "tar.gz" || value == "tar.zst"):
+			e.Format = value
+		default:
+			return Entry{}, fmt.Errorf("%s: unexpected %q, want sha256=<hex>, package=<name> or format=<tar.gz|tar.zst>", name, field)
+		}
+	}
+	return e, nil
+}
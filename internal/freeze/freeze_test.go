@@ -0,0 +1,88 @@
+package freeze
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/lockfile"
+)
+
+func TestFromLockfile(t *testing.T) {
+	lock := lockfile.New()
+	lock.Set(lockfile.Package{Name: "json-utils", Version: "1.2.0", Checksum: "sha256:abc"})
+	lock.Set(lockfile.Package{Name: "http-client", Version: "2.0.0", Format: "tar.zst"})
+	lock.Set(lockfile.Package{Name: "old-json", PackageName: "json-utils", Version: "1.0.0", Checksum: "sha256:def"})
+
+	var buf bytes.Buffer
+	if err := Write(&buf, FromLockfile(lock)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	want := "http-client==2.0.0 format=tar.zst\njson-utils==1.2.0 sha256=abc\nold-json==1.0.0 package=json-utils sha256=def\n"
+	if buf.String() != want {
+		t.Errorf("Write() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Entry
+		wantErr string
+	}{
+		{
+			name:  "round trip",
+			input: "# pinned\n\nhttp-client==2.0.0 format=tar.zst\njson-utils==1.2.0 sha256=abc\nold-json==1.0.0 package=json-utils\n",
+			want: []Entry{
+				{Name: "http-client", Version: "2.0.0", Format: "tar.zst"},
+				{Name: "json-utils", Version: "1.2.0", Checksum: "sha256:abc"},
+				{Name: "old-json", Version: "1.0.0", PackageName: "json-utils"},
+			},
+		},
+		{
+			name:    "missing version",
+			input:   "json-utils\n",
+			wantErr: "line 1: expected name==version",
+		},
+		{
+			name:    "constraint instead of version",
+			input:   "json-utils==^1.2.0\n",
+			wantErr: "line 1: json-utils: invalid version format",
+		},
+		{
+			name:    "unknown field",
+			input:   "json-utils==1.2.0 md5=abc\n",
+			wantErr: `line 1: json-utils: unexpected "md5=abc"`,
+		},
+		{
+			name:    "unknown format",
+			input:   "json-utils==1.2.0 format=tar.bz2\n",
+			wantErr: `line 1: json-utils: unexpected "format=tar.bz2"`,
+		},
+		{
+			name:    "duplicate",
+			input:   "json-utils==1.2.0\njson-utils==1.3.0\n",
+			wantErr: "line 2: json-utils is pinned more than once",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package install
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/registry"
+)
+
+// SetAsOf makes installs resolve dependencies as they would have been at t,
+// ignoring versions published after it. The zero time, the default, allows
+// every version.
+func (i *Installer) SetAsOf(t time.Time) {
+	i.asOf = t
+}
+
+// ParseAsOf parses an --as-of value: a date such as "2024-06-01", meaning
+// its start in UTC, or an RFC 3339 timestamp
+func ParseAsOf(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: use YYYY-MM-DD or an RFC 3339 timestamp such as 2024-06-01T12:00:00Z", value)
+	}
+	return t, nil
+}
+
+// listVersions returns the versions of a package that resolution may select
+func (i *Installer) listVersions(client *registry.Client, name string) ([]string, error) {
+	if i.asOf.IsZero() {
+		return client.ListVersions(name)
+	}
+	return client.ListVersionsAsOf(name, i.asOf)
+}
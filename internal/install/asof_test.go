@@ -0,0 +1,81 @@
+package install
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+)
+
+func TestParseAsOf(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "2024-06-01", want: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{value: "2024-06-01T12:30:00+02:00", want: time.Date(2024, 6, 1, 10, 30, 0, 0, time.UTC)},
+		{value: "June 2024", wantErr: true},
+		{value: "2024-13-01", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAsOf(tt.value)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("ParseAsOf(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestInstaller_AsOf(t *testing.T) {
+	reg := registrytest.New()
+	for n, v := range []string{"1.0.0", "1.1.0", "1.2.0"} {
+		archive, err := registrytest.Archive(map[string]string{"src/main.crl": fmt.Sprintf("# json-utils %s", v)})
+		if err != nil {
+			t.Fatalf("failed to build archive: %v", err)
+		}
+		published := time.Date(2024, time.Month(4+n), 15, 0, 0, 0, 0, time.UTC)
+		reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: v, PublishedAt: &published}, archive)
+	}
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\njson-utils = \"^1.0.0\"\n"), 0644)
+
+	installer.SetAsOf(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	lock, err := installer.InstallManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	if got := lock.Find("json-utils").Version; got != "1.1.0" {
+		t.Errorf("locked version as of 2024-06-01 = %s, want 1.1.0", got)
+	}
+	if err := installer.InstallPackageByName("json-utils", "", false); err != nil {
+		t.Fatalf("InstallPackageByName() error = %v", err)
+	}
+	if !cfg.LocalPackageInstalled("json-utils", "1.1.0") || cfg.LocalPackageInstalled("json-utils", "1.2.0") {
+		t.Errorf("InstallPackageByName() did not pick the latest version as of the date")
+	}
+
+	installer.SetAsOf(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	if _, err := installer.InstallManifest(manifestPath); err == nil {
+		t.Error("InstallManifest() before any version was published succeeded")
+	}
+
+	// Without a date and without the lockfile pinning 1.1.0, the newest
+	// version is picked again
+	installer.SetAsOf(time.Time{})
+	os.Remove(filepath.Join(projectDir, "Bifrost.lock"))
+	if lock, err := installer.InstallManifest(manifestPath); err != nil || lock.Find("json-utils").Version != "1.2.0" {
+		t.Errorf("InstallManifest() without a date = %v, want 1.2.0 locked", err)
+	}
+}
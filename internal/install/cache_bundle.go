@@ -0,0 +1,282 @@
+package install
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/archive"
+	ver "github.com/javanhut/bifrost/internal/version"
+)
+
+// CacheBundleIndex is the entry of a cache bundle listing its archives
+const CacheBundleIndex = "bifrost-cache.json"
+
+// CacheEntry is an archive in the cache, as recorded in a cache bundle
+type CacheEntry struct {
+	// File is the archive's name in the cache directory
+	File     string `json:"file"`
+	Checksum string `json:"checksum"`
+	Size     int64  `json:"size"`
+}
+
+// cacheBundle is the index of a cache bundle
+type cacheBundle struct {
+	Entries []CacheEntry `json:"entries"`
+}
+
+// CacheEntries returns the cached archives of the packages selected by
+// name or name@version, or every cached archive without selectors
+func (i *Installer) CacheEntries(selectors ...string) ([]CacheEntry, error) {
+	entries, err := os.ReadDir(i.config.CacheDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read cache: %w", err)
+	}
+
+	matched := make([]bool, len(selectors))
+	var files []string
+	for _, entry := range entries {
+		file := entry.Name()
+		format, ok := archive.FormatOf(file)
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		stem := strings.TrimSuffix(file, "."+string(format))
+		selected := len(selectors) == 0
+		for n, selector := range selectors {
+			if cacheFileMatches(stem, selector) {
+				selected, matched[n] = true, true
+			}
+		}
+		if selected {
+			files = append(files, file)
+		}
+	}
+	for n, selector := range selectors {
+		if !matched[n] {
+			return nil, fmt.Errorf("no cached archives of %s", selector)
+		}
+	}
+
+	sort.Strings(files)
+	result := make([]CacheEntry, 0, len(files))
+	for _, file := range files {
+		entry, err := i.cacheEntry(file)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// cacheFileMatches reports whether the cached archive named stem, without
+// its extension, belongs to the package selected by name or name@version.
+// Prebuilt archives have the target after the version.
+func cacheFileMatches(stem, selector string) bool {
+	name, version, hasVersion := strings.Cut(selector, "@")
+	if strings.HasPrefix(selector, "@") {
+		// Scoped names start with @
+		name, version, hasVersion = strings.Cut(selector[1:], "@")
+		name = "@" + name
+	}
+	// As in archive.FileName
+	rest, ok := strings.CutPrefix(stem, strings.ReplaceAll(name, "/", "+")+"-")
+	if !ok {
+		return false
+	}
+	if hasVersion {
+		return rest == version || strings.HasPrefix(rest, version+"-")
+	}
+	// Files of packages whose name starts with name- fail to parse here
+	_, err := ver.Parse(rest)
+	return err == nil
+}
+
+// LockedCacheEntries returns the cached archives of the packages in the
+// lockfile next to the manifest at manifestPath, downloading those that are
+// not cached yet
+func (i *Installer) LockedCacheEntries(manifestPath string) ([]CacheEntry, error) {
+	pkgs, err := i.FetchLocked(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var result []CacheEntry
+	for _, pkg := range pkgs {
+		file := filepath.Base(i.cacheArchivePath(pkg))
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+		entry, err := i.cacheEntry(file)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(a, b int) bool { return result[a].File < result[b].File })
+	return result, nil
+}
+
+// cacheEntry checksums the cached archive file
+func (i *Installer) cacheEntry(file string) (CacheEntry, error) {
+	path := i.config.CachePath(file)
+	info, err := os.Stat(path)
+	if err != nil {
+		return CacheEntry{}, fmt.Errorf("failed to read cached archive: %w", err)
+	}
+	checksum, err := archiveChecksum(path)
+	if err != nil {
+		return CacheEntry{}, fmt.Errorf("failed to checksum %s: %w", file, err)
+	}
+	return CacheEntry{File: file, Checksum: checksum, Size: info.Size()}, nil
+}
+
+// ExportCache writes the cached archives of entries to a gzipped tarball at
+// path, led by an index of their checksums, for ImportCache on another
+// machine
+func (i *Installer) ExportCache(path string, entries []CacheEntry) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("failed to write bundle: %w", cerr)
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	index, err := json.MarshalIndent(cacheBundle{Entries: entries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode bundle index: %w", err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: CacheBundleIndex, Mode: 0644, Size: int64(len(index))}); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if _, err := tw.Write(index); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	for _, entry := range entries {
+		if err := writeBundleFile(tw, i.config.CachePath(entry.File), entry); err != nil {
+			return fmt.Errorf("failed to add %s to bundle: %w", entry.File, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return nil
+}
+
+// writeBundleFile adds the archive at path to a bundle as entry
+func writeBundleFile(tw *tar.Writer, path string, entry CacheEntry) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := tw.WriteHeader(&tar.Header{Name: entry.File, Mode: 0644, Size: entry.Size}); err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, f, entry.Size)
+	return err
+}
+
+// ImportCache copies the archives of the bundle at path, written by
+// ExportCache, into the cache. Every archive must match the checksum in
+// the bundle's index and, when a transparency log is set, be recorded in
+// it. It returns the archives imported and those that were already cached.
+func (i *Installer) ImportCache(path string) (imported, existing []CacheEntry, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	header, err := tr.Next()
+	if err != nil || header.Name != CacheBundleIndex {
+		return nil, nil, fmt.Errorf("%s is not a cache bundle: it does not start with %s", path, CacheBundleIndex)
+	}
+	var index cacheBundle
+	if err := json.NewDecoder(tr).Decode(&index); err != nil {
+		return nil, nil, fmt.Errorf("failed to read bundle index: %w", err)
+	}
+	pending := make(map[string]CacheEntry, len(index.Entries))
+	for _, entry := range index.Entries {
+		if _, ok := archive.FormatOf(entry.File); !ok || entry.File != filepath.Base(entry.File) || entry.Checksum == "" {
+			return nil, nil, fmt.Errorf("bundle index lists an invalid archive %q", entry.File)
+		}
+		pending[entry.File] = entry
+	}
+	if err := os.MkdirAll(i.config.CacheDir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return imported, existing, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		entry, ok := pending[header.Name]
+		if !ok || header.Typeflag != tar.TypeReg {
+			return imported, existing, fmt.Errorf("bundle contains %s, which its index does not list", header.Name)
+		}
+		delete(pending, header.Name)
+
+		if cachedArchiveMatches(i.config.CachePath(entry.File), entry.Checksum) {
+			existing = append(existing, entry)
+			continue
+		}
+		if err := i.importCacheFile(tr, entry); err != nil {
+			return imported, existing, err
+		}
+		imported = append(imported, entry)
+	}
+	if len(pending) > 0 {
+		missing := sortedKeys(pending)
+		return imported, existing, fmt.Errorf("bundle is missing %s listed in its index", strings.Join(missing, ", "))
+	}
+	return imported, existing, nil
+}
+
+// importCacheFile writes the archive of entry read from r into the cache,
+// unless its checksum differs from the one recorded for it or the
+// transparency log, when one is set, does not record it
+func (i *Installer) importCacheFile(r io.Reader, entry CacheEntry) error {
+	return writeCacheFile(i.config.CachePath(entry.File), func(w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	}, func(tmpPath string) error {
+		checksum, err := archiveChecksum(tmpPath)
+		if err != nil {
+			return fmt.Errorf("failed to import %s: %w", entry.File, err)
+		}
+		if checksum != entry.Checksum {
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", entry.File, entry.Checksum, checksum)
+		}
+		return i.checkLogged(entry.File, checksum)
+	})
+}
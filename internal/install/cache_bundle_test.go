@@ -0,0 +1,115 @@
+package install
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+)
+
+func TestCacheFileMatches(t *testing.T) {
+	tests := []struct {
+		stem     string
+		selector string
+		want     bool
+	}{
+		{"json-utils-1.2.0", "json-utils", true},
+		{"json-utils-1.2.0", "json-utils@1.2.0", true},
+		{"json-utils-1.2.0-linux-amd64", "json-utils@1.2.0", true},
+		{"json-utils-1.2.0", "json-utils@1.0.0", false},
+		{"json-utils-1.2.0", "json", false},
+		{"@acme+utils-0.1.0", "@acme/utils", true},
+		{"@acme+utils-0.1.0", "@acme/utils@0.1.0", true},
+	}
+	for _, tt := range tests {
+		if got := cacheFileMatches(tt.stem, tt.selector); got != tt.want {
+			t.Errorf("cacheFileMatches(%q, %q) = %v, want %v", tt.stem, tt.selector, got, tt.want)
+		}
+	}
+}
+
+func TestInstaller_CacheBundle(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0", "1.2.0"})
+	archive, err := registrytest.Archive(map[string]string{"src/main.crl": "# http-client"})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "http-client", Version: "2.0.0"}, archive)
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\njson-utils = \"^1.0.0\"\n"), 0644)
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	if err := installer.InstallPackageByName("http-client", "2.0.0", true); err != nil {
+		t.Fatalf("InstallPackageByName() error = %v", err)
+	}
+
+	// The lockfile selects only the locked archive
+	entries, err := installer.LockedCacheEntries(manifestPath)
+	if err != nil {
+		t.Fatalf("LockedCacheEntries() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].File != "json-utils-1.2.0.tar.gz" || entries[0].Checksum == "" {
+		t.Fatalf("LockedCacheEntries() = %+v", entries)
+	}
+	all, err := installer.CacheEntries()
+	if err != nil || len(all) != 2 {
+		t.Fatalf("CacheEntries() = %+v, %v, want both archives", all, err)
+	}
+	if _, err := installer.CacheEntries("yaml"); err == nil {
+		t.Error("CacheEntries() of a package that is not cached succeeded")
+	}
+
+	bundle := filepath.Join(t.TempDir(), "cache.tar.gz")
+	if err := installer.ExportCache(bundle, all); err != nil {
+		t.Fatalf("ExportCache() error = %v", err)
+	}
+
+	// Another machine installs from the imported cache without the registry
+	other := newTestConfig(t, "http://127.0.0.1:1")
+	importer := New(other)
+	importer.SetOutput(io.Discard)
+	imported, existing, err := importer.ImportCache(bundle)
+	if err != nil || len(imported) != 2 || len(existing) != 0 {
+		t.Fatalf("ImportCache() = %+v, %+v, %v", imported, existing, err)
+	}
+	if _, err := os.Stat(other.CachePath("http-client-2.0.0.tar.gz")); err != nil {
+		t.Errorf("archive not imported: %v", err)
+	}
+	os.MkdirAll(filepath.Dir(other.ModulesDir), 0755)
+	otherManifest := filepath.Join(filepath.Dir(other.ModulesDir), "Bifrost.toml")
+	data, _ := os.ReadFile(filepath.Join(projectDir, "Bifrost.lock"))
+	os.WriteFile(filepath.Join(filepath.Dir(other.ModulesDir), "Bifrost.lock"), data, 0644)
+	data, _ = os.ReadFile(manifestPath)
+	os.WriteFile(otherManifest, data, 0644)
+	if err := importer.InstallLocked(otherManifest); err != nil {
+		t.Fatalf("InstallLocked() from the imported cache error = %v", err)
+	}
+
+	imported, existing, err = importer.ImportCache(bundle)
+	if err != nil || len(imported) != 0 || len(existing) != 2 {
+		t.Errorf("second ImportCache() = %+v, %+v, %v, want everything already cached", imported, existing, err)
+	}
+
+	// A tampered archive is refused
+	os.WriteFile(cfg.CachePath("json-utils-1.2.0.tar.gz"), []byte("tampered"), 0644)
+	all[1].Size = int64(len("tampered"))
+	if err := installer.ExportCache(bundle, all); err != nil {
+		t.Fatalf("ExportCache() error = %v", err)
+	}
+	third := New(newTestConfig(t, registrytest.URL))
+	if _, _, err := third.ImportCache(bundle); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("ImportCache() of a tampered archive error = %v, want checksum mismatch", err)
+	}
+}
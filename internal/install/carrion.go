@@ -0,0 +1,97 @@
+package install
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/errcode"
+	"github.com/javanhut/bifrost/internal/resolver"
+	ver "github.com/javanhut/bifrost/internal/version"
+	"github.com/javanhut/bifrost/internal/warn"
+)
+
+// carrionVersionPattern finds the version in the output of
+// `carrion --version`, such as "Carrion 0.1.8" or "carrion v0.2"
+var carrionVersionPattern = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// DetectCarrionVersion returns the version of the Carrion interpreter on
+// PATH, as `carrion --version` reports it
+func DetectCarrionVersion() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "carrion", "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run carrion --version: %w", err)
+	}
+	return parseCarrionVersion(string(out))
+}
+
+// parseCarrionVersion returns the MAJOR.MINOR.PATCH version in the output of
+// `carrion --version`, with a missing patch taken as 0
+func parseCarrionVersion(output string) (string, error) {
+	m := carrionVersionPattern.FindStringSubmatch(output)
+	if m == nil {
+		return "", fmt.Errorf("no version in carrion --version output %q", strings.TrimSpace(output))
+	}
+	if m[3] == "" {
+		m[3] = "0"
+	}
+	return m[1] + "." + m[2] + "." + m[3], nil
+}
+
+// SetCarrionVersion sets the version of the Carrion interpreter packages are
+// checked against, instead of asking the carrion on PATH
+func (i *Installer) SetCarrionVersion(v string) {
+	// Done with detection before it starts
+	i.carrionOnce.Do(func() {})
+	i.carrionVersion = v
+}
+
+// SetIgnoreCarrionVersion installs packages that require another Carrion
+// version with a warning, rather than refusing them
+func (i *Installer) SetIgnoreCarrionVersion(ignore bool) {
+	i.ignoreCarrionVersion = ignore
+}
+
+// interpreterVersion returns the version of the Carrion interpreter, asking
+// the carrion on PATH the first time unless one was set. Empty means it is
+// unknown.
+func (i *Installer) interpreterVersion() string {
+	i.carrionOnce.Do(func() {
+		i.carrionVersion, _ = DetectCarrionVersion()
+	})
+	return i.carrionVersion
+}
+
+// checkCarrion checks that the Carrion interpreter is a version pkg runs
+// on, as its manifest's constraint says. An interpreter whose version is
+// unknown only gets a warning.
+func (i *Installer) checkCarrion(pkg *resolver.Package, constraint string) error {
+	if constraint == "" {
+		return nil
+	}
+	c, err := ver.ParseConstraint(constraint)
+	if err != nil {
+		return fmt.Errorf("%s@%s requires an invalid Carrion version %q: %w", pkg.RegistryName(), pkg.Version, constraint, err)
+	}
+
+	interpreter := i.interpreterVersion()
+	v, err := ver.Parse(interpreter)
+	if err != nil {
+		warn.Printf(warn.Package, "%s@%s requires Carrion %s, and the version of the installed interpreter is unknown", pkg.RegistryName(), pkg.Version, constraint)
+		return nil
+	}
+	if c.Satisfies(v) {
+		return nil
+	}
+	if i.ignoreCarrionVersion {
+		warn.Printf(warn.Package, "%s@%s requires Carrion %s, but the interpreter is %s", pkg.RegistryName(), pkg.Version, constraint, interpreter)
+		return nil
+	}
+	return errcode.IncompatibleCarrion.Errorf("%s@%s requires Carrion %s, but the interpreter is %s; upgrade Carrion, pick another version of the package or pass --ignore-carrion-version",
+		pkg.RegistryName(), pkg.Version, constraint, interpreter)
+}
@@ -0,0 +1,84 @@
+package install
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/errcode"
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+	"github.com/javanhut/bifrost/internal/warn"
+)
+
+func TestParseCarrionVersion(t *testing.T) {
+	tests := []struct {
+		output  string
+		want    string
+		wantErr bool
+	}{
+		{output: "Carrion 0.1.8\n", want: "0.1.8"},
+		{output: "carrion version v1.2.3 (linux/amd64)", want: "1.2.3"},
+		{output: "Carrion 0.2", want: "0.2.0"},
+		{output: "Carrion dev build", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseCarrionVersion(tt.output)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseCarrionVersion(%q) = %q, %v, want %q", tt.output, got, err, tt.want)
+		}
+	}
+}
+
+func TestInstaller_CheckCarrionVersion(t *testing.T) {
+	var warnings strings.Builder
+	warn.SetOutput(&warnings)
+	defer warn.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name        string
+		interpreter string
+		ignore      bool
+		wantCode    errcode.Code
+		wantWarning string
+	}{
+		{name: "compatible", interpreter: "0.5.2"},
+		{name: "too old", interpreter: "0.4.0", wantCode: errcode.IncompatibleCarrion},
+		{name: "too old, ignored", interpreter: "0.4.0", ignore: true, wantWarning: "requires Carrion >=0.5.0, but the interpreter is 0.4.0"},
+		{name: "unknown interpreter", wantWarning: "version of the installed interpreter is unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings.Reset()
+			reg := registrytest.New()
+			archive, err := registrytest.Archive(map[string]string{
+				"Bifrost.toml": "[package]\nname = \"json-utils\"\nversion = \"1.0.0\"\ncarrion = \">=0.5.0\"\n",
+				"src/main.crl": "grim Main:",
+			})
+			if err != nil {
+				t.Fatalf("failed to build archive: %v", err)
+			}
+			reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0"}, archive)
+
+			cfg := newTestConfig(t, registrytest.URL)
+			installer := New(cfg)
+			installer.SetClient(reg.Client())
+			installer.SetOutput(io.Discard)
+			installer.SetCarrionVersion(tt.interpreter)
+			installer.SetIgnoreCarrionVersion(tt.ignore)
+
+			err = installer.InstallPackageByName("json-utils", "1.0.0", false)
+			if code := errcode.Of(err); code != tt.wantCode {
+				t.Fatalf("InstallPackageByName() error = %v, want code %q", err, tt.wantCode)
+			}
+			_, statErr := os.Stat(cfg.LocalPackagePath("json-utils", "1.0.0"))
+			if installed := statErr == nil; installed != (tt.wantCode == "") {
+				t.Errorf("installed = %v, want %v", installed, tt.wantCode == "")
+			}
+			if !strings.Contains(warnings.String(), tt.wantWarning) {
+				t.Errorf("warnings = %q, want %q", warnings.String(), tt.wantWarning)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package install
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/archive"
+	"github.com/javanhut/bifrost/internal/changelog"
+	"github.com/javanhut/bifrost/internal/resolver"
+	ver "github.com/javanhut/bifrost/internal/version"
+)
+
+// Changelog returns the changelog entries of a package for the versions
+// after from up to and including to, as declared by version to. With an
+// empty from only the entry for to is returned. A changelog kept inside the
+// package is read from its archive, which stays cached for a later install.
+// Packages without a changelog give changelog.ErrNoChangelog.
+func (i *Installer) Changelog(packageName, from, to string) ([]changelog.Entry, error) {
+	client, err := i.clientFor(i.registryClient(), packageName)
+	if err != nil {
+		return nil, err
+	}
+	info, err := client.GetPackageInfo(packageName, to)
+	if err != nil {
+		return nil, err
+	}
+	if info.Changelog == "" {
+		return nil, changelog.ErrNoChangelog
+	}
+
+	var data []byte
+	if strings.HasPrefix(info.Changelog, "http://") || strings.HasPrefix(info.Changelog, "https://") {
+		data, err = client.FetchChangelog(info.Changelog)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		v, err := ver.Parse(info.Version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q for %s: %w", info.Version, packageName, err)
+		}
+		pkg := &resolver.Package{Name: packageName, Version: v, Checksum: info.Checksum, Format: info.Format, Artifacts: info.Artifacts}
+		archivePath, _, err := i.fetchArchive(client, pkg)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = archive.ReadFile(archivePath, info.Changelog); err != nil {
+			return nil, fmt.Errorf("failed to read changelog: %w", err)
+		}
+	}
+
+	return changelog.Between(changelog.Parse(string(data)), from, info.Version)
+}
@@ -0,0 +1,86 @@
+package install
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/registry"
+	ver "github.com/javanhut/bifrost/internal/version"
+)
+
+const (
+	// versionListTTL is how long a version list cached for completion is
+	// used. Shells ask again on every tab press.
+	versionListTTL = 5 * time.Minute
+	// maxCompletedVersions is how many of the newest versions
+	// CompleteVersions returns
+	maxCompletedVersions = 10
+)
+
+// cachedVersionList is a version list cached for completion, with the
+// registry it came from
+type cachedVersionList struct {
+	Registry string                `json:"registry"`
+	List     *registry.VersionList `json:"list"`
+}
+
+// CompleteVersions returns the dist-tags of the registry package name,
+// then its newest versions, newest first, for completing "name@" in a
+// shell. Version lists are cached in the registry directory for a few
+// minutes.
+func (i *Installer) CompleteVersions(name string) ([]string, error) {
+	client, err := i.clientFor(i.registryClient(), name)
+	if err != nil {
+		return nil, err
+	}
+	list, err := i.versionListFor(client, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var completions []string
+	for tag := range list.DistTags {
+		completions = append(completions, tag)
+	}
+	slices.Sort(completions)
+
+	parsed := make(map[string]*ver.Version)
+	var versions []string
+	for _, s := range list.Versions {
+		if v, err := ver.Parse(s); err == nil {
+			parsed[s] = v
+			versions = append(versions, s)
+		}
+	}
+	slices.SortFunc(versions, func(a, b string) int { return parsed[b].Compare(parsed[a]) })
+	return append(completions, versions[:min(len(versions), maxCompletedVersions)]...), nil
+}
+
+// versionListFor returns the version list of name from client, reusing one
+// cached within versionListTTL
+func (i *Installer) versionListFor(client *registry.Client, name string) (*registry.VersionList, error) {
+	path := filepath.Join(i.config.RegistryDir, "versions", url.PathEscape(name)+".json")
+	if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) < versionListTTL {
+		var cached cachedVersionList
+		if data, err := os.ReadFile(path); err == nil && json.Unmarshal(data, &cached) == nil &&
+			cached.Registry == client.BaseURL() && cached.List != nil {
+			return cached.List, nil
+		}
+	}
+
+	list, err := client.GetVersionList(name)
+	if err != nil {
+		return nil, err
+	}
+	// Caching only saves requests, so failing to is not an error
+	if data, err := json.Marshal(cachedVersionList{Registry: client.BaseURL(), List: list}); err == nil {
+		if os.MkdirAll(filepath.Dir(path), 0755) == nil {
+			os.WriteFile(path, data, 0644)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,50 @@
+package install
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+)
+
+func TestInstaller_CompleteVersions(t *testing.T) {
+	versions := []string{"0.9.0", "1.0.0", "1.2.0", "1.10.0"}
+	for n := 0; n < maxCompletedVersions; n++ {
+		versions = append(versions, "0.1."+strings.Repeat("0", n+1))
+	}
+	reg := newTestRegistry(t, "json-utils", versions)
+	reg.SetDistTag("json-utils", "next", "1.10.0")
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+
+	got, err := installer.CompleteVersions("json-utils")
+	if err != nil {
+		t.Fatalf("CompleteVersions() error = %v", err)
+	}
+	if len(got) != 1+maxCompletedVersions {
+		t.Fatalf("CompleteVersions() = %v, want the tag and %d versions", got, maxCompletedVersions)
+	}
+	if want := []string{"next", "1.10.0", "1.2.0", "1.0.0", "0.9.0"}; !reflect.DeepEqual(got[:5], want) {
+		t.Errorf("CompleteVersions() = %v, want it to start with %v", got, want)
+	}
+
+	// The version list is cached, so the registry is asked once
+	if _, err := installer.CompleteVersions("json-utils"); err != nil {
+		t.Fatalf("CompleteVersions() error = %v", err)
+	}
+	listed := 0
+	for _, r := range reg.Requests() {
+		if strings.HasSuffix(r, "/versions") {
+			listed++
+		}
+	}
+	if listed != 1 {
+		t.Errorf("version list requested %d times, want 1", listed)
+	}
+
+	if _, err := installer.CompleteVersions("yaml"); err == nil {
+		t.Error("CompleteVersions() of an unknown package succeeded")
+	}
+}
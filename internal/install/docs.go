@@ -0,0 +1,136 @@
+package install
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/archive"
+	"github.com/javanhut/bifrost/internal/freeze"
+)
+
+// DocsDir is the directory of a package holding its documentation
+const DocsDir = "docs"
+
+// DocEntryPoints are the files opened as a package's documentation, in order
+// of preference
+var DocEntryPoints = []string{"README.md", "README", "README.txt", "README.rst", "docs/index.md", "docs/README.md"}
+
+// SetWithDocs makes installs extract the README and docs directory of
+// packages, which are left out by default to save space
+func (i *Installer) SetWithDocs(withDocs bool) {
+	i.withDocs = withDocs
+}
+
+// isDocPath reports whether the archive entry name is documentation: the
+// docs directory or a README at the package root
+func isDocPath(name string) bool {
+	name = strings.TrimPrefix(strings.TrimSuffix(name, "/"), "./")
+	if name == DocsDir || strings.HasPrefix(name, DocsDir+"/") {
+		return true
+	}
+	if strings.Contains(name, "/") {
+		return false
+	}
+	base := strings.ToUpper(name)
+	return base == "README" || strings.HasPrefix(base, "README.")
+}
+
+// Doc is the documentation entry point of an installed package
+type Doc struct {
+	Package string
+	Version string
+	// Name is the entry point's path inside the package, e.g. "README.md"
+	Name string
+	// Path is where the entry point is installed, empty when the package
+	// was installed without docs and it was read from the archive instead
+	Path    string
+	Content []byte
+}
+
+// Docs returns the documentation entry point of name, a dependency locked
+// for the manifest at manifestPath. It is read from the installed package,
+// or from its archive when the package was installed without docs.
+func (i *Installer) Docs(manifestPath, name string) (*Doc, error) {
+	lock, err := i.loadCurrentLock(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil || lock.Find(name) == nil {
+		return nil, fmt.Errorf("%s is not installed; run 'bifrost install' first", name)
+	}
+	locked := lock.Find(name)
+
+	doc := &Doc{Package: name, Version: locked.Version}
+	installPath := i.config.LocalPackagePath(name, locked.Version)
+	for _, entry := range DocEntryPoints {
+		p := filepath.Join(installPath, filepath.FromSlash(entry))
+		if content, err := os.ReadFile(p); err == nil {
+			doc.Name, doc.Path, doc.Content = entry, p, content
+			return doc, nil
+		}
+	}
+
+	pkgs, err := frozenPackages([]freeze.Entry{{Name: locked.Name, PackageName: locked.PackageName, Version: locked.Version, Checksum: locked.Checksum, Format: locked.Format, Artifacts: locked.Artifacts}})
+	if err != nil {
+		return nil, err
+	}
+	archivePath, _, err := i.fetchArchive(i.registryClient(), pkgs[0])
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	doc.Name, doc.Content, err = archiveDoc(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s@%s: %w", name, locked.Version, err)
+	}
+	if doc.Name == "" {
+		return nil, fmt.Errorf("%s@%s has no README or %s", name, locked.Version, path.Join(DocsDir, "index.md"))
+	}
+	return doc, nil
+}
+
+// archiveDoc returns the most preferred documentation entry point in an
+// archive, with an empty name when it has none
+func archiveDoc(r io.Reader) (string, []byte, error) {
+	zr, err := archive.NewReader(r)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zr.Close()
+
+	found := make(map[string][]byte)
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		name := strings.TrimPrefix(header.Name, "./")
+		if header.Typeflag != tar.TypeReg || !isDocPath(name) {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return "", nil, err
+		}
+		found[name] = content
+	}
+	for _, entry := range DocEntryPoints {
+		if content, ok := found[entry]; ok {
+			return entry, content, nil
+		}
+	}
+	return "", nil, nil
+}
@@ -0,0 +1,96 @@
+package install
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+)
+
+func TestIsDocPath(t *testing.T) {
+	tests := map[string]bool{
+		"README.md":         true,
+		"readme.txt":        true,
+		"README":            true,
+		"docs/":             true,
+		"docs/guide/api.md": true,
+		"./docs/index.md":   true,
+		"src/README.md":     false,
+		"src/main.crl":      false,
+		"docsite/index.md":  false,
+		"READMEFIRST":       false,
+	}
+	for name, want := range tests {
+		if got := isDocPath(name); got != want {
+			t.Errorf("isDocPath(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestInstaller_Docs(t *testing.T) {
+	reg := registrytest.New()
+	archive, err := registrytest.Archive(map[string]string{
+		"src/main.crl":  "# json-utils",
+		"README.md":     "# json-utils\n",
+		"docs/index.md": "# Guide\n",
+	})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0"}, archive)
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\njson-utils = \"^1.0.0\"\n"), 0644)
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+
+	// Docs are left out by default, read from the archive and not counted
+	// as missing
+	installPath := cfg.LocalPackagePath("json-utils", "1.0.0")
+	for _, name := range []string{"README.md", "docs"} {
+		if _, err := os.Stat(filepath.Join(installPath, name)); !os.IsNotExist(err) {
+			t.Errorf("%s installed without --with-docs: %v", name, err)
+		}
+	}
+	doc, err := installer.Docs(manifestPath, "json-utils")
+	if err != nil {
+		t.Fatalf("Docs() error = %v", err)
+	}
+	if doc.Name != "README.md" || doc.Path != "" || string(doc.Content) != "# json-utils\n" {
+		t.Errorf("Docs() from the archive = %+v", doc)
+	}
+	results, err := installer.Verify(manifestPath, false)
+	if err != nil || !results[0].OK() {
+		t.Errorf("Verify() without docs = %+v, %v", results, err)
+	}
+
+	os.RemoveAll(installPath)
+	installer.SetWithDocs(true)
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	doc, err = installer.Docs(manifestPath, "json-utils")
+	if err != nil {
+		t.Fatalf("Docs() error = %v", err)
+	}
+	if want := filepath.Join(installPath, "README.md"); doc.Path != want {
+		t.Errorf("Docs() path = %q, want %q", doc.Path, want)
+	}
+	if _, err := os.Stat(filepath.Join(installPath, "docs", "index.md")); err != nil {
+		t.Errorf("docs not installed with --with-docs: %v", err)
+	}
+
+	if _, err := installer.Docs(manifestPath, "missing"); err == nil {
+		t.Error("Docs() of a package that is not a dependency succeeded")
+	}
+}
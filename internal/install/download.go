@@ -0,0 +1,243 @@
+package install
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/archive"
+	"github.com/javanhut/bifrost/internal/delta"
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/resolver"
+	ver "github.com/javanhut/bifrost/internal/version"
+)
+
+// DefaultMaxConcurrentDownloads is how many archives a manifest install
+// downloads at once unless told otherwise
+const DefaultMaxConcurrentDownloads = 4
+
+// cacheTempSuffix ends the names of files still being written into the
+// cache. Nothing reads them as cached archives.
+const cacheTempSuffix = ".tmp"
+
+// fetched is the outcome of downloading one archive ahead of installing it
+type fetched struct {
+	path     string
+	checksum string
+	err      error
+}
+
+// SetMaxConcurrentDownloads limits how many archives InstallManifest and
+// InstallFrozen download at once. Values below one mean one at a time.
+func (i *Installer) SetMaxConcurrentDownloads(n int) {
+	i.maxDownloads = max(n, 1)
+}
+
+// SetLimitRate caps the combined download rate of all archives at
+// bytesPerSecond. Zero removes the limit.
+func (i *Installer) SetLimitRate(bytesPerSecond int64) {
+	i.limiter = registry.NewRateLimiter(bytesPerSecond)
+}
+
+// prefetch downloads the archives of the packages in pkgs that are not
+// installed yet, up to maxDownloads at a time. Extraction stays sequential;
+// installLocalPackage picks the results up through fetch. Errors are kept
+// and reported when the package they belong to is installed.
+func (i *Installer) prefetch(client *registry.Client, pkgs []*resolver.Package) {
+	i.prefetched = make(map[string]*fetched)
+	if i.maxDownloads <= 1 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, i.maxDownloads)
+	for _, pkg := range pkgs {
+		if i.config.LocalPackageInstalled(pkg.Name, pkg.Version.String()) || i.overrides[pkg.Name].Path != "" {
+			continue
+		}
+		// Aliases of the same package share one archive
+		key := archiveKey(pkg)
+		if _, ok := i.prefetched[key]; ok {
+			continue
+		}
+		result := &fetched{}
+		i.prefetched[key] = result
+
+		wg.Add(1)
+		go func(pkg *resolver.Package) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			result.path, result.checksum, result.err = i.fetchArchive(client, pkg)
+		}(pkg)
+	}
+	wg.Wait()
+}
+
+// fetch returns pkg's archive, from an earlier prefetch if there was one
+func (i *Installer) fetch(client *registry.Client, pkg *resolver.Package) (string, string, error) {
+	if result, ok := i.prefetched[archiveKey(pkg)]; ok {
+		return result.path, result.checksum, result.err
+	}
+	return i.fetchArchive(client, pkg)
+}
+
+// archiveKey identifies the archive pkg is installed from
+func archiveKey(pkg *resolver.Package) string {
+	return fmt.Sprintf("%s@%s", pkg.RegistryName(), pkg.Version)
+}
+
+// fetchPatch tries to build the archive of name@version at archivePath by
+// applying a registry patch to the newest older version in the cache. It
+// reports whether that worked; when it did not, for lack of a base or a
+// patch or because the result does not match checksum, the caller
+// downloads the full archive.
+func (i *Installer) fetchPatch(client *registry.Client, name, version, checksum, archivePath string) bool {
+	basePath, baseVersion := i.patchBase(name, version)
+	if basePath == "" {
+		return false
+	}
+
+	started := time.Now()
+	reader, format, err := client.DownloadPatch(name, baseVersion, version)
+	if err != nil {
+		if !errors.Is(err, registry.ErrNoPatch) {
+			i.logf("Patch for %s@%s unavailable, downloading full archive: %v\n", name, version, err)
+		}
+		return false
+	}
+	defer reader.Close()
+	if format != delta.Format {
+		i.logf("Patch for %s@%s has unsupported format %q, downloading full archive\n", name, version, format)
+		return false
+	}
+
+	i.logf("Patching %s@%s from %s...\n", name, version, baseVersion)
+	counted := &countingReader{r: i.limiter.Reader(reader)}
+	if err := applyPatch(basePath, counted, archivePath, checksum); err != nil {
+		i.logf("Patch for %s@%s failed, downloading full archive: %v\n", name, version, err)
+		return false
+	}
+
+	i.mu.Lock()
+	i.report.recordPatch(name, version, baseVersion, counted.n, time.Since(started))
+	i.mu.Unlock()
+	return true
+}
+
+// applyPatch writes the result of applying patch to the archive at basePath
+// to archivePath, only once it matches checksum
+func applyPatch(basePath string, patch io.Reader, archivePath, checksum string) error {
+	base, err := os.ReadFile(basePath)
+	if err != nil {
+		return err
+	}
+	return writeCacheFile(archivePath, func(w io.Writer) error {
+		return delta.Apply(base, patch, w)
+	}, func(tmpPath string) error {
+		got, err := archiveChecksum(tmpPath)
+		if err != nil {
+			return err
+		}
+		if got != checksum {
+			return fmt.Errorf("checksum mismatch: expected %s, got %s", checksum, got)
+		}
+		return nil
+	})
+}
+
+// writeCacheFile writes a file into the cache at path. The file is written
+// to a temporary name unique to this writer and only renamed into place once
+// verify accepts it, so installs of other projects sharing the cache never
+// read a partial file or write into the same one.
+func writeCacheFile(path string, write func(io.Writer) error, verify func(tmpPath string) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to save %s: %w", filepath.Base(path), err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*"+cacheTempSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to save %s: %w", filepath.Base(path), err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = write(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save %s: %w", filepath.Base(path), err)
+	}
+	if err := verify(tmp.Name()); err != nil {
+		return err
+	}
+	// Another install may have cached the same file meanwhile; both passed
+	// verification, so either may win
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// patchBase returns the path and version of the newest cached archive of
+// name older than version, or empty strings if there is none
+func (i *Installer) patchBase(name, version string) (string, string) {
+	target, err := ver.Parse(version)
+	if err != nil {
+		return "", ""
+	}
+	entries, err := os.ReadDir(i.config.CacheDir)
+	if err != nil {
+		return "", ""
+	}
+
+	prefix := name + "-"
+	var best *ver.Version
+	var bestPath string
+	for _, entry := range entries {
+		file := entry.Name()
+		format, ok := archive.FormatOf(file)
+		if !ok || !strings.HasPrefix(file, prefix) {
+			continue
+		}
+		// Files of packages whose name starts with name- fail to parse here
+		v, err := ver.Parse(strings.TrimSuffix(strings.TrimPrefix(file, prefix), "."+string(format)))
+		if err != nil || v.Compare(target) >= 0 {
+			continue
+		}
+		if info, err := entry.Info(); err != nil || info.Size() > delta.MaxArchiveSize {
+			continue
+		}
+		if best == nil || v.Compare(best) > 0 {
+			best, bestPath = v, filepath.Join(i.config.CacheDir, file)
+		}
+	}
+	if best == nil {
+		return "", ""
+	}
+	return bestPath, best.String()
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// logf writes a progress message. Downloads running in parallel share the
+// output, so their messages must not interleave.
+func (i *Installer) logf(format string, args ...interface{}) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	fmt.Fprintf(i.out, format, args...)
+}
@@ -0,0 +1,163 @@
+package install
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/javanhut/bifrost/internal/color"
+)
+
+// EventKind is a step of an install reported to an EventHandler
+type EventKind string
+
+const (
+	// EventResolving is sent when resolution of a package or of a
+	// manifest's dependencies starts. Package is empty for a manifest.
+	EventResolving EventKind = "resolving"
+	// EventCached is sent when an archive is taken from the cache
+	EventCached EventKind = "cached"
+	// EventDownloading is sent when an archive download starts and again as
+	// it progresses, with Bytes and Total
+	EventDownloading EventKind = "downloading"
+	// EventExtracting is sent before a package is extracted to Path
+	EventExtracting EventKind = "extracting"
+	// EventInstalled is sent once a package is installed at Path
+	EventInstalled EventKind = "installed"
+	// EventUpToDate is sent for a package already installed at Path
+	EventUpToDate EventKind = "up-to-date"
+	// EventLinked is sent once a package in the user package directory, or
+	// the directory overriding it, is linked into the project at Path
+	EventLinked EventKind = "linked"
+	// EventFailed is sent for a package a keep-going install skips
+	EventFailed EventKind = "failed"
+	// EventDone is sent when an install finishes, with its Report
+	EventDone EventKind = "done"
+)
+
+// Event describes the progress of an install
+type Event struct {
+	Kind    EventKind
+	Package string
+	Version string
+	Path    string
+	// Bytes and Total are how much of a download is done and its size.
+	// Total is zero when the registry did not give the size.
+	Bytes int64
+	Total int64
+	// Err is why a package failed
+	Err error
+	// Report is the summary of a finished install
+	Report *Report
+}
+
+// Percent returns how much of a download is done, or -1 when its size is
+// unknown
+func (e Event) Percent() int {
+	if e.Total <= 0 {
+		return -1
+	}
+	return int(e.Bytes * 100 / e.Total)
+}
+
+// EventHandler receives the events of an install. Events from parallel
+// downloads are delivered one at a time.
+type EventHandler func(Event)
+
+// SetEventHandler sends install events to h instead of writing them to the
+// output as text. A nil handler restores the text output.
+func (i *Installer) SetEventHandler(h EventHandler) {
+	i.events = h
+}
+
+// TextEvents returns a handler writing events to w as the progress lines
+// the installer prints by default
+func TextEvents(w io.Writer) EventHandler {
+	return func(e Event) {
+		writeEvent(w, e)
+	}
+}
+
+// emit delivers e to the event handler, or writes it to the output
+func (i *Installer) emit(e Event) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.events != nil {
+		i.events(e)
+		return
+	}
+	writeEvent(i.out, e)
+}
+
+// finish completes the report of an install and announces it is done
+func (i *Installer) finish() {
+	i.report.finish()
+	i.emit(Event{Kind: EventDone, Report: i.report})
+}
+
+func writeEvent(w io.Writer, e Event) {
+	c := color.For(w)
+	ref := c.Ref(e.Package, e.Version)
+	switch e.Kind {
+	case EventResolving:
+		if e.Package == "" {
+			fmt.Fprintln(w, "Resolving dependencies...")
+		} else {
+			fmt.Fprintf(w, "Resolving %s...\n", c.Package(e.Package))
+		}
+	case EventCached:
+		fmt.Fprintf(w, "Using cached %s\n", ref)
+	case EventDownloading:
+		// Progress is only shown by handlers that can redraw it
+		if e.Bytes == 0 {
+			fmt.Fprintf(w, "Downloading %s...\n", ref)
+		}
+	case EventExtracting:
+		fmt.Fprintf(w, "Installing %s to %s...\n", ref, e.Path)
+	case EventInstalled:
+		fmt.Fprintf(w, "Successfully installed %s to %s\n", ref, e.Path)
+	case EventUpToDate:
+		fmt.Fprintf(w, "Package %s already installed at %s\n", ref, e.Path)
+	case EventLinked:
+		fmt.Fprintf(w, "Linked %s into %s\n", ref, e.Path)
+	case EventFailed:
+		fmt.Fprintf(w, "%s %s: %v\n", c.Error("Failed to install"), ref, e.Err)
+	}
+}
+
+// progressReader sends download events for the bytes read through it,
+// whenever another percent is done or, without a size, every 256 KiB
+type progressReader struct {
+	r     io.Reader
+	i     *Installer
+	event Event
+	// next is the byte count of the next event and sent that of the last
+	next int64
+	sent int64
+}
+
+func (i *Installer) newProgressReader(r io.Reader, name, version string, total int64) *progressReader {
+	p := &progressReader{r: r, i: i, event: Event{Kind: EventDownloading, Package: name, Version: version, Total: max(total, 0)}}
+	p.i.emit(p.event)
+	p.advance()
+	return p
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.event.Bytes += int64(n)
+	if p.event.Bytes >= p.next || (err == io.EOF && p.event.Bytes != p.sent) {
+		p.i.emit(p.event)
+		p.advance()
+	}
+	return n, err
+}
+
+// advance records an event was sent and sets when the next one is due
+func (p *progressReader) advance() {
+	p.sent = p.event.Bytes
+	step := p.event.Total / 100
+	if p.event.Total == 0 {
+		step = 256 << 10
+	}
+	p.next = p.event.Bytes + max(step, 1)
+}
@@ -0,0 +1,96 @@
+package install
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+	"github.com/javanhut/bifrost/internal/warn"
+)
+
+func TestInstaller_Events(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	var output bytes.Buffer
+	installer.SetOutput(&output)
+	var events []Event
+	installer.SetEventHandler(func(e Event) {
+		events = append(events, e)
+	})
+	var warnings bytes.Buffer
+	warn.SetOutput(&warnings)
+	defer warn.SetOutput(os.Stderr)
+
+	projectDir := t.TempDir()
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\njson-utils = \"^1.0.0\"\n"), 0644)
+
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	var kinds []string
+	for _, e := range events {
+		if e.Kind != EventDownloading || e.Bytes == 0 {
+			kinds = append(kinds, string(e.Kind))
+		}
+	}
+	want := "resolving downloading extracting installed done"
+	if got := strings.Join(kinds, " "); got != want {
+		t.Errorf("events = %s, want %s", got, want)
+	}
+
+	var last *Event
+	for n := range events {
+		if events[n].Kind == EventDownloading {
+			last = &events[n]
+		}
+	}
+	if last == nil || last.Total == 0 || last.Bytes != last.Total || last.Percent() != 100 {
+		t.Errorf("last download event = %+v, want the whole archive", last)
+	}
+	if done := events[len(events)-1]; done.Report == nil || len(done.Report.Added) != 1 {
+		t.Errorf("done event = %+v, want the install report", done)
+	}
+	if installed := events[len(events)-2]; installed.Package != "json-utils" || installed.Path != cfg.LocalPackagePath("json-utils", "1.0.0") {
+		t.Errorf("installed event = %+v", installed)
+	}
+	if strings.Contains(output.String(), "Downloading") {
+		t.Errorf("events also written as text: %q", output.String())
+	}
+	// Warnings go to the warning channel, not the progress output
+	if !strings.Contains(warnings.String(), "Warning [integrity]: json-utils@1.0.0 has no Bifrost.toml") || strings.Contains(output.String(), "Warning") {
+		t.Errorf("warnings = %q, output = %q", warnings.String(), output.String())
+	}
+
+	// Without a handler the same events are written as text
+	installer.SetEventHandler(nil)
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	if !strings.Contains(output.String(), "Package json-utils@1.0.0 already installed at") {
+		t.Errorf("text output = %q", output.String())
+	}
+}
+
+func TestEvent_Percent(t *testing.T) {
+	tests := []struct {
+		bytes, total int64
+		want         int
+	}{
+		{bytes: 0, total: 200, want: 0},
+		{bytes: 50, total: 200, want: 25},
+		{bytes: 200, total: 200, want: 100},
+		{bytes: 50, total: 0, want: -1},
+	}
+	for _, tt := range tests {
+		e := Event{Kind: EventDownloading, Bytes: tt.bytes, Total: tt.total}
+		if got := e.Percent(); got != tt.want {
+			t.Errorf("Percent() of %d/%d = %d, want %d", tt.bytes, tt.total, got, tt.want)
+		}
+	}
+}
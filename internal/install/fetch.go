@@ -0,0 +1,93 @@
+package install
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/resolver"
+)
+
+// Fetch resolves the dependencies of the manifest at manifestPath and
+// downloads their archives into the cache, without installing anything or
+// writing the lockfile. The cache is shared by every project and checkout,
+// so a later install of the same versions needs no network. It returns the
+// packages fetched, in install order.
+func (i *Installer) Fetch(manifestPath string) ([]*resolver.Package, error) {
+	i.report = newReport()
+	defer i.finish()
+
+	m, err := i.loadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := lockfile.LoadIfExists(i.lockPath(manifestPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lockfile: %w", err)
+	}
+
+	i.emit(Event{Kind: EventResolving})
+	resolution, err := i.resolveManifest(m, lock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve dependencies: %w", err)
+	}
+	applyLockedChecksums(resolution, lock)
+
+	pkgs := resolution.GetResolutionOrder()
+	return pkgs, i.fetchAll(i.registryClient(), pkgs)
+}
+
+// FetchLocked downloads the archives of the packages in the lockfile next to
+// the manifest at manifestPath into the cache, as InstallLocked would
+// install them
+func (i *Installer) FetchLocked(manifestPath string) ([]*resolver.Package, error) {
+	i.report = newReport()
+	defer i.finish()
+
+	entries, err := i.lockedEntries(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	pkgs, err := frozenPackages(entries)
+	if err != nil {
+		return nil, err
+	}
+	return pkgs, i.fetchAll(i.registryClient(), pkgs)
+}
+
+// fetchAll downloads the archives of pkgs into the cache, up to maxDownloads
+// at a time, returning the first failure in pkgs order
+func (i *Installer) fetchAll(client *registry.Client, pkgs []*resolver.Package) error {
+	errs := make([]error, len(pkgs))
+	seen := make(map[string]bool)
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, i.maxDownloads)
+	for n, pkg := range pkgs {
+		// Aliases of the same package share one archive
+		key := archiveKey(pkg)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		wg.Add(1)
+		go func(n int, pkg *resolver.Package) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			if _, _, err := i.fetchArchive(client, pkg); err != nil {
+				errs[n] = fmt.Errorf("failed to fetch %s@%s: %w", pkg.RegistryName(), pkg.Version, err)
+			}
+		}(n, pkg)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package install
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxGrepFileSize is the largest file Grep searches; bigger ones are data
+// rather than source
+const maxGrepFileSize = 4 << 20
+
+// Match is a line of an installed dependency matching a Grep pattern
+type Match struct {
+	Package string `json:"package"`
+	Version string `json:"version"`
+	// File is the matching file where it is installed, and Path its path
+	// inside the package
+	File string `json:"file"`
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// Grep searches the text files of the dependencies locked for the manifest
+// at manifestPath, or only of the packages named, for lines matching
+// pattern. Hidden files, binary files and files over 4 MB are skipped.
+func (i *Installer) Grep(manifestPath string, pattern *regexp.Regexp, packages ...string) ([]Match, error) {
+	lock, err := i.loadCurrentLock(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		return nil, fmt.Errorf("no dependencies are installed; run 'bifrost install' first")
+	}
+
+	selected := lock.Packages
+	if len(packages) > 0 {
+		selected = nil
+		for _, name := range packages {
+			locked := lock.Find(name)
+			if locked == nil {
+				return nil, fmt.Errorf("%s is not installed; run 'bifrost install' first", name)
+			}
+			selected = append(selected, *locked)
+		}
+	}
+
+	var matches []Match
+	for _, locked := range selected {
+		installPath := i.config.LocalPackagePath(locked.Name, locked.Version)
+		found, err := grepPackage(installPath, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search %s@%s: %w", locked.Name, locked.Version, err)
+		}
+		for _, m := range found {
+			m.Package, m.Version = locked.Name, locked.Version
+			m.File = filepath.Join(installPath, filepath.FromSlash(m.Path))
+			matches = append(matches, m)
+		}
+	}
+	return matches, nil
+}
+
+// grepPackage returns the lines matching pattern in the package installed
+// at installPath, which may be a link to the user package directory
+func grepPackage(installPath string, pattern *regexp.Regexp) ([]Match, error) {
+	root, err := filepath.EvalSymlinks(installPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("not installed at %s; run 'bifrost install'", installPath)
+		}
+		return nil, err
+	}
+
+	var matches []Match
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxGrepFileSize {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// Binary files have NUL bytes near the start, text files none
+		if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		for n, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSuffix(line, "\r")
+			if pattern.MatchString(line) {
+				matches = append(matches, Match{Path: filepath.ToSlash(rel), Line: n + 1, Text: line})
+			}
+		}
+		return nil
+	})
+	return matches, err
+}
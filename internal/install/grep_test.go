@@ -0,0 +1,65 @@
+package install
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+)
+
+func TestInstaller_Grep(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0"})
+	archive, err := registrytest.Archive(map[string]string{
+		"src/main.crl":   "import json-utils\n\nfunc get(url):\n    return fetch(url)\r\n",
+		"src/.hidden":    "fetch",
+		"assets/img.bin": "fetch\x00\x01",
+	})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "http-client", Version: "2.0.0", Dependencies: map[string]string{"json-utils": "^1.0.0"}}, archive)
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\nhttp-client = \"2.0.0\"\n"), 0644)
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+
+	matches, err := installer.Grep(manifestPath, regexp.MustCompile(`fetch\(`))
+	if err != nil {
+		t.Fatalf("Grep() error = %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("Grep() = %+v, want one match", matches)
+	}
+	m := matches[0]
+	if m.Package != "http-client" || m.Path != "src/main.crl" || m.Line != 4 || m.Text != "    return fetch(url)" {
+		t.Errorf("Grep() match = %+v", m)
+	}
+	if want := filepath.Join(cfg.LocalPackagePath("http-client", "2.0.0"), "src", "main.crl"); m.File != want {
+		t.Errorf("Grep() file = %s, want %s", m.File, want)
+	}
+
+	// Naming a package searches only it
+	matches, err = installer.Grep(manifestPath, regexp.MustCompile(`json-utils`), "json-utils")
+	if err != nil {
+		t.Fatalf("Grep() error = %v", err)
+	}
+	if len(matches) != 1 || matches[0].Package != "json-utils" {
+		t.Errorf("Grep() of json-utils = %+v", matches)
+	}
+
+	if _, err := installer.Grep(manifestPath, regexp.MustCompile(`x`), "yaml"); err == nil {
+		t.Error("Grep() of a package that is not installed succeeded")
+	}
+}
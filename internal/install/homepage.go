@@ -0,0 +1,60 @@
+package install
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/manifest"
+	"github.com/javanhut/bifrost/internal/registry"
+)
+
+// ProjectURL returns the repository of a package, or its homepage when it
+// declares no repository. Without a version, a dependency locked for the
+// manifest at manifestPath is looked up in its installed Bifrost.toml first;
+// otherwise the registry is asked about version, or the latest one.
+func (i *Installer) ProjectURL(manifestPath, name, version string) (string, error) {
+	registryName := name
+	if version == "" {
+		lock, err := lockfile.LoadIfExists(i.lockPath(manifestPath))
+		if err != nil {
+			return "", fmt.Errorf("failed to load lockfile: %w", err)
+		}
+		var locked *lockfile.Package
+		if lock != nil {
+			locked = lock.Find(name)
+		}
+		if locked != nil {
+			version = locked.Version
+			if locked.PackageName != "" {
+				registryName = locked.PackageName
+			}
+			path := filepath.Join(i.config.LocalPackagePath(name, locked.Version), manifest.FileName)
+			if m, err := manifest.Load(path); err == nil {
+				if url := cmp.Or(m.Package.Repository, m.Package.Homepage); url != "" {
+					return url, nil
+				}
+			}
+		}
+	}
+
+	client, err := i.clientFor(i.registryClient(), registryName)
+	if err != nil {
+		return "", err
+	}
+	var info *registry.PackageInfo
+	if version == "" {
+		info, err = client.GetPackageLatest(registryName)
+	} else {
+		info, err = client.GetPackageInfo(registryName, version)
+	}
+	if err != nil {
+		return "", err
+	}
+	url := cmp.Or(info.Repository, info.Homepage)
+	if url == "" {
+		return "", fmt.Errorf("%s@%s declares no repository or homepage", registryName, info.Version)
+	}
+	return url, nil
+}
@@ -0,0 +1,61 @@
+package install
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+)
+
+func TestInstaller_ProjectURL(t *testing.T) {
+	reg := registrytest.New()
+	for _, v := range []string{"1.0.0", "1.1.0"} {
+		archive, err := registrytest.Archive(map[string]string{
+			"src/main.crl": "# json-utils",
+			"Bifrost.toml": "[package]\nname = \"json-utils\"\nversion = \"" + v + "\"\nrepository = \"https://git.example.com/json-utils\"\n",
+		})
+		if err != nil {
+			t.Fatalf("failed to build archive: %v", err)
+		}
+		reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: v, Homepage: "https://json-utils.example.com/" + v}, archive)
+	}
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\njson-utils = \"~1.0.0\"\n"), 0644)
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+
+	tests := []struct {
+		name, version string
+		want          string
+		wantErr       bool
+	}{
+		// The installed manifest's repository
+		{name: "json-utils", want: "https://git.example.com/json-utils"},
+		// The registry's homepage, as the registry has no repository
+		{name: "json-utils", version: "1.1.0", want: "https://json-utils.example.com/1.1.0"},
+		{name: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := installer.ProjectURL(manifestPath, tt.name, tt.version)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ProjectURL(%q, %q) = %q, %v, want %q", tt.name, tt.version, got, err, tt.want)
+		}
+	}
+
+	// Without an installed manifest the locked version is asked for
+	os.RemoveAll(cfg.LocalPackagePath("json-utils", "1.0.0"))
+	if got, err := installer.ProjectURL(manifestPath, "json-utils", ""); err != nil || got != "https://json-utils.example.com/1.0.0" {
+		t.Errorf("ProjectURL() without the installed package = %q, %v", got, err)
+	}
+}
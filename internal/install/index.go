@@ -0,0 +1,228 @@
+package install
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/errcode"
+	"github.com/javanhut/bifrost/internal/locksign"
+	"github.com/javanhut/bifrost/internal/registry"
+	ver "github.com/javanhut/bifrost/internal/version"
+	"github.com/javanhut/bifrost/internal/warn"
+)
+
+// packageIndex is the index of a registry, synced once per install
+type packageIndex struct {
+	entries map[string]registry.IndexEntry
+	key     ed25519.PublicKey
+	err     error
+}
+
+// indexChecksum returns the checksum the package index of the registry
+// client talks to lists for name@version, empty when the registry has no
+// index configured or the index does not list the version. The index is the
+// registry's own record, so a checksum from it is trusted over metadata and
+// archives served by the hosts packages are downloaded from.
+func (i *Installer) indexChecksum(client *registry.Client, name, version string) (string, error) {
+	index, err := i.packageIndex(client)
+	if err != nil || index == nil {
+		return "", err
+	}
+	entry, ok := index.entries[name]
+	if !ok {
+		return "", nil
+	}
+	checksum, err := entry.Checksum(version, index.key)
+	if err != nil {
+		return "", errcode.ChecksumMismatch.Errorf("%v", err)
+	}
+	return checksum, nil
+}
+
+// indexSigned reports whether the package index of the registry client
+// talks to lists a checksum for name@version signed with its index key,
+// which require_signatures takes as the package's verified signature
+func (i *Installer) indexSigned(client *registry.Client, name, version string) (bool, error) {
+	index, err := i.packageIndex(client)
+	if err != nil || index == nil || index.key == nil {
+		return false, err
+	}
+	checksum, err := i.indexChecksum(client, name, version)
+	return checksum != "", err
+}
+
+// packageIndex returns the index of the registry client talks to, syncing
+// the local copy the first time, or nil when the registry has none
+// configured. When the index cannot be reached, the local copy is used.
+func (i *Installer) packageIndex(client *registry.Client) (*packageIndex, error) {
+	registryConfig, err := i.config.IndexFor(client.BaseURL())
+	if err != nil || registryConfig == nil {
+		return nil, err
+	}
+
+	i.indexMu.Lock()
+	defer i.indexMu.Unlock()
+	if index, ok := i.indexes[registryConfig.Index]; ok {
+		return index, index.err
+	}
+	index := &packageIndex{}
+	if registryConfig.IndexKey != "" {
+		if index.key, err = locksign.ParsePublicKey(registryConfig.IndexKey); err != nil {
+			index.err = fmt.Errorf("index key of %s: %w", client.BaseURL(), err)
+		}
+	}
+	if index.err == nil {
+		local, err := i.syncIndex(client, registryConfig.Index)
+		if err != nil {
+			index.err = err
+		} else {
+			index.entries = local.Entries()
+		}
+	}
+	if i.indexes == nil {
+		i.indexes = make(map[string]*packageIndex)
+	}
+	i.indexes[registryConfig.Index] = index
+	return index, index.err
+}
+
+// syncIndex brings the local copy of the index at url up to date and
+// returns it. Without a connection the local copy is returned as it is.
+func (i *Installer) syncIndex(client *registry.Client, url string) (*registry.LocalIndex, error) {
+	path := i.localIndexPath(url)
+	local, _ := registry.LoadLocalIndex(path)
+	updated, _, err := client.SyncIndex(url, local)
+	if err != nil {
+		if local != nil && local.URL == url {
+			warn.Printf(warn.Network, "failed to update package index %s, using the copy from %s: %v", url, local.UpdatedAt.Local().Format("2006-01-02 15:04"), err)
+			return local, nil
+		}
+		return nil, fmt.Errorf("failed to fetch package index %s: %w", url, err)
+	}
+	// The copy only saves downloads, so failing to keep it is not an error
+	updated.Save(path)
+	return updated, nil
+}
+
+// localIndexPath returns where the local copy of the index at url is kept
+func (i *Installer) localIndexPath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(i.config.RegistryDir, "index", hex.EncodeToString(sum[:8])+".json")
+}
+
+// indexURL returns the URL of the index of a configured registry: the one
+// configured for it, or the default index path on the registry
+func (i *Installer) indexURL(r config.NamedRegistry) string {
+	if r.Index != "" {
+		return r.Index
+	}
+	baseURL := r.URL
+	if baseURL == "" {
+		baseURL = i.config.EffectiveRegistryURL()
+	}
+	return strings.TrimRight(baseURL, "/") + registry.DefaultIndexPath
+}
+
+// IndexSync is the result of updating the local copy of a registry's index
+type IndexSync struct {
+	Registry string `json:"registry"`
+	URL      string `json:"url"`
+	// Updated is set when the index changed since the last update
+	Updated   bool      `json:"updated"`
+	Packages  int       `json:"packages"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// UpdateIndexes updates the local copies of the indexes of every configured
+// registry, downloading only those that changed. A registry that fails is
+// reported in its result rather than stopping the others.
+func (i *Installer) UpdateIndexes() ([]IndexSync, error) {
+	registries, err := i.config.GetRegistries()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load registries: %w", err)
+	}
+	var results []IndexSync
+	for _, r := range registries {
+		client := i.registryClient()
+		if r.Name != config.DefaultRegistryName {
+			client = newRegistryClient(&r.RegistryConfig)
+		}
+		url := i.indexURL(r)
+		result := IndexSync{Registry: r.Name, URL: url}
+
+		path := i.localIndexPath(url)
+		local, _ := registry.LoadLocalIndex(path)
+		updated, changed, err := client.SyncIndex(url, local)
+		if err == nil {
+			err = updated.Save(path)
+		}
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Updated = changed
+			result.Packages = len(updated.Packages)
+			result.UpdatedAt = updated.UpdatedAt
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// IndexMatch is a package found in the local copy of a registry's index
+type IndexMatch struct {
+	Name     string `json:"name"`
+	Latest   string `json:"latest"`
+	Versions int    `json:"versions"`
+	Registry string `json:"registry"`
+}
+
+// SearchIndexes looks for packages whose name contains query in the local
+// copies of the indexes of every configured registry, without going online.
+// Registries whose index was never updated are returned separately.
+func (i *Installer) SearchIndexes(query string) (matches []IndexMatch, missing []string, err error) {
+	registries, err := i.config.GetRegistries()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load registries: %w", err)
+	}
+	query = strings.ToLower(query)
+	for _, r := range registries {
+		local, err := registry.LoadLocalIndex(i.localIndexPath(i.indexURL(r)))
+		if err != nil {
+			return nil, nil, err
+		}
+		if local == nil {
+			missing = append(missing, r.Name)
+			continue
+		}
+		for _, e := range local.Packages {
+			if strings.Contains(strings.ToLower(e.Name), query) {
+				matches = append(matches, IndexMatch{Name: e.Name, Latest: newestIndexed(e.Versions), Versions: len(e.Versions), Registry: r.Name})
+			}
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].Name < matches[b].Name })
+	return matches, missing, nil
+}
+
+// newestIndexed returns the newest of versions, ignoring any that do not
+// parse
+func newestIndexed(versions []string) string {
+	var newest *ver.Version
+	for _, s := range versions {
+		if v, err := ver.Parse(s); err == nil && (newest == nil || v.Compare(newest) > 0) {
+			newest = v
+		}
+	}
+	if newest == nil {
+		return ""
+	}
+	return newest.String()
+}
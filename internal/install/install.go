@@ -2,24 +2,105 @@ package install
 
 import (
 	"archive/tar"
-	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/javanhut/bifrost/internal/archive"
 	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/errcode"
+	"github.com/javanhut/bifrost/internal/freeze"
+	"github.com/javanhut/bifrost/internal/journal"
+	"github.com/javanhut/bifrost/internal/link"
+	"github.com/javanhut/bifrost/internal/lockfile"
 	"github.com/javanhut/bifrost/internal/manifest"
+	"github.com/javanhut/bifrost/internal/policy"
+	"github.com/javanhut/bifrost/internal/refs"
 	"github.com/javanhut/bifrost/internal/registry"
 	"github.com/javanhut/bifrost/internal/resolver"
+	"github.com/javanhut/bifrost/internal/tlog"
 	ver "github.com/javanhut/bifrost/internal/version"
+	"github.com/javanhut/bifrost/internal/warn"
 )
 
 type Installer struct {
 	config *config.Config
+	client *registry.Client
+	out    io.Writer
+	report *Report
+	// keepGoing continues a manifest install past failed packages
+	keepGoing bool
+	// project is the directory of the project installing global packages,
+	// empty outside a project
+	project string
+
+	// maxDownloads is how many archives are downloaded at once, and limiter
+	// caps their combined rate when set
+	maxDownloads int
+	limiter      *registry.RateLimiter
+	// strict refuses packages with install scripts unless allowScripts is
+	// set
+	strict       bool
+	allowScripts bool
+	// scriptPrompt asks whether a package may run its install scripts in
+	// strict mode, nil where nobody can be asked. Answers are remembered
+	// in the trust file.
+	scriptPrompt ScriptPrompt
+	// scriptTimeout stops install scripts running longer, zero for no
+	// limit
+	scriptTimeout time.Duration
+	// tlog is the transparency log archives must be recorded in, nil for
+	// none
+	tlog *tlog.Client
+	// scanner is the command every archive is scanned with before it is
+	// extracted, empty for none
+	scanner string
+	// withDocs extracts the README and docs directory of packages
+	withDocs bool
+	// asOf limits resolution to versions published by then, when set
+	asOf time.Time
+	// target is the platform prebuilt archives are installed for, empty
+	// for the current one
+	target string
+	// events receives install progress instead of the text output when set
+	events EventHandler
+	// policy holds the organization rules installs must follow, nil for
+	// none
+	policy *policy.Policy
+	// dirMode and fileMode are the permissions extracted packages get
+	dirMode  os.FileMode
+	fileMode os.FileMode
+	// overrides substitutes dependencies of manifest installs, by name
+	overrides map[string]Override
+	// prefetched holds archives downloaded ahead of a manifest install
+	prefetched map[string]*fetched
+	// carrionVersion is the version of the Carrion interpreter packages
+	// must run on, detected once carrionOnce runs, and
+	// ignoreCarrionVersion installs packages requiring another one anyway
+	carrionVersion       string
+	carrionOnce          sync.Once
+	ignoreCarrionVersion bool
+	// scopeClients are the clients of the registries scoped packages are
+	// routed to, by scope
+	scopeClients map[string]*registry.Client
+	// indexes holds the package indexes of registries by URL, synced
+	// once per install, and indexMu guards it
+	indexes map[string]*packageIndex
+	indexMu sync.Mutex
+	// mu guards out, report and scopeClients while downloads run in
+	// parallel
+	mu sync.Mutex
 }
 
 // getAPIURL extracts the API URL from the registry URL
@@ -33,18 +114,81 @@ func getAPIURL(registryURL string) string {
 
 func New(cfg *config.Config) *Installer {
 	return &Installer{
-		config: cfg,
+		config:        cfg,
+		out:           os.Stdout,
+		report:        newReport(),
+		maxDownloads:  DefaultMaxConcurrentDownloads,
+		dirMode:       DefaultDirMode,
+		fileMode:      DefaultFileMode,
+		scriptTimeout: DefaultScriptTimeout,
 	}
 }
 
+// SetOutput redirects progress messages, which go to stdout by default
+func (i *Installer) SetOutput(w io.Writer) {
+	i.out = w
+}
+
+// SetKeepGoing controls what InstallManifest does when a package fails to
+// install. By default the packages it installed so far are removed again and
+// the lockfile is left as it was; with keepGoing set the remaining packages
+// are still installed and the failures are reported at the end.
+func (i *Installer) SetKeepGoing(keepGoing bool) {
+	i.keepGoing = keepGoing
+}
+
+// SetPolicy makes installs follow the rules of an organization policy:
+// packages from registries it does not allow, blocked versions and, where it
+// forbids them, install scripts are refused
+func (i *Installer) SetPolicy(p *policy.Policy) {
+	i.policy = p
+}
+
+// SetProject sets the project recorded as using the packages it installs
+// globally, so uninstalling them elsewhere keeps them while it needs them
+func (i *Installer) SetProject(dir string) {
+	i.project = dir
+}
+
+// Report returns the summary of the most recent InstallPackageByName or
+// InstallManifest call
+func (i *Installer) Report() *Report {
+	return i.report
+}
+
+// SetClient makes the installer use client for all registry access instead of
+// a client created from the configured registry URL
+func (i *Installer) SetClient(client *registry.Client) {
+	i.client = client
+}
+
+// recoverInterrupted cleans up installs and uninstalls that a crash left
+// half done, before starting a new one
+func (i *Installer) recoverInterrupted() error {
+	recovered, err := journal.Open(i.config.JournalPath()).Recover()
+	if err != nil {
+		return fmt.Errorf("failed to recover interrupted operations: %w", err)
+	}
+	for _, e := range recovered {
+		fmt.Fprintf(i.out, "Cleaned up interrupted %s of %s\n", e.Op, strings.Join(e.Paths, ", "))
+	}
+	return nil
+}
+
+// registryClient returns the client used to talk to the registry
+func (i *Installer) registryClient() *registry.Client {
+	if i.client != nil {
+		return i.client
+	}
+	return registry.NewClient(i.config.EffectiveRegistryURL())
+}
+
 func (i *Installer) Install(resolution *resolver.Resolution) error {
 	// Get installation order
 	packages := resolution.GetResolutionOrder()
 
 	for _, pkg := range packages {
-		fmt.Printf("Installing %s@%s...\n", pkg.Name, pkg.Version)
-
-		if err := i.installPackage(pkg); err != nil {
+		if _, err := i.installPackage(pkg); err != nil {
 			return fmt.Errorf("failed to install %s: %w", pkg.Name, err)
 		}
 	}
@@ -52,49 +196,55 @@ func (i *Installer) Install(resolution *resolver.Resolution) error {
 	return nil
 }
 
-func (i *Installer) installPackage(pkg *resolver.Package) error {
+// installPackage installs pkg into the user package directory, returning
+// the archive's checksum. The checksum is empty when the package was already
+// installed.
+func (i *Installer) installPackage(pkg *resolver.Package) (string, error) {
 	// Check if already installed (user-specific location)
 	installPath := i.config.PackagePath(pkg.Name, pkg.Version.String())
 	if _, err := os.Stat(installPath); err == nil {
-		fmt.Printf("  Already installed at %s\n", installPath)
-		return nil
+		i.emit(Event{Kind: EventUpToDate, Package: pkg.Name, Version: pkg.Version.String(), Path: installPath})
+		i.recordInstalled(i.registryClient(), pkg, "", installPath, EventUpToDate)
+		return "", nil
+	}
+	if err := i.config.CheckStoreWrite(); err != nil {
+		return "", err
 	}
 
-	// Download from registry
-	client := registry.NewClient(i.config.RegistryURL)
-
-	// Get package info to get download URL
-	_, err := client.GetPackageInfo(pkg.Name, pkg.Version.String())
+	archivePath, checksum, err := i.fetchArchive(i.registryClient(), pkg)
 	if err != nil {
-		return fmt.Errorf("failed to get package info: %w", err)
+		return "", err
+	}
+	if err := i.scanArchive(archivePath, pkg); err != nil {
+		return "", err
 	}
 
-	// Download package archive
-	archivePath := i.config.CachePath(fmt.Sprintf("%s-%s.tar.gz", pkg.Name, pkg.Version.String()))
-	
-	fmt.Printf("  Downloading %s@%s...\n", pkg.Name, pkg.Version.String())
-	reader, err := client.DownloadPackage(pkg.Name, pkg.Version.String())
+	txn, err := journal.Open(i.config.JournalPath()).Begin(journal.OpInstall, installPath)
 	if err != nil {
-		return fmt.Errorf("failed to download package: %w", err)
-	}
-	defer reader.Close()
-	
-	// Save to file
-	if err := i.saveToFile(reader, archivePath); err != nil {
-		return fmt.Errorf("failed to save package: %w", err)
+		return "", err
 	}
 
 	// Install from archive
-	fmt.Printf("  Extracting to %s...\n", installPath)
-	if err := i.InstallFromArchive(archivePath, pkg); err != nil {
-		return fmt.Errorf("failed to install from archive: %w", err)
+	i.emit(Event{Kind: EventExtracting, Package: pkg.Name, Version: pkg.Version.String(), Path: installPath})
+	err = i.InstallFromArchive(archivePath, pkg)
+	if err == nil {
+		err = i.verifyEmbeddedManifest(installPath, pkg)
+	}
+	if err == nil {
+		err = i.runInstallScripts(installPath, pkg)
+	}
+	if err != nil {
+		removeInstalled(installPath)
+		txn.Commit()
+		return "", fmt.Errorf("failed to install from archive: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return "", err
 	}
 
-	// Clean up archive after successful installation
-	os.Remove(archivePath)
-
-	fmt.Printf("  Successfully installed %s@%s\n", pkg.Name, pkg.Version.String())
-	return nil
+	i.emit(Event{Kind: EventInstalled, Package: pkg.Name, Version: pkg.Version.String(), Path: installPath})
+	i.recordInstalled(i.registryClient(), pkg, checksum, installPath, EventInstalled)
+	return checksum, nil
 }
 
 // InstallGlobal installs a package to the shared global location
@@ -104,25 +254,39 @@ func (i *Installer) InstallGlobal(pkg *resolver.Package, sourcePath string) erro
 
 	// Check if already installed globally
 	if _, err := os.Stat(installPath); err == nil {
-		fmt.Printf("Package %s@%s already installed globally at %s\n",
-			pkg.Name, pkg.Version.String(), installPath)
+		i.emit(Event{Kind: EventUpToDate, Package: pkg.Name, Version: pkg.Version.String(), Path: installPath})
 		return nil
 	}
 
+	txn, err := journal.Open(i.config.JournalPath()).Begin(journal.OpInstall, installPath)
+	if err != nil {
+		return err
+	}
+
 	// Create target directory (may require sudo)
 	if err := os.MkdirAll(installPath, 0755); err != nil {
+		txn.Commit()
 		return fmt.Errorf("failed to create global install directory %s (may need sudo): %w",
 			installPath, err)
 	}
 
 	// Copy package files to global location
+	i.emit(Event{Kind: EventExtracting, Package: pkg.Name, Version: pkg.Version.String(), Path: installPath})
 	if err := i.copyDirectory(sourcePath, installPath); err != nil {
+		removeInstalled(installPath)
+		txn.Commit()
 		return fmt.Errorf("failed to copy package to global location: %w", err)
 	}
+	if err := i.normalizePermissions(installPath, true); err != nil {
+		removeInstalled(installPath)
+		txn.Commit()
+		return fmt.Errorf("failed to set permissions of %s: %w", installPath, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return err
+	}
 
-	fmt.Printf("Package %s@%s installed globally at %s\n",
-		pkg.Name, pkg.Version.String(), installPath)
-
+	i.emit(Event{Kind: EventInstalled, Package: pkg.Name, Version: pkg.Version.String(), Path: installPath})
 	return nil
 }
 
@@ -149,7 +313,7 @@ func (i *Installer) copyDirectory(src, dst string) error {
 	})
 }
 
-// copyFile copies a single file
+// copyFile copies a single file, keeping its permissions
 func (i *Installer) copyFile(src, dst string) error {
 	srcFile, err := os.Open(src)
 	if err != nil {
@@ -157,7 +321,11 @@ func (i *Installer) copyFile(src, dst string) error {
 	}
 	defer srcFile.Close()
 
-	dstFile, err := os.Create(dst)
+	info, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+	dstFile, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
 	if err != nil {
 		return err
 	}
@@ -178,14 +346,14 @@ func (i *Installer) InstallLocal(manifestPath string) error {
 	packageDir := filepath.Dir(manifestPath)
 
 	// Create local modules directory
-	modulesDir := filepath.Join(packageDir, i.config.LocalModulesPath())
+	modulesDir := i.config.ProjectModulesDir(packageDir)
 	if err := os.MkdirAll(modulesDir, 0755); err != nil {
 		return fmt.Errorf("failed to create modules directory: %w", err)
 	}
 
 	// This is a no-op for local development
-	fmt.Printf("Local package %s is ready for development\n", m.Package.Name)
-	fmt.Printf("Import path: %s\n", m.Package.Name)
+	fmt.Fprintf(i.out, "Local package %s is ready for development\n", m.Package.Name)
+	fmt.Fprintf(i.out, "Import path: %s\n", m.Package.Name)
 
 	return nil
 }
@@ -205,21 +373,25 @@ func (i *Installer) InstallFromArchive(archivePath string, pkg *resolver.Package
 	defer file.Close()
 
 	// Extract based on file extension
-	if strings.HasSuffix(archivePath, ".tar.gz") || strings.HasSuffix(archivePath, ".tgz") {
-		return i.extractTarGz(file, installPath)
+	if _, ok := archive.FormatOf(archivePath); !ok {
+		return fmt.Errorf("unsupported archive format")
 	}
-
-	return fmt.Errorf("unsupported archive format")
+	if err := i.extractTarball(file, installPath); err != nil {
+		return err
+	}
+	return i.normalizePermissions(installPath, false)
 }
 
-func (i *Installer) extractTarGz(r io.Reader, destDir string) error {
-	gzr, err := gzip.NewReader(r)
+// extractTarball extracts a gzip or zstd compressed tarball into destDir
+func (i *Installer) extractTarball(r io.Reader, destDir string) error {
+	gzr, err := archive.NewReader(r)
 	if err != nil {
 		return err
 	}
 	defer gzr.Close()
 
 	tr := tar.NewReader(gzr)
+	names := archive.NewNames()
 
 	for {
 		header, err := tr.Next()
@@ -230,7 +402,17 @@ func (i *Installer) extractTarGz(r io.Reader, destDir string) error {
 			return err
 		}
 
-		target := filepath.Join(destDir, header.Name)
+		if header.Name == "./" || header.Name == "." {
+			continue
+		}
+		name, err := names.Add(header.Name)
+		if err != nil {
+			return errcode.UnsafeArchive.Errorf("refusing to extract archive: %w", err)
+		}
+		if !i.withDocs && isDocPath(name) {
+			continue
+		}
+		target := filepath.Join(destDir, filepath.FromSlash(name))
 
 		switch header.Typeflag {
 		case tar.TypeDir:
@@ -268,7 +450,7 @@ func (i *Installer) Download(url string, destPath string) error {
 	}
 
 	// Download file
-	resp, err := http.Get(url)
+	resp, err := registry.HTTPClient(registry.OperationDownload).Get(url)
 	if err != nil {
 		return err
 	}
@@ -286,202 +468,1054 @@ func (i *Installer) Download(url string, destPath string) error {
 	defer out.Close()
 
 	// Copy contents
-	_, err = io.Copy(out, resp.Body)
+	_, err = io.Copy(out, i.limiter.Reader(resp.Body))
 	return err
 }
 
-func (i *Installer) saveToFile(reader io.Reader, destPath string) error {
-	// Create destination directory
-	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+// CreateSymlinks links pkg's copy in the user package directory into the
+// project modules directory, replacing whatever was installed there. Where
+// symlinks cannot be created the package is copied instead, and the copy is
+// refreshed by later installs when the original changes.
+func (i *Installer) CreateSymlinks(pkg *resolver.Package) error {
+	installPath := i.config.PackagePath(pkg.Name, pkg.Version.String())
+	linkPath := i.config.LocalPackagePath(pkg.Name, pkg.Version.String())
+
+	copied, err := link.Create(installPath, linkPath)
+	if err != nil {
 		return err
 	}
+	if copied {
+		fmt.Fprintf(i.out, "Symlinks are unavailable here, copied %s instead\n", linkPath)
+	}
+	return nil
+}
 
-	// Create file
-	out, err := os.Create(destPath)
+// recordLink records pkg in the project lockfile as linked from the user
+// package directory, so uninstall knows to remove the link. The link to a
+// previously recorded version is removed.
+func (i *Installer) recordLink(pkg *resolver.Package, checksum string) error {
+	lockPath := filepath.Join(i.project, lockfile.FileNameFor(i.config.Profile))
+	lock, err := lockfile.LoadIfExists(lockPath)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to load lockfile: %w", err)
+	}
+	if lock == nil {
+		lock = lockfile.New()
 	}
-	defer out.Close()
 
-	// Copy contents
-	_, err = io.Copy(out, reader)
-	return err
+	if len(pkg.Artifacts) > 0 {
+		checksum = pkg.Checksum
+	}
+	if locked := lock.Find(pkg.Name); locked != nil {
+		switch {
+		case locked.Version == pkg.Version.String():
+			// Keep the recorded checksum when the package was already installed
+			if checksum == "" {
+				checksum = locked.Checksum
+			}
+		case locked.Scope == lockfile.ScopeUser && i.config.Layout != config.LayoutFlat:
+			if err := removeInstalled(i.config.LocalPackagePath(pkg.Name, locked.Version)); err != nil {
+				return fmt.Errorf("failed to remove link to %s@%s: %w", pkg.Name, locked.Version, err)
+			}
+		}
+	}
+	lock.Set(lockfile.Package{
+		Name:         pkg.Name,
+		PackageName:  pkg.PackageName,
+		Version:      pkg.Version.String(),
+		Source:       i.sourceURL(i.registryClient(), pkg.RegistryName()),
+		Checksum:     checksum,
+		Format:       pkg.Format,
+		Dependencies: sortedKeys(pkg.Dependencies),
+		Scope:        lockfile.ScopeUser,
+		Artifacts:    pkg.Artifacts,
+	})
+	if err := lock.Save(lockPath); err != nil {
+		return fmt.Errorf("failed to write lockfile: %w", err)
+	}
+	return i.signLock(lockPath)
 }
 
-func (i *Installer) CreateSymlinks(pkg *resolver.Package) error {
-	// Create symlink in local modules directory for easy imports
-	installPath := i.config.PackagePath(pkg.Name, pkg.Version.String())
-	linkPath := filepath.Join(i.config.LocalModulesPath(), pkg.Name)
+func (i *Installer) InstallPackageByName(packageName string, version string, global bool) error {
+	// For local installation, use the local package installation method
+	if !global {
+		return i.InstallPackageLocalByName(packageName, version)
+	}
 
-	// Remove existing link if present
-	os.Remove(linkPath)
+	i.report = newReport()
+	defer i.finish()
 
-	// Create parent directory
-	if err := os.MkdirAll(filepath.Dir(linkPath), 0755); err != nil {
+	if err := i.recoverInterrupted(); err != nil {
 		return err
 	}
+	client := i.registryClient()
 
-	// Create symlink
-	return os.Symlink(installPath, linkPath)
+	// Resolve the concrete version before touching the filesystem
+	i.emit(Event{Kind: EventResolving, Package: packageName})
+	pkg, err := i.resolvePackage(client, packageName, version)
+	if err != nil {
+		return err
+	}
+	reference := i.project
+	if reference == "" {
+		reference = refs.Explicit
+	}
+	return i.installShared(client, pkg, reference)
 }
 
-func (i *Installer) InstallPackageByName(packageName string, version string, global bool) error {
-	// For local installation, use the local package installation method
-	if !global {
-		return i.InstallPackageLocalByName(packageName, version)
+// installShared downloads pkg and installs it into the shared global
+// package directory, recording reference as a user of it
+func (i *Installer) installShared(client *registry.Client, pkg *resolver.Package, reference string) error {
+	if err := i.config.CheckStoreWrite(); err != nil {
+		return err
+	}
+
+	// For global install, we need to download first then install globally
+	archivePath, checksum, err := i.fetchArchive(client, pkg)
+	if err != nil {
+		return err
+	}
+	if err := i.scanArchive(archivePath, pkg); err != nil {
+		return err
 	}
-	
-	// Continue with existing global installation logic
-	client := registry.NewClient(i.config.RegistryURL)
 
-	// If no version specified, get latest
-	if version == "" {
-		version = "latest"
+	// Extract to temp location
+	tempDir := i.config.CachePath(fmt.Sprintf("%s-%s-temp", pkg.Name, pkg.Version.String()))
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return err
 	}
+	defer os.RemoveAll(tempDir)
 
-	// Get package info
-	pkgInfo, err := client.GetPackageInfo(packageName, version)
+	// Open archive file
+	archiveFile, err := os.Open(archivePath)
 	if err != nil {
-		return fmt.Errorf("failed to get package info: %w", err)
+		return fmt.Errorf("failed to open archive: %w", err)
 	}
+	defer archiveFile.Close()
 
-	// Create a Package struct for installation
-	pkg := &resolver.Package{
-		Name: pkgInfo.Name,
-		Version: &ver.Version{
-			Major: 0,
-			Minor: 0,
-			Patch: 1,
-		},
+	if err := i.extractTarball(archiveFile, tempDir); err != nil {
+		return fmt.Errorf("failed to extract package: %w", err)
+	}
+	if err := i.verifyEmbeddedManifest(tempDir, pkg); err != nil {
+		return err
+	}
+
+	// Install globally, recording who uses the package so another project
+	// uninstalling it leaves it in place
+	sharedDir := i.config.GetSharedGlobalPackagesDir()
+	if err := os.MkdirAll(sharedDir, 0755); err != nil {
+		return fmt.Errorf("failed to create global install directory %s (may need sudo): %w", sharedDir, err)
 	}
 
-	// Parse actual version if not "latest"
-	if version != "latest" && pkgInfo.Version != "" {
-		if v, err := ver.Parse(pkgInfo.Version); err == nil {
-			pkg.Version = v
+	// Scripts run before the package is copied, so what they generate is
+	// installed with it
+	_, statErr := os.Stat(filepath.Join(sharedDir, pkg.Name, pkg.Version.String()))
+	if statErr != nil {
+		if err := i.runInstallScripts(tempDir, pkg); err != nil {
+			return err
+		}
+	}
+	err = refs.Update(filepath.Join(sharedDir, refs.FileName), func(r *refs.Refs) error {
+		if err := i.InstallGlobal(pkg, tempDir); err != nil {
+			return err
 		}
+		r.Add(pkg.Name, pkg.Version.String(), reference)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	globalPath := filepath.Join(sharedDir, pkg.Name, pkg.Version.String())
+	if statErr == nil {
+		i.report.Unchanged++
+		i.recordInstalled(client, pkg, checksum, globalPath, EventUpToDate)
+	} else {
+		i.report.Added = append(i.report.Added, Change{Name: pkg.Name, Version: pkg.Version.String()})
+		i.recordInstalled(client, pkg, checksum, globalPath, EventInstalled)
 	}
+	return nil
+}
 
-	if global {
-		// For global install, we need to download first then install globally
-		archivePath := i.config.CachePath(fmt.Sprintf("%s-%s.tar.gz", pkg.Name, pkg.Version.String()))
+// InstallPackageLocalByName installs a package to the local project directory
+func (i *Installer) InstallPackageLocalByName(packageName string, version string) error {
+	i.report = newReport()
+	defer i.finish()
 
-		fmt.Printf("Downloading %s@%s...\n", pkg.Name, pkgInfo.Version)
-		reader, err := client.DownloadPackage(pkg.Name, pkgInfo.Version)
+	if err := i.recoverInterrupted(); err != nil {
+		return err
+	}
+	client := i.registryClient()
+
+	// Resolve the concrete version before touching the filesystem
+	i.emit(Event{Kind: EventResolving, Package: packageName})
+	pkg, err := i.resolvePackage(client, packageName, version)
+	if err != nil {
+		return err
+	}
+
+	existed := i.config.LocalPackageInstalled(pkg.Name, pkg.Version.String())
+	if _, err := i.installLocalPackage(client, pkg); err != nil {
+		return err
+	}
+
+	if existed {
+		i.report.Unchanged++
+	} else {
+		i.report.Added = append(i.report.Added, Change{Name: pkg.Name, Version: pkg.Version.String()})
+	}
+	return nil
+}
+
+// PackageRequest is a package to install and the version spec it was
+// requested with, such as "1.2", "^2" or "" for the newest
+type PackageRequest struct {
+	Name    string
+	Version string
+}
+
+// InstallPackagesLocalByName installs several packages into the local
+// project directory. They are resolved together with their dependencies,
+// so a dependency they share is installed at a single version, and their
+// archives are downloaded in parallel.
+func (i *Installer) InstallPackagesLocalByName(requests []PackageRequest) error {
+	i.report = newReport()
+	defer i.finish()
+
+	if err := i.recoverInterrupted(); err != nil {
+		return err
+	}
+	client := i.registryClient()
+
+	m := &manifest.Manifest{Dependencies: make(map[string]string)}
+	for _, req := range requests {
+		if err := manifest.ValidateName(req.Name); err != nil {
+			return err
+		}
+		if _, ok := m.Dependencies[req.Name]; ok {
+			return fmt.Errorf("%s is requested more than once", req.Name)
+		}
+		constraint, err := parseVersionSpec(req.Version)
 		if err != nil {
-			return fmt.Errorf("failed to download package: %w", err)
+			return err
 		}
-		defer reader.Close()
-		
-		// Save to file
-		if err := i.saveToFile(reader, archivePath); err != nil {
-			return fmt.Errorf("failed to save package: %w", err)
+		m.Dependencies[req.Name] = ">=0.0.0"
+		if constraint != nil {
+			m.Dependencies[req.Name] = constraint.String()
 		}
+	}
+
+	i.emit(Event{Kind: EventResolving})
+	resolution, err := i.ResolveManifest(m)
+	if err != nil {
+		return fmt.Errorf("failed to resolve packages: %w", err)
+	}
 
-		// Extract to temp location
-		tempDir := i.config.CachePath(fmt.Sprintf("%s-%s-temp", pkg.Name, pkg.Version.String()))
-		if err := os.MkdirAll(tempDir, 0755); err != nil {
+	order := resolution.GetResolutionOrder()
+	i.prefetch(client, order)
+	defer func() { i.prefetched = nil }()
+
+	var installed []string
+	for _, pkg := range order {
+		installPath := i.config.LocalPackagePath(pkg.Name, pkg.Version.String())
+		existed := i.config.LocalPackageInstalled(pkg.Name, pkg.Version.String())
+		if _, err := i.installLocalPackage(client, pkg); err != nil {
+			if i.keepGoing {
+				i.emit(Event{Kind: EventFailed, Package: pkg.Name, Version: pkg.Version.String(), Err: err})
+				i.report.Failed = append(i.report.Failed, Failure{Name: pkg.Name, Version: pkg.Version.String(), Error: err.Error()})
+				continue
+			}
+			i.rollback(installed)
+			return fmt.Errorf("failed to install %s: %w", pkg.Name, err)
+		}
+		if existed {
+			i.report.Unchanged++
+		} else {
+			installed = append(installed, installPath)
+			i.report.Added = append(i.report.Added, Change{Name: pkg.Name, Version: pkg.Version.String()})
+		}
+	}
+	return i.report.failedError()
+}
+
+// InstallPackageUserByName installs a package into the user package
+// directory. Inside a project the package is also linked into the project
+// modules directory and recorded in the lockfile.
+func (i *Installer) InstallPackageUserByName(packageName string, version string) error {
+	i.report = newReport()
+	defer i.finish()
+
+	if err := i.recoverInterrupted(); err != nil {
+		return err
+	}
+	client := i.registryClient()
+
+	// Resolve the concrete version before touching the filesystem
+	i.emit(Event{Kind: EventResolving, Package: packageName})
+	pkg, err := i.resolvePackage(client, packageName, version)
+	if err != nil {
+		return err
+	}
+
+	_, statErr := os.Stat(i.config.PackagePath(pkg.Name, pkg.Version.String()))
+	checksum, err := i.installPackage(pkg)
+	if err != nil {
+		return err
+	}
+
+	if i.project != "" {
+		if err := i.CreateSymlinks(pkg); err != nil {
+			return fmt.Errorf("failed to link %s into the project: %w", pkg.Name, err)
+		}
+		if err := i.recordLink(pkg, checksum); err != nil {
 			return err
 		}
-		defer os.RemoveAll(tempDir)
+		i.emit(Event{Kind: EventLinked, Package: pkg.Name, Version: pkg.Version.String(), Path: i.config.LocalPackagePath(pkg.Name, pkg.Version.String())})
+	}
+
+	if statErr == nil {
+		i.report.Unchanged++
+	} else {
+		i.report.Added = append(i.report.Added, Change{Name: pkg.Name, Version: pkg.Version.String()})
+	}
+	return nil
+}
+
+// installLocalPackage fetches pkg's archive and extracts it into the local
+// project modules directory, returning the archive's checksum. The checksum
+// is empty when the package was already installed.
+func (i *Installer) installLocalPackage(client *registry.Client, pkg *resolver.Package) (string, error) {
+	versionStr := pkg.Version.String()
+
+	// Use local installation path
+	installPath := i.config.LocalPackagePath(pkg.Name, versionStr)
+
+	// Check if already installed locally. A directory linked by an
+	// override install is replaced by the package itself.
+	if i.isOverrideLink(pkg, installPath) {
+		if _, err := link.Remove(installPath); err != nil {
+			return "", fmt.Errorf("failed to remove override of %s: %w", pkg.Name, err)
+		}
+	}
+	if i.config.LocalPackageInstalled(pkg.Name, versionStr) && installedPackage(installPath, pkg.Name) != pkg.RegistryName() {
+		// Another profile, or an edited alias, installed another package
+		// under this name and version
+		fmt.Fprintf(i.out, "Replacing %s@%s (package %s)\n", pkg.Name, versionStr, installedPackage(installPath, pkg.Name))
+		if err := os.RemoveAll(installPath); err != nil {
+			return "", fmt.Errorf("failed to remove %s: %w", installPath, err)
+		}
+	}
+	if i.config.LocalPackageInstalled(pkg.Name, versionStr) {
+		// A copy standing in for a link follows the package it copies
+		if _, err := link.Refresh(installPath); err != nil {
+			return "", err
+		}
+		i.emit(Event{Kind: EventUpToDate, Package: pkg.Name, Version: versionStr, Path: installPath})
+		i.recordInstalled(client, pkg, "", installPath, EventUpToDate)
+		return "", nil
+	}
 
-		// Open archive file
-		archiveFile, err := os.Open(archivePath)
+	archivePath, checksum, err := i.fetch(client, pkg)
+	if err != nil {
+		return "", err
+	}
+	if err := i.scanArchive(archivePath, pkg); err != nil {
+		return "", err
+	}
+
+	txn, err := journal.Open(i.config.JournalPath()).Begin(journal.OpInstall, installPath)
+	if err != nil {
+		return "", err
+	}
+
+	// With the flat layout another version may occupy the install path
+	if i.config.Layout == config.LayoutFlat {
+		if previous := config.FlatVersion(installPath); previous != "" {
+			fmt.Fprintf(i.out, "Replacing %s@%s\n", pkg.Name, previous)
+		}
+		if err := os.RemoveAll(installPath); err != nil {
+			txn.Commit()
+			return "", fmt.Errorf("failed to remove previous version: %w", err)
+		}
+	}
+
+	// Install from archive to local directory
+	i.emit(Event{Kind: EventExtracting, Package: pkg.Name, Version: versionStr, Path: installPath})
+	err = i.InstallFromArchiveToLocal(archivePath, pkg, versionStr)
+	if err == nil {
+		err = i.verifyEmbeddedManifest(installPath, pkg)
+	}
+	if err == nil {
+		err = i.runInstallScripts(installPath, pkg)
+	}
+	if err == nil && i.config.Layout == config.LayoutFlat {
+		err = os.WriteFile(filepath.Join(installPath, config.VersionFile), []byte(versionStr+"\n"), 0644)
+	}
+	if err == nil && pkg.RegistryName() != pkg.Name {
+		err = os.WriteFile(filepath.Join(installPath, config.PackageFile), []byte(pkg.RegistryName()+"\n"), 0644)
+	}
+	if err != nil {
+		// Do not leave a partially extracted package behind
+		removeInstalled(installPath)
+		txn.Commit()
+		return "", fmt.Errorf("failed to install from archive: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return "", err
+	}
+
+	i.emit(Event{Kind: EventInstalled, Package: pkg.Name, Version: versionStr, Path: installPath})
+	i.recordInstalled(client, pkg, checksum, installPath, EventInstalled)
+	return checksum, nil
+}
+
+// ResolveManifest resolves the dependencies declared in m against the
+// registry. For every constraint encountered the newest satisfying version is
+// considered, and its own dependencies are followed transitively.
+func (i *Installer) ResolveManifest(m *manifest.Manifest) (*resolver.Resolution, error) {
+	return i.resolveManifest(m, nil)
+}
+
+// resolveManifest is ResolveManifest keeping the versions in lock where
+// lockedSelection allows, so that only dependencies whose constraints
+// changed move
+func (i *Installer) resolveManifest(m *manifest.Manifest, lock *lockfile.Lockfile) (*resolver.Resolution, error) {
+	client := i.registryClient()
+	r := resolver.New()
+
+	// name is the dependency name, which differs from the registry package
+	// for aliases
+	type request struct {
+		name       string
+		pkg        string
+		constraint string
+	}
+
+	m = i.overriddenManifest(m)
+	var queue []request
+	for _, name := range sortedKeys(m.Dependencies) {
+		queue = append(queue, request{name: name, pkg: m.PackageName(name), constraint: m.Dependencies[name]})
+	}
+
+	available := make(map[string][]string)
+	added := make(map[string]bool)
+	// renamed maps the old names of renamed packages to their new ones
+	renamed := make(map[string]string)
+
+	for len(queue) > 0 {
+		req := queue[0]
+		queue = queue[1:]
+
+		// Names end up in paths and URLs, so reject odd ones before asking
+		// the registry about them
+		if err := manifest.ValidateName(req.name); err != nil {
+			return nil, err
+		}
+		if err := manifest.ValidateName(req.pkg); err != nil {
+			return nil, err
+		}
+
+		constraint, err := ver.ParseConstraint(req.constraint)
 		if err != nil {
-			return fmt.Errorf("failed to open archive: %w", err)
+			return nil, fmt.Errorf("invalid constraint for %s: %w", req.name, err)
 		}
-		defer archiveFile.Close()
 
-		if err := i.extractTarGz(archiveFile, tempDir); err != nil {
-			return fmt.Errorf("failed to extract package: %w", err)
+		// A directory overriding the dependency stands in for the registry
+		if pkg, err := i.pathPackage(req.name); pkg != nil || err != nil {
+			if err != nil {
+				return nil, err
+			}
+			if key := req.name + "@" + pkg.Version.String(); !added[key] {
+				added[key] = true
+				deps := i.overrides[req.name].manifest
+				for _, depName := range sortedKeys(deps.Dependencies) {
+					queue = append(queue, request{name: depName, pkg: deps.PackageName(depName), constraint: i.overrideConstraint(depName, deps.Dependencies[depName])})
+				}
+				r.AddPackage(pkg)
+			}
+			continue
 		}
 
-		// Install globally
-		if err := i.InstallGlobal(pkg, tempDir); err != nil {
-			return err
+		// A renamed package keeps its dependency name and is installed as
+		// an alias of the new one
+		if to, ok := renamed[req.pkg]; ok {
+			req.pkg = to
+		}
+		pkgClient, err := i.clientFor(client, req.pkg)
+		if err != nil {
+			return nil, err
+		}
+		versions, ok := available[req.pkg]
+		if !ok {
+			var name string
+			name, pkgClient, versions, err = i.listRenamedVersions(client, pkgClient, req.pkg)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list versions of %s: %w", req.pkg, err)
+			}
+			if name != req.pkg {
+				renamed[req.pkg] = name
+				req.pkg = name
+			}
+			available[req.pkg] = versions
 		}
 
-		// Clean up
-		os.Remove(archivePath)
-	} else {
-		// Regular user-specific install
-		if err := i.installPackage(pkg); err != nil {
-			return err
+		// Leave unsatisfiable constraints for the resolver to report
+		selected := lockedSelection(lock, m, req.name, req.pkg, constraint, versions)
+		if selected == nil {
+			selected = selectVersion(versions, constraint)
 		}
+		if selected == nil {
+			continue
+		}
+
+		key := req.name + "@" + selected.String()
+		if added[key] {
+			continue
+		}
+		added[key] = true
+
+		info, err := pkgClient.GetPackageInfo(req.pkg, selected.String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get package info: %w", err)
+		}
+
+		pkg := &resolver.Package{
+			Name:         req.name,
+			Version:      selected,
+			Dependencies: make(map[string]ver.Constraint),
+			Checksum:     info.Checksum,
+			Format:       info.Format,
+			Artifacts:    info.Artifacts,
+		}
+		if req.pkg != req.name {
+			pkg.PackageName = req.pkg
+		}
+		for _, depName := range sortedKeys(info.Dependencies) {
+			depConstraintStr := i.overrideConstraint(depName, info.Dependencies[depName])
+			depConstraint, err := ver.ParseConstraint(depConstraintStr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid constraint for %s in %s: %w", depName, key, err)
+			}
+			pkg.Dependencies[depName] = depConstraint
+			queue = append(queue, request{name: depName, pkg: depName, constraint: depConstraintStr})
+		}
+		r.AddPackage(pkg)
 	}
 
-	return nil
+	return r.Resolve(m)
 }
 
-// InstallPackageLocalByName installs a package to the local project directory
-func (i *Installer) InstallPackageLocalByName(packageName string, version string) error {
-	client := registry.NewClient(i.config.RegistryURL)
+// InstallManifest resolves and installs every dependency declared in the
+// manifest at manifestPath into the local modules directory, then records
+// the result in the lockfile next to the manifest
+func (i *Installer) InstallManifest(manifestPath string) (*lockfile.Lockfile, error) {
+	i.report = newReport()
+	defer i.finish()
+
+	m, err := i.loadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	lockPath := i.lockPath(manifestPath)
+	return i.installManifest(m, lockPath, lockPath)
+}
 
-	// If no version specified, get latest
-	if version == "" {
-		version = "latest"
+// installManifest installs the dependencies of m against the lockfile at
+// lockPath and writes the result to savePath, signing it when it replaces
+// the lockfile
+func (i *Installer) installManifest(m *manifest.Manifest, lockPath, savePath string) (*lockfile.Lockfile, error) {
+	if err := i.recoverInterrupted(); err != nil {
+		return nil, err
 	}
 
-	// Get package info
-	pkgInfo, err := client.GetPackageInfo(packageName, version)
+	previous, err := lockfile.LoadIfExists(lockPath)
 	if err != nil {
-		return fmt.Errorf("failed to get package info: %w", err)
+		return nil, fmt.Errorf("failed to load lockfile: %w", err)
 	}
 
-	// Create a Package struct for installation
-	pkg := &resolver.Package{
-		Name: pkgInfo.Name,
-		Version: &ver.Version{
-			Major: 0,
-			Minor: 0,
-			Patch: 1,
-		},
+	if previous != nil {
+		// Say why locked versions are about to change rather than moving
+		// them silently
+		conflicts, err := LockConflicts(m, previous)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range conflicts {
+			i.logf("%s no longer matches %s: %s; re-resolving it\n", lockfile.FileNameFor(i.config.Profile), manifest.FileName, c)
+		}
+		if len(conflicts) == 0 && previous.Drifted(m) {
+			i.logf("The dependencies in %s changed since %s was written; re-resolving\n", manifest.FileName, lockfile.FileNameFor(i.config.Profile))
+		}
+	}
+
+	i.emit(Event{Kind: EventResolving})
+	resolution, err := i.resolveManifest(m, previous)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve dependencies: %w", err)
 	}
+	if err := i.checkOverridesUsed(resolution); err != nil {
+		return nil, err
+	}
+	applyLockedChecksums(resolution, previous)
+
+	client := i.registryClient()
+	order := resolution.GetResolutionOrder()
+	i.prefetch(client, order)
+	defer func() { i.prefetched = nil }()
+
+	lock := lockfile.New()
+	lock.ManifestHash = m.DependencyHash()
+	// Paths of packages this install added, for rolling back on failure
+	var installed []string
+	for _, pkg := range order {
+		installPath := i.config.LocalPackagePath(pkg.Name, pkg.Version.String())
+		existed := i.config.LocalPackageInstalled(pkg.Name, pkg.Version.String())
+
+		if i.overrides[pkg.Name].Path != "" {
+			if _, err := i.linkOverride(pkg); err != nil {
+				i.rollback(installed)
+				return nil, err
+			}
+			installed = append(installed, installPath)
+			continue
+		}
 
-	// Parse actual version if not "latest"
-	if version != "latest" && pkgInfo.Version != "" {
-		if v, err := ver.Parse(pkgInfo.Version); err == nil {
-			pkg.Version = v
+		checksum, err := i.installLocalPackage(client, pkg)
+		if err != nil {
+			if i.keepGoing {
+				i.emit(Event{Kind: EventFailed, Package: pkg.Name, Version: pkg.Version.String(), Err: err})
+				i.report.Failed = append(i.report.Failed, Failure{Name: pkg.Name, Version: pkg.Version.String(), Error: err.Error()})
+				continue
+			}
+			i.rollback(installed)
+			return nil, fmt.Errorf("failed to install %s: %w", pkg.Name, err)
+		}
+		if !existed {
+			installed = append(installed, installPath)
+		}
+
+		// Keep the recorded checksum of packages that were already installed,
+		// and the scope of those still linked from the user package directory
+		var scope string
+		if checksum == "" && previous != nil {
+			if locked := previous.Find(pkg.Name); locked != nil && locked.Version == pkg.Version.String() {
+				checksum = locked.Checksum
+				scope = locked.Scope
+			}
 		}
+		// The checksum of the archive installed for this platform is not
+		// the package's; its artifacts record that one
+		if len(pkg.Artifacts) > 0 {
+			checksum = pkg.Checksum
+		}
+
+		lock.Set(lockfile.Package{
+			Name:         pkg.Name,
+			PackageName:  pkg.PackageName,
+			Version:      pkg.Version.String(),
+			Source:       i.sourceURL(client, pkg.RegistryName()),
+			Checksum:     checksum,
+			Format:       pkg.Format,
+			Dependencies: sortedKeys(pkg.Dependencies),
+			Scope:        scope,
+			Constraint:   m.Dependencies[pkg.Name],
+			Artifacts:    pkg.Artifacts,
+		})
 	}
 
-	// Use local installation path
-	installPath := i.config.LocalPackagePath(pkg.Name, pkgInfo.Version)
-	
-	// Check if already installed locally
-	if _, err := os.Stat(installPath); err == nil {
-		fmt.Printf("Package %s@%s already installed locally at %s\n", pkg.Name, pkgInfo.Version, installPath)
-		return nil
+	// The lockfile only records complete installs
+	if err := i.report.failedError(); err != nil {
+		return nil, err
+	}
+	// nor substituted ones
+	if len(i.overrides) > 0 {
+		i.logf("Dependencies are overridden; %s was left as it was\n", lockfile.FileNameFor(i.config.Profile))
+		return lock, nil
+	}
+
+	if err := lock.Save(savePath); err != nil {
+		i.rollback(installed)
+		return nil, fmt.Errorf("failed to write lockfile: %w", err)
+	}
+	if savePath == lockPath {
+		if err := i.signLock(lockPath); err != nil {
+			return nil, err
+		}
+	}
+	i.report.recordLockDiff(previous, lock)
+
+	return lock, nil
+}
+
+// InstallFrozen installs exactly the pinned packages into the local modules
+// directory, without resolving dependencies or touching the manifest or
+// lockfile. Archives must match the pinned checksums. Failures roll back or
+// continue as for InstallManifest.
+func (i *Installer) InstallFrozen(entries []freeze.Entry) error {
+	i.report = newReport()
+	defer i.finish()
+
+	if err := i.recoverInterrupted(); err != nil {
+		return err
 	}
 
-	// Download package archive
-	archivePath := i.config.CachePath(fmt.Sprintf("%s-%s.tar.gz", pkg.Name, pkgInfo.Version))
-	
-	fmt.Printf("Downloading %s@%s...\n", pkg.Name, pkgInfo.Version)
-	reader, err := client.DownloadPackage(pkg.Name, pkgInfo.Version)
+	pkgs, err := frozenPackages(entries)
 	if err != nil {
-		return fmt.Errorf("failed to download package: %w", err)
+		return err
 	}
-	defer reader.Close()
-	
-	// Save to file
-	if err := i.saveToFile(reader, archivePath); err != nil {
-		return fmt.Errorf("failed to save package: %w", err)
+
+	client := i.registryClient()
+	i.prefetch(client, pkgs)
+	defer func() { i.prefetched = nil }()
+
+	var installed []string
+	for n, e := range entries {
+		pkg := pkgs[n]
+		installPath := i.config.LocalPackagePath(pkg.Name, e.Version)
+		existed := i.config.LocalPackageInstalled(pkg.Name, e.Version)
+		if _, err := i.installLocalPackage(client, pkg); err != nil {
+			if i.keepGoing {
+				i.emit(Event{Kind: EventFailed, Package: pkg.Name, Version: e.Version, Err: err})
+				i.report.Failed = append(i.report.Failed, Failure{Name: pkg.Name, Version: e.Version, Error: err.Error()})
+				continue
+			}
+			i.rollback(installed)
+			return fmt.Errorf("failed to install %s: %w", pkg.Name, err)
+		}
+
+		if existed {
+			i.report.Unchanged++
+		} else {
+			installed = append(installed, installPath)
+			i.report.Added = append(i.report.Added, Change{Name: pkg.Name, Version: e.Version})
+		}
 	}
 
-	// Install from archive to local directory
-	fmt.Printf("Installing to %s...\n", installPath)
-	if err := i.InstallFromArchiveToLocal(archivePath, pkg, pkgInfo.Version); err != nil {
-		return fmt.Errorf("failed to install from archive: %w", err)
+	return i.report.failedError()
+}
+
+// frozenPackages turns pinned entries into the packages to install
+func frozenPackages(entries []freeze.Entry) ([]*resolver.Package, error) {
+	var pkgs []*resolver.Package
+	for _, e := range entries {
+		v, err := ver.Parse(e.Version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version for %s: %w", e.Name, err)
+		}
+		pkgs = append(pkgs, &resolver.Package{Name: e.Name, Version: v, Checksum: e.Checksum, PackageName: e.PackageName, Format: e.Format, Artifacts: e.Artifacts})
 	}
+	return pkgs, nil
+}
 
-	// Clean up archive after successful installation
-	os.Remove(archivePath)
+// rollback removes packages added by a failed install, newest first. The
+// lockfile is only written once every package is installed, so the previous
+// one is still in place.
+func (i *Installer) rollback(installed []string) {
+	if len(installed) == 0 {
+		return
+	}
+	fmt.Fprintf(i.out, "Rolling back %d newly installed package(s)...\n", len(installed))
+	for n := len(installed) - 1; n >= 0; n-- {
+		if err := removeInstalled(installed[n]); err != nil {
+			warn.Printf(warn.FileError(err), "failed to remove %s: %v", installed[n], err)
+		}
+	}
+}
 
-	fmt.Printf("Successfully installed %s@%s to %s\n", pkg.Name, pkgInfo.Version, installPath)
+// removeInstalled deletes an installed package version, and the package
+// directory above it when no other version is left
+func removeInstalled(installPath string) error {
+	if err := os.RemoveAll(installPath); err != nil {
+		return err
+	}
+	packageDir := filepath.Dir(installPath)
+	if entries, err := os.ReadDir(packageDir); err == nil && len(entries) == 0 {
+		os.Remove(packageDir)
+	}
 	return nil
 }
 
+// fetchArchive returns the path and checksum of pkg's archive in the cache,
+// or of its prebuilt archive for the platform when it ships those. A cached
+// archive is reused when it matches the expected checksum; otherwise the
+// archive is downloaded, and discarded if it does not match. Archives are
+// kept in the cache for later installs.
+func (i *Installer) fetchArchive(client *registry.Client, pkg *resolver.Package) (string, string, error) {
+	// Aliased packages are fetched and cached under their registry name
+	name := pkg.RegistryName()
+	versionStr := pkg.Version.String()
+	archivePath := i.cacheArchivePath(pkg)
+	target, expected, err := i.artifact(pkg)
+	if err != nil {
+		return "", "", err
+	}
+	client, err = i.clientFor(client, name)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Cached archives are no exception to the policy
+	if err := i.policy.CheckRegistry(client.BaseURL()); err != nil {
+		return "", "", err
+	}
+	signed := false
+	if i.policy != nil && i.policy.RequireSignatures {
+		if signed, err = i.indexSigned(client, name, versionStr); err != nil {
+			return "", "", err
+		}
+	}
+	if err := i.policy.CheckPackage(name, versionStr, signed); err != nil {
+		return "", "", err
+	}
+	// The registry's index vouches for package archives wherever they are
+	// served from
+	if target == "" {
+		indexed, err := i.indexChecksum(client, name, versionStr)
+		if err != nil {
+			return "", "", err
+		}
+		if indexed != "" && expected != "" && indexed != expected {
+			return "", "", errcode.ChecksumMismatch.Errorf("checksum mismatch for %s@%s: expected %s, but the package index lists %s", name, versionStr, expected, indexed)
+		}
+		if indexed != "" {
+			expected = indexed
+		}
+	}
+
+	// The log is consulted for cached archives too, which may have been
+	// imported or cached before the log was set
+	if expected != "" {
+		if err := i.checkTransparencyLog(name, versionStr, expected); err != nil {
+			return "", "", err
+		}
+	}
+
+	if cachedArchiveMatches(archivePath, expected) {
+		i.emit(Event{Kind: EventCached, Package: name, Version: versionStr})
+		i.mu.Lock()
+		i.report.CacheHits++
+		i.mu.Unlock()
+		return archivePath, expected, nil
+	}
+
+	// Only a known checksum can tell whether a patched archive is right.
+	// Registries patch package archives, not prebuilt ones.
+	if target == "" && expected != "" && i.fetchPatch(client, name, versionStr, expected, archivePath) {
+		return archivePath, expected, nil
+	}
+
+	started := time.Now()
+	var download *registry.Download
+	if target != "" {
+		download, err = client.DownloadArtifact(name, versionStr, target, pkg.Format)
+	} else {
+		download, err = client.DownloadPackage(name, versionStr, pkg.Format)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to download package: %w", err)
+	}
+	defer download.Close()
+
+	// The archive only enters the cache once it is complete and matches,
+	// so installs sharing the cache never pick up a partial or wrong one
+	reader := &countingReader{r: i.newProgressReader(i.limiter.Reader(download), name, versionStr, download.Size)}
+	var checksum string
+	err = writeCacheFile(archivePath, func(w io.Writer) error {
+		_, err := io.Copy(w, reader)
+		return err
+	}, func(tmpPath string) error {
+		var err error
+		if checksum, err = archiveChecksum(tmpPath); err != nil {
+			return fmt.Errorf("failed to checksum package: %w", err)
+		}
+		if expected != "" && checksum != expected {
+			return errcode.ChecksumMismatch.Errorf("checksum mismatch for %s@%s: expected %s, got %s", name, versionStr, expected, checksum)
+		}
+		if expected == "" {
+			return i.checkTransparencyLog(name, versionStr, checksum)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+	i.mu.Lock()
+	i.report.recordDownload(name, versionStr, reader.n, time.Since(started))
+	i.mu.Unlock()
+
+	return archivePath, checksum, nil
+}
+
+// cacheArchivePath returns where pkg's archive, or its prebuilt archive for
+// the platform, is kept in the cache
+func (i *Installer) cacheArchivePath(pkg *resolver.Package) string {
+	version := pkg.Version.String()
+	if len(pkg.Artifacts) > 0 {
+		version += "-" + i.platformTarget()
+	}
+	return i.config.CachePath(archive.FileName(pkg.RegistryName(), version, archive.Format(pkg.Format)))
+}
+
+// cachedArchiveMatches reports whether archivePath exists and has the
+// expected checksum. Without an expected checksum a cached archive cannot be
+// trusted.
+func cachedArchiveMatches(archivePath, expected string) bool {
+	if expected == "" {
+		return false
+	}
+	checksum, err := archiveChecksum(archivePath)
+	return err == nil && checksum == expected
+}
+
+// applyLockedChecksums makes packages resolved to the version recorded in
+// the lockfile expect the locked checksums
+func applyLockedChecksums(resolution *resolver.Resolution, lock *lockfile.Lockfile) {
+	if lock == nil {
+		return
+	}
+	for _, pkg := range resolution.Packages {
+		locked := lock.Find(pkg.Name)
+		if locked == nil || locked.PackageName != pkg.PackageName || locked.Version != pkg.Version.String() {
+			continue
+		}
+		if locked.Checksum != "" {
+			pkg.Checksum = locked.Checksum
+		}
+		if len(locked.Artifacts) > 0 {
+			pkg.Artifacts = locked.Artifacts
+		}
+	}
+}
+
+// archiveChecksum returns the sha256 checksum of a file in "sha256:<hex>" form
+func archiveChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sortedKeys returns the keys of m in lexical order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// resolvePackage turns a user supplied version spec into the concrete
+// published version of a package. The spec may be empty or "latest" (newest
+// release), a full version ("1.2.3"), a partial version ("1" or "1.2", newest
+// matching release) or any constraint understood by version.ParseConstraint.
+func (i *Installer) resolvePackage(client *registry.Client, packageName string, spec string) (*resolver.Package, error) {
+	pkg, _, err := i.resolvePackageInfo(client, packageName, spec)
+	return pkg, err
+}
+
+// resolvePackageInfo resolves a package like resolvePackage, also returning
+// what the registry says about the selected version
+func (i *Installer) resolvePackageInfo(client *registry.Client, packageName string, spec string) (*resolver.Package, *registry.PackageInfo, error) {
+	if err := manifest.ValidateName(packageName); err != nil {
+		return nil, nil, err
+	}
+	constraint, err := parseVersionSpec(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	pkgClient, err := i.clientFor(client, packageName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	registryName, pkgClient, available, err := i.listRenamedVersions(client, pkgClient, packageName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list versions of %s: %w", packageName, err)
+	}
+
+	selected := selectVersion(available, constraint)
+	if selected == nil {
+		if constraint == nil {
+			return nil, nil, errcode.NoMatchingVersion.Errorf("package %s has no published versions", packageName)
+		}
+		return nil, nil, errcode.NoMatchingVersion.Errorf("no version of %s matches %s", packageName, spec)
+	}
+
+	// Confirm the registry knows the selected version before downloading it
+	info, err := pkgClient.GetPackageInfo(registryName, selected.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get package info: %w", err)
+	}
+
+	pkg := &resolver.Package{
+		Name:      packageName,
+		Version:   selected,
+		Checksum:  info.Checksum,
+		Format:    info.Format,
+		Artifacts: info.Artifacts,
+	}
+	if registryName != packageName {
+		pkg.PackageName = registryName
+	}
+	return pkg, info, nil
+}
+
+var partialVersionRegex = regexp.MustCompile(`^([\^~]?)v?(\d+)(?:\.(\d+))?$`)
+
+// parseVersionSpec converts a version spec into a constraint. A nil
+// constraint means any version is acceptable.
+func parseVersionSpec(spec string) (ver.Constraint, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "latest" {
+		return nil, nil
+	}
+
+	// Partial versions select the newest release sharing the given prefix,
+	// and with a caret the newest of the same major version
+	if m := partialVersionRegex.FindStringSubmatch(spec); m != nil {
+		major, _ := strconv.Atoi(m[2])
+		if m[3] == "" || m[1] == "^" {
+			minor, _ := strconv.Atoi(m[3])
+			return ver.ParseConstraint(fmt.Sprintf(">=%d.%d.0, <%d.0.0", major, minor, major+1))
+		}
+		minor, _ := strconv.Atoi(m[3])
+		return ver.ParseConstraint(fmt.Sprintf(">=%d.%d.0, <%d.%d.0", major, minor, major, minor+1))
+	}
+
+	constraint, err := ver.ParseConstraint(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version spec %q: %w", spec, err)
+	}
+	return constraint, nil
+}
+
+// selectVersion returns the newest version satisfying constraint, skipping
+// entries that are not valid semantic versions
+func selectVersion(available []string, constraint ver.Constraint) *ver.Version {
+	var selected *ver.Version
+	for _, s := range available {
+		v, err := ver.Parse(s)
+		if err != nil {
+			continue
+		}
+		if constraint != nil && !constraint.Satisfies(v) {
+			continue
+		}
+		if selected == nil || v.Compare(selected) > 0 {
+			selected = v
+		}
+	}
+	return selected
+}
+
 // InstallFromArchiveToLocal extracts an archive to a local project directory
 func (i *Installer) InstallFromArchiveToLocal(archivePath string, pkg *resolver.Package, version string) error {
 	// Create target directory in local modules
@@ -498,9 +1532,11 @@ func (i *Installer) InstallFromArchiveToLocal(archivePath string, pkg *resolver.
 	defer file.Close()
 
 	// Extract based on file extension
-	if strings.HasSuffix(archivePath, ".tar.gz") || strings.HasSuffix(archivePath, ".tgz") {
-		return i.extractTarGz(file, installPath)
+	if _, ok := archive.FormatOf(archivePath); !ok {
+		return fmt.Errorf("unsupported archive format")
 	}
-
-	return fmt.Errorf("unsupported archive format")
+	if err := i.extractTarball(file, installPath); err != nil {
+		return err
+	}
+	return i.normalizePermissions(installPath, false)
 }
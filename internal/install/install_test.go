@@ -0,0 +1,2204 @@
+package install
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/changelog"
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/delta"
+	"github.com/javanhut/bifrost/internal/errcode"
+	"github.com/javanhut/bifrost/internal/freeze"
+	"github.com/javanhut/bifrost/internal/journal"
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/locksign"
+	"github.com/javanhut/bifrost/internal/manifest"
+	"github.com/javanhut/bifrost/internal/policy"
+	"github.com/javanhut/bifrost/internal/refs"
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+	"github.com/javanhut/bifrost/internal/trust"
+	"github.com/javanhut/bifrost/internal/warn"
+)
+
+// newTestRegistry returns a fake registry holding the given published
+// versions of a single package
+func newTestRegistry(t *testing.T, name string, versions []string) *registrytest.Registry {
+	t.Helper()
+
+	reg := registrytest.New()
+	for _, v := range versions {
+		archive, err := registrytest.Archive(map[string]string{
+			"src/main.crl": fmt.Sprintf("# %s %s", name, v),
+		})
+		if err != nil {
+			t.Fatalf("failed to build archive: %v", err)
+		}
+		reg.AddPackage(registry.PackageInfo{Name: name, Version: v}, archive)
+	}
+	return reg
+}
+
+func newTestConfig(t *testing.T, registryURL string) *config.Config {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	cfg := &config.Config{
+		HomeDir:     tempDir,
+		PackagesDir: filepath.Join(tempDir, "packages"),
+		CacheDir:    filepath.Join(tempDir, "cache"),
+		RegistryDir: filepath.Join(tempDir, "registry"),
+		ModulesDir:  filepath.Join(tempDir, "project", "carrion_modules"),
+		RegistryURL: registryURL,
+		AuthFile:    filepath.Join(tempDir, "auth.json"),
+		ConfigFile:  filepath.Join(tempDir, "config.json"),
+	}
+	if err := cfg.Init(); err != nil {
+		t.Fatalf("failed to init config: %v", err)
+	}
+	return cfg
+}
+
+func TestInstaller_InstallPackageByName(t *testing.T) {
+	versions := []string{"1.0.0", "1.2.0", "1.2.5", "1.3.0", "2.1.0", "not-a-version"}
+	reg := newTestRegistry(t, "json-utils", versions)
+
+	tests := []struct {
+		name        string
+		spec        string
+		wantVersion string
+		wantErr     string
+	}{
+		{
+			name:        "no version installs latest",
+			spec:        "",
+			wantVersion: "2.1.0",
+		},
+		{
+			name:        "latest keyword",
+			spec:        "latest",
+			wantVersion: "2.1.0",
+		},
+		{
+			name:        "exact version",
+			spec:        "1.2.0",
+			wantVersion: "1.2.0",
+		},
+		{
+			name:        "partial major.minor",
+			spec:        "1.2",
+			wantVersion: "1.2.5",
+		},
+		{
+			name:        "partial major",
+			spec:        "1",
+			wantVersion: "1.3.0",
+		},
+		{
+			name:        "caret constraint",
+			spec:        "^1.0.0",
+			wantVersion: "1.3.0",
+		},
+		{
+			name:    "invalid spec",
+			spec:    "1.x.y",
+			wantErr: "invalid version spec",
+		},
+		{
+			name:    "no matching version",
+			spec:    "3.0",
+			wantErr: "no version of json-utils matches 3.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, registrytest.URL)
+			installer := New(cfg)
+			installer.SetClient(reg.Client())
+
+			err := installer.InstallPackageByName("json-utils", tt.spec, false)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("InstallPackageByName() error = %v, want containing %q", err, tt.wantErr)
+				}
+				entries, _ := os.ReadDir(filepath.Join(cfg.ModulesDir, "json-utils"))
+				if len(entries) != 0 {
+					t.Errorf("failed install left %d version directories behind", len(entries))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InstallPackageByName() error = %v", err)
+			}
+
+			mainFile := filepath.Join(cfg.LocalPackagePath("json-utils", tt.wantVersion), "src", "main.crl")
+			data, err := os.ReadFile(mainFile)
+			if err != nil {
+				t.Fatalf("expected %s to be installed: %v", mainFile, err)
+			}
+			if want := "# json-utils " + tt.wantVersion; string(data) != want {
+				t.Errorf("installed content = %q, want %q", data, want)
+			}
+
+			entries, _ := os.ReadDir(filepath.Join(cfg.ModulesDir, "json-utils"))
+			if len(entries) != 1 {
+				t.Errorf("expected exactly one version directory, got %d", len(entries))
+			}
+		})
+	}
+}
+
+func TestInstaller_InstallPackageByName_UnknownPackage(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0"})
+	installer := New(newTestConfig(t, registrytest.URL))
+	installer.SetClient(reg.Client())
+
+	err := installer.InstallPackageByName("missing", "latest", false)
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestInstaller_InstallPackagesLocalByName(t *testing.T) {
+	reg := newTestRegistry(t, "text-utils", []string{"1.0.0", "1.1.0", "1.4.0", "2.0.0"})
+	archive, err := registrytest.Archive(map[string]string{"src/main.crl": "# app"})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0", Dependencies: map[string]string{"text-utils": "^1.0.0"}}, archive)
+	reg.AddPackage(registry.PackageInfo{Name: "http-client", Version: "2.0.0", Dependencies: map[string]string{"text-utils": "~1.1.0"}}, archive)
+	reg.AddPackage(registry.PackageInfo{Name: "http-client", Version: "2.3.0", Dependencies: map[string]string{"text-utils": "^1.1.0"}}, archive)
+
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	err = installer.InstallPackagesLocalByName([]PackageRequest{{Name: "json-utils", Version: "1.0"}, {Name: "http-client", Version: "^2"}})
+	if err != nil {
+		t.Fatalf("InstallPackagesLocalByName() error = %v", err)
+	}
+
+	// The dependency both packages share is installed once
+	for name, version := range map[string]string{"json-utils": "1.0.0", "http-client": "2.3.0", "text-utils": "1.4.0"} {
+		entries, _ := os.ReadDir(filepath.Join(cfg.ModulesDir, name))
+		if len(entries) != 1 || entries[0].Name() != version {
+			t.Errorf("%s installed versions = %v, want only %s", name, entries, version)
+		}
+	}
+	if added := len(installer.Report().Added); added != 3 {
+		t.Errorf("Report().Added has %d packages, want 3", added)
+	}
+
+	err = installer.InstallPackagesLocalByName([]PackageRequest{{Name: "json-utils"}, {Name: "json-utils", Version: "1.0.0"}})
+	if err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("InstallPackagesLocalByName() with a repeated package error = %v", err)
+	}
+}
+
+func TestParseVersionSpec(t *testing.T) {
+	tests := []struct {
+		spec      string
+		wantNil   bool
+		wantErr   bool
+		satisfies []string
+		rejects   []string
+	}{
+		{spec: "", wantNil: true},
+		{spec: "latest", wantNil: true},
+		{spec: "1.2.3", satisfies: []string{"1.2.3"}, rejects: []string{"1.2.4"}},
+		{spec: "1.2", satisfies: []string{"1.2.0", "1.2.9"}, rejects: []string{"1.1.9", "1.3.0"}},
+		{spec: "v2", satisfies: []string{"2.0.0", "2.9.9"}, rejects: []string{"1.9.9", "3.0.0"}},
+		{spec: "~1.2.3", satisfies: []string{"1.2.5"}, rejects: []string{"1.3.0"}},
+		{spec: "^2", satisfies: []string{"2.0.0", "2.9.9"}, rejects: []string{"1.9.9", "3.0.0"}},
+		{spec: "^1.2", satisfies: []string{"1.2.0", "1.9.0"}, rejects: []string{"1.1.9", "2.0.0"}},
+		{spec: "~1.2", satisfies: []string{"1.2.0", "1.2.9"}, rejects: []string{"1.1.9", "1.3.0"}},
+		{spec: "1.2.3.4", wantErr: true},
+		{spec: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			c, err := parseVersionSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseVersionSpec(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (c == nil) != tt.wantNil {
+				t.Fatalf("parseVersionSpec(%q) = %v, wantNil %v", tt.spec, c, tt.wantNil)
+			}
+			for _, s := range tt.satisfies {
+				if got := selectVersion([]string{s}, c); got == nil {
+					t.Errorf("%q should satisfy %s", tt.spec, s)
+				}
+			}
+			for _, s := range tt.rejects {
+				if got := selectVersion([]string{s}, c); got != nil {
+					t.Errorf("%q should not satisfy %s", tt.spec, s)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectVersion(t *testing.T) {
+	available := []string{"0.9.0", "1.10.0", "1.9.0", "garbage", "v1.2.0"}
+
+	got := selectVersion(available, nil)
+	if got == nil || got.String() != "1.10.0" {
+		t.Errorf("selectVersion() = %v, want 1.10.0", got)
+	}
+
+	if got := selectVersion([]string{"garbage"}, nil); got != nil {
+		t.Errorf("selectVersion() with no valid versions = %v, want nil", got)
+	}
+}
+
+func TestInstaller_InstallManifest(t *testing.T) {
+	reg := registrytest.New()
+	addPackage := func(name, v string, deps map[string]string) {
+		archive, err := registrytest.Archive(map[string]string{"src/main.crl": name + " " + v})
+		if err != nil {
+			t.Fatalf("failed to build archive: %v", err)
+		}
+		reg.AddPackage(registry.PackageInfo{Name: name, Version: v, Dependencies: deps}, archive)
+	}
+	addPackage("http-client", "1.0.0", map[string]string{"json-utils": "~0.3.0"})
+	addPackage("http-client", "1.4.0", map[string]string{"json-utils": "~0.3.5"})
+	addPackage("http-client", "2.0.0", nil)
+	addPackage("json-utils", "0.3.5", nil)
+	addPackage("json-utils", "0.3.9", nil)
+	addPackage("json-utils", "0.4.0", nil)
+
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+
+	projectDir := t.TempDir()
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte(`[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+http-client = "^1.0.0"
+`), 0644)
+
+	lock, err := installer.InstallManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+
+	want := map[string]string{"http-client": "1.4.0", "json-utils": "0.3.9"}
+	if len(lock.Packages) != len(want) {
+		t.Fatalf("locked %d packages, want %d", len(lock.Packages), len(want))
+	}
+	for name, v := range want {
+		locked := lock.Find(name)
+		if locked == nil || locked.Version != v {
+			t.Errorf("locked %s = %+v, want version %s", name, locked, v)
+			continue
+		}
+		if !strings.HasPrefix(locked.Checksum, "sha256:") {
+			t.Errorf("locked %s has checksum %q", name, locked.Checksum)
+		}
+		if _, err := os.Stat(cfg.LocalPackagePath(name, v)); err != nil {
+			t.Errorf("%s@%s not installed: %v", name, v, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(projectDir, "Bifrost.lock")); err != nil {
+		t.Errorf("lockfile not written: %v", err)
+	}
+
+	// A second install keeps checksums for packages that are already present
+	lock, err = installer.InstallManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("second InstallManifest() error = %v", err)
+	}
+	if locked := lock.Find("json-utils"); locked == nil || locked.Checksum == "" {
+		t.Errorf("checksum lost on reinstall: %+v", locked)
+	}
+}
+
+func TestInstaller_InstallManifestKeepsLockedVersions(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	writeManifest := func(constraint string) {
+		os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\njson-utils = \""+constraint+"\"\n"), 0644)
+	}
+	writeManifest("^1.0.0")
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+
+	archive, err := registrytest.Archive(map[string]string{"src/main.crl": "# json-utils 1.1.0"})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.1.0"}, archive)
+
+	// A newer version satisfying the same constraint leaves the lock alone
+	lock, err := installer.InstallManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("second InstallManifest() error = %v", err)
+	}
+	if locked := lock.Find("json-utils"); locked == nil || locked.Version != "1.0.0" {
+		t.Errorf("locked json-utils = %+v, want 1.0.0 kept", locked)
+	}
+
+	// A changed constraint resolves the dependency afresh
+	writeManifest(">=1.0.0")
+	lock, err = installer.InstallManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("InstallManifest() after edit error = %v", err)
+	}
+	if locked := lock.Find("json-utils"); locked == nil || locked.Version != "1.1.0" {
+		t.Errorf("locked json-utils = %+v, want 1.1.0 after the constraint changed", locked)
+	}
+}
+
+func TestInstaller_InstallManifestScopedRegistry(t *testing.T) {
+	public := newTestRegistry(t, "json-utils", []string{"1.0.0"})
+	private := registrytest.New()
+	archive, err := registrytest.Archive(map[string]string{"src/main.crl": "# internal"})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	private.AddPackage(registry.PackageInfo{Name: "@acme/utils", Version: "1.1.0", Dependencies: map[string]string{"json-utils": "^1.0.0"}}, archive)
+	// The private registry only answers requests with its token
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		private.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(t, registrytest.URL)
+	userConfig := &config.UserConfig{
+		Registries: map[string]config.RegistryConfig{
+			"acme": {URL: server.URL, AuthType: "token", APIKey: "secret"},
+		},
+		Scopes: map[string]string{"@acme": "acme"},
+	}
+	if err := cfg.SaveUserConfig(userConfig); err != nil {
+		t.Fatalf("failed to save config: %v", err)
+	}
+	installer := New(cfg)
+	installer.SetClient(public.Client())
+	installer.SetOutput(io.Discard)
+
+	projectDir := t.TempDir()
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\n\"@acme/utils\" = \"^1.0.0\"\n"), 0644)
+
+	lock, err := installer.InstallManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	if locked := lock.Find("@acme/utils"); locked == nil || locked.Version != "1.1.0" || locked.Source != server.URL {
+		t.Errorf("locked @acme/utils = %+v, want 1.1.0 from %s", locked, server.URL)
+	}
+	if locked := lock.Find("json-utils"); locked == nil || locked.Source != registrytest.URL {
+		t.Errorf("locked json-utils = %+v, want it from the public registry", locked)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.LocalPackagePath("@acme/utils", "1.1.0"), "src", "main.crl")); err != nil {
+		t.Errorf("@acme/utils not installed: %v", err)
+	}
+	for _, req := range public.Requests() {
+		if strings.Contains(req, "acme") {
+			t.Errorf("public registry was asked for a scoped package: %s", req)
+		}
+	}
+}
+
+func TestInstaller_InstallManifestFlatLayout(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0", "1.1.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	cfg.Layout = config.LayoutFlat
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+
+	manifestPath := filepath.Join(t.TempDir(), "Bifrost.toml")
+	writeManifest := func(constraint string) {
+		os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\njson-utils = \""+constraint+"\"\n"), 0644)
+	}
+	packageDir := filepath.Join(cfg.ModulesDir, "json-utils")
+
+	for _, v := range []string{"1.0.0", "1.1.0"} {
+		writeManifest(v)
+		if _, err := installer.InstallManifest(manifestPath); err != nil {
+			t.Fatalf("InstallManifest(%s) error = %v", v, err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(packageDir, "src", "main.crl"))
+		if err != nil || string(data) != "# json-utils "+v {
+			t.Errorf("flat package contains %q, %v, want json-utils %s", data, err, v)
+		}
+		if got := config.FlatVersion(packageDir); got != v {
+			t.Errorf("FlatVersion() = %q, want %q", got, v)
+		}
+	}
+
+	// The older version was replaced, not kept beside the new one
+	entries, _ := os.ReadDir(packageDir)
+	for _, e := range entries {
+		if e.Name() == "1.0.0" || e.Name() == "1.1.0" {
+			t.Errorf("flat layout created version directory %s", e.Name())
+		}
+	}
+}
+
+// newFailingProject sets up a registry where "broken" fails its checksum
+// check, and a project depending on it and on "json-utils"
+func newFailingProject(t *testing.T) (*registrytest.Registry, string) {
+	t.Helper()
+	reg := registrytest.New()
+	for _, name := range []string{"json-utils", "broken"} {
+		archive, err := registrytest.Archive(map[string]string{"src/main.crl": name})
+		if err != nil {
+			t.Fatalf("failed to build archive: %v", err)
+		}
+		info := registry.PackageInfo{Name: name, Version: "1.0.0"}
+		if name == "broken" {
+			info.Checksum = "sha256:0000"
+		}
+		reg.AddPackage(info, archive)
+	}
+
+	projectDir := t.TempDir()
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte(`[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+broken = "1.0.0"
+json-utils = "1.0.0"
+`), 0644)
+	return reg, manifestPath
+}
+
+func TestInstaller_InstallManifestRollback(t *testing.T) {
+	reg, manifestPath := newFailingProject(t)
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+
+	lockPath := filepath.Join(filepath.Dir(manifestPath), "Bifrost.lock")
+	previous := []byte("version = 1\n")
+	os.WriteFile(lockPath, previous, 0644)
+
+	if _, err := installer.InstallManifest(manifestPath); err == nil {
+		t.Fatal("InstallManifest() error = nil, want failure")
+	}
+
+	for _, name := range []string{"json-utils", "broken"} {
+		if _, err := os.Stat(cfg.LocalPackagePath(name, "1.0.0")); !os.IsNotExist(err) {
+			t.Errorf("%s was not rolled back", name)
+		}
+	}
+	if got, _ := os.ReadFile(lockPath); string(got) != string(previous) {
+		t.Errorf("lockfile changed to %q", got)
+	}
+}
+
+func TestInstaller_InstallManifestKeepGoing(t *testing.T) {
+	reg, manifestPath := newFailingProject(t)
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetKeepGoing(true)
+
+	_, err := installer.InstallManifest(manifestPath)
+	if err == nil || !strings.Contains(err.Error(), "1 package(s) failed to install: broken") {
+		t.Fatalf("InstallManifest() error = %v, want broken to fail", err)
+	}
+
+	if _, err := os.Stat(cfg.LocalPackagePath("json-utils", "1.0.0")); err != nil {
+		t.Errorf("json-utils not installed: %v", err)
+	}
+	failed := installer.Report().Failed
+	if len(failed) != 1 || failed[0].Name != "broken" {
+		t.Errorf("Report().Failed = %+v, want broken", failed)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(manifestPath), "Bifrost.lock")); !os.IsNotExist(err) {
+		t.Error("lockfile written for an incomplete install")
+	}
+}
+
+func TestInstaller_RecoversInterruptedInstall(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+
+	// Simulate a crash halfway through extracting a package, by a process
+	// that is gone
+	partial := cfg.LocalPackagePath("json-utils", "1.0.0")
+	entry, _ := json.Marshal(journal.Entry{ID: "0-crashed-1", State: "begin", Op: journal.OpInstall, Paths: []string{partial}})
+	if err := os.WriteFile(cfg.JournalPath(), append(entry, '\n'), 0644); err != nil {
+		t.Fatalf("failed to write journal: %v", err)
+	}
+	os.MkdirAll(partial, 0755)
+
+	if err := installer.InstallPackageByName("json-utils", "1.0.0", false); err != nil {
+		t.Fatalf("InstallPackageByName() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(partial, "src", "main.crl")); err != nil {
+		t.Errorf("package not reinstalled after recovery: %v", err)
+	}
+	if pending, _ := journal.Open(cfg.JournalPath()).Pending(); len(pending) != 0 {
+		t.Errorf("journal still has pending operations: %+v", pending)
+	}
+}
+
+func TestInstaller_GlobalInstallRecordsReference(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	cfg.GlobalPackagesDir = filepath.Join(t.TempDir(), "lib")
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+
+	project := t.TempDir()
+	installer.SetProject(project)
+	if err := installer.InstallPackageByName("json-utils", "1.0.0", true); err != nil {
+		t.Fatalf("InstallPackageByName() error = %v", err)
+	}
+	installer.SetProject("")
+	if err := installer.InstallPackageByName("json-utils", "1.0.0", true); err != nil {
+		t.Fatalf("second InstallPackageByName() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(cfg.GlobalPackagesDir, "json-utils", "1.0.0", "src", "main.crl")); err != nil {
+		t.Errorf("package not installed globally: %v", err)
+	}
+	r, err := refs.Load(filepath.Join(cfg.GlobalPackagesDir, refs.FileName))
+	if err != nil {
+		t.Fatalf("refs.Load() error = %v", err)
+	}
+	want := []string{project, refs.Explicit}
+	sort.Strings(want)
+	if got := r.Projects("json-utils", "1.0.0"); !reflect.DeepEqual(got, want) {
+		t.Errorf("references = %v, want %v", got, want)
+	}
+}
+
+func TestInstaller_InstallPackageUserByName(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0", "1.1.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	project := filepath.Dir(cfg.ModulesDir)
+	installer.SetProject(project)
+	if err := installer.InstallPackageUserByName("json-utils", "1.0.0"); err != nil {
+		t.Fatalf("InstallPackageUserByName() error = %v", err)
+	}
+	if err := installer.InstallPackageUserByName("json-utils", "1.1.0"); err != nil {
+		t.Fatalf("second InstallPackageUserByName() error = %v", err)
+	}
+
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		if _, err := os.Stat(filepath.Join(cfg.PackagePath("json-utils", version), "src", "main.crl")); err != nil {
+			t.Errorf("json-utils@%s not installed in the user package directory: %v", version, err)
+		}
+	}
+	if _, err := os.Lstat(cfg.LocalPackagePath("json-utils", "1.0.0")); !os.IsNotExist(err) {
+		t.Errorf("link to the replaced version left behind: %v", err)
+	}
+	linkPath := cfg.LocalPackagePath("json-utils", "1.1.0")
+	if target, err := os.Readlink(linkPath); err != nil || target != cfg.PackagePath("json-utils", "1.1.0") {
+		t.Errorf("Readlink(%s) = %q, %v, want link to the user package directory", linkPath, target, err)
+	}
+	if content, err := os.ReadFile(filepath.Join(linkPath, "src", "main.crl")); err != nil || string(content) != "# json-utils 1.1.0" {
+		t.Errorf("linked package content = %q, %v", content, err)
+	}
+
+	lock, err := lockfile.Load(filepath.Join(project, lockfile.FileName))
+	if err != nil {
+		t.Fatalf("lockfile.Load() error = %v", err)
+	}
+	locked := lock.Find("json-utils")
+	if locked == nil || locked.Version != "1.1.0" || locked.Scope != lockfile.ScopeUser || locked.Checksum == "" {
+		t.Errorf("locked json-utils = %+v, want 1.1.0 linked from user scope", locked)
+	}
+}
+
+func TestInstaller_ReadOnlyStore(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	cfg.GlobalPackagesDir = filepath.Join(t.TempDir(), "lib")
+	cfg.ReadOnlyStore = true
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	if err := installer.InstallPackageByName("json-utils", "1.0.0", true); !errors.Is(err, config.ErrReadOnlyStore) {
+		t.Errorf("global InstallPackageByName() error = %v, want %v", err, config.ErrReadOnlyStore)
+	}
+	if err := installer.InstallPackageUserByName("json-utils", "1.0.0"); !errors.Is(err, config.ErrReadOnlyStore) {
+		t.Errorf("InstallPackageUserByName() error = %v, want %v", err, config.ErrReadOnlyStore)
+	}
+	for _, dir := range []string{cfg.GlobalPackagesDir, cfg.PackagePath("json-utils", "1.0.0")} {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("%s written to the read-only store: %v", dir, err)
+		}
+	}
+
+	// Projects install as usual
+	if err := installer.InstallPackageByName("json-utils", "1.0.0", false); err != nil {
+		t.Fatalf("InstallPackageByName() into the project error = %v", err)
+	}
+	if _, err := os.Stat(cfg.LocalPackagePath("json-utils", "1.0.0")); err != nil {
+		t.Errorf("package not installed into the project: %v", err)
+	}
+}
+
+func TestInstaller_InstallFrozen(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0", "1.2.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+
+	published, _ := reg.Package("json-utils", "1.0.0")
+	err := installer.InstallFrozen([]freeze.Entry{
+		{Name: "json-utils", Version: "1.0.0", Checksum: published.Info.Checksum},
+	})
+	if err != nil {
+		t.Fatalf("InstallFrozen() error = %v", err)
+	}
+	if _, err := os.Stat(cfg.LocalPackagePath("json-utils", "1.0.0")); err != nil {
+		t.Errorf("pinned version not installed: %v", err)
+	}
+	if _, err := os.Stat(cfg.LocalPackagePath("json-utils", "1.2.0")); !os.IsNotExist(err) {
+		t.Error("unpinned version installed")
+	}
+
+	err = installer.InstallFrozen([]freeze.Entry{{Name: "json-utils", Version: "1.2.0", Checksum: "sha256:0000"}})
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("InstallFrozen() error = %v, want checksum mismatch", err)
+	}
+}
+
+func TestInstaller_InstallManifestAliases(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.4.0", "2.1.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+
+	manifestPath := filepath.Join(t.TempDir(), "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte(`[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+json-utils = "^1.0.0"
+json2 = { package = "json-utils", version = "^2.0.0" }
+`), 0644)
+
+	lock, err := installer.InstallManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+
+	for name, v := range map[string]string{"json-utils": "1.4.0", "json2": "2.1.0"} {
+		data, err := os.ReadFile(filepath.Join(cfg.LocalPackagePath(name, v), "src", "main.crl"))
+		if err != nil {
+			t.Errorf("%s@%s not installed: %v", name, v, err)
+			continue
+		}
+		if want := "# json-utils " + v; string(data) != want {
+			t.Errorf("%s contains %q, want %q", name, data, want)
+		}
+	}
+
+	if locked := lock.Find("json2"); locked == nil || locked.PackageName != "json-utils" || locked.Version != "2.1.0" {
+		t.Errorf("locked json2 = %+v, want json-utils@2.1.0", locked)
+	}
+	if locked := lock.Find("json-utils"); locked == nil || locked.PackageName != "" {
+		t.Errorf("locked json-utils = %+v, want no alias", locked)
+	}
+}
+
+func TestInstaller_InstallManifestProfile(t *testing.T) {
+	reg := newTestRegistry(t, "payments", []string{"1.0.0"})
+	archive, err := registrytest.Archive(map[string]string{"src/main.crl": "# payments-mock 1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "payments-mock", Version: "1.0.0"}, archive)
+	cfg := newTestConfig(t, registrytest.URL)
+
+	dir := t.TempDir()
+	manifestPath := filepath.Join(dir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte(`[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+payments = "^1.0.0"
+
+[profile.dev.dependencies]
+payments = { package = "payments-mock", version = "^1.0.0" }
+`), 0644)
+
+	install := func(profile, want string) *lockfile.Lockfile {
+		t.Helper()
+		cfg.Profile = profile
+		installer := New(cfg)
+		installer.SetClient(reg.Client())
+		lock, err := installer.InstallManifest(manifestPath)
+		if err != nil {
+			t.Fatalf("InstallManifest() with profile %q error = %v", profile, err)
+		}
+		data, err := os.ReadFile(filepath.Join(cfg.LocalPackagePath("payments", "1.0.0"), "src", "main.crl"))
+		if err != nil || string(data) != want {
+			t.Errorf("with profile %q payments contains %q (%v), want %q", profile, data, err, want)
+		}
+		return lock
+	}
+
+	install("", "# payments 1.0.0")
+	lock := install("dev", "# payments-mock 1.0.0")
+	if locked := lock.Find("payments"); locked == nil || locked.PackageName != "payments-mock" {
+		t.Errorf("dev locked payments = %+v, want payments-mock", locked)
+	}
+	// Switching back replaces the mock installed under the same version
+	install("", "# payments 1.0.0")
+
+	for file, pkg := range map[string]string{"Bifrost.lock": "", "Bifrost.dev.lock": "payments-mock"} {
+		l, err := lockfile.Load(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if locked := l.Find("payments"); locked == nil || locked.PackageName != pkg {
+			t.Errorf("%s locks payments = %+v, want package %q", file, locked, pkg)
+		}
+	}
+}
+
+func TestInstaller_InstallManifestLimitedDownloads(t *testing.T) {
+	reg := registrytest.New()
+	names := []string{"alpha", "beta", "gamma", "delta", "epsilon"}
+	for _, name := range names {
+		archive, err := registrytest.Archive(map[string]string{"src/main.crl": "# " + name})
+		if err != nil {
+			t.Fatalf("failed to build archive: %v", err)
+		}
+		reg.AddPackage(registry.PackageInfo{Name: name, Version: "1.0.0"}, archive)
+	}
+
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+	installer.SetMaxConcurrentDownloads(2)
+	installer.SetLimitRate(1 << 20)
+
+	manifestPath := filepath.Join(t.TempDir(), "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte(`[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+alpha = "1.0.0"
+beta = "1.0.0"
+gamma = "1.0.0"
+delta = "1.0.0"
+epsilon = "1.0.0"
+`), 0644)
+
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+
+	for _, name := range names {
+		if !cfg.LocalPackageInstalled(name, "1.0.0") {
+			t.Errorf("%s@1.0.0 not installed", name)
+		}
+	}
+	if got := len(installer.Report().Downloads); got != len(names) {
+		t.Errorf("report has %d downloads, want %d", got, len(names))
+	}
+	if got := downloads(reg); got != len(names) {
+		t.Errorf("registry served %d downloads, want %d", got, len(names))
+	}
+}
+
+func TestInstaller_PlanPackageByName(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0", "1.2.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+
+	plan, err := installer.PlanPackageByName("json-utils", "1", false)
+	if err != nil {
+		t.Fatalf("PlanPackageByName() error = %v", err)
+	}
+
+	installPath := cfg.LocalPackagePath("json-utils", "1.2.0")
+	want := []Action{
+		{
+			Action:  ActionDownload,
+			Package: "json-utils",
+			Version: "1.2.0",
+			Source:  registrytest.URL + "/packages/json-utils/1.2.0/json-utils-1.2.0.tar.gz",
+			Path:    cfg.CachePath("json-utils-1.2.0.tar.gz"),
+		},
+		{
+			Action:  ActionExtract,
+			Package: "json-utils",
+			Version: "1.2.0",
+			Source:  cfg.CachePath("json-utils-1.2.0.tar.gz"),
+			Path:    installPath,
+		},
+	}
+	if len(plan.Actions) != len(want) {
+		t.Fatalf("plan has %d actions, want %d: %+v", len(plan.Actions), len(want), plan.Actions)
+	}
+	for i := range want {
+		if plan.Actions[i] != want[i] {
+			t.Errorf("action %d = %+v, want %+v", i, plan.Actions[i], want[i])
+		}
+	}
+
+	var printed strings.Builder
+	plan.Print(&printed)
+	if !strings.Contains(printed.String(), "download json-utils@1.2.0 from ") ||
+		!strings.Contains(printed.String(), "extract json-utils@1.2.0 to "+installPath) {
+		t.Errorf("Print() = %q", printed.String())
+	}
+
+	if _, err := os.Stat(installPath); !os.IsNotExist(err) {
+		t.Errorf("planning installed the package: %v", err)
+	}
+	for _, req := range reg.Requests() {
+		if strings.HasPrefix(req, "GET /packages/") {
+			t.Errorf("planning downloaded an archive: %s", req)
+		}
+	}
+
+	// Once installed, the plan skips the package
+	if err := installer.InstallPackageByName("json-utils", "1", false); err != nil {
+		t.Fatalf("InstallPackageByName() error = %v", err)
+	}
+	plan, err = installer.PlanPackageByName("json-utils", "1", false)
+	if err != nil {
+		t.Fatalf("PlanPackageByName() error = %v", err)
+	}
+	if len(plan.Actions) != 1 || plan.Actions[0].Action != ActionSkip {
+		t.Errorf("plan after install = %+v, want a single skip", plan.Actions)
+	}
+}
+
+func TestInstaller_PlanManifest(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+
+	projectDir := t.TempDir()
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte(`[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+json-utils = "^1.0.0"
+`), 0644)
+
+	plan, err := installer.PlanManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("PlanManifest() error = %v", err)
+	}
+
+	var kinds []string
+	for _, a := range plan.Actions {
+		kinds = append(kinds, a.Action)
+	}
+	want := []string{ActionDownload, ActionExtract, ActionWriteLockfile}
+	if strings.Join(kinds, ",") != strings.Join(want, ",") {
+		t.Errorf("plan actions = %v, want %v", kinds, want)
+	}
+	if last := plan.Actions[len(plan.Actions)-1]; last.Path != filepath.Join(projectDir, "Bifrost.lock") {
+		t.Errorf("lockfile path = %q", last.Path)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, "Bifrost.lock")); !os.IsNotExist(err) {
+		t.Error("planning wrote a lockfile")
+	}
+}
+
+// downloads counts archive downloads served by reg
+func downloads(reg *registrytest.Registry) int {
+	n := 0
+	for _, req := range reg.Requests() {
+		if strings.HasPrefix(req, "GET /packages/") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestInstaller_CacheReuse(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+
+	if err := installer.InstallPackageByName("json-utils", "1.0.0", false); err != nil {
+		t.Fatalf("InstallPackageByName() error = %v", err)
+	}
+	archivePath := cfg.CachePath("json-utils-1.0.0.tar.gz")
+	if _, err := os.Stat(archivePath); err != nil {
+		t.Fatalf("archive not kept in cache: %v", err)
+	}
+
+	// A second project sharing the cache reuses the archive
+	cfg.ModulesDir = filepath.Join(t.TempDir(), "carrion_modules")
+	if err := installer.InstallPackageByName("json-utils", "1.0.0", false); err != nil {
+		t.Fatalf("InstallPackageByName() error = %v", err)
+	}
+	if got := downloads(reg); got != 1 {
+		t.Errorf("archive downloaded %d times, want 1", got)
+	}
+
+	// A corrupted cache entry is replaced by a fresh download
+	os.WriteFile(archivePath, []byte("corrupted"), 0644)
+	cfg.ModulesDir = filepath.Join(t.TempDir(), "carrion_modules")
+	if err := installer.InstallPackageByName("json-utils", "1.0.0", false); err != nil {
+		t.Fatalf("InstallPackageByName() error = %v", err)
+	}
+	if got := downloads(reg); got != 2 {
+		t.Errorf("archive downloaded %d times, want 2", got)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.LocalPackagePath("json-utils", "1.0.0"), "src", "main.crl")); err != nil {
+		t.Errorf("package not installed after re-download: %v", err)
+	}
+}
+
+func TestInstaller_ConcurrentProjectsShareCache(t *testing.T) {
+	reg := registrytest.New()
+	var names []string
+	for n := range 8 {
+		name := fmt.Sprintf("pkg-%d", n)
+		archive, err := registrytest.Archive(map[string]string{
+			"src/main.crl": strings.Repeat(name+"\n", 4096),
+		})
+		if err != nil {
+			t.Fatalf("failed to build archive: %v", err)
+		}
+		reg.AddPackage(registry.PackageInfo{Name: name, Version: "1.0.0"}, archive)
+		names = append(names, name)
+	}
+	cfg := newTestConfig(t, registrytest.URL)
+
+	// Two projects install the same packages at once into one cache, each
+	// package by an installer of its own as separate processes would
+	var projects []*config.Config
+	errs := make(chan error, 2*len(names))
+	var wg sync.WaitGroup
+	for range 2 {
+		project := *cfg
+		project.ModulesDir = filepath.Join(t.TempDir(), "carrion_modules")
+		projects = append(projects, &project)
+		for _, name := range names {
+			installer := New(&project)
+			installer.SetClient(reg.Client())
+			installer.SetOutput(io.Discard)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- installer.InstallPackageByName(name, "1.0.0", false)
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("InstallPackageByName() error = %v", err)
+		}
+	}
+
+	for _, name := range names {
+		pkg, _ := reg.Package(name, "1.0.0")
+		if !cachedArchiveMatches(cfg.CachePath(name+"-1.0.0.tar.gz"), pkg.Info.Checksum) {
+			t.Errorf("cached archive of %s does not match its checksum", name)
+		}
+		for _, project := range projects {
+			data, err := os.ReadFile(filepath.Join(project.LocalPackagePath(name, "1.0.0"), "src", "main.crl"))
+			if err != nil || string(data) != strings.Repeat(name+"\n", 4096) {
+				t.Errorf("%s installed into %s with %d bytes (%v)", name, project.ModulesDir, len(data), err)
+			}
+		}
+	}
+	if tmp := cacheTempFiles(t, cfg); len(tmp) > 0 {
+		t.Errorf("installs left temporary files in the cache: %v", tmp)
+	}
+}
+
+// cacheTempFiles returns the files still being written, or left behind
+// half-written, in the cache of cfg
+func cacheTempFiles(t *testing.T, cfg *config.Config) []string {
+	t.Helper()
+
+	tmp, err := filepath.Glob(filepath.Join(cfg.CacheDir, "*"+cacheTempSuffix))
+	if err != nil {
+		t.Fatalf("failed to list cache: %v", err)
+	}
+	return tmp
+}
+
+func TestInstaller_PatchDownload(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0", "1.1.0", "1.2.0"})
+	v1, _ := reg.Package("json-utils", "1.0.0")
+	v11, _ := reg.Package("json-utils", "1.1.0")
+	patch, err := delta.Create(v1.Archive, v11.Archive)
+	if err != nil {
+		t.Fatalf("failed to create patch: %v", err)
+	}
+	reg.AddPatch("json-utils", "1.0.0", "1.1.0", patch)
+	// Applies cleanly but produces the wrong archive
+	bad, err := delta.Create(v11.Archive, v11.Archive)
+	if err != nil {
+		t.Fatalf("failed to create patch: %v", err)
+	}
+	reg.AddPatch("json-utils", "1.1.0", "1.2.0", bad)
+
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+	if err := installer.InstallPackageByName("json-utils", "1.0.0", false); err != nil {
+		t.Fatalf("InstallPackageByName() error = %v", err)
+	}
+
+	// The cached 1.0.0 archive is patched up to 1.1.0
+	if err := installer.InstallPackageByName("json-utils", "1.1.0", false); err != nil {
+		t.Fatalf("InstallPackageByName() error = %v", err)
+	}
+	if pkg, _ := reg.Package("json-utils", "1.1.0"); pkg.Downloads != 0 || pkg.PatchDownloads != 1 {
+		t.Errorf("1.1.0 downloaded %d times and patched %d times, want 0 and 1", pkg.Downloads, pkg.PatchDownloads)
+	}
+	if d := installer.Report().Downloads; len(d) != 1 || d[0].PatchedFrom != "1.0.0" {
+		t.Errorf("report downloads = %+v, want one patch from 1.0.0", d)
+	}
+	data, err := os.ReadFile(filepath.Join(cfg.LocalPackagePath("json-utils", "1.1.0"), "src", "main.crl"))
+	if err != nil || string(data) != "# json-utils 1.1.0" {
+		t.Errorf("patched install contains %q (%v), want %q", data, err, "# json-utils 1.1.0")
+	}
+
+	// A patch that fails verification falls back to the full archive
+	if err := installer.InstallPackageByName("json-utils", "1.2.0", false); err != nil {
+		t.Fatalf("InstallPackageByName() error = %v", err)
+	}
+	if pkg, _ := reg.Package("json-utils", "1.2.0"); pkg.Downloads != 1 || pkg.PatchDownloads != 1 {
+		t.Errorf("1.2.0 downloaded %d times and patched %d times, want 1 and 1", pkg.Downloads, pkg.PatchDownloads)
+	}
+	if tmp := cacheTempFiles(t, cfg); len(tmp) > 0 {
+		t.Errorf("failed patch left its output behind: %v", tmp)
+	}
+}
+
+func TestInstaller_ZstdPackage(t *testing.T) {
+	reg := registrytest.New()
+	archive, err := registrytest.ZstdArchive(map[string]string{"src/main.crl": "# big-data 1.0.0"})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "big-data", Version: "1.0.0", Format: "tar.zst"}, archive)
+
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	manifestPath := filepath.Join(t.TempDir(), "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte(`[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+big-data = "^1.0.0"
+`), 0644)
+
+	lock, err := installer.InstallManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(cfg.LocalPackagePath("big-data", "1.0.0"), "src", "main.crl"))
+	if err != nil || string(data) != "# big-data 1.0.0" {
+		t.Errorf("installed main.crl = %q (%v), want %q", data, err, "# big-data 1.0.0")
+	}
+	if _, err := os.Stat(cfg.CachePath("big-data-1.0.0.tar.zst")); err != nil {
+		t.Errorf("zstd archive not cached under its own extension: %v", err)
+	}
+	if locked := lock.Find("big-data"); locked == nil || locked.Format != "tar.zst" {
+		t.Errorf("locked big-data = %+v, want format tar.zst", locked)
+	}
+}
+
+func TestInstaller_VerifiesEmbeddedManifest(t *testing.T) {
+	manifestFor := func(name, version string) string {
+		return fmt.Sprintf("[package]\nname = %q\nversion = %q\n", name, version)
+	}
+	tests := []struct {
+		name     string
+		manifest string
+		wantErr  string
+	}{
+		{name: "matching", manifest: manifestFor("json-utils", "1.1.0")},
+		{name: "wrong version", manifest: manifestFor("json-utils", "1.0.0"), wantErr: "contains the manifest of json-utils@1.0.0"},
+		{name: "wrong name", manifest: manifestFor("evil-utils", "1.1.0"), wantErr: "contains the manifest of evil-utils@1.1.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := registrytest.New()
+			archive, err := registrytest.Archive(map[string]string{
+				"Bifrost.toml": tt.manifest,
+				"src/main.crl": "grim Main:",
+			})
+			if err != nil {
+				t.Fatalf("failed to build archive: %v", err)
+			}
+			reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.1.0"}, archive)
+
+			cfg := newTestConfig(t, registrytest.URL)
+			installer := New(cfg)
+			installer.SetClient(reg.Client())
+			installer.SetOutput(io.Discard)
+
+			err = installer.InstallPackageByName("json-utils", "1.1.0", false)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("InstallPackageByName() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("InstallPackageByName() error = %v, want containing %q", err, tt.wantErr)
+			}
+			if _, err := os.Stat(cfg.LocalPackagePath("json-utils", "1.1.0")); !os.IsNotExist(err) {
+				t.Errorf("mislabeled package left installed: %v", err)
+			}
+		})
+	}
+}
+
+func TestInstaller_ChecksumMismatch(t *testing.T) {
+	reg := registrytest.New()
+	archive, err := registrytest.Archive(map[string]string{"src/main.crl": "grim Main:"})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0", Checksum: "sha256:0000"}, archive)
+
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+
+	err = installer.InstallPackageByName("json-utils", "1.0.0", false)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("InstallPackageByName() error = %v, want checksum mismatch", err)
+	}
+	if code := errcode.Of(err); code != errcode.ChecksumMismatch {
+		t.Errorf("error code = %q, want %s", code, errcode.ChecksumMismatch)
+	}
+	if _, err := os.Stat(cfg.CachePath("json-utils-1.0.0.tar.gz")); !os.IsNotExist(err) {
+		t.Error("mismatched archive was left in the cache")
+	}
+	if _, err := os.Stat(cfg.LocalPackagePath("json-utils", "1.0.0")); !os.IsNotExist(err) {
+		t.Error("mismatched archive was installed")
+	}
+}
+
+func TestInstaller_RejectsUnsafeArchiveNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"parent directory", map[string]string{"../escape.crl": "x"}},
+		{"case collision", map[string]string{"src/main.crl": "a", "src/Main.crl": "b"}},
+		{"control character", map[string]string{"src/ma\x1bin.crl": "x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := registrytest.New()
+			archive, err := registrytest.Archive(tt.files)
+			if err != nil {
+				t.Fatalf("failed to build archive: %v", err)
+			}
+			reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0"}, archive)
+
+			cfg := newTestConfig(t, registrytest.URL)
+			installer := New(cfg)
+			installer.SetClient(reg.Client())
+
+			err = installer.InstallPackageByName("json-utils", "1.0.0", false)
+			if err == nil || !strings.Contains(err.Error(), "refusing to extract") {
+				t.Fatalf("InstallPackageByName() error = %v, want the archive rejected", err)
+			}
+			if _, err := os.Stat(cfg.LocalPackagePath("json-utils", "1.0.0")); !os.IsNotExist(err) {
+				t.Error("rejected archive was left installed")
+			}
+			if _, err := os.Stat(filepath.Join(filepath.Dir(cfg.LocalPackagePath("json-utils", "1.0.0")), "escape.crl")); !os.IsNotExist(err) {
+				t.Error("archive wrote outside the install directory")
+			}
+		})
+	}
+}
+
+func TestInstaller_PlanReusesCache(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+
+	if err := installer.InstallPackageByName("json-utils", "1.0.0", false); err != nil {
+		t.Fatalf("InstallPackageByName() error = %v", err)
+	}
+
+	cfg.ModulesDir = filepath.Join(t.TempDir(), "carrion_modules")
+	plan, err := installer.PlanPackageByName("json-utils", "1.0.0", false)
+	if err != nil {
+		t.Fatalf("PlanPackageByName() error = %v", err)
+	}
+	if len(plan.Actions) != 2 || plan.Actions[0].Action != ActionReuseCache || plan.Actions[1].Action != ActionExtract {
+		t.Errorf("plan = %+v, want reuse-cache then extract", plan.Actions)
+	}
+}
+
+func TestInstaller_Outdated(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0", "1.2.0", "2.0.0", "2.1.0-alpha", "2.1.0-beta.10", "2.1.0-beta.2", "1.3.0-rc.1"})
+	archive, err := registrytest.Archive(map[string]string{"src/main.crl": "http-client"})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "http-client", Version: "2.0.0"}, archive)
+
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte(`[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+json-utils = "1.0.0"
+http-client = "^2.0.0"
+`), 0644)
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+
+	// Loosen the constraint without reinstalling
+	os.WriteFile(manifestPath, []byte(`[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+json-utils = "^1.0.0"
+http-client = "^2.0.0"
+`), 0644)
+
+	outdated, err := installer.Outdated(manifestPath)
+	if err != nil {
+		t.Fatalf("Outdated() error = %v", err)
+	}
+	want := []Outdated{{
+		Name:             "json-utils",
+		Constraint:       "^1.0.0",
+		Current:          "1.0.0",
+		Wanted:           "1.2.0",
+		Latest:           "2.0.0",
+		LatestPrerelease: "2.1.0-beta.10",
+		Registry:         registrytest.URL,
+	}}
+	if !reflect.DeepEqual(outdated, want) {
+		t.Errorf("Outdated() = %+v, want %+v", outdated, want)
+	}
+}
+
+func TestInstaller_Changelog(t *testing.T) {
+	const text = `# Changelog
+
+## [1.2.0]
+- Streaming parser
+
+## [1.1.0]
+- Faster encoding
+
+## [1.0.0]
+- Initial release
+`
+	reg := registrytest.New()
+	archive, err := registrytest.Archive(map[string]string{"CHANGELOG.md": text, "src/main.crl": "grim Main:"})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.2.0", Changelog: "CHANGELOG.md"}, archive)
+	reg.AddPackage(registry.PackageInfo{Name: "http-client", Version: "1.0.0"}, archive)
+
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	entries, err := installer.Changelog("json-utils", "1.0.0", "1.2.0")
+	if err != nil {
+		t.Fatalf("Changelog() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].Version != "1.2.0" || entries[1].Body != "- Faster encoding" {
+		t.Errorf("Changelog() = %+v, want the 1.2.0 and 1.1.0 entries", entries)
+	}
+	if _, err := os.Stat(cfg.CachePath("json-utils-1.2.0.tar.gz")); err != nil {
+		t.Errorf("archive read for the changelog not cached: %v", err)
+	}
+
+	if _, err := installer.Changelog("http-client", "", "1.0.0"); !errors.Is(err, changelog.ErrNoChangelog) {
+		t.Errorf("Changelog() without a declared changelog error = %v, want ErrNoChangelog", err)
+	}
+}
+
+func TestInstaller_InstallScripts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("install scripts in this test use sh")
+	}
+	manifest := `[package]
+name = "json-utils"
+version = "1.0.0"
+
+[scripts]
+postinstall = "echo built > generated.txt"
+test = "exit 1"
+
+[bin]
+json-fmt = "bin/json-fmt.crl"
+`
+	tests := []struct {
+		name         string
+		strict       bool
+		allowScripts bool
+		wantErr      bool
+		wantRun      bool
+	}{
+		{name: "default skips scripts"},
+		{name: "allowed scripts", allowScripts: true, wantRun: true},
+		{name: "strict refuses scripts", strict: true, wantErr: true},
+		{name: "strict with allowed scripts", strict: true, allowScripts: true, wantRun: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := registrytest.New()
+			archive, err := registrytest.Archive(map[string]string{"Bifrost.toml": manifest, "src/main.crl": "grim Main:"})
+			if err != nil {
+				t.Fatalf("failed to build archive: %v", err)
+			}
+			reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0"}, archive)
+
+			cfg := newTestConfig(t, registrytest.URL)
+			installer := New(cfg)
+			installer.SetClient(reg.Client())
+			installer.SetOutput(io.Discard)
+			installer.SetStrict(tt.strict)
+			installer.SetAllowScripts(tt.allowScripts)
+			var warnings strings.Builder
+			warn.SetOutput(&warnings)
+			defer warn.SetOutput(os.Stderr)
+
+			err = installer.InstallPackageByName("json-utils", "1.0.0", false)
+			for _, want := range []string{"Warning [package]: json-utils@1.0.0 provides executables: json-fmt", "Warning [package]: json-utils@1.0.0 runs install scripts:\n  postinstall: echo built > generated.txt"} {
+				if !strings.Contains(warnings.String(), want) {
+					t.Errorf("warnings missing %q:\n%s", want, warnings.String())
+				}
+			}
+			installPath := cfg.LocalPackagePath("json-utils", "1.0.0")
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "--allow-scripts") {
+					t.Fatalf("InstallPackageByName() error = %v, want refusal", err)
+				}
+				if _, err := os.Stat(installPath); !os.IsNotExist(err) {
+					t.Errorf("refused package left installed: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InstallPackageByName() error = %v", err)
+			}
+			data, err := os.ReadFile(filepath.Join(installPath, "generated.txt"))
+			if !tt.wantRun {
+				// A plain install never runs package code
+				if !os.IsNotExist(err) {
+					t.Errorf("install without allowed scripts ran postinstall: %q, %v", data, err)
+				}
+				return
+			}
+			if err != nil || string(data) != "built\n" {
+				t.Errorf("postinstall output = %q, %v", data, err)
+			}
+		})
+	}
+}
+
+func TestInstaller_ScriptTrust(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("install scripts in this test use sh")
+	}
+	reg := registrytest.New()
+	archive, err := registrytest.Archive(map[string]string{
+		"Bifrost.toml": "[package]\nname = \"json-utils\"\nversion = \"1.0.0\"\n\n[scripts]\npostinstall = \"true\"\n",
+		"src/main.crl": "grim Main:",
+	})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0"}, archive)
+
+	cfg := newTestConfig(t, registrytest.URL)
+	prompts := 0
+	installWith := func(strict bool, answer bool) error {
+		os.RemoveAll(cfg.ModulesDir)
+		installer := New(cfg)
+		installer.SetClient(reg.Client())
+		installer.SetOutput(io.Discard)
+		installer.SetStrict(strict)
+		installer.SetScriptPrompt(func(name, version string) (bool, error) {
+			prompts++
+			return answer, nil
+		})
+		return installer.InstallPackageByName("json-utils", "1.0.0", false)
+	}
+
+	// The first strict install asks, later ones remember the answer
+	if err := installWith(true, true); err != nil {
+		t.Fatalf("install after allowing scripts error = %v", err)
+	}
+	if err := installWith(true, false); err != nil {
+		t.Fatalf("install of an allowed version error = %v", err)
+	}
+	if prompts != 1 {
+		t.Errorf("prompted %d times, want 1", prompts)
+	}
+
+	// A denial is remembered and refuses the version even outside strict
+	// mode
+	store, err := trust.Load(cfg.TrustPath())
+	if err != nil || len(store.Revoke("json-utils", "")) != 1 {
+		t.Fatalf("trust decisions = %+v, %v", store, err)
+	}
+	if err := store.Save(cfg.TrustPath()); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := installWith(true, false); err == nil || !strings.Contains(err.Error(), "bifrost trust revoke json-utils@1.0.0") {
+		t.Fatalf("install after denying scripts error = %v", err)
+	}
+	if err := installWith(false, true); err == nil {
+		t.Fatal("install of a denied version outside strict mode succeeded")
+	}
+	if prompts != 2 {
+		t.Errorf("prompted %d times, want 2", prompts)
+	}
+}
+
+func TestInstaller_PackageIndex(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+
+	tests := []struct {
+		name string
+		// setUp changes the registry after its index was published
+		setUp   func(reg *registrytest.Registry)
+		signer  ed25519.PrivateKey
+		wantErr string
+	}{
+		{name: "archive matches the signed index"},
+		{
+			name: "archive replaced on the download host",
+			setUp: func(reg *registrytest.Registry) {
+				archive, _ := registrytest.Archive(map[string]string{"src/main.crl": "grim Evil:"})
+				reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0"}, archive)
+			},
+			wantErr: "package index lists",
+		},
+		{name: "index signed with another key", signer: otherKey, wantErr: "does not match the index key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := newTestRegistry(t, "json-utils", []string{"1.0.0"})
+			signer := priv
+			if tt.signer != nil {
+				signer = tt.signer
+			}
+			reg.SetIndexKey(signer)
+			reg.SetIndex(reg.Index())
+			if tt.setUp != nil {
+				tt.setUp(reg)
+			}
+
+			cfg := newTestConfig(t, registrytest.URL)
+			userConfig, _ := cfg.LoadUserConfig()
+			userConfig.Registry.Index = registrytest.URL + registrytest.IndexPath
+			userConfig.Registry.IndexKey = locksign.Encode(pub)
+			if err := cfg.SaveUserConfig(userConfig); err != nil {
+				t.Fatalf("SaveUserConfig() error = %v", err)
+			}
+			installer := New(cfg)
+			installer.SetClient(reg.Client())
+			installer.SetOutput(io.Discard)
+
+			err := installer.InstallPackageByName("json-utils", "1.0.0", false)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("InstallPackageByName() error = %v", err)
+				}
+				if requests := strings.Join(reg.Requests(), "\n"); !strings.Contains(requests, "GET "+registrytest.IndexPath) {
+					t.Errorf("index not fetched; requests:\n%s", requests)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || errcode.Of(err) != errcode.ChecksumMismatch {
+				t.Fatalf("InstallPackageByName() error = %v, want %q", err, tt.wantErr)
+			}
+			if _, err := os.Stat(cfg.LocalPackagePath("json-utils", "1.0.0")); !os.IsNotExist(err) {
+				t.Errorf("package left installed: %v", err)
+			}
+		})
+	}
+}
+
+func TestInstaller_UpdateIndexes(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0", "1.2.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+
+	if _, missing, err := installer.SearchIndexes("json"); err != nil || len(missing) != 1 {
+		t.Fatalf("SearchIndexes() before an update missing = %v, %v", missing, err)
+	}
+
+	results, err := installer.UpdateIndexes()
+	if err != nil || len(results) != 1 || !results[0].Updated || results[0].Packages != 1 || results[0].Error != "" {
+		t.Fatalf("UpdateIndexes() = %+v, %v", results, err)
+	}
+	// Nothing changed, so the index is not downloaded again
+	results, err = installer.UpdateIndexes()
+	if err != nil || len(results) != 1 || results[0].Updated || results[0].Packages != 1 {
+		t.Fatalf("UpdateIndexes() of an unchanged index = %+v, %v", results, err)
+	}
+
+	// Searching works offline
+	matches, missing, err := New(cfg).SearchIndexes("JSON")
+	if err != nil || len(missing) != 0 {
+		t.Fatalf("SearchIndexes() missing = %v, %v", missing, err)
+	}
+	want := []IndexMatch{{Name: "json-utils", Latest: "1.2.0", Versions: 2, Registry: config.DefaultRegistryName}}
+	if !reflect.DeepEqual(matches, want) {
+		t.Errorf("SearchIndexes() = %+v, want %+v", matches, want)
+	}
+}
+
+func TestScriptEnv(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "json-utils")
+	sep := string(os.PathListSeparator)
+	env := scriptEnv([]string{
+		"HOME=/home/dev",
+		"LC_ALL=C",
+		"AWS_SECRET_ACCESS_KEY=secret",
+		"BIFROST_API_KEY=secret",
+		"PATH=" + strings.Join([]string{".", filepath.Join(string(filepath.Separator), "usr", "bin"), "bin"}, sep),
+	}, dir)
+
+	want := []string{
+		"HOME=/home/dev",
+		"LC_ALL=C",
+		"PATH=" + filepath.Join(dir, "bin") + sep + filepath.Join(string(filepath.Separator), "usr", "bin"),
+		"PWD=" + dir,
+	}
+	if strings.Join(env, "\n") != strings.Join(want, "\n") {
+		t.Errorf("scriptEnv() = %q, want %q", env, want)
+	}
+}
+
+func TestInstaller_InstallScriptsSandbox(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("install scripts in this test use sh")
+	}
+	t.Setenv("BIFROST_TEST_TOKEN", "secret")
+
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{name: "scrubbed environment", script: `echo "token=$BIFROST_TEST_TOKEN pwd=$PWD" > env.txt`},
+		{name: "timeout", script: "sleep 10", wantErr: "timed out after 200ms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := registrytest.New()
+			manifest := fmt.Sprintf("[package]\nname = \"json-utils\"\nversion = \"1.0.0\"\n\n[scripts]\npostinstall = %q\n", tt.script)
+			archive, err := registrytest.Archive(map[string]string{"Bifrost.toml": manifest, "src/main.crl": "grim Main:"})
+			if err != nil {
+				t.Fatalf("failed to build archive: %v", err)
+			}
+			reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0"}, archive)
+
+			cfg := newTestConfig(t, registrytest.URL)
+			installer := New(cfg)
+			installer.SetClient(reg.Client())
+			var out strings.Builder
+			installer.SetOutput(&out)
+			installer.SetAllowScripts(true)
+			installer.SetScriptTimeout(200 * time.Millisecond)
+
+			err = installer.InstallPackageByName("json-utils", "1.0.0", false)
+			if !strings.Contains(out.String(), "Running postinstall script of json-utils@1.0.0 in ") {
+				t.Errorf("output does not log the script command line:\n%s", out.String())
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("InstallPackageByName() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InstallPackageByName() error = %v", err)
+			}
+			installPath := cfg.LocalPackagePath("json-utils", "1.0.0")
+			data, err := os.ReadFile(filepath.Join(installPath, "env.txt"))
+			if want := "token= pwd="; err != nil || !strings.HasPrefix(string(data), want) {
+				t.Errorf("script environment = %q, %v, want %q...", data, err, want)
+			}
+		})
+	}
+}
+
+func TestInstaller_Policy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("install scripts in this test use sh")
+	}
+	scriptManifest := `[package]
+name = "json-utils"
+version = "1.0.0"
+
+[scripts]
+postinstall = "echo built > generated.txt"
+`
+	tests := []struct {
+		name   string
+		policy string
+		// signed serves a package index signing the package's checksum
+		signed  bool
+		wantErr string
+	}{
+		{name: "allowed registry", policy: `allowed_registries = ["` + registrytest.URL + `/"]`},
+		{name: "disallowed registry", policy: `allowed_registries = ["https://registry.acme.internal"]`, wantErr: "is not allowed by policy"},
+		{name: "blocked version", policy: "[[blocked]]\nname = \"json-utils\"\nversions = \">=0.1.0, <2.0.0\"\nreason = \"CVE-2024-1234\"\n", wantErr: "CVE-2024-1234"},
+		{name: "other version blocked", policy: "[[blocked]]\nname = \"json-utils\"\nversions = \"2.0.0\"\n"},
+		{name: "forbidden install scripts", policy: "forbid_install_scripts = true", wantErr: "which policy"},
+		{name: "disallowed license", policy: `allowed_licenses = ["MIT"]`, wantErr: "declares no license"},
+		{name: "required signature without an index", policy: "require_signatures = true", wantErr: "requires signed packages"},
+		{name: "required signature from a signed index", policy: "require_signatures = true", signed: true},
+	}
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policyPath := filepath.Join(t.TempDir(), policy.FileName)
+			if err := os.WriteFile(policyPath, []byte(tt.policy), 0644); err != nil {
+				t.Fatalf("failed to write policy: %v", err)
+			}
+			pol, err := policy.LoadFile(policyPath)
+			if err != nil {
+				t.Fatalf("LoadFile() error = %v", err)
+			}
+
+			reg := registrytest.New()
+			archive, err := registrytest.Archive(map[string]string{"Bifrost.toml": scriptManifest, "src/main.crl": "grim Main:"})
+			if err != nil {
+				t.Fatalf("failed to build archive: %v", err)
+			}
+			reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0"}, archive)
+
+			cfg := newTestConfig(t, registrytest.URL)
+			if tt.signed {
+				reg.SetIndexKey(priv)
+				reg.SetIndex(reg.Index())
+				userConfig, _ := cfg.LoadUserConfig()
+				userConfig.Registry.Index = registrytest.URL + registrytest.IndexPath
+				userConfig.Registry.IndexKey = locksign.Encode(pub)
+				if err := cfg.SaveUserConfig(userConfig); err != nil {
+					t.Fatalf("SaveUserConfig() error = %v", err)
+				}
+			}
+			installer := New(cfg)
+			installer.SetClient(reg.Client())
+			installer.SetOutput(io.Discard)
+			installer.SetAllowScripts(true)
+			installer.SetPolicy(pol)
+
+			err = installer.InstallPackageByName("json-utils", "1.0.0", false)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("InstallPackageByName() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("InstallPackageByName() error = %v, want containing %q", err, tt.wantErr)
+			}
+			if _, err := os.Stat(cfg.LocalPackagePath("json-utils", "1.0.0")); !os.IsNotExist(err) {
+				t.Errorf("refused package left installed: %v", err)
+			}
+		})
+	}
+}
+
+func TestInstaller_InstallLocked(t *testing.T) {
+	t.Setenv(locksign.PrivateKeyEnv, "")
+	t.Setenv(locksign.PublicKeyEnv, "")
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0", "1.2.0", "2.0.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	lockPath := filepath.Join(projectDir, lockfile.FileName)
+	writeManifest := func(constraint string) {
+		os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\njson-utils = \""+constraint+"\"\n"), 0644)
+	}
+	writeManifest("~1.0.0")
+
+	if err := installer.InstallLocked(manifestPath); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("InstallLocked() without a lockfile error = %v", err)
+	}
+
+	// The project signs its lockfile, so installing re-signs it
+	pub, priv, err := locksign.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	os.WriteFile(locksign.PublicKeyPath(lockPath), []byte(locksign.Encode(pub)), 0644)
+	if _, err := locksign.SavePrivateKey(cfg, priv); err != nil {
+		t.Fatalf("SavePrivateKey() error = %v", err)
+	}
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	if err := locksign.Verify(lockPath, pub); err != nil {
+		t.Errorf("Verify() after install error = %v", err)
+	}
+
+	os.RemoveAll(cfg.ModulesDir)
+	if err := installer.InstallLocked(manifestPath); err != nil {
+		t.Fatalf("InstallLocked() error = %v", err)
+	}
+	if !cfg.LocalPackageInstalled("json-utils", "1.0.0") {
+		t.Error("InstallLocked() did not install the locked version")
+	}
+
+	writeManifest("^2.0.0")
+	if err := installer.InstallLocked(manifestPath); err == nil || !strings.Contains(err.Error(), "out of date") {
+		t.Errorf("InstallLocked() with a stale lockfile error = %v", err)
+	}
+}
+
+func TestInstaller_InstallLockedDrift(t *testing.T) {
+	t.Setenv(locksign.PrivateKeyEnv, "")
+	t.Setenv(locksign.PublicKeyEnv, "")
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0", "1.2.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	writeManifest := func(description, dependencies string) {
+		os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\ndescription = \""+description+"\"\n\n[dependencies]\n"+dependencies), 0644)
+	}
+	writeManifest("An app", "json-utils = \"~1.0.0\"\n")
+
+	lock, err := installer.InstallManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	m, _ := manifest.Load(manifestPath)
+	if lock.ManifestHash != m.DependencyHash() {
+		t.Errorf("ManifestHash = %q, want %q", lock.ManifestHash, m.DependencyHash())
+	}
+
+	tests := []struct {
+		name         string
+		description  string
+		dependencies string
+		wantErr      string
+	}{
+		{name: "unrelated edit", description: "A renamed app", dependencies: "json-utils = \"~1.0.0\"\n"},
+		// The locked version still satisfies the new constraint, but the
+		// lockfile was not resolved from it
+		{name: "constraint changed", description: "An app", dependencies: "json-utils = \"^1.0.0\"\n", wantErr: "changed since it was written"},
+		{name: "dependency removed", description: "An app", dependencies: "", wantErr: "changed since it was written"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeManifest(tt.description, tt.dependencies)
+			err := installer.InstallLocked(manifestPath)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("InstallLocked() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || errcode.Of(err) != errcode.LockfileOutOfDate {
+				t.Errorf("InstallLocked() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInstaller_NormalizesPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows does not have Unix permissions")
+	}
+
+	// An archive recording modes the install should not keep
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	entries := []struct {
+		name string
+		mode int64
+	}{
+		{name: "src/", mode: 0700},
+		{name: "src/main.crl", mode: 0600},
+		{name: "bin/run.sh", mode: 0777},
+	}
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: e.mode, Typeflag: tar.TypeReg}
+		if strings.HasSuffix(e.name, "/") {
+			hdr.Typeflag = tar.TypeDir
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write archive: %v", err)
+		}
+	}
+	tw.Close()
+	gw.Close()
+
+	tests := []struct {
+		name              string
+		dirMode, fileMode os.FileMode
+		wantDir, wantFile os.FileMode
+		wantExec          os.FileMode
+	}{
+		{name: "defaults", wantDir: 0755, wantFile: 0644, wantExec: 0755},
+		{name: "configured", dirMode: 0750, fileMode: 0640, wantDir: 0750, wantFile: 0640, wantExec: 0750},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := registrytest.New()
+			reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0"}, buf.Bytes())
+			cfg := newTestConfig(t, registrytest.URL)
+			installer := New(cfg)
+			installer.SetClient(reg.Client())
+			installer.SetOutput(io.Discard)
+			installer.SetModes(tt.dirMode, tt.fileMode)
+
+			if err := installer.InstallPackageByName("json-utils", "1.0.0", false); err != nil {
+				t.Fatalf("InstallPackageByName() error = %v", err)
+			}
+			installPath := cfg.LocalPackagePath("json-utils", "1.0.0")
+			for path, want := range map[string]os.FileMode{
+				"src":          tt.wantDir,
+				"src/main.crl": tt.wantFile,
+				"bin/run.sh":   tt.wantExec,
+			} {
+				info, err := os.Stat(filepath.Join(installPath, path))
+				if err != nil {
+					t.Fatalf("failed to stat %s: %v", path, err)
+				}
+				if got := info.Mode().Perm(); got != want {
+					t.Errorf("mode of %s = %04o, want %04o", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestInstaller_PathsWithSpacesAndUnicode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("install scripts in this test use sh")
+	}
+	reg := registrytest.New()
+	archive, err := registrytest.Archive(map[string]string{
+		"Bifrost.toml":        "[package]\nname = \"json-utils\"\nversion = \"1.0.0\"\n\n[scripts]\npostinstall = \"echo built > 'généré.txt'\"\n",
+		"src/main.crl":        "grim Main:",
+		"données/exemple.crl": "grim Exemple:",
+		"with space/file.crl": "grim Space:",
+	})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0"}, archive)
+
+	tempDir := t.TempDir()
+	cfg := config.NewWithHome(filepath.Join(tempDir, "Carrion Home", "données"))
+	cfg.RegistryURL = registrytest.URL
+	projectDir := filepath.Join(tempDir, "my projects", "приложение")
+	cfg.ModulesDir = filepath.Join(projectDir, "carrion_modules")
+	if err := cfg.Init(); err != nil {
+		t.Fatalf("failed to init config: %v", err)
+	}
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\njson-utils = \"^1.0.0\"\n"), 0644)
+
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+	installer.SetAllowScripts(true)
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+
+	installPath := cfg.LocalPackagePath("json-utils", "1.0.0")
+	for _, name := range []string{"src/main.crl", "données/exemple.crl", "with space/file.crl", "généré.txt"} {
+		if _, err := os.Stat(filepath.Join(installPath, filepath.FromSlash(name))); err != nil {
+			t.Errorf("%s not installed: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, lockfile.FileName)); err != nil {
+		t.Errorf("lockfile not written: %v", err)
+	}
+	if entries, _ := os.ReadDir(cfg.CacheDir); len(entries) == 0 {
+		t.Error("archive not cached under CARRION_HOME")
+	}
+}
+
+func TestInstaller_Fetch(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0", "1.2.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\njson-utils = \"^1.0.0\"\n"), 0644)
+
+	pkgs, err := installer.Fetch(manifestPath)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if len(pkgs) != 1 || pkgs[0].Version.String() != "1.2.0" {
+		t.Errorf("Fetch() = %v, want json-utils@1.2.0", pkgs)
+	}
+	if _, err := os.Stat(cfg.CachePath("json-utils-1.2.0.tar.gz")); err != nil {
+		t.Errorf("archive not cached: %v", err)
+	}
+	if _, err := os.Stat(cfg.ModulesDir); !os.IsNotExist(err) {
+		t.Errorf("fetch created %s: %v", cfg.ModulesDir, err)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, lockfile.FileName)); !os.IsNotExist(err) {
+		t.Errorf("fetch wrote the lockfile: %v", err)
+	}
+
+	// The install that follows takes the archive from the cache
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	if r := installer.Report(); len(r.Downloads) != 0 || r.CacheHits != 1 {
+		t.Errorf("install after fetch report = %+v, want one cache hit", r)
+	}
+
+	if _, err := installer.FetchLocked(manifestPath); err != nil {
+		t.Fatalf("FetchLocked() error = %v", err)
+	}
+	if r := installer.Report(); r.CacheHits != 1 {
+		t.Errorf("FetchLocked() report = %+v, want one cache hit", r)
+	}
+}
+
+func TestLockConflicts(t *testing.T) {
+	lock := lockfile.New()
+	lock.Set(lockfile.Package{Name: "json-utils", Version: "1.2.0", Constraint: "^1.0.0"})
+	lock.Set(lockfile.Package{Name: "http", Version: "2.0.0", PackageName: "http-client"})
+	lock.Set(lockfile.Package{Name: "yaml", Version: "0.3.0"})
+
+	tests := []struct {
+		name     string
+		manifest string
+		want     []string
+	}{
+		{
+			name:     "locks still satisfied",
+			manifest: "json-utils = \"^1.1.0\"\nhttp = { package = \"http-client\", version = \"^2.0.0\" }\nyaml = \"~0.3.0\"\nnew-dep = \"^1.0.0\"\n",
+		},
+		{
+			name:     "constraint changed",
+			manifest: "json-utils = \"^2.0.0\"\nyaml = \"^1.0.0\"\n",
+			want: []string{
+				`json-utils is locked to 1.2.0, which does not satisfy "^2.0.0" (the constraint changed from "^1.0.0")`,
+				`yaml is locked to 0.3.0, which does not satisfy "^1.0.0"`,
+			},
+		},
+		{
+			name:     "alias target changed",
+			manifest: "http = { package = \"http-fast\", version = \"^2.0.0\" }\n",
+			want:     []string{"http is locked to package http-client, but Bifrost.toml now installs it from http-fast"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "Bifrost.toml")
+			os.WriteFile(path, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\n"+tt.manifest), 0644)
+			m, err := manifest.Load(path)
+			if err != nil {
+				t.Fatalf("failed to load manifest: %v", err)
+			}
+
+			conflicts, err := LockConflicts(m, lock)
+			if err != nil {
+				t.Fatalf("LockConflicts() error = %v", err)
+			}
+			var got []string
+			for _, c := range conflicts {
+				got = append(got, c.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LockConflicts() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstaller_InstallManifestExplainsLockConflicts(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.2.0", "2.0.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	var output bytes.Buffer
+	installer.SetOutput(&output)
+
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	writeManifest := func(constraint string) {
+		os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\njson-utils = \""+constraint+"\"\n"), 0644)
+	}
+	writeManifest("^1.0.0")
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+
+	writeManifest("^2.0.0")
+	err := installer.InstallLocked(manifestPath)
+	if err == nil || !strings.Contains(err.Error(), `(the constraint changed from "^1.0.0")`) || !strings.Contains(err.Error(), "re-resolve json-utils") {
+		t.Errorf("InstallLocked() error = %v, want the changed constraint explained", err)
+	}
+
+	output.Reset()
+	lock, err := installer.InstallManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	if !strings.Contains(output.String(), `json-utils is locked to 1.2.0, which does not satisfy "^2.0.0"`) {
+		t.Errorf("install output = %q, want the conflict explained", output.String())
+	}
+	if locked := lock.Find("json-utils"); locked == nil || locked.Version != "2.0.0" || locked.Constraint != "^2.0.0" {
+		t.Errorf("locked json-utils = %+v, want 2.0.0 under ^2.0.0", locked)
+	}
+}
+
+func TestInstaller_InstallManifestReResolvesOnlyConflicts(t *testing.T) {
+	reg := registrytest.New()
+	addPackage := func(name, v string) {
+		archive, err := registrytest.Archive(map[string]string{"src/main.crl": name + " " + v})
+		if err != nil {
+			t.Fatalf("failed to build archive: %v", err)
+		}
+		reg.AddPackage(registry.PackageInfo{Name: name, Version: v}, archive)
+	}
+	addPackage("json-utils", "1.2.0")
+	addPackage("json-utils", "2.0.0")
+	addPackage("http-client", "1.0.0")
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	writeManifest := func(constraint string) {
+		os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\nhttp-client = \"^1.0.0\"\njson-utils = \""+constraint+"\"\n"), 0644)
+	}
+	writeManifest("^1.0.0")
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+
+	addPackage("http-client", "1.1.0")
+	writeManifest("^2.0.0")
+	lock, err := installer.InstallManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	if locked := lock.Find("json-utils"); locked == nil || locked.Version != "2.0.0" {
+		t.Errorf("locked json-utils = %+v, want the conflicting dependency moved to 2.0.0", locked)
+	}
+	if locked := lock.Find("http-client"); locked == nil || locked.Version != "1.0.0" {
+		t.Errorf("locked http-client = %+v, want 1.0.0 kept", locked)
+	}
+}
@@ -0,0 +1,201 @@
+package install
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/errcode"
+	"github.com/javanhut/bifrost/internal/freeze"
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/locksign"
+	"github.com/javanhut/bifrost/internal/manifest"
+	ver "github.com/javanhut/bifrost/internal/version"
+	"github.com/javanhut/bifrost/internal/warn"
+)
+
+// InstallLocked installs exactly the packages in the lockfile next to the
+// manifest at manifestPath, without resolving dependencies or rewriting the
+// lockfile. It fails when there is no lockfile or it no longer satisfies the
+// manifest's dependencies.
+func (i *Installer) InstallLocked(manifestPath string) error {
+	entries, err := i.lockedEntries(manifestPath)
+	if err != nil {
+		return err
+	}
+	return i.InstallFrozen(entries)
+}
+
+// lockedEntries returns the packages locked for the manifest at
+// manifestPath, once the lockfile is known to still satisfy it
+func (i *Installer) lockedEntries(manifestPath string) ([]freeze.Entry, error) {
+	m, err := i.loadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	lockPath := i.lockPath(manifestPath)
+	lock, err := lockfile.LoadIfExists(lockPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lockfile: %w", err)
+	}
+	if lock == nil {
+		return nil, fmt.Errorf("%s not found; run 'bifrost install' to create it", lockPath)
+	}
+	if err := checkLocked(m, lock); err != nil {
+		return nil, err
+	}
+	return freeze.FromLockfile(lock), nil
+}
+
+// Conflict is a dependency whose locked version the manifest no longer
+// admits
+type Conflict struct {
+	Name string
+	// Locked is the locked version and Constraint the manifest's current
+	// constraint for it
+	Locked     string
+	Constraint string
+	// Previous is the constraint the version was locked under, when the
+	// lockfile recorded it
+	Previous string
+	// LockedPackage and Package are the registry packages locked and now
+	// wanted, when the dependency became an alias of another package
+	LockedPackage string
+	Package       string
+}
+
+func (c Conflict) String() string {
+	if c.Package != c.LockedPackage {
+		return fmt.Sprintf("%s is locked to package %s, but %s now installs it from %s", c.Name, c.LockedPackage, manifest.FileName, c.Package)
+	}
+	s := fmt.Sprintf("%s is locked to %s, which does not satisfy %q", c.Name, c.Locked, c.Constraint)
+	if c.Previous != "" && c.Previous != c.Constraint {
+		s += fmt.Sprintf(" (the constraint changed from %q)", c.Previous)
+	}
+	return s
+}
+
+// LockConflicts returns the dependencies of m that are locked to a version
+// or package m no longer admits, in name order. Dependencies that are not
+// locked yet are not conflicts.
+func LockConflicts(m *manifest.Manifest, lock *lockfile.Lockfile) ([]Conflict, error) {
+	var conflicts []Conflict
+	for _, name := range sortedKeys(m.Dependencies) {
+		locked := lock.Find(name)
+		if locked == nil {
+			continue
+		}
+		c := Conflict{
+			Name:          name,
+			Locked:        locked.Version,
+			Constraint:    m.Dependencies[name],
+			Previous:      locked.Constraint,
+			LockedPackage: locked.PackageName,
+			Package:       m.PackageName(name),
+		}
+		if c.LockedPackage == "" {
+			c.LockedPackage = locked.Name
+		}
+		if c.Package != c.LockedPackage {
+			conflicts = append(conflicts, c)
+			continue
+		}
+
+		constraint, err := ver.ParseConstraint(c.Constraint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid constraint for %s: %w", name, err)
+		}
+		v, err := ver.Parse(locked.Version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid locked version for %s: %w", name, err)
+		}
+		if !constraint.Satisfies(v) {
+			conflicts = append(conflicts, c)
+		}
+	}
+	return conflicts, nil
+}
+
+// lockedSelection returns the version lock has for the dependency called
+// name when it can stay: it installs pkg, it is still published among
+// available and satisfies constraint, and for a direct dependency of m the
+// constraint is the one it was locked with. Otherwise it returns nil and the
+// dependency is resolved afresh.
+func lockedSelection(lock *lockfile.Lockfile, m *manifest.Manifest, name, pkg string, constraint ver.Constraint, available []string) *ver.Version {
+	if lock == nil {
+		return nil
+	}
+	locked := lock.Find(name)
+	if locked == nil || cmp.Or(locked.PackageName, locked.Name) != pkg {
+		return nil
+	}
+	if c, ok := m.Dependencies[name]; ok && locked.Constraint != "" && locked.Constraint != c {
+		return nil
+	}
+	v, err := ver.Parse(locked.Version)
+	if err != nil {
+		return nil
+	}
+	published := slices.ContainsFunc(available, func(s string) bool {
+		a, err := ver.Parse(s)
+		return err == nil && a.Compare(v) == 0
+	})
+	if !published {
+		return nil
+	}
+	if constraint != nil && !constraint.Satisfies(v) {
+		return nil
+	}
+	return v
+}
+
+// checkLocked returns an error unless every dependency of m is locked to a
+// version of the same package satisfying its constraint, explaining each
+// mismatch. A lockfile whose manifest hash matches m is current without
+// further checks.
+func checkLocked(m *manifest.Manifest, lock *lockfile.Lockfile) error {
+	if lock.ManifestHash != "" && !lock.Drifted(m) {
+		return nil
+	}
+	for _, name := range sortedKeys(m.Dependencies) {
+		if lock.Find(name) == nil {
+			return errcode.LockfileOutOfDate.Errorf("lockfile is out of date: %s is not locked; run 'bifrost install' to lock it", name)
+		}
+	}
+
+	conflicts, err := LockConflicts(m, lock)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) == 0 {
+		// Removed dependencies and new aliases of locked versions leave no
+		// conflict behind, but the hash still tells
+		if lock.Drifted(m) {
+			return errcode.LockfileOutOfDate.Errorf("lockfile is out of date: the dependencies in %s changed since it was written\nrun 'bifrost install' to update %s", manifest.FileName, lockfile.FileName)
+		}
+		return nil
+	}
+	var b strings.Builder
+	names := make([]string, len(conflicts))
+	for n, c := range conflicts {
+		fmt.Fprintf(&b, "\n  %s", c)
+		names[n] = c.Name
+	}
+	return errcode.LockfileOutOfDate.Errorf("lockfile is out of date:%s\nrun 'bifrost install' to re-resolve %s and update %s", b.String(), strings.Join(names, ", "), lockfile.FileName)
+}
+
+// signLock signs the lockfile at lockPath again after it was written, when
+// the project signs its lockfile. Without the project key it only warns, so
+// the stale signature fails the next verification.
+func (i *Installer) signLock(lockPath string) error {
+	if _, err := locksign.Resign(i.config, lockPath); err != nil {
+		if errors.Is(err, locksign.ErrNoSigningKey) {
+			warn.Printf(warn.Integrity, "%v; %s%s no longer matches the lockfile", err, lockfile.FileNameFor(i.config.Profile), locksign.SignatureSuffix)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
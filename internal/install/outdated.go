@@ -0,0 +1,160 @@
+package install
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/metadata"
+	ver "github.com/javanhut/bifrost/internal/version"
+)
+
+// Outdated is a dependency with a newer version published than the one in
+// use
+type Outdated struct {
+	Name string `json:"name"`
+	// Package is the registry package when Name is an alias
+	Package    string `json:"package,omitempty"`
+	Constraint string `json:"constraint,omitempty"`
+	// Current is the installed version, or the locked one when the
+	// dependency is not installed, and empty when it is neither
+	Current string `json:"current,omitempty"`
+	// Wanted is the newest version satisfying Constraint
+	Wanted string `json:"wanted,omitempty"`
+	// Latest is the newest published stable version
+	Latest string `json:"latest"`
+	// LatestPrerelease is the newest published version counting
+	// prereleases, which is Latest unless a prerelease is newer
+	LatestPrerelease string `json:"latest_prerelease"`
+	// Registry is the URL of the registry the package comes from
+	Registry string `json:"registry"`
+	Dev      bool   `json:"dev,omitempty"`
+}
+
+// Outdated lists the dependencies of the project whose manifest is at
+// manifestPath, including locked transitive ones, for which the registry
+// has a newer version than the one in use
+func (i *Installer) Outdated(manifestPath string) ([]Outdated, error) {
+	md, err := metadata.Collect(i.config, manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	client := i.registryClient()
+
+	var outdated []Outdated
+	for _, dep := range md.Dependencies {
+		name := md.Manifest.PackageName(dep.Name)
+		pkgClient, err := i.clientFor(client, name)
+		if err != nil {
+			return nil, err
+		}
+		available, err := pkgClient.ListVersions(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list versions of %s: %w", name, err)
+		}
+		latest := selectVersion(available, nil)
+		if latest == nil {
+			continue
+		}
+
+		entry := Outdated{
+			Name:             dep.Name,
+			Constraint:       dep.Constraint,
+			Current:          dep.Version,
+			Latest:           latest.String(),
+			LatestPrerelease: latest.String(),
+			Registry:         pkgClient.BaseURL(),
+			Dev:              dep.Dev,
+		}
+		if pre := newestPrerelease(available, latest); pre != "" {
+			entry.LatestPrerelease = pre
+		}
+		if name != dep.Name {
+			entry.Package = name
+		}
+		if entry.Current == "" {
+			entry.Current = dep.Locked
+		}
+		if dep.Constraint != "" {
+			constraint, err := ver.ParseConstraint(dep.Constraint)
+			if err != nil {
+				return nil, fmt.Errorf("invalid constraint %q for %s: %w", dep.Constraint, dep.Name, err)
+			}
+			if wanted := selectVersion(available, constraint); wanted != nil {
+				entry.Wanted = wanted.String()
+			}
+		}
+
+		if entry.Current != "" {
+			current, err := ver.Parse(entry.Current)
+			if err == nil && current.Compare(latest) >= 0 {
+				continue
+			}
+		}
+		outdated = append(outdated, entry)
+	}
+	return outdated, nil
+}
+
+// newestPrerelease returns the newest of the available versions with a
+// prerelease suffix, such as "2.1.0-beta.1", when it is newer than stable,
+// and empty otherwise. Prereleases are never selected for install, so they
+// are only reported.
+func newestPrerelease(available []string, stable *ver.Version) string {
+	var newest string
+	var newestBase *ver.Version
+	var newestPre string
+	for _, s := range available {
+		base, pre, ok := splitPrerelease(s)
+		if !ok || base.Compare(stable) <= 0 {
+			continue
+		}
+		if newestBase == nil || base.Compare(newestBase) > 0 ||
+			base.Compare(newestBase) == 0 && comparePrerelease(pre, newestPre) > 0 {
+			newest, newestBase, newestPre = s, base, pre
+		}
+	}
+	return newest
+}
+
+// splitPrerelease splits a version such as "2.1.0-beta.1+build.5" into its
+// release and prerelease parts, ignoring build metadata
+func splitPrerelease(s string) (*ver.Version, string, bool) {
+	s, _, _ = strings.Cut(s, "+")
+	release, pre, ok := strings.Cut(s, "-")
+	if !ok || pre == "" {
+		return nil, "", false
+	}
+	v, err := ver.Parse(release)
+	if err != nil {
+		return nil, "", false
+	}
+	return v, pre, true
+}
+
+// comparePrerelease orders prerelease suffixes of the same release as
+// semantic versioning does: identifier by identifier, numeric ones by value
+// and before alphanumeric ones, and a shorter suffix first when it is a
+// prefix of the other
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for n := 0; n < len(as) && n < len(bs); n++ {
+		an, aErr := strconv.Atoi(as[n])
+		bn, bErr := strconv.Atoi(bs[n])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return an - bn
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[n], bs[n]); c != 0 {
+				return c
+			}
+		}
+	}
+	return len(as) - len(bs)
+}
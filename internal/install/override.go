@@ -0,0 +1,155 @@
+package install
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/link"
+	"github.com/javanhut/bifrost/internal/manifest"
+	"github.com/javanhut/bifrost/internal/resolver"
+	ver "github.com/javanhut/bifrost/internal/version"
+)
+
+// Override substitutes a dependency for a single manifest install, without
+// editing the manifest or the lockfile
+type Override struct {
+	// Name is the dependency name overridden, direct or transitive
+	Name string
+	// Version replaces every constraint on the dependency. For a Path
+	// override it is the version of the package in the directory.
+	Version string
+	// Path is a local package directory linked into the project in place
+	// of the dependency, empty to install Version from the registry
+	Path string
+
+	// manifest is the Bifrost.toml of Path
+	manifest *manifest.Manifest
+}
+
+// ParseOverride parses an --override value, name=version or name=path.
+// Values that parse as a version are versions; write a directory named like
+// one as ./1.2.0. A directory must hold a Bifrost.toml.
+func ParseOverride(value string) (Override, error) {
+	name, target, ok := strings.Cut(value, "=")
+	if !ok || target == "" {
+		return Override{}, fmt.Errorf("invalid override %q: use name=version or name=path", value)
+	}
+	if err := manifest.ValidateName(name); err != nil {
+		return Override{}, fmt.Errorf("invalid override %q: %w", value, err)
+	}
+	if v, err := ver.Parse(target); err == nil {
+		return Override{Name: name, Version: v.String()}, nil
+	}
+
+	path, err := filepath.Abs(target)
+	if err != nil {
+		return Override{}, fmt.Errorf("invalid override %q: %w", value, err)
+	}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return Override{}, fmt.Errorf("invalid override %q: %s is neither a version nor a package directory", value, target)
+	}
+	m, err := manifest.Load(filepath.Join(path, manifest.FileName))
+	if err != nil {
+		return Override{}, fmt.Errorf("invalid override %q: %w", value, err)
+	}
+	v, err := ver.Parse(m.Package.Version)
+	if err != nil {
+		return Override{}, fmt.Errorf("invalid override %q: version of %s: %w", value, path, err)
+	}
+	return Override{Name: name, Version: v.String(), Path: path, manifest: m}, nil
+}
+
+// SetOverrides substitutes dependencies in the manifest installs that
+// follow. Overridden installs leave the lockfile as it was, and the next
+// install without overrides puts the locked packages back.
+func (i *Installer) SetOverrides(overrides []Override) {
+	i.overrides = make(map[string]Override, len(overrides))
+	for _, o := range overrides {
+		i.overrides[o.Name] = o
+	}
+}
+
+// overrideConstraint returns the constraint on the dependency name,
+// replaced by the version it is overridden with
+func (i *Installer) overrideConstraint(name, constraint string) string {
+	if o, ok := i.overrides[name]; ok {
+		return o.Version
+	}
+	return constraint
+}
+
+// overriddenManifest returns m with the constraints of overridden
+// dependencies replaced, leaving m itself alone
+func (i *Installer) overriddenManifest(m *manifest.Manifest) *manifest.Manifest {
+	if len(i.overrides) == 0 {
+		return m
+	}
+	overridden := *m
+	overridden.Dependencies = make(map[string]string, len(m.Dependencies))
+	for name, constraint := range m.Dependencies {
+		overridden.Dependencies[name] = i.overrideConstraint(name, constraint)
+	}
+	return &overridden
+}
+
+// pathPackage returns the package in the directory the dependency name is
+// overridden with, or nil when it is not overridden by a path
+func (i *Installer) pathPackage(name string) (*resolver.Package, error) {
+	o, ok := i.overrides[name]
+	if !ok || o.Path == "" {
+		return nil, nil
+	}
+	v, err := ver.Parse(o.Version)
+	if err != nil {
+		return nil, err
+	}
+	pkg := &resolver.Package{Name: name, Version: v, Dependencies: make(map[string]ver.Constraint)}
+	for depName, constraint := range o.manifest.Dependencies {
+		c, err := ver.ParseConstraint(i.overrideConstraint(depName, constraint))
+		if err != nil {
+			return nil, fmt.Errorf("invalid constraint for %s in %s: %w", depName, o.Path, err)
+		}
+		pkg.Dependencies[depName] = c
+	}
+	return pkg, nil
+}
+
+// checkOverridesUsed fails when an override names a package the resolution
+// does not contain, which is most likely a typo
+func (i *Installer) checkOverridesUsed(resolution *resolver.Resolution) error {
+	for _, name := range sortedKeys(i.overrides) {
+		if _, ok := resolution.Packages[name]; !ok {
+			return fmt.Errorf("override of %s matches no dependency", name)
+		}
+	}
+	return nil
+}
+
+// linkOverride links the directory overriding pkg into the project in
+// place of an installed package
+func (i *Installer) linkOverride(pkg *resolver.Package) (string, error) {
+	o := i.overrides[pkg.Name]
+	installPath := i.config.LocalPackagePath(pkg.Name, pkg.Version.String())
+	if _, err := link.Create(o.Path, installPath); err != nil {
+		return "", fmt.Errorf("failed to link %s: %w", o.Path, err)
+	}
+	i.emit(Event{Kind: EventLinked, Package: pkg.Name, Version: pkg.Version.String(), Path: installPath})
+	i.report.Packages = append(i.report.Packages, Installed{
+		Name:    pkg.Name,
+		Version: pkg.Version.String(),
+		Source:  o.Path,
+		Path:    installPath,
+		Status:  EventLinked,
+	})
+	return installPath, nil
+}
+
+// isOverrideLink reports whether the installed pkg at installPath is a link
+// left by an overridden install rather than the package itself or its copy
+// in the user package directory
+func (i *Installer) isOverrideLink(pkg *resolver.Package, installPath string) bool {
+	source := link.Source(installPath)
+	return source != "" && source != i.config.PackagePath(pkg.Name, pkg.Version.String())
+}
@@ -0,0 +1,156 @@
+package install
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/link"
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+)
+
+// newPackageDir returns a local package directory with a Bifrost.toml of
+// name@version depending on deps
+func newPackageDir(t *testing.T, name, version, deps string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	content := "[package]\nname = \"" + name + "\"\nversion = \"" + version + "\"\n\n[dependencies]\n" + deps
+	if err := os.WriteFile(filepath.Join(dir, "Bifrost.toml"), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	return dir
+}
+
+func TestParseOverride(t *testing.T) {
+	dir := newPackageDir(t, "json-utils", "1.3.0", "")
+	file := filepath.Join(dir, "Bifrost.toml")
+
+	tests := []struct {
+		value   string
+		want    Override
+		wantErr string
+	}{
+		{value: "json-utils=1.2.0", want: Override{Name: "json-utils", Version: "1.2.0"}},
+		{value: "json-utils=" + dir, want: Override{Name: "json-utils", Version: "1.3.0", Path: dir}},
+		{value: "json-utils", wantErr: "use name=version or name=path"},
+		{value: "json-utils=", wantErr: "use name=version or name=path"},
+		{value: "../evil=1.0.0", wantErr: "invalid override"},
+		{value: "json-utils=" + file, wantErr: "neither a version nor a package directory"},
+		{value: "json-utils=" + t.TempDir(), wantErr: "Bifrost.toml"},
+	}
+	for _, tt := range tests {
+		got, err := ParseOverride(tt.value)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseOverride(%q) error = %v, want %q", tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseOverride(%q) error = %v", tt.value, err)
+			continue
+		}
+		if got.Name != tt.want.Name || got.Version != tt.want.Version || got.Path != tt.want.Path {
+			t.Errorf("ParseOverride(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestInstaller_InstallManifestOverride(t *testing.T) {
+	reg := registrytest.New()
+	for _, pkg := range []registry.PackageInfo{
+		{Name: "http-client", Version: "1.0.0", Dependencies: map[string]string{"json-utils": "^1.1.0"}},
+		{Name: "json-utils", Version: "1.0.0"},
+		{Name: "json-utils", Version: "1.1.0"},
+		{Name: "text-utils", Version: "0.2.0"},
+	} {
+		archive, err := registrytest.Archive(map[string]string{"src/main.crl": pkg.Name + " " + pkg.Version})
+		if err != nil {
+			t.Fatalf("failed to build archive: %v", err)
+		}
+		reg.AddPackage(pkg, archive)
+	}
+	cfg := newTestConfig(t, registrytest.URL)
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\nhttp-client = \"^1.0.0\"\n"), 0644)
+
+	newInstaller := func(overrides ...string) *Installer {
+		installer := New(cfg)
+		installer.SetClient(reg.Client())
+		installer.SetOutput(io.Discard)
+		var parsed []Override
+		for _, value := range overrides {
+			o, err := ParseOverride(value)
+			if err != nil {
+				t.Fatalf("ParseOverride(%q) error = %v", value, err)
+			}
+			parsed = append(parsed, o)
+		}
+		installer.SetOverrides(parsed)
+		return installer
+	}
+	if _, err := newInstaller().InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	lockPath := filepath.Join(projectDir, lockfile.FileName)
+	locked, err := os.ReadFile(lockPath)
+	if err != nil {
+		t.Fatalf("failed to read lockfile: %v", err)
+	}
+
+	// A version override wins over the constraints of dependents
+	if _, err := newInstaller("json-utils=1.0.0").InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() with a version override error = %v", err)
+	}
+	if _, err := os.Stat(cfg.LocalPackagePath("json-utils", "1.0.0")); err != nil {
+		t.Errorf("overridden version not installed: %v", err)
+	}
+
+	// A path override links the directory and resolves its dependencies
+	dir := newPackageDir(t, "json-utils", "1.2.0", "text-utils = \"^0.2.0\"\n")
+	if _, err := newInstaller("json-utils=" + dir).InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() with a path override error = %v", err)
+	}
+	if got := link.Source(cfg.LocalPackagePath("json-utils", "1.2.0")); got != dir {
+		t.Errorf("json-utils@1.2.0 links to %q, want %q", got, dir)
+	}
+	if _, err := os.Stat(cfg.LocalPackagePath("text-utils", "0.2.0")); err != nil {
+		t.Errorf("dependency of the overriding directory not installed: %v", err)
+	}
+
+	if data, _ := os.ReadFile(lockPath); string(data) != string(locked) {
+		t.Errorf("overridden installs changed the lockfile:\n%s", data)
+	}
+	if m, _ := os.ReadFile(manifestPath); strings.Contains(string(m), "json-utils") {
+		t.Errorf("overridden installs changed the manifest:\n%s", m)
+	}
+
+	// An override naming no dependency is refused
+	_, err = newInstaller("jsn-utils=1.0.0").InstallManifest(manifestPath)
+	if err == nil || !strings.Contains(err.Error(), "matches no dependency") {
+		t.Errorf("InstallManifest() with an unused override error = %v, want matches no dependency", err)
+	}
+
+	// The next install puts the registry package back in place of a link
+	os.WriteFile(filepath.Join(dir, "Bifrost.toml"), []byte("[package]\nname = \"json-utils\"\nversion = \"1.1.0\"\n"), 0644)
+	if _, err := newInstaller("json-utils=" + dir).InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() with a path override error = %v", err)
+	}
+	if _, err := newInstaller().InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	installPath := cfg.LocalPackagePath("json-utils", "1.1.0")
+	if source := link.Source(installPath); source != "" {
+		t.Errorf("json-utils@1.1.0 still links to %s", source)
+	}
+	if data, err := os.ReadFile(filepath.Join(installPath, "src", "main.crl")); err != nil || string(data) != "json-utils 1.1.0" {
+		t.Errorf("json-utils@1.1.0 contains %q (%v)", data, err)
+	}
+}
@@ -0,0 +1,93 @@
+package install
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	// DefaultDirMode is the permission of extracted directories
+	DefaultDirMode os.FileMode = 0755
+	// DefaultFileMode is the permission of extracted files. Executable
+	// files also get execute permission wherever they are readable.
+	DefaultFileMode os.FileMode = 0644
+)
+
+// SetModes sets the permissions given to extracted directories and files,
+// replacing whatever the archive says. Zero keeps the default.
+func (i *Installer) SetModes(dirMode, fileMode os.FileMode) {
+	if dirMode != 0 {
+		i.dirMode = dirMode
+	}
+	if fileMode != 0 {
+		i.fileMode = fileMode
+	}
+}
+
+// withExecute adds execute permission wherever mode allows reading
+func withExecute(mode os.FileMode) os.FileMode {
+	return mode | (mode&0444)>>2
+}
+
+// normalizePermissions gives every directory and file below root the
+// configured permissions, keeping only whether a file is executable from
+// the archive. The shared global store is made world-readable so every user
+// can import from it. Outside it, files extracted by root under sudo are
+// handed to the user who ran sudo instead of being left owned by root.
+func (i *Installer) normalizePermissions(root string, global bool) error {
+	dirMode, fileMode := withExecute(i.dirMode), i.fileMode
+	if global {
+		dirMode |= 0555
+		fileMode |= 0444
+	}
+	uid, gid, chown := sudoUser()
+	chown = chown && !global
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		mode := fileMode
+		if d.IsDir() {
+			mode = dirMode
+		} else if info.Mode()&0111 != 0 {
+			mode = withExecute(fileMode)
+		}
+		if info.Mode().Perm() != mode {
+			if err := os.Chmod(path, mode); err != nil {
+				return err
+			}
+		}
+		if chown {
+			return os.Lchown(path, uid, gid)
+		}
+		return nil
+	})
+}
+
+// sudoUser returns the user that ran bifrost through sudo, when running as
+// root on their behalf
+func sudoUser() (int, int, bool) {
+	if os.Geteuid() != 0 {
+		return 0, 0, false
+	}
+	uid, err := strconv.Atoi(os.Getenv("SUDO_UID"))
+	if err != nil {
+		return 0, 0, false
+	}
+	gid, err := strconv.Atoi(os.Getenv("SUDO_GID"))
+	if err != nil {
+		return 0, 0, false
+	}
+	return uid, gid, true
+}
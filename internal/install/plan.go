@@ -0,0 +1,214 @@
+package install
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/resolver"
+)
+
+// Kinds of actions an install performs
+const (
+	ActionDownload      = "download"
+	ActionReuseCache    = "reuse-cache"
+	ActionSkip          = "skip"
+	ActionExtract       = "extract"
+	ActionCopy          = "copy"
+	ActionWriteLockfile = "write-lockfile"
+)
+
+// Action is a single step of an install
+type Action struct {
+	Action  string `json:"action"`
+	Package string `json:"package,omitempty"`
+	Version string `json:"version,omitempty"`
+	// Source is the URL or path the step reads from
+	Source string `json:"source,omitempty"`
+	// Path is the file or directory the step writes to
+	Path   string `json:"path,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Plan is the ordered list of actions an install would perform
+type Plan struct {
+	Actions []Action `json:"actions"`
+}
+
+func (p *Plan) add(actions ...Action) {
+	p.Actions = append(p.Actions, actions...)
+}
+
+// Print writes the plan as one line per action
+func (p *Plan) Print(w io.Writer) {
+	for _, a := range p.Actions {
+		pkg := a.Package + "@" + a.Version
+		switch a.Action {
+		case ActionDownload:
+			fmt.Fprintf(w, "  download %s from %s to %s\n", pkg, a.Source, a.Path)
+		case ActionReuseCache:
+			fmt.Fprintf(w, "  reuse cached %s at %s\n", pkg, a.Path)
+		case ActionExtract:
+			fmt.Fprintf(w, "  extract %s to %s\n", pkg, a.Path)
+		case ActionCopy:
+			fmt.Fprintf(w, "  copy %s to %s\n", pkg, a.Path)
+		case ActionSkip:
+			fmt.Fprintf(w, "  skip %s: %s at %s\n", pkg, a.Reason, a.Path)
+		case ActionWriteLockfile:
+			fmt.Fprintf(w, "  write %s\n", a.Path)
+		default:
+			fmt.Fprintf(w, "  %s %s %s\n", a.Action, pkg, a.Path)
+		}
+	}
+}
+
+// PlanPackageByName resolves a named package like InstallPackageByName and
+// returns the actions installing it would perform, without performing them
+func (i *Installer) PlanPackageByName(packageName string, version string, global bool) (*Plan, error) {
+	client := i.registryClient()
+
+	pkg, err := i.resolvePackage(client, packageName, version)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Actions: []Action{}}
+	if global {
+		plan.add(i.planGlobalPackage(client, pkg)...)
+	} else {
+		plan.add(i.planLocalPackage(client, pkg)...)
+	}
+	return plan, nil
+}
+
+// PlanManifest resolves the manifest at manifestPath like InstallManifest and
+// returns the actions installing it would perform, without performing them
+func (i *Installer) PlanManifest(manifestPath string) (*Plan, error) {
+	m, err := i.loadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	lockPath := i.lockPath(manifestPath)
+	previous, err := lockfile.LoadIfExists(lockPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lockfile: %w", err)
+	}
+
+	resolution, err := i.resolveManifest(m, previous)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve dependencies: %w", err)
+	}
+	applyLockedChecksums(resolution, previous)
+
+	client := i.registryClient()
+	plan := &Plan{Actions: []Action{}}
+	for _, pkg := range resolution.GetResolutionOrder() {
+		plan.add(i.planLocalPackage(client, pkg)...)
+	}
+	plan.add(Action{
+		Action: ActionWriteLockfile,
+		Path:   lockPath,
+	})
+	return plan, nil
+}
+
+// planLocalPackage mirrors installLocalPackage
+func (i *Installer) planLocalPackage(client *registry.Client, pkg *resolver.Package) []Action {
+	versionStr := pkg.Version.String()
+	installPath := i.config.LocalPackagePath(pkg.Name, versionStr)
+
+	if i.config.LocalPackageInstalled(pkg.Name, versionStr) {
+		return []Action{{
+			Action:  ActionSkip,
+			Package: pkg.Name,
+			Version: versionStr,
+			Path:    installPath,
+			Reason:  "already installed",
+		}}
+	}
+
+	archivePath := i.cacheArchivePath(pkg)
+	return []Action{
+		i.planFetch(client, pkg, archivePath),
+		{
+			Action:  ActionExtract,
+			Package: pkg.Name,
+			Version: versionStr,
+			Source:  archivePath,
+			Path:    installPath,
+		},
+	}
+}
+
+// planFetch mirrors fetchArchive
+func (i *Installer) planFetch(client *registry.Client, pkg *resolver.Package, archivePath string) Action {
+	versionStr := pkg.Version.String()
+	target, expected, err := i.artifact(pkg)
+	if err == nil && cachedArchiveMatches(archivePath, expected) {
+		return Action{
+			Action:  ActionReuseCache,
+			Package: pkg.Name,
+			Version: versionStr,
+			Path:    archivePath,
+			Reason:  "checksum matches " + expected,
+		}
+	}
+	if scoped, err := i.clientFor(client, pkg.RegistryName()); err == nil {
+		client = scoped
+	}
+	action := Action{
+		Action:  ActionDownload,
+		Package: pkg.Name,
+		Version: versionStr,
+		Source:  client.DownloadURL(pkg.RegistryName(), versionStr, pkg.Format),
+		Path:    archivePath,
+	}
+	switch {
+	case err != nil:
+		action.Reason = err.Error()
+	case target != "":
+		action.Source = client.ArtifactURL(pkg.RegistryName(), versionStr, target, pkg.Format)
+		action.Reason = "prebuilt for " + target
+	}
+	return action
+}
+
+// planGlobalPackage mirrors the global branch of InstallPackageByName
+func (i *Installer) planGlobalPackage(client *registry.Client, pkg *resolver.Package) []Action {
+	versionStr := pkg.Version.String()
+	installPath := filepath.Join(i.config.GetSharedGlobalPackagesDir(), pkg.Name, versionStr)
+	archivePath := i.cacheArchivePath(pkg)
+	tempDir := i.config.CachePath(fmt.Sprintf("%s-%s-temp", pkg.Name, versionStr))
+
+	actions := []Action{
+		i.planFetch(client, pkg, archivePath),
+		{
+			Action:  ActionExtract,
+			Package: pkg.Name,
+			Version: versionStr,
+			Source:  archivePath,
+			Path:    tempDir,
+		},
+	}
+
+	if _, err := os.Stat(installPath); err == nil {
+		return append(actions, Action{
+			Action:  ActionSkip,
+			Package: pkg.Name,
+			Version: versionStr,
+			Path:    installPath,
+			Reason:  "already installed globally",
+		})
+	}
+	return append(actions, Action{
+		Action:  ActionCopy,
+		Package: pkg.Name,
+		Version: versionStr,
+		Source:  tempDir,
+		Path:    installPath,
+	})
+}
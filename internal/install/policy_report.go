@@ -0,0 +1,153 @@
+package install
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/manifest"
+	"github.com/javanhut/bifrost/internal/policy"
+)
+
+// PolicyReport is the result of checking every package in a lockfile
+// against the organization policy
+type PolicyReport struct {
+	// Policy is the policy file checked against, empty when there is none
+	Policy      string         `json:"policy"`
+	Lockfile    string         `json:"lockfile"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Passed      bool           `json:"passed"`
+	Packages    []PolicyResult `json:"packages"`
+}
+
+// PolicyResult lists the policy violations of one locked package
+type PolicyResult struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Source  string `json:"source,omitempty"`
+	// License is the license the package declares, empty when it declares
+	// none or it could not be found
+	License    string      `json:"license,omitempty"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Violation is a policy rule a package breaks
+type Violation struct {
+	// Rule is "registry", "blocked", "signature" or "license"
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Failed returns the results with at least one violation
+func (r *PolicyReport) Failed() []PolicyResult {
+	var failed []PolicyResult
+	for _, p := range r.Packages {
+		if len(p.Violations) > 0 {
+			failed = append(failed, p)
+		}
+	}
+	return failed
+}
+
+// Save writes the report to path as JSON
+func (r *PolicyReport) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// PolicyReport checks every package in the lockfile of the manifest at
+// manifestPath against the policy, without installing anything. Licenses
+// come from the installed packages' manifests, or from the registry for
+// packages that are not installed when the policy has license rules.
+func (i *Installer) PolicyReport(manifestPath string) (*PolicyReport, error) {
+	lockPath := i.lockPath(manifestPath)
+	lock, err := i.loadCurrentLock(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		return nil, fmt.Errorf("%s not found; run 'bifrost install' to create it", lockPath)
+	}
+
+	pol := i.policy
+	if pol == nil {
+		pol = &policy.Policy{}
+	}
+	report := &PolicyReport{Policy: pol.Path(), Lockfile: lockPath, GeneratedAt: time.Now(), Passed: true}
+	for _, locked := range lock.Packages {
+		name := locked.Name
+		if locked.PackageName != "" {
+			name = locked.PackageName
+		}
+		result := PolicyResult{Name: locked.Name, Version: locked.Version, Source: locked.Source}
+		check := func(rule string, err error) {
+			if err != nil {
+				result.Violations = append(result.Violations, Violation{Rule: rule, Message: err.Error()})
+			}
+		}
+
+		if locked.Source != "" {
+			check("registry", pol.CheckRegistry(locked.Source))
+		}
+		check("blocked", pol.CheckBlocked(name, locked.Version))
+		if pol.RequireSignatures {
+			signed, err := i.lockedSigned(name, locked.Version)
+			if err != nil {
+				check("signature", fmt.Errorf("failed to check the signature of %s@%s: %w", name, locked.Version, err))
+			} else {
+				check("signature", pol.CheckSignature(name, locked.Version, signed))
+			}
+		}
+		if len(pol.AllowedLicenses) > 0 || len(pol.DeniedLicenses) > 0 {
+			license, err := i.lockedLicense(locked.Name, name, locked.Version)
+			if err != nil {
+				check("license", fmt.Errorf("failed to find the license of %s@%s: %w", name, locked.Version, err))
+			} else {
+				result.License = license
+				check("license", pol.CheckLicense(name, locked.Version, license))
+			}
+		}
+
+		if len(result.Violations) > 0 {
+			report.Passed = false
+		}
+		report.Packages = append(report.Packages, result)
+	}
+	return report, nil
+}
+
+// lockedSigned reports whether the index of the registry a locked package
+// comes from signs its checksum
+func (i *Installer) lockedSigned(registryName, version string) (bool, error) {
+	client, err := i.clientFor(i.registryClient(), registryName)
+	if err != nil {
+		return false, err
+	}
+	return i.indexSigned(client, registryName, version)
+}
+
+// lockedLicense returns the license a locked package declares, read from
+// its installed manifest or else from the registry
+func (i *Installer) lockedLicense(name, registryName, version string) (string, error) {
+	path := filepath.Join(i.config.LocalPackagePath(name, version), manifest.FileName)
+	if m, err := manifest.Load(path); err == nil {
+		return m.Package.License, nil
+	}
+	client, err := i.clientFor(i.registryClient(), registryName)
+	if err != nil {
+		return "", err
+	}
+	info, err := client.GetPackageInfo(registryName, version)
+	if err != nil {
+		return "", err
+	}
+	return info.License, nil
+}
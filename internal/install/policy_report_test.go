@@ -0,0 +1,88 @@
+package install
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/policy"
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+)
+
+func TestInstaller_PolicyReport(t *testing.T) {
+	reg := registrytest.New()
+	for name, license := range map[string]string{"json-utils": "MIT", "left-pad": "GPL-3.0"} {
+		archive, err := registrytest.Archive(map[string]string{
+			"Bifrost.toml": "[package]\nname = \"" + name + "\"\nversion = \"1.0.0\"\nlicense = \"" + license + "\"\n",
+			"src/main.crl": "# " + name,
+		})
+		if err != nil {
+			t.Fatalf("failed to build archive: %v", err)
+		}
+		reg.AddPackage(registry.PackageInfo{Name: name, Version: "1.0.0", License: license}, archive)
+	}
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\njson-utils = \"^1.0.0\"\nleft-pad = \"^1.0.0\"\n"), 0644)
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+
+	report, err := installer.PolicyReport(manifestPath)
+	if err != nil {
+		t.Fatalf("PolicyReport() without a policy error = %v", err)
+	}
+	if !report.Passed || len(report.Packages) != 2 || len(report.Failed()) != 0 {
+		t.Errorf("PolicyReport() without a policy = %+v", report)
+	}
+
+	policyPath := filepath.Join(t.TempDir(), policy.FileName)
+	os.WriteFile(policyPath, []byte(`
+allowed_licenses = ["MIT"]
+
+[[blocked]]
+name = "left-pad"
+reason = "unmaintained"
+`), 0644)
+	pol, err := policy.LoadFile(policyPath)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	installer.SetPolicy(pol)
+	// The package left installed is read from disk, the other from the
+	// registry
+	os.RemoveAll(cfg.LocalPackagePath("left-pad", "1.0.0"))
+
+	report, err = installer.PolicyReport(manifestPath)
+	if err != nil {
+		t.Fatalf("PolicyReport() error = %v", err)
+	}
+	if report.Passed || report.Policy != policyPath {
+		t.Errorf("PolicyReport() = %+v, want a failed report for %s", report, policyPath)
+	}
+	failed := report.Failed()
+	if len(failed) != 1 || failed[0].Name != "left-pad" || failed[0].License != "GPL-3.0" {
+		t.Fatalf("failed packages = %+v, want left-pad", failed)
+	}
+	var rules []string
+	for _, v := range failed[0].Violations {
+		rules = append(rules, v.Rule)
+	}
+	if got := strings.Join(rules, " "); got != "blocked license" {
+		t.Errorf("violated rules = %s, want blocked license", got)
+	}
+
+	os.Remove(filepath.Join(projectDir, "Bifrost.lock"))
+	if _, err := installer.PolicyReport(manifestPath); err == nil {
+		t.Error("PolicyReport() without a lockfile succeeded")
+	}
+}
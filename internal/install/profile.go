@@ -0,0 +1,56 @@
+package install
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/manifest"
+)
+
+// loadManifest loads the project manifest at path with the configured
+// profile selected
+func (i *Installer) loadManifest(path string) (*manifest.Manifest, error) {
+	m, err := manifest.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifest: %w", err)
+	}
+	return m.WithProfile(i.config.Profile)
+}
+
+// lockPath returns the path of the lockfile of the manifest at
+// manifestPath for the configured profile
+func (i *Installer) lockPath(manifestPath string) string {
+	return filepath.Join(filepath.Dir(manifestPath), lockfile.FileNameFor(i.config.Profile))
+}
+
+// loadCurrentLock loads the lockfile of the manifest at manifestPath,
+// returning nil when there is none. A lockfile the manifest's dependencies
+// changed since fails with lockfile.ErrOutOfDate rather than being read as
+// the project's.
+func (i *Installer) loadCurrentLock(manifestPath string) (*lockfile.Lockfile, error) {
+	m, err := i.loadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := lockfile.LoadCurrent(i.lockPath(manifestPath), m)
+	if err != nil && !errors.Is(err, lockfile.ErrOutOfDate) {
+		return nil, fmt.Errorf("failed to load lockfile: %w", err)
+	}
+	return lock, err
+}
+
+// installedPackage returns the registry package installed in the package
+// directory dir of the dependency called name: the one recorded for an
+// alias, or name itself
+func installedPackage(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, config.PackageFile))
+	if err != nil {
+		return name
+	}
+	return strings.TrimSpace(string(data))
+}
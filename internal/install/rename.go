@@ -0,0 +1,74 @@
+package install
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/javanhut/bifrost/internal/manifest"
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/warn"
+)
+
+// maxRenames bounds how many renames are followed from one name, so a
+// registry whose tombstones point at each other cannot loop resolution
+const maxRenames = 5
+
+// listRenamedVersions lists the versions of the registry package name like
+// listVersions, following the tombstones of renamed packages with a warning.
+// It returns the name the versions are published under and the client
+// serving it.
+func (i *Installer) listRenamedVersions(client, pkgClient *registry.Client, name string) (string, *registry.Client, []string, error) {
+	for hops := 0; ; hops++ {
+		versions, err := i.listVersions(pkgClient, name)
+		var renamed *registry.RenamedError
+		if !errors.As(err, &renamed) {
+			return name, pkgClient, versions, err
+		}
+		if hops == maxRenames {
+			return "", nil, nil, fmt.Errorf("package %s was renamed more than %d times", name, maxRenames)
+		}
+		if err := manifest.ValidateName(renamed.RenamedTo); err != nil {
+			return "", nil, nil, fmt.Errorf("package %s was renamed to an invalid name: %w", name, err)
+		}
+		warnRenamed(renamed)
+
+		name = renamed.RenamedTo
+		pkgClient, err = i.clientFor(client, name)
+		if err != nil {
+			return "", nil, nil, err
+		}
+	}
+}
+
+// warnRenamed tells the user to move off the old name of a renamed package
+// before the registry stops resolving it
+func warnRenamed(renamed *registry.RenamedError) {
+	if renamed.RenamedUntil != nil {
+		warn.Printf(warn.Deprecation, "%s was renamed to %s and resolves to it until %s; depend on %s instead", renamed.Name, renamed.RenamedTo, renamed.RenamedUntil.Format("2006-01-02"), renamed.RenamedTo)
+		return
+	}
+	warn.Printf(warn.Deprecation, "%s was renamed to %s; depend on %s instead", renamed.Name, renamed.RenamedTo, renamed.RenamedTo)
+}
+
+// wasRenamedTo reports whether the registry renamed the package oldName,
+// possibly through several renames, to newName. Archives published before
+// a rename still embed the manifest of the old name.
+func (i *Installer) wasRenamedTo(oldName, newName string) bool {
+	client := i.registryClient()
+	name := oldName
+	for hops := 0; hops < maxRenames; hops++ {
+		pkgClient, err := i.clientFor(client, name)
+		if err != nil {
+			return false
+		}
+		list, err := pkgClient.GetVersionList(name)
+		if err != nil || list.RenamedTo == "" {
+			return false
+		}
+		if list.RenamedTo == newName {
+			return true
+		}
+		name = list.RenamedTo
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package install
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+	"github.com/javanhut/bifrost/internal/warn"
+)
+
+func TestInstaller_RenamedPackage(t *testing.T) {
+	var warnings strings.Builder
+	warn.SetOutput(&warnings)
+	defer warn.SetOutput(os.Stderr)
+
+	// The archive was published before the rename, so it embeds the old name
+	reg := registrytest.New()
+	archive, err := registrytest.Archive(map[string]string{
+		"Bifrost.toml": "[package]\nname = \"json-utils\"\nversion = \"1.0.0\"\n",
+		"src/main.crl": "# json-utils 1.0.0",
+	})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0"}, archive)
+	if _, err := reg.Client().Rename("json-utils", "json-kit"); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+
+	manifestPath := filepath.Join(t.TempDir(), "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte(`[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+json-utils = "^1.0.0"
+`), 0644)
+
+	lock, err := installer.InstallManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+
+	// The dependency keeps its name, so imports of it still work
+	if _, err := os.Stat(filepath.Join(cfg.LocalPackagePath("json-utils", "1.0.0"), "src", "main.crl")); err != nil {
+		t.Errorf("json-utils not installed under its old name: %v", err)
+	}
+	if locked := lock.Find("json-utils"); locked == nil || locked.PackageName != "json-kit" {
+		t.Errorf("locked json-utils = %+v, want an alias of json-kit", locked)
+	}
+	if !strings.Contains(warnings.String(), "json-utils was renamed to json-kit") {
+		t.Errorf("warnings = %q, want one about the rename", warnings.String())
+	}
+
+	pkg, err := installer.resolvePackage(reg.Client(), "json-utils", "")
+	if err != nil {
+		t.Fatalf("resolvePackage() error = %v", err)
+	}
+	if pkg.Name != "json-utils" || pkg.RegistryName() != "json-kit" {
+		t.Errorf("resolvePackage() = %s from %s, want json-utils from json-kit", pkg.Name, pkg.RegistryName())
+	}
+}
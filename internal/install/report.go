@@ -0,0 +1,237 @@
+package install
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/archive"
+	"github.com/javanhut/bifrost/internal/color"
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/resolver"
+	"github.com/javanhut/bifrost/internal/warn"
+)
+
+// Report summarizes what an install changed and how long it took
+type Report struct {
+	// Packages are the packages the install put in place or found already
+	// installed, in install order
+	Packages  []Installed `json:"packages"`
+	Added     []Change    `json:"added"`
+	Updated   []Change    `json:"updated"`
+	Removed   []Change    `json:"removed"`
+	Unchanged int         `json:"unchanged"`
+	// Failed lists packages skipped by a keep-going install
+	Failed []Failure `json:"failed"`
+
+	BytesDownloaded int64 `json:"bytes_downloaded"`
+	CacheHits       int   `json:"cache_hits"`
+	// Downloads are ordered from slowest to fastest
+	Downloads []Download `json:"downloads"`
+
+	// Warnings are those printed while the install ran
+	Warnings []warn.Warning `json:"warnings"`
+	// Error is why the install failed, set by the caller before saving the
+	// report of a failed install
+	Error string `json:"error,omitempty"`
+
+	StartedAt  time.Time     `json:"started_at"`
+	Duration   time.Duration `json:"-"`
+	DurationMS int64         `json:"duration_ms"`
+
+	// warnings is how many warnings were printed before the install
+	warnings int
+}
+
+// Installed is a package in place after an install
+type Installed struct {
+	Name string `json:"name"`
+	// PackageName is the registry package installed under Name, for aliases
+	PackageName string `json:"package_name,omitempty"`
+	Version     string `json:"version"`
+	Checksum    string `json:"checksum,omitempty"`
+	// Source is the registry the package was fetched from, or the
+	// directory an override linked in its place
+	Source string `json:"source"`
+	Path   string `json:"path"`
+	// Status is EventInstalled, EventUpToDate or, for overrides,
+	// EventLinked
+	Status EventKind `json:"status"`
+}
+
+// Change is a package added, updated or removed by an install
+type Change struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Previous is the version replaced by an update
+	Previous string `json:"previous,omitempty"`
+}
+
+// Failure is a package that could not be installed
+type Failure struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Error   string `json:"error"`
+}
+
+// Download records a single archive download
+type Download struct {
+	Package    string        `json:"package"`
+	Version    string        `json:"version"`
+	Bytes      int64         `json:"bytes"`
+	Duration   time.Duration `json:"-"`
+	DurationMS int64         `json:"duration_ms"`
+	// PatchedFrom is the cached version a patch was applied to, when only a
+	// patch was downloaded
+	PatchedFrom string `json:"patched_from,omitempty"`
+}
+
+func newReport() *Report {
+	return &Report{
+		Packages:  []Installed{},
+		Added:     []Change{},
+		Updated:   []Change{},
+		Removed:   []Change{},
+		Failed:    []Failure{},
+		Downloads: []Download{},
+		Warnings:  []warn.Warning{},
+		StartedAt: time.Now(),
+		warnings:  len(warn.Emitted()),
+	}
+}
+
+// Save writes the report as JSON to path, for keeping with build artifacts
+func (r *Report) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// recordInstalled records that pkg is in place at path
+func (i *Installer) recordInstalled(client *registry.Client, pkg *resolver.Package, checksum, path string, status EventKind) {
+	if checksum == "" {
+		checksum = pkg.Checksum
+	}
+	source := i.sourceURL(client, pkg.RegistryName())
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.report.Packages = append(i.report.Packages, Installed{
+		Name:        pkg.Name,
+		PackageName: pkg.PackageName,
+		Version:     pkg.Version.String(),
+		Checksum:    checksum,
+		Source:      source,
+		Path:        path,
+		Status:      status,
+	})
+}
+
+func (r *Report) recordDownload(name, version string, bytes int64, elapsed time.Duration) {
+	r.BytesDownloaded += bytes
+	r.Downloads = append(r.Downloads, Download{
+		Package:    name,
+		Version:    version,
+		Bytes:      bytes,
+		Duration:   elapsed,
+		DurationMS: elapsed.Milliseconds(),
+	})
+}
+
+// recordPatch records a download of a patch from version from
+func (r *Report) recordPatch(name, version, from string, bytes int64, elapsed time.Duration) {
+	r.recordDownload(name, version, bytes, elapsed)
+	r.Downloads[len(r.Downloads)-1].PatchedFrom = from
+}
+
+// recordLockDiff fills in the added, updated, removed and unchanged packages
+// by comparing the lockfile before and after an install
+func (r *Report) recordLockDiff(previous, current *lockfile.Lockfile) {
+	before := make(map[string]string)
+	if previous != nil {
+		for _, p := range previous.Packages {
+			before[p.Name] = p.Version
+		}
+	}
+
+	for _, p := range current.Packages {
+		old, ok := before[p.Name]
+		delete(before, p.Name)
+		switch {
+		case !ok:
+			r.Added = append(r.Added, Change{Name: p.Name, Version: p.Version})
+		case old != p.Version:
+			r.Updated = append(r.Updated, Change{Name: p.Name, Version: p.Version, Previous: old})
+		default:
+			r.Unchanged++
+		}
+	}
+
+	for _, name := range sortedKeys(before) {
+		r.Removed = append(r.Removed, Change{Name: name, Version: before[name]})
+	}
+}
+
+// failedError summarizes the packages a keep-going install could not
+// install, or returns nil when there were none
+func (r *Report) failedError() error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+	names := make([]string, len(r.Failed))
+	for n, f := range r.Failed {
+		names[n] = f.Name
+	}
+	return fmt.Errorf("%d package(s) failed to install: %s", len(names), strings.Join(names, ", "))
+}
+
+func (r *Report) finish() {
+	sort.SliceStable(r.Downloads, func(a, b int) bool {
+		return r.Downloads[a].Duration > r.Downloads[b].Duration
+	})
+	r.Duration = time.Since(r.StartedAt)
+	r.DurationMS = r.Duration.Milliseconds()
+	if emitted := warn.Emitted(); len(emitted) >= r.warnings {
+		r.Warnings = append(r.Warnings, emitted[r.warnings:]...)
+	}
+}
+
+// Print writes a human readable summary, listing at most slowest of the
+// slowest downloads
+func (r *Report) Print(w io.Writer, slowest int) {
+	fmt.Fprintf(w, "%d added, %d updated, %d removed, %d unchanged in %.2fs\n",
+		len(r.Added), len(r.Updated), len(r.Removed), r.Unchanged, r.Duration.Seconds())
+	fmt.Fprintf(w, "Downloaded %s in %d archive(s), %d cache hit(s)\n",
+		archive.FormatSize(r.BytesDownloaded), len(r.Downloads), r.CacheHits)
+	if len(r.Failed) > 0 {
+		c := color.For(w)
+		fmt.Fprintf(w, "%s\n", c.Error(fmt.Sprintf("%d failed:", len(r.Failed))))
+		for _, f := range r.Failed {
+			fmt.Fprintf(w, "  %s: %s\n", c.Ref(f.Name, f.Version), f.Error)
+		}
+	}
+
+	if len(r.Downloads) == 0 || slowest <= 0 {
+		return
+	}
+	fmt.Fprintln(w, "Slowest downloads:")
+	for n, d := range r.Downloads {
+		if n == slowest {
+			break
+		}
+		fmt.Fprintf(w, "  %-30s %8.2fs %10s", d.Package+"@"+d.Version, d.Duration.Seconds(), archive.FormatSize(d.Bytes))
+		if d.PatchedFrom != "" {
+			fmt.Fprintf(w, " (patch from %s)", d.PatchedFrom)
+		}
+		fmt.Fprintln(w)
+	}
+}
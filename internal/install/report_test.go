@@ -0,0 +1,159 @@
+package install
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+	"github.com/javanhut/bifrost/internal/warn"
+)
+
+func TestReport_RecordLockDiff(t *testing.T) {
+	previous := lockfile.New()
+	previous.Set(lockfile.Package{Name: "kept", Version: "1.0.0"})
+	previous.Set(lockfile.Package{Name: "bumped", Version: "1.0.0"})
+	previous.Set(lockfile.Package{Name: "dropped", Version: "0.1.0"})
+
+	current := lockfile.New()
+	current.Set(lockfile.Package{Name: "kept", Version: "1.0.0"})
+	current.Set(lockfile.Package{Name: "bumped", Version: "1.1.0"})
+	current.Set(lockfile.Package{Name: "fresh", Version: "2.0.0"})
+
+	r := newReport()
+	r.recordLockDiff(previous, current)
+
+	if len(r.Added) != 1 || r.Added[0].Name != "fresh" {
+		t.Errorf("Added = %+v", r.Added)
+	}
+	if len(r.Updated) != 1 || r.Updated[0] != (Change{Name: "bumped", Version: "1.1.0", Previous: "1.0.0"}) {
+		t.Errorf("Updated = %+v", r.Updated)
+	}
+	if len(r.Removed) != 1 || r.Removed[0].Name != "dropped" {
+		t.Errorf("Removed = %+v", r.Removed)
+	}
+	if r.Unchanged != 1 {
+		t.Errorf("Unchanged = %d, want 1", r.Unchanged)
+	}
+
+	r = newReport()
+	r.recordLockDiff(nil, current)
+	if len(r.Added) != 3 {
+		t.Errorf("with no previous lockfile Added = %+v, want all 3 packages", r.Added)
+	}
+}
+
+func TestReport_Print(t *testing.T) {
+	r := newReport()
+	r.Added = []Change{{Name: "a", Version: "1.0.0"}}
+	r.recordDownload("a", "1.0.0", 2048, 300*time.Millisecond)
+	r.recordDownload("b", "2.0.0", 1024, 900*time.Millisecond)
+	r.CacheHits = 1
+	r.finish()
+
+	if r.Downloads[0].Package != "b" {
+		t.Errorf("slowest download = %s, want b", r.Downloads[0].Package)
+	}
+	if r.BytesDownloaded != 3072 {
+		t.Errorf("BytesDownloaded = %d, want 3072", r.BytesDownloaded)
+	}
+
+	var buf bytes.Buffer
+	r.Print(&buf, 1)
+	out := buf.String()
+	for _, want := range []string{"1 added", "3.0 KB in 2 archive(s), 1 cache hit(s)", "b@2.0.0"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "a@1.0.0") {
+		t.Errorf("summary lists more than the slowest download:\n%s", out)
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if !strings.Contains(string(data), `"duration_ms":900`) {
+		t.Errorf("JSON report missing download duration: %s", data)
+	}
+}
+
+func TestInstaller_Report(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	var progress bytes.Buffer
+	installer.SetOutput(&progress)
+	warn.SetOutput(io.Discard)
+	defer warn.SetOutput(os.Stderr)
+
+	projectDir := t.TempDir()
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte(`[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+json-utils = "^1.0.0"
+`), 0644)
+
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	r := installer.Report()
+	if len(r.Added) != 1 || len(r.Downloads) != 1 || r.BytesDownloaded == 0 || r.CacheHits != 0 {
+		t.Errorf("first install report = %+v", r)
+	}
+	if !strings.Contains(progress.String(), "Downloading json-utils@1.0.0") {
+		t.Errorf("progress not written to SetOutput writer: %q", progress.String())
+	}
+	published, _ := reg.Package("json-utils", "1.0.0")
+	want := Installed{
+		Name:     "json-utils",
+		Version:  "1.0.0",
+		Checksum: published.Info.Checksum,
+		Source:   registrytest.URL,
+		Path:     cfg.LocalPackagePath("json-utils", "1.0.0"),
+		Status:   EventInstalled,
+	}
+	if len(r.Packages) != 1 || r.Packages[0] != want {
+		t.Errorf("Packages = %+v, want %+v", r.Packages, want)
+	}
+	if len(r.Warnings) != 1 || r.Warnings[0].Category != warn.Integrity {
+		t.Errorf("Warnings = %+v, want the missing manifest warning", r.Warnings)
+	}
+
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+	if err := r.Save(reportPath); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	var saved Report
+	data, err := os.ReadFile(reportPath)
+	if err == nil {
+		err = json.Unmarshal(data, &saved)
+	}
+	if err != nil || len(saved.Packages) != 1 || saved.Packages[0] != want || saved.StartedAt.IsZero() {
+		t.Errorf("saved report = %+v, %v", saved, err)
+	}
+
+	// A fresh modules directory installs from the cache
+	cfg.ModulesDir = filepath.Join(t.TempDir(), "carrion_modules")
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	r = installer.Report()
+	if len(r.Added) != 0 || r.Unchanged != 1 || r.CacheHits != 1 || len(r.Downloads) != 0 {
+		t.Errorf("second install report = %+v", r)
+	}
+	if len(r.Packages) != 1 || r.Packages[0].Checksum != want.Checksum {
+		t.Errorf("second install Packages = %+v", r.Packages)
+	}
+}
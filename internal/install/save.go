@@ -0,0 +1,73 @@
+package install
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/javanhut/bifrost/internal/fsutil"
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/manifest"
+	ver "github.com/javanhut/bifrost/internal/version"
+)
+
+// AddDependencies records the requested packages as dependencies in the
+// manifest at manifestPath, then installs it like InstallManifest, so they
+// are locked and a clean install brings them back. A request given as an
+// exact version or a constraint is saved as written, a partial version as
+// the range it stands for, and a request for the newest version as a caret
+// constraint on the version currently newest. Dev dependencies
+// installed this way become regular dependencies. The manifest is left as
+// it was, permissions included, when the install fails.
+func (i *Installer) AddDependencies(manifestPath string, requests []PackageRequest) (*lockfile.Lockfile, error) {
+	info, err := os.Stat(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	original, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	m, err := manifest.Load(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifest: %w", err)
+	}
+	var edits []manifest.Edit
+	client := i.registryClient()
+	for _, req := range requests {
+		constraint := req.Version
+		if _, err := ver.ParseConstraint(constraint); err != nil {
+			spec, err := parseVersionSpec(req.Version)
+			if err != nil {
+				return nil, err
+			}
+			if spec != nil {
+				// Partial versions such as "1.2" are saved as the range
+				// they stand for
+				constraint = spec.String()
+			} else {
+				i.emit(Event{Kind: EventResolving, Package: req.Name})
+				pkg, err := i.resolvePackage(client, req.Name, "")
+				if err != nil {
+					return nil, err
+				}
+				constraint = "^" + pkg.Version.String()
+			}
+		}
+		edits = append(edits, manifest.SetDependency("dependencies", req.Name, m.PackageName(req.Name), constraint))
+		if _, ok := m.DevDependencies[req.Name]; ok {
+			edits = append(edits, manifest.Edit{Table: "dev-dependencies", Key: req.Name})
+		}
+	}
+
+	if err := manifest.EditFile(manifestPath, edits...); err != nil {
+		return nil, fmt.Errorf("failed to save manifest: %w", err)
+	}
+	lock, err := i.InstallManifest(manifestPath)
+	if err != nil {
+		if restoreErr := fsutil.WriteFileAtomic(manifestPath, original, info.Mode().Perm()); restoreErr != nil {
+			return nil, fmt.Errorf("%w (and failed to restore %s: %v)", err, manifest.FileName, restoreErr)
+		}
+		return nil, err
+	}
+	return lock, nil
+}
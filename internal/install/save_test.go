@@ -0,0 +1,85 @@
+package install
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/manifest"
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+)
+
+func TestInstaller_AddDependencies(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0", "1.2.0", "2.1.0"})
+	archive, err := registrytest.Archive(map[string]string{"src/main.crl": "# http-client"})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "http-client", Version: "2.0.0"}, archive)
+	reg.AddPackage(registry.PackageInfo{Name: "test-kit", Version: "0.3.0"}, archive)
+
+	cfg := newTestConfig(t, registrytest.URL)
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, manifest.FileName)
+	os.WriteFile(manifestPath, []byte(`[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+# Talks to the API
+http-client = "^2.0.0"
+
+[dev-dependencies]
+test-kit = "^0.1.0"
+`), 0644)
+
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	lock, err := installer.AddDependencies(manifestPath, []PackageRequest{{Name: "json-utils"}, {Name: "test-kit", Version: "0.3"}})
+	if err != nil {
+		t.Fatalf("AddDependencies() error = %v", err)
+	}
+
+	m, err := manifest.Load(manifestPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := map[string]string{"http-client": "^2.0.0", "json-utils": "^2.1.0", "test-kit": ">=0.3.0, <0.4.0"}
+	if !reflect.DeepEqual(m.Dependencies, want) {
+		t.Errorf("saved dependencies = %v, want %v", m.Dependencies, want)
+	}
+	if len(m.DevDependencies) != 0 {
+		t.Errorf("saved dev dependencies = %v, want test-kit moved to dependencies", m.DevDependencies)
+	}
+	if data, _ := os.ReadFile(manifestPath); !strings.Contains(string(data), "# Talks to the API\nhttp-client") {
+		t.Errorf("saved manifest lost its comments:\n%s", data)
+	}
+	if locked := lock.Find("json-utils"); locked == nil || locked.Version != "2.1.0" {
+		t.Errorf("locked json-utils = %+v, want 2.1.0", locked)
+	}
+	if !cfg.LocalPackageInstalled("json-utils", "2.1.0") {
+		t.Errorf("json-utils 2.1.0 is not installed")
+	}
+
+	// A failed install leaves the manifest as it was, permissions included
+	os.Chmod(manifestPath, 0600)
+	before, _ := os.ReadFile(manifestPath)
+	if _, err := installer.AddDependencies(manifestPath, []PackageRequest{{Name: "missing", Version: "^1.0.0"}}); err == nil {
+		t.Fatalf("AddDependencies() of an unknown package succeeded")
+	}
+	if after, _ := os.ReadFile(manifestPath); string(after) != string(before) {
+		t.Errorf("failed AddDependencies() changed the manifest:\n%s", after)
+	}
+	if info, err := os.Stat(manifestPath); err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("failed AddDependencies() left the manifest mode %v, want 0600", info.Mode().Perm())
+	}
+}
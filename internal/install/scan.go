@@ -0,0 +1,89 @@
+package install
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/errcode"
+	"github.com/javanhut/bifrost/internal/resolver"
+)
+
+// SetScanner makes installs run command on every package archive before it
+// is extracted, cached or not, with the archive's path as the last argument,
+// e.g. "clamscan --no-summary". An archive the command exits non-zero for is
+// quarantined and the install fails.
+func (i *Installer) SetScanner(command string) {
+	i.scanner = command
+}
+
+// scanArchive runs the scanner on pkg's archive at archivePath. An archive
+// the scanner rejects is moved out of the cache into the quarantine
+// directory, so no later install extracts it either.
+func (i *Installer) scanArchive(archivePath string, pkg *resolver.Package) error {
+	if i.scanner == "" {
+		return nil
+	}
+	cmd := scanCommand(i.scanner, archivePath)
+	cmd.Stdout = i.out
+	cmd.Stderr = i.out
+	i.logf("Scanning %s@%s: %s %s\n", pkg.Name, pkg.Version, i.scanner, archivePath)
+
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+	quarantined, qerr := quarantine(archivePath, i.config.QuarantineDir())
+	if qerr != nil {
+		return fmt.Errorf("scanner rejected %s@%s (%v), and its archive could not be quarantined: %w", pkg.Name, pkg.Version, err, qerr)
+	}
+	return errcode.ArchiveQuarantined.Errorf("scanner rejected %s@%s (%v); its archive was quarantined as %s", pkg.Name, pkg.Version, err, quarantined)
+}
+
+// scanCommand returns the command running scanner with the platform shell
+// and path appended as its last argument
+func scanCommand(scanner, path string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", scanner+` "`+path+`"`)
+	}
+	// The path is passed as a positional parameter rather than pasted
+	// into the script, so it is never interpreted by the shell
+	return exec.Command("sh", "-c", scanner+` "$1"`, "sh", path)
+}
+
+// quarantine moves the file at path into dir under a name that keeps
+// earlier quarantined copies, returning its new path
+func quarantine(path, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dir, time.Now().UTC().Format("20060102T150405Z")+"-"+filepath.Base(path))
+	if err := os.Rename(path, dst); err == nil {
+		return dst, nil
+	}
+
+	// The cache may be on another filesystem
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		src.Close()
+		return "", err
+	}
+	_, err = io.Copy(out, src)
+	src.Close()
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	return dst, os.Remove(path)
+}
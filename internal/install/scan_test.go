@@ -0,0 +1,56 @@
+package install
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/errcode"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+)
+
+func TestInstaller_Scanner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("scanners in this test use sh")
+	}
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	install := func(scanner string) error {
+		installer := New(cfg)
+		installer.SetClient(reg.Client())
+		installer.SetOutput(io.Discard)
+		installer.SetScanner(scanner)
+		return installer.InstallPackageByName("json-utils", "1.0.0", false)
+	}
+	installPath := cfg.LocalPackagePath("json-utils", "1.0.0")
+
+	// The scanner gets the archive's path
+	if err := install("test -f"); err != nil {
+		t.Fatalf("InstallPackageByName() with an accepting scanner error = %v", err)
+	}
+	if _, err := os.Stat(installPath); err != nil {
+		t.Fatalf("package not installed: %v", err)
+	}
+	if err := os.RemoveAll(installPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cached archives are scanned too, and a rejected one is quarantined
+	err := install("false")
+	if errcode.Of(err) != errcode.ArchiveQuarantined {
+		t.Fatalf("InstallPackageByName() with a rejecting scanner error = %v, want %s", err, errcode.ArchiveQuarantined)
+	}
+	if _, err := os.Stat(installPath); !os.IsNotExist(err) {
+		t.Errorf("rejected package installed: %v", err)
+	}
+	cached, _ := filepath.Glob(filepath.Join(cfg.CacheDir, "json-utils-*"))
+	if len(cached) != 0 {
+		t.Errorf("rejected archive left in the cache: %v", cached)
+	}
+	quarantined, _ := os.ReadDir(cfg.QuarantineDir())
+	if len(quarantined) != 1 {
+		t.Errorf("quarantine holds %d files, want 1", len(quarantined))
+	}
+}
@@ -0,0 +1,70 @@
+package install
+
+import (
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/manifest"
+	"github.com/javanhut/bifrost/internal/registry"
+)
+
+// SetScopeClient makes packages of scope, e.g. "@acme", use client instead
+// of the registry the config routes the scope to
+func (i *Installer) SetScopeClient(scope string, client *registry.Client) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.scopeClients == nil {
+		i.scopeClients = make(map[string]*registry.Client)
+	}
+	i.scopeClients[scope] = client
+}
+
+// clientFor returns the client for the registry package name: one for the
+// registry its scope is routed to, with that registry's credentials, or
+// client for unscoped names and scopes without a route
+func (i *Installer) clientFor(client *registry.Client, name string) (*registry.Client, error) {
+	scope := manifest.Scope(name)
+	if scope == "" {
+		return client, nil
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if scoped, ok := i.scopeClients[scope]; ok {
+		return scoped, nil
+	}
+	registryConfig, routed, err := i.config.ScopeRegistryConfig(scope)
+	if err != nil {
+		return nil, err
+	}
+	if !routed {
+		return client, nil
+	}
+
+	scoped := newRegistryClient(registryConfig)
+	if i.scopeClients == nil {
+		i.scopeClients = make(map[string]*registry.Client)
+	}
+	i.scopeClients[scope] = scoped
+	return scoped, nil
+}
+
+// sourceURL returns the URL of the registry the package name is fetched
+// from, for recording in the lockfile
+func (i *Installer) sourceURL(client *registry.Client, name string) string {
+	if scoped, err := i.clientFor(client, name); err == nil {
+		return scoped.BaseURL()
+	}
+	return client.BaseURL()
+}
+
+// newRegistryClient returns a client for a configured registry with its
+// credentials
+func newRegistryClient(registryConfig *config.RegistryConfig) *registry.Client {
+	client := registry.NewClient(registryConfig.URL)
+	switch registryConfig.AuthType {
+	case "token":
+		client.SetAPIKey(registryConfig.APIKey)
+	case "basic":
+		client.SetBasicAuth(registryConfig.Username, registryConfig.Password)
+	}
+	return client
+}
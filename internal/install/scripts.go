@@ -0,0 +1,242 @@
+package install
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/errcode"
+	"github.com/javanhut/bifrost/internal/manifest"
+	"github.com/javanhut/bifrost/internal/resolver"
+	"github.com/javanhut/bifrost/internal/trust"
+	"github.com/javanhut/bifrost/internal/warn"
+)
+
+// SetStrict makes installs refuse packages that declare install scripts
+// unless scripts are allowed with SetAllowScripts
+func (i *Installer) SetStrict(strict bool) {
+	i.strict = strict
+}
+
+// SetAllowScripts allows packages with install scripts in strict mode
+func (i *Installer) SetAllowScripts(allow bool) {
+	i.allowScripts = allow
+}
+
+// ScriptPrompt asks whether name@version may run the install scripts just
+// listed, returning the answer
+type ScriptPrompt func(name, version string) (bool, error)
+
+// SetScriptPrompt makes strict installs ask with prompt whether a package
+// may run its install scripts instead of refusing it. Each answer is
+// remembered per package version, so installing it again does not ask
+// again.
+func (i *Installer) SetScriptPrompt(prompt ScriptPrompt) {
+	i.scriptPrompt = prompt
+}
+
+// DefaultScriptTimeout is how long an install script may run before it is
+// stopped
+const DefaultScriptTimeout = 5 * time.Minute
+
+// SetScriptTimeout sets how long an install script may run before it is
+// stopped and the install fails; zero lets scripts run as long as they need
+func (i *Installer) SetScriptTimeout(d time.Duration) {
+	i.scriptTimeout = d
+}
+
+// runInstallScripts warns about the install scripts and executables pkg
+// declares in the manifest extracted into dir, and runs the scripts there
+// when they are allowed. Install scripts run arbitrary code with the user's
+// privileges, so they only run with --allow-scripts or a remembered
+// decision allowing them, with a scrubbed environment and a timeout rather
+// than everything the user has exported. Otherwise they are skipped, or in
+// strict mode the package is refused.
+func (i *Installer) runInstallScripts(dir string, pkg *resolver.Package) error {
+	path := filepath.Join(dir, manifest.FileName)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	m, err := manifest.Load(path)
+	if err != nil {
+		return fmt.Errorf("failed to read embedded %s: %w", manifest.FileName, err)
+	}
+
+	if len(m.Bin) > 0 {
+		names := make([]string, 0, len(m.Bin))
+		for name := range m.Bin {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		warn.Printf(warn.Package, "%s@%s provides executables: %s", pkg.Name, pkg.Version, strings.Join(names, ", "))
+	}
+
+	scripts := m.InstallScripts()
+	if len(scripts) == 0 {
+		return nil
+	}
+	var listed strings.Builder
+	for _, event := range scripts {
+		fmt.Fprintf(&listed, "\n  %s: %s", event, m.Scripts[event])
+	}
+	warn.Printf(warn.Package, "%s@%s runs install scripts:%s", pkg.Name, pkg.Version, listed.String())
+	if i.policy != nil && i.policy.ForbidInstallScripts {
+		return errcode.PolicyViolation.Errorf("%s@%s has install scripts, which policy %s forbids", pkg.Name, pkg.Version, i.policy.Path())
+	}
+	run, err := i.checkScriptTrust(pkg)
+	if err != nil {
+		return err
+	}
+	if !run {
+		warn.Printf(warn.Package, "install scripts of %s@%s were not run; review them and pass --allow-scripts to run them", pkg.Name, pkg.Version)
+		return nil
+	}
+
+	env := scriptEnv(os.Environ(), dir)
+	for _, event := range scripts {
+		if err := i.runScript(dir, env, event, m.Scripts[event], pkg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkScriptTrust decides whether pkg may run its install scripts. An
+// answer remembered for the version stands unless --allow-scripts is given.
+// Without one, scripts are skipped, except in strict mode, which asks when
+// it can or refuses the package.
+func (i *Installer) checkScriptTrust(pkg *resolver.Package) (bool, error) {
+	if i.allowScripts {
+		return true, nil
+	}
+	path := i.config.TrustPath()
+	store, err := trust.Load(path)
+	if err != nil {
+		return false, err
+	}
+	version := pkg.Version.String()
+	if d := store.Find(pkg.Name, version); d != nil {
+		if d.Allow {
+			i.logf("Running install scripts of %s@%s, allowed on %s\n", pkg.Name, version, d.DecidedAt.Format("2006-01-02"))
+			return true, nil
+		}
+		return false, errcode.ScriptsRefused.Errorf("%s@%s has install scripts, which were denied on %s; run 'bifrost trust revoke %s@%s' to be asked again", pkg.Name, version, d.DecidedAt.Format("2006-01-02"), pkg.Name, version)
+	}
+	if !i.strict {
+		return false, nil
+	}
+	if i.scriptPrompt == nil {
+		return false, errcode.ScriptsRefused.Errorf("%s@%s has install scripts, which strict mode refuses; review them and pass --allow-scripts to run them", pkg.Name, pkg.Version)
+	}
+
+	allow, err := i.scriptPrompt(pkg.Name, version)
+	if err != nil {
+		return false, err
+	}
+	store.Set(trust.Decision{Package: pkg.Name, Version: version, Allow: allow, DecidedAt: time.Now().UTC()})
+	if err := store.Save(path); err != nil {
+		return false, err
+	}
+	if !allow {
+		return false, errcode.ScriptsRefused.Errorf("%s@%s has install scripts, which were denied; run 'bifrost trust revoke %s@%s' to be asked again", pkg.Name, version, pkg.Name, version)
+	}
+	return true, nil
+}
+
+// runScript runs one install script in dir with env, stopping it once the
+// script timeout passes
+func (i *Installer) runScript(dir string, env []string, event, script string, pkg *resolver.Package) error {
+	ctx := context.Background()
+	if i.scriptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.scriptTimeout)
+		defer cancel()
+	}
+	cmd := scriptCommand(ctx, script)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = i.out
+	cmd.Stderr = i.out
+	// Children of the shell may keep its output open after it is killed
+	cmd.WaitDelay = time.Second
+	i.logf("Running %s script of %s@%s in %s: %s\n", event, pkg.Name, pkg.Version, dir, commandLine(cmd.Args))
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s script of %s@%s timed out after %s", event, pkg.Name, pkg.Version, i.scriptTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%s script of %s@%s failed: %w", event, pkg.Name, pkg.Version, err)
+	}
+	return nil
+}
+
+// scriptCommand returns the command running script with the platform shell
+func scriptCommand(ctx context.Context, script string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", script)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", script)
+}
+
+// scriptEnvVars are the variables install scripts inherit; everything else,
+// credentials and tokens included, is left out. Names are matched without
+// regard to case, as Windows does.
+var scriptEnvVars = map[string]bool{
+	"HOME": true, "USER": true, "USERNAME": true, "LOGNAME": true, "SHELL": true,
+	"LANG": true, "LANGUAGE": true, "TERM": true, "TZ": true,
+	"TMPDIR": true, "TEMP": true, "TMP": true,
+	"SYSTEMROOT": true, "SYSTEMDRIVE": true, "WINDIR": true, "COMSPEC": true,
+	"PATHEXT": true, "USERPROFILE": true, "APPDATA": true, "LOCALAPPDATA": true,
+}
+
+// scriptEnv returns the environment install scripts run with in dir, built
+// from environ: the allowed variables and locale settings, PWD pinned to
+// dir, and a PATH of the package's own bin directory followed by the
+// absolute entries of the inherited one. Relative entries such as "." are
+// dropped so a script cannot shadow system commands with files of its own.
+func scriptEnv(environ []string, dir string) []string {
+	var env []string
+	var inherited string
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		upper := strings.ToUpper(name)
+		switch {
+		case upper == "PATH":
+			inherited = value
+		case scriptEnvVars[upper] || strings.HasPrefix(upper, "LC_"):
+			env = append(env, kv)
+		}
+	}
+
+	path := []string{filepath.Join(dir, "bin")}
+	for _, entry := range filepath.SplitList(inherited) {
+		if filepath.IsAbs(entry) {
+			path = append(path, entry)
+		}
+	}
+	return append(env, "PATH="+strings.Join(path, string(os.PathListSeparator)), "PWD="+dir)
+}
+
+// commandLine formats args for the log, quoting those with spaces or
+// nothing in them
+func commandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for n, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'") {
+			arg = strconv.Quote(arg)
+		}
+		quoted[n] = arg
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,63 @@
+package install
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/link"
+	"github.com/javanhut/bifrost/internal/refs"
+	"github.com/javanhut/bifrost/internal/resolver"
+)
+
+// InstallStdlib installs a package the registry blesses as part of the
+// Carrion standard library into the shared global package directory, which
+// the interpreter searches, and makes the installed version the active one.
+// Versions live side by side in versioned subdirectories; the package's
+// config.CurrentLink link points at the active one.
+func (i *Installer) InstallStdlib(packageName string, version string) error {
+	i.report = newReport()
+	defer i.finish()
+
+	if err := i.recoverInterrupted(); err != nil {
+		return err
+	}
+	client := i.registryClient()
+
+	i.emit(Event{Kind: EventResolving, Package: packageName})
+	pkg, info, err := i.resolvePackageInfo(client, packageName, version)
+	if err != nil {
+		return err
+	}
+	if !info.Stdlib {
+		return fmt.Errorf("%s is not part of the Carrion standard library; install it with --global instead", packageName)
+	}
+
+	// The standard library belongs to the system rather than the project
+	// the install ran in, so gc keeps it when the project goes away
+	if err := i.installShared(client, pkg, refs.Explicit); err != nil {
+		return err
+	}
+	return i.activateStdlib(pkg)
+}
+
+// activateStdlib points the current link of pkg in the shared directory at
+// its installed version
+func (i *Installer) activateStdlib(pkg *resolver.Package) error {
+	packageDir := filepath.Join(i.config.GetSharedGlobalPackagesDir(), pkg.Name)
+	versionDir := filepath.Join(packageDir, pkg.Version.String())
+	currentPath := filepath.Join(packageDir, config.CurrentLink)
+	if link.Source(currentPath) == versionDir {
+		return nil
+	}
+
+	copied, err := link.Create(versionDir, currentPath)
+	if err != nil {
+		return fmt.Errorf("failed to activate %s@%s: %w", pkg.Name, pkg.Version, err)
+	}
+	if copied {
+		fmt.Fprintf(i.out, "Symlinks are unavailable here, copied %s instead\n", currentPath)
+	}
+	i.logf("Activated %s@%s in %s\n", pkg.Name, pkg.Version, packageDir)
+	return nil
+}
@@ -0,0 +1,62 @@
+package install
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/link"
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+)
+
+func TestInstaller_InstallStdlib(t *testing.T) {
+	reg := registrytest.New()
+	for _, v := range []string{"1.0.0", "1.1.0"} {
+		archive, err := registrytest.Archive(map[string]string{"collections.crl": "# collections " + v})
+		if err != nil {
+			t.Fatalf("failed to build archive: %v", err)
+		}
+		reg.AddPackage(registry.PackageInfo{Name: "collections", Version: v, Stdlib: true}, archive)
+	}
+	archive, err := registrytest.Archive(map[string]string{"src/main.crl": "# json-utils"})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0"}, archive)
+
+	cfg := newTestConfig(t, registrytest.URL)
+	cfg.GlobalPackagesDir = filepath.Join(t.TempDir(), "lib")
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	currentPath := filepath.Join(cfg.GlobalPackagesDir, "collections", config.CurrentLink)
+	for _, v := range []string{"1.0.0", "1.1.0", "1.0.0"} {
+		if err := installer.InstallStdlib("collections", v); err != nil {
+			t.Fatalf("InstallStdlib(%s) error = %v", v, err)
+		}
+		if got, want := link.Source(currentPath), filepath.Join(cfg.GlobalPackagesDir, "collections", v); got != want {
+			t.Errorf("after installing %s, %s points at %q, want %q", v, config.CurrentLink, got, want)
+		}
+		data, err := os.ReadFile(filepath.Join(currentPath, "collections.crl"))
+		if err != nil || string(data) != "# collections "+v {
+			t.Errorf("active collections.crl = %q, %v", data, err)
+		}
+	}
+
+	// Both versions stay installed side by side
+	if _, err := os.Stat(filepath.Join(cfg.GlobalPackagesDir, "collections", "1.1.0", "collections.crl")); err != nil {
+		t.Errorf("inactive version removed: %v", err)
+	}
+
+	if err := installer.InstallStdlib("json-utils", ""); err == nil || !strings.Contains(err.Error(), "not part of the Carrion standard library") {
+		t.Errorf("InstallStdlib() of a package that is not blessed error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.GlobalPackagesDir, "json-utils")); !os.IsNotExist(err) {
+		t.Errorf("package that is not blessed was installed: %v", err)
+	}
+}
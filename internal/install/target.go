@@ -0,0 +1,62 @@
+package install
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/resolver"
+)
+
+// CurrentTarget returns the platform target of this machine, its operating
+// system and architecture as Go names them, e.g. "linux-amd64"
+func CurrentTarget() string {
+	return runtime.GOOS + "-" + runtime.GOARCH
+}
+
+var targetRegex = regexp.MustCompile(`^[a-z0-9]+-[a-z0-9_]+$`)
+
+// ValidateTarget returns an error unless target has the "<os>-<arch>" form
+func ValidateTarget(target string) error {
+	if !targetRegex.MatchString(target) {
+		return fmt.Errorf("invalid target %q: use <os>-<arch>, such as %s", target, CurrentTarget())
+	}
+	return nil
+}
+
+// SetTarget makes installs pick the prebuilt archives of packages for
+// target instead of the current platform, to install into a staging
+// directory for another machine
+func (i *Installer) SetTarget(target string) {
+	i.target = target
+}
+
+// platformTarget returns the target prebuilt archives are picked for
+func (i *Installer) platformTarget() string {
+	if i.target != "" {
+		return i.target
+	}
+	return CurrentTarget()
+}
+
+// artifact returns the platform target whose prebuilt archive is installed
+// for pkg and the checksum that archive must have. Platform-independent
+// packages give an empty target and the package archive's checksum.
+func (i *Installer) artifact(pkg *resolver.Package) (string, string, error) {
+	if len(pkg.Artifacts) == 0 {
+		return "", pkg.Checksum, nil
+	}
+	target := i.platformTarget()
+	checksum, ok := pkg.Artifacts[target]
+	if !ok {
+		targets := make([]string, 0, len(pkg.Artifacts))
+		for t := range pkg.Artifacts {
+			targets = append(targets, t)
+		}
+		sort.Strings(targets)
+		return "", "", fmt.Errorf("%s@%s has no prebuilt archive for %s (available: %s)", pkg.RegistryName(), pkg.Version, target, strings.Join(targets, ", "))
+	}
+	return target, checksum, nil
+}
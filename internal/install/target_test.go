@@ -0,0 +1,91 @@
+package install
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+)
+
+func TestValidateTarget(t *testing.T) {
+	for target, valid := range map[string]bool{
+		"linux-amd64":   true,
+		"darwin-arm64":  true,
+		CurrentTarget(): true,
+		"linux":         false,
+		"Linux-AMD64":   false,
+		"../x-y":        false,
+	} {
+		if err := ValidateTarget(target); (err == nil) != valid {
+			t.Errorf("ValidateTarget(%q) error = %v, want valid %v", target, err, valid)
+		}
+	}
+}
+
+func TestInstaller_Artifacts(t *testing.T) {
+	reg := registrytest.New()
+	build := func(content string) []byte {
+		archive, err := registrytest.Archive(map[string]string{"src/main.crl": "# json-utils", "lib/native.so": content})
+		if err != nil {
+			t.Fatalf("failed to build archive: %v", err)
+		}
+		return archive
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0"}, build("generic"))
+	reg.AddArtifact("json-utils", "1.0.0", CurrentTarget(), build("native"))
+	reg.AddArtifact("json-utils", "1.0.0", "plan9-mips", build("plan9"))
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\njson-utils = \"^1.0.0\"\n"), 0644)
+	installPath := cfg.LocalPackagePath("json-utils", "1.0.0")
+	installed := func() string {
+		data, _ := os.ReadFile(filepath.Join(installPath, "lib", "native.so"))
+		return string(data)
+	}
+
+	lock, err := installer.InstallManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	if got := installed(); got != "native" {
+		t.Errorf("installed %q, want the archive for %s", got, CurrentTarget())
+	}
+	locked := lock.Find("json-utils")
+	published, _ := reg.Package("json-utils", "1.0.0")
+	info := published.Info
+	if locked.Checksum != info.Checksum || len(locked.Artifacts) != 2 || locked.Artifacts["plan9-mips"] != info.Artifacts["plan9-mips"] {
+		t.Errorf("locked = %+v, want the package checksum and every artifact", locked)
+	}
+	if results, err := installer.Verify(manifestPath, false); err != nil || !results[0].OK() {
+		t.Errorf("Verify() = %+v, %v", results, err)
+	}
+	if results, err := installer.Verify(manifestPath, true); err != nil || !results[0].OK() || results[0].Republished {
+		t.Errorf("Verify(remote) = %+v, %v", results, err)
+	}
+
+	// Cross-installs pick another platform's archive from the lockfile
+	os.RemoveAll(installPath)
+	installer.SetTarget("plan9-mips")
+	if err := installer.InstallLocked(manifestPath); err != nil {
+		t.Fatalf("InstallLocked() error = %v", err)
+	}
+	if got := installed(); got != "plan9" {
+		t.Errorf("installed %q for plan9-mips", got)
+	}
+
+	os.RemoveAll(installPath)
+	installer.SetTarget("windows-arm64")
+	if err := installer.InstallLocked(manifestPath); err == nil || !strings.Contains(err.Error(), "no prebuilt archive for windows-arm64") {
+		t.Errorf("InstallLocked() for a target without an archive error = %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package install
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/javanhut/bifrost/internal/tlog"
+)
+
+// SetTransparencyLog makes installs look up the checksum of every archive
+// in log, whether it is downloaded or already cached, and makes cache
+// imports look up every archive they bring in. Archives the log does not
+// record are refused.
+func (i *Installer) SetTransparencyLog(log *tlog.Client) {
+	i.tlog = log
+}
+
+// checkTransparencyLog fails unless the transparency log, when one is set,
+// records checksum as name@version's
+func (i *Installer) checkTransparencyLog(name, version, checksum string) error {
+	return i.checkLogged(name+"@"+version, checksum)
+}
+
+// checkLogged fails unless the transparency log, when one is set, records
+// checksum as the checksum of what
+func (i *Installer) checkLogged(what, checksum string) error {
+	if i.tlog == nil {
+		return nil
+	}
+	entry, err := i.tlog.Find(checksum)
+	if err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	i.logf("Found %s in the transparency log at index %d\n", what, entry.LogIndex)
+	return nil
+}
+
+// LoggedPackage is a package version looked up in the transparency log
+type LoggedPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Checksum is the checksum of the package archive the log was searched
+	// for
+	Checksum string      `json:"checksum"`
+	Entry    *tlog.Entry `json:"entry,omitempty"`
+}
+
+// LogEntry looks up name@version, the newest version for an empty one, in
+// the transparency log by the checksum its registry lists for the package
+// archive. When the lookup fails, what was looked up is returned with the
+// error.
+func (i *Installer) LogEntry(name, version string) (*LoggedPackage, error) {
+	if i.tlog == nil {
+		return nil, errors.New("no transparency log is configured; set tlog.url")
+	}
+	client, err := i.clientFor(i.registryClient(), name)
+	if err != nil {
+		return nil, err
+	}
+	pkg, err := i.resolvePackage(client, name, version)
+	if err != nil {
+		return nil, err
+	}
+	logged := &LoggedPackage{Name: pkg.Name, Version: pkg.Version.String(), Checksum: pkg.Checksum}
+	indexed, err := i.indexChecksum(client, pkg.RegistryName(), logged.Version)
+	if err != nil {
+		return nil, err
+	}
+	if indexed != "" {
+		logged.Checksum = indexed
+	}
+	if logged.Checksum == "" {
+		return nil, fmt.Errorf("the registry lists no checksum for %s@%s to look up", logged.Name, logged.Version)
+	}
+	logged.Entry, err = i.tlog.Find(logged.Checksum)
+	return logged, err
+}
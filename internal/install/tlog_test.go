@@ -0,0 +1,100 @@
+package install
+
+import (
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/errcode"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+	"github.com/javanhut/bifrost/internal/tlog"
+	"github.com/javanhut/bifrost/internal/tlog/tlogtest"
+)
+
+func TestInstaller_TransparencyLog(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0", "1.1.0"})
+	published, _ := reg.Package("json-utils", "1.1.0")
+	log := tlogtest.New()
+	log.Add(published.Info.Checksum)
+	srv := httptest.NewServer(log)
+	defer srv.Close()
+
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+	installer.SetTransparencyLog(tlog.New(srv.URL, nil))
+
+	if err := installer.InstallPackageByName("json-utils", "1.1.0", false); err != nil {
+		t.Fatalf("InstallPackageByName() of a logged version error = %v", err)
+	}
+	logged, err := installer.LogEntry("json-utils", "")
+	if err != nil || logged.Version != "1.1.0" || logged.Checksum != published.Info.Checksum || logged.Entry == nil {
+		t.Errorf("LogEntry() = %+v, %v", logged, err)
+	}
+
+	err = installer.InstallPackageByName("json-utils", "1.0.0", false)
+	if errcode.Of(err) != errcode.UnloggedArchive {
+		t.Fatalf("InstallPackageByName() of an unlogged version error = %v, want %s", err, errcode.UnloggedArchive)
+	}
+	if cached, _ := filepath.Glob(filepath.Join(cfg.CacheDir, "json-utils-1.0.0*")); len(cached) != 0 {
+		t.Errorf("unlogged archive entered the cache: %v", cached)
+	}
+}
+
+func TestInstaller_TransparencyLogCachedArchives(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0", "1.1.0"})
+	published, _ := reg.Package("json-utils", "1.1.0")
+	log := tlogtest.New()
+	log.Add(published.Info.Checksum)
+	srv := httptest.NewServer(log)
+	defer srv.Close()
+
+	// Both versions are cached before the log is set
+	cfg := newTestConfig(t, registrytest.URL)
+	unlogged := New(cfg)
+	unlogged.SetClient(reg.Client())
+	unlogged.SetOutput(io.Discard)
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		if err := unlogged.InstallPackageByName("json-utils", version, false); err != nil {
+			t.Fatalf("InstallPackageByName(%s) error = %v", version, err)
+		}
+	}
+
+	// A cached archive the log does not record is not installed
+	shared := newTestConfig(t, registrytest.URL)
+	shared.CacheDir = cfg.CacheDir
+	installer := New(shared)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+	installer.SetTransparencyLog(tlog.New(srv.URL, nil))
+	if err := installer.InstallPackageByName("json-utils", "1.1.0", false); err != nil {
+		t.Fatalf("InstallPackageByName() of a cached logged version error = %v", err)
+	}
+	err := installer.InstallPackageByName("json-utils", "1.0.0", false)
+	if errcode.Of(err) != errcode.UnloggedArchive {
+		t.Fatalf("InstallPackageByName() of a cached unlogged version error = %v, want %s", err, errcode.UnloggedArchive)
+	}
+
+	// Nor is an unlogged archive imported into the cache
+	entries, err := unlogged.CacheEntries()
+	if err != nil {
+		t.Fatalf("CacheEntries() error = %v", err)
+	}
+	bundle := filepath.Join(t.TempDir(), "cache.tar.gz")
+	if err := unlogged.ExportCache(bundle, entries); err != nil {
+		t.Fatalf("ExportCache() error = %v", err)
+	}
+	other := newTestConfig(t, registrytest.URL)
+	importer := New(other)
+	importer.SetOutput(io.Discard)
+	importer.SetTransparencyLog(tlog.New(srv.URL, nil))
+	_, _, err = importer.ImportCache(bundle)
+	if errcode.Of(err) != errcode.UnloggedArchive {
+		t.Fatalf("ImportCache() of an unlogged archive error = %v, want %s", err, errcode.UnloggedArchive)
+	}
+	if cached, _ := filepath.Glob(filepath.Join(other.CacheDir, "json-utils-1.0.0*")); len(cached) != 0 {
+		t.Errorf("unlogged archive was imported: %v", cached)
+	}
+}
@@ -0,0 +1,91 @@
+package install
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/changelog"
+	"github.com/javanhut/bifrost/internal/manifest"
+)
+
+// WriteUpdateSummary writes what the install of report changed as Markdown,
+// for pasting into a pull request description: a table of the packages
+// added, updated and removed linking to their repositories, then for every
+// update the policy advisory it moves off and the changelog entries in
+// between. Changelogs that cannot be read are noted rather than failing
+// the summary.
+func (i *Installer) WriteUpdateSummary(w io.Writer, report *Report) error {
+	var b strings.Builder
+	b.WriteString("## Dependency updates\n\n")
+	if len(report.Added)+len(report.Updated)+len(report.Removed) == 0 {
+		b.WriteString("No dependencies changed.\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+
+	// Aliases are installed under their own name, and their changelog and
+	// advisories are those of the registry package
+	packageNames := make(map[string]string)
+	for _, p := range report.Packages {
+		packageNames[p.Name] = cmp.Or(p.PackageName, p.Name)
+	}
+	packageName := func(name string) string {
+		return cmp.Or(packageNames[name], name)
+	}
+
+	b.WriteString("| Package | From | To |\n|---|---|---|\n")
+	for _, c := range report.Updated {
+		fmt.Fprintf(&b, "| %s | %s | %s |\n", i.packageLink(c.Name, c.Version), c.Previous, c.Version)
+	}
+	for _, c := range report.Added {
+		fmt.Fprintf(&b, "| %s (added) | | %s |\n", i.packageLink(c.Name, c.Version), c.Version)
+	}
+	for _, c := range report.Removed {
+		fmt.Fprintf(&b, "| %s (removed) | %s | |\n", c.Name, c.Version)
+	}
+
+	for _, c := range report.Updated {
+		name := packageName(c.Name)
+		fmt.Fprintf(&b, "\n### %s %s → %s\n", c.Name, c.Previous, c.Version)
+		if err := i.policy.CheckBlocked(name, c.Previous); err != nil {
+			fmt.Fprintf(&b, "\n**Fixes:** %s\n", err)
+		}
+
+		entries, err := i.Changelog(name, c.Previous, c.Version)
+		switch {
+		case errors.Is(err, changelog.ErrNoChangelog):
+			b.WriteString("\nNo changelog declared.\n")
+		case err != nil:
+			fmt.Fprintf(&b, "\nChangelog unavailable: %v\n", err)
+		case len(entries) == 0:
+			b.WriteString("\nNo changelog entries for these versions.\n")
+		}
+		for _, e := range entries {
+			fmt.Fprintf(&b, "\n#### %s\n", e.Heading)
+			if e.Body != "" {
+				fmt.Fprintf(&b, "\n%s\n", e.Body)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// packageLink returns name as a Markdown link to the repository, or else
+// the homepage, the installed version's manifest declares, or just name
+// when it declares neither
+func (i *Installer) packageLink(name, version string) string {
+	m, err := manifest.Load(filepath.Join(i.config.LocalPackagePath(name, version), manifest.FileName))
+	if err != nil {
+		return name
+	}
+	if url := cmp.Or(m.Package.Repository, m.Package.Homepage); url != "" {
+		return fmt.Sprintf("[%s](%s)", name, url)
+	}
+	return name
+}
@@ -0,0 +1,91 @@
+package install
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/policy"
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+)
+
+func TestInstaller_WriteUpdateSummary(t *testing.T) {
+	reg := registrytest.New()
+	for _, v := range []string{"1.0.0", "1.2.0"} {
+		archive, err := registrytest.Archive(map[string]string{
+			"Bifrost.toml": "[package]\nname = \"json-utils\"\nversion = \"" + v + "\"\nrepository = \"https://git.example.com/json-utils\"\n",
+			"CHANGELOG.md": "# Changelog\n\n## [1.2.0]\n- Streaming parser\n\n## [1.1.0]\n- Faster encoding\n\n## [1.0.0]\n- Initial release\n",
+		})
+		if err != nil {
+			t.Fatalf("failed to build archive: %v", err)
+		}
+		reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: v, Changelog: "CHANGELOG.md"}, archive)
+	}
+	archive, err := registrytest.Archive(map[string]string{"src/main.crl": "grim Main:"})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "http-client", Version: "2.0.0"}, archive)
+	reg.AddPackage(registry.PackageInfo{Name: "left-pad", Version: "1.0.0"}, archive)
+
+	cfg := newTestConfig(t, registrytest.URL)
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	install := func(deps string) *Installer {
+		t.Helper()
+		os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\n"+deps), 0644)
+		installer := New(cfg)
+		installer.SetClient(reg.Client())
+		installer.SetOutput(io.Discard)
+		if _, err := installer.InstallManifest(manifestPath); err != nil {
+			t.Fatalf("InstallManifest() error = %v", err)
+		}
+		return installer
+	}
+
+	var out strings.Builder
+	installer := install("json-utils = \"1.0.0\"\nleft-pad = \"1.0.0\"\n")
+	// A second install changes nothing
+	installer = install("json-utils = \"1.0.0\"\nleft-pad = \"1.0.0\"\n")
+	if err := installer.WriteUpdateSummary(&out, installer.Report()); err != nil {
+		t.Fatalf("WriteUpdateSummary() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "No dependencies changed.") {
+		t.Errorf("summary without changes = %q", out.String())
+	}
+
+	policyPath := filepath.Join(t.TempDir(), policy.FileName)
+	os.WriteFile(policyPath, []byte("[[blocked]]\nname = \"json-utils\"\nversions = \"1.0.0\"\nreason = \"CVE-2024-0001\"\n"), 0644)
+	pol, err := policy.LoadFile(policyPath)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	installer = install("json-utils = \"^1.0.0\"\nhttp-client = \"2.0.0\"\n")
+	installer.SetPolicy(pol)
+	out.Reset()
+	if err := installer.WriteUpdateSummary(&out, installer.Report()); err != nil {
+		t.Fatalf("WriteUpdateSummary() error = %v", err)
+	}
+	summary := out.String()
+	for _, want := range []string{
+		"| [json-utils](https://git.example.com/json-utils) | 1.0.0 | 1.2.0 |",
+		"| http-client (added) | | 2.0.0 |",
+		"| left-pad (removed) | 1.0.0 | |",
+		"### json-utils 1.0.0 → 1.2.0",
+		"**Fixes:** json-utils@1.0.0 is blocked by policy",
+		"CVE-2024-0001",
+		"#### [1.2.0]\n\n- Streaming parser",
+		"#### [1.1.0]\n\n- Faster encoding",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary does not contain %q:\n%s", want, summary)
+		}
+	}
+	if strings.Contains(summary, "Initial release") {
+		t.Errorf("summary contains the changelog entry of the previous version:\n%s", summary)
+	}
+}
@@ -0,0 +1,320 @@
+package install
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/manifest"
+	ver "github.com/javanhut/bifrost/internal/version"
+)
+
+// StagedSuffix is appended to the name of the lockfile for the lockfile of
+// an upgrade awaiting confirmation, e.g. "Bifrost.lock.upgrade"
+const StagedSuffix = ".upgrade"
+
+// ErrNoTestScript is returned by RunTests for projects whose manifest
+// declares no test script
+var ErrNoTestScript = errors.New("no test script declared in [scripts]")
+
+// Upgrade is the upgrade of a direct dependency to a newer version
+type Upgrade struct {
+	Name string `json:"name"`
+	// PackageName is the registry package installed under Name when Name
+	// is an alias
+	PackageName string `json:"package,omitempty"`
+	// From is the locked version, empty when the dependency is not locked
+	// yet
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	// Constraint is the constraint the manifest gets once the upgrade is
+	// confirmed
+	Constraint string `json:"constraint"`
+	// Major is set for upgrades crossing a major version
+	Major bool `json:"major"`
+}
+
+// RegistryName returns the registry package being upgraded
+func (u *Upgrade) RegistryName() string {
+	return cmp.Or(u.PackageName, u.Name)
+}
+
+// StagedLockPath returns the path of the lockfile an upgrade of the project
+// at manifestPath is staged in
+func (i *Installer) StagedLockPath(manifestPath string) string {
+	return i.lockPath(manifestPath) + StagedSuffix
+}
+
+// checkNotStaged fails while an upgrade of the project at manifestPath
+// awaits confirmation
+func (i *Installer) checkNotStaged(manifestPath string) error {
+	staged := i.StagedLockPath(manifestPath)
+	if _, err := os.Stat(staged); err == nil {
+		return fmt.Errorf("an upgrade is staged in %s already; confirm or abandon it first", filepath.Base(staged))
+	}
+	return nil
+}
+
+// PlanUpgrade returns the upgrade of the dependency called name of the
+// project at manifestPath to version, or to the newest version for an empty
+// one. Upgrades crossing a major version are refused unless major is set.
+func (i *Installer) PlanUpgrade(manifestPath, name, version string, major bool) (*Upgrade, error) {
+	if err := i.checkNotStaged(manifestPath); err != nil {
+		return nil, err
+	}
+	m, err := i.loadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	constraint, ok := m.Dependencies[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a dependency in %s", name, manifest.FileName)
+	}
+	lock, err := lockfile.LoadIfExists(i.lockPath(manifestPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lockfile: %w", err)
+	}
+
+	up := &Upgrade{Name: name}
+	if pkg := m.PackageName(name); pkg != name {
+		up.PackageName = pkg
+	}
+	client, err := i.clientFor(i.registryClient(), up.RegistryName())
+	if err != nil {
+		return nil, err
+	}
+	target, err := i.resolvePackage(client, up.RegistryName(), version)
+	if err != nil {
+		return nil, err
+	}
+	up.To = target.Version.String()
+	up.Constraint = "^" + up.To
+
+	var locked *lockfile.Package
+	if lock != nil {
+		locked = lock.Find(name)
+	}
+	if from, err := ver.Parse(lockedVersion(locked)); err == nil {
+		up.From = from.String()
+		if target.Version.Compare(from) <= 0 {
+			return nil, fmt.Errorf("%s is at %s, and %s is not newer", name, up.From, up.To)
+		}
+		up.Major = target.Version.Major != from.Major
+	} else {
+		// Without a locked version, the constraint tells which major is in
+		// use
+		c, err := ver.ParseConstraint(constraint)
+		up.Major = err != nil || !c.Satisfies(target.Version)
+	}
+	if up.Major && !major {
+		return nil, fmt.Errorf("upgrading %s to %s crosses a major version; pass --major to review its changelog and test the upgrade before keeping it", name, up.To)
+	}
+	return up, nil
+}
+
+// lockedVersion returns the version of locked, or "" for nil
+func lockedVersion(locked *lockfile.Package) string {
+	if locked == nil {
+		return ""
+	}
+	return locked.Version
+}
+
+// StageUpgrade installs the project at manifestPath with up applied,
+// recording the result in the staged lockfile rather than the lockfile.
+// Every other dependency stays at its locked version. The manifest and
+// lockfile are left as they were until ConfirmUpgrade.
+func (i *Installer) StageUpgrade(manifestPath string, up *Upgrade) (*lockfile.Lockfile, error) {
+	i.report = newReport()
+	defer i.finish()
+
+	if err := i.checkNotStaged(manifestPath); err != nil {
+		return nil, err
+	}
+	m, err := i.loadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	deps := make(map[string]string, len(m.Dependencies))
+	for name, constraint := range m.Dependencies {
+		deps[name] = constraint
+	}
+	deps[up.Name] = up.Constraint
+	m.Dependencies = deps
+
+	lockPath := i.lockPath(manifestPath)
+	previous, err := lockfile.LoadIfExists(lockPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lockfile: %w", err)
+	}
+	if err := i.checkPinned(m, previous, up); err != nil {
+		return nil, err
+	}
+	return i.installManifest(m, lockPath, i.StagedLockPath(manifestPath))
+}
+
+// checkPinned fails unless resolving m against previous keeps every direct
+// dependency but the one up upgrades at its locked version, so that an
+// upgrade never moves other dependencies behind the user's back
+func (i *Installer) checkPinned(m *manifest.Manifest, previous *lockfile.Lockfile, up *Upgrade) error {
+	if previous == nil {
+		return nil
+	}
+	resolution, err := i.resolveManifest(m, previous)
+	if err != nil {
+		return fmt.Errorf("failed to resolve dependencies: %w", err)
+	}
+	for _, name := range sortedKeys(m.Dependencies) {
+		locked := previous.Find(name)
+		pkg := resolution.Packages[name]
+		if name == up.Name || locked == nil || pkg == nil {
+			continue
+		}
+		if v := pkg.Version.String(); v != locked.Version {
+			return fmt.Errorf("upgrading %s to %s would move %s from %s to %s; upgrade %s first", up.Name, up.To, name, locked.Version, v, name)
+		}
+	}
+	return nil
+}
+
+// stagedConstraints returns the constraints of the direct dependencies an
+// upgrade staged in staged changed from those in previous
+func stagedConstraints(staged, previous *lockfile.Lockfile) map[string]string {
+	constraints := make(map[string]string)
+	for _, pkg := range staged.Packages {
+		if pkg.Constraint == "" {
+			continue
+		}
+		if previous != nil {
+			if locked := previous.Find(pkg.Name); locked != nil && locked.Constraint == pkg.Constraint {
+				continue
+			}
+		}
+		constraints[pkg.Name] = pkg.Constraint
+	}
+	return constraints
+}
+
+// ConfirmUpgrade keeps the upgrade staged for the project at manifestPath:
+// the manifest gets the constraints it was staged with, and the staged
+// lockfile replaces the lockfile. Dependencies a selected profile declares
+// are updated in the profile.
+func (i *Installer) ConfirmUpgrade(manifestPath string) (*lockfile.Lockfile, error) {
+	staged := i.StagedLockPath(manifestPath)
+	lock, err := lockfile.LoadIfExists(staged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load staged lockfile: %w", err)
+	}
+	if lock == nil {
+		return nil, fmt.Errorf("no upgrade is staged in %s", filepath.Base(staged))
+	}
+
+	lockPath := i.lockPath(manifestPath)
+	previous, err := lockfile.LoadIfExists(lockPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lockfile: %w", err)
+	}
+	constraints := stagedConstraints(lock, previous)
+
+	// The staged lockfile was resolved from the manifest as it was then;
+	// refuse to keep it for a manifest edited since
+	current, err := i.loadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	for name, constraint := range constraints {
+		if _, ok := current.Dependencies[name]; ok {
+			current.Dependencies[name] = constraint
+		}
+	}
+	if lock.Drifted(current) {
+		return nil, fmt.Errorf("%s changed since the upgrade was staged; abandon it and upgrade again", manifest.FileName)
+	}
+
+	m, err := manifest.Load(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifest: %w", err)
+	}
+	var edits []manifest.Edit
+	profile := m.Profiles[i.config.Profile]
+	for _, name := range sortedKeys(constraints) {
+		if profile != nil && profile.Dependencies[name] != "" {
+			pkg := cmp.Or(profile.Aliases[name], name)
+			edits = append(edits, manifest.SetDependency("profile."+i.config.Profile+".dependencies", name, pkg, constraints[name]))
+		} else if _, ok := m.Dependencies[name]; ok {
+			edits = append(edits, manifest.SetDependency("dependencies", name, m.PackageName(name), constraints[name]))
+		}
+	}
+	if err := manifest.EditFile(manifestPath, edits...); err != nil {
+		return nil, fmt.Errorf("failed to save manifest: %w", err)
+	}
+
+	if err := os.Rename(staged, lockPath); err != nil {
+		return nil, fmt.Errorf("failed to replace lockfile: %w", err)
+	}
+	if err := i.signLock(lockPath); err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// AbandonUpgrade drops the upgrade staged for the project at manifestPath:
+// the packages it installed are removed and those of the lockfile installed
+// again
+func (i *Installer) AbandonUpgrade(manifestPath string) error {
+	staged := i.StagedLockPath(manifestPath)
+	lock, err := lockfile.LoadIfExists(staged)
+	if err != nil {
+		return fmt.Errorf("failed to load staged lockfile: %w", err)
+	}
+	if lock == nil {
+		return fmt.Errorf("no upgrade is staged in %s", filepath.Base(staged))
+	}
+	previous, err := lockfile.LoadIfExists(i.lockPath(manifestPath))
+	if err != nil {
+		return fmt.Errorf("failed to load lockfile: %w", err)
+	}
+
+	for _, pkg := range lock.Packages {
+		if previous != nil && lockedVersion(previous.Find(pkg.Name)) == pkg.Version {
+			continue
+		}
+		if err := removeInstalled(i.config.LocalPackagePath(pkg.Name, pkg.Version)); err != nil {
+			return fmt.Errorf("failed to remove %s@%s: %w", pkg.Name, pkg.Version, err)
+		}
+	}
+	if err := os.Remove(staged); err != nil {
+		return err
+	}
+	if previous == nil {
+		return nil
+	}
+	return i.InstallLocked(manifestPath)
+}
+
+// RunTests runs the test script of the project at manifestPath in the
+// project directory. Unlike install scripts it is the project's own, so it
+// runs with the user's environment and no timeout.
+func (i *Installer) RunTests(manifestPath string) error {
+	m, err := manifest.Load(manifestPath)
+	if err != nil {
+		return fmt.Errorf("failed to load manifest: %w", err)
+	}
+	script := m.Scripts["test"]
+	if script == "" {
+		return ErrNoTestScript
+	}
+	cmd := scriptCommand(context.Background(), script)
+	cmd.Dir = filepath.Dir(manifestPath)
+	cmd.Stdout = i.out
+	cmd.Stderr = i.out
+	i.logf("Running test script of %s: %s\n", m.Package.Name, commandLine(cmd.Args))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("test script failed: %w", err)
+	}
+	return nil
+}
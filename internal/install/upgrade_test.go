@@ -0,0 +1,140 @@
+package install
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/manifest"
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+)
+
+func TestInstaller_Upgrade(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0", "1.2.0", "2.0.0"})
+	addPackage := func(name, v string) {
+		archive, err := registrytest.Archive(map[string]string{"src/main.crl": name + " " + v})
+		if err != nil {
+			t.Fatalf("failed to build archive: %v", err)
+		}
+		reg.AddPackage(registry.PackageInfo{Name: name, Version: v}, archive)
+	}
+	addPackage("http-client", "1.0.0")
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+
+	dir := t.TempDir()
+	manifestPath := filepath.Join(dir, "Bifrost.toml")
+	manifestText := `[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+http-client = "^1.0.0"
+json-utils = "~1.0.0"
+`
+	os.WriteFile(manifestPath, []byte(manifestText), 0644)
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	// Other dependencies stay at their locked versions through the upgrade
+	addPackage("http-client", "1.1.0")
+	lockPath := filepath.Join(dir, lockfile.FileName)
+	original, _ := os.ReadFile(lockPath)
+
+	if _, err := installer.PlanUpgrade(manifestPath, "json-utils", "", false); err == nil || !strings.Contains(err.Error(), "--major") {
+		t.Errorf("PlanUpgrade() across a major without major error = %v", err)
+	}
+	if _, err := installer.PlanUpgrade(manifestPath, "json-utils", "1.0.0", false); err == nil {
+		t.Error("PlanUpgrade() to the locked version succeeded")
+	}
+	if _, err := installer.PlanUpgrade(manifestPath, "left-pad", "", true); err == nil {
+		t.Error("PlanUpgrade() of a package that is not a dependency succeeded")
+	}
+	up, err := installer.PlanUpgrade(manifestPath, "json-utils", "", true)
+	if err != nil {
+		t.Fatalf("PlanUpgrade() error = %v", err)
+	}
+	if up.From != "1.0.0" || up.To != "2.0.0" || !up.Major || up.Constraint != "^2.0.0" {
+		t.Errorf("PlanUpgrade() = %+v", up)
+	}
+
+	stage := func() {
+		t.Helper()
+		if _, err := installer.StageUpgrade(manifestPath, up); err != nil {
+			t.Fatalf("StageUpgrade() error = %v", err)
+		}
+		if !cfg.LocalPackageInstalled("json-utils", "2.0.0") {
+			t.Error("staged upgrade not installed")
+		}
+		if data, _ := os.ReadFile(lockPath); string(data) != string(original) {
+			t.Error("StageUpgrade() changed the lockfile")
+		}
+		if _, err := installer.PlanUpgrade(manifestPath, "json-utils", "", true); err == nil {
+			t.Error("PlanUpgrade() succeeded with an upgrade staged")
+		}
+	}
+
+	stage()
+	if err := installer.AbandonUpgrade(manifestPath); err != nil {
+		t.Fatalf("AbandonUpgrade() error = %v", err)
+	}
+	if cfg.LocalPackageInstalled("json-utils", "2.0.0") || !cfg.LocalPackageInstalled("json-utils", "1.0.0") {
+		t.Error("AbandonUpgrade() left the upgrade installed")
+	}
+	if _, err := os.Stat(installer.StagedLockPath(manifestPath)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("staged lockfile left behind: %v", err)
+	}
+
+	stage()
+	os.WriteFile(manifestPath, []byte(strings.Replace(manifestText, `"^1.0.0"`, `"^1.1.0"`, 1)), 0644)
+	if _, err := installer.ConfirmUpgrade(manifestPath); err == nil || !strings.Contains(err.Error(), "changed since the upgrade was staged") {
+		t.Errorf("ConfirmUpgrade() after editing the manifest error = %v", err)
+	}
+	os.WriteFile(manifestPath, []byte(manifestText), 0644)
+	lock, err := installer.ConfirmUpgrade(manifestPath)
+	if err != nil {
+		t.Fatalf("ConfirmUpgrade() error = %v", err)
+	}
+	if locked := lock.Find("json-utils"); locked == nil || locked.Version != "2.0.0" {
+		t.Errorf("confirmed lock has json-utils %+v", locked)
+	}
+	if locked := lock.Find("http-client"); locked == nil || locked.Version != "1.0.0" {
+		t.Errorf("confirmed lock has http-client %+v, want 1.0.0 kept", locked)
+	}
+	m, _ := manifest.Load(manifestPath)
+	if m.Dependencies["json-utils"] != "^2.0.0" {
+		t.Errorf("manifest constraint = %q, want ^2.0.0", m.Dependencies["json-utils"])
+	}
+	// The lockfile matches the manifest again
+	if err := installer.InstallLocked(manifestPath); err != nil {
+		t.Errorf("InstallLocked() after ConfirmUpgrade() error = %v", err)
+	}
+}
+
+func TestInstaller_RunTests(t *testing.T) {
+	installer := New(newTestConfig(t, registrytest.URL))
+	var out strings.Builder
+	installer.SetOutput(&out)
+
+	dir := t.TempDir()
+	manifestPath := filepath.Join(dir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n"), 0644)
+	if err := installer.RunTests(manifestPath); !errors.Is(err, ErrNoTestScript) {
+		t.Errorf("RunTests() without a test script error = %v", err)
+	}
+
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[scripts]\ntest = \"echo tested\"\n"), 0644)
+	if err := installer.RunTests(manifestPath); err != nil || !strings.Contains(out.String(), "tested") {
+		t.Errorf("RunTests() error = %v, output %q", err, out.String())
+	}
+
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[scripts]\ntest = \"exit 1\"\n"), 0644)
+	if err := installer.RunTests(manifestPath); err == nil {
+		t.Error("RunTests() of a failing test script succeeded")
+	}
+}
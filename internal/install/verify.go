@@ -0,0 +1,41 @@
+package install
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/javanhut/bifrost/internal/errcode"
+	"github.com/javanhut/bifrost/internal/manifest"
+	"github.com/javanhut/bifrost/internal/resolver"
+	"github.com/javanhut/bifrost/internal/warn"
+)
+
+// verifyEmbeddedManifest checks that the Bifrost.toml extracted into dir
+// names the package and version that were requested, so an archive uploaded
+// under the wrong name or version is not installed as something it is not,
+// declares a license the policy allows and runs on the Carrion
+// interpreter. Versions published before their package was renamed embed
+// the old name.
+// Archives without a manifest cannot be checked and only get a warning.
+func (i *Installer) verifyEmbeddedManifest(dir string, pkg *resolver.Package) error {
+	path := filepath.Join(dir, manifest.FileName)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		warn.Printf(warn.Integrity, "%s@%s has no %s, cannot verify its name and version", pkg.RegistryName(), pkg.Version, manifest.FileName)
+		return nil
+	}
+
+	m, err := manifest.Load(path)
+	if err != nil {
+		return fmt.Errorf("failed to read embedded %s: %w", manifest.FileName, err)
+	}
+	want := fmt.Sprintf("%s@%s", pkg.RegistryName(), pkg.Version)
+	got := fmt.Sprintf("%s@%s", m.Package.Name, m.Package.Version)
+	if got != want && !(m.Package.Version == pkg.Version.String() && i.wasRenamedTo(m.Package.Name, pkg.RegistryName())) {
+		return errcode.MislabeledArchive.Errorf("archive for %s contains the manifest of %s; the registry may be serving a mislabeled upload", want, got)
+	}
+	if err := i.policy.CheckLicense(pkg.RegistryName(), pkg.Version.String(), m.Package.License); err != nil {
+		return err
+	}
+	return i.checkCarrion(pkg, m.Package.Carrion)
+}
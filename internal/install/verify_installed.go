@@ -0,0 +1,267 @@
+package install
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/javanhut/bifrost/internal/archive"
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/freeze"
+	"github.com/javanhut/bifrost/internal/link"
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/resolver"
+	ver "github.com/javanhut/bifrost/internal/version"
+)
+
+// VerifyResult compares an installed package with the archive of its
+// version
+type VerifyResult struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Path    string `json:"path"`
+	// LockedChecksum is the archive checksum in the lockfile, and
+	// RegistryChecksum that of the archive the registry serves now, only
+	// checked with remote
+	LockedChecksum   string `json:"locked_checksum,omitempty"`
+	RegistryChecksum string `json:"registry_checksum,omitempty"`
+	// Republished is set when the registry's archive is no longer the one
+	// the lockfile was written against
+	Republished  bool `json:"republished,omitempty"`
+	NotInstalled bool `json:"not_installed,omitempty"`
+	// Modified files differ from the archive and Missing files are in the
+	// archive but not installed, apart from docs left out by the install
+	Modified []string `json:"modified,omitempty"`
+	Missing  []string `json:"missing,omitempty"`
+	// Extra files are installed but not in the archive, such as files
+	// written by install scripts. They do not fail verification.
+	Extra []string `json:"extra,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// OK reports whether the package is installed exactly as its archive has it
+func (r *VerifyResult) OK() bool {
+	return r.Error == "" && !r.Republished && !r.NotInstalled && len(r.Modified) == 0 && len(r.Missing) == 0
+}
+
+// Verify compares the packages installed for the lockfile next to the
+// manifest at manifestPath, file by file, with the archives of their
+// versions. Without remote the archives come from the cache and must still
+// match the lockfile's checksums. With remote they are downloaded from the
+// registry again, and the checksum the registry lists now is compared with
+// the lockfile's, which catches an upload modified after the lockfile was
+// written.
+func (i *Installer) Verify(manifestPath string, remote bool) ([]*VerifyResult, error) {
+	lock, err := i.loadCurrentLock(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		return nil, fmt.Errorf("%s not found; run 'bifrost install' to create it", i.lockPath(manifestPath))
+	}
+
+	client := i.registryClient()
+	var results []*VerifyResult
+	for _, e := range freeze.FromLockfile(lock) {
+		results = append(results, i.verifyInstalled(client, e, remote))
+	}
+	return results, nil
+}
+
+func (i *Installer) verifyInstalled(client *registry.Client, e freeze.Entry, remote bool) *VerifyResult {
+	r := &VerifyResult{Name: e.Name, Version: e.Version, Path: i.config.LocalPackagePath(e.Name, e.Version), LockedChecksum: e.Checksum}
+	if !i.config.LocalPackageInstalled(e.Name, e.Version) {
+		r.NotInstalled = true
+		return r
+	}
+
+	var files map[string]string
+	var err error
+	if remote {
+		name := e.Name
+		if e.PackageName != "" {
+			name = e.PackageName
+		}
+		// Packages with prebuilt archives were installed from the one for
+		// the platform
+		target := ""
+		if len(e.Artifacts) > 0 {
+			target = i.platformTarget()
+		}
+		if client, err = i.clientFor(client, name); err == nil {
+			files, err = r.registryFiles(client, e, target)
+		}
+	} else {
+		files, err = i.cachedFiles(e)
+	}
+	if err == nil {
+		err = r.compare(files)
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// registryFiles downloads the archive of e from the registry, or its
+// prebuilt archive for target when that is set, and returns the checksums
+// of its files
+func (r *VerifyResult) registryFiles(client *registry.Client, e freeze.Entry, target string) (map[string]string, error) {
+	name := e.Name
+	if e.PackageName != "" {
+		name = e.PackageName
+	}
+	info, err := client.GetPackageInfo(name, e.Version)
+	if err != nil {
+		return nil, err
+	}
+	listed, locked := info.Checksum, e.Checksum
+	var download *registry.Download
+	if target != "" {
+		listed, locked = info.Artifacts[target], e.Artifacts[target]
+		r.LockedChecksum = locked
+		download, err = client.DownloadArtifact(name, e.Version, target, e.Format)
+	} else {
+		download, err = client.DownloadPackage(name, e.Version, e.Format)
+	}
+	r.RegistryChecksum = listed
+	if err != nil {
+		return nil, fmt.Errorf("failed to download package: %w", err)
+	}
+	defer download.Close()
+	hash := sha256.New()
+	tee := io.TeeReader(download, hash)
+	files, err := archiveFiles(tee)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return nil, fmt.Errorf("failed to download package: %w", err)
+	}
+
+	served := "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	if listed != "" && served != listed {
+		return nil, fmt.Errorf("registry lists checksum %s but serves an archive with %s", listed, served)
+	}
+	if r.RegistryChecksum == "" {
+		r.RegistryChecksum = served
+	}
+	r.Republished = locked != "" && served != locked
+	return files, nil
+}
+
+// cachedFiles returns the checksums of the files in the cached archive of
+// e, which must match the lockfile
+func (i *Installer) cachedFiles(e freeze.Entry) (map[string]string, error) {
+	v, err := ver.Parse(e.Version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version: %w", err)
+	}
+	pkg := &resolver.Package{Name: e.Name, PackageName: e.PackageName, Version: v, Format: e.Format, Checksum: e.Checksum, Artifacts: e.Artifacts}
+	_, expected, err := i.artifact(pkg)
+	if err != nil {
+		return nil, err
+	}
+	path := i.cacheArchivePath(pkg)
+	if !cachedArchiveMatches(path, expected) {
+		return nil, fmt.Errorf("no cached archive matching %s; run 'bifrost fetch --frozen-lockfile' or verify with --remote", lockfile.FileName)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return archiveFiles(f)
+}
+
+// archiveFiles returns the sha256 checksums of the regular files in an
+// archive, by the path they are extracted to
+func archiveFiles(r io.Reader) (map[string]string, error) {
+	zr, err := archive.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	names := archive.NewNames()
+	files := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Name == "./" || header.Name == "." || header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name, err := names.Add(header.Name)
+		if err != nil {
+			return nil, err
+		}
+		hash := sha256.New()
+		if _, err := io.Copy(hash, tr); err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		files[name] = "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	}
+}
+
+// compare records how the files installed at r.Path differ from files
+func (r *VerifyResult) compare(files map[string]string) error {
+	root, err := filepath.EvalSymlinks(r.Path)
+	if err != nil {
+		return err
+	}
+	installed := make(map[string]bool)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		// The flat layout records the installed version next to the files,
+		// aliases their package, and copies made in place of links are
+		// marked
+		if rel == config.VersionFile || rel == config.PackageFile || rel == link.MarkerFile {
+			return nil
+		}
+		installed[rel] = true
+
+		want, ok := files[rel]
+		if !ok {
+			r.Extra = append(r.Extra, rel)
+			return nil
+		}
+		if got, err := archiveChecksum(path); err != nil {
+			return err
+		} else if got != want {
+			r.Modified = append(r.Modified, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for name := range files {
+		// Docs are only extracted on request
+		if !installed[name] && !isDocPath(name) {
+			r.Missing = append(r.Missing, name)
+		}
+	}
+	sort.Strings(r.Missing)
+	return nil
+}
@@ -0,0 +1,133 @@
+package install
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+)
+
+func TestInstaller_Verify(t *testing.T) {
+	reg := registrytest.New()
+	archive, err := registrytest.Archive(map[string]string{
+		"src/main.crl": "# json-utils",
+		"src/util.crl": "# util",
+		"README.md":    "json-utils",
+	})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0"}, archive)
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\njson-utils = \"^1.0.0\"\n"), 0644)
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+
+	for _, remote := range []bool{false, true} {
+		results, err := installer.Verify(manifestPath, remote)
+		if err != nil {
+			t.Fatalf("Verify(remote=%v) error = %v", remote, err)
+		}
+		if len(results) != 1 || !results[0].OK() || len(results[0].Extra) != 0 {
+			t.Errorf("Verify(remote=%v) of a fresh install = %+v", remote, results[0])
+		}
+	}
+
+	installPath := cfg.LocalPackagePath("json-utils", "1.0.0")
+	os.WriteFile(filepath.Join(installPath, "src", "main.crl"), []byte("# tampered"), 0644)
+	os.Remove(filepath.Join(installPath, "src", "util.crl"))
+	os.WriteFile(filepath.Join(installPath, "generated.crl"), []byte("# from a script"), 0644)
+
+	results, err := installer.Verify(manifestPath, false)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	r := results[0]
+	if r.OK() {
+		t.Errorf("Verify() of a modified install is OK")
+	}
+	if want := []string{"src/main.crl"}; !reflect.DeepEqual(r.Modified, want) {
+		t.Errorf("Modified = %v, want %v", r.Modified, want)
+	}
+	if want := []string{"src/util.crl"}; !reflect.DeepEqual(r.Missing, want) {
+		t.Errorf("Missing = %v, want %v", r.Missing, want)
+	}
+	if want := []string{"generated.crl"}; !reflect.DeepEqual(r.Extra, want) {
+		t.Errorf("Extra = %v, want %v", r.Extra, want)
+	}
+
+	// Reinstall, then replace the upload behind the lockfile's back
+	os.RemoveAll(installPath)
+	if _, err := installer.InstallManifest(manifestPath); err != nil {
+		t.Fatalf("InstallManifest() error = %v", err)
+	}
+	republished, err := registrytest.Archive(map[string]string{
+		"src/main.crl": "# json-utils, changed",
+		"src/util.crl": "# util",
+		"README.md":    "json-utils",
+	})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0"}, republished)
+
+	if results, err := installer.Verify(manifestPath, false); err != nil || !results[0].OK() {
+		t.Errorf("Verify() against the cache = %+v, %v, want OK", results[0], err)
+	}
+	results, err = installer.Verify(manifestPath, true)
+	if err != nil {
+		t.Fatalf("Verify(remote) error = %v", err)
+	}
+	r = results[0]
+	if !r.Republished || r.OK() || r.RegistryChecksum == r.LockedChecksum {
+		t.Errorf("Verify(remote) of a republished package = %+v", r)
+	}
+	if want := []string{"src/main.crl"}; !reflect.DeepEqual(r.Modified, want) {
+		t.Errorf("Modified = %v, want %v", r.Modified, want)
+	}
+}
+
+func TestInstaller_VerifyNotInstalled(t *testing.T) {
+	reg := newTestRegistry(t, "json-utils", []string{"1.0.0"})
+	cfg := newTestConfig(t, registrytest.URL)
+	installer := New(cfg)
+	installer.SetClient(reg.Client())
+	installer.SetOutput(io.Discard)
+
+	projectDir := filepath.Dir(cfg.ModulesDir)
+	os.MkdirAll(projectDir, 0755)
+	manifestPath := filepath.Join(projectDir, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\njson-utils = \"^1.0.0\"\n"), 0644)
+	if _, err := installer.Verify(manifestPath, false); err == nil {
+		t.Errorf("Verify() without a lockfile succeeded")
+	}
+
+	lockPath := filepath.Join(projectDir, "Bifrost.lock")
+	os.WriteFile(lockPath, []byte("version = 1\nmanifest-hash = \"sha256:0000\"\n\n[[package]]\nname = \"json-utils\"\nversion = \"1.0.0\"\n"), 0644)
+	if _, err := installer.Verify(manifestPath, false); !errors.Is(err, lockfile.ErrOutOfDate) {
+		t.Errorf("Verify() of a lockfile the manifest changed since error = %v, want ErrOutOfDate", err)
+	}
+
+	os.WriteFile(lockPath, []byte("version = 1\n\n[[package]]\nname = \"json-utils\"\nversion = \"1.0.0\"\n"), 0644)
+	results, err := installer.Verify(manifestPath, true)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if len(results) != 1 || !results[0].NotInstalled || results[0].OK() {
+		t.Errorf("Verify() of a package that is not installed = %+v", results)
+	}
+}
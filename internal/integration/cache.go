@@ -0,0 +1,135 @@
+package integration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/manifest"
+)
+
+// project is what resolving imports from a working directory depends on
+type project struct {
+	workingDir string
+	// key is the absolute working directory, which caches are kept by
+	key      string
+	manifest *manifest.Manifest
+	lock     *lockfile.Lockfile
+	// hash identifies the contents of the manifest and lockfile. Cached
+	// resolutions are only reused while it is unchanged, so installs and
+	// edits to the dependencies invalidate them.
+	hash string
+}
+
+// loadProject reads the manifest and lockfile of the project workingDir is
+// in, if any
+func (ci *CarrionIntegration) loadProject(workingDir string) *project {
+	p := &project{workingDir: workingDir, key: workingDir}
+	if abs, err := filepath.Abs(workingDir); err == nil {
+		p.key = abs
+	}
+
+	h := sha256.New()
+	if path, err := manifest.Find(workingDir); err == nil {
+		p.manifest, _ = manifest.Load(path)
+		lockPath := filepath.Join(filepath.Dir(path), lockfile.FileName)
+		// A lockfile the dependencies changed since pins versions the
+		// project no longer asks for, so imports resolve as without one
+		// until the next install
+		if p.manifest != nil {
+			p.lock, _ = lockfile.LoadCurrent(lockPath, p.manifest)
+		}
+		for _, file := range []string{path, lockPath} {
+			data, _ := os.ReadFile(file)
+			h.Write(data)
+			h.Write([]byte{0})
+		}
+	}
+	p.hash = hex.EncodeToString(h.Sum(nil))
+	return p
+}
+
+// importCache holds the imports resolved from one working directory, in
+// memory and in the registry directory between runs
+type importCache struct {
+	WorkingDir string            `json:"working_dir"`
+	Hash       string            `json:"hash"`
+	Paths      map[string]string `json:"paths"`
+
+	// dirty is set when resolutions were added since the cache was saved
+	dirty bool
+}
+
+// cachePath returns where the resolutions made from the working directory
+// key are kept between runs
+func (ci *CarrionIntegration) cachePath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(ci.config.RegistryDir, "imports", hex.EncodeToString(sum[:8])+".json")
+}
+
+// cacheFor returns the resolutions cached for p, loading them from disk the
+// first time and starting over when the project's dependencies changed.
+// ci.mu must be held.
+func (ci *CarrionIntegration) cacheFor(p *project) *importCache {
+	if c := ci.caches[p.key]; c != nil && c.Hash == p.hash {
+		return c
+	}
+
+	var c importCache
+	if data, err := os.ReadFile(ci.cachePath(p.key)); err != nil || json.Unmarshal(data, &c) != nil ||
+		c.WorkingDir != p.key || c.Hash != p.hash || c.Paths == nil {
+		c = importCache{WorkingDir: p.key, Hash: p.hash, Paths: make(map[string]string)}
+	}
+	ci.caches[p.key] = &c
+	return &c
+}
+
+// resolveCached resolves importPath from p, reusing an earlier resolution
+// while the file it found is still there. Imports that were not found are
+// looked for again every time.
+func (ci *CarrionIntegration) resolveCached(p *project, importPath string) (string, error) {
+	key := strings.TrimSuffix(importPath, ".crl")
+
+	ci.mu.Lock()
+	path, ok := ci.cacheFor(p).Paths[key]
+	ci.mu.Unlock()
+	if ok {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	path, err := ci.resolve(p, importPath)
+	if err != nil {
+		return "", err
+	}
+	ci.mu.Lock()
+	c := ci.cacheFor(p)
+	c.Paths[key] = path
+	c.dirty = true
+	ci.mu.Unlock()
+	return path, nil
+}
+
+// saveCache writes the resolutions made from p since it was last saved.
+// Caching only saves lookups, so failing to is not an error.
+func (ci *CarrionIntegration) saveCache(p *project) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	c := ci.caches[p.key]
+	if c == nil || !c.dirty {
+		return
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	path := ci.cachePath(p.key)
+	if os.MkdirAll(filepath.Dir(path), 0755) == nil && os.WriteFile(path, data, 0644) == nil {
+		c.dirty = false
+	}
+}
@@ -1,32 +1,109 @@
 package integration
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/link"
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/version"
 )
 
 // CarrionIntegration provides methods to integrate with Carrion's import system
 type CarrionIntegration struct {
 	config *config.Config
+
+	mu sync.Mutex
+	// caches hold the resolutions made from each working directory
+	caches map[string]*importCache
 }
 
 func New(cfg *config.Config) *CarrionIntegration {
 	return &CarrionIntegration{
 		config: cfg,
+		caches: make(map[string]*importCache),
+	}
+}
+
+// ImportNotFoundError is returned by ResolveImport when no search path holds
+// the import
+type ImportNotFoundError struct {
+	Import string
+	// SearchPaths are the directories searched, in order
+	SearchPaths []string
+}
+
+func (e *ImportNotFoundError) Error() string {
+	return fmt.Sprintf("import not found: %s", e.Import)
+}
+
+// Resolution is the outcome of resolving an import, in the form tools
+// shelling out to bifrost read it
+type Resolution struct {
+	Import string `json:"import"`
+	// Path is the resolved file, empty when the import was not found
+	Path  string `json:"path,omitempty"`
+	Error string `json:"error,omitempty"`
+	// SearchPaths are the directories searched when the import was not
+	// found
+	SearchPaths []string `json:"search_paths,omitempty"`
+}
+
+// Resolve resolves importPath like ResolveImport, reporting a failure in
+// the Resolution rather than as an error
+func (ci *CarrionIntegration) Resolve(importPath string, workingDir string) Resolution {
+	return ci.ResolveImports([]string{importPath}, workingDir)[0]
+}
+
+// ResolveImports resolves every import in importPaths from workingDir in
+// one pass, reading the project's manifest and lockfile once, for editors
+// and the language server resolving a whole file or project at a time
+func (ci *CarrionIntegration) ResolveImports(importPaths []string, workingDir string) []Resolution {
+	p := ci.loadProject(workingDir)
+	resolutions := make([]Resolution, len(importPaths))
+	for n, importPath := range importPaths {
+		r := Resolution{Import: importPath}
+		path, err := ci.resolveCached(p, importPath)
+		if err != nil {
+			r.Error = err.Error()
+			var notFound *ImportNotFoundError
+			if errors.As(err, &notFound) {
+				r.SearchPaths = notFound.SearchPaths
+			}
+		}
+		r.Path = path
+		resolutions[n] = r
 	}
+	ci.saveCache(p)
+	return resolutions
 }
 
 // ResolveImport resolves a Carrion import path to a file path
 func (ci *CarrionIntegration) ResolveImport(importPath string, workingDir string) (string, error) {
+	p := ci.loadProject(workingDir)
+	path, err := ci.resolveCached(p, importPath)
+	ci.saveCache(p)
+	return path, err
+}
+
+// resolve looks for importPath along the search paths of project p
+func (ci *CarrionIntegration) resolve(p *project, importPath string) (string, error) {
 	// Remove .crl extension if present
 	importPath = strings.TrimSuffix(importPath, ".crl")
 
 	// Get search paths
-	searchPaths := ci.config.GetImportPaths(workingDir)
+	searchPaths := ci.config.GetImportPaths(p.workingDir)
+	modulesDir := ci.config.ProjectModulesDir(p.workingDir)
+
+	// Aliased dependencies are installed into the project under their alias,
+	// but live under the registry package name everywhere else. Packages the
+	// project's lockfile pins resolve to exactly the locked version.
+	project, lock := p.manifest, p.lock
 
 	for _, basePath := range searchPaths {
 		// Try direct path
@@ -36,27 +113,71 @@ func (ci *CarrionIntegration) ResolveImport(importPath string, workingDir string
 		}
 
 		// For package imports (e.g., "json-utils/parser"), check in package directories
+		// A flat layout modules directory holds packages without a version
+		// directory, so the direct path above already found them
+		if basePath == modulesDir && ci.config.Layout == config.LayoutFlat {
+			continue
+		}
 		parts := strings.Split(importPath, "/")
-		if len(parts) > 1 && basePath == ci.config.PackagesDir {
-			// Look for the latest version of the package
+		// Standard library packages in the shared directory are imported
+		// from their active version
+		if len(parts) > 1 && basePath == ci.config.GetSharedGlobalPackagesDir() {
+			fullPath = filepath.Join(basePath, parts[0], config.CurrentLink, strings.Join(parts[1:], "/")+".crl")
+			if _, err := os.Stat(fullPath); err == nil {
+				return fullPath, nil
+			}
+		}
+		if len(parts) > 1 && (basePath == ci.config.PackagesDir || basePath == modulesDir) {
+			subPath := strings.Join(parts[1:], "/")
+			if locked := lockedPackage(lock, parts[0]); locked != nil {
+				packageName := locked.Name
+				if basePath != modulesDir && locked.PackageName != "" {
+					packageName = locked.PackageName
+				}
+				fullPath = filepath.Join(basePath, packageName, locked.Version, subPath+".crl")
+				if _, err := os.Stat(fullPath); err == nil {
+					return fullPath, nil
+				}
+				continue
+			}
+
 			packageName := parts[0]
+			constraint := ""
+			if project != nil && basePath != modulesDir {
+				if pkg, ok := project.Aliases[packageName]; ok {
+					packageName = pkg
+					constraint = project.Dependencies[parts[0]]
+					if constraint == "" {
+						constraint = project.DevDependencies[parts[0]]
+					}
+				}
+			}
 			packagePath := filepath.Join(basePath, packageName)
 
 			versions, err := ci.getPackageVersions(packagePath)
 			if err == nil && len(versions) > 0 {
-				// Use the latest version
-				latestVersion := versions[len(versions)-1]
-				subPath := strings.Join(parts[1:], "/")
-				fullPath = filepath.Join(packagePath, latestVersion, subPath+".crl")
+				// Use the latest version, or the latest the alias allows
+				if selected := latestVersion(versions, constraint); selected != "" {
+					fullPath = filepath.Join(packagePath, selected, subPath+".crl")
 
-				if _, err := os.Stat(fullPath); err == nil {
-					return fullPath, nil
+					if _, err := os.Stat(fullPath); err == nil {
+						return fullPath, nil
+					}
 				}
 			}
 		}
 	}
 
-	return "", fmt.Errorf("import not found: %s", importPath)
+	return "", &ImportNotFoundError{Import: importPath, SearchPaths: searchPaths}
+}
+
+// lockedPackage returns the entry lock has for name, or nil when there is no
+// lockfile or it does not lock name
+func lockedPackage(lock *lockfile.Lockfile, name string) *lockfile.Package {
+	if lock == nil {
+		return nil
+	}
+	return lock.Find(name)
 }
 
 // getPackageVersions returns sorted list of versions for a package
@@ -73,10 +194,35 @@ func (ci *CarrionIntegration) getPackageVersions(packagePath string) ([]string,
 		}
 	}
 
-	// TODO: Sort by semantic version
 	return versions, nil
 }
 
+// latestVersion returns the newest of versions satisfying constraint, or the
+// newest overall when constraint is empty. Directory names that are not
+// versions are ignored.
+func latestVersion(versions []string, constraint string) string {
+	var c version.Constraint
+	if constraint != "" {
+		var err error
+		if c, err = version.ParseConstraint(constraint); err != nil {
+			return ""
+		}
+	}
+
+	var best *version.Version
+	var bestName string
+	for _, name := range versions {
+		v, err := version.Parse(name)
+		if err != nil || (c != nil && !c.Satisfies(v)) {
+			continue
+		}
+		if best == nil || v.Compare(best) > 0 {
+			best, bestName = v, name
+		}
+	}
+	return bestName
+}
+
 // GenerateImportConfig creates a configuration file for Carrion to use
 func (ci *CarrionIntegration) GenerateImportConfig(projectDir string) error {
 	configPath := filepath.Join(projectDir, ".carrion_imports")
@@ -98,21 +244,14 @@ func (ci *CarrionIntegration) SetupEnvironment() error {
 	return os.Setenv("CARRION_IMPORT_PATH", pathString)
 }
 
-// LinkPackage creates a symlink in the local modules directory
+// LinkPackage creates a symlink in the local modules directory, or a copy
+// where symlinks are unavailable
 func (ci *CarrionIntegration) LinkPackage(packageName, version string) error {
 	source := ci.config.PackagePath(packageName, version)
 	target := filepath.Join(ci.config.LocalModulesPath(), packageName)
 
-	// Remove existing link
-	os.Remove(target)
-
-	// Create parent directory
-	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
-		return err
-	}
-
-	// Create symlink
-	return os.Symlink(source, target)
+	_, err := link.Create(source, target)
+	return err
 }
 
 // CreateModulesDirectory creates the local modules directory structure
@@ -0,0 +1,167 @@
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/manifest"
+)
+
+func TestCarrionIntegration_Resolve(t *testing.T) {
+	cfg := config.NewWithHome(t.TempDir())
+	project := t.TempDir()
+	os.MkdirAll(filepath.Join(project, "lib"), 0755)
+	os.WriteFile(filepath.Join(project, "lib", "strings.crl"), []byte("# strings"), 0644)
+	packageFile := filepath.Join(project, "carrion_modules", "json-utils", "1.2.0", "parser.crl")
+	os.MkdirAll(filepath.Dir(packageFile), 0755)
+	os.WriteFile(packageFile, []byte("# parser"), 0644)
+
+	ci := New(cfg)
+	tests := []struct {
+		importPath string
+		want       Resolution
+	}{
+		{"lib/strings", Resolution{Import: "lib/strings", Path: filepath.Join(project, "lib", "strings.crl")}},
+		{"json-utils/parser.crl", Resolution{Import: "json-utils/parser.crl", Path: packageFile}},
+		{"missing/module", Resolution{
+			Import:      "missing/module",
+			Error:       "import not found: missing/module",
+			SearchPaths: cfg.GetImportPaths(project),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.importPath, func(t *testing.T) {
+			if got := ci.Resolve(tt.importPath, project); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCarrionIntegration_ResolveImportLocked(t *testing.T) {
+	cfg := config.NewWithHome(t.TempDir())
+	project := t.TempDir()
+	os.WriteFile(filepath.Join(project, manifest.FileName), []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\njson-utils = \"^1.0.0\"\n"), 0644)
+	for _, v := range []string{"1.0.0", "1.2.0"} {
+		dir := filepath.Join(project, "carrion_modules", "json-utils", v)
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "parser.crl"), []byte("# parser "+v), 0644)
+	}
+	ci := New(cfg)
+
+	// Without a lockfile the newest installed version wins
+	got, err := ci.ResolveImport("json-utils/parser", project)
+	if want := filepath.Join(project, "carrion_modules", "json-utils", "1.2.0", "parser.crl"); err != nil || got != want {
+		t.Errorf("ResolveImport() without lockfile = %q, %v, want %q", got, err, want)
+	}
+
+	lock := lockfile.New()
+	lock.Set(lockfile.Package{Name: "json-utils", Version: "1.0.0"})
+	if err := lock.Save(filepath.Join(project, lockfile.FileName)); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	got, err = ci.ResolveImport("json-utils/parser", project)
+	if want := filepath.Join(project, "carrion_modules", "json-utils", "1.0.0", "parser.crl"); err != nil || got != want {
+		t.Errorf("ResolveImport() with lockfile = %q, %v, want %q", got, err, want)
+	}
+
+	// A locked version that is not installed is not replaced by another
+	lock.Set(lockfile.Package{Name: "json-utils", Version: "1.1.0"})
+	if err := lock.Save(filepath.Join(project, lockfile.FileName)); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if got, err := ci.ResolveImport("json-utils/parser", project); err == nil {
+		t.Errorf("ResolveImport() of a missing locked version = %q, want error", got)
+	}
+}
+
+func TestCarrionIntegration_ResolveImportsCached(t *testing.T) {
+	cfg := config.NewWithHome(t.TempDir())
+	project := t.TempDir()
+	manifestPath := filepath.Join(project, manifest.FileName)
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n"), 0644)
+	packageFile := filepath.Join(project, "carrion_modules", "json-utils", "1.2.0", "parser.crl")
+	os.MkdirAll(filepath.Dir(packageFile), 0755)
+	os.WriteFile(packageFile, []byte("# parser"), 0644)
+
+	got := New(cfg).ResolveImports([]string{"json-utils/parser", "missing/module"}, project)
+	if len(got) != 2 || got[0].Path != packageFile || got[1].Error == "" || len(got[1].SearchPaths) == 0 {
+		t.Fatalf("ResolveImports() = %+v", got)
+	}
+
+	// A file that would now shadow the package is not looked for while the
+	// cached resolution, read back from disk, still exists
+	shadow := filepath.Join(project, "json-utils", "parser.crl")
+	os.MkdirAll(filepath.Dir(shadow), 0755)
+	os.WriteFile(shadow, []byte("# shadow"), 0644)
+	if path, err := New(cfg).ResolveImport("json-utils/parser", project); err != nil || path != packageFile {
+		t.Errorf("ResolveImport() with a cached resolution = %q, %v, want %q", path, err, packageFile)
+	}
+
+	// Changing the manifest invalidates the cache
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.2.0\"\n"), 0644)
+	if path, err := New(cfg).ResolveImport("json-utils/parser", project); err != nil || path != shadow {
+		t.Errorf("ResolveImport() after a manifest change = %q, %v, want %q", path, err, shadow)
+	}
+
+	// So does removing the file a resolution found
+	ci := New(cfg)
+	os.Remove(shadow)
+	if path, err := ci.ResolveImport("json-utils/parser", project); err != nil || path != packageFile {
+		t.Errorf("ResolveImport() after removing the resolved file = %q, %v, want %q", path, err, packageFile)
+	}
+}
+
+func TestCarrionIntegration_EnvFiles(t *testing.T) {
+	cfg := config.NewWithHome(t.TempDir())
+	project := t.TempDir()
+	manifestPath := filepath.Join(project, manifest.FileName)
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\ncarrion = \">=0.1.0\"\n"), 0644)
+	ci := New(cfg)
+
+	vars := ci.Environment(project)
+	want := []EnvVar{
+		{Name: "CARRION_HOME", Value: cfg.HomeDir},
+		{Name: "CARRION_IMPORT_PATH", Value: strings.Join(cfg.GetImportPaths(project), string(os.PathListSeparator))},
+		{Name: "CARRION_VERSION_CONSTRAINT", Value: ">=0.1.0"},
+	}
+	if !reflect.DeepEqual(vars, want) {
+		t.Fatalf("Environment() = %+v, want %+v", vars, want)
+	}
+
+	if _, err := ci.WriteEnvFile(project, EnvrcFile, vars, false); err != nil {
+		t.Fatalf("WriteEnvFile() error = %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(project, EnvrcFile))
+	if !strings.Contains(string(data), "export CARRION_VERSION_CONSTRAINT='>=0.1.0'\n") {
+		t.Errorf(".envrc = %q", data)
+	}
+
+	// A hand-written .env is neither replaced nor refreshed
+	handWritten := "DATABASE_URL=postgres://localhost\n"
+	os.WriteFile(filepath.Join(project, DotenvFile), []byte(handWritten), 0644)
+	if _, err := ci.WriteEnvFile(project, DotenvFile, vars, false); err == nil {
+		t.Errorf("WriteEnvFile() replaced a hand-written .env")
+	}
+
+	os.WriteFile(manifestPath, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\ncarrion = \">=0.2.0\"\n"), 0644)
+	refreshed, err := ci.RefreshEnvFiles(project)
+	if err != nil {
+		t.Fatalf("RefreshEnvFiles() error = %v", err)
+	}
+	if want := []string{filepath.Join(project, EnvrcFile)}; !reflect.DeepEqual(refreshed, want) {
+		t.Errorf("RefreshEnvFiles() = %v, want %v", refreshed, want)
+	}
+	data, _ = os.ReadFile(filepath.Join(project, EnvrcFile))
+	if !strings.Contains(string(data), "export CARRION_VERSION_CONSTRAINT='>=0.2.0'\n") {
+		t.Errorf("refreshed .envrc = %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(project, DotenvFile)); string(data) != handWritten {
+		t.Errorf("RefreshEnvFiles() changed a hand-written .env to %q", data)
+	}
+}
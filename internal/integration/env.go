@@ -0,0 +1,117 @@
+package integration
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/manifest"
+)
+
+const (
+	// DotenvFile holds the project environment as KEY="value" lines
+	DotenvFile = ".env"
+	// EnvrcFile holds the project environment as export lines for direnv
+	EnvrcFile = ".envrc"
+)
+
+// envHeader starts every environment file bifrost writes. Only files
+// starting with it are refreshed by installs, so hand-written ones are
+// never touched.
+const envHeader = "# Generated by 'bifrost env'; 'bifrost install' keeps it up to date."
+
+// EnvVar is an environment variable a project runs with
+type EnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Environment returns the variables running the project rooted at
+// projectDir needs: the Carrion home, the import search path and, when the
+// manifest constrains it, the Carrion version the project runs on
+func (ci *CarrionIntegration) Environment(projectDir string) []EnvVar {
+	vars := []EnvVar{
+		{Name: "CARRION_HOME", Value: ci.config.HomeDir},
+		{Name: "CARRION_IMPORT_PATH", Value: strings.Join(ci.config.GetImportPaths(projectDir), string(os.PathListSeparator))},
+	}
+	if m, err := manifest.Load(filepath.Join(projectDir, manifest.FileName)); err == nil && m.Package.Carrion != "" {
+		vars = append(vars, EnvVar{Name: "CARRION_VERSION_CONSTRAINT", Value: m.Package.Carrion})
+	}
+	return vars
+}
+
+// WriteEnvFile writes vars to the environment file name in projectDir, as
+// export lines for an EnvrcFile and KEY="value" lines otherwise. An existing
+// file bifrost did not generate is only replaced when force is set.
+func (ci *CarrionIntegration) WriteEnvFile(projectDir, name string, vars []EnvVar, force bool) (string, error) {
+	path := filepath.Join(projectDir, name)
+	if !force {
+		if generated, err := isGeneratedEnvFile(path); err == nil && !generated {
+			return "", fmt.Errorf("%s exists and was not generated by bifrost; pass --force to replace it", path)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(envHeader + "\n")
+	for _, v := range vars {
+		if name == EnvrcFile {
+			fmt.Fprintf(&b, "export %s=%s\n", v.Name, ShellQuote(v.Value))
+		} else {
+			fmt.Fprintf(&b, "%s=%s\n", v.Name, dotenvQuote(v.Value))
+		}
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// RefreshEnvFiles rewrites the environment files bifrost generated in
+// projectDir with the project's current environment, returning their paths
+func (ci *CarrionIntegration) RefreshEnvFiles(projectDir string) ([]string, error) {
+	var refreshed []string
+	for _, name := range []string{DotenvFile, EnvrcFile} {
+		path := filepath.Join(projectDir, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if generated, err := isGeneratedEnvFile(path); err != nil || !generated {
+			continue
+		}
+		path, err := ci.WriteEnvFile(projectDir, name, ci.Environment(projectDir), false)
+		if err != nil {
+			return refreshed, err
+		}
+		refreshed = append(refreshed, path)
+	}
+	return refreshed, nil
+}
+
+// isGeneratedEnvFile reports whether the file at path starts with
+// envHeader. A missing file counts as generated, since writing it replaces
+// nothing.
+func isGeneratedEnvFile(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	return strings.TrimRight(line, "\r\n") == envHeader, nil
+}
+
+// ShellQuote quotes s for POSIX shells
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// dotenvQuote quotes s as a double-quoted .env value
+func dotenvQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,294 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Op is the kind of operation a transaction performs
+type Op string
+
+const (
+	// OpInstall creates package directories. Recovering an interrupted
+	// install removes them, undoing the partial install.
+	OpInstall Op = "install"
+	// OpUninstall deletes package directories. Recovering an interrupted
+	// uninstall removes what is left, completing it.
+	OpUninstall Op = "uninstall"
+)
+
+type state string
+
+const (
+	stateBegin  state = "begin"
+	stateCommit state = "commit"
+)
+
+// Entry is a single line of the journal
+type Entry struct {
+	ID    string    `json:"id"`
+	State state     `json:"state"`
+	Op    Op        `json:"op,omitempty"`
+	Paths []string  `json:"paths,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// Journal is an append-only log of install and uninstall operations. Each
+// operation is recorded before it touches the filesystem and marked done
+// once it has finished, so operations cut short by a crash can be found and
+// cleaned up afterwards.
+type Journal struct {
+	path string
+}
+
+// Txn is an operation recorded in the journal
+type Txn struct {
+	journal *Journal
+	id      string
+	// lock is the lock file held while the operation runs
+	lock *os.File
+}
+
+var sequence atomic.Uint64
+
+// open holds the IDs of the transactions this process has begun and not
+// committed yet, and openMu guards it
+var (
+	open   = make(map[string]bool)
+	openMu sync.Mutex
+)
+
+// Open returns the journal stored at path. The file is created on the first
+// write.
+func Open(path string) *Journal {
+	return &Journal{path: path}
+}
+
+// Begin records that op is about to modify paths, which are package version
+// directories. Relative paths are made absolute so the entry can be
+// recovered from any directory.
+func (j *Journal) Begin(op Op, paths ...string) (*Txn, error) {
+	abs := make([]string, len(paths))
+	for n, p := range paths {
+		a, err := filepath.Abs(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", p, err)
+		}
+		abs[n] = a
+	}
+
+	id := strconv.Itoa(os.Getpid()) + "-" + strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(sequence.Add(1), 10)
+	// The lock is taken before the entry is written, so that no other
+	// process sees the operation without its lock held
+	lock, err := j.lock(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := j.append(Entry{ID: id, State: stateBegin, Op: op, Paths: abs, Time: time.Now().UTC()}); err != nil {
+		lock.Close()
+		os.Remove(lock.Name())
+		return nil, err
+	}
+	openMu.Lock()
+	open[id] = true
+	openMu.Unlock()
+	return &Txn{journal: j, id: id, lock: lock}, nil
+}
+
+// Commit records that the operation finished
+func (t *Txn) Commit() error {
+	openMu.Lock()
+	delete(open, t.id)
+	openMu.Unlock()
+	err := t.journal.append(Entry{ID: t.id, State: stateCommit, Time: time.Now().UTC()})
+	if t.lock != nil {
+		t.lock.Close()
+		os.Remove(t.lock.Name())
+	}
+	return err
+}
+
+// lockPath returns the path of the lock file of the operation called id
+func (j *Journal) lockPath(id string) string {
+	return filepath.Join(filepath.Dir(j.path), "journal.locks", id+".lock")
+}
+
+// lock creates the lock file of the operation called id and locks it. The
+// lock is held until the file is closed, or the process exits.
+func (j *Journal) lock(id string) (*os.File, error) {
+	path := j.lockPath(id)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create journal lock directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal lock: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to lock journal lock: %w", err)
+	}
+	return f, nil
+}
+
+// running reports whether the operation e is still going on, begun by this
+// process and not committed yet or begun by another process that still
+// holds its lock file. Installs of other projects share the journal, and
+// their operations must not be cleaned up under them. The lock goes away
+// with the process holding it, however it ends.
+func (j *Journal) running(e Entry) bool {
+	openMu.Lock()
+	ours := open[e.ID]
+	openMu.Unlock()
+	if ours {
+		return true
+	}
+	f, err := os.OpenFile(j.lockPath(e.ID), os.O_RDWR, 0)
+	if err != nil {
+		// Without a lock file the operation is gone; a lock file that
+		// cannot be opened is taken to be held
+		return !errors.Is(err, os.ErrNotExist)
+	}
+	defer f.Close()
+	return locked(f)
+}
+
+func (j *Journal) append(e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	return nil
+}
+
+// Pending returns operations that were begun but never committed, oldest
+// first. A torn final line left by a crash mid-write is ignored.
+func (j *Journal) Pending() ([]Entry, error) {
+	f, err := os.Open(j.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer f.Close()
+
+	var order []string
+	begun := make(map[string]Entry)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		switch e.State {
+		case stateBegin:
+			order = append(order, e.ID)
+			begun[e.ID] = e
+		case stateCommit:
+			delete(begun, e.ID)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	var pending []Entry
+	for _, id := range order {
+		if e, ok := begun[id]; ok {
+			pending = append(pending, e)
+		}
+	}
+	return pending, nil
+}
+
+// Interrupted returns the pending operations that are no longer running,
+// oldest first
+func (j *Journal) Interrupted() ([]Entry, error) {
+	pending, err := j.Pending()
+	if err != nil {
+		return nil, err
+	}
+	var interrupted []Entry
+	for _, e := range pending {
+		if !j.running(e) {
+			interrupted = append(interrupted, e)
+		}
+	}
+	return interrupted, nil
+}
+
+// Recover cleans up every pending operation that is no longer running by
+// removing the paths it recorded, which undoes an interrupted install and
+// completes an interrupted uninstall. Once nothing is pending the journal is
+// truncated. The recovered entries are returned.
+func (j *Journal) Recover() ([]Entry, error) {
+	pending, err := j.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	var interrupted, live []Entry
+	for _, e := range pending {
+		if j.running(e) {
+			live = append(live, e)
+		} else {
+			interrupted = append(interrupted, e)
+		}
+	}
+
+	for _, e := range interrupted {
+		for _, p := range e.Paths {
+			if err := os.RemoveAll(p); err != nil {
+				return nil, fmt.Errorf("failed to recover %s operation %s: %w", e.Op, e.ID, err)
+			}
+			// Drop the package directory once its last version is gone
+			parent := filepath.Dir(p)
+			if entries, err := os.ReadDir(parent); err == nil && len(entries) == 0 {
+				os.Remove(parent)
+			}
+		}
+		os.Remove(j.lockPath(e.ID))
+	}
+
+	// Operations still running keep the journal; the recovered ones are
+	// marked done instead
+	if len(live) > 0 {
+		for _, e := range interrupted {
+			if err := (&Txn{journal: j, id: e.ID}).Commit(); err != nil {
+				return nil, err
+			}
+		}
+		return interrupted, nil
+	}
+	if err := os.Truncate(j.path, 0); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to truncate journal: %w", err)
+	}
+	return interrupted, nil
+}
@@ -0,0 +1,162 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestJournal_Pending(t *testing.T) {
+	dir := t.TempDir()
+	j := Open(filepath.Join(dir, "journal.log"))
+
+	pending, err := j.Pending()
+	if err != nil || len(pending) != 0 {
+		t.Fatalf("Pending() on a missing journal = %v, %v, want none", pending, err)
+	}
+
+	done, err := j.Begin(OpInstall, filepath.Join(dir, "done"))
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	if _, err := j.Begin(OpUninstall, filepath.Join(dir, "interrupted")); err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	if err := done.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	// A crash mid-write leaves a torn final line
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"torn","state":"beg`)
+	f.Close()
+
+	pending, err = j.Pending()
+	if err != nil {
+		t.Fatalf("Pending() error = %v", err)
+	}
+	if len(pending) != 1 {
+		t.Fatalf("Pending() = %+v, want one entry", pending)
+	}
+	if pending[0].Op != OpUninstall || pending[0].Paths[0] != filepath.Join(dir, "interrupted") {
+		t.Errorf("Pending()[0] = %+v, want the interrupted uninstall", pending[0])
+	}
+}
+
+// crash makes txn look begun by a process that exited before committing it
+func crash(txn *Txn) {
+	openMu.Lock()
+	delete(open, txn.id)
+	openMu.Unlock()
+	// The process going away releases its lock, leaving the lock file
+	txn.lock.Close()
+}
+
+func TestJournal_Recover(t *testing.T) {
+	dir := t.TempDir()
+	j := Open(filepath.Join(dir, "journal.log"))
+
+	partial := filepath.Join(dir, "modules", "json-utils", "1.0.0")
+	kept := filepath.Join(dir, "modules", "http-client", "2.0.0")
+	for _, p := range []string{partial, kept} {
+		if err := os.MkdirAll(p, 0755); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(p, "main.crl"), []byte("grim Main:"), 0644)
+	}
+
+	interrupted, err := j.Begin(OpInstall, partial)
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	crash(interrupted)
+	txn, err := j.Begin(OpInstall, kept)
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	txn.Commit()
+
+	recovered, err := j.Recover()
+	if err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+	if len(recovered) != 1 || recovered[0].Paths[0] != partial {
+		t.Errorf("Recover() = %+v, want the partial install", recovered)
+	}
+
+	if _, err := os.Stat(filepath.Dir(partial)); !os.IsNotExist(err) {
+		t.Error("partial install and its empty package directory were not removed")
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("committed install was removed: %v", err)
+	}
+
+	if pending, err := j.Pending(); err != nil || len(pending) != 0 {
+		t.Errorf("Pending() after Recover() = %v, %v, want none", pending, err)
+	}
+	if info, err := os.Stat(j.path); err != nil || info.Size() != 0 {
+		t.Errorf("journal not truncated: %v", err)
+	}
+}
+
+func TestJournal_RecoverLeavesRunningOperations(t *testing.T) {
+	dir := t.TempDir()
+	j := Open(filepath.Join(dir, "journal.log"))
+
+	partial := filepath.Join(dir, "modules", "json-utils", "1.0.0")
+	ours := filepath.Join(dir, "modules", "http-client", "2.0.0")
+	theirs := filepath.Join(dir, "other", "carrion_modules", "json-utils", "1.0.0")
+	for _, p := range []string{partial, ours, theirs} {
+		if err := os.MkdirAll(p, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	interrupted, err := j.Begin(OpInstall, partial)
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	crash(interrupted)
+	running, err := j.Begin(OpInstall, ours)
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	// An install of another project by a process that is still running,
+	// holding its lock through a file of its own
+	other := Entry{ID: strconv.Itoa(os.Getppid()) + "-x-1", State: stateBegin, Op: OpInstall, Paths: []string{theirs}}
+	lock, err := j.lock(other.ID)
+	if err != nil {
+		t.Fatalf("lock() error = %v", err)
+	}
+	defer lock.Close()
+	if err := j.append(other); err != nil {
+		t.Fatal(err)
+	}
+
+	recovered, err := j.Recover()
+	if err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+	if len(recovered) != 1 || recovered[0].Paths[0] != partial {
+		t.Errorf("Recover() = %+v, want only the interrupted install", recovered)
+	}
+	if _, err := os.Stat(j.lockPath(interrupted.id)); !os.IsNotExist(err) {
+		t.Errorf("lock file of the interrupted install left behind: %v", err)
+	}
+	for _, p := range []string{ours, theirs} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("running install of %s was removed: %v", p, err)
+		}
+	}
+
+	// The recovered operation is done; the running ones stay pending
+	running.Commit()
+	pending, err := j.Pending()
+	if err != nil || len(pending) != 1 || pending[0].ID != other.ID {
+		t.Errorf("Pending() after Recover() = %+v, %v, want the other process's install", pending, err)
+	}
+}
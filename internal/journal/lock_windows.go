@@ -0,0 +1,23 @@
+package journal
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile takes an exclusive lock on f without waiting for it
+func lockFile(f *os.File) error {
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, new(windows.Overlapped))
+}
+
+// locked reports whether another open file holds the lock on f
+func locked(f *os.File) bool {
+	err := lockFile(f)
+	if err == nil {
+		windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, new(windows.Overlapped))
+		return false
+	}
+	return errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+}
@@ -0,0 +1,146 @@
+// Package licenses gathers the license declarations and license texts of a
+// project's installed dependencies, for redistribution compliance
+package licenses
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/manifest"
+	"github.com/javanhut/bifrost/internal/metadata"
+)
+
+// DefaultBundleDir is the directory license texts are collected into
+const DefaultBundleDir = "third_party_licenses"
+
+// filePrefixes are the names of license and attribution files, matched
+// case-insensitively with any extension
+var filePrefixes = []string{"LICENSE", "LICENCE", "COPYING", "NOTICE"}
+
+// Package is the license information of one installed dependency
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// License is the license declared in the package's Bifrost.toml
+	License string `json:"license,omitempty"`
+	// Files are the license and notice files at the root of the package
+	Files []string `json:"files,omitempty"`
+}
+
+// Collect returns the license information of the installed dependencies of
+// the project whose manifest is at manifestPath, ordered by name.
+// Dependencies that are not installed are returned in missing.
+func Collect(cfg *config.Config, manifestPath string) (pkgs []Package, missing []string, err error) {
+	md, err := metadata.Collect(cfg, manifestPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, dep := range md.Dependencies {
+		if !dep.Installed {
+			missing = append(missing, dep.Name)
+			continue
+		}
+		pkg := Package{Name: dep.Name, Version: dep.Version}
+		if m, err := manifest.Load(filepath.Join(dep.Path, manifest.FileName)); err == nil {
+			pkg.License = m.Package.License
+		}
+		pkg.Files, err = licenseFiles(dep.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", dep.Path, err)
+		}
+		pkgs = append(pkgs, pkg)
+	}
+
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Name < pkgs[j].Name })
+	return pkgs, missing, nil
+}
+
+// licenseFiles returns the paths of the license and notice files in dir
+func licenseFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || !isLicenseFile(entry.Name()) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+	return files, nil
+}
+
+// isLicenseFile reports whether name is a license or notice file name, such
+// as LICENSE, LICENSE.md or NOTICE.txt
+func isLicenseFile(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, prefix := range filePrefixes {
+		if upper == prefix || strings.HasPrefix(upper, prefix+".") || strings.HasPrefix(upper, prefix+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// Bundle copies the license files of pkgs into dir, one name-version
+// subdirectory per package, and returns the number of files copied
+func Bundle(pkgs []Package, dir string) (int, error) {
+	copied := 0
+	for _, pkg := range pkgs {
+		if len(pkg.Files) == 0 {
+			continue
+		}
+		pkgDir := filepath.Join(dir, fmt.Sprintf("%s-%s", pkg.Name, pkg.Version))
+		if err := os.MkdirAll(pkgDir, 0755); err != nil {
+			return copied, fmt.Errorf("failed to create %s: %w", pkgDir, err)
+		}
+		for _, file := range pkg.Files {
+			if err := copyFile(file, filepath.Join(pkgDir, filepath.Base(file))); err != nil {
+				return copied, fmt.Errorf("failed to copy %s: %w", file, err)
+			}
+			copied++
+		}
+	}
+	return copied, nil
+}
+
+// Concatenate writes the license files of pkgs to w as a single document,
+// each under a header naming its package
+func Concatenate(pkgs []Package, w io.Writer) error {
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", file, err)
+			}
+			header := fmt.Sprintf("%s@%s: %s", pkg.Name, pkg.Version, filepath.Base(file))
+			if pkg.License != "" {
+				header += fmt.Sprintf(" (%s)", pkg.License)
+			}
+			if _, err := fmt.Fprintf(w, "%s\n%s\n\n%s", header, strings.Repeat("=", len(header)), data); err != nil {
+				return err
+			}
+			if !strings.HasSuffix(string(data), "\n") {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
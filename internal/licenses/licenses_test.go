@@ -0,0 +1,135 @@
+package licenses
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/config"
+)
+
+func newTestProject(t *testing.T) (*config.Config, string) {
+	t.Helper()
+
+	cfg := config.NewWithHome(t.TempDir())
+	root := t.TempDir()
+	cfg.ModulesDir = filepath.Join(root, "carrion_modules")
+
+	manifest := `[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+json-utils = "1.0.0"
+http-client = "2.0.0"
+missing-lib = "1.0.0"
+`
+	os.WriteFile(filepath.Join(root, "Bifrost.toml"), []byte(manifest), 0644)
+
+	packages := []struct {
+		name, version, license string
+		files                  map[string]string
+	}{
+		{"json-utils", "1.0.0", "MIT", map[string]string{"LICENSE": "MIT License\n", "NOTICE.txt": "Copyright json-utils"}},
+		{"http-client", "2.0.0", "", map[string]string{"README.md": "# http-client\n"}},
+	}
+	for _, pkg := range packages {
+		dir := cfg.LocalPackagePath(pkg.name, pkg.version)
+		os.MkdirAll(dir, 0755)
+		toml := "[package]\nname = \"" + pkg.name + "\"\nversion = \"" + pkg.version + "\"\nlicense = \"" + pkg.license + "\"\n"
+		os.WriteFile(filepath.Join(dir, "Bifrost.toml"), []byte(toml), 0644)
+		for name, content := range pkg.files {
+			os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		}
+	}
+	return cfg, filepath.Join(root, "Bifrost.toml")
+}
+
+func TestCollect(t *testing.T) {
+	cfg, manifestPath := newTestProject(t)
+
+	pkgs, missing, err := Collect(cfg, manifestPath)
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if len(missing) != 1 || missing[0] != "missing-lib" {
+		t.Errorf("missing = %v, want [missing-lib]", missing)
+	}
+	if len(pkgs) != 2 || pkgs[0].Name != "http-client" || pkgs[1].Name != "json-utils" {
+		t.Fatalf("Collect() = %+v, want http-client and json-utils", pkgs)
+	}
+	if pkgs[0].License != "" || len(pkgs[0].Files) != 0 {
+		t.Errorf("http-client = %+v, want no license", pkgs[0])
+	}
+	if pkgs[1].License != "MIT" || len(pkgs[1].Files) != 2 {
+		t.Errorf("json-utils = %+v, want MIT with two files", pkgs[1])
+	}
+}
+
+func TestBundle(t *testing.T) {
+	cfg, manifestPath := newTestProject(t)
+	pkgs, _, err := Collect(cfg, manifestPath)
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	dir := filepath.Join(t.TempDir(), DefaultBundleDir)
+	copied, err := Bundle(pkgs, dir)
+	if err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+	if copied != 2 {
+		t.Errorf("Bundle() copied %d files, want 2", copied)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "json-utils-1.0.0", "LICENSE"))
+	if err != nil || string(data) != "MIT License\n" {
+		t.Errorf("bundled LICENSE = %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "http-client-2.0.0")); !os.IsNotExist(err) {
+		t.Errorf("directory created for a package without license files: %v", err)
+	}
+}
+
+func TestConcatenate(t *testing.T) {
+	cfg, manifestPath := newTestProject(t)
+	pkgs, _, err := Collect(cfg, manifestPath)
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Concatenate(pkgs, &buf); err != nil {
+		t.Fatalf("Concatenate() error = %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"json-utils@1.0.0: LICENSE (MIT)", "MIT License", "json-utils@1.0.0: NOTICE.txt (MIT)", "Copyright json-utils"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Concatenate() output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestIsLicenseFile(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"LICENSE", true},
+		{"license.md", true},
+		{"LICENCE.txt", true},
+		{"COPYING", true},
+		{"NOTICE", true},
+		{"LICENSE-APACHE", true},
+		{"README.md", false},
+		{"licenses.crl", false},
+		{"Bifrost.toml", false},
+	}
+
+	for _, tt := range tests {
+		if got := isLicenseFile(tt.name); got != tt.want {
+			t.Errorf("isLicenseFile(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
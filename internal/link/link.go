@@ -0,0 +1,222 @@
+// Package link puts a package directory in place at another path: as a
+// symlink where the filesystem allows one, otherwise as a copy. Copies carry
+// a marker file naming the original, so they can be told apart from
+// installed packages and refreshed when the original changes.
+package link
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// MarkerFile is written at the root of a copy made in place of a symlink
+const MarkerFile = ".bifrost-copy"
+
+// marker is the content of MarkerFile
+type marker struct {
+	Source string `json:"source"`
+	// Fingerprint summarizes the source when it was copied
+	Fingerprint string `json:"fingerprint"`
+}
+
+// symlink creates symlinks, replaced in tests to simulate filesystems
+// without them
+var symlink = os.Symlink
+
+var (
+	mu sync.Mutex
+	// unsupported holds the directories where a symlink could not be
+	// created, so later links there are copied straight away
+	unsupported = make(map[string]bool)
+)
+
+// Create makes target refer to the directory source, replacing whatever is
+// at target, and reports whether it had to copy source because a symlink
+// could not be created there
+func Create(source, target string) (bool, error) {
+	if err := os.RemoveAll(target); err != nil {
+		return false, err
+	}
+	parent := filepath.Dir(target)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return false, err
+	}
+
+	mu.Lock()
+	skip := unsupported[parent]
+	mu.Unlock()
+	if !skip {
+		if err := symlink(source, target); err == nil {
+			return false, nil
+		}
+		mu.Lock()
+		unsupported[parent] = true
+		mu.Unlock()
+	}
+
+	if err := copyTree(source, target); err != nil {
+		os.RemoveAll(target)
+		return false, fmt.Errorf("failed to copy %s: %w", source, err)
+	}
+	return true, nil
+}
+
+// IsSymlink reports whether path is a symlink
+func IsSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&fs.ModeSymlink != 0
+}
+
+// IsCopy reports whether path is a copy made by Create
+func IsCopy(path string) bool {
+	_, err := readMarker(path)
+	return err == nil
+}
+
+// Source returns the directory the symlink or copy at path refers to, or ""
+// when path is neither
+func Source(path string) string {
+	if IsSymlink(path) {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return ""
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		return target
+	}
+	if m, err := readMarker(path); err == nil {
+		return m.Source
+	}
+	return ""
+}
+
+// Remove deletes the symlink or copy at path, and reports whether there was
+// one. Anything else at path is left alone.
+func Remove(path string) (bool, error) {
+	switch {
+	case IsSymlink(path):
+		return true, os.Remove(path)
+	case IsCopy(path):
+		return true, os.RemoveAll(path)
+	}
+	return false, nil
+}
+
+// Refresh copies the source of the copy at path again if it changed since
+// it was copied, and reports whether it did. Symlinks, directories that are
+// not copies and copies whose source is gone are left as they are.
+func Refresh(path string) (bool, error) {
+	m, err := readMarker(path)
+	if err != nil {
+		return false, nil
+	}
+	fingerprint, err := fingerprintOf(m.Source)
+	if err != nil || fingerprint == m.Fingerprint {
+		return false, nil
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return false, err
+	}
+	if err := copyTree(m.Source, path); err != nil {
+		return false, fmt.Errorf("failed to copy %s: %w", m.Source, err)
+	}
+	return true, nil
+}
+
+func readMarker(path string) (*marker, error) {
+	data, err := os.ReadFile(filepath.Join(path, MarkerFile))
+	if err != nil {
+		return nil, err
+	}
+	var m marker
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// copyTree copies the directory source to target and marks it as a copy
+func copyTree(source, target string) error {
+	fingerprint, err := fingerprintOf(source)
+	if err != nil {
+		return err
+	}
+	err = filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(target, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(dst, info.Mode().Perm()|0700)
+		}
+		return copyFile(path, dst, info.Mode().Perm())
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(marker{Source: source, Fingerprint: fingerprint})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(target, MarkerFile), data, 0644)
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// fingerprintOf summarizes the files below dir by their number, total size
+// and latest modification, which changes whenever the directory is
+// reinstalled or edited
+func fingerprintOf(dir string) (string, error) {
+	var files, size, latest int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files++
+			size += info.Size()
+		}
+		latest = max(latest, info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d:%d", files, size, latest), nil
+}
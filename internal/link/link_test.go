@@ -0,0 +1,154 @@
+package link
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeSource(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+// withoutSymlinks makes symlinks fail for the rest of the test and counts
+// the attempts
+func withoutSymlinks(t *testing.T) *int {
+	t.Helper()
+	attempts := 0
+	symlink = func(oldname, newname string) error {
+		attempts++
+		return errors.New("operation not permitted")
+	}
+	t.Cleanup(func() {
+		symlink = os.Symlink
+		mu.Lock()
+		unsupported = make(map[string]bool)
+		mu.Unlock()
+	})
+	return &attempts
+}
+
+func TestCreate(t *testing.T) {
+	source := writeSource(t, map[string]string{"src/main.crl": "main"})
+	target := filepath.Join(t.TempDir(), "carrion_modules", "utils")
+
+	copied, err := Create(source, target)
+	if err != nil || copied {
+		t.Fatalf("Create() = %v, %v, want a symlink", copied, err)
+	}
+	if !IsSymlink(target) || IsCopy(target) {
+		t.Errorf("target is not a plain symlink")
+	}
+	if removed, err := Remove(target); !removed || err != nil {
+		t.Errorf("Remove() = %v, %v", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(source, "src", "main.crl")); err != nil {
+		t.Errorf("Remove() of a symlink touched its source: %v", err)
+	}
+}
+
+func TestCreate_FallsBackToCopy(t *testing.T) {
+	attempts := withoutSymlinks(t)
+	source := writeSource(t, map[string]string{"src/main.crl": "main"})
+	modules := filepath.Join(t.TempDir(), "carrion_modules")
+
+	copied, err := Create(source, filepath.Join(modules, "utils"))
+	if err != nil || !copied {
+		t.Fatalf("Create() = %v, %v, want a copy", copied, err)
+	}
+	data, err := os.ReadFile(filepath.Join(modules, "utils", "src", "main.crl"))
+	if err != nil || string(data) != "main" {
+		t.Errorf("copied file = %q, %v", data, err)
+	}
+	if !IsCopy(filepath.Join(modules, "utils")) || IsSymlink(filepath.Join(modules, "utils")) {
+		t.Errorf("target is not marked as a copy")
+	}
+
+	// Later links into the same directory do not try symlinks again
+	if _, err := Create(source, filepath.Join(modules, "other")); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if *attempts != 1 {
+		t.Errorf("symlink attempts = %d, want 1", *attempts)
+	}
+
+	if removed, err := Remove(filepath.Join(modules, "utils")); !removed || err != nil {
+		t.Errorf("Remove() = %v, %v", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(modules, "utils")); !os.IsNotExist(err) {
+		t.Errorf("copy still exists after Remove(): %v", err)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	withoutSymlinks(t)
+	source := writeSource(t, map[string]string{"src/main.crl": "v1"})
+	target := filepath.Join(t.TempDir(), "utils")
+	if _, err := Create(source, target); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if refreshed, err := Refresh(target); refreshed || err != nil {
+		t.Errorf("Refresh() of an unchanged copy = %v, %v", refreshed, err)
+	}
+
+	later := time.Now().Add(time.Minute)
+	path := filepath.Join(source, "src", "main.crl")
+	if err := os.WriteFile(path, []byte("v2"), 0644); err != nil {
+		t.Fatalf("failed to update source: %v", err)
+	}
+	os.Chtimes(path, later, later)
+	if refreshed, err := Refresh(target); !refreshed || err != nil {
+		t.Fatalf("Refresh() of a stale copy = %v, %v", refreshed, err)
+	}
+	data, _ := os.ReadFile(filepath.Join(target, "src", "main.crl"))
+	if string(data) != "v2" {
+		t.Errorf("refreshed file = %q, want v2", data)
+	}
+}
+
+func TestRemove_LeavesOtherDirectories(t *testing.T) {
+	dir := writeSource(t, map[string]string{"src/main.crl": "main"})
+	if removed, err := Remove(dir); removed || err != nil {
+		t.Errorf("Remove() of an installed package = %v, %v", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "src", "main.crl")); err != nil {
+		t.Errorf("Remove() deleted an installed package: %v", err)
+	}
+}
+
+func TestSource(t *testing.T) {
+	source := writeSource(t, map[string]string{"src/main.crl": "main"})
+	dir := t.TempDir()
+
+	if _, err := Create(source, filepath.Join(dir, "linked")); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if got := Source(filepath.Join(dir, "linked")); got != source {
+		t.Errorf("Source() of a symlink = %q, want %q", got, source)
+	}
+	if got := Source(source); got != "" {
+		t.Errorf("Source() of a plain directory = %q, want none", got)
+	}
+
+	withoutSymlinks(t)
+	if _, err := Create(source, filepath.Join(dir, "copied")); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if got := Source(filepath.Join(dir, "copied")); got != source {
+		t.Errorf("Source() of a copy = %q, want %q", got, source)
+	}
+}
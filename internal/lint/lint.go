@@ -0,0 +1,158 @@
+// Package lint checks a package for common mistakes before it is
+// published: missing license, readme or metadata, a main file that is not
+// packed, tests packed by accident and overly large files
+package lint
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/archive"
+	"github.com/javanhut/bifrost/internal/manifest"
+)
+
+// Rule names a check. Rules listed under allow in the manifest's [lint]
+// table are skipped.
+type Rule string
+
+const (
+	// MissingLicense reports a package without a LICENSE, LICENCE or
+	// COPYING file at its root
+	MissingLicense Rule = "missing-license"
+	// MissingReadme reports a package without a README at its root
+	MissingReadme Rule = "missing-readme"
+	// MissingDescription reports a manifest without package.description
+	MissingDescription Rule = "missing-description"
+	// MissingKeywords reports a manifest without package.keywords
+	MissingKeywords Rule = "missing-keywords"
+	// MissingMain reports a package.metadata.main file that is not packed
+	MissingMain Rule = "missing-main"
+	// TestsIncluded reports test directories and files that are packed
+	TestsIncluded Rule = "tests-included"
+	// LargeFile reports packed files over the size limit
+	LargeFile Rule = "large-file"
+)
+
+// Rules are all the rules, in the order findings are reported
+var Rules = []Rule{MissingLicense, MissingReadme, MissingDescription, MissingKeywords, MissingMain, TestsIncluded, LargeFile}
+
+// DefaultMaxFileSize is the size over which a packed file is reported
+const DefaultMaxFileSize = 1 << 20
+
+// testDirs are directory names that only hold tests
+var testDirs = []string{"appraise", "test", "tests"}
+
+// Finding is a problem found in a package
+type Finding struct {
+	Rule Rule `json:"rule"`
+	// Path is the packed file the finding is about, if any
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s", f.Rule, f.Message)
+}
+
+// Check lints the package described by m whose archive would hold files,
+// as returned by archive.Files. Files over maxFileSize bytes are reported;
+// zero means DefaultMaxFileSize. Rules the manifest allows are skipped, and
+// an unknown rule there is an error.
+func Check(m *manifest.Manifest, files []archive.File, maxFileSize int64) ([]Finding, error) {
+	if maxFileSize <= 0 {
+		maxFileSize = DefaultMaxFileSize
+	}
+	allowed := make(map[Rule]bool)
+	if m.Lint != nil {
+		for _, name := range m.Lint.Allow {
+			if !slices.Contains(Rules, Rule(name)) {
+				return nil, fmt.Errorf("lint.allow: unknown rule %q", name)
+			}
+			allowed[Rule(name)] = true
+		}
+	}
+
+	var findings []Finding
+	report := func(rule Rule, path, format string, args ...any) {
+		if !allowed[rule] {
+			findings = append(findings, Finding{Rule: rule, Path: path, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	if !slices.ContainsFunc(files, func(f archive.File) bool { return isRootFile(f.Path, "LICENSE", "LICENCE", "COPYING") }) {
+		report(MissingLicense, "", "no LICENSE file at the package root")
+	}
+	if !slices.ContainsFunc(files, func(f archive.File) bool { return isRootFile(f.Path, "README") }) {
+		report(MissingReadme, "", "no README at the package root")
+	}
+	if strings.TrimSpace(m.Package.Description) == "" {
+		report(MissingDescription, "", "package.description is empty")
+	}
+	if len(m.Package.Keywords) == 0 {
+		report(MissingKeywords, "", "package.keywords is empty")
+	}
+	if main := m.Package.Metadata.Main; main != "" {
+		main = path.Clean(strings.TrimPrefix(main, "./"))
+		if !slices.ContainsFunc(files, func(f archive.File) bool { return f.Path == main }) {
+			report(MissingMain, main, "main file %s is not in the package", main)
+		}
+	}
+
+	reportedDirs := make(map[string]bool)
+	for _, f := range files {
+		if dir := testDir(f.Path); dir != "" {
+			if !reportedDirs[dir] {
+				reportedDirs[dir] = true
+				report(TestsIncluded, dir+"/", "test directory %s/ is packed; exclude it in %s", dir, archive.IgnoreFileName)
+			}
+		} else if isTestFile(f.Path) {
+			report(TestsIncluded, f.Path, "test file %s is packed; exclude it in %s", f.Path, archive.IgnoreFileName)
+		}
+	}
+	for _, f := range files {
+		if f.Size > maxFileSize {
+			report(LargeFile, f.Path, "%s is %s, over %s", f.Path, archive.FormatSize(f.Size), archive.FormatSize(maxFileSize))
+		}
+	}
+
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		return slices.Index(Rules, a.Rule) - slices.Index(Rules, b.Rule)
+	})
+	return findings, nil
+}
+
+// isRootFile reports whether the slash-separated path is a file at the
+// package root named one of names, case-insensitively and with any
+// extension, as in README.md or LICENSE-MIT
+func isRootFile(p string, names ...string) bool {
+	if strings.Contains(p, "/") {
+		return false
+	}
+	upper := strings.ToUpper(p)
+	for _, name := range names {
+		if upper == name || strings.HasPrefix(upper, name+".") || strings.HasPrefix(upper, name+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// testDir returns the outermost directory of p that only holds tests, or ""
+func testDir(p string) string {
+	parts := strings.Split(p, "/")
+	for n, part := range parts[:len(parts)-1] {
+		if slices.Contains(testDirs, part) {
+			return strings.Join(parts[:n+1], "/")
+		}
+	}
+	return ""
+}
+
+// isTestFile reports whether p is a Carrion test file outside a test
+// directory, such as main_test.crl or appraise_main.crl
+func isTestFile(p string) bool {
+	name := path.Base(p)
+	return strings.HasSuffix(name, "_test.crl") || strings.HasPrefix(name, "appraise_") && strings.HasSuffix(name, ".crl")
+}
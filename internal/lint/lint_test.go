@@ -0,0 +1,87 @@
+package lint
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/archive"
+	"github.com/javanhut/bifrost/internal/manifest"
+)
+
+func TestCheck(t *testing.T) {
+	complete := []archive.File{
+		{Path: "LICENSE", Size: 1000},
+		{Path: "README.md", Size: 2000},
+		{Path: "src/main.crl", Size: 3000},
+	}
+	described := manifest.Package{
+		Name:        "json-utils",
+		Version:     "1.0.0",
+		Description: "JSON helpers",
+		Keywords:    []string{"json"},
+		Metadata:    manifest.PackageMetadata{Main: "src/main.crl"},
+	}
+
+	tests := []struct {
+		name    string
+		pkg     manifest.Package
+		lint    *manifest.Lint
+		files   []archive.File
+		want    []Rule
+		wantErr string
+	}{
+		{name: "clean", pkg: described, files: complete},
+		{
+			name:  "nothing",
+			pkg:   manifest.Package{Name: "json-utils", Version: "1.0.0", Metadata: manifest.PackageMetadata{Main: "./src/main.crl"}},
+			files: []archive.File{{Path: "docs/LICENSE"}},
+			want:  []Rule{MissingLicense, MissingReadme, MissingDescription, MissingKeywords, MissingMain},
+		},
+		{
+			name: "tests and large files",
+			pkg:  described,
+			files: append(complete,
+				archive.File{Path: "appraise/appraise_main.crl"},
+				archive.File{Path: "appraise/fixtures/data.json"},
+				archive.File{Path: "src/parser_test.crl"},
+				archive.File{Path: "assets/logo.png", Size: 2 << 20},
+			),
+			want: []Rule{TestsIncluded, TestsIncluded, LargeFile},
+		},
+		{
+			name:  "allowed",
+			pkg:   manifest.Package{Name: "json-utils", Version: "1.0.0", Description: "JSON helpers"},
+			lint:  &manifest.Lint{Allow: []string{"missing-keywords", "missing-license"}},
+			files: complete[1:],
+		},
+		{
+			name:    "unknown rule",
+			pkg:     described,
+			lint:    &manifest.Lint{Allow: []string{"missing-tests"}},
+			files:   complete,
+			wantErr: `unknown rule "missing-tests"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, err := Check(&manifest.Manifest{Package: tt.pkg, Lint: tt.lint}, tt.files, 0)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Check() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			var got []Rule
+			for _, f := range findings {
+				got = append(got, f.Rule)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() = %v, want rules %v", findings, tt.want)
+			}
+		})
+	}
+}
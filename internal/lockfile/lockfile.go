@@ -0,0 +1,251 @@
+package lockfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/javanhut/bifrost/internal/errcode"
+	"github.com/javanhut/bifrost/internal/manifest"
+)
+
+// FileName is the name of the lockfile written next to Bifrost.toml
+const FileName = "Bifrost.lock"
+
+// FileNameFor returns the name of the lockfile of the manifest profile
+// called profile, "Bifrost.<profile>.lock", so each profile's resolution is
+// tracked on its own. The empty profile is locked in FileName.
+func FileNameFor(profile string) string {
+	if profile == "" {
+		return FileName
+	}
+	return "Bifrost." + profile + ".lock"
+}
+
+// FormatVersion is the lockfile format version written by this release
+const FormatVersion = 1
+
+// ScopeUser marks a package installed in the user package directory and
+// linked into the project modules directory
+const ScopeUser = "user"
+
+// Lockfile records the exact versions a project's dependencies resolved to
+type Lockfile struct {
+	Version int `toml:"version" json:"version"`
+	// ManifestHash is the manifest's dependency hash when the lockfile was
+	// written, so a lockfile that no longer matches the manifest is noticed
+	// without resolving anything
+	ManifestHash string    `toml:"manifest-hash,omitempty" json:"manifest_hash,omitempty"`
+	Packages     []Package `toml:"package" json:"packages"`
+}
+
+// Package is a single resolved dependency
+type Package struct {
+	Name         string   `toml:"name" json:"name"`
+	Version      string   `toml:"version" json:"version"`
+	Source       string   `toml:"source,omitempty" json:"source,omitempty"`
+	Checksum     string   `toml:"checksum,omitempty" json:"checksum,omitempty"`
+	Dependencies []string `toml:"dependencies,omitempty" json:"dependencies,omitempty"`
+	// PackageName is the registry package installed under Name when Name is
+	// an alias
+	PackageName string `toml:"package,omitempty" json:"package,omitempty"`
+	// Format is the archive format the checksum belongs to, empty for
+	// "tar.gz"
+	Format string `toml:"format,omitempty" json:"format,omitempty"`
+	// Scope is ScopeUser for packages linked from the user package
+	// directory, empty for packages installed into the project
+	Scope string `toml:"scope,omitempty" json:"scope,omitempty"`
+	// Constraint is the manifest's constraint for a direct dependency when
+	// it was locked
+	Constraint string `toml:"constraint,omitempty" json:"constraint,omitempty"`
+	// Artifacts maps platform targets to the checksums of the prebuilt
+	// archives installed on them, for packages that ship platform assets
+	Artifacts map[string]string `toml:"artifacts,omitempty" json:"artifacts,omitempty"`
+}
+
+// New returns an empty lockfile in the current format
+func New() *Lockfile {
+	return &Lockfile{Version: FormatVersion}
+}
+
+// Load reads a lockfile from path
+func Load(path string) (*Lockfile, error) {
+	var l Lockfile
+	if _, err := toml.DecodeFile(path, &l); err != nil {
+		return nil, err
+	}
+	if l.Version > FormatVersion {
+		return nil, fmt.Errorf("lockfile %s uses format version %d, newer than supported version %d", path, l.Version, FormatVersion)
+	}
+	return &l, nil
+}
+
+// LoadIfExists reads a lockfile from path, returning nil without error when
+// the file does not exist
+func LoadIfExists(path string) (*Lockfile, error) {
+	l, err := Load(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return l, nil
+}
+
+// ErrOutOfDate is wrapped by the error LoadCurrent returns for a lockfile
+// written before the manifest's dependencies changed
+var ErrOutOfDate = errors.New("lockfile is out of date")
+
+// Drifted reports whether the dependencies of m changed since l was written.
+// Lockfiles written before the manifest hash was recorded never count as
+// drifted; only their constraints can be checked.
+func (l *Lockfile) Drifted(m *manifest.Manifest) bool {
+	return l.ManifestHash != "" && l.ManifestHash != m.DependencyHash()
+}
+
+// LoadCurrent is LoadIfExists for the lockfile of m, failing with
+// ErrOutOfDate when the dependencies in m changed since it was written, so
+// that versions which no longer apply are not taken for the project's
+func LoadCurrent(path string, m *manifest.Manifest) (*Lockfile, error) {
+	l, err := LoadIfExists(path)
+	if err != nil || l == nil {
+		return l, err
+	}
+	if l.Drifted(m) {
+		return nil, errcode.LockfileOutOfDate.Errorf("%w: the dependencies in %s changed since %s was written; run 'bifrost install' to update it", ErrOutOfDate, manifest.FileName, filepath.Base(path))
+	}
+	return l, nil
+}
+
+// header starts every lockfile
+const header = "# This file is generated by Bifrost. Do not edit it by hand.\n"
+
+// Save writes the lockfile to path in its canonical form. An unchanged
+// lockfile is left untouched.
+func (l *Lockfile) Save(path string) error {
+	data := l.Marshal()
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Marshal renders the lockfile in its canonical form: packages sorted by
+// name, their keys in a fixed order and dependencies sorted one per line.
+// Adding or updating a dependency then only changes the lines of the
+// packages involved, which keeps lockfile diffs reviewable.
+func (l *Lockfile) Marshal() []byte {
+	l.sort()
+
+	var b bytes.Buffer
+	b.WriteString(header)
+	fmt.Fprintf(&b, "\nversion = %d\n", l.Version)
+	if l.ManifestHash != "" {
+		fmt.Fprintf(&b, "manifest-hash = %s\n", quote(l.ManifestHash))
+	}
+	for _, pkg := range l.Packages {
+		b.WriteString("\n[[package]]\n")
+		writeKey(&b, "name", pkg.Name)
+		writeKey(&b, "package", pkg.PackageName)
+		writeKey(&b, "version", pkg.Version)
+		writeKey(&b, "constraint", pkg.Constraint)
+		writeKey(&b, "source", pkg.Source)
+		writeKey(&b, "checksum", pkg.Checksum)
+		writeKey(&b, "format", pkg.Format)
+		writeKey(&b, "scope", pkg.Scope)
+		if len(pkg.Dependencies) > 0 {
+			b.WriteString("  dependencies = [\n")
+			for _, dep := range pkg.Dependencies {
+				fmt.Fprintf(&b, "    %s,\n", quote(dep))
+			}
+			b.WriteString("  ]\n")
+		}
+		if len(pkg.Artifacts) > 0 {
+			b.WriteString("  [package.artifacts]\n")
+			targets := make([]string, 0, len(pkg.Artifacts))
+			for target := range pkg.Artifacts {
+				targets = append(targets, target)
+			}
+			sort.Strings(targets)
+			for _, target := range targets {
+				fmt.Fprintf(&b, "    %s = %s\n", quote(target), quote(pkg.Artifacts[target]))
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+// writeKey writes a string key of a package, omitting empty values
+func writeKey(b *bytes.Buffer, key, value string) {
+	if value != "" {
+		fmt.Fprintf(b, "  %s = %s\n", key, quote(value))
+	}
+}
+
+// quote renders s as a TOML basic string
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// Find returns the locked entry for a package, or nil when it is not locked
+func (l *Lockfile) Find(name string) *Package {
+	for i := range l.Packages {
+		if l.Packages[i].Name == name {
+			return &l.Packages[i]
+		}
+	}
+	return nil
+}
+
+// Set adds or replaces the locked entry for pkg.Name
+func (l *Lockfile) Set(pkg Package) {
+	if existing := l.Find(pkg.Name); existing != nil {
+		*existing = pkg
+		return
+	}
+	l.Packages = append(l.Packages, pkg)
+}
+
+// Remove drops the locked entry for a package, reporting whether it existed
+func (l *Lockfile) Remove(name string) bool {
+	for i := range l.Packages {
+		if l.Packages[i].Name == name {
+			l.Packages = append(l.Packages[:i], l.Packages[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Lockfile) sort() {
+	sort.SliceStable(l.Packages, func(i, j int) bool {
+		return l.Packages[i].Name < l.Packages[j].Name
+	})
+	for i := range l.Packages {
+		sort.Strings(l.Packages[i].Dependencies)
+	}
+}
@@ -0,0 +1,183 @@
+package lockfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/manifest"
+)
+
+func TestLockfile_SaveLoadRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+
+	l := New()
+	l.ManifestHash = "sha256:def"
+	l.Set(Package{Name: "zeta", Version: "1.0.0", Dependencies: []string{"beta", "alpha"}})
+	l.Set(Package{Name: "alpha", Version: "0.2.0", Checksum: "sha256:abc", Source: "https://registry.test",
+		Artifacts: map[string]string{"linux-amd64": "sha256:111", "darwin-arm64": "sha256:222"}})
+
+	if err := l.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Version != FormatVersion {
+		t.Errorf("Version = %d, want %d", loaded.Version, FormatVersion)
+	}
+	if loaded.ManifestHash != "sha256:def" {
+		t.Errorf("ManifestHash = %q, want sha256:def", loaded.ManifestHash)
+	}
+	if len(loaded.Packages) != 2 {
+		t.Fatalf("expected 2 packages, got %d", len(loaded.Packages))
+	}
+	if loaded.Packages[0].Name != "alpha" || loaded.Packages[1].Name != "zeta" {
+		t.Errorf("packages not sorted by name: %+v", loaded.Packages)
+	}
+	if deps := loaded.Packages[1].Dependencies; len(deps) != 2 || deps[0] != "alpha" {
+		t.Errorf("dependencies not sorted: %v", deps)
+	}
+	if loaded.Packages[0].Checksum != "sha256:abc" {
+		t.Errorf("Checksum = %q, want sha256:abc", loaded.Packages[0].Checksum)
+	}
+	if artifacts := loaded.Packages[0].Artifacts; len(artifacts) != 2 || artifacts["darwin-arm64"] != "sha256:222" {
+		t.Errorf("Artifacts = %v", artifacts)
+	}
+	if loaded.Packages[1].Artifacts != nil {
+		t.Errorf("Artifacts of a platform-independent package = %v", loaded.Packages[1].Artifacts)
+	}
+}
+
+func TestLockfile_SetFindRemove(t *testing.T) {
+	l := New()
+	l.Set(Package{Name: "json-utils", Version: "1.0.0"})
+	l.Set(Package{Name: "json-utils", Version: "1.1.0"})
+
+	if len(l.Packages) != 1 {
+		t.Fatalf("Set() should replace existing entries, got %d packages", len(l.Packages))
+	}
+	if got := l.Find("json-utils"); got == nil || got.Version != "1.1.0" {
+		t.Errorf("Find() = %+v, want version 1.1.0", got)
+	}
+	if l.Find("missing") != nil {
+		t.Error("Find() of unknown package should return nil")
+	}
+	if !l.Remove("json-utils") || l.Remove("json-utils") {
+		t.Error("Remove() should report whether the package was present")
+	}
+}
+
+func TestLoadIfExists(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := LoadIfExists(filepath.Join(dir, FileName))
+	if err != nil || l != nil {
+		t.Errorf("LoadIfExists() on missing file = %v, %v; want nil, nil", l, err)
+	}
+
+	path := filepath.Join(dir, "broken.lock")
+	os.WriteFile(path, []byte("not = [valid"), 0644)
+	if _, err := LoadIfExists(path); err == nil {
+		t.Error("expected an error for an invalid lockfile")
+	}
+}
+
+func TestLoadCurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	m := &manifest.Manifest{Dependencies: map[string]string{"json-utils": "^1.0.0"}}
+
+	if l, err := LoadCurrent(path, m); err != nil || l != nil {
+		t.Errorf("LoadCurrent() on missing file = %v, %v; want nil, nil", l, err)
+	}
+
+	l := New()
+	l.ManifestHash = m.DependencyHash()
+	l.Set(Package{Name: "json-utils", Version: "1.0.0"})
+	if err := l.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if l, err := LoadCurrent(path, m); err != nil || l == nil {
+		t.Errorf("LoadCurrent() of a current lockfile = %v, %v", l, err)
+	}
+
+	m.Dependencies["json-utils"] = "^2.0.0"
+	if l, err := LoadCurrent(path, m); !errors.Is(err, ErrOutOfDate) || l != nil {
+		t.Errorf("LoadCurrent() after the dependencies changed = %v, %v; want ErrOutOfDate", l, err)
+	}
+
+	// Lockfiles without a manifest hash cannot tell
+	l.ManifestHash = ""
+	if err := l.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if l, err := LoadCurrent(path, m); err != nil || l == nil {
+		t.Errorf("LoadCurrent() of a lockfile without a hash = %v, %v", l, err)
+	}
+}
+
+func TestLoad_FutureFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	os.WriteFile(path, []byte("version = 99\n"), 0644)
+
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "newer than supported") {
+		t.Errorf("expected future format error, got %v", err)
+	}
+}
+
+func TestLockfile_MarshalIsStable(t *testing.T) {
+	build := func(extra bool) *Lockfile {
+		l := New()
+		l.Set(Package{Name: "zeta", Version: "1.0.0", Dependencies: []string{"gamma", "alpha"}})
+		l.Set(Package{Name: "alpha", Version: "0.2.0", Checksum: "sha256:abc", Source: "https://registry.test"})
+		l.Set(Package{Name: "gamma", Version: "2.0.0", PackageName: "gamma-core", Scope: ScopeUser})
+		if extra {
+			l.Set(Package{Name: "beta", Version: "1.1.0"})
+			l.Find("zeta").Dependencies = append(l.Find("zeta").Dependencies, "beta")
+		}
+		return l
+	}
+
+	before := string(build(false).Marshal())
+	if again := string(build(false).Marshal()); again != before {
+		t.Fatalf("Marshal() differs between runs:\n%s\n%s", before, again)
+	}
+
+	// Adding a dependency only inserts lines: the new package's entry and
+	// its name in the list of its dependent
+	after := string(build(true).Marshal())
+	oldLines, newLines := strings.Split(before, "\n"), strings.Split(after, "\n")
+	n := 0
+	for _, line := range newLines {
+		if n < len(oldLines) && line == oldLines[n] {
+			n++
+		}
+	}
+	if n != len(oldLines) {
+		t.Errorf("adding a dependency changed existing lines:\n%s\n%s", before, after)
+	}
+	if added := len(newLines) - len(oldLines); added != 5 {
+		t.Errorf("adding a dependency added %d lines, want 5:\n%s", added, after)
+	}
+}
+
+func TestLockfile_MarshalQuotes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	l := New()
+	l.Set(Package{Name: "odd", Version: "1.0.0", Source: "https://registry.test/\"quoted\"\\path\tdonnées"})
+	if err := l.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := loaded.Packages[0].Source; got != l.Packages[0].Source {
+		t.Errorf("Source = %q, want %q", got, l.Packages[0].Source)
+	}
+}
@@ -0,0 +1,264 @@
+// Package locksign signs lockfiles with a project key and verifies them, so
+// a change to pinned versions or checksums made without the key is detected.
+//
+// The project's public key is committed next to the lockfile as
+// Bifrost.lock.pub and the signature as Bifrost.lock.sig. Private keys are
+// kept under ~/.carrion/keys, named by the fingerprint of their public key,
+// or passed in BIFROST_LOCK_SIGNING_KEY. Frozen installs only trust a public
+// key pinned outside the project, in BIFROST_LOCK_PUBLIC_KEY or the user's
+// configuration.
+package locksign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/errcode"
+)
+
+// PublicKeyFileName is the project's public key, kept next to the lockfile
+const PublicKeyFileName = "Bifrost.lock.pub"
+
+// SignatureSuffix is appended to the lockfile path to name its signature
+const SignatureSuffix = ".sig"
+
+// PrivateKeyEnv holds a base64 private key, taking precedence over the key
+// files, e.g. for signing in CI
+const PrivateKeyEnv = "BIFROST_LOCK_SIGNING_KEY"
+
+// PublicKeyEnv holds a base64 public key that verification trusts instead of
+// the committed one, so a change that replaces both the lockfile and the
+// committed key still fails
+const PublicKeyEnv = "BIFROST_LOCK_PUBLIC_KEY"
+
+var (
+	// ErrNoSigningKey is returned when a project has a public key but the
+	// matching private key is not available
+	ErrNoSigningKey = errors.New("no signing key for this project's lockfile")
+	// ErrUnsigned is returned when a signed project's lockfile has no
+	// signature
+	ErrUnsigned error = &errcode.Error{Code: errcode.LockfileSignature, Err: errors.New("lockfile is not signed")}
+	// ErrBadSignature is returned when a lockfile does not match its
+	// signature
+	ErrBadSignature error = &errcode.Error{Code: errcode.LockfileSignature, Err: errors.New("lockfile signature does not match; it was changed without the project key")}
+	// ErrNoPublicKey is returned when a lockfile has a signature but there
+	// is no key to check it against
+	ErrNoPublicKey error = &errcode.Error{Code: errcode.LockfileSignature, Err: fmt.Errorf("lockfile is signed but %s is missing and %s is not set", PublicKeyFileName, PublicKeyEnv)}
+	// ErrUntrustedKey is returned when the committed public key is not
+	// pinned outside the project
+	ErrUntrustedKey error = &errcode.Error{Code: errcode.LockfileSignature, Err: errors.New("the project's lockfile key is not pinned outside the project")}
+)
+
+// GenerateKey returns a new project key pair
+func GenerateKey() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	return ed25519.GenerateKey(rand.Reader)
+}
+
+// Encode renders a key as base64
+func Encode(key []byte) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// ParsePublicKey parses a base64 public key
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(data) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key: expected %d base64 encoded bytes", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+// ParsePrivateKey parses a base64 private key
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(data) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid private key: expected %d base64 encoded bytes", ed25519.PrivateKeySize)
+	}
+	return ed25519.PrivateKey(data), nil
+}
+
+// Fingerprint identifies a public key by the start of its SHA-256 hash
+func Fingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// PublicKeyPath returns where the public key of the project whose lockfile
+// is at lockPath is kept
+func PublicKeyPath(lockPath string) string {
+	return filepath.Join(filepath.Dir(lockPath), PublicKeyFileName)
+}
+
+// KeyPath returns where the private key for pub is kept
+func KeyPath(cfg *config.Config, pub ed25519.PublicKey) string {
+	return filepath.Join(cfg.HomeDir, "keys", Fingerprint(pub)+".key")
+}
+
+// SavePrivateKey writes priv to its key file, readable only by the user
+func SavePrivateKey(cfg *config.Config, priv ed25519.PrivateKey) (string, error) {
+	path := KeyPath(cfg, priv.Public().(ed25519.PublicKey))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create key directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(Encode(priv)+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write private key: %w", err)
+	}
+	return path, nil
+}
+
+// LoadPublicKey returns the key lockfile signatures are checked against:
+// the one in PublicKeyEnv, or else the project's committed key. It returns
+// nil without error when the project does not sign its lockfile, and
+// ErrNoPublicKey for a signature without a key.
+func LoadPublicKey(lockPath string) (ed25519.PublicKey, error) {
+	if env := os.Getenv(PublicKeyEnv); env != "" {
+		pub, err := ParsePublicKey(env)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", PublicKeyEnv, err)
+		}
+		return pub, nil
+	}
+	pub, err := loadProjectKey(lockPath)
+	if err != nil || pub != nil {
+		return pub, err
+	}
+	if _, err := os.Stat(lockPath + SignatureSuffix); err == nil {
+		return nil, ErrNoPublicKey
+	}
+	return nil, nil
+}
+
+// LoadTrustedKey is LoadPublicKey for frozen installs, which must not trust
+// a key committed along with the lockfile it vouches for: the committed key
+// is only returned when it is one of trusted, the base64 keys pinned in the
+// user's configuration, and ErrUntrustedKey otherwise. PublicKeyEnv is
+// trusted as it is. With keys pinned, a project without a key or signature
+// is ErrUnsigned, so deleting both does not turn verification off.
+func LoadTrustedKey(lockPath string, trusted []string) (ed25519.PublicKey, error) {
+	pub, err := LoadPublicKey(lockPath)
+	if err != nil {
+		return nil, err
+	}
+	if pub == nil {
+		if len(trusted) > 0 {
+			return nil, fmt.Errorf("%w: %s and its signature are missing, but lock.keys pins lockfile keys", ErrUnsigned, PublicKeyFileName)
+		}
+		return nil, nil
+	}
+	if os.Getenv(PublicKeyEnv) != "" {
+		return pub, nil
+	}
+	for _, s := range trusted {
+		if key, err := ParsePublicKey(s); err == nil && key.Equal(pub) {
+			return pub, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s holds key %s; pin it with 'bifrost config set lock.keys %s' or set %s", ErrUntrustedKey, PublicKeyFileName, Fingerprint(pub), Encode(pub), PublicKeyEnv)
+}
+
+// loadProjectKey reads the committed public key, returning nil when there
+// is none
+func loadProjectKey(lockPath string) (ed25519.PublicKey, error) {
+	path := PublicKeyPath(lockPath)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	pub, err := ParsePublicKey(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return pub, nil
+}
+
+// LoadPrivateKey returns the private key matching pub, from PrivateKeyEnv or
+// the key directory, or ErrNoSigningKey
+func LoadPrivateKey(cfg *config.Config, pub ed25519.PublicKey) (ed25519.PrivateKey, error) {
+	var encoded string
+	if env := os.Getenv(PrivateKeyEnv); env != "" {
+		encoded = env
+	} else {
+		data, err := os.ReadFile(KeyPath(cfg, pub))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, ErrNoSigningKey
+			}
+			return nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+		encoded = string(data)
+	}
+
+	priv, err := ParsePrivateKey(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(priv.Public().(ed25519.PublicKey), pub) {
+		return nil, fmt.Errorf("%w: the available key %s does not match %s", ErrNoSigningKey, Fingerprint(priv.Public().(ed25519.PublicKey)), Fingerprint(pub))
+	}
+	return priv, nil
+}
+
+// Sign writes the signature of the lockfile at lockPath made with priv
+func Sign(lockPath string, priv ed25519.PrivateKey) error {
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return fmt.Errorf("failed to read lockfile: %w", err)
+	}
+	signature := Encode(ed25519.Sign(priv, data))
+	if err := os.WriteFile(lockPath+SignatureSuffix, []byte(signature+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write lockfile signature: %w", err)
+	}
+	return nil
+}
+
+// Verify checks the signature of the lockfile at lockPath against pub
+func Verify(lockPath string, pub ed25519.PublicKey) error {
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return fmt.Errorf("failed to read lockfile: %w", err)
+	}
+	encoded, err := os.ReadFile(lockPath + SignatureSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrUnsigned
+		}
+		return fmt.Errorf("failed to read lockfile signature: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil || !ed25519.Verify(pub, data, signature) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// Resign signs the lockfile at lockPath again after it changed, when the
+// project has a committed public key. It reports whether it signed, and
+// returns ErrNoSigningKey when the project signs its lockfile but the key is
+// not available here, leaving the old signature to fail verification.
+func Resign(cfg *config.Config, lockPath string) (bool, error) {
+	pub, err := loadProjectKey(lockPath)
+	if err != nil || pub == nil {
+		return false, err
+	}
+	priv, err := LoadPrivateKey(cfg, pub)
+	if err != nil {
+		return false, err
+	}
+	if err := Sign(lockPath, priv); err != nil {
+		return false, err
+	}
+	return true, nil
+}
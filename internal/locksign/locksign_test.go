@@ -0,0 +1,170 @@
+package locksign
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/config"
+)
+
+func newTestProject(t *testing.T) (*config.Config, string) {
+	t.Helper()
+	t.Setenv(PrivateKeyEnv, "")
+	t.Setenv(PublicKeyEnv, "")
+	tempDir := t.TempDir()
+	cfg := config.NewWithHome(filepath.Join(tempDir, "home"))
+	lockPath := filepath.Join(tempDir, "Bifrost.lock")
+	if err := os.WriteFile(lockPath, []byte("version = 1\n"), 0644); err != nil {
+		t.Fatalf("failed to write lockfile: %v", err)
+	}
+	return cfg, lockPath
+}
+
+// setUp gives the project at lockPath a committed public key and stores the
+// private key for cfg
+func setUp(t *testing.T, cfg *config.Config, lockPath string) {
+	t.Helper()
+	pub, priv, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	if err := os.WriteFile(PublicKeyPath(lockPath), []byte(Encode(pub)+"\n"), 0644); err != nil {
+		t.Fatalf("failed to write public key: %v", err)
+	}
+	if _, err := SavePrivateKey(cfg, priv); err != nil {
+		t.Fatalf("SavePrivateKey() error = %v", err)
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	cfg, lockPath := newTestProject(t)
+	setUp(t, cfg, lockPath)
+
+	pub, err := LoadPublicKey(lockPath)
+	if err != nil || pub == nil {
+		t.Fatalf("LoadPublicKey() = %v, %v", pub, err)
+	}
+	if err := Verify(lockPath, pub); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("Verify() of an unsigned lockfile error = %v, want ErrUnsigned", err)
+	}
+
+	if signed, err := Resign(cfg, lockPath); !signed || err != nil {
+		t.Fatalf("Resign() = %v, %v", signed, err)
+	}
+	if err := Verify(lockPath, pub); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	if err := os.WriteFile(lockPath, []byte("version = 1\n\n[[package]]\nname = \"evil\"\n"), 0644); err != nil {
+		t.Fatalf("failed to tamper with lockfile: %v", err)
+	}
+	if err := Verify(lockPath, pub); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Verify() of a changed lockfile error = %v, want ErrBadSignature", err)
+	}
+}
+
+func TestLoadPublicKey_EnvironmentPinsKey(t *testing.T) {
+	cfg, lockPath := newTestProject(t)
+	setUp(t, cfg, lockPath)
+	if _, err := Resign(cfg, lockPath); err != nil {
+		t.Fatalf("Resign() error = %v", err)
+	}
+
+	// A change replacing the committed key and re-signing with it still
+	// fails against the key pinned in the environment
+	trusted, err := LoadPublicKey(lockPath)
+	if err != nil {
+		t.Fatalf("LoadPublicKey() error = %v", err)
+	}
+	setUp(t, cfg, lockPath)
+	if _, err := Resign(cfg, lockPath); err != nil {
+		t.Fatalf("Resign() error = %v", err)
+	}
+	t.Setenv(PublicKeyEnv, Encode(trusted))
+	pub, err := LoadPublicKey(lockPath)
+	if err != nil {
+		t.Fatalf("LoadPublicKey() error = %v", err)
+	}
+	if err := Verify(lockPath, pub); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Verify() with the pinned key error = %v, want ErrBadSignature", err)
+	}
+}
+
+func TestLoadPublicKey_SignatureWithoutKey(t *testing.T) {
+	cfg, lockPath := newTestProject(t)
+	if pub, err := LoadPublicKey(lockPath); pub != nil || err != nil {
+		t.Errorf("LoadPublicKey() of an unsigned project = %v, %v, want nil, nil", pub, err)
+	}
+
+	setUp(t, cfg, lockPath)
+	if _, err := Resign(cfg, lockPath); err != nil {
+		t.Fatalf("Resign() error = %v", err)
+	}
+	os.Remove(PublicKeyPath(lockPath))
+	if _, err := LoadPublicKey(lockPath); !errors.Is(err, ErrNoPublicKey) {
+		t.Errorf("LoadPublicKey() with a signature but no key error = %v, want ErrNoPublicKey", err)
+	}
+}
+
+func TestLoadTrustedKey(t *testing.T) {
+	cfg, lockPath := newTestProject(t)
+	if pub, err := LoadTrustedKey(lockPath, nil); pub != nil || err != nil {
+		t.Errorf("LoadTrustedKey() of an unsigned project = %v, %v, want nil, nil", pub, err)
+	}
+	pinned, _, _ := GenerateKey()
+	if _, err := LoadTrustedKey(lockPath, []string{Encode(pinned)}); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("LoadTrustedKey() of an unsigned project with keys pinned error = %v, want ErrUnsigned", err)
+	}
+
+	setUp(t, cfg, lockPath)
+	committed, err := LoadPublicKey(lockPath)
+	if err != nil {
+		t.Fatalf("LoadPublicKey() error = %v", err)
+	}
+	if _, err := LoadTrustedKey(lockPath, nil); !errors.Is(err, ErrUntrustedKey) {
+		t.Errorf("LoadTrustedKey() of a key that is not pinned error = %v, want ErrUntrustedKey", err)
+	}
+	other, _, _ := GenerateKey()
+	if _, err := LoadTrustedKey(lockPath, []string{Encode(other)}); !errors.Is(err, ErrUntrustedKey) {
+		t.Errorf("LoadTrustedKey() with another key pinned error = %v, want ErrUntrustedKey", err)
+	}
+	if pub, err := LoadTrustedKey(lockPath, []string{Encode(other), Encode(committed)}); err != nil || !pub.Equal(committed) {
+		t.Errorf("LoadTrustedKey() with the key pinned = %v, %v", pub, err)
+	}
+
+	t.Setenv(PublicKeyEnv, Encode(other))
+	if pub, err := LoadTrustedKey(lockPath, nil); err != nil || !pub.Equal(other) {
+		t.Errorf("LoadTrustedKey() with the key in the environment = %v, %v", pub, err)
+	}
+}
+
+func TestResign(t *testing.T) {
+	cfg, lockPath := newTestProject(t)
+	if signed, err := Resign(cfg, lockPath); signed || err != nil {
+		t.Errorf("Resign() without a project key = %v, %v, want false, nil", signed, err)
+	}
+
+	pub, priv, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	if err := os.WriteFile(PublicKeyPath(lockPath), []byte(Encode(pub)), 0644); err != nil {
+		t.Fatalf("failed to write public key: %v", err)
+	}
+	if _, err := Resign(cfg, lockPath); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("Resign() without the private key error = %v, want ErrNoSigningKey", err)
+	}
+
+	t.Setenv(PrivateKeyEnv, Encode(priv))
+	if signed, err := Resign(cfg, lockPath); !signed || err != nil {
+		t.Errorf("Resign() with the key in the environment = %v, %v", signed, err)
+	}
+
+	_, other, _ := GenerateKey()
+	t.Setenv(PrivateKeyEnv, Encode(other))
+	if _, err := Resign(cfg, lockPath); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("Resign() with another project's key error = %v, want ErrNoSigningKey", err)
+	}
+}
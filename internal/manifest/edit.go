@@ -0,0 +1,176 @@
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/javanhut/bifrost/internal/fsutil"
+)
+
+// Edit is a change to a single key of a manifest table
+type Edit struct {
+	// Table is the table holding the key, e.g. "dependencies" or
+	// "profile.dev.dependencies"
+	Table string
+	Key   string
+	// Value is the TOML value the key gets, e.g. `"^1.2.0"`. An empty one
+	// removes the key.
+	Value string
+}
+
+// SetDependency returns the edit setting the dependency name of table to
+// constraint, written as an alias table when it installs a package of
+// another name
+func SetDependency(table, name, pkg, constraint string) Edit {
+	value := strconv.Quote(constraint)
+	if pkg != "" && pkg != name {
+		value = fmt.Sprintf("{ package = %s, version = %s }", strconv.Quote(pkg), value)
+	}
+	return Edit{Table: table, Key: name, Value: value}
+}
+
+var (
+	tableHeader = regexp.MustCompile(`^\s*\[\s*([^\[\]]+?)\s*\]\s*(#.*)?$`)
+	keyValue    = regexp.MustCompile(`^(\s*)("[^"]*"|'[^']*'|[A-Za-z0-9_-]+)\s*=\s*`)
+	bareKey     = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// EditFile applies edits to the manifest at path in place. Unlike Save, it
+// rewrites only the lines of the keys edited, so comments, ordering and
+// formatting elsewhere in the file are kept. Keys missing from their table
+// are added after its last key, and tables missing from the file are added
+// at its end.
+func EditFile(path string, edits ...Edit) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	text := string(data)
+	for _, e := range edits {
+		text = applyEdit(text, e)
+	}
+	// A key the line editing cannot see, such as one set through a dotted
+	// key or an inline table, would end up declared twice
+	if _, err := toml.Decode(text, new(map[string]any)); err != nil {
+		return fmt.Errorf("failed to edit %s: %w", FileName, err)
+	}
+	return fsutil.WriteFileAtomic(path, []byte(text), info.Mode().Perm())
+}
+
+// applyEdit returns text with e applied
+func applyEdit(text string, e Edit) string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	table := ""
+	found := false
+	last := -1 // the last key of e.Table, or its header
+	for n, line := range lines {
+		trimmed := strings.TrimRight(line, "\r\n")
+		if m := tableHeader.FindStringSubmatch(trimmed); m != nil && !strings.HasPrefix(strings.TrimSpace(trimmed), "[[") {
+			table = normalizeTable(m[1])
+			if table == e.Table {
+				found, last = true, n
+			}
+			continue
+		}
+		if table != e.Table {
+			continue
+		}
+		m := keyValue.FindStringSubmatch(trimmed)
+		if m == nil {
+			continue
+		}
+		last = n
+		if unquoteKey(m[2]) != e.Key {
+			continue
+		}
+		if e.Value == "" {
+			return strings.Join(append(lines[:n], lines[n+1:]...), "")
+		}
+		// Whatever follows the value, a comment usually, is kept
+		rest := trimmed[len(m[0]):]
+		lines[n] = m[0] + e.Value + rest[valueEnd(rest):] + line[len(trimmed):]
+		return strings.Join(lines, "")
+	}
+
+	if e.Value == "" {
+		return text
+	}
+	entry := formatKey(e.Key) + " = " + e.Value + "\n"
+	if !found {
+		if text != "" && !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		if text != "" {
+			text += "\n"
+		}
+		return text + "[" + e.Table + "]\n" + entry
+	}
+	if !strings.HasSuffix(lines[last], "\n") {
+		lines[last] += "\n"
+	}
+	lines = append(lines[:last+1], append([]string{entry}, lines[last+1:]...)...)
+	return strings.Join(lines, "")
+}
+
+// valueEnd returns the length of the single-line value at the start of s,
+// which ends at the first comment or line end outside strings
+func valueEnd(s string) int {
+	var quote byte
+	for n := 0; n < len(s); n++ {
+		switch c := s[n]; {
+		case quote == '"' && c == '\\':
+			n++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return len(strings.TrimRight(s[:n], " \t"))
+		}
+	}
+	return len(strings.TrimRight(s, " \t"))
+}
+
+// normalizeTable returns a table name as written in a header, such as
+// `profile . "dev"`, in the form of Edit.Table
+func normalizeTable(name string) string {
+	parts := strings.Split(name, ".")
+	for n, part := range parts {
+		parts[n] = unquoteKey(strings.TrimSpace(part))
+	}
+	return strings.Join(parts, ".")
+}
+
+// unquoteKey returns the name of a bare or quoted key
+func unquoteKey(key string) string {
+	if strings.HasPrefix(key, "'") {
+		return strings.Trim(key, "'")
+	}
+	if s, err := strconv.Unquote(key); err == nil {
+		return s
+	}
+	return key
+}
+
+// formatKey returns key as written in TOML, quoted unless it is a bare key
+func formatKey(key string) string {
+	if bareKey.MatchString(key) {
+		return key
+	}
+	return strconv.Quote(key)
+}
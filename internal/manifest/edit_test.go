@@ -0,0 +1,90 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEditFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Bifrost.toml")
+	content := `# The app
+[package]
+name = "app" # renamed with bifrost rename
+version = "0.1.0"
+
+[dependencies]
+# HTTP
+http-client = "^1.0.0"  # pinned for the API
+json = { package = "json-utils", version = "^1.0.0" }
+
+# Test helpers
+[dev-dependencies]
+test-kit = "^0.1.0"
+
+[profile.dev.dependencies]
+http-client = "^1.0.0"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+
+	err := EditFile(path,
+		Edit{Table: "package", Key: "name", Value: `"web-app"`},
+		SetDependency("dependencies", "http-client", "http-client", "^2.0.0"),
+		SetDependency("dependencies", "json", "json-utils", "^2.0.0"),
+		SetDependency("dependencies", "@acme/log", "@acme/log", "^1.0.0"),
+		Edit{Table: "dev-dependencies", Key: "test-kit"},
+		SetDependency("profile.dev.dependencies", "http-client", "", "^2.1.0"),
+		SetDependency("scripts", "test", "", "carrion test"),
+	)
+	if err != nil {
+		t.Fatalf("EditFile() error = %v", err)
+	}
+
+	want := `# The app
+[package]
+name = "web-app" # renamed with bifrost rename
+version = "0.1.0"
+
+[dependencies]
+# HTTP
+http-client = "^2.0.0"  # pinned for the API
+json = { package = "json-utils", version = "^2.0.0" }
+"@acme/log" = "^1.0.0"
+
+# Test helpers
+[dev-dependencies]
+
+[profile.dev.dependencies]
+http-client = "^2.1.0"
+
+[scripts]
+test = "carrion test"
+`
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("edited manifest =\n%s\nwant\n%s", data, want)
+	}
+	m, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() after EditFile() error = %v", err)
+	}
+	if m.Dependencies["json"] != "^2.0.0" || m.PackageName("json") != "json-utils" {
+		t.Errorf("edited alias = %q of %q", m.Dependencies["json"], m.PackageName("json"))
+	}
+
+	// Edits that would leave the manifest invalid are refused, and the file
+	// is left alone
+	os.WriteFile(path, []byte("[package]\nname = \"app\"\ndependencies.http-client = \"^1.0.0\"\n[dependencies]\n"), 0644)
+	before, _ := os.ReadFile(path)
+	if err := EditFile(path, Edit{Table: "package", Key: "dependencies", Value: `"x"`}); err == nil {
+		t.Error("EditFile() of a key set through a dotted key succeeded")
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Errorf("failed EditFile() changed the manifest:\n%s", after)
+	}
+}
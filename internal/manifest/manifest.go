@@ -1,40 +1,317 @@
 package manifest
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 )
 
+// FileName is the conventional name of a package manifest
+const FileName = "Bifrost.toml"
+
 type Manifest struct {
-	Package         Package           `toml:"package"`
-	Dependencies    map[string]string `toml:"dependencies"`
-	DevDependencies map[string]string `toml:"dev-dependencies"`
+	Package         Package           `toml:"package" json:"package"`
+	Dependencies    map[string]string `toml:"dependencies" json:"dependencies"`
+	DevDependencies map[string]string `toml:"dev-dependencies" json:"dev_dependencies"`
+	// Aliases maps dependency names declared as
+	// `name = { package = "...", version = "..." }` to the registry package
+	// installed under that name
+	Aliases map[string]string `toml:"-" json:"aliases,omitempty"`
+	// Scripts maps script names to shell commands. Those named after a
+	// lifecycle event run when the package is installed.
+	Scripts map[string]string `toml:"scripts,omitempty" json:"scripts,omitempty"`
+	// Bin maps executable names to files in the package
+	Bin map[string]string `toml:"bin,omitempty" json:"bin,omitempty"`
+	// Lint configures the checks of `bifrost lint-package`, nil for the
+	// defaults
+	Lint *Lint `toml:"lint,omitempty" json:"lint,omitempty"`
+	// Profiles are the named profiles declared as [profile.<name>] tables,
+	// selected with --profile
+	Profiles map[string]*Profile `toml:"-" json:"profiles,omitempty"`
+}
+
+// Profile overrides the dependencies and registry of a project while it is
+// selected, e.g. to install a mock package in a "dev" profile and the real
+// one in "prod"
+type Profile struct {
+	// Dependencies are added to the project's dependencies, replacing those
+	// of the same name
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+	// Aliases maps the profile's aliased dependencies to the registry
+	// packages they install
+	Aliases map[string]string `json:"aliases,omitempty"`
+	// Registry is the URL of the registry the profile installs from, empty
+	// for the configured one
+	Registry string `json:"registry,omitempty"`
+}
+
+// Lint configures the pre-publish checks of a package
+type Lint struct {
+	// Allow lists the rules silenced for the package, e.g.
+	// "missing-keywords"
+	Allow []string `toml:"allow,omitempty" json:"allow,omitempty"`
+}
+
+// LifecycleEvents are the scripts run after a package is extracted, in the
+// order they run
+var LifecycleEvents = []string{"preinstall", "install", "postinstall"}
+
+// InstallScripts returns the names of the lifecycle scripts m declares, in
+// the order they run
+func (m *Manifest) InstallScripts() []string {
+	var names []string
+	for _, event := range LifecycleEvents {
+		if m.Scripts[event] != "" {
+			names = append(names, event)
+		}
+	}
+	return names
+}
+
+// PackageName returns the registry package a dependency name refers to
+func (m *Manifest) PackageName(dependency string) string {
+	if pkg, ok := m.Aliases[dependency]; ok {
+		return pkg
+	}
+	return dependency
+}
+
+// DependencyHash returns a "sha256:<hex>" hash of what the lockfile is
+// resolved from: every dependency with its constraint and the registry
+// package it installs. Other edits to the manifest leave it unchanged.
+func (m *Manifest) DependencyHash() string {
+	names := make([]string, 0, len(m.Dependencies))
+	for name := range m.Dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\x00%s\x00%s\n", name, m.PackageName(name), m.Dependencies[name])
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// rawManifest is the manifest as written, where a dependency is either a
+// version constraint or an alias table
+type rawManifest struct {
+	Package         Package               `toml:"package"`
+	Dependencies    map[string]any        `toml:"dependencies"`
+	DevDependencies map[string]any        `toml:"dev-dependencies"`
+	Scripts         map[string]string     `toml:"scripts,omitempty"`
+	Bin             map[string]string     `toml:"bin,omitempty"`
+	Lint            *Lint                 `toml:"lint,omitempty"`
+	Profile         map[string]rawProfile `toml:"profile,omitempty"`
+}
+
+// rawProfile is a [profile.<name>] table as written
+type rawProfile struct {
+	Registry     string         `toml:"registry,omitempty"`
+	Dependencies map[string]any `toml:"dependencies,omitempty"`
 }
 
 type Package struct {
-	Name        string          `toml:"name"`
-	Version     string          `toml:"version"`
-	Authors     []string        `toml:"authors"`
-	Description string          `toml:"description"`
-	License     string          `toml:"license"`
-	Repository  string          `toml:"repository"`
-	Keywords    []string        `toml:"keywords"`
-	Metadata    PackageMetadata `toml:"metadata"`
+	Name        string          `toml:"name" json:"name"`
+	Version     string          `toml:"version" json:"version"`
+	Authors     []string        `toml:"authors" json:"authors"`
+	Description string          `toml:"description" json:"description"`
+	License     string          `toml:"license" json:"license"`
+	Repository  string          `toml:"repository" json:"repository"`
+	Homepage    string          `toml:"homepage,omitempty" json:"homepage,omitempty"`
+	Keywords    []string        `toml:"keywords" json:"keywords"`
+	Metadata    PackageMetadata `toml:"metadata" json:"metadata"`
+	// Changelog is the path of the changelog inside the package, or the URL
+	// of one
+	Changelog string `toml:"changelog,omitempty" json:"changelog,omitempty"`
+	// Categories are the registry categories the package is listed under
+	Categories []string `toml:"categories,omitempty" json:"categories,omitempty"`
+	// Carrion constrains the Carrion language versions the package runs
+	// on, e.g. ">=0.5.0"
+	Carrion string `toml:"carrion,omitempty" json:"carrion,omitempty"`
 }
 
 type PackageMetadata struct {
-	Main    string   `toml:"main"`
-	Include []string `toml:"include"`
-	Exclude []string `toml:"exclude"`
+	Main    string   `toml:"main" json:"main"`
+	Include []string `toml:"include" json:"include"`
+	Exclude []string `toml:"exclude" json:"exclude"`
 }
 
 func Load(path string) (*Manifest, error) {
-	var m Manifest
-	if _, err := toml.DecodeFile(path, &m); err != nil {
+	var raw rawManifest
+	if _, err := toml.DecodeFile(path, &raw); err != nil {
 		return nil, err
 	}
-	return &m, nil
+
+	m := &Manifest{Package: raw.Package, Scripts: raw.Scripts, Bin: raw.Bin, Lint: raw.Lint}
+	var err error
+	if m.Dependencies, err = m.parseDependencies(raw.Dependencies, "dependencies"); err != nil {
+		return nil, err
+	}
+	if m.DevDependencies, err = m.parseDependencies(raw.DevDependencies, "dev-dependencies"); err != nil {
+		return nil, err
+	}
+	for name, rp := range raw.Profile {
+		if err := validateNamePart("profile name", name, name); err != nil {
+			return nil, err
+		}
+		// Profile aliases are kept apart from the project's until the
+		// profile is selected
+		aliases := &Manifest{}
+		deps, err := aliases.parseDependencies(rp.Dependencies, "profile."+name+".dependencies")
+		if err != nil {
+			return nil, err
+		}
+		if m.Profiles == nil {
+			m.Profiles = make(map[string]*Profile)
+		}
+		m.Profiles[name] = &Profile{Dependencies: deps, Aliases: aliases.Aliases, Registry: rp.Registry}
+	}
+	return m, nil
+}
+
+// WithProfile returns the manifest as seen with the profile called name
+// selected: its dependencies added to the project's, replacing those of
+// the same name. An empty name returns m itself.
+func (m *Manifest) WithProfile(name string) (*Manifest, error) {
+	if name == "" {
+		return m, nil
+	}
+	p, ok := m.Profiles[name]
+	if !ok {
+		if len(m.Profiles) == 0 {
+			return nil, fmt.Errorf("profile %q is not declared in %s, which has no [profile.<name>] tables", name, FileName)
+		}
+		names := make([]string, 0, len(m.Profiles))
+		for n := range m.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("profile %q is not declared in %s (profiles: %s)", name, FileName, strings.Join(names, ", "))
+	}
+
+	merged := *m
+	merged.Dependencies = make(map[string]string, len(m.Dependencies)+len(p.Dependencies))
+	merged.Aliases = make(map[string]string, len(m.Aliases)+len(p.Aliases))
+	for dep, constraint := range m.Dependencies {
+		merged.Dependencies[dep] = constraint
+	}
+	for dep, pkg := range m.Aliases {
+		merged.Aliases[dep] = pkg
+	}
+	for dep, constraint := range p.Dependencies {
+		merged.Dependencies[dep] = constraint
+		delete(merged.Aliases, dep)
+		if pkg, ok := p.Aliases[dep]; ok {
+			merged.Aliases[dep] = pkg
+		}
+	}
+	return &merged, nil
+}
+
+// parseDependencies converts a dependency table, recording aliases in m
+func (m *Manifest) parseDependencies(raw map[string]any, table string) (map[string]string, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	deps := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch v := value.(type) {
+		case string:
+			deps[name] = v
+		case map[string]any:
+			pkg, _ := v["package"].(string)
+			if pkg == "" {
+				return nil, fmt.Errorf("%s.%s: alias needs a package name, e.g. { package = \"json-utils\", version = \"^2.0.0\" }", table, name)
+			}
+			constraint, ok := v["version"].(string)
+			if !ok {
+				return nil, fmt.Errorf("%s.%s: alias of %s needs a version", table, name, pkg)
+			}
+			for key := range v {
+				if key != "package" && key != "version" {
+					return nil, fmt.Errorf("%s.%s: unknown key %q", table, name, key)
+				}
+			}
+			if m.Aliases == nil {
+				m.Aliases = make(map[string]string)
+			}
+			m.Aliases[name] = pkg
+			deps[name] = constraint
+		default:
+			return nil, fmt.Errorf("%s.%s: expected a version string or an alias table", table, name)
+		}
+	}
+	return deps, nil
+}
+
+// Find returns the path of the nearest manifest in startDir or one of its
+// parent directories
+func Find(startDir string) (string, error) {
+	dir, err := filepath.Abs(startDir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		candidate := filepath.Join(dir, FileName)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no %s found in %s or any parent directory", FileName, startDir)
+		}
+		dir = parent
+	}
+}
+
+// Save writes the manifest to path as TOML, replacing the file. Comments and
+// formatting of an existing file are lost; EditFile changes one in place.
+func (m *Manifest) Save(path string) error {
+	raw := rawManifest{
+		Package:         m.Package,
+		Dependencies:    m.rawDependencies(m.Dependencies),
+		DevDependencies: m.rawDependencies(m.DevDependencies),
+		Scripts:         m.Scripts,
+		Bin:             m.Bin,
+		Lint:            m.Lint,
+	}
+	for name, p := range m.Profiles {
+		if raw.Profile == nil {
+			raw.Profile = make(map[string]rawProfile)
+		}
+		aliases := &Manifest{Aliases: p.Aliases}
+		raw.Profile[name] = rawProfile{Registry: p.Registry, Dependencies: aliases.rawDependencies(p.Dependencies)}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return toml.NewEncoder(f).Encode(raw)
+}
+
+// rawDependencies writes aliased dependencies back as alias tables
+func (m *Manifest) rawDependencies(deps map[string]string) map[string]any {
+	raw := make(map[string]any, len(deps))
+	for name, constraint := range deps {
+		if pkg, ok := m.Aliases[name]; ok {
+			raw[name] = map[string]string{"package": pkg, "version": constraint}
+		} else {
+			raw[name] = constraint
+		}
+	}
+	return raw
 }
 
 func WriteDefault(path string, packageName string, versionNumber string) error {
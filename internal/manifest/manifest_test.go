@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -262,6 +263,7 @@ func TestManifestRoundTrip(t *testing.T) {
 			Description: "Testing round-trip encoding/decoding",
 			License:     "Apache-2.0",
 			Repository:  "https://github.com/test/roundtrip",
+			Homepage:    "https://roundtrip.example.com",
 			Keywords:    []string{"test", "roundtrip", "toml"},
 			Metadata: PackageMetadata{
 				Main:    "lib/index.crl",
@@ -294,6 +296,7 @@ authors = ["First Author", "Second Author"]
 description = "Testing round-trip encoding/decoding"
 license = "Apache-2.0"
 repository = "https://github.com/test/roundtrip"
+homepage = "https://roundtrip.example.com"
 keywords = ["test", "roundtrip", "toml"]
 
 [package.metadata]
@@ -339,6 +342,7 @@ func compareManifests(a, b *Manifest) bool {
 		a.Package.Description != b.Package.Description ||
 		a.Package.License != b.Package.License ||
 		a.Package.Repository != b.Package.Repository ||
+		a.Package.Homepage != b.Package.Homepage ||
 		a.Package.Metadata.Main != b.Package.Metadata.Main {
 		return false
 	}
@@ -371,3 +375,274 @@ func compareMaps(a, b map[string]string) bool {
 	}
 	return true
 }
+
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "src", "lib")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("failed to create dirs: %v", err)
+	}
+
+	if _, err := Find(nested); err == nil {
+		t.Error("expected an error when no manifest exists")
+	}
+
+	manifestPath := filepath.Join(root, FileName)
+	if err := WriteDefault(manifestPath, "app", ""); err != nil {
+		t.Fatalf("WriteDefault() error = %v", err)
+	}
+
+	got, err := Find(nested)
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if got != manifestPath {
+		t.Errorf("Find() = %s, want %s", got, manifestPath)
+	}
+}
+
+func TestLoad_Aliases(t *testing.T) {
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		name        string
+		deps        string
+		wantDeps    map[string]string
+		wantAliases map[string]string
+		wantErr     bool
+	}{
+		{
+			name: "two majors side by side",
+			deps: `json-utils = "^1.0.0"
+json2 = { package = "json-utils", version = "^2.0.0" }`,
+			wantDeps:    map[string]string{"json-utils": "^1.0.0", "json2": "^2.0.0"},
+			wantAliases: map[string]string{"json2": "json-utils"},
+		},
+		{
+			name:    "missing package",
+			deps:    `json2 = { version = "^2.0.0" }`,
+			wantErr: true,
+		},
+		{
+			name:    "missing version",
+			deps:    `json2 = { package = "json-utils" }`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown key",
+			deps:    `json2 = { package = "json-utils", version = "^2.0.0", git = "x" }`,
+			wantErr: true,
+		},
+		{
+			name:    "wrong type",
+			deps:    `json2 = 2`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tempDir, "Bifrost.toml")
+			content := "[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\n" + tt.deps + "\n"
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got.Dependencies, tt.wantDeps) {
+				t.Errorf("Dependencies = %v, want %v", got.Dependencies, tt.wantDeps)
+			}
+			if !reflect.DeepEqual(got.Aliases, tt.wantAliases) {
+				t.Errorf("Aliases = %v, want %v", got.Aliases, tt.wantAliases)
+			}
+			if got.PackageName("json2") != "json-utils" || got.PackageName("json-utils") != "json-utils" {
+				t.Errorf("PackageName() does not follow aliases")
+			}
+
+			// Aliases survive a save and reload
+			if err := got.Save(path); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			reloaded, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load() after Save() error = %v", err)
+			}
+			if !reflect.DeepEqual(reloaded.Aliases, tt.wantAliases) || !reflect.DeepEqual(reloaded.Dependencies, tt.wantDeps) {
+				t.Errorf("after Save(): %v %v", reloaded.Dependencies, reloaded.Aliases)
+			}
+		})
+	}
+}
+
+func TestLoad_Scripts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Bifrost.toml")
+	content := `[package]
+name = "json-utils"
+version = "1.0.0"
+
+[scripts]
+postinstall = "carrion build.crl"
+preinstall = "carrion check.crl"
+test = "carrion test"
+
+[bin]
+json-fmt = "bin/json-fmt.crl"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+
+	m, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got, want := m.InstallScripts(), []string{"preinstall", "postinstall"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("InstallScripts() = %v, want %v", got, want)
+	}
+	if m.Bin["json-fmt"] != "bin/json-fmt.crl" {
+		t.Errorf("Bin = %v", m.Bin)
+	}
+
+	if err := m.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	saved, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() after Save() error = %v", err)
+	}
+	if !reflect.DeepEqual(saved.Scripts, m.Scripts) || !reflect.DeepEqual(saved.Bin, m.Bin) {
+		t.Errorf("round trip = %v %v, want %v %v", saved.Scripts, saved.Bin, m.Scripts, m.Bin)
+	}
+}
+
+func TestLoad_Lint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Bifrost.toml")
+	content := `[package]
+name = "json-utils"
+version = "1.0.0"
+
+[lint]
+allow = ["missing-keywords", "large-file"]
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+
+	m, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := &Lint{Allow: []string{"missing-keywords", "large-file"}}
+	if !reflect.DeepEqual(m.Lint, want) {
+		t.Errorf("Lint = %+v, want %+v", m.Lint, want)
+	}
+
+	if err := m.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	saved, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() after Save() error = %v", err)
+	}
+	if !reflect.DeepEqual(saved.Lint, want) {
+		t.Errorf("round trip Lint = %+v, want %+v", saved.Lint, want)
+	}
+
+	// Manifests without a [lint] table are saved without one
+	m.Lint = nil
+	if err := m.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "[lint]") {
+		t.Errorf("saved manifest has an empty [lint] table:\n%s", data)
+	}
+}
+
+func TestLoad_Profiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Bifrost.toml")
+	content := `[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+json-utils = "^1.0.0"
+payments = "^2.0.0"
+
+[profile.dev]
+registry = "https://staging.example.com"
+
+[profile.dev.dependencies]
+payments = { package = "payments-mock", version = "^1.0.0" }
+
+[profile.prod.dependencies]
+metrics = "^3.0.0"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+
+	m, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(m.Aliases) != 0 {
+		t.Errorf("Aliases = %v, want profile aliases kept apart", m.Aliases)
+	}
+	if dev := m.Profiles["dev"]; dev == nil || dev.Registry != "https://staging.example.com" || dev.Aliases["payments"] != "payments-mock" {
+		t.Errorf("dev profile = %+v", dev)
+	}
+
+	dev, err := m.WithProfile("dev")
+	if err != nil {
+		t.Fatalf("WithProfile(dev) error = %v", err)
+	}
+	if want := map[string]string{"json-utils": "^1.0.0", "payments": "^1.0.0"}; !reflect.DeepEqual(dev.Dependencies, want) {
+		t.Errorf("dev Dependencies = %v, want %v", dev.Dependencies, want)
+	}
+	if dev.PackageName("payments") != "payments-mock" {
+		t.Errorf("dev installs payments from %s, want payments-mock", dev.PackageName("payments"))
+	}
+	prod, err := m.WithProfile("prod")
+	if err != nil {
+		t.Fatalf("WithProfile(prod) error = %v", err)
+	}
+	if want := map[string]string{"json-utils": "^1.0.0", "payments": "^2.0.0", "metrics": "^3.0.0"}; !reflect.DeepEqual(prod.Dependencies, want) {
+		t.Errorf("prod Dependencies = %v, want %v", prod.Dependencies, want)
+	}
+	if prod.PackageName("payments") != "payments" {
+		t.Errorf("prod installs payments from %s", prod.PackageName("payments"))
+	}
+	// Each profile is locked on its own
+	if dev.DependencyHash() == prod.DependencyHash() || dev.DependencyHash() == m.DependencyHash() {
+		t.Error("profiles share a dependency hash")
+	}
+	if len(m.Dependencies) != 2 {
+		t.Errorf("WithProfile() changed the project's dependencies: %v", m.Dependencies)
+	}
+
+	if _, err := m.WithProfile("staging"); err == nil || !strings.Contains(err.Error(), "dev, prod") {
+		t.Errorf("WithProfile(staging) error = %v, want the declared profiles listed", err)
+	}
+
+	if err := m.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	saved, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() after Save() error = %v", err)
+	}
+	if !reflect.DeepEqual(saved.Profiles, m.Profiles) {
+		t.Errorf("round trip Profiles = %+v, want %+v", saved.Profiles, m.Profiles)
+	}
+
+	os.WriteFile(path, []byte("[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[profile.Prod.dependencies]\nmetrics = \"^3.0.0\"\n"), 0644)
+	if _, err := Load(path); err == nil {
+		t.Error("Load() accepted an invalid profile name")
+	}
+}
@@ -0,0 +1,143 @@
+package manifest
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/version"
+)
+
+// MaxNameLength is the longest package name accepted
+const MaxNameLength = 64
+
+// reservedNames cannot be used as package names, either because they clash
+// with Carrion and Bifrost themselves or because Windows refuses to create
+// files with those names
+var reservedNames = map[string]bool{
+	"bifrost": true, "carrion": true, "carrion_modules": true, "std": true, "stdlib": true,
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true, "com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true, "lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+var versionRegex = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)$`)
+
+// ValidateName checks that name can be used as a package or dependency name.
+// Names are used unescaped in install paths and registry URLs, so they are
+// limited to lowercase ASCII letters, digits, "-" and "_", must start with a
+// letter and must not end with a separator. A name may belong to a scope, as
+// in "@acme/utils", where the scope follows the same rules.
+func ValidateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("package name is empty")
+	}
+	if len(name) > MaxNameLength {
+		return fmt.Errorf("invalid package name %q: longer than %d characters", name, MaxNameLength)
+	}
+	if strings.HasPrefix(name, "@") {
+		scope, bare, ok := strings.Cut(name[1:], "/")
+		if !ok || scope == "" || bare == "" {
+			return fmt.Errorf("invalid package name %q: scoped names look like @scope/name", name)
+		}
+		if err := validateNamePart("package name", name, scope); err != nil {
+			return err
+		}
+		return validateNamePart("package name", name, bare)
+	}
+	return validateNamePart("package name", name, name)
+}
+
+// ValidateScope checks that scope, such as "@acme", can prefix package names
+func ValidateScope(scope string) error {
+	name, ok := strings.CutPrefix(scope, "@")
+	if !ok || name == "" {
+		return fmt.Errorf("invalid scope %q: scopes look like @name", scope)
+	}
+	return validateNamePart("scope", scope, name)
+}
+
+// validateNamePart checks part, the whole of name or one half of a scoped
+// name. what says what name is in errors.
+func validateNamePart(what, name, part string) error {
+	if part[0] < 'a' || part[0] > 'z' {
+		return fmt.Errorf("invalid %s %q: must start with a lowercase letter", what, name)
+	}
+	for _, r := range part {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+		case r >= 'A' && r <= 'Z':
+			return fmt.Errorf("invalid %s %q: must be lowercase (try %q)", what, name, strings.ToLower(name))
+		default:
+			return fmt.Errorf("invalid %s %q: %q is not allowed, use lowercase letters, digits, '-' and '_'", what, name, r)
+		}
+	}
+	if last := part[len(part)-1]; last == '-' || last == '_' {
+		return fmt.Errorf("invalid %s %q: must not end with %q", what, name, last)
+	}
+	if reservedNames[part] {
+		return fmt.Errorf("invalid %s %q: the name is reserved", what, name)
+	}
+	return nil
+}
+
+// Scope returns the scope of a name such as "@acme/utils", or "" for a name
+// without one
+func Scope(name string) string {
+	if !strings.HasPrefix(name, "@") {
+		return ""
+	}
+	scope, _, ok := strings.Cut(name, "/")
+	if !ok {
+		return ""
+	}
+	return scope
+}
+
+// ValidateVersion checks that v is a release version of the form
+// MAJOR.MINOR.PATCH, without a "v" prefix or leading zeros
+func ValidateVersion(v string) error {
+	if !versionRegex.MatchString(v) {
+		return fmt.Errorf("invalid version %q: must be MAJOR.MINOR.PATCH, e.g. 1.0.0", v)
+	}
+	return nil
+}
+
+// Validate checks the package name and version and every dependency name
+func (m *Manifest) Validate() error {
+	if err := ValidateName(m.Package.Name); err != nil {
+		return fmt.Errorf("package.name: %w", err)
+	}
+	if err := ValidateVersion(m.Package.Version); err != nil {
+		return fmt.Errorf("package.version: %w", err)
+	}
+	if m.Package.Carrion != "" {
+		if _, err := version.ParseConstraint(m.Package.Carrion); err != nil {
+			return fmt.Errorf("package.carrion: %w", err)
+		}
+	}
+	tables := []struct {
+		name string
+		deps map[string]string
+	}{{"dependencies", m.Dependencies}, {"dev-dependencies", m.DevDependencies}}
+	for _, table := range tables {
+		names := make([]string, 0, len(table.deps))
+		for name := range table.deps {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if err := ValidateName(name); err != nil {
+				return fmt.Errorf("%s: %w", table.name, err)
+			}
+			if pkg := m.PackageName(name); pkg != name {
+				if err := ValidateName(pkg); err != nil {
+					return fmt.Errorf("%s.%s: %w", table.name, name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
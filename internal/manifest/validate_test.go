@@ -0,0 +1,128 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"json-utils", false},
+		{"http_client2", false},
+		{"a", false},
+		{"", true},
+		{"Json-Utils", true},
+		{"2fast", true},
+		{"-utils", true},
+		{"utils-", true},
+		{"json.utils", true},
+		{"json/utils", true},
+		{"../escape", true},
+		{"json utils", true},
+		{"jsön", true},
+		{"carrion", true},
+		{"con", true},
+		{"@acme/utils", false},
+		{"@acme-corp/http_client", false},
+		{"@acme", true},
+		{"@acme/", true},
+		{"@/utils", true},
+		{"@Acme/utils", true},
+		{"@acme/utils/extra", true},
+		{"@acme/../escape", true},
+		{"@2acme/utils", true},
+		{"@acme/con", true},
+		{strings.Repeat("a", MaxNameLength), false},
+		{strings.Repeat("a", MaxNameLength+1), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateName(tt.name); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScope(t *testing.T) {
+	tests := map[string]string{
+		"@acme/utils": "@acme",
+		"utils":       "",
+		"@acme":       "",
+	}
+	for name, want := range tests {
+		if got := Scope(name); got != want {
+			t.Errorf("Scope(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestValidateScope(t *testing.T) {
+	for scope, wantErr := range map[string]bool{"@acme": false, "@acme-corp": false, "acme": true, "@": true, "@Acme": true, "@acme/utils": true} {
+		if err := ValidateScope(scope); (err != nil) != wantErr {
+			t.Errorf("ValidateScope(%q) error = %v, wantErr %v", scope, err, wantErr)
+		}
+	}
+}
+
+func TestValidateVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		wantErr bool
+	}{
+		{"0.1.0", false},
+		{"10.20.30", false},
+		{"v1.0.0", true},
+		{"1.0", true},
+		{"01.0.0", true},
+		{"1.0.0-beta", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			if err := ValidateVersion(tt.version); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateVersion(%q) error = %v, wantErr %v", tt.version, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManifest_Validate(t *testing.T) {
+	valid := func() *Manifest {
+		return &Manifest{
+			Package:      Package{Name: "app", Version: "1.0.0"},
+			Dependencies: map[string]string{"json-utils": "^1.0.0"},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(m *Manifest)
+		wantErr bool
+	}{
+		{"valid", func(m *Manifest) {}, false},
+		{"bad name", func(m *Manifest) { m.Package.Name = "My App" }, true},
+		{"bad version", func(m *Manifest) { m.Package.Version = "1.0" }, true},
+		{"bad dependency", func(m *Manifest) { m.Dependencies["Json"] = "^1.0.0" }, true},
+		{"bad dev dependency", func(m *Manifest) { m.DevDependencies = map[string]string{"x/y": "1.0.0"} }, true},
+		{"bad alias target", func(m *Manifest) {
+			m.Dependencies["json2"] = "^2.0.0"
+			m.Aliases = map[string]string{"json2": "Json-Utils"}
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := valid()
+			tt.modify(m)
+			if err := m.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
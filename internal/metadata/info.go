@@ -0,0 +1,143 @@
+package metadata
+
+import (
+	"fmt"
+
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/manifest"
+	ver "github.com/javanhut/bifrost/internal/version"
+)
+
+// Install statuses of a dependency
+const (
+	// StatusInstalled is a dependency installed at its locked version, or
+	// at a version its constraint allows when it is not locked
+	StatusInstalled = "installed"
+	// StatusMissing is a dependency installed at no version
+	StatusMissing = "missing"
+	// StatusMismatched is a dependency installed only at a version other
+	// than the locked one, or one its constraint does not allow
+	StatusMismatched = "mismatched"
+)
+
+// Info is the consolidated view of a project `bifrost info --json` prints
+// for dashboards
+type Info struct {
+	FormatVersion int                `json:"format_version"`
+	Package       manifest.Package   `json:"package"`
+	ManifestPath  string             `json:"manifest_path"`
+	LockfilePath  string             `json:"lockfile_path,omitempty"`
+	Dependencies  []DependencyStatus `json:"dependencies"`
+	Scripts       map[string]string  `json:"scripts"`
+	Registries    []Registry         `json:"registries"`
+}
+
+// DependencyStatus is a declared or locked dependency with the version it
+// resolved to and how it is installed
+type DependencyStatus struct {
+	Name string `json:"name"`
+	// Package is the registry package when Name is an alias
+	Package    string `json:"package,omitempty"`
+	Constraint string `json:"constraint,omitempty"`
+	Dev        bool   `json:"dev,omitempty"`
+	// Locked is the version the lockfile resolved the dependency to
+	Locked string `json:"locked,omitempty"`
+	// Installed is the version found installed, if any
+	Installed string `json:"installed,omitempty"`
+	Status    string `json:"status"`
+	// Source is the registry or archive the locked version came from
+	Source string `json:"source,omitempty"`
+	Scope  string `json:"scope,omitempty"`
+	Path   string `json:"path,omitempty"`
+}
+
+// Registry is a configured registry, without its credentials
+type Registry struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// CollectInfo describes the project whose manifest is at manifestPath and
+// the install status of each of its dependencies
+func CollectInfo(cfg *config.Config, manifestPath string) (*Info, error) {
+	md, err := Collect(cfg, manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	registries, err := cfg.GetRegistries()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load registries: %w", err)
+	}
+
+	info := &Info{
+		FormatVersion: FormatVersion,
+		Package:       md.Manifest.Package,
+		ManifestPath:  md.ManifestPath,
+		LockfilePath:  md.LockfilePath,
+		Dependencies:  []DependencyStatus{},
+		Scripts:       md.Manifest.Scripts,
+		Registries:    []Registry{},
+	}
+	if info.Scripts == nil {
+		info.Scripts = map[string]string{}
+	}
+	for _, r := range registries {
+		info.Registries = append(info.Registries, Registry{Name: r.Name, URL: r.URL})
+	}
+
+	for _, dep := range md.Dependencies {
+		s := DependencyStatus{
+			Name:       dep.Name,
+			Constraint: dep.Constraint,
+			Dev:        dep.Dev,
+			Locked:     dep.Locked,
+			Installed:  dep.Version,
+			Scope:      dep.Scope,
+			Path:       dep.Path,
+			Status:     StatusInstalled,
+		}
+		if pkg := md.Manifest.PackageName(dep.Name); pkg != dep.Name {
+			s.Package = pkg
+		}
+		if md.Lockfile != nil {
+			if locked := md.Lockfile.Find(dep.Name); locked != nil {
+				s.Source = locked.Source
+			}
+		}
+
+		switch {
+		case !dep.Installed && dep.Locked != "":
+			// The locked version is not installed; look for any other
+			probe := Dependency{Name: dep.Name}
+			locate(cfg, md.ProjectRoot, &probe)
+			s.Status = StatusMissing
+			if probe.Installed {
+				s.Status = StatusMismatched
+				s.Installed, s.Scope, s.Path = probe.Version, probe.Scope, probe.Path
+			}
+		case !dep.Installed:
+			s.Status = StatusMissing
+		case dep.Locked == "" && !allows(dep.Constraint, dep.Version):
+			s.Status = StatusMismatched
+		}
+		info.Dependencies = append(info.Dependencies, s)
+	}
+	return info, nil
+}
+
+// allows reports whether constraint admits version. Anything that does not
+// parse is given the benefit of the doubt.
+func allows(constraint, version string) bool {
+	if constraint == "" {
+		return true
+	}
+	c, err := ver.ParseConstraint(constraint)
+	if err != nil {
+		return true
+	}
+	v, err := ver.Parse(version)
+	if err != nil {
+		return true
+	}
+	return c.Satisfies(v)
+}
@@ -0,0 +1,223 @@
+// Package metadata assembles a complete, read-only description of a project
+// for editors and language servers. Collecting it never touches the network.
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/manifest"
+	ver "github.com/javanhut/bifrost/internal/version"
+)
+
+// FormatVersion is the version of the metadata document layout
+const FormatVersion = 1
+
+// Installation scopes a package can be found in
+const (
+	ScopeLocal  = "local"
+	ScopeUser   = "user"
+	ScopeGlobal = "global"
+)
+
+// Metadata is the project model emitted by `bifrost metadata`
+type Metadata struct {
+	FormatVersion int                `json:"format_version"`
+	ProjectRoot   string             `json:"project_root"`
+	ManifestPath  string             `json:"manifest_path"`
+	Manifest      *manifest.Manifest `json:"manifest"`
+	LockfilePath  string             `json:"lockfile_path,omitempty"`
+	Lockfile      *lockfile.Lockfile `json:"lockfile,omitempty"`
+	// LockfileOutOfDate is set when the dependencies in the manifest changed
+	// since the lockfile was written. Its versions no longer apply, so
+	// Lockfile is left empty.
+	LockfileOutOfDate bool         `json:"lockfile_out_of_date,omitempty"`
+	ImportPaths       []string     `json:"import_paths"`
+	Dependencies      []Dependency `json:"dependencies"`
+	Directories       Directories  `json:"directories"`
+}
+
+// Dependency describes a declared or locked dependency and where it lives
+type Dependency struct {
+	Name       string `json:"name"`
+	Constraint string `json:"constraint,omitempty"`
+	Dev        bool   `json:"dev,omitempty"`
+	Locked     string `json:"locked,omitempty"`
+	// Version is the installed version imports will use, if any
+	Version   string `json:"version,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Installed bool   `json:"installed"`
+}
+
+// Directories lists the package locations bifrost searches
+type Directories struct {
+	Home    string `json:"home"`
+	Modules string `json:"modules"`
+	User    string `json:"user"`
+	Global  string `json:"global"`
+	Cache   string `json:"cache"`
+}
+
+// Collect describes the project whose manifest is at manifestPath
+func Collect(cfg *config.Config, manifestPath string) (*Metadata, error) {
+	manifestPath, err := filepath.Abs(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	m, err := manifest.Load(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifest: %w", err)
+	}
+	if m, err = m.WithProfile(cfg.Profile); err != nil {
+		return nil, err
+	}
+
+	root := filepath.Dir(manifestPath)
+	md := &Metadata{
+		FormatVersion: FormatVersion,
+		ProjectRoot:   root,
+		ManifestPath:  manifestPath,
+		Manifest:      m,
+		ImportPaths:   cfg.GetImportPaths(root),
+		Dependencies:  []Dependency{},
+		Directories: Directories{
+			Home:    cfg.HomeDir,
+			Modules: ModulesDir(cfg, root),
+			User:    cfg.PackagesDir,
+			Global:  cfg.GetSharedGlobalPackagesDir(),
+			Cache:   cfg.CacheDir,
+		},
+	}
+
+	lockPath := filepath.Join(root, lockfile.FileNameFor(cfg.Profile))
+	lock, err := lockfile.LoadCurrent(lockPath, m)
+	if errors.Is(err, lockfile.ErrOutOfDate) {
+		md.LockfilePath = lockPath
+		md.LockfileOutOfDate = true
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load lockfile: %w", err)
+	}
+	if lock != nil {
+		md.LockfilePath = lockPath
+		md.Lockfile = lock
+	}
+
+	seen := make(map[string]bool)
+	add := func(name, constraint string, dev bool) {
+		seen[name] = true
+		dep := Dependency{Name: name, Constraint: constraint, Dev: dev}
+		if lock != nil {
+			if locked := lock.Find(name); locked != nil {
+				dep.Locked = locked.Version
+			}
+		}
+		locate(cfg, root, &dep)
+		md.Dependencies = append(md.Dependencies, dep)
+	}
+
+	for _, name := range sortedKeys(m.Dependencies) {
+		add(name, m.Dependencies[name], false)
+	}
+	for _, name := range sortedKeys(m.DevDependencies) {
+		add(name, m.DevDependencies[name], true)
+	}
+	// Transitive dependencies are only known through the lockfile
+	if lock != nil {
+		for _, locked := range lock.Packages {
+			if !seen[locked.Name] {
+				add(locked.Name, "", false)
+			}
+		}
+	}
+
+	return md, nil
+}
+
+// ModulesDir returns the project modules directory for a project rooted at root
+func ModulesDir(cfg *config.Config, root string) string {
+	return cfg.ProjectModulesDir(root)
+}
+
+// locate fills in where dep is installed, preferring the locked version and
+// searching locations in import resolution order
+func locate(cfg *config.Config, root string, dep *Dependency) {
+	locations := []struct {
+		scope string
+		dir   string
+	}{
+		{ScopeLocal, ModulesDir(cfg, root)},
+		{ScopeUser, cfg.PackagesDir},
+		{ScopeGlobal, cfg.GetSharedGlobalPackagesDir()},
+	}
+
+	for _, loc := range locations {
+		packageDir := filepath.Join(loc.dir, dep.Name)
+		if loc.scope == ScopeLocal && cfg.Layout == config.LayoutFlat {
+			if version := config.FlatVersion(packageDir); version != "" && (dep.Locked == "" || dep.Locked == version) {
+				dep.Version = version
+				dep.Scope = loc.scope
+				dep.Path = packageDir
+				dep.Installed = true
+				return
+			}
+			continue
+		}
+		version := dep.Locked
+		if version == "" {
+			version = newestVersion(packageDir)
+		}
+		if version == "" {
+			continue
+		}
+
+		path := filepath.Join(packageDir, version)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			dep.Version = version
+			dep.Scope = loc.scope
+			dep.Path = path
+			dep.Installed = true
+			return
+		}
+	}
+}
+
+// newestVersion returns the highest semantic version directory in packageDir
+func newestVersion(packageDir string) string {
+	entries, err := os.ReadDir(packageDir)
+	if err != nil {
+		return ""
+	}
+
+	var newest *ver.Version
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		v, err := ver.Parse(entry.Name())
+		if err != nil {
+			continue
+		}
+		if newest == nil || v.Compare(newest) > 0 {
+			newest = v
+		}
+	}
+	if newest == nil {
+		return ""
+	}
+	return newest.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,162 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/lockfile"
+)
+
+func TestCollect(t *testing.T) {
+	home := t.TempDir()
+	cfg := config.NewWithHome(home)
+	if err := cfg.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	root := t.TempDir()
+	manifestPath := filepath.Join(root, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte(`[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+json-utils = "^1.0.0"
+http-client = "^2.0.0"
+
+[dev-dependencies]
+test-kit = "^0.1.0"
+`), 0644)
+
+	lock := lockfile.New()
+	lock.Set(lockfile.Package{Name: "json-utils", Version: "1.2.0"})
+	lock.Set(lockfile.Package{Name: "text-utils", Version: "0.5.0"})
+	if err := lock.Save(filepath.Join(root, lockfile.FileName)); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// json-utils has a stale version locally plus the locked one; http-client
+	// is only installed for the user
+	os.MkdirAll(filepath.Join(root, "carrion_modules", "json-utils", "1.1.0"), 0755)
+	os.MkdirAll(filepath.Join(root, "carrion_modules", "json-utils", "1.2.0"), 0755)
+	os.MkdirAll(filepath.Join(cfg.PackagesDir, "http-client", "2.0.0"), 0755)
+	os.MkdirAll(filepath.Join(cfg.PackagesDir, "http-client", "2.3.1"), 0755)
+
+	md, err := Collect(cfg, manifestPath)
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	if md.ProjectRoot != root || md.Lockfile == nil {
+		t.Fatalf("unexpected metadata header: root=%s lockfile=%v", md.ProjectRoot, md.Lockfile)
+	}
+	if md.Directories.Modules != filepath.Join(root, "carrion_modules") {
+		t.Errorf("Modules = %s", md.Directories.Modules)
+	}
+
+	deps := make(map[string]Dependency)
+	for _, dep := range md.Dependencies {
+		deps[dep.Name] = dep
+	}
+	if len(deps) != 4 {
+		t.Fatalf("expected 4 dependencies, got %+v", md.Dependencies)
+	}
+
+	if d := deps["json-utils"]; d.Version != "1.2.0" || d.Scope != ScopeLocal || !d.Installed {
+		t.Errorf("json-utils = %+v, want locked local 1.2.0", d)
+	}
+	if d := deps["http-client"]; d.Version != "2.3.1" || d.Scope != ScopeUser {
+		t.Errorf("http-client = %+v, want newest user version 2.3.1", d)
+	}
+	if d := deps["test-kit"]; !d.Dev || d.Installed {
+		t.Errorf("test-kit = %+v, want missing dev dependency", d)
+	}
+	if d := deps["text-utils"]; d.Locked != "0.5.0" || d.Constraint != "" || d.Installed {
+		t.Errorf("text-utils = %+v, want transitive locked dependency", d)
+	}
+
+	// A lockfile the dependencies changed since is flagged, not reported
+	lock.ManifestHash = "sha256:0000"
+	if err := lock.Save(filepath.Join(root, lockfile.FileName)); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	md, err = Collect(cfg, manifestPath)
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if !md.LockfileOutOfDate || md.Lockfile != nil || len(md.Dependencies) != 3 {
+		t.Errorf("Collect() with an out of date lockfile = out of date %v, lockfile %v, %d dependencies", md.LockfileOutOfDate, md.Lockfile, len(md.Dependencies))
+	}
+}
+
+func TestCollectInfo(t *testing.T) {
+	cfg := config.NewWithHome(t.TempDir())
+	if err := cfg.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	root := t.TempDir()
+	manifestPath := filepath.Join(root, "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte(`[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+json-utils = "^1.0.0"
+http-client = "^2.0.0"
+text-utils = "^0.5.0"
+fmt = { package = "carrion-fmt", version = "^1.0.0" }
+
+[scripts]
+test = "carrion test"
+`), 0644)
+
+	lock := lockfile.New()
+	lock.Set(lockfile.Package{Name: "json-utils", Version: "1.2.0", Source: "https://registry.test"})
+	lock.Set(lockfile.Package{Name: "http-client", Version: "2.1.0"})
+	if err := lock.Save(filepath.Join(root, lockfile.FileName)); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// json-utils is installed as locked, http-client at another version,
+	// text-utils outside its constraint and fmt not at all
+	os.MkdirAll(filepath.Join(root, "carrion_modules", "json-utils", "1.2.0"), 0755)
+	os.MkdirAll(filepath.Join(root, "carrion_modules", "http-client", "2.0.0"), 0755)
+	os.MkdirAll(filepath.Join(root, "carrion_modules", "text-utils", "0.4.0"), 0755)
+
+	info, err := CollectInfo(cfg, manifestPath)
+	if err != nil {
+		t.Fatalf("CollectInfo() error = %v", err)
+	}
+	if info.Package.Name != "app" || info.Scripts["test"] != "carrion test" || len(info.Registries) == 0 {
+		t.Errorf("CollectInfo() = %+v", info)
+	}
+
+	deps := make(map[string]DependencyStatus)
+	for _, dep := range info.Dependencies {
+		deps[dep.Name] = dep
+	}
+	tests := []struct {
+		name      string
+		status    string
+		installed string
+	}{
+		{"json-utils", StatusInstalled, "1.2.0"},
+		{"http-client", StatusMismatched, "2.0.0"},
+		{"text-utils", StatusMismatched, "0.4.0"},
+		{"fmt", StatusMissing, ""},
+	}
+	for _, tt := range tests {
+		if d := deps[tt.name]; d.Status != tt.status || d.Installed != tt.installed {
+			t.Errorf("%s = %+v, want %s at %q", tt.name, d, tt.status, tt.installed)
+		}
+	}
+	if d := deps["json-utils"]; d.Source != "https://registry.test" || d.Locked != "1.2.0" {
+		t.Errorf("json-utils = %+v, want locked from https://registry.test", d)
+	}
+	if d := deps["fmt"]; d.Package != "carrion-fmt" {
+		t.Errorf("fmt = %+v, want alias of carrion-fmt", d)
+	}
+}
@@ -0,0 +1,479 @@
+package migrate
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/javanhut/bifrost/internal/manifest"
+	"github.com/javanhut/bifrost/internal/version"
+)
+
+// MappingFileName is the mapping file looked up in the imported directory
+// when none is given
+const MappingFileName = "bifrost-import.toml"
+
+// Ecosystem is a package ecosystem dependencies can be imported from
+type Ecosystem string
+
+const (
+	NPM   Ecosystem = "npm"
+	PyPI  Ecosystem = "pypi"
+	Cargo Ecosystem = "cargo"
+)
+
+// sources are the files Import looks for, in order of preference
+var sources = []struct {
+	file      string
+	ecosystem Ecosystem
+}{
+	{"package.json", NPM},
+	{"Cargo.toml", Cargo},
+	{"requirements.txt", PyPI},
+}
+
+// Mapping maps dependency names of each ecosystem to Carrion package names.
+// Mapping a name to "" leaves the dependency out.
+type Mapping map[Ecosystem]map[string]string
+
+// LoadMapping reads a mapping file with one table per ecosystem:
+//
+//	[npm]
+//	lodash = "carrion-utils"
+//
+//	[pypi]
+//	requests = "http-client"
+func LoadMapping(path string) (Mapping, error) {
+	var m Mapping
+	if _, err := toml.DecodeFile(path, &m); err != nil {
+		return nil, fmt.Errorf("failed to load mapping %s: %w", path, err)
+	}
+	for eco := range m {
+		if eco != NPM && eco != PyPI && eco != Cargo {
+			return nil, fmt.Errorf("mapping %s: unknown ecosystem %q (want npm, pypi or cargo)", path, eco)
+		}
+	}
+	return m, nil
+}
+
+// Result is a manifest produced by Import
+type Result struct {
+	Manifest *manifest.Manifest
+	// Source is the file the manifest was imported from
+	Source    string
+	Ecosystem Ecosystem
+	// Unmapped lists dependencies kept under their original name because the
+	// mapping has no entry for them
+	Unmapped []string
+	// Warnings describe dependencies that could not be imported exactly
+	Warnings []string
+}
+
+type dependency struct {
+	name string
+	spec string
+	dev  bool
+	// unversioned is set for path and git dependencies
+	unversioned bool
+}
+
+type source struct {
+	name        string
+	version     string
+	description string
+	license     string
+	authors     []string
+	repository  string
+	keywords    []string
+	deps        []dependency
+}
+
+// Import reads a package.json, Cargo.toml or requirements.txt in dir and
+// converts it into a Bifrost manifest, renaming dependencies through
+// mapping
+func Import(dir string, mapping Mapping) (*Result, error) {
+	for _, s := range sources {
+		path := filepath.Join(dir, s.file)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		var src *source
+		var err error
+		switch s.ecosystem {
+		case NPM:
+			src, err = readPackageJSON(path)
+		case Cargo:
+			src, err = readCargoToml(path)
+		case PyPI:
+			src, err = readRequirements(path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		return convert(src, path, s.ecosystem, mapping[s.ecosystem]), nil
+	}
+	return nil, fmt.Errorf("no package.json, Cargo.toml or requirements.txt found in %s", dir)
+}
+
+func convert(src *source, path string, eco Ecosystem, names map[string]string) *Result {
+	res := &Result{Source: path, Ecosystem: eco}
+
+	name := src.name
+	if name == "" {
+		abs, _ := filepath.Abs(filepath.Dir(path))
+		name = filepath.Base(abs)
+	}
+	pkgVersion := "0.1.0"
+	if v := padVersion(src.version); v != "" {
+		if _, err := version.Parse(v); err == nil {
+			pkgVersion = v
+		}
+	}
+
+	m := &manifest.Manifest{
+		Package: manifest.Package{
+			Name:        normalizeName(name),
+			Version:     pkgVersion,
+			Authors:     src.authors,
+			Description: src.description,
+			License:     src.license,
+			Repository:  src.repository,
+			Keywords:    src.keywords,
+			Metadata: manifest.PackageMetadata{
+				Main: "src/main.crl",
+			},
+		},
+		Dependencies:    map[string]string{},
+		DevDependencies: map[string]string{},
+	}
+
+	for _, dep := range src.deps {
+		target, mapped := names[dep.name]
+		if mapped && target == "" {
+			continue
+		}
+		if !mapped {
+			target = normalizeName(dep.name)
+			res.Unmapped = append(res.Unmapped, dep.name)
+		}
+
+		constraint, ok := convertSpec(eco, dep.spec)
+		if dep.unversioned {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("%s: path or git dependency has no registry version, using any version", dep.name))
+		} else if !ok {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("%s: cannot translate %q, using any version", dep.name, dep.spec))
+		}
+
+		if dep.dev {
+			m.DevDependencies[target] = constraint
+		} else {
+			m.Dependencies[target] = constraint
+		}
+	}
+
+	sort.Strings(res.Unmapped)
+	res.Manifest = m
+	return res
+}
+
+// anyVersion is the constraint used when a dependency accepts any version
+const anyVersion = ">=0.0.0"
+
+// convertSpec translates an ecosystem's version requirement into a Bifrost
+// constraint, reporting false when it had to fall back to any version
+func convertSpec(eco Ecosystem, spec string) (string, bool) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "*" || spec == "latest" {
+		return anyVersion, true
+	}
+
+	var constraint string
+	switch eco {
+	case NPM:
+		constraint = convertNPM(spec)
+	case Cargo:
+		constraint = convertCargo(spec)
+	case PyPI:
+		constraint = convertPyPI(spec)
+	}
+
+	if constraint == "" {
+		return anyVersion, false
+	}
+	if _, err := version.ParseConstraint(constraint); err != nil {
+		return anyVersion, false
+	}
+	return constraint, true
+}
+
+var xRange = regexp.MustCompile(`^(\d+)(?:\.(\d+))?\.[xX*]$|^(\d+)\.[xX*](?:\.[xX*])?$`)
+
+func convertNPM(spec string) string {
+	// "1.x" and "1.2.x" are caret and tilde ranges
+	if m := xRange.FindStringSubmatch(spec); m != nil {
+		if m[3] != "" {
+			return "^" + m[3] + ".0.0"
+		}
+		if m[2] == "" {
+			return "^" + m[1] + ".0.0"
+		}
+		return "~" + m[1] + "." + m[2] + ".0"
+	}
+
+	// ">=1.0.0 <2.0.0" is a range written without a comma
+	if fields := strings.Fields(spec); len(fields) == 2 {
+		return comparison(fields[0]) + ", " + comparison(fields[1])
+	}
+
+	for _, prefix := range []string{"^", "~", "="} {
+		if strings.HasPrefix(spec, prefix) {
+			v := padVersion(strings.TrimPrefix(spec, prefix))
+			if prefix == "=" {
+				return v
+			}
+			return prefix + v
+		}
+	}
+	if strings.HasPrefix(spec, ">") || strings.HasPrefix(spec, "<") {
+		return comparison(spec)
+	}
+	return padVersion(spec)
+}
+
+func convertCargo(spec string) string {
+	if strings.Contains(spec, ",") {
+		parts := strings.Split(spec, ",")
+		for n, p := range parts {
+			parts[n] = comparison(strings.TrimSpace(p))
+		}
+		return strings.Join(parts, ", ")
+	}
+
+	switch {
+	case strings.HasPrefix(spec, "="):
+		return padVersion(strings.TrimPrefix(spec, "="))
+	case strings.HasPrefix(spec, "^"), strings.HasPrefix(spec, "~"):
+		return spec[:1] + padVersion(spec[1:])
+	case strings.HasPrefix(spec, ">"), strings.HasPrefix(spec, "<"):
+		return comparison(spec)
+	}
+	// A bare Cargo version is a caret requirement
+	return "^" + padVersion(spec)
+}
+
+func convertPyPI(spec string) string {
+	var parts []string
+	for _, clause := range strings.Split(spec, ",") {
+		clause = strings.TrimSpace(clause)
+		switch {
+		case strings.HasPrefix(clause, "=="):
+			v := strings.TrimPrefix(clause, "==")
+			if strings.HasSuffix(v, ".*") {
+				// "==1.2.*" allows any 1.2 release
+				base := strings.Split(strings.TrimSuffix(v, ".*"), ".")
+				if len(base) == 1 {
+					return "^" + padVersion(base[0])
+				}
+				return "~" + padVersion(strings.Join(base, "."))
+			}
+			return padVersion(v)
+		case strings.HasPrefix(clause, "~="):
+			// A compatible release may change the second to last component
+			v := strings.TrimPrefix(clause, "~=")
+			if strings.Count(v, ".") == 1 {
+				return "^" + padVersion(v)
+			}
+			return "~" + padVersion(v)
+		case strings.HasPrefix(clause, "!="), strings.HasPrefix(clause, "==="):
+			return ""
+		default:
+			parts = append(parts, comparison(clause))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// comparison pads the version in a comparison such as ">=1.2"
+func comparison(clause string) string {
+	op := strings.TrimRight(clause, "0123456789.vxX*")
+	if len(op) > 2 {
+		return clause
+	}
+	return op + padVersion(strings.TrimSpace(clause[len(op):]))
+}
+
+// padVersion completes a partial version such as "1" or "1.2" to three
+// components
+func padVersion(v string) string {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if v == "" {
+		return ""
+	}
+	for strings.Count(v, ".") < 2 {
+		v += ".0"
+	}
+	return v
+}
+
+// normalizeName lowercases a package name, drops an npm scope and uses
+// hyphens as separators
+func normalizeName(name string) string {
+	if i := strings.LastIndex(name, "/"); i != -1 {
+		name = name[i+1:]
+	}
+	name = strings.ToLower(name)
+	return strings.NewReplacer("_", "-", ".", "-").Replace(name)
+}
+
+func readPackageJSON(path string) (*source, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var pkg struct {
+		Name            string            `json:"name"`
+		Version         string            `json:"version"`
+		Description     string            `json:"description"`
+		License         string            `json:"license"`
+		Keywords        []string          `json:"keywords"`
+		Author          json.RawMessage   `json:"author"`
+		Repository      json.RawMessage   `json:"repository"`
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, err
+	}
+
+	src := &source{
+		name:        pkg.Name,
+		version:     pkg.Version,
+		description: pkg.Description,
+		license:     pkg.License,
+		keywords:    pkg.Keywords,
+	}
+
+	// author and repository are either a string or an object
+	var author struct{ Name, Email string }
+	var authorString string
+	if json.Unmarshal(pkg.Author, &authorString) == nil && authorString != "" {
+		src.authors = []string{authorString}
+	} else if json.Unmarshal(pkg.Author, &author) == nil && author.Name != "" {
+		if author.Email != "" {
+			src.authors = []string{fmt.Sprintf("%s <%s>", author.Name, author.Email)}
+		} else {
+			src.authors = []string{author.Name}
+		}
+	}
+	var repo struct{ URL string }
+	if json.Unmarshal(pkg.Repository, &src.repository) != nil && json.Unmarshal(pkg.Repository, &repo) == nil {
+		src.repository = repo.URL
+	}
+
+	for _, name := range sortedKeys(pkg.Dependencies) {
+		src.deps = append(src.deps, dependency{name: name, spec: pkg.Dependencies[name]})
+	}
+	for _, name := range sortedKeys(pkg.DevDependencies) {
+		src.deps = append(src.deps, dependency{name: name, spec: pkg.DevDependencies[name], dev: true})
+	}
+	return src, nil
+}
+
+func readCargoToml(path string) (*source, error) {
+	var crate struct {
+		Package struct {
+			Name        string   `toml:"name"`
+			Version     string   `toml:"version"`
+			Description string   `toml:"description"`
+			License     string   `toml:"license"`
+			Authors     []string `toml:"authors"`
+			Repository  string   `toml:"repository"`
+			Keywords    []string `toml:"keywords"`
+		} `toml:"package"`
+		Dependencies    map[string]any `toml:"dependencies"`
+		DevDependencies map[string]any `toml:"dev-dependencies"`
+	}
+	if _, err := toml.DecodeFile(path, &crate); err != nil {
+		return nil, err
+	}
+
+	src := &source{
+		name:        crate.Package.Name,
+		version:     crate.Package.Version,
+		description: crate.Package.Description,
+		license:     crate.Package.License,
+		authors:     crate.Package.Authors,
+		repository:  crate.Package.Repository,
+		keywords:    crate.Package.Keywords,
+	}
+
+	// A dependency is either a version string or a table with a version key
+	add := func(deps map[string]any, dev bool) {
+		for _, name := range sortedKeys(deps) {
+			dep := dependency{name: name, dev: dev}
+			switch d := deps[name].(type) {
+			case string:
+				dep.spec = d
+			case map[string]any:
+				dep.spec, _ = d["version"].(string)
+				dep.unversioned = dep.spec == ""
+			}
+			src.deps = append(src.deps, dep)
+		}
+	}
+	add(crate.Dependencies, false)
+	add(crate.DevDependencies, true)
+	return src, nil
+}
+
+var requirement = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*(?:\[[^\]]*\])?\s*(.*)$`)
+
+func readRequirements(path string) (*source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	src := &source{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+		// Drop environment markers such as `; python_version < "3.8"`
+		if i := strings.Index(line, ";"); i != -1 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		// Skip blank lines and options such as -r and --index-url
+		if line == "" || strings.HasPrefix(line, "-") {
+			continue
+		}
+
+		m := requirement.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		src.deps = append(src.deps, dependency{name: m[1], spec: strings.ReplaceAll(m[2], " ", "")})
+	}
+	return src, scanner.Err()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,174 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImport_PackageJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "package.json", `{
+  "name": "@acme/Web_Client",
+  "version": "2.1.0",
+  "description": "A web client",
+  "license": "MIT",
+  "author": {"name": "Ada", "email": "ada@example.com"},
+  "repository": {"type": "git", "url": "https://github.com/acme/web-client"},
+  "dependencies": {
+    "lodash": "^4.17.21",
+    "left-pad": "1.x",
+    "request": ">=2.0.0 <3.0.0",
+    "local": "file:../local"
+  },
+  "devDependencies": {
+    "jest": "~29.1"
+  }
+}`)
+
+	mapping := Mapping{NPM: {"lodash": "carrion-utils", "jest": "appraise", "left-pad": ""}}
+	res, err := Import(dir, mapping)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	m := res.Manifest
+	if m.Package.Name != "web-client" || m.Package.Version != "2.1.0" {
+		t.Errorf("package = %s@%s, want web-client@2.1.0", m.Package.Name, m.Package.Version)
+	}
+	if !reflect.DeepEqual(m.Package.Authors, []string{"Ada <ada@example.com>"}) {
+		t.Errorf("authors = %v", m.Package.Authors)
+	}
+	if m.Package.Repository != "https://github.com/acme/web-client" {
+		t.Errorf("repository = %q", m.Package.Repository)
+	}
+
+	wantDeps := map[string]string{
+		"carrion-utils": "^4.17.21",
+		"request":       ">=2.0.0, <3.0.0",
+		"local":         anyVersion,
+	}
+	if !reflect.DeepEqual(m.Dependencies, wantDeps) {
+		t.Errorf("dependencies = %v, want %v", m.Dependencies, wantDeps)
+	}
+	if !reflect.DeepEqual(m.DevDependencies, map[string]string{"appraise": "~29.1.0"}) {
+		t.Errorf("dev dependencies = %v", m.DevDependencies)
+	}
+	if !reflect.DeepEqual(res.Unmapped, []string{"local", "request"}) {
+		t.Errorf("unmapped = %v", res.Unmapped)
+	}
+	if len(res.Warnings) != 1 {
+		t.Errorf("warnings = %v, want one for the file dependency", res.Warnings)
+	}
+}
+
+func TestImport_CargoToml(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "Cargo.toml", `[package]
+name = "json_utils"
+version = "0.3.1"
+authors = ["Ada <ada@example.com>"]
+
+[dependencies]
+serde = "1.0"
+regex = { version = "=1.9.1", features = ["std"] }
+helper = { path = "../helper" }
+
+[dev-dependencies]
+criterion = "~0.5"
+`)
+
+	res, err := Import(dir, nil)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	m := res.Manifest
+	if m.Package.Name != "json-utils" || m.Package.Version != "0.3.1" {
+		t.Errorf("package = %s@%s, want json-utils@0.3.1", m.Package.Name, m.Package.Version)
+	}
+	wantDeps := map[string]string{
+		"serde":  "^1.0.0",
+		"regex":  "1.9.1",
+		"helper": anyVersion,
+	}
+	if !reflect.DeepEqual(m.Dependencies, wantDeps) {
+		t.Errorf("dependencies = %v, want %v", m.Dependencies, wantDeps)
+	}
+	if !reflect.DeepEqual(m.DevDependencies, map[string]string{"criterion": "~0.5.0"}) {
+		t.Errorf("dev dependencies = %v", m.DevDependencies)
+	}
+	if len(res.Warnings) != 1 {
+		t.Errorf("warnings = %v, want one for the path dependency", res.Warnings)
+	}
+}
+
+func TestImport_Requirements(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Data_Tools")
+	os.Mkdir(dir, 0755)
+	writeFile(t, dir, "requirements.txt", `# Runtime dependencies
+-r base.txt
+requests[security]==2.31.0
+numpy >= 1.24, < 2.0
+Django~=4.2
+urllib3==1.26.*
+six ; python_version < "3"
+pytz!=2023.1
+`)
+
+	res, err := Import(dir, Mapping{PyPI: {"requests": "http-client"}})
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	m := res.Manifest
+	if m.Package.Name != "data-tools" || m.Package.Version != "0.1.0" {
+		t.Errorf("package = %s@%s, want data-tools@0.1.0", m.Package.Name, m.Package.Version)
+	}
+	wantDeps := map[string]string{
+		"http-client": "2.31.0",
+		"numpy":       ">=1.24.0, <2.0.0",
+		"django":      "^4.2.0",
+		"urllib3":     "~1.26.0",
+		"six":         anyVersion,
+		"pytz":        anyVersion,
+	}
+	if !reflect.DeepEqual(m.Dependencies, wantDeps) {
+		t.Errorf("dependencies = %v, want %v", m.Dependencies, wantDeps)
+	}
+	if len(res.Warnings) != 1 {
+		t.Errorf("warnings = %v, want one for the != requirement", res.Warnings)
+	}
+}
+
+func TestImport_NoSource(t *testing.T) {
+	if _, err := Import(t.TempDir(), nil); err == nil {
+		t.Error("Import() of an empty directory succeeded")
+	}
+}
+
+func TestLoadMapping(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "good.toml", "[npm]\nlodash = \"carrion-utils\"\n\n[pypi]\nrequests = \"http-client\"\n")
+	writeFile(t, dir, "bad.toml", "[gems]\nrails = \"web\"\n")
+
+	m, err := LoadMapping(filepath.Join(dir, "good.toml"))
+	if err != nil {
+		t.Fatalf("LoadMapping() error = %v", err)
+	}
+	if m[NPM]["lodash"] != "carrion-utils" || m[PyPI]["requests"] != "http-client" {
+		t.Errorf("LoadMapping() = %v", m)
+	}
+
+	if _, err := LoadMapping(filepath.Join(dir, "bad.toml")); err == nil {
+		t.Error("LoadMapping() accepted an unknown ecosystem")
+	}
+}
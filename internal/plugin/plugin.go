@@ -0,0 +1,162 @@
+// Package plugin runs external bifrost-<name> executables found on PATH as
+// bifrost subcommands.
+//
+// Plugins receive a JSON handshake document describing the invoking
+// environment in the BIFROST_PLUGIN_CONTEXT environment variable. The most
+// commonly needed fields are also exported as individual variables so simple
+// shell plugins do not need a JSON parser.
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Prefix is prepended to a subcommand name to form the plugin executable name
+const Prefix = "bifrost-"
+
+// ProtocolVersion is the version of the handshake document
+const ProtocolVersion = 1
+
+// Environment variables set for every plugin invocation
+const (
+	EnvContext     = "BIFROST_PLUGIN_CONTEXT"
+	EnvRegistryURL = "BIFROST_REGISTRY_URL"
+	EnvHome        = "BIFROST_HOME"
+	EnvProjectRoot = "BIFROST_PROJECT_ROOT"
+	EnvManifest    = "BIFROST_MANIFEST"
+)
+
+// Context is the handshake document passed to plugins
+type Context struct {
+	ProtocolVersion int    `json:"protocol_version"`
+	BifrostPath     string `json:"bifrost_path"`
+	HomeDir         string `json:"home_dir"`
+	RegistryURL     string `json:"registry_url"`
+	Auth            *Auth  `json:"auth,omitempty"`
+	ProjectRoot     string `json:"project_root,omitempty"`
+	ManifestPath    string `json:"manifest_path,omitempty"`
+}
+
+// Auth carries the registry credentials configured for the user
+type Auth struct {
+	Type     string `json:"type"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	APIKey   string `json:"api_key,omitempty"`
+}
+
+// Find returns the path of the executable implementing subcommand name
+func Find(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, "-") {
+		return "", fmt.Errorf("invalid plugin name %q", name)
+	}
+	return exec.LookPath(Prefix + name)
+}
+
+// List returns the names of all plugins available on PATH, sorted and
+// without duplicates. Earlier PATH entries shadow later ones.
+func List() []string {
+	seen := make(map[string]bool)
+	var names []string
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := pluginName(entry.Name())
+			if !ok || seen[name] || entry.IsDir() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || !isExecutable(info) {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// pluginName extracts the subcommand name from an executable file name
+func pluginName(file string) (string, bool) {
+	if !strings.HasPrefix(file, Prefix) {
+		return "", false
+	}
+	name := strings.TrimPrefix(file, Prefix)
+	if runtime.GOOS == "windows" {
+		ext := filepath.Ext(name)
+		switch strings.ToLower(ext) {
+		case ".exe", ".bat", ".cmd":
+			name = strings.TrimSuffix(name, ext)
+		default:
+			return "", false
+		}
+	}
+	return name, name != ""
+}
+
+// isExecutable reports whether a file found on PATH can be run as a plugin
+func isExecutable(info os.FileInfo) bool {
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	return info.Mode().Perm()&0111 != 0
+}
+
+// Environ returns env extended with the handshake variables for ctx
+func Environ(env []string, ctx *Context) ([]string, error) {
+	data, err := json.Marshal(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode plugin context: %w", err)
+	}
+
+	env = append(env,
+		EnvContext+"="+string(data),
+		EnvRegistryURL+"="+ctx.RegistryURL,
+		EnvHome+"="+ctx.HomeDir,
+	)
+	if ctx.ProjectRoot != "" {
+		env = append(env, EnvProjectRoot+"="+ctx.ProjectRoot)
+	}
+	if ctx.ManifestPath != "" {
+		env = append(env, EnvManifest+"="+ctx.ManifestPath)
+	}
+	return env, nil
+}
+
+// Run executes the plugin at path with args, connected to the current
+// standard streams, and returns its exit code
+func Run(path string, args []string, ctx *Context) (int, error) {
+	env, err := Environ(os.Environ(), ctx)
+	if err != nil {
+		return 1, err
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), nil
+		}
+		return 1, fmt.Errorf("failed to run plugin %s: %w", path, err)
+	}
+	return 0, nil
+}
@@ -0,0 +1,93 @@
+package plugin
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func writePlugin(t *testing.T, dir, name, script string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, Prefix+name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("failed to write plugin: %v", err)
+	}
+	return path
+}
+
+func TestFindAndList(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script plugins are not executable on Windows")
+	}
+
+	first := t.TempDir()
+	second := t.TempDir()
+	writePlugin(t, first, "hello", "exit 0\n")
+	writePlugin(t, second, "hello", "exit 1\n")
+	writePlugin(t, second, "audit", "exit 0\n")
+	os.WriteFile(filepath.Join(second, Prefix+"notes"), []byte("not executable"), 0644)
+	t.Setenv("PATH", first+string(os.PathListSeparator)+second)
+
+	names := List()
+	if strings.Join(names, ",") != "audit,hello" {
+		t.Errorf("List() = %v, want [audit hello]", names)
+	}
+
+	path, err := Find("hello")
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if filepath.Dir(path) != first {
+		t.Errorf("Find() = %s, want plugin from first PATH entry", path)
+	}
+
+	for _, name := range []string{"missing", "", "../hello", "-x"} {
+		if _, err := Find(name); err == nil {
+			t.Errorf("Find(%q) should fail", name)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script plugins are not executable on Windows")
+	}
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.json")
+	path := writePlugin(t, dir, "dump", `printf '%s' "$BIFROST_PLUGIN_CONTEXT" > "$1"
+[ "$BIFROST_REGISTRY_URL" = "https://registry.test" ] || exit 3
+exit 7
+`)
+
+	ctx := &Context{
+		ProtocolVersion: ProtocolVersion,
+		HomeDir:         dir,
+		RegistryURL:     "https://registry.test",
+		Auth:            &Auth{Type: "token", APIKey: "secret"},
+		ProjectRoot:     "/work/app",
+	}
+	code, err := Run(path, []string{out}, ctx)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if code != 7 {
+		t.Errorf("Run() exit code = %d, want 7", code)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("plugin did not write output: %v", err)
+	}
+	var got Context
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid handshake JSON %q: %v", data, err)
+	}
+	if got.ProjectRoot != "/work/app" || got.Auth == nil || got.Auth.APIKey != "secret" {
+		t.Errorf("handshake = %+v, want project root and auth", got)
+	}
+}
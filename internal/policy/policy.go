@@ -0,0 +1,204 @@
+// Package policy loads the organization policy file an administrator puts
+// in a system directory. Its rules apply on top of the user configuration,
+// which cannot relax them.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/javanhut/bifrost/internal/errcode"
+	ver "github.com/javanhut/bifrost/internal/version"
+)
+
+// FileName is the name of the policy file in the system configuration
+// directory
+const FileName = "policy.toml"
+
+// Policy is the set of rules in a policy file. The zero Policy allows
+// everything.
+type Policy struct {
+	// AllowedRegistries lists the registry URLs packages may come from.
+	// Empty allows any registry.
+	AllowedRegistries []string `toml:"allowed_registries" json:"allowed_registries,omitempty"`
+	// RequireSignatures refuses packages without a verified signature: a
+	// checksum the registry's package index signs with its index key
+	RequireSignatures bool `toml:"require_signatures" json:"require_signatures,omitempty"`
+	// ForbidInstallScripts refuses packages with install scripts, even when
+	// scripts are allowed on the command line
+	ForbidInstallScripts bool `toml:"forbid_install_scripts" json:"forbid_install_scripts,omitempty"`
+	// Blocked lists packages, or ranges of their versions, that must not be
+	// installed
+	Blocked []Block `toml:"blocked" json:"blocked,omitempty"`
+	// AllowedLicenses lists the licenses packages may declare. Empty allows
+	// any license, including none.
+	AllowedLicenses []string `toml:"allowed_licenses" json:"allowed_licenses,omitempty"`
+	// DeniedLicenses lists licenses packages must not declare
+	DeniedLicenses []string `toml:"denied_licenses" json:"denied_licenses,omitempty"`
+
+	// path is the file the policy was loaded from, empty when there is none
+	path string
+}
+
+// Block forbids the versions of a package matching Versions, or every
+// version when it is empty
+type Block struct {
+	Name     string `toml:"name" json:"name"`
+	Versions string `toml:"versions" json:"versions,omitempty"`
+	Reason   string `toml:"reason" json:"reason,omitempty"`
+
+	constraint ver.Constraint
+}
+
+// DefaultPath returns the location of the system policy file:
+// /etc/carrion/policy.toml, or %ProgramData%\Carrion\policy.toml on Windows
+func DefaultPath() string {
+	if runtime.GOOS == "windows" {
+		programData := os.Getenv("ProgramData")
+		if programData == "" {
+			programData = filepath.Join("C:", "ProgramData")
+		}
+		return filepath.Join(programData, "Carrion", FileName)
+	}
+	return filepath.Join("/etc", "carrion", FileName)
+}
+
+// Load reads the policy file at DefaultPath, returning an empty policy when
+// there is none
+func Load() (*Policy, error) {
+	return LoadFile(DefaultPath())
+}
+
+// LoadFile reads the policy file at path, returning an empty policy when it
+// does not exist. A policy that cannot be read is an error rather than no
+// policy, so a broken file never lifts its rules.
+func LoadFile(path string) (*Policy, error) {
+	var p Policy
+	if _, err := toml.DecodeFile(path, &p); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &Policy{}, nil
+		}
+		return nil, fmt.Errorf("failed to load policy %s: %w", path, err)
+	}
+	p.path = path
+
+	for i := range p.Blocked {
+		b := &p.Blocked[i]
+		if b.Name == "" {
+			return nil, fmt.Errorf("policy %s: blocked entry %d has no name", path, i+1)
+		}
+		if b.Versions == "" {
+			continue
+		}
+		constraint, err := ver.ParseConstraint(b.Versions)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: invalid versions %q for %s: %w", path, b.Versions, b.Name, err)
+		}
+		b.constraint = constraint
+	}
+	return &p, nil
+}
+
+// Path returns the file the policy was loaded from, or "" if there is none
+func (p *Policy) Path() string {
+	return p.path
+}
+
+// CheckRegistry returns an error if packages may not be installed from the
+// registry at registryURL
+func (p *Policy) CheckRegistry(registryURL string) error {
+	if p == nil || len(p.AllowedRegistries) == 0 {
+		return nil
+	}
+	for _, allowed := range p.AllowedRegistries {
+		if sameRegistry(allowed, registryURL) {
+			return nil
+		}
+	}
+	return errcode.PolicyViolation.Errorf("registry %s is not allowed by policy %s (allowed: %s)", registryURL, p.path, strings.Join(p.AllowedRegistries, ", "))
+}
+
+// CheckPackage returns an error if name@version may not be installed.
+// signed is whether its checksum carries a verified index signature.
+func (p *Policy) CheckPackage(name, version string, signed bool) error {
+	if err := p.CheckBlocked(name, version); err != nil {
+		return err
+	}
+	return p.CheckSignature(name, version, signed)
+}
+
+// CheckBlocked returns an error if name@version is blocked
+func (p *Policy) CheckBlocked(name, version string) error {
+	if p == nil {
+		return nil
+	}
+	for _, b := range p.Blocked {
+		if b.Name != name {
+			continue
+		}
+		if b.constraint != nil {
+			v, err := ver.Parse(version)
+			if err != nil || !b.constraint.Satisfies(v) {
+				continue
+			}
+		}
+		msg := fmt.Sprintf("%s@%s is blocked by policy %s", name, version, p.path)
+		if b.Reason != "" {
+			msg += ": " + b.Reason
+		}
+		return &errcode.Error{Code: errcode.PolicyViolation, Err: errors.New(msg)}
+	}
+	return nil
+}
+
+// CheckSignature returns an error if name@version needs a verified
+// signature and signed is not set
+func (p *Policy) CheckSignature(name, version string, signed bool) error {
+	if p != nil && p.RequireSignatures && !signed {
+		return errcode.PolicyViolation.Errorf("policy %s requires signed packages and %s@%s has no verified signature; configure its registry's index and index-key", p.path, name, version)
+	}
+	return nil
+}
+
+// CheckLicense returns an error if name@version may not be installed under
+// license, the SPDX identifier its manifest declares. Licenses are compared
+// ignoring case.
+func (p *Policy) CheckLicense(name, version, license string) error {
+	if p == nil {
+		return nil
+	}
+	for _, denied := range p.DeniedLicenses {
+		if strings.EqualFold(denied, license) {
+			return errcode.PolicyViolation.Errorf("%s@%s is licensed under %s, which policy %s denies", name, version, license, p.path)
+		}
+	}
+	if len(p.AllowedLicenses) == 0 {
+		return nil
+	}
+	for _, allowed := range p.AllowedLicenses {
+		if strings.EqualFold(allowed, license) {
+			return nil
+		}
+	}
+	if license == "" {
+		return errcode.PolicyViolation.Errorf("%s@%s declares no license and policy %s only allows %s", name, version, p.path, strings.Join(p.AllowedLicenses, ", "))
+	}
+	return errcode.PolicyViolation.Errorf("%s@%s is licensed under %s, which policy %s does not allow (allowed: %s)", name, version, license, p.path, strings.Join(p.AllowedLicenses, ", "))
+}
+
+// sameRegistry reports whether two registry URLs name the same registry,
+// ignoring case in the host and trailing slashes
+func sameRegistry(a, b string) bool {
+	ua, errA := url.Parse(strings.TrimRight(a, "/"))
+	ub, errB := url.Parse(strings.TrimRight(b, "/"))
+	if errA != nil || errB != nil {
+		return strings.TrimRight(a, "/") == strings.TrimRight(b, "/")
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host) && ua.Path == ub.Path
+}
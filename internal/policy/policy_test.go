@@ -0,0 +1,154 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePolicy(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), FileName)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	p, err := LoadFile(filepath.Join(t.TempDir(), FileName))
+	if err != nil {
+		t.Fatalf("LoadFile() of a missing file error = %v", err)
+	}
+	if p.Path() != "" || p.CheckRegistry("https://anything.test") != nil || p.CheckPackage("x", "1.0.0", false) != nil {
+		t.Errorf("missing policy restricts something: %+v", p)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "invalid toml", content: "allowed_registries = [", wantErr: "failed to load policy"},
+		{name: "blocked without name", content: "[[blocked]]\nversions = \"<1.0.0\"\n", wantErr: "has no name"},
+		{name: "invalid versions", content: "[[blocked]]\nname = \"x\"\nversions = \"soon\"\n", wantErr: "invalid versions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadFile(writePolicy(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadFile() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicy_CheckRegistry(t *testing.T) {
+	p, err := LoadFile(writePolicy(t, `allowed_registries = ["https://registry.acme.internal/", "https://registry.carrionlang.com"]`))
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://registry.acme.internal", true},
+		{"https://REGISTRY.acme.internal/", true},
+		{"https://registry.carrionlang.com", true},
+		{"http://registry.carrionlang.com", false},
+		{"https://mirror.example.com", false},
+		{"https://registry.carrionlang.com/other", false},
+	}
+	for _, tt := range tests {
+		if err := p.CheckRegistry(tt.url); (err == nil) != tt.allowed {
+			t.Errorf("CheckRegistry(%q) error = %v, want allowed %v", tt.url, err, tt.allowed)
+		}
+	}
+}
+
+func TestPolicy_CheckPackage(t *testing.T) {
+	p, err := LoadFile(writePolicy(t, `
+[[blocked]]
+name = "left-pad"
+reason = "unmaintained"
+
+[[blocked]]
+name = "json-utils"
+versions = ">=1.2.0, <1.3.0"
+reason = "CVE-2024-1234"
+`))
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name, version string
+		wantErr       string
+	}{
+		{"left-pad", "1.0.0", "unmaintained"},
+		{"json-utils", "1.2.4", "CVE-2024-1234"},
+		{"json-utils", "1.3.0", ""},
+		{"http-client", "1.2.4", ""},
+	}
+	for _, tt := range tests {
+		err := p.CheckPackage(tt.name, tt.version, false)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("CheckPackage(%s, %s) error = %v", tt.name, tt.version, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("CheckPackage(%s, %s) error = %v, want containing %q", tt.name, tt.version, err, tt.wantErr)
+		}
+	}
+
+	p.RequireSignatures = true
+	if err := p.CheckPackage("http-client", "1.2.4", false); err == nil || !strings.Contains(err.Error(), "requires signed packages") {
+		t.Errorf("CheckPackage() of an unsigned package with required signatures error = %v", err)
+	}
+	if err := p.CheckPackage("http-client", "1.2.4", true); err != nil {
+		t.Errorf("CheckPackage() of a signed package with required signatures error = %v", err)
+	}
+}
+
+func TestPolicy_CheckLicense(t *testing.T) {
+	p, err := LoadFile(writePolicy(t, `
+allowed_licenses = ["MIT", "Apache-2.0"]
+denied_licenses = ["GPL-3.0"]
+`))
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	tests := []struct {
+		license string
+		wantErr string
+	}{
+		{"MIT", ""},
+		{"apache-2.0", ""},
+		{"GPL-3.0", "which policy"},
+		{"BSD-3-Clause", "does not allow"},
+		{"", "declares no license"},
+	}
+	for _, tt := range tests {
+		err := p.CheckLicense("json-utils", "1.0.0", tt.license)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("CheckLicense(%q) error = %v", tt.license, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("CheckLicense(%q) error = %v, want containing %q", tt.license, err, tt.wantErr)
+		}
+	}
+
+	// Without an allow list only denied licenses are refused
+	p.AllowedLicenses = nil
+	if err := p.CheckLicense("json-utils", "1.0.0", ""); err != nil {
+		t.Errorf("CheckLicense() without allowed licenses error = %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package refs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/fsutil"
+)
+
+// FileName is the reference file kept in the global packages directory
+const FileName = "refs.json"
+
+// Explicit is the reference recorded for a package installed globally from
+// outside any project. It is only dropped by uninstalling the package.
+const Explicit = "explicit"
+
+// staleLock is how old a lock file must be before it is assumed to belong to
+// a process that died while holding it
+const staleLock = 30 * time.Second
+
+// Refs records which projects use each globally installed package version,
+// so a version is only deleted once nothing references it
+type Refs struct {
+	// Packages maps package name to version to referencing project
+	// directories
+	Packages map[string]map[string][]string `json:"packages"`
+}
+
+// Update loads the reference file at path, applies fn and writes the result
+// back. A lock file next to it serializes concurrent updates from several
+// bifrost processes.
+func Update(path string, fn func(*Refs) error) error {
+	unlock, err := lock(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	r, err := Load(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(r); err != nil {
+		return err
+	}
+	return r.save(path)
+}
+
+// Load reads the reference file at path. A missing file yields no references.
+func Load(path string) (*Refs, error) {
+	r := &Refs{Packages: make(map[string]map[string][]string)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+		return nil, fmt.Errorf("failed to read references: %w", err)
+	}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("failed to parse references %s: %w", path, err)
+	}
+	if r.Packages == nil {
+		r.Packages = make(map[string]map[string][]string)
+	}
+	return r, nil
+}
+
+// save writes the references through a temporary file so readers never see a
+// partial file. Each save uses its own temporary file, as installs of several
+// projects may save at once.
+func (r *Refs) save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := fsutil.WriteFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write references: %w", err)
+	}
+	return nil
+}
+
+// Tracked reports whether any reference was ever recorded for the version.
+// Versions installed before references were kept are untracked.
+func (r *Refs) Tracked(name, version string) bool {
+	_, ok := r.Packages[name][version]
+	return ok
+}
+
+// Add records that project uses name@version
+func (r *Refs) Add(name, version, project string) {
+	versions := r.Packages[name]
+	if versions == nil {
+		versions = make(map[string][]string)
+		r.Packages[name] = versions
+	}
+	for _, p := range versions[version] {
+		if p == project {
+			return
+		}
+	}
+	versions[version] = append(versions[version], project)
+	sort.Strings(versions[version])
+}
+
+// Remove drops project's reference to name@version. The version stays
+// tracked, with no references, until Forget is called.
+func (r *Refs) Remove(name, version, project string) {
+	projects := r.Packages[name][version]
+	for n, p := range projects {
+		if p == project {
+			r.Packages[name][version] = append(projects[:n:n], projects[n+1:]...)
+			return
+		}
+	}
+}
+
+// Forget drops name@version entirely, once it has been deleted
+func (r *Refs) Forget(name, version string) {
+	delete(r.Packages[name], version)
+	if len(r.Packages[name]) == 0 {
+		delete(r.Packages, name)
+	}
+}
+
+// Projects returns the references to name@version
+func (r *Refs) Projects(name, version string) []string {
+	return r.Packages[name][version]
+}
+
+// Prune drops references from projects whose manifest no longer exists and
+// returns them
+func (r *Refs) Prune() []string {
+	var pruned []string
+	for _, name := range sortedKeys(r.Packages) {
+		for _, version := range sortedKeys(r.Packages[name]) {
+			for _, project := range r.Packages[name][version] {
+				if project == Explicit {
+					continue
+				}
+				if _, err := os.Stat(filepath.Join(project, "Bifrost.toml")); os.IsNotExist(err) {
+					r.Remove(name, version, project)
+					pruned = append(pruned, project)
+				}
+			}
+		}
+	}
+	return pruned
+}
+
+// Unreferenced returns the tracked versions that no project references,
+// keyed by package name
+func (r *Refs) Unreferenced() map[string][]string {
+	unreferenced := make(map[string][]string)
+	for name, versions := range r.Packages {
+		for version, projects := range versions {
+			if len(projects) == 0 {
+				unreferenced[name] = append(unreferenced[name], version)
+			}
+		}
+		sort.Strings(unreferenced[name])
+	}
+	return unreferenced
+}
+
+// lock creates path exclusively, waiting for another holder to release it
+func lock(path string) (func(), error) {
+	deadline := time.Now().Add(2 * staleLock)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock references: %w", err)
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,97 @@
+package refs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func newProject(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "Bifrost.toml"), []byte("[package]"), 0644)
+	return dir
+}
+
+func TestRefs_AddRemove(t *testing.T) {
+	r, err := Load(filepath.Join(t.TempDir(), FileName))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	r.Add("json-utils", "1.0.0", "/b")
+	r.Add("json-utils", "1.0.0", "/a")
+	r.Add("json-utils", "1.0.0", "/a")
+	if got := r.Projects("json-utils", "1.0.0"); !reflect.DeepEqual(got, []string{"/a", "/b"}) {
+		t.Errorf("Projects() = %v, want [/a /b]", got)
+	}
+
+	r.Remove("json-utils", "1.0.0", "/a")
+	r.Remove("json-utils", "1.0.0", "/b")
+	if !r.Tracked("json-utils", "1.0.0") {
+		t.Error("version untracked after its references were removed")
+	}
+	if got := r.Unreferenced(); !reflect.DeepEqual(got, map[string][]string{"json-utils": {"1.0.0"}}) {
+		t.Errorf("Unreferenced() = %v", got)
+	}
+
+	r.Forget("json-utils", "1.0.0")
+	if r.Tracked("json-utils", "1.0.0") || len(r.Packages) != 0 {
+		t.Errorf("Forget() left %v", r.Packages)
+	}
+}
+
+func TestRefs_Prune(t *testing.T) {
+	live := newProject(t)
+	gone := filepath.Join(t.TempDir(), "deleted-project")
+
+	r := &Refs{Packages: map[string]map[string][]string{}}
+	r.Add("json-utils", "1.0.0", live)
+	r.Add("json-utils", "1.0.0", gone)
+	r.Add("http-client", "2.0.0", gone)
+	r.Add("http-client", "2.0.0", Explicit)
+
+	if pruned := r.Prune(); !reflect.DeepEqual(pruned, []string{gone, gone}) {
+		t.Errorf("Prune() = %v, want the deleted project twice", pruned)
+	}
+	if got := r.Projects("json-utils", "1.0.0"); !reflect.DeepEqual(got, []string{live}) {
+		t.Errorf("json-utils references = %v, want %v", got, []string{live})
+	}
+	if got := r.Projects("http-client", "2.0.0"); !reflect.DeepEqual(got, []string{Explicit}) {
+		t.Errorf("http-client references = %v, want the explicit reference", got)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+
+	// Concurrent updates must not lose references
+	var wg sync.WaitGroup
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			err := Update(path, func(r *Refs) error {
+				r.Add("json-utils", "1.0.0", string(rune('a'+n)))
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Update() error = %v", err)
+			}
+		}(n)
+	}
+	wg.Wait()
+
+	r, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := len(r.Projects("json-utils", "1.0.0")); got != 10 {
+		t.Errorf("recorded %d references, want 10", got)
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Error("lock file left behind")
+	}
+}
@@ -2,15 +2,24 @@ package registry
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/javanhut/bifrost/internal/errcode"
 )
 
 type Client struct {
@@ -21,6 +30,8 @@ type Client struct {
 	username   string
 	password   string
 	authType   string
+	// timeouts bound each request by its operation
+	timeouts Timeouts
 }
 
 type PackageInfo struct {
@@ -32,6 +43,27 @@ type PackageInfo struct {
 	Homepage    string   `json:"homepage"`
 	Repository  string   `json:"repository"`
 	Keywords    []string `json:"keywords"`
+	Categories  []string `json:"categories,omitempty"`
+	// Dependencies maps dependency names to version constraints
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+	// Checksum is the "sha256:<hex>" checksum of the package archive
+	Checksum string `json:"checksum,omitempty"`
+	// Format is the archive format the version was published in, "tar.gz"
+	// or "tar.zst". Empty means "tar.gz".
+	Format string `json:"format,omitempty"`
+	// Changelog is the path of the changelog inside the package archive, or
+	// the URL of one
+	Changelog string `json:"changelog,omitempty"`
+	// PublishedAt is when the version was published, nil when the registry
+	// does not say
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	// Artifacts maps platform targets, such as "linux-amd64", to the
+	// checksums of prebuilt archives installed in place of the package
+	// archive on those platforms. Empty for platform-independent packages.
+	Artifacts map[string]string `json:"artifacts,omitempty"`
+	// Stdlib marks packages the registry blesses as part of the Carrion
+	// standard library, which 'bifrost install --stdlib' installs
+	Stdlib bool `json:"stdlib,omitempty"`
 }
 
 type SearchResult struct {
@@ -41,34 +73,120 @@ type SearchResult struct {
 	Downloads   int    `json:"downloads"`
 }
 
+// BrowseOptions selects a page of the packages listed under a category or
+// keyword. Empty Category and Keyword list every package; zero Page and
+// PerPage leave the choice to the registry.
+type BrowseOptions struct {
+	Category string
+	Keyword  string
+	Page     int
+	PerPage  int
+}
+
+// BrowsePage is one page of the packages matching BrowseOptions
+type BrowsePage struct {
+	Packages []SearchResult `json:"packages"`
+	Page     int            `json:"page"`
+	PerPage  int            `json:"per_page"`
+	// Total is the number of matching packages across all pages
+	Total int `json:"total"`
+}
+
 type HealthResponse struct {
 	Status string `json:"status"`
+	// MaxUploadSize is the largest archive, in bytes, the registry accepts.
+	// Zero means the registry does not advertise a limit.
+	MaxUploadSize int64 `json:"max_upload_size,omitempty"`
+	// Version is the registry server's version, if it reports one
+	Version string `json:"version,omitempty"`
+	// Features lists the optional API features the registry supports, such
+	// as FeatureYank. Nil means the registry does not advertise them.
+	Features []string `json:"features,omitempty"`
+	// IndexUpdatedAt is when the registry last rebuilt its package index
+	IndexUpdatedAt *time.Time `json:"index_updated_at,omitempty"`
+	// RateLimit is the request budget from the X-RateLimit-* headers of the
+	// health response, nil when the registry sends none
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
 }
 
-func NewClient(baseURL string) *Client {
-	// Parse the base URL to extract just the host and scheme
-	u, err := url.Parse(baseURL)
-	if err != nil {
-		// If parsing fails, use baseURL as-is
-		return &Client{
-			baseURL: baseURL,
-			apiURL:  baseURL,
-			httpClient: &http.Client{
-				Timeout: 30 * time.Second,
-			},
-		}
+// VersionList is the response of the package versions endpoint
+type VersionList struct {
+	Name     string   `json:"name"`
+	Versions []string `json:"versions"`
+	// PublishedAt maps versions to when they were published, for registries
+	// that record it
+	PublishedAt map[string]time.Time `json:"published_at,omitempty"`
+	// DistTags maps tags such as "latest" or "next" to the versions they
+	// point at, for registries that support them
+	DistTags map[string]string `json:"dist_tags,omitempty"`
+	// RenamedTo is set on the tombstone of a renamed package: the name its
+	// versions are now published under
+	RenamedTo string `json:"renamed_to,omitempty"`
+	// RenamedUntil is when the registry stops resolving the old name of a
+	// renamed package
+	RenamedUntil *time.Time `json:"renamed_until,omitempty"`
+}
+
+// Option customizes a Client created by NewClient
+type Option func(*Client)
+
+// WithHTTPClient makes the client issue all requests through httpClient
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
 	}
-	
-	// Always use the root domain for API calls
-	apiURL := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
-	
-	return &Client{
+}
+
+// WithTransport replaces the transport of the client's HTTP client, which is
+// useful for routing requests to an in-process fake registry
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		httpClient := *c.httpClient
+		httpClient.Transport = transport
+		c.httpClient = &httpClient
+	}
+}
+
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
 		baseURL: baseURL,
-		apiURL:  apiURL,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+		apiURL:  baseURL,
+		// Requests are bounded by timeouts rather than the client's Timeout,
+		// which would cut long downloads short
+		httpClient: &http.Client{},
+		timeouts:   currentTimeouts(),
+	}
+
+	// Always use the root domain for API calls. If parsing fails, use
+	// baseURL as-is
+	if u, err := url.Parse(baseURL); err == nil {
+		c.apiURL = fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	// Requests are queued by the scheduler rather than failing when the
+	// registry limits them, and queries ask for compressed responses
+	httpClient := *c.httpClient
+	httpClient.Transport = &timeoutTransport{
+		next: &scheduledTransport{
+			next: &encodingTransport{next: httpClient.Transport, op: OperationQuery},
 		},
+		timeouts: c.timeouts,
 	}
+	if httpClient.CheckRedirect == nil {
+		httpClient.CheckRedirect = checkRedirect
+	}
+	c.httpClient = &httpClient
+
+	return c
+}
+
+// BaseURL returns the registry URL the client was created with
+func (c *Client) BaseURL() string {
+	return c.baseURL
 }
 
 func (c *Client) Search(query string) ([]SearchResult, error) {
@@ -88,38 +206,76 @@ func (c *Client) Search(query string) ([]SearchResult, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("search failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, statusError("search", resp)
 	}
 
 	var results []SearchResult
-	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+	if err := decodeJSON(resp, &results); err != nil {
 		return nil, fmt.Errorf("failed to decode search results: %w", err)
 	}
 
 	return results, nil
 }
 
+// Browse lists the packages the registry files under a category or keyword,
+// a page at a time
+func (c *Client) Browse(opts BrowseOptions) (*BrowsePage, error) {
+	u, err := url.Parse(c.apiURL + "/api/browse")
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	q := u.Query()
+	if opts.Category != "" {
+		q.Set("category", opts.Category)
+	}
+	if opts.Keyword != "" {
+		q.Set("keyword", opts.Keyword)
+	}
+	if opts.Page > 0 {
+		q.Set("page", strconv.Itoa(opts.Page))
+	}
+	if opts.PerPage > 0 {
+		q.Set("per_page", strconv.Itoa(opts.PerPage))
+	}
+	u.RawQuery = q.Encode()
+
+	resp, err := c.httpClient.Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to browse packages: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("browse", resp)
+	}
+
+	var page BrowsePage
+	if err := decodeJSON(resp, &page); err != nil {
+		return nil, fmt.Errorf("failed to decode browse results: %w", err)
+	}
+	return &page, nil
+}
+
 func (c *Client) GetPackageInfo(name, version string) (*PackageInfo, error) {
-	url := fmt.Sprintf("%s/api/package/%s/%s", c.apiURL, name, version)
+	url := fmt.Sprintf("%s/api/package/%s/%s", c.apiURL, url.PathEscape(name), url.PathEscape(version))
 
-	resp, err := c.httpClient.Get(url)
+	resp, err := c.get(url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get package info: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusNotFound {
-		return nil, fmt.Errorf("package %s@%s not found", name, version)
+		return nil, errcode.PackageNotFound.Errorf("package %s@%s not found", name, version)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, statusError("package info request", resp)
 	}
 
 	var info PackageInfo
-	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+	if err := decodeJSON(resp, &info); err != nil {
 		return nil, fmt.Errorf("failed to decode package info: %w", err)
 	}
 
@@ -130,22 +286,78 @@ func (c *Client) GetPackageLatest(name string) (*PackageInfo, error) {
 	return c.GetPackageInfo(name, "latest")
 }
 
-func (c *Client) Health() error {
-	url := c.apiURL + "/api/health"
+// ListVersions returns every published version of a package as reported by
+// the registry. A renamed package is a *RenamedError.
+func (c *Client) ListVersions(name string) ([]string, error) {
+	list, err := c.versionList(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := list.renamed(); err != nil {
+		return nil, err
+	}
+	return list.Versions, nil
+}
 
-	resp, err := c.httpClient.Get(url)
+// GetVersionList returns the versions of a package with what the registry
+// records about them, such as publish times and dist-tags, or the tombstone
+// of a renamed package
+func (c *Client) GetVersionList(name string) (*VersionList, error) {
+	return c.versionList(name)
+}
+
+// ListVersionsAsOf returns the versions of a package published at or before
+// asOf. Versions without a publish time are left out, and a registry that
+// records none for the package is an error rather than an empty list.
+func (c *Client) ListVersionsAsOf(name string, asOf time.Time) ([]string, error) {
+	list, err := c.versionList(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := list.renamed(); err != nil {
+		return nil, err
+	}
+	if len(list.Versions) > 0 && len(list.PublishedAt) == 0 {
+		return nil, fmt.Errorf("registry %s does not record when versions of %s were published", c.baseURL, name)
+	}
+	var versions []string
+	for _, v := range list.Versions {
+		if published, ok := list.PublishedAt[v]; ok && !published.After(asOf) {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+func (c *Client) versionList(name string) (*VersionList, error) {
+	url := fmt.Sprintf("%s/api/package/%s/versions", c.apiURL, url.PathEscape(name))
+
+	resp, err := c.get(url)
 	if err != nil {
-		return fmt.Errorf("registry unreachable: %w", err)
+		return nil, fmt.Errorf("failed to list versions: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errcode.PackageNotFound.Errorf("package %s not found", name)
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("registry health check failed with status %d", resp.StatusCode)
+		return nil, statusError("version list request", resp)
 	}
 
-	var health HealthResponse
-	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
-		return fmt.Errorf("failed to decode health response: %w", err)
+	var list VersionList
+	if err := decodeJSON(resp, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode version list: %w", err)
+	}
+
+	return &list, nil
+}
+
+func (c *Client) Health() error {
+	health, err := c.Status()
+	if err != nil {
+		return err
 	}
 
 	if health.Status != "healthy" {
@@ -155,6 +367,31 @@ func (c *Client) Health() error {
 	return nil
 }
 
+// Status returns the registry's health response, including the limits it
+// advertises
+func (c *Client) Status() (*HealthResponse, error) {
+	url := c.apiURL + "/api/health"
+
+	resp, err := c.httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("registry unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("registry health check", resp)
+	}
+
+	var health HealthResponse
+	if err := decodeJSON(resp, &health); err != nil {
+		return nil, fmt.Errorf("failed to decode health response: %w", err)
+	}
+	if health.RateLimit == nil {
+		health.RateLimit = parseRateLimit(resp.Header)
+	}
+	return &health, nil
+}
+
 func (c *Client) Publish(packagePath string, metadata *PackageInfo) error {
 	// Use direct Nexus upload since it's working
 	if err := c.publishDirectToNexus(packagePath, metadata); err == nil {
@@ -194,9 +431,12 @@ func (c *Client) publishPackageToEndpoint(packagePath string, metadata *PackageI
 		return fmt.Errorf("failed to create form file: %w", err)
 	}
 
-	if _, err := io.Copy(part, file); err != nil {
+	// Checksum the archive on the way, for the idempotency key
+	h := sha256.New()
+	if _, err := io.Copy(part, io.TeeReader(file, h)); err != nil {
 		return fmt.Errorf("failed to copy file: %w", err)
 	}
+	checksum := "sha256:" + hex.EncodeToString(h.Sum(nil))
 
 	// Add metadata as JSON
 	metadataJSON, err := json.Marshal(metadata)
@@ -212,59 +452,157 @@ func (c *Client) publishPackageToEndpoint(packagePath string, metadata *PackageI
 		return fmt.Errorf("failed to close multipart writer: %w", err)
 	}
 
-	// Create request
 	url := fmt.Sprintf("%s%s", c.apiURL, endpoint)
-	req, err := http.NewRequest("POST", url, body)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	return c.sendPublish(url, writer.FormDataContentType(), body.Bytes(), metadata, checksum)
+}
+
+// DownloadURL returns the URL of a package version's archive in format, the
+// archive file extension. An empty format means "tar.gz".
+func (c *Client) DownloadURL(name, version, format string) string {
+	if format == "" {
+		format = "tar.gz"
 	}
+	// Use the packages download path according to nginx config
+	filename := fmt.Sprintf("%s-%s.%s", name, version, format)
+	return fmt.Sprintf("%s/packages/%s/%s/%s", c.apiURL, url.PathEscape(name), url.PathEscape(version), url.PathEscape(filename))
+}
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+// ArtifactURL returns the URL of the archive of name@version prebuilt for
+// the platform target
+func (c *Client) ArtifactURL(name, version, target, format string) string {
+	if format == "" {
+		format = "tar.gz"
+	}
+	filename := fmt.Sprintf("%s-%s-%s.%s", name, version, target, format)
+	return fmt.Sprintf("%s/packages/%s/%s/%s", c.apiURL, url.PathEscape(name), url.PathEscape(version), url.PathEscape(filename))
+}
 
-	// Add authentication header based on auth type
-	if c.authType == "token" && c.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	} else if c.authType == "basic" && c.username != "" && c.password != "" {
-		req.SetBasicAuth(c.username, c.password)
+// archiveMediaTypes maps archive formats to the media types sent in Accept
+var archiveMediaTypes = map[string]string{
+	"tar.gz":  "application/gzip",
+	"tar.zst": "application/zstd",
+}
+
+// Download is the body of an archive download
+type Download struct {
+	io.ReadCloser
+	// Size is the length of the archive in bytes, or -1 when the registry
+	// did not send it
+	Size int64
+}
+
+// DownloadPackage downloads a package version's archive in format. The
+// request accepts either compression, preferring format, so a registry that
+// negotiates on Accept may answer with the other one; callers should detect
+// the compression from the content.
+func (c *Client) DownloadPackage(name, version, format string) (*Download, error) {
+	return c.downloadArchive(c.DownloadURL(name, version, format), name, version, format)
+}
+
+// DownloadArtifact downloads the archive of name@version prebuilt for the
+// platform target, negotiating its compression like DownloadPackage
+func (c *Client) DownloadArtifact(name, version, target, format string) (*Download, error) {
+	return c.downloadArchive(c.ArtifactURL(name, version, target, format), name, version+" for "+target, format)
+}
+
+func (c *Client) downloadArchive(url, name, version, format string) (*Download, error) {
+	accept := "application/gzip"
+	if mediaType, ok := archiveMediaTypes[format]; ok && mediaType != accept {
+		accept = mediaType + ", " + accept + ";q=0.9"
 	}
 
-	// Send request
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.download(func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", accept+", application/octet-stream;q=0.5")
+		return req, nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to publish package: %w", err)
+		return nil, fmt.Errorf("failed to download package: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("publish failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("package %s@%s not found", name, version)
 	}
 
-	return nil
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, statusError("download", resp)
+	}
+
+	// A proxy or login page answering in place of the registry would
+	// otherwise be saved and later fail extraction with a gzip error
+	if mediaType := contentType(resp); mediaType == "text/html" || mediaType == "application/json" {
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("download from %s returned %s instead of a package archive: %s",
+			responseURL(resp), mediaType, bodySnippet(resp.Body))
+	}
+
+	return &Download{ReadCloser: resp.Body, Size: resp.ContentLength}, nil
 }
 
-func (c *Client) DownloadPackage(name, version string) (io.ReadCloser, error) {
-	// Use the packages download path according to nginx config
-	filename := fmt.Sprintf("%s-%s.tar.gz", name, version)
-	url := fmt.Sprintf("%s/packages/%s/%s/%s", c.apiURL, name, version, filename)
-	
-	resp, err := c.httpClient.Get(url)
+// PatchFormatHeader names the format of a patch served by DownloadPatch
+const PatchFormatHeader = "X-Patch-Format"
+
+// ErrNoPatch is returned by DownloadPatch when the registry has no patch
+// between the two versions
+var ErrNoPatch = errors.New("no patch available")
+
+// DownloadPatch fetches a binary patch that turns the archive of name@from
+// into the archive of name@to, along with the patch format. Registries
+// without patches, or without one for this pair of versions, give
+// ErrNoPatch.
+func (c *Client) DownloadPatch(name, from, to string) (io.ReadCloser, string, error) {
+	url := fmt.Sprintf("%s/api/package/%s/%s/patch?from=%s", c.apiURL, url.PathEscape(name), url.PathEscape(to), url.QueryEscape(from))
+
+	resp, err := c.download(func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, url, nil)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to download package: %w", err)
+		return nil, "", fmt.Errorf("failed to download patch: %w", err)
 	}
 
-	if resp.StatusCode == http.StatusNotFound {
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusNotImplemented {
 		resp.Body.Close()
-		return nil, fmt.Errorf("package %s@%s not found", name, version)
+		return nil, "", ErrNoPatch
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
+		defer resp.Body.Close()
+		return nil, "", statusError("patch download", resp)
+	}
+
+	format := resp.Header.Get(PatchFormatHeader)
+	if format == "" {
 		resp.Body.Close()
-		return nil, fmt.Errorf("download failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, "", fmt.Errorf("patch from %s has no %s header", responseURL(resp), PatchFormatHeader)
+	}
+	return resp.Body, format, nil
+}
+
+// maxChangelogSize bounds how much of a remote changelog FetchChangelog reads
+const maxChangelogSize = 1 << 20
+
+// FetchChangelog downloads a changelog published at a URL rather than
+// inside the package archive
+func (c *Client) FetchChangelog(url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(withOperation(req, OperationDownload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch changelog: %w", err)
 	}
+	defer resp.Body.Close()
 
-	return resp.Body, nil
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("changelog request", resp)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxChangelogSize))
 }
 
 // SetAPIKey sets the API key for token-based authentication
@@ -300,7 +638,11 @@ func (c *Client) publishDirectToNexus(packagePath string, metadata *PackageInfo)
 	}
 
 	// Add the package file
-	filename := fmt.Sprintf("%s-%s.tar.gz", metadata.Name, metadata.Version)
+	ext := "tar.gz"
+	if strings.HasSuffix(packagePath, ".tar.zst") {
+		ext = "tar.zst"
+	}
+	filename := fmt.Sprintf("%s-%s.%s", metadata.Name, metadata.Version, ext)
 	part, err := writer.CreateFormFile("raw.asset1", filename)
 	if err != nil {
 		return fmt.Errorf("failed to create form file: %w", err)
@@ -319,8 +661,8 @@ func (c *Client) publishDirectToNexus(packagePath string, metadata *PackageInfo)
 		return fmt.Errorf("failed to close multipart writer: %w", err)
 	}
 
-	// Use Nexus components API for upload
-	uploadURL := fmt.Sprintf("https://registry.carrionlang.com/nexus/service/rest/v1/components?repository=carrion")
+	// Use Nexus components API for upload, hosted alongside the registry API
+	uploadURL := fmt.Sprintf("%s/nexus/service/rest/v1/components?repository=carrion", c.apiURL)
 
 	// Create request
 	req, err := http.NewRequest("POST", uploadURL, body)
@@ -336,15 +678,14 @@ func (c *Client) publishDirectToNexus(packagePath string, metadata *PackageInfo)
 	}
 
 	// Send request
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.httpClient.Do(withOperation(req, OperationPublish))
 	if err != nil {
 		return fmt.Errorf("failed to upload to Nexus: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("nexus upload failed with status %d: %s", resp.StatusCode, string(body))
+		return statusError("nexus upload", resp)
 	}
 
 	return nil
@@ -375,9 +716,84 @@ func (c *Client) registerWithIndex(metadata *PackageInfo) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("index registration failed with status %d: %s", resp.StatusCode, string(body))
+		return statusError("index registration", resp)
+	}
+
+	return nil
+}
+
+const (
+	// maxErrorBodySize caps how much of an error response is read
+	maxErrorBodySize = 4 << 10
+	// maxJSONBodySize caps the size of any JSON document accepted from the registry
+	maxJSONBodySize = 32 << 20
+	// snippetLength is how much of an unexpected body is quoted in errors
+	snippetLength = 200
+)
+
+// contentType returns the media type of a response without parameters
+func contentType(resp *http.Response) string {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(mediaType)
+}
+
+// isJSONContentType reports whether a media type carries JSON
+func isJSONContentType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// snippet collapses whitespace and truncates a response body for use in error messages
+func snippet(data []byte) string {
+	// A body cut short may end inside a rune; invalid bytes are replaced so
+	// the error stays printable
+	text := strings.Join(strings.Fields(strings.ToValidUTF8(string(data), "\uFFFD")), " ")
+	if len(text) > snippetLength {
+		n := snippetLength
+		for n > 0 && !utf8.RuneStart(text[n]) {
+			n--
+		}
+		text = text[:n] + "..."
+	}
+	if text == "" {
+		return "<empty body>"
+	}
+	return text
+}
+
+// bodySnippet reads a bounded prefix of r and returns it as an error snippet
+func bodySnippet(r io.Reader) string {
+	data, _ := io.ReadAll(io.LimitReader(r, maxErrorBodySize))
+	return snippet(data)
+}
+
+// statusError builds an error for an unexpected response status, including
+// the request URL and the beginning of the response body
+func statusError(op string, resp *http.Response) error {
+	return fmt.Errorf("%s failed with status %d (%s): %s",
+		op, resp.StatusCode, responseURL(resp), bodySnippet(resp.Body))
+}
+
+// decodeJSON validates that resp carries JSON and decodes it into v
+func decodeJSON(resp *http.Response, v interface{}) error {
+	mediaType := contentType(resp)
+	if mediaType != "" && !isJSONContentType(mediaType) {
+		return fmt.Errorf("expected JSON from %s but got %s: %s",
+			resp.Request.URL, mediaType, bodySnippet(resp.Body))
 	}
 
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJSONBodySize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read response from %s: %w", resp.Request.URL, err)
+	}
+	if len(data) > maxJSONBodySize {
+		return fmt.Errorf("response from %s exceeds %d bytes", resp.Request.URL, maxJSONBodySize)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid JSON from %s (%v): %s", resp.Request.URL, err, snippet(data))
+	}
 	return nil
 }
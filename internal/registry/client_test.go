@@ -0,0 +1,382 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+const proxyErrorPage = `<!DOCTYPE html>
+<html>
+  <head><title>502 Bad Gateway</title></head>
+  <body><h1>Bad Gateway</h1></body>
+</html>`
+
+func TestClient_ResponseValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		call        func(c *Client) error
+		wantErrPart []string
+	}{
+		{
+			name: "html page instead of package info",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				io.WriteString(w, proxyErrorPage)
+			},
+			call: func(c *Client) error {
+				_, err := c.GetPackageInfo("json-utils", "1.0.0")
+				return err
+			},
+			wantErrPart: []string{"expected JSON", "text/html", "/api/package/json-utils/1.0.0", "Bad Gateway"},
+		},
+		{
+			name: "html page instead of search results",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				io.WriteString(w, proxyErrorPage)
+			},
+			call: func(c *Client) error {
+				_, err := c.Search("json")
+				return err
+			},
+			wantErrPart: []string{"failed to decode search results", "/api/search?q=json"},
+		},
+		{
+			name: "malformed json",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, `{"name": `)
+			},
+			call: func(c *Client) error {
+				_, err := c.ListVersions("json-utils")
+				return err
+			},
+			wantErrPart: []string{"invalid JSON", "/api/package/json-utils/versions", `{"name":`},
+		},
+		{
+			name: "error status includes url and snippet",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				io.WriteString(w, "maintenance\n\n   window")
+			},
+			call: func(c *Client) error {
+				return c.Health()
+			},
+			wantErrPart: []string{"status 503", "/api/health", "maintenance window"},
+		},
+		{
+			name: "html page instead of archive",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				io.WriteString(w, proxyErrorPage)
+			},
+			call: func(c *Client) error {
+				rc, err := c.DownloadPackage("json-utils", "1.0.0", "")
+				if rc != nil {
+					rc.Close()
+				}
+				return err
+			},
+			wantErrPart: []string{"instead of a package archive", "json-utils-1.0.0.tar.gz"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			err := tt.call(NewClient(server.URL))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, part := range tt.wantErrPart {
+				if !strings.Contains(err.Error(), part) {
+					t.Errorf("error %q does not contain %q", err, part)
+				}
+			}
+		})
+	}
+}
+
+func TestSnippet_RuneBoundary(t *testing.T) {
+	// Two-byte runes put the snippet limit in the middle of one
+	text := snippet([]byte("x" + strings.Repeat("é", snippetLength)))
+	if !utf8.ValidString(text) {
+		t.Errorf("snippet() = %q, not valid UTF-8", text)
+	}
+	if !strings.HasSuffix(text, "é...") {
+		t.Errorf("snippet() = %q, want it cut after a whole rune", text)
+	}
+	if got := snippet([]byte("bad gateway \xe2\x82")); got != "bad gateway \uFFFD" {
+		t.Errorf("snippet() of a body ending inside a rune = %q", got)
+	}
+}
+
+func TestClient_ErrorBodyIsCapped(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, strings.Repeat("x", 1<<20))
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL).GetPackageInfo("json-utils", "1.0.0")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(err.Error()) > 1024 {
+		t.Errorf("error message is %d bytes, expected it to be truncated", len(err.Error()))
+	}
+}
+
+func TestClient_JSONWithoutContentType(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["Content-Type"] = nil
+		io.WriteString(w, `{"status": "healthy"}`)
+	}))
+	defer server.Close()
+
+	if err := NewClient(server.URL).Health(); err != nil {
+		t.Errorf("Health() error = %v", err)
+	}
+}
+
+func TestClient_Status(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"status": "healthy", "max_upload_size": 52428800}`)
+	}))
+	defer server.Close()
+
+	status, err := NewClient(server.URL).Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if status.MaxUploadSize != 50<<20 {
+		t.Errorf("MaxUploadSize = %d, want %d", status.MaxUploadSize, 50<<20)
+	}
+}
+
+func TestClient_ListVersionsAsOf(t *testing.T) {
+	body := `{"name": "json-utils", "versions": ["1.0.0", "1.1.0", "1.2.0", "2.0.0"], "published_at": {
+		"1.0.0": "2024-01-10T09:00:00Z",
+		"1.1.0": "2024-05-31T23:59:59Z",
+		"2.0.0": "2024-07-01T00:00:00Z"
+	}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+
+	// 1.2.0 has no publish time, so it cannot be shown to predate the date
+	versions, err := client.ListVersionsAsOf("json-utils", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("ListVersionsAsOf() error = %v", err)
+	}
+	if want := []string{"1.0.0", "1.1.0"}; !reflect.DeepEqual(versions, want) {
+		t.Errorf("ListVersionsAsOf() = %v, want %v", versions, want)
+	}
+
+	body = `{"name": "json-utils", "versions": ["1.0.0"]}`
+	if _, err := client.ListVersionsAsOf("json-utils", time.Now()); err == nil || !strings.Contains(err.Error(), "does not record") {
+		t.Errorf("ListVersionsAsOf() without publish times error = %v", err)
+	}
+}
+
+func TestClient_DownloadPatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/package/json-utils/1.1.0/patch" || r.URL.Query().Get("from") != "1.0.0" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set(PatchFormatHeader, "zstd")
+		io.WriteString(w, "patch")
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+
+	reader, format, err := client.DownloadPatch("json-utils", "1.0.0", "1.1.0")
+	if err != nil {
+		t.Fatalf("DownloadPatch() error = %v", err)
+	}
+	defer reader.Close()
+	if data, _ := io.ReadAll(reader); string(data) != "patch" || format != "zstd" {
+		t.Errorf("DownloadPatch() = %q in format %q, want %q in zstd", data, format, "patch")
+	}
+
+	if _, _, err := client.DownloadPatch("json-utils", "0.9.0", "1.1.0"); !errors.Is(err, ErrNoPatch) {
+		t.Errorf("DownloadPatch() without a patch error = %v, want ErrNoPatch", err)
+	}
+}
+
+func TestClient_DownloadPackageFormat(t *testing.T) {
+	var gotPath, gotAccept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAccept = r.URL.Path, r.Header.Get("Accept")
+		w.Header().Set("Content-Type", "application/zstd")
+		io.WriteString(w, "archive")
+	}))
+	defer server.Close()
+
+	rc, err := NewClient(server.URL).DownloadPackage("big-data", "1.0.0", "tar.zst")
+	if err != nil {
+		t.Fatalf("DownloadPackage() error = %v", err)
+	}
+	rc.Close()
+	if gotPath != "/packages/big-data/1.0.0/big-data-1.0.0.tar.zst" {
+		t.Errorf("requested %s, want the tar.zst archive", gotPath)
+	}
+	if !strings.HasPrefix(gotAccept, "application/zstd, application/gzip;q=0.9") {
+		t.Errorf("Accept = %q, want zstd preferred over gzip", gotAccept)
+	}
+}
+
+func TestClient_EscapesPackagePaths(t *testing.T) {
+	var gotPaths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPaths = append(gotPaths, r.URL.EscapedPath())
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"name": "données utils", "version": "1.0.0", "versions": ["1.0.0"]}`)
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+
+	if _, err := client.GetPackageInfo("données utils", "1.0.0"); err != nil {
+		t.Fatalf("GetPackageInfo() error = %v", err)
+	}
+	if _, err := client.ListVersions("données utils"); err != nil {
+		t.Fatalf("ListVersions() error = %v", err)
+	}
+	want := []string{
+		"/api/package/donn%C3%A9es%20utils/1.0.0",
+		"/api/package/donn%C3%A9es%20utils/versions",
+	}
+	if !reflect.DeepEqual(gotPaths, want) {
+		t.Errorf("requested %v, want %v", gotPaths, want)
+	}
+
+	if got, want := client.DownloadURL("a b", "1.0.0", ""), server.URL+"/packages/a%20b/1.0.0/a%20b-1.0.0.tar.gz"; got != want {
+		t.Errorf("DownloadURL() = %s, want %s", got, want)
+	}
+}
+
+func TestClient_PublishRetries(t *testing.T) {
+	publishRetryDelay = time.Millisecond
+	t.Cleanup(func() { publishRetryDelay = time.Second })
+
+	archivePath := filepath.Join(t.TempDir(), "json-utils-1.0.0.tar.gz")
+	os.WriteFile(archivePath, []byte("archive"), 0644)
+	sum := sha256.Sum256([]byte("archive"))
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name       string
+		registered string
+		wantErr    string
+	}{
+		{name: "lost response of a publish that landed", registered: checksum},
+		{name: "version exists with different content", registered: "sha256:other", wantErr: "different content"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var keys []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/publish":
+					keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+					// The first attempt gets through, but its response is lost
+					if len(keys) == 1 {
+						w.WriteHeader(http.StatusBadGateway)
+						return
+					}
+					w.WriteHeader(http.StatusConflict)
+				case "/api/package/json-utils/1.0.0":
+					w.Header().Set("Content-Type", "application/json")
+					fmt.Fprintf(w, `{"name": "json-utils", "version": "1.0.0", "checksum": %q}`, tt.registered)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			err := NewClient(server.URL).Publish(archivePath, &PackageInfo{Name: "json-utils", Version: "1.0.0"})
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Publish() error = %v, want %q", err, tt.wantErr)
+			}
+			want := IdempotencyKey("json-utils", "1.0.0", checksum)
+			if !reflect.DeepEqual(keys, []string{want, want}) {
+				t.Errorf("idempotency keys = %q, want %q twice", keys, want)
+			}
+		})
+	}
+}
+
+func TestClient_Rename(t *testing.T) {
+	until := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	tombstone := fmt.Sprintf(`{"name": "json-utils", "versions": [], "renamed_to": "json-kit", "renamed_until": %q}`, until.Format(time.RFC3339))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/package/json-utils/rename":
+			body, _ := io.ReadAll(r.Body)
+			if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+				t.Errorf("rename Authorization = %q", got)
+			}
+			if !strings.Contains(string(body), `"new_name":"json-kit"`) {
+				t.Errorf("rename body = %s", body)
+			}
+			io.WriteString(w, tombstone)
+		case r.Method == http.MethodGet && r.URL.Path == "/api/package/json-utils/versions":
+			io.WriteString(w, tombstone)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+	client.SetAPIKey("secret")
+
+	list, err := client.Rename("json-utils", "json-kit")
+	if err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if list.RenamedTo != "json-kit" || list.RenamedUntil == nil || !list.RenamedUntil.Equal(until) {
+		t.Errorf("Rename() = %+v, want a tombstone pointing at json-kit until %s", list, until)
+	}
+
+	// Listing the old name reports the rename rather than no versions
+	_, err = client.ListVersions("json-utils")
+	var renamed *RenamedError
+	if !errors.As(err, &renamed) || renamed.RenamedTo != "json-kit" {
+		t.Errorf("ListVersions() error = %v, want a RenamedError", err)
+	}
+	if _, err := client.ListVersionsAsOf("json-utils", until); !errors.As(err, &renamed) {
+		t.Errorf("ListVersionsAsOf() error = %v, want a RenamedError", err)
+	}
+	if list, err := client.GetVersionList("json-utils"); err != nil || list.RenamedTo != "json-kit" {
+		t.Errorf("GetVersionList() = %+v, %v, want the tombstone", list, err)
+	}
+
+	if _, err := client.Rename("missing", "json-kit"); err == nil {
+		t.Error("Rename() of an unknown package succeeded")
+	}
+}
@@ -0,0 +1,111 @@
+package registry
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// AcceptEncoding lists the content encodings asked for on queries, best
+// first. Metadata such as version lists and search results is JSON that
+// compresses well, which matters most over slow links.
+const AcceptEncoding = "zstd, gzip, deflate"
+
+// encodingTransport negotiates compressed responses for queries and
+// decodes them, so callers always read the plain body. Downloads and
+// uploads ask for no encoding: archives are compressed already, and a
+// re-encoded response would hide the archive's size from progress output.
+// Requests with an Accept-Encoding of their own are left alone.
+type encodingTransport struct {
+	next http.RoundTripper
+	// op is the operation of requests not marked with one
+	op Operation
+}
+
+func (t *encodingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if req.Header.Get("Accept-Encoding") != "" {
+		return next.RoundTrip(req)
+	}
+	op, ok := req.Context().Value(operationKey{}).(Operation)
+	if !ok {
+		op = t.op
+	}
+
+	req = req.Clone(req.Context())
+	if op == OperationQuery || op == "" {
+		req.Header.Set("Accept-Encoding", AcceptEncoding)
+	} else {
+		req.Header.Set("Accept-Encoding", "identity")
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil || req.Method == http.MethodHead {
+		return resp, err
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" {
+		return resp, nil
+	}
+	body, err := decodeBody(encoding, resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to decode %s response from %s: %w", encoding, req.URL.Host, err)
+	}
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// decodeBody returns a reader of body decoded from encoding, closing body
+// when it is closed
+func decodeBody(encoding string, body io.ReadCloser) (io.ReadCloser, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		r, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return &decodedBody{Reader: r, close: r.Close, body: body}, nil
+	case "deflate":
+		r, err := zlib.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return &decodedBody{Reader: r, close: r.Close, body: body}, nil
+	case "zstd":
+		r, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return &decodedBody{Reader: r, close: func() error { r.Close(); return nil }, body: body}, nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+}
+
+// decodedBody reads a decoded response body and closes both the decoder
+// and the body underneath
+type decodedBody struct {
+	io.Reader
+	close func() error
+	body  io.ReadCloser
+}
+
+func (b *decodedBody) Close() error {
+	err := b.close()
+	if bodyErr := b.body.Close(); err == nil {
+		err = bodyErr
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package registry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestClient_ContentEncoding(t *testing.T) {
+	const versions = `{"name":"json-utils","versions":["1.0.0","1.1.0"]}`
+	encoders := map[string]func(io.Writer) io.WriteCloser{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"zstd": func(w io.Writer) io.WriteCloser {
+			zw, _ := zstd.NewWriter(w)
+			return zw
+		},
+	}
+
+	for _, encoding := range []string{"zstd", "gzip", "deflate", ""} {
+		t.Run("encoding "+encoding, func(t *testing.T) {
+			var queryAccept, downloadAccept string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasSuffix(r.URL.Path, "/versions") {
+					downloadAccept = r.Header.Get("Accept-Encoding")
+					w.Header().Set("Content-Type", "application/gzip")
+					io.WriteString(w, "archive")
+					return
+				}
+				queryAccept = r.Header.Get("Accept-Encoding")
+				w.Header().Set("Content-Type", "application/json")
+				if encoding == "" {
+					io.WriteString(w, versions)
+					return
+				}
+				var buf bytes.Buffer
+				enc := encoders[encoding](&buf)
+				io.WriteString(enc, versions)
+				enc.Close()
+				w.Header().Set("Content-Encoding", encoding)
+				w.Write(buf.Bytes())
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL)
+			got, err := client.ListVersions("json-utils")
+			if err != nil {
+				t.Fatalf("ListVersions() error = %v", err)
+			}
+			if want := []string{"1.0.0", "1.1.0"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("ListVersions() = %v, want %v", got, want)
+			}
+			if queryAccept != AcceptEncoding {
+				t.Errorf("query Accept-Encoding = %q, want %q", queryAccept, AcceptEncoding)
+			}
+
+			download, err := client.DownloadPackage("json-utils", "1.0.0", "tar.gz")
+			if err != nil {
+				t.Fatalf("DownloadPackage() error = %v", err)
+			}
+			defer download.Close()
+			if data, err := io.ReadAll(download); err != nil || string(data) != "archive" || download.Size != int64(len("archive")) {
+				t.Errorf("download = %q (%d bytes), %v", data, download.Size, err)
+			}
+			if downloadAccept != "identity" {
+				t.Errorf("download Accept-Encoding = %q, want identity", downloadAccept)
+			}
+		})
+	}
+}
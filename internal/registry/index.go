@@ -2,31 +2,184 @@
 package registry
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/fsutil"
 )
 
+// DefaultIndexPath is where registries without a configured index URL
+// publish their index
+const DefaultIndexPath = "/index.json"
+
+// IndexEntry lists the published versions of a package in a registry index.
+// The index is a static file a registry publishes next to its API, so the
+// checksums in it let archives be mirrored on hosts that are not trusted:
+// an archive is only installed when it matches the index.
 type IndexEntry struct {
 	Name     string   `json:"name"`
 	Versions []string `json:"versions"`
 	URL      string   `json:"url"`
+	// Checksums maps versions to the "sha256:<hex>" checksums of their
+	// archives
+	Checksums map[string]string `json:"checksums,omitempty"`
+	// Signatures maps versions to base64 ed25519 signatures of
+	// IndexMessage for the version, made with the registry's index key
+	Signatures map[string]string `json:"signatures,omitempty"`
+}
+
+// IndexMessage returns what the index signature of name@version signs
+func IndexMessage(name, version, checksum string) []byte {
+	return []byte(name + "@" + version + " " + checksum)
+}
+
+// Sign signs the checksum of every version of e with priv
+func (e *IndexEntry) Sign(priv ed25519.PrivateKey) {
+	e.Signatures = make(map[string]string, len(e.Checksums))
+	for version, checksum := range e.Checksums {
+		e.Signatures[version] = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, IndexMessage(e.Name, version, checksum)))
+	}
+}
+
+// Checksum returns the checksum the index lists for version, empty when it
+// lists none. With a key, the checksum must carry a valid signature made
+// with it.
+func (e IndexEntry) Checksum(version string, key ed25519.PublicKey) (string, error) {
+	checksum := e.Checksums[version]
+	if checksum == "" || key == nil {
+		return checksum, nil
+	}
+	signature, err := base64.StdEncoding.DecodeString(e.Signatures[version])
+	if err != nil || len(signature) == 0 {
+		return "", fmt.Errorf("index entry for %s@%s is not signed", e.Name, version)
+	}
+	if !ed25519.Verify(key, IndexMessage(e.Name, version, checksum), signature) {
+		return "", fmt.Errorf("index signature for %s@%s does not match the index key", e.Name, version)
+	}
+	return checksum, nil
 }
 
+// FetchIndex downloads the index at url, keyed by package name
 func FetchIndex(url string) (map[string]IndexEntry, error) {
-	resp, err := http.Get(url)
+	return fetchIndex(HTTPClient(OperationQuery), url)
+}
+
+// FetchIndex downloads the index at url through the client, keyed by
+// package name
+func (c *Client) FetchIndex(url string) (map[string]IndexEntry, error) {
+	return fetchIndex(c.httpClient, url)
+}
+
+func fetchIndex(httpClient *http.Client, url string) (map[string]IndexEntry, error) {
+	local, _, err := syncIndex(httpClient, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return local.Entries(), nil
+}
 
-	var idx []IndexEntry
-	if err := json.NewDecoder(resp.Body).Decode(&idx); err != nil {
-		return nil, err
+// LocalIndex is a copy of a registry index kept on disk, along with the
+// validators the server sent with it so updates only download a changed
+// index
+type LocalIndex struct {
+	URL          string       `json:"url"`
+	ETag         string       `json:"etag,omitempty"`
+	LastModified string       `json:"last_modified,omitempty"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+	Packages     []IndexEntry `json:"packages"`
+}
+
+// LoadLocalIndex reads the index copy at path, or returns nil when there is
+// none
+func LoadLocalIndex(path string) (*LocalIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read local index: %w", err)
+	}
+	var local LocalIndex
+	if err := json.Unmarshal(data, &local); err != nil {
+		return nil, fmt.Errorf("failed to parse local index %s: %w", path, err)
 	}
-	// map by name for easy lookup
-	m := make(map[string]IndexEntry, len(idx))
-	for _, e := range idx {
+	return &local, nil
+}
+
+// Save writes the index copy to path through a temporary file so readers
+// never see a partial index, nor concurrent saves each other's
+func (l *LocalIndex) Save(path string) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to save local index: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save local index: %w", err)
+	}
+	return nil
+}
+
+// Entries returns the packages of the index keyed by name
+func (l *LocalIndex) Entries() map[string]IndexEntry {
+	m := make(map[string]IndexEntry, len(l.Packages))
+	for _, e := range l.Packages {
 		m[e.Name] = e
 	}
-	return m, nil
+	return m
+}
+
+// SyncIndex brings local, a copy of the index at url or nil, up to date.
+// The index is only downloaded again when the server says it changed; the
+// returned copy is then a new one and changed is true.
+func (c *Client) SyncIndex(url string, local *LocalIndex) (updated *LocalIndex, changed bool, err error) {
+	return syncIndex(c.httpClient, url, local)
+}
+
+func syncIndex(httpClient *http.Client, url string, local *LocalIndex) (*LocalIndex, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid index URL: %w", err)
+	}
+	if local != nil && local.URL == url {
+		if local.ETag != "" {
+			req.Header.Set("If-None-Match", local.ETag)
+		}
+		if local.LastModified != "" {
+			req.Header.Set("If-Modified-Since", local.LastModified)
+		}
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && local != nil {
+		unchanged := *local
+		unchanged.UpdatedAt = time.Now().UTC()
+		return &unchanged, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, statusError("index fetch", resp)
+	}
+
+	updated := &LocalIndex{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		UpdatedAt:    time.Now().UTC(),
+	}
+	if err := decodeJSON(resp, &updated.Packages); err != nil {
+		return nil, false, fmt.Errorf("failed to decode index: %w", err)
+	}
+	return updated, true, nil
 }
@@ -0,0 +1,65 @@
+package registry
+
+import (
+	"crypto/ed25519"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIndexEntry_Checksum(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	entry := IndexEntry{Name: "json-utils", Checksums: map[string]string{"1.0.0": "sha256:aa", "1.1.0": "sha256:bb"}}
+	entry.Sign(priv)
+	unsigned := IndexEntry{Name: "json-utils", Checksums: entry.Checksums}
+	tampered := IndexEntry{Name: "json-utils", Checksums: map[string]string{"1.0.0": "sha256:cc"}, Signatures: entry.Signatures}
+
+	tests := []struct {
+		name    string
+		entry   IndexEntry
+		version string
+		key     ed25519.PublicKey
+		want    string
+		wantErr string
+	}{
+		{name: "signed", entry: entry, version: "1.1.0", key: pub, want: "sha256:bb"},
+		{name: "unsigned without a key", entry: unsigned, version: "1.0.0", want: "sha256:aa"},
+		{name: "unlisted version", entry: entry, version: "2.0.0", key: pub},
+		{name: "unsigned with a key", entry: unsigned, version: "1.0.0", key: pub, wantErr: "not signed"},
+		{name: "tampered checksum", entry: tampered, version: "1.0.0", key: pub, wantErr: "does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.entry.Checksum(tt.version, tt.key)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Checksum() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Checksum() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_FetchIndex(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name": "json-utils", "versions": ["1.0.0"], "checksums": {"1.0.0": "sha256:aa"}}]`))
+	}))
+	defer server.Close()
+
+	index, err := NewClient(server.URL).FetchIndex(server.URL + "/index.json")
+	if err != nil {
+		t.Fatalf("FetchIndex() error = %v", err)
+	}
+	if got := index["json-utils"].Checksums["1.0.0"]; got != "sha256:aa" {
+		t.Errorf("checksum of json-utils@1.0.0 = %q, want sha256:aa", got)
+	}
+}
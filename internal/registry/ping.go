@@ -0,0 +1,139 @@
+package registry
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// Auth states reported by Ping
+const (
+	AuthNotConfigured = "not configured"
+	AuthValid         = "valid"
+	AuthInvalid       = "invalid"
+	// AuthUnchecked means the registry has no endpoint to validate
+	// credentials against
+	AuthUnchecked = "unchecked"
+)
+
+// PingResult times the phases of a request to the registry. Phases that did
+// not happen, such as TLS for a plain HTTP registry or DNS for an IP
+// address, are zero.
+type PingResult struct {
+	URL     string        `json:"url"`
+	DNS     time.Duration `json:"dns_ns"`
+	Connect time.Duration `json:"connect_ns"`
+	TLS     time.Duration `json:"tls_ns"`
+	// Latency is the time from sending the health request to its complete
+	// response
+	Latency time.Duration `json:"latency_ns"`
+	Status  string        `json:"status,omitempty"`
+	Auth    string        `json:"auth"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// OK reports whether the registry answered and accepted any credentials
+func (p *PingResult) OK() bool {
+	return p.Error == "" && p.Auth != AuthInvalid
+}
+
+// Ping checks that the registry answers its health endpoint, timing DNS
+// lookup, connection, TLS handshake and the request itself on a fresh
+// connection, then validates the client's credentials if it has any
+func (c *Client) Ping() *PingResult {
+	result := &PingResult{URL: c.baseURL, Auth: AuthNotConfigured}
+
+	var dnsStart, connectStart, tlsStart time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:           func(httptrace.DNSDoneInfo) { result.DNS = time.Since(dnsStart) },
+		ConnectStart:      func(string, string) { connectStart = time.Now() },
+		ConnectDone:       func(string, string, error) { result.Connect = time.Since(connectStart) },
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { result.TLS = time.Since(tlsStart) },
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.apiURL+"/api/health", nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	// A reused connection would hide the connection and TLS costs
+	req.Close = true
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		result.Error = fmt.Sprintf("registry unreachable: %v", err)
+		return result
+	}
+	var health HealthResponse
+	if resp.StatusCode != http.StatusOK {
+		result.Error = statusError("registry health check", resp).Error()
+	} else if err := decodeJSON(resp, &health); err != nil {
+		result.Error = fmt.Sprintf("failed to decode health response: %v", err)
+	}
+	resp.Body.Close()
+	result.Latency = time.Since(start)
+	result.Status = health.Status
+	if result.Error != "" {
+		return result
+	}
+
+	if c.authType == "token" || c.authType == "basic" {
+		auth, err := c.validateAuth()
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.Auth = auth
+	}
+	return result
+}
+
+// validateAuth asks the registry whether the client's credentials are valid
+func (c *Client) validateAuth() (string, error) {
+	req, err := http.NewRequest(http.MethodGet, c.apiURL+"/api/auth/validate", nil)
+	if err != nil {
+		return "", err
+	}
+	c.authorize(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to validate credentials: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return AuthValid, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return AuthInvalid, nil
+	case http.StatusNotFound:
+		return AuthUnchecked, nil
+	}
+	return "", statusError("credential check", resp)
+}
+
+// get sends a GET request for rawURL with the client's credentials, which
+// private registries require for reading package metadata
+func (c *Client) get(rawURL string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(req)
+	return c.httpClient.Do(req)
+}
+
+// authorize adds the client's credentials to req
+func (c *Client) authorize(req *http.Request) {
+	if c.authType == "token" && c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	} else if c.authType == "basic" && c.username != "" && c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+}
@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newPingServer(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/health":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"status": "healthy"}`)
+		case "/api/auth/validate":
+			if token == "" {
+				http.NotFound(w, r)
+			} else if r.Header.Get("Authorization") != "Bearer "+token {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient_Ping(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		apiKey   string
+		wantAuth string
+		wantOK   bool
+	}{
+		{name: "no credentials", token: "secret", wantAuth: AuthNotConfigured, wantOK: true},
+		{name: "valid token", token: "secret", apiKey: "secret", wantAuth: AuthValid, wantOK: true},
+		{name: "invalid token", token: "secret", apiKey: "wrong", wantAuth: AuthInvalid, wantOK: false},
+		{name: "no validation endpoint", apiKey: "secret", wantAuth: AuthUnchecked, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newPingServer(t, tt.token)
+			c := NewClient(server.URL, WithHTTPClient(server.Client()))
+			if tt.apiKey != "" {
+				c.SetAPIKey(tt.apiKey)
+			}
+
+			result := c.Ping()
+			if result.Error != "" {
+				t.Fatalf("Ping() error = %s", result.Error)
+			}
+			if result.Status != "healthy" {
+				t.Errorf("Status = %q, want healthy", result.Status)
+			}
+			if result.Auth != tt.wantAuth {
+				t.Errorf("Auth = %q, want %q", result.Auth, tt.wantAuth)
+			}
+			if result.OK() != tt.wantOK {
+				t.Errorf("OK() = %v, want %v", result.OK(), tt.wantOK)
+			}
+			if result.TLS <= 0 || result.Connect <= 0 || result.Latency <= 0 {
+				t.Errorf("phases not timed: %+v", result)
+			}
+		})
+	}
+}
+
+func TestClient_PingUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	result := NewClient(server.URL).Ping()
+	if result.Error == "" || result.OK() {
+		t.Errorf("Ping() of a closed server = %+v, want an error", result)
+	}
+}
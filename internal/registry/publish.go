@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/warn"
+)
+
+// IdempotencyKeyHeader carries the key of a publish. Every attempt to
+// publish the same archive as the same version sends the same key, so a
+// registry can tell a retry from a second publish.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxPublishAttempts is how often a publish is tried when the registry
+// cannot be reached or fails with a server error
+const maxPublishAttempts = 3
+
+// publishRetryDelay is the wait before retrying a publish, doubling with
+// every attempt
+var publishRetryDelay = time.Second
+
+// IdempotencyKey returns the key of publishing the archive with checksum as
+// name@version
+func IdempotencyKey(name, version, checksum string) string {
+	sum := sha256.Sum256([]byte(name + "@" + version + " " + checksum))
+	return hex.EncodeToString(sum[:])
+}
+
+// sendPublish posts a publish request to url, retrying it when the registry
+// cannot be reached or fails with a server error. Whether a failed attempt
+// got through is unknown, so a retry the registry rejects because the
+// version exists is checked against the archive's checksum.
+func (c *Client) sendPublish(url, contentType string, body []byte, metadata *PackageInfo, checksum string) error {
+	key := IdempotencyKey(metadata.Name, metadata.Version, checksum)
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set(IdempotencyKeyHeader, key)
+		c.authorize(req)
+
+		resp, err := c.httpClient.Do(withOperation(req, OperationPublish))
+		if err != nil {
+			err = fmt.Errorf("failed to publish package: %w", err)
+		} else {
+			switch {
+			case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated:
+				resp.Body.Close()
+				return nil
+			case resp.StatusCode == http.StatusConflict:
+				resp.Body.Close()
+				return c.checkPublished(metadata, checksum)
+			case resp.StatusCode >= http.StatusInternalServerError:
+				err = statusError("publish", resp)
+				resp.Body.Close()
+			default:
+				err = statusError("publish", resp)
+				resp.Body.Close()
+				return err
+			}
+		}
+
+		if attempt == maxPublishAttempts {
+			return err
+		}
+		wait := publishRetryDelay << (attempt - 1)
+		warn.Printf(warn.Network, "%v; retrying in %s", err, wait)
+		time.Sleep(wait)
+	}
+}
+
+// checkPublished decides a publish the registry rejects because the version
+// already exists. When it holds the same archive, an earlier attempt whose
+// response was lost got through and the publish succeeded; different
+// content is an error.
+func (c *Client) checkPublished(metadata *PackageInfo, checksum string) error {
+	info, err := c.GetPackageInfo(metadata.Name, metadata.Version)
+	if err != nil {
+		return fmt.Errorf("%s@%s already exists, and its checksum could not be compared: %w", metadata.Name, metadata.Version, err)
+	}
+	switch info.Checksum {
+	case checksum:
+		return nil
+	case "":
+		return fmt.Errorf("%s@%s already exists, and the registry records no checksum to compare", metadata.Name, metadata.Version)
+	}
+	return fmt.Errorf("%s@%s already exists with different content (registry has %s, this archive is %s); publish it as a new version", metadata.Name, metadata.Version, info.Checksum, checksum)
+}
@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// maxRateChunk caps how much one Read may take from the bucket at once, so
+// parallel downloads sharing a limiter take turns instead of one of them
+// draining a whole second's worth of tokens
+const maxRateChunk = 32 << 10
+
+// RateLimiter is a token bucket that limits the combined throughput of the
+// readers it wraps. It is safe for concurrent use, so one limiter caps the
+// total bandwidth of parallel downloads. A nil *RateLimiter does not limit.
+type RateLimiter struct {
+	mu sync.Mutex
+	// rate is the refill rate in bytes per second, and burst the bucket size
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter allowing bytesPerSecond bytes per second
+// on average, with bursts of up to one second's worth. It returns nil, which
+// does not limit, when bytesPerSecond is not positive.
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	rate := float64(bytesPerSecond)
+	return &RateLimiter{rate: rate, burst: rate, tokens: rate, last: time.Now()}
+}
+
+// Reader wraps r so reads from it wait for tokens from the bucket
+func (l *RateLimiter) Reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &rateLimitedReader{r: r, limiter: l}
+}
+
+// wait takes n tokens, sleeping until the bucket has refilled enough to
+// cover them. The bucket may go into debt, which later callers pay off.
+func (l *RateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+type rateLimitedReader struct {
+	r       io.Reader
+	limiter *RateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	limit := maxRateChunk
+	if burst := int(r.limiter.burst); burst < limit {
+		limit = max(burst, 1)
+	}
+	if len(p) > limit {
+		p = p[:limit]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.limiter.wait(n)
+	}
+	return n, err
+}
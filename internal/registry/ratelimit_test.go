@@ -0,0 +1,62 @@
+package registry
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Reader(t *testing.T) {
+	const rate = 1 << 20
+	limiter := NewRateLimiter(rate)
+
+	// The first second's worth comes out of the full bucket, the rest at the
+	// limited rate
+	data := make([]byte, rate+rate/2)
+	start := time.Now()
+	n, err := io.Copy(io.Discard, limiter.Reader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("Copy() = %d bytes, want %d", n, len(data))
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("reading %d bytes at %d B/s took %v, want at least 400ms", len(data), rate, elapsed)
+	}
+}
+
+func TestRateLimiter_SharedByReaders(t *testing.T) {
+	const rate = 1 << 20
+	limiter := NewRateLimiter(rate)
+
+	// Two readers of half a bucket each fit in the burst together, a third
+	// has to wait for the refill
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			io.Copy(io.Discard, limiter.Reader(bytes.NewReader(make([]byte, rate/2))))
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("three readers sharing %d B/s took %v, want at least 400ms", rate, elapsed)
+	}
+}
+
+func TestNewRateLimiter_Unlimited(t *testing.T) {
+	if limiter := NewRateLimiter(0); limiter != nil {
+		t.Fatalf("NewRateLimiter(0) = %v, want nil", limiter)
+	}
+
+	r := bytes.NewReader([]byte("data"))
+	var limiter *RateLimiter
+	if got := limiter.Reader(r); got != io.Reader(r) {
+		t.Error("nil limiter wrapped the reader")
+	}
+}
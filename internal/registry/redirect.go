@@ -0,0 +1,104 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// maxRedirects is how many redirects a request follows, as net/http does
+const maxRedirects = 10
+
+// checkRedirect follows redirects, such as registries sending downloads to
+// presigned CDN URLs, without leaking credentials: Authorization and Cookie
+// headers are only sent to the host the request was made to, and a redirect
+// from HTTPS to plain HTTP is refused
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	first := via[0]
+	if first.URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return fmt.Errorf("refusing redirect from %s to insecure %s", first.URL.Host, redactURL(req.URL))
+	}
+	if req.URL.Host != first.URL.Host {
+		req.Header.Del("Authorization")
+		req.Header.Del("Cookie")
+	}
+	return nil
+}
+
+// redirectedOffHost reports whether resp came from another host than the
+// request was made to
+func redirectedOffHost(resp *http.Response) bool {
+	if resp.Request == nil || resp.Request.Response == nil {
+		return false
+	}
+	first := resp.Request
+	for first.Response != nil && first.Response.Request != nil {
+		first = first.Response.Request
+	}
+	return first.URL.Host != resp.Request.URL.Host
+}
+
+// errExpiredURL is a redirect target refusing a download, which presigned
+// URLs do once they expire
+var errExpiredURL = errors.New("download URL expired or was refused")
+
+// expiredRedirect reports whether resp is a redirect target refusing the
+// download, as an expired presigned URL does
+func expiredRedirect(resp *http.Response) bool {
+	if !redirectedOffHost(resp) {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusGone:
+		return true
+	}
+	return false
+}
+
+// redactURL drops the query of u, which holds the signature of a presigned
+// URL
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.RawQuery = ""
+	redacted.User = nil
+	return redacted.String()
+}
+
+// responseURL returns the URL resp came from, for error messages, without
+// the query of a redirect target
+func responseURL(resp *http.Response) string {
+	if redirectedOffHost(resp) {
+		return redactURL(resp.Request.URL)
+	}
+	return resp.Request.URL.String()
+}
+
+// download sends the request built by newRequest. A redirect target
+// refusing it, usually an expired presigned URL, is retried once with a
+// fresh request so the registry can issue a new URL.
+func (c *Client) download(newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		c.authorize(req)
+		resp, err := c.httpClient.Do(withOperation(req, OperationDownload))
+		if err != nil {
+			return nil, err
+		}
+		if !expiredRedirect(resp) {
+			return resp, nil
+		}
+		if attempt == 1 {
+			defer resp.Body.Close()
+			return nil, fmt.Errorf("%w even after requesting a new one: %s answered with status %d: %s",
+				errExpiredURL, responseURL(resp), resp.StatusCode, bodySnippet(resp.Body))
+		}
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,114 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newCDN serves archives at presigned URLs, refusing the first expired
+// requests it gets
+func newCDN(t *testing.T, expired int32) (*httptest.Server, *atomic.Value) {
+	t.Helper()
+	var auth atomic.Value
+	auth.Store("")
+	var refused atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a := r.Header.Get("Authorization"); a != "" {
+			auth.Store(a)
+		}
+		if refused.Add(1) <= expired {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, "Request has expired")
+			return
+		}
+		w.Header().Set("Content-Type", "application/gzip")
+		io.WriteString(w, "archive")
+	}))
+	t.Cleanup(server.Close)
+	return server, &auth
+}
+
+// newRedirectingRegistry redirects downloads to a fresh presigned URL on cdn
+func newRedirectingRegistry(t *testing.T, cdn string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var issued atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := issued.Add(1)
+		http.Redirect(w, r, fmt.Sprintf("%s/blob?sig=signature%d", cdn, n), http.StatusFound)
+	}))
+	t.Cleanup(server.Close)
+	return server, &issued
+}
+
+func TestClient_DownloadPackageFollowsRedirects(t *testing.T) {
+	tests := []struct {
+		name       string
+		expired    int32
+		wantIssued int32
+		wantErr    bool
+	}{
+		{name: "presigned URL", wantIssued: 1},
+		{name: "expired URL is renewed", expired: 1, wantIssued: 2},
+		{name: "URLs keep expiring", expired: 2, wantIssued: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cdn, cdnAuth := newCDN(t, tt.expired)
+			reg, issued := newRedirectingRegistry(t, cdn.URL)
+			client := NewClient(reg.URL)
+			client.SetAPIKey("secret")
+
+			download, err := client.DownloadPackage("json-utils", "1.0.0", "tar.gz")
+			if tt.wantErr {
+				if !errors.Is(err, errExpiredURL) {
+					t.Fatalf("DownloadPackage() error = %v, want an expired URL", err)
+				}
+				if strings.Contains(err.Error(), "signature") {
+					t.Errorf("error leaks the presigned URL: %v", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("DownloadPackage() error = %v", err)
+				}
+				data, _ := io.ReadAll(download)
+				download.Close()
+				if string(data) != "archive" {
+					t.Errorf("downloaded %q, want the archive", data)
+				}
+			}
+			if got := issued.Load(); got != tt.wantIssued {
+				t.Errorf("registry issued %d URLs, want %d", got, tt.wantIssued)
+			}
+			if a := cdnAuth.Load().(string); a != "" {
+				t.Errorf("CDN received Authorization %q", a)
+			}
+		})
+	}
+}
+
+func TestCheckRedirect_RefusesInsecureRedirect(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "archive")
+	}))
+	defer plain.Close()
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, plain.URL+"/blob", http.StatusFound)
+	}))
+	defer secure.Close()
+
+	client := NewClient(secure.URL, WithHTTPClient(secure.Client()))
+	_, err := client.DownloadPackage("json-utils", "1.0.0", "tar.gz")
+	if err == nil || !strings.Contains(err.Error(), "insecure") {
+		t.Errorf("DownloadPackage() error = %v, want the insecure redirect refused", err)
+	}
+}
@@ -0,0 +1,693 @@
+// Package registrytest provides an in-memory implementation of the Bifrost
+// registry API for hermetic tests of code that installs or publishes packages.
+//
+// A Registry can be served over a real listener with httptest.NewServer, or
+// used directly as an http.RoundTripper through Client:
+//
+//	reg := registrytest.New()
+//	reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0"}, archive)
+//	client := reg.Client()
+package registrytest
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/version"
+)
+
+// URL is the base URL used by clients returned from Registry.Client
+const URL = "https://registry.test"
+
+// Package is a single published version held by the fake registry
+type Package struct {
+	Info      registry.PackageInfo
+	Archive   []byte
+	Downloads int
+	// Patches maps older versions to zstd patches producing Archive
+	Patches map[string][]byte
+	// PatchDownloads counts patches served
+	PatchDownloads int
+	// Artifacts maps platform targets to their prebuilt archives
+	Artifacts map[string][]byte
+}
+
+// Registry is an in-memory registry implementing the HTTP API consumed by
+// registry.Client. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	packages map[string]map[string]*Package
+	users    map[string]string
+	tokens   map[string]string
+	requests []string
+	health   registry.HealthResponse
+	// distTags maps package names to their tags and the versions they
+	// point at
+	distTags map[string]map[string]string
+	// index is served at IndexPath instead of one built from the packages
+	// when set, and indexKey signs the built one
+	index    []registry.IndexEntry
+	indexKey ed25519.PrivateKey
+	// tombstones maps the old names of renamed packages to the version
+	// lists served for them
+	tombstones map[string]registry.VersionList
+}
+
+// RenameWindow is how long the registry keeps resolving the old name of a
+// renamed package
+const RenameWindow = 90 * 24 * time.Hour
+
+// IndexPath is where the registry serves its package index
+const IndexPath = registry.DefaultIndexPath
+
+// New returns an empty registry that accepts unauthenticated publishes until
+// a user is added
+func New() *Registry {
+	return &Registry{
+		packages:   make(map[string]map[string]*Package),
+		users:      make(map[string]string),
+		tokens:     make(map[string]string),
+		health:     registry.HealthResponse{Status: "healthy"},
+		distTags:   make(map[string]map[string]string),
+		tombstones: make(map[string]registry.VersionList),
+	}
+}
+
+// Client returns a registry client whose requests are served in-process by r
+func (r *Registry) Client() *registry.Client {
+	return registry.NewClient(URL, registry.WithTransport(r))
+}
+
+// AddPackage publishes a package version with the given archive contents.
+// If info has no checksum, the archive's checksum is recorded.
+func (r *Registry) AddPackage(info registry.PackageInfo, archive []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addPackageLocked(info, archive)
+}
+
+func (r *Registry) addPackageLocked(info registry.PackageInfo, archive []byte) {
+	versions, ok := r.packages[info.Name]
+	if !ok {
+		versions = make(map[string]*Package)
+		r.packages[info.Name] = versions
+	}
+	if info.Checksum == "" && archive != nil {
+		sum := sha256.Sum256(archive)
+		info.Checksum = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	versions[info.Version] = &Package{Info: info, Archive: archive}
+}
+
+// AddArtifact serves archive as the prebuilt archive of name@version for
+// the platform target, and lists its checksum in the version's metadata.
+// The version must already be published.
+func (r *Registry) AddArtifact(name, version, target string, archive []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pkg := r.packages[name][version]
+	if pkg.Artifacts == nil {
+		pkg.Artifacts = make(map[string][]byte)
+		pkg.Info.Artifacts = make(map[string]string)
+	}
+	sum := sha256.Sum256(archive)
+	pkg.Artifacts[target] = archive
+	pkg.Info.Artifacts[target] = "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// AddPatch serves patch as the zstd patch from name@from to name@to, which
+// must already be published
+func (r *Registry) AddPatch(name, from, to string, patch []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pkg := r.packages[name][to]
+	if pkg.Patches == nil {
+		pkg.Patches = make(map[string][]byte)
+	}
+	pkg.Patches[from] = patch
+}
+
+// AddUser registers credentials. Once any user exists, publishing requires
+// either basic auth with a known user or a bearer token issued at login.
+func (r *Registry) AddUser(username, password string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[username] = password
+}
+
+// SetHealth sets the response of the health endpoint
+func (r *Registry) SetHealth(health registry.HealthResponse) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.health = health
+}
+
+// SetDistTag points tag, such as "next", at a version of a package
+func (r *Registry) SetDistTag(name, tag, version string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.distTags[name] == nil {
+		r.distTags[name] = make(map[string]string)
+	}
+	r.distTags[name][tag] = version
+}
+
+// SetIndexKey signs the checksums in the index with priv
+func (r *Registry) SetIndexKey(priv ed25519.PrivateKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.indexKey = priv
+}
+
+// SetIndex pins the index served at IndexPath to entries, as a registry
+// whose index was published before its packages changed
+func (r *Registry) SetIndex(entries []registry.IndexEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.index = entries
+}
+
+// Index returns the index served at IndexPath: the pinned one, or one
+// listing every published version with its checksum
+func (r *Registry) Index() []registry.IndexEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.index != nil {
+		return r.index
+	}
+
+	names := make([]string, 0, len(r.packages))
+	for name := range r.packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := []registry.IndexEntry{}
+	for _, name := range names {
+		entry := registry.IndexEntry{Name: name, URL: URL + "/api/package/" + name, Checksums: make(map[string]string)}
+		for v, pkg := range r.packages[name] {
+			entry.Versions = append(entry.Versions, v)
+			entry.Checksums[v] = pkg.Info.Checksum
+		}
+		sort.Strings(entry.Versions)
+		if r.indexKey != nil {
+			entry.Sign(r.indexKey)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Package returns a published package version
+func (r *Registry) Package(name, version string) (*Package, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pkg, ok := r.packages[name][version]
+	return pkg, ok
+}
+
+// Requests returns the method and path of every request served so far
+func (r *Registry) Requests() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.requests...)
+}
+
+// RoundTrip serves req in-process, regardless of the host it targets
+func (r *Registry) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+// ServeHTTP implements http.Handler
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+	r.mu.Unlock()
+
+	path := req.URL.Path
+	switch {
+	case path == "/api/health" && req.Method == http.MethodGet:
+		r.mu.Lock()
+		health := r.health
+		r.mu.Unlock()
+		writeJSON(w, http.StatusOK, health)
+	case path == IndexPath && req.Method == http.MethodGet:
+		r.handleIndex(w, req)
+	case path == "/api/search" && req.Method == http.MethodGet:
+		r.handleSearch(w, req)
+	case path == "/api/browse" && req.Method == http.MethodGet:
+		r.handleBrowse(w, req)
+	case strings.HasPrefix(path, "/api/package/") && req.Method == http.MethodGet:
+		r.handlePackage(w, req)
+	case strings.HasPrefix(path, "/api/package/") && strings.HasSuffix(path, "/rename") && req.Method == http.MethodPost:
+		r.handleRename(w, req)
+	case strings.HasPrefix(path, "/packages/") && req.Method == http.MethodGet:
+		r.handleDownload(w, req)
+	case (path == "/api/publish" || path == "/api/publish-test") && req.Method == http.MethodPost:
+		r.handlePublish(w, req)
+	case path == "/api/register" && req.Method == http.MethodPost:
+		writeJSON(w, http.StatusOK, map[string]string{"status": "registered"})
+	case path == "/api/auth/login" && req.Method == http.MethodPost:
+		r.handleLogin(w, req)
+	case path == "/api/auth/validate" && req.Method == http.MethodGet:
+		if !r.authorized(req) {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "valid"})
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// handleIndex serves the index with an ETag of its contents, answering
+// requests for the version the client already has with 304 Not Modified
+func (r *Registry) handleIndex(w http.ResponseWriter, req *http.Request) {
+	data, err := json.Marshal(r.Index())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	if req.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (r *Registry) handleSearch(w http.ResponseWriter, req *http.Request) {
+	query := strings.ToLower(req.URL.Query().Get("q"))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	results := []registry.SearchResult{}
+	for name := range r.packages {
+		latest := r.latestLocked(name)
+		if latest == nil {
+			continue
+		}
+		if !strings.Contains(strings.ToLower(name), query) &&
+			!strings.Contains(strings.ToLower(latest.Info.Description), query) {
+			continue
+		}
+		results = append(results, r.resultLocked(name, latest))
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+// handleBrowse lists the packages whose latest version has the requested
+// category and keyword, sorted by name and paginated
+func (r *Registry) handleBrowse(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	category := query.Get("category")
+	keyword := query.Get("keyword")
+	page, perPage := 1, 20
+	if n, err := strconv.Atoi(query.Get("page")); err == nil && n > 0 {
+		page = n
+	}
+	if n, err := strconv.Atoi(query.Get("per_page")); err == nil && n > 0 {
+		perPage = n
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var matches []registry.SearchResult
+	for name := range r.packages {
+		latest := r.latestLocked(name)
+		if latest == nil {
+			continue
+		}
+		if category != "" && !containsFold(latest.Info.Categories, category) {
+			continue
+		}
+		if keyword != "" && !containsFold(latest.Info.Keywords, keyword) {
+			continue
+		}
+		matches = append(matches, r.resultLocked(name, latest))
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Name < matches[j].Name
+	})
+
+	result := registry.BrowsePage{Packages: []registry.SearchResult{}, Page: page, PerPage: perPage, Total: len(matches)}
+	if start := (page - 1) * perPage; start < len(matches) {
+		result.Packages = matches[start:min(start+perPage, len(matches))]
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// resultLocked returns the search result for a package, counting downloads
+// of all its versions
+func (r *Registry) resultLocked(name string, latest *Package) registry.SearchResult {
+	downloads := 0
+	for _, pkg := range r.packages[name] {
+		downloads += pkg.Downloads
+	}
+	return registry.SearchResult{
+		Name:        name,
+		Description: latest.Info.Description,
+		Version:     latest.Info.Version,
+		Downloads:   downloads,
+	}
+}
+
+// containsFold reports whether list contains s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathParts splits the path of req after prefix into its unescaped
+// segments, so the "/" of a scoped package name stays in its segment
+func pathParts(req *http.Request, prefix string) []string {
+	parts := strings.Split(strings.TrimPrefix(req.URL.EscapedPath(), prefix), "/")
+	for n, part := range parts {
+		if unescaped, err := url.PathUnescape(part); err == nil {
+			parts[n] = unescaped
+		}
+	}
+	return parts
+}
+
+func (r *Registry) handlePackage(w http.ResponseWriter, req *http.Request) {
+	parts := pathParts(req, "/api/package/")
+	if len(parts) == 3 && parts[2] == "patch" {
+		r.handlePatch(w, parts[0], parts[1], req.URL.Query().Get("from"))
+		return
+	}
+	if len(parts) != 2 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	name, ver := parts[0], parts[1]
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if tombstone, ok := r.tombstones[name]; ok && ver == "versions" {
+		writeJSON(w, http.StatusOK, tombstone)
+		return
+	}
+	versions, ok := r.packages[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "package not found")
+		return
+	}
+
+	if ver == "versions" {
+		list := registry.VersionList{Name: name, Versions: []string{}}
+		for v, pkg := range versions {
+			list.Versions = append(list.Versions, v)
+			if pkg.Info.PublishedAt != nil {
+				if list.PublishedAt == nil {
+					list.PublishedAt = make(map[string]time.Time)
+				}
+				list.PublishedAt[v] = *pkg.Info.PublishedAt
+			}
+		}
+		sort.Strings(list.Versions)
+		list.DistTags = r.distTags[name]
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+
+	var pkg *Package
+	if ver == "latest" {
+		pkg = r.latestLocked(name)
+	} else {
+		pkg = versions[ver]
+	}
+	if pkg == nil {
+		writeError(w, http.StatusNotFound, "version not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, pkg.Info)
+}
+
+func (r *Registry) handleDownload(w http.ResponseWriter, req *http.Request) {
+	parts := pathParts(req, "/packages/")
+	if len(parts) != 3 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	r.mu.Lock()
+	pkg, ok := r.packages[parts[0]][parts[1]]
+	format, mediaType := "tar.gz", "application/gzip"
+	if ok && pkg.Info.Format == "tar.zst" {
+		format, mediaType = "tar.zst", "application/zstd"
+	}
+	var data []byte
+	if ok {
+		ok = false
+		if parts[2] == parts[0]+"-"+parts[1]+"."+format {
+			data, ok = pkg.Archive, true
+		}
+		for target, artifact := range pkg.Artifacts {
+			if parts[2] == parts[0]+"-"+parts[1]+"-"+target+"."+format {
+				data, ok = artifact, true
+			}
+		}
+	}
+	if ok {
+		pkg.Downloads++
+	}
+	r.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "archive not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (r *Registry) handlePatch(w http.ResponseWriter, name, to, from string) {
+	r.mu.Lock()
+	var patch []byte
+	pkg, ok := r.packages[name][to]
+	if ok {
+		patch, ok = pkg.Patches[from]
+	}
+	if ok {
+		pkg.PatchDownloads++
+	}
+	r.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "patch not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(registry.PatchFormatHeader, "zstd")
+	w.WriteHeader(http.StatusOK)
+	w.Write(patch)
+}
+
+func (r *Registry) handlePublish(w http.ResponseWriter, req *http.Request) {
+	if !r.authorized(req) {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	if err := req.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid multipart form: "+err.Error())
+		return
+	}
+
+	var info registry.PackageInfo
+	if err := json.Unmarshal([]byte(req.FormValue("metadata")), &info); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid metadata: "+err.Error())
+		return
+	}
+	if info.Name == "" {
+		writeError(w, http.StatusBadRequest, "package name is required")
+		return
+	}
+	if _, err := version.Parse(info.Version); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	file, _, err := req.FormFile("package")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "package file is required")
+		return
+	}
+	defer file.Close()
+	archive, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.packages[info.Name][info.Version]; exists {
+		writeError(w, http.StatusConflict, "version already exists")
+		return
+	}
+	if req.URL.Path == "/api/publish" {
+		now := time.Now().UTC()
+		info.PublishedAt = &now
+		r.addPackageLocked(info, archive)
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]string{"status": "published"})
+}
+
+// handleRename moves every version of a package to a new name and leaves
+// a tombstone pointing at it under the old one
+func (r *Registry) handleRename(w http.ResponseWriter, req *http.Request) {
+	if !r.authorized(req) {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	parts := pathParts(req, "/api/package/")
+	if len(parts) != 2 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	oldName := parts[0]
+	var rename struct {
+		NewName string `json:"new_name"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&rename); err != nil || rename.NewName == "" {
+		writeError(w, http.StatusBadRequest, "new_name is required")
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versions, ok := r.packages[oldName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "package not found")
+		return
+	}
+	if _, taken := r.packages[rename.NewName]; taken || rename.NewName == oldName {
+		writeError(w, http.StatusConflict, "package "+rename.NewName+" already exists")
+		return
+	}
+
+	for _, pkg := range versions {
+		pkg.Info.Name = rename.NewName
+	}
+	r.packages[rename.NewName] = versions
+	delete(r.packages, oldName)
+	if tags, ok := r.distTags[oldName]; ok {
+		r.distTags[rename.NewName] = tags
+		delete(r.distTags, oldName)
+	}
+	until := time.Now().UTC().Add(RenameWindow)
+	tombstone := registry.VersionList{Name: oldName, Versions: []string{}, RenamedTo: rename.NewName, RenamedUntil: &until}
+	r.tombstones[oldName] = tombstone
+	writeJSON(w, http.StatusOK, tombstone)
+}
+
+func (r *Registry) handleLogin(w http.ResponseWriter, req *http.Request) {
+	var login struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&login); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	password, ok := r.users[login.Username]
+	if !ok || password != login.Password {
+		writeError(w, http.StatusUnauthorized, "invalid username or password")
+		return
+	}
+
+	token := "test-token-" + login.Username
+	r.tokens[token] = login.Username
+	writeJSON(w, http.StatusOK, map[string]string{
+		"api_key":  token,
+		"username": login.Username,
+	})
+}
+
+// authorized reports whether req carries valid credentials, or whether the
+// registry is open because no users were added
+func (r *Registry) authorized(req *http.Request) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.users) == 0 {
+		return true
+	}
+	if token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "); token != "" {
+		if _, ok := r.tokens[token]; ok {
+			return true
+		}
+	}
+	if username, password, ok := req.BasicAuth(); ok {
+		return r.users[username] == password
+	}
+	return false
+}
+
+// latestLocked returns the newest valid version of a package
+func (r *Registry) latestLocked(name string) *Package {
+	var latest *Package
+	var latestVersion *version.Version
+	for v, pkg := range r.packages[name] {
+		parsed, err := version.Parse(v)
+		if err != nil {
+			continue
+		}
+		if latestVersion == nil || parsed.Compare(latestVersion) > 0 {
+			latest, latestVersion = pkg, parsed
+		}
+	}
+	return latest
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
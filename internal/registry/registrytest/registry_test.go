@@ -0,0 +1,174 @@
+package registrytest
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/registry"
+)
+
+func writeArchive(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	data, err := Archive(files)
+	if err != nil {
+		t.Fatalf("Archive() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "package.tar.gz")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	return path
+}
+
+func TestRegistry_PublishAndInstallRoundTrip(t *testing.T) {
+	reg := New()
+	client := reg.Client()
+
+	archivePath := writeArchive(t, map[string]string{"src/main.crl": "grim Main:"})
+	metadata := &registry.PackageInfo{
+		Name:        "json-utils",
+		Version:     "1.0.0",
+		Description: "JSON helpers",
+	}
+	if err := client.Publish(archivePath, metadata); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	// Publishing the same archive again, as a retry would, succeeds, but
+	// other content under the same version does not
+	if err := client.Publish(archivePath, metadata); err != nil {
+		t.Errorf("republishing the same archive error = %v", err)
+	}
+	if err := client.Publish(writeArchive(t, map[string]string{"src/main.crl": "changed"}), metadata); err == nil {
+		t.Error("expected republishing the same version with other content to fail")
+	}
+
+	versions, err := client.ListVersions("json-utils")
+	if err != nil {
+		t.Fatalf("ListVersions() error = %v", err)
+	}
+	if len(versions) != 1 || versions[0] != "1.0.0" {
+		t.Errorf("ListVersions() = %v, want [1.0.0]", versions)
+	}
+
+	info, err := client.GetPackageLatest("json-utils")
+	if err != nil {
+		t.Fatalf("GetPackageLatest() error = %v", err)
+	}
+	if info.Description != "JSON helpers" {
+		t.Errorf("Description = %q, want %q", info.Description, "JSON helpers")
+	}
+
+	rc, err := client.DownloadPackage("json-utils", "1.0.0", "")
+	if err != nil {
+		t.Fatalf("DownloadPackage() error = %v", err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	want, _ := os.ReadFile(archivePath)
+	if string(got) != string(want) {
+		t.Error("downloaded archive differs from published archive")
+	}
+
+	results, err := client.Search("json")
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Downloads != 1 {
+		t.Errorf("Search() = %+v, want one result with one download", results)
+	}
+}
+
+func TestRegistry_PublishRequiresAuth(t *testing.T) {
+	reg := New()
+	reg.AddUser("alice", "secret")
+	archivePath := writeArchive(t, map[string]string{"README.md": "# pkg"})
+	metadata := &registry.PackageInfo{Name: "pkg", Version: "0.1.0"}
+
+	if err := reg.Client().Publish(archivePath, metadata); err == nil {
+		t.Fatal("expected unauthenticated publish to fail")
+	}
+
+	client := reg.Client()
+	client.SetBasicAuth("alice", "secret")
+	if err := client.Publish(archivePath, metadata); err != nil {
+		t.Fatalf("authenticated Publish() error = %v", err)
+	}
+	if _, ok := reg.Package("pkg", "0.1.0"); !ok {
+		t.Error("expected package to be stored after publish")
+	}
+}
+
+func TestRegistry_ServesOverHTTP(t *testing.T) {
+	reg := New()
+	reg.AddPackage(registry.PackageInfo{Name: "pkg", Version: "0.1.0"}, nil)
+
+	server := httptest.NewServer(reg)
+	defer server.Close()
+
+	client := registry.NewClient(server.URL)
+	if err := client.Health(); err != nil {
+		t.Fatalf("Health() error = %v", err)
+	}
+	if _, err := client.GetPackageInfo("pkg", "0.1.0"); err != nil {
+		t.Errorf("GetPackageInfo() error = %v", err)
+	}
+	if _, err := client.GetPackageInfo("pkg", "9.9.9"); err == nil {
+		t.Error("expected missing version to fail")
+	}
+}
+
+func TestRegistry_SetHealth(t *testing.T) {
+	reg := New()
+	reg.SetHealth(registry.HealthResponse{Status: "healthy", Version: "2.0.0", Features: []string{registry.FeatureYank}})
+
+	status, err := reg.Client().Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if status.Version != "2.0.0" || !status.Supports(registry.FeatureYank) || status.Supports(registry.FeatureDistTags) {
+		t.Errorf("Status() = %+v", status)
+	}
+}
+
+func TestRegistry_Browse(t *testing.T) {
+	reg := New()
+	reg.AddPackage(registry.PackageInfo{Name: "http-client", Version: "1.0.0", Categories: []string{"web"}, Keywords: []string{"http"}}, nil)
+	reg.AddPackage(registry.PackageInfo{Name: "router", Version: "0.2.0", Categories: []string{"Web"}}, nil)
+	reg.AddPackage(registry.PackageInfo{Name: "templates", Version: "1.1.0", Categories: []string{"web"}, Keywords: []string{"html"}}, nil)
+	reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0", Keywords: []string{"json"}}, nil)
+	client := reg.Client()
+
+	tests := []struct {
+		name      string
+		opts      registry.BrowseOptions
+		wantNames []string
+		wantTotal int
+	}{
+		{name: "category", opts: registry.BrowseOptions{Category: "web"}, wantNames: []string{"http-client", "router", "templates"}, wantTotal: 3},
+		{name: "keyword", opts: registry.BrowseOptions{Keyword: "json"}, wantNames: []string{"json-utils"}, wantTotal: 1},
+		{name: "category and keyword", opts: registry.BrowseOptions{Category: "web", Keyword: "html"}, wantNames: []string{"templates"}, wantTotal: 1},
+		{name: "second page", opts: registry.BrowseOptions{Category: "web", Page: 2, PerPage: 2}, wantNames: []string{"templates"}, wantTotal: 3},
+		{name: "past the end", opts: registry.BrowseOptions{Category: "web", Page: 3, PerPage: 2}, wantTotal: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := client.Browse(tt.opts)
+			if err != nil {
+				t.Fatalf("Browse() error = %v", err)
+			}
+			var names []string
+			for _, pkg := range page.Packages {
+				names = append(names, pkg.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") || page.Total != tt.wantTotal {
+				t.Errorf("Browse() = %v of %d, want %v of %d", names, page.Total, tt.wantNames, tt.wantTotal)
+			}
+		})
+	}
+}
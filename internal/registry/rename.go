@@ -0,0 +1,71 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/errcode"
+)
+
+// RenamedError is returned when listing the versions of a package the
+// registry has renamed. Its versions are published under RenamedTo, and the
+// old name resolves to it until RenamedUntil, when the registry sets one.
+type RenamedError struct {
+	Name         string
+	RenamedTo    string
+	RenamedUntil *time.Time
+}
+
+func (e *RenamedError) Error() string {
+	return fmt.Sprintf("package %s was renamed to %s", e.Name, e.RenamedTo)
+}
+
+// renamed returns the error describing the tombstone of a renamed package,
+// or nil when list is not one
+func (l *VersionList) renamed() error {
+	if l.RenamedTo == "" {
+		return nil
+	}
+	return &RenamedError{Name: l.Name, RenamedTo: l.RenamedTo, RenamedUntil: l.RenamedUntil}
+}
+
+// Rename moves every version of a package to newName. The registry keeps a
+// tombstone for the old name that points installs at the new one during a
+// deprecation window, and returns it.
+func (c *Client) Rename(oldName, newName string) (*VersionList, error) {
+	body, err := json.Marshal(map[string]string{"new_name": newName})
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/api/package/%s/rename", c.apiURL, url.PathEscape(oldName))
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rename request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.authorize(req)
+
+	resp, err := c.httpClient.Do(withOperation(req, OperationPublish))
+	if err != nil {
+		return nil, fmt.Errorf("failed to rename package: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+	case http.StatusNotFound:
+		return nil, errcode.PackageNotFound.Errorf("package %s not found", oldName)
+	default:
+		return nil, statusError("rename", resp)
+	}
+
+	var tombstone VersionList
+	if err := decodeJSON(resp, &tombstone); err != nil {
+		return nil, fmt.Errorf("failed to decode rename response: %w", err)
+	}
+	return &tombstone, nil
+}
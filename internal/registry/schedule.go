@@ -0,0 +1,206 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/warn"
+)
+
+const (
+	// MaxConcurrentRequests is how many requests run at once against one
+	// registry, across every client in the process. Further requests queue.
+	MaxConcurrentRequests = 8
+	// maxRateLimitRetries is how often a rate limited request is retried
+	maxRateLimitRetries = 5
+	// maxRateLimitWait is the longest a request waits for a rate limit to
+	// reset. Longer limits fail the request instead of hanging.
+	maxRateLimitWait = 2 * time.Minute
+)
+
+// requests schedules the requests of every client, per registry host
+var requests = &scheduler{hosts: make(map[string]*hostQueue)}
+
+type scheduler struct {
+	mu    sync.Mutex
+	hosts map[string]*hostQueue
+}
+
+// hostQueue holds the concurrency slots of one registry and when its rate
+// limit allows the next request
+type hostQueue struct {
+	slots chan struct{}
+	mu    sync.Mutex
+	until time.Time
+}
+
+func (s *scheduler) host(host string) *hostQueue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.hosts[host]
+	if !ok {
+		q = &hostQueue{slots: make(chan struct{}, MaxConcurrentRequests)}
+		s.hosts[host] = q
+	}
+	return q
+}
+
+// acquire takes a slot, then waits out any rate limit pause
+func (q *hostQueue) acquire(ctx context.Context) error {
+	select {
+	case q.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	q.mu.Lock()
+	wait := time.Until(q.until)
+	q.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		q.release()
+		return ctx.Err()
+	}
+}
+
+func (q *hostQueue) release() {
+	<-q.slots
+}
+
+// pause holds back requests to the host until t
+func (q *hostQueue) pause(t time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if t.After(q.until) {
+		q.until = t
+	}
+}
+
+// scheduledTransport sends requests through the scheduler. It keeps to
+// MaxConcurrentRequests per registry, holds requests back once the
+// X-RateLimit-* headers say the budget is spent, and retries requests the
+// registry rejects with 429 Too Many Requests after the delay it asks for.
+type scheduledTransport struct {
+	next http.RoundTripper
+}
+
+func (t *scheduledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	q := requests.host(req.URL.Host)
+
+	for attempt := 0; ; attempt++ {
+		if err := q.acquire(req.Context()); err != nil {
+			return nil, err
+		}
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			q.release()
+			return nil, err
+		}
+
+		now := time.Now()
+		if rl := parseRateLimit(resp.Header); rl != nil && rl.Remaining == 0 && rl.Reset != nil && rl.Reset.Sub(now) <= maxRateLimitWait {
+			q.pause(*rl.Reset)
+		}
+
+		wait, limited := retryDelay(resp, attempt, now)
+		if !limited || attempt == maxRateLimitRetries || !canWait(req, now.Add(wait)) {
+			resp.Body = &releasingBody{ReadCloser: resp.Body, release: q.release}
+			return resp, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		q.release()
+
+		retry, err := rewind(req)
+		if err != nil {
+			return nil, err
+		}
+		req = retry
+		q.pause(now.Add(wait))
+		warn.Printf(warn.Network, "%s is rate limiting requests, retrying in %s", req.URL.Host, wait.Round(time.Second))
+	}
+}
+
+// retryDelay returns how long to wait before retrying a response rejected
+// for rate limiting: its Retry-After, its X-RateLimit-Reset, or a backoff
+// doubling with every attempt
+func retryDelay(resp *http.Response, attempt int, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests &&
+		(resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "") {
+		return 0, false
+	}
+	if after := resp.Header.Get("Retry-After"); after != "" {
+		if seconds, err := strconv.Atoi(after); err == nil {
+			return time.Duration(max(seconds, 0)) * time.Second, true
+		}
+		if t, err := http.ParseTime(after); err == nil {
+			return max(t.Sub(now), 0), true
+		}
+	}
+	if rl := parseRateLimit(resp.Header); rl != nil && rl.Reset != nil {
+		return max(rl.Reset.Sub(now), 0), true
+	}
+	return time.Second << attempt, true
+}
+
+// canWait reports whether req may be retried at t: the wait is not longer
+// than maxRateLimitWait, ends before the request's deadline, and the
+// request body can be sent again
+func canWait(req *http.Request, t time.Time) bool {
+	if time.Until(t) > maxRateLimitWait {
+		return false
+	}
+	if deadline, ok := req.Context().Deadline(); ok && t.After(deadline) {
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// rewind returns a copy of req whose body can be sent again
+func rewind(req *http.Request) (*http.Request, error) {
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	return retry, nil
+}
+
+// releasingBody gives back the request's slot once the response body is
+// read to the end or closed, so a slow download keeps its slot while it
+// streams
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+func (b *releasingBody) Close() error {
+	b.once.Do(b.release)
+	return b.ReadCloser.Close()
+}
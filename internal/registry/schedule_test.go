@@ -0,0 +1,129 @@
+package registry
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/warn"
+)
+
+func TestScheduledTransport_RetriesRateLimited(t *testing.T) {
+	warn.SetOutput(io.Discard)
+	defer warn.SetOutput(os.Stderr)
+
+	var calls atomic.Int32
+	var bodies []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/slow":
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case calls.Add(1) == 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			io.WriteString(w, "ok")
+		}
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+
+	resp, err := client.httpClient.Post(server.URL+"/api/publish", "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(data) != "ok" {
+		t.Errorf("response = %d %q, want 200 ok", resp.StatusCode, data)
+	}
+	if len(bodies) != 2 || bodies[1] != "payload" {
+		t.Errorf("request bodies = %q, want the payload sent twice", bodies)
+	}
+
+	// A limit resetting too far in the future is reported, not waited for
+	resp, err = client.httpClient.Get(server.URL + "/slow")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", resp.StatusCode)
+	}
+}
+
+func TestScheduledTransport_LimitsConcurrency(t *testing.T) {
+	var current, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := current.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		current.Add(-1)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"status": "healthy"}`)
+	}))
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	for n := 0; n < 3*MaxConcurrentRequests; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := NewClient(server.URL).Health(); err != nil {
+				t.Errorf("Health() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := peak.Load(); got > MaxConcurrentRequests {
+		t.Errorf("%d concurrent requests, want at most %d", got, MaxConcurrentRequests)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		status      int
+		headers     map[string]string
+		attempt     int
+		want        time.Duration
+		wantLimited bool
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "unavailable without retry-after", status: http.StatusServiceUnavailable},
+		{name: "retry-after seconds", status: http.StatusTooManyRequests, headers: map[string]string{"Retry-After": "7"}, want: 7 * time.Second, wantLimited: true},
+		{name: "retry-after date", status: http.StatusServiceUnavailable, headers: map[string]string{"Retry-After": now.Add(time.Minute).Format(http.TimeFormat)}, want: time.Minute, wantLimited: true},
+		{name: "rate limit reset", status: http.StatusTooManyRequests, headers: map[string]string{"X-RateLimit-Limit": "10", "X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1792065630"}, want: 30 * time.Second, wantLimited: true},
+		{name: "backoff", status: http.StatusTooManyRequests, attempt: 2, want: 4 * time.Second, wantLimited: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: make(http.Header)}
+			for k, v := range tt.headers {
+				resp.Header.Set(k, v)
+			}
+			got, limited := retryDelay(resp, tt.attempt, now)
+			if got != tt.want || limited != tt.wantLimited {
+				t.Errorf("retryDelay() = %v, %v, want %v, %v", got, limited, tt.want, tt.wantLimited)
+			}
+		})
+	}
+}
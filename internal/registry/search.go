@@ -0,0 +1,58 @@
+package registry
+
+import "sync"
+
+// Source is a registry to search, under the name it has in the
+// configuration
+type Source struct {
+	Name   string
+	Client *Client
+}
+
+// SourcedResult is a search hit with the registries that have the package,
+// in the order the sources were given. Version, description and downloads
+// come from the first of them.
+type SourcedResult struct {
+	SearchResult
+	Registries []string `json:"registries"`
+}
+
+// SearchAll queries every source in parallel and merges the results by
+// package name, ordered by the first source that has each package. A source
+// that fails does not fail the search; its error is returned keyed by the
+// source name.
+func SearchAll(sources []Source, query string) ([]SourcedResult, map[string]error) {
+	results := make([][]SearchResult, len(sources))
+	errs := make([]error, len(sources))
+
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, client *Client) {
+			defer wg.Done()
+			results[i], errs[i] = client.Search(query)
+		}(i, source.Client)
+	}
+	wg.Wait()
+
+	var merged []SourcedResult
+	index := make(map[string]int)
+	failed := make(map[string]error)
+	for i, source := range sources {
+		if errs[i] != nil {
+			failed[source.Name] = errs[i]
+			continue
+		}
+		for _, result := range results[i] {
+			if j, ok := index[result.Name]; ok {
+				if registries := merged[j].Registries; registries[len(registries)-1] != source.Name {
+					merged[j].Registries = append(registries, source.Name)
+				}
+				continue
+			}
+			index[result.Name] = len(merged)
+			merged = append(merged, SourcedResult{SearchResult: result, Registries: []string{source.Name}})
+		}
+	}
+	return merged, failed
+}
@@ -0,0 +1,42 @@
+package registry
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSearchAll(t *testing.T) {
+	serve := func(status int, body string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			io.WriteString(w, body)
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	public := serve(http.StatusOK, `[{"name": "json-utils", "version": "1.2.0"}, {"name": "http-client", "version": "2.0.0"}]`)
+	internal := serve(http.StatusOK, `[{"name": "acme-auth", "version": "0.3.0"}, {"name": "json-utils", "version": "1.1.0-acme"}]`)
+	down := serve(http.StatusServiceUnavailable, `{"error": "maintenance"}`)
+
+	results, errs := SearchAll([]Source{
+		{Name: "default", Client: NewClient(public.URL)},
+		{Name: "acme", Client: NewClient(internal.URL)},
+		{Name: "mirror", Client: NewClient(down.URL)},
+	}, "json")
+
+	want := []SourcedResult{
+		{SearchResult: SearchResult{Name: "json-utils", Version: "1.2.0"}, Registries: []string{"default", "acme"}},
+		{SearchResult: SearchResult{Name: "http-client", Version: "2.0.0"}, Registries: []string{"default"}},
+		{SearchResult: SearchResult{Name: "acme-auth", Version: "0.3.0"}, Registries: []string{"acme"}},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("SearchAll() = %+v, want %+v", results, want)
+	}
+	if len(errs) != 1 || errs["mirror"] == nil {
+		t.Errorf("SearchAll() errors = %v, want one for mirror", errs)
+	}
+}
@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Optional API features a registry may list in its health response
+const (
+	// FeatureTokenAuth is login issuing bearer tokens
+	FeatureTokenAuth = "token-auth"
+	// FeatureYank is marking published versions as yanked
+	FeatureYank = "yank"
+	// FeatureDistTags is named tags such as "latest" pointing at versions
+	FeatureDistTags = "dist-tags"
+	// FeatureSignatures is serving package signatures
+	FeatureSignatures = "signatures"
+)
+
+// KnownFeatures lists the optional features bifrost can use
+var KnownFeatures = []string{FeatureTokenAuth, FeatureYank, FeatureDistTags, FeatureSignatures}
+
+// Supports reports whether the registry advertises feature
+func (h *HealthResponse) Supports(feature string) bool {
+	return slices.Contains(h.Features, feature)
+}
+
+// AdvertisesFeatures reports whether the registry lists its features at
+// all. Registries that do not may still support some of them.
+func (h *HealthResponse) AdvertisesFeatures() bool {
+	return h.Features != nil
+}
+
+// RateLimit is a registry's request budget
+type RateLimit struct {
+	Limit     int `json:"limit"`
+	Remaining int `json:"remaining"`
+	// Reset is when the budget is refilled, nil if not reported
+	Reset *time.Time `json:"reset,omitempty"`
+}
+
+// parseRateLimit reads the X-RateLimit-Limit, -Remaining and -Reset
+// headers. Reset is a Unix time.
+func parseRateLimit(h http.Header) *RateLimit {
+	limit, err := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return nil
+	}
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return nil
+	}
+	rl := &RateLimit{Limit: limit, Remaining: remaining}
+	if reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		t := time.Unix(reset, 0)
+		rl.Reset = &t
+	}
+	return rl
+}
@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient_StatusFeatures(t *testing.T) {
+	reset := time.Unix(1790000000, 0)
+	tests := []struct {
+		name          string
+		body          string
+		headers       map[string]string
+		wantVersion   string
+		wantAdvertise bool
+		wantYank      bool
+		wantLimit     *RateLimit
+		wantIndex     bool
+	}{
+		{
+			name: "minimal",
+			body: `{"status": "healthy"}`,
+		},
+		{
+			name:          "features and index",
+			body:          `{"status": "healthy", "version": "2.3.0", "features": ["token-auth", "yank"], "index_updated_at": "2026-10-01T12:00:00Z"}`,
+			wantVersion:   "2.3.0",
+			wantAdvertise: true,
+			wantYank:      true,
+			wantIndex:     true,
+		},
+		{
+			name:          "no features",
+			body:          `{"status": "healthy", "features": []}`,
+			wantAdvertise: true,
+		},
+		{
+			name:      "rate limit headers",
+			body:      `{"status": "healthy"}`,
+			headers:   map[string]string{"X-RateLimit-Limit": "5000", "X-RateLimit-Remaining": "4990", "X-RateLimit-Reset": "1790000000"},
+			wantLimit: &RateLimit{Limit: 5000, Remaining: 4990, Reset: &reset},
+		},
+		{
+			name:    "partial rate limit headers",
+			body:    `{"status": "healthy"}`,
+			headers: map[string]string{"X-RateLimit-Limit": "5000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.headers {
+					w.Header().Set(k, v)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			status, err := NewClient(server.URL).Status()
+			if err != nil {
+				t.Fatalf("Status() error = %v", err)
+			}
+			if status.Version != tt.wantVersion {
+				t.Errorf("Version = %q, want %q", status.Version, tt.wantVersion)
+			}
+			if status.AdvertisesFeatures() != tt.wantAdvertise {
+				t.Errorf("AdvertisesFeatures() = %v, want %v", status.AdvertisesFeatures(), tt.wantAdvertise)
+			}
+			if status.Supports(FeatureYank) != tt.wantYank {
+				t.Errorf("Supports(yank) = %v, want %v", status.Supports(FeatureYank), tt.wantYank)
+			}
+			if status.Supports(FeatureSignatures) {
+				t.Errorf("Supports(signatures) = true")
+			}
+			if (status.IndexUpdatedAt != nil) != tt.wantIndex {
+				t.Errorf("IndexUpdatedAt = %v", status.IndexUpdatedAt)
+			}
+			switch {
+			case tt.wantLimit == nil && status.RateLimit != nil:
+				t.Errorf("RateLimit = %+v, want nil", status.RateLimit)
+			case tt.wantLimit != nil && (status.RateLimit == nil || status.RateLimit.Limit != tt.wantLimit.Limit ||
+				status.RateLimit.Remaining != tt.wantLimit.Remaining || !status.RateLimit.Reset.Equal(*tt.wantLimit.Reset)):
+				t.Errorf("RateLimit = %+v, want %+v", status.RateLimit, tt.wantLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Operation is a kind of registry request, each bounded by its own timeout
+type Operation string
+
+const (
+	// OperationQuery is a health check, search or metadata lookup
+	OperationQuery Operation = "query"
+	// OperationDownload is the download of an archive, patch or changelog
+	OperationDownload Operation = "download"
+	// OperationPublish is the upload of a package
+	OperationPublish Operation = "publish"
+)
+
+// Timeouts bound registry requests, from sending them to reading the end
+// of the response, per kind of operation. A download is only bounded until
+// its response arrives and while its body makes no progress, so a large
+// archive read at a limited rate is not cut off. Zero means no limit.
+type Timeouts struct {
+	Query    time.Duration
+	Download time.Duration
+	Publish  time.Duration
+}
+
+// DefaultTimeouts keep queries short and give transfers time to finish
+var DefaultTimeouts = Timeouts{
+	Query:    30 * time.Second,
+	Download: 10 * time.Minute,
+	Publish:  10 * time.Minute,
+}
+
+// Uniform returns timeouts bounding every operation by d
+func Uniform(d time.Duration) Timeouts {
+	return Timeouts{Query: d, Download: d, Publish: d}
+}
+
+// Of returns the timeout of op
+func (t Timeouts) Of(op Operation) time.Duration {
+	switch op {
+	case OperationDownload:
+		return t.Download
+	case OperationPublish:
+		return t.Publish
+	}
+	return t.Query
+}
+
+var (
+	timeoutsMu sync.Mutex
+	timeouts   = DefaultTimeouts
+)
+
+// SetTimeouts sets the timeouts of clients created afterwards without
+// WithTimeouts
+func SetTimeouts(t Timeouts) {
+	timeoutsMu.Lock()
+	defer timeoutsMu.Unlock()
+	timeouts = t
+}
+
+func currentTimeouts() Timeouts {
+	timeoutsMu.Lock()
+	defer timeoutsMu.Unlock()
+	return timeouts
+}
+
+// WithTimeouts bounds the client's requests by t instead of the timeouts
+// set with SetTimeouts
+func WithTimeouts(t Timeouts) Option {
+	return func(c *Client) {
+		c.timeouts = t
+	}
+}
+
+// HTTPClient returns an HTTP client bounded by the timeout of op, for
+// requests made without a Client. Like a Client's, its queries ask for
+// compressed responses.
+func HTTPClient(op Operation) *http.Client {
+	return &http.Client{Transport: &timeoutTransport{
+		next:     &encodingTransport{op: op},
+		timeouts: currentTimeouts(),
+		op:       op,
+	}}
+}
+
+type operationKey struct{}
+
+// withOperation marks req as a request of op, which decides its timeout.
+// Unmarked requests are queries.
+func withOperation(req *http.Request, op Operation) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), operationKey{}, op))
+}
+
+// timeoutTransport bounds each request by the timeout of its operation.
+// Waiting for the scheduler and retries after rate limiting count towards
+// it. For queries and uploads the deadline lasts until the response body
+// is read or closed; for downloads it is pushed back whenever the body
+// makes progress, so only a stalled transfer times out.
+type timeoutTransport struct {
+	next     http.RoundTripper
+	timeouts Timeouts
+	// op is the operation of requests not marked with one
+	op Operation
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	op, ok := req.Context().Value(operationKey{}).(Operation)
+	if !ok {
+		op = t.op
+	}
+	if op == "" {
+		op = OperationQuery
+	}
+	d := t.timeouts.Of(op)
+	if d <= 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(d, func() { cancel(errTimedOut) })
+	body := &cancelingBody{ctx: ctx, op: op, timeout: d, cancel: func() {
+		timer.Stop()
+		cancel(nil)
+	}}
+
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		body.cancel()
+		return nil, body.wrap(err)
+	}
+	body.ReadCloser = resp.Body
+	if op == OperationDownload {
+		body.timer = timer
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// errTimedOut cancels a request whose timeout ran out
+var errTimedOut = errors.New("registry request timed out")
+
+// cancelingBody releases the request's deadline once the response body is
+// read to the end or closed. With timer set, every read that makes progress
+// pushes the deadline back by the timeout.
+type cancelingBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	op      Operation
+	timeout time.Duration
+	cancel  func()
+	timer   *time.Timer
+}
+
+// wrap names the timeout in err if the request failed because it ran out
+func (b *cancelingBody) wrap(err error) error {
+	if context.Cause(b.ctx) == errTimedOut {
+		return fmt.Errorf("%s timed out after %s: %w", b.op, b.timeout, err)
+	}
+	return err
+}
+
+func (b *cancelingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.timer != nil {
+		b.timer.Reset(b.timeout)
+	}
+	if err == io.EOF {
+		b.cancel()
+	} else if err != nil {
+		err = b.wrap(err)
+	}
+	return n, err
+}
+
+func (b *cancelingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
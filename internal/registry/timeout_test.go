@@ -0,0 +1,131 @@
+package registry
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_Timeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		if strings.HasSuffix(r.URL.Path, "/versions") {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"name":"json-utils","versions":["1.0.0"]}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/gzip")
+		io.WriteString(w, "archive")
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		timeouts     Timeouts
+		wantQueryErr bool
+		wantFetchErr bool
+	}{
+		{name: "defaults", timeouts: DefaultTimeouts},
+		{name: "short queries", timeouts: Timeouts{Query: 10 * time.Millisecond, Download: time.Minute}, wantQueryErr: true},
+		{name: "short downloads", timeouts: Timeouts{Query: time.Minute, Download: 10 * time.Millisecond}, wantFetchErr: true},
+		{name: "no limit", timeouts: Timeouts{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(server.URL, WithTimeouts(tt.timeouts))
+
+			_, err := client.ListVersions("json-utils")
+			if (err != nil) != tt.wantQueryErr {
+				t.Fatalf("ListVersions() error = %v, wantErr %v", err, tt.wantQueryErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "query timed out after 10ms") {
+				t.Errorf("ListVersions() error = %v, want the timeout named", err)
+			}
+
+			download, err := client.DownloadPackage("json-utils", "1.0.0", "tar.gz")
+			if (err != nil) != tt.wantFetchErr {
+				t.Fatalf("DownloadPackage() error = %v, wantErr %v", err, tt.wantFetchErr)
+			}
+			if err != nil {
+				return
+			}
+			defer download.Close()
+			if data, err := io.ReadAll(download); err != nil || string(data) != "archive" {
+				t.Errorf("download = %q, %v", data, err)
+			}
+		})
+	}
+}
+
+func TestClient_DownloadTimeoutIsIdle(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/gzip")
+		stalled := strings.Contains(r.URL.Path, "stalled")
+		for i := 0; i < 8; i++ {
+			io.WriteString(w, "chunk")
+			w.(http.Flusher).Flush()
+			if stalled && i == 1 {
+				time.Sleep(500 * time.Millisecond)
+			} else {
+				time.Sleep(40 * time.Millisecond)
+			}
+		}
+	}))
+	defer server.Close()
+
+	timeouts := Timeouts{Query: time.Minute, Download: 150 * time.Millisecond}
+	client := NewClient(server.URL, WithTimeouts(timeouts))
+	previous := currentTimeouts()
+	SetTimeouts(timeouts)
+	defer SetTimeouts(previous)
+
+	fromClient := func(name string) (io.ReadCloser, error) {
+		return client.DownloadPackage(name, "1.0.0", "tar.gz")
+	}
+	fromHTTPClient := func(name string) (io.ReadCloser, error) {
+		resp, err := HTTPClient(OperationDownload).Get(server.URL + "/" + name + ".tar.gz")
+		if err != nil {
+			return nil, err
+		}
+		return resp.Body, nil
+	}
+
+	tests := []struct {
+		name    string
+		fetch   func(name string) (io.ReadCloser, error)
+		pkg     string
+		wantErr bool
+	}{
+		{name: "client progressing", fetch: fromClient, pkg: "slow"},
+		{name: "client stalled", fetch: fromClient, pkg: "stalled", wantErr: true},
+		{name: "http client progressing", fetch: fromHTTPClient, pkg: "slow"},
+		{name: "http client stalled", fetch: fromHTTPClient, pkg: "stalled", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := tt.fetch(tt.pkg)
+			if err != nil {
+				t.Fatalf("fetch: %v", err)
+			}
+			defer body.Close()
+
+			// The whole transfer takes longer than the timeout
+			data, err := io.ReadAll(body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadAll() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), "download timed out after 150ms") {
+					t.Errorf("ReadAll() error = %v, want the timeout named", err)
+				}
+				return
+			}
+			if want := strings.Repeat("chunk", 8); string(data) != want {
+				t.Errorf("body = %q, want %q", data, want)
+			}
+		})
+	}
+}
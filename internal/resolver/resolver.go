@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sort"
 
+	"github.com/javanhut/bifrost/internal/errcode"
 	"github.com/javanhut/bifrost/internal/manifest"
 	"github.com/javanhut/bifrost/internal/version"
 )
@@ -12,6 +13,26 @@ type Package struct {
 	Name         string
 	Version      *version.Version
 	Dependencies map[string]version.Constraint
+	// Checksum is the expected "sha256:<hex>" checksum of the package
+	// archive, when known
+	Checksum string
+	// PackageName is the registry package installed under Name when Name is
+	// an alias, and empty otherwise
+	PackageName string
+	// Format is the archive format to download, "tar.gz" or "tar.zst".
+	// Empty means "tar.gz".
+	Format string
+	// Artifacts maps platform targets to the checksums of prebuilt archives
+	// installed instead of the package archive on those platforms
+	Artifacts map[string]string
+}
+
+// RegistryName returns the name pkg is published under in the registry
+func (p *Package) RegistryName() string {
+	if p.PackageName != "" {
+		return p.PackageName
+	}
+	return p.Name
 }
 
 type Resolution struct {
@@ -41,6 +62,9 @@ func (r *Resolver) Resolve(root *manifest.Manifest) (*Resolution, error) {
 	}
 
 	for name, constraintStr := range root.Dependencies {
+		if err := manifest.ValidateName(name); err != nil {
+			return nil, err
+		}
 		constraint, err := version.ParseConstraint(constraintStr)
 		if err != nil {
 			return nil, fmt.Errorf("invalid constraint for %s: %w", name, err)
@@ -64,7 +88,7 @@ func (r *Resolver) resolvePackage(pkg *Package, resolved map[string]*Package, st
 	// Check for circular dependencies
 	for _, name := range stack {
 		if name == pkg.Name {
-			return fmt.Errorf("circular dependency detected: %s", append(stack, pkg.Name))
+			return errcode.CircularDependency.Errorf("circular dependency detected: %s", append(stack, pkg.Name))
 		}
 	}
 
@@ -74,16 +98,20 @@ func (r *Resolver) resolvePackage(pkg *Package, resolved map[string]*Package, st
 		// Check if already resolved
 		if existing, ok := resolved[depName]; ok {
 			if !constraint.Satisfies(existing.Version) {
-				return fmt.Errorf("version conflict for %s: %s requires %s, but %s is already resolved",
+				return errcode.ResolutionConflict.Errorf("version conflict for %s: %s requires %s, but %s is already resolved",
 					depName, pkg.Name, constraint, existing.Version)
 			}
 			continue
 		}
 
+		if err := manifest.ValidateName(depName); err != nil {
+			return fmt.Errorf("%s depends on an invalid name: %w", pkg.Name, err)
+		}
+
 		// Find compatible version
 		candidates := r.packages[depName]
 		if len(candidates) == 0 {
-			return fmt.Errorf("package not found: %s", depName)
+			return errcode.PackageNotFound.Errorf("package not found: %s", depName)
 		}
 
 		// Sort by version (newest first)
@@ -101,7 +129,7 @@ func (r *Resolver) resolvePackage(pkg *Package, resolved map[string]*Package, st
 		}
 
 		if selected == nil {
-			return fmt.Errorf("no compatible version found for %s with constraint %s", depName, constraint)
+			return errcode.NoMatchingVersion.Errorf("no compatible version found for %s with constraint %s", depName, constraint)
 		}
 
 		// Add to resolved
@@ -0,0 +1,268 @@
+// Package stats summarizes disk usage and dependency use on this machine.
+// Everything is computed from local files and nothing is sent anywhere.
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/lockfile"
+)
+
+// HistoryFileName is the file in the Carrion home directory that keeps the
+// disk usage recorded by earlier runs
+const HistoryFileName = "stats-history.json"
+
+// maxHistory is how many snapshots the history file keeps
+const maxHistory = 100
+
+// Stats is a summary of local package usage
+type Stats struct {
+	CacheFiles int   `json:"cache_files"`
+	CacheBytes int64 `json:"cache_bytes"`
+	// Locations are the project, user and global package directories
+	Locations []Location `json:"locations"`
+	// Projects is how many lockfiles were scanned, zero when no directory
+	// was scanned
+	Projects int `json:"projects,omitempty"`
+	// Dependencies are the packages locked by the scanned projects, most
+	// used first
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+	// History is the disk usage recorded by earlier runs, oldest first
+	History []Snapshot `json:"history,omitempty"`
+}
+
+// Location is a directory packages are installed in
+type Location struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Packages int    `json:"packages"`
+	Versions int    `json:"versions"`
+	Files    int    `json:"files"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// Dependency is a package locked by one or more scanned projects
+type Dependency struct {
+	Name     string   `json:"name"`
+	Projects int      `json:"projects"`
+	Versions []string `json:"versions"`
+}
+
+// Snapshot is the disk usage at one point in time
+type Snapshot struct {
+	Time           time.Time `json:"time"`
+	CacheBytes     int64     `json:"cache_bytes"`
+	InstalledBytes int64     `json:"installed_bytes"`
+}
+
+// InstalledBytes returns the combined size of all locations
+func (s *Stats) InstalledBytes() int64 {
+	var total int64
+	for _, l := range s.Locations {
+		total += l.Bytes
+	}
+	return total
+}
+
+// Collect measures the cache and the package directories of cfg. When
+// projectsRoot is not empty, the lockfiles of projects below it are scanned
+// for the dependencies they use.
+func Collect(cfg *config.Config, projectsRoot string) (*Stats, error) {
+	s := &Stats{}
+	s.CacheFiles, s.CacheBytes = usage(cfg.CacheDir)
+
+	for _, dir := range []struct{ name, path string }{
+		{"project", cfg.LocalModulesPath()},
+		{"user", cfg.PackagesDir},
+		{"global", cfg.GetSharedGlobalPackagesDir()},
+	} {
+		l := Location{Name: dir.name, Path: dir.path}
+		l.Packages, l.Versions = countPackages(dir.path)
+		l.Files, l.Bytes = usage(dir.path)
+		s.Locations = append(s.Locations, l)
+	}
+
+	if projectsRoot != "" {
+		projects, deps, err := ScanProjects(projectsRoot, filepath.Base(cfg.ModulesDir))
+		if err != nil {
+			return nil, err
+		}
+		s.Projects = projects
+		s.Dependencies = deps
+	}
+	return s, nil
+}
+
+// ScanProjects reads every lockfile below root and returns how many were
+// found and the packages they lock, most used first. Hidden directories and
+// modules directories named modulesDir are skipped, as are lockfiles that
+// cannot be read.
+func ScanProjects(root, modulesDir string) (int, []Dependency, error) {
+	projects := 0
+	used := make(map[string]map[string]bool)
+	versions := make(map[string]map[string]bool)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(d.Name(), ".") || d.Name() == modulesDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != lockfile.FileName {
+			return nil
+		}
+		lock, err := lockfile.Load(path)
+		if err != nil {
+			return nil
+		}
+		projects++
+		project := filepath.Dir(path)
+		for _, pkg := range lock.Packages {
+			name := pkg.Name
+			if pkg.PackageName != "" {
+				name = pkg.PackageName
+			}
+			if used[name] == nil {
+				used[name] = make(map[string]bool)
+				versions[name] = make(map[string]bool)
+			}
+			used[name][project] = true
+			versions[name][pkg.Version] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+
+	deps := make([]Dependency, 0, len(used))
+	for name, projects := range used {
+		dep := Dependency{Name: name, Projects: len(projects)}
+		for v := range versions[name] {
+			dep.Versions = append(dep.Versions, v)
+		}
+		sort.Strings(dep.Versions)
+		deps = append(deps, dep)
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].Projects != deps[j].Projects {
+			return deps[i].Projects > deps[j].Projects
+		}
+		return deps[i].Name < deps[j].Name
+	})
+	return projects, deps, nil
+}
+
+// Record appends the disk usage in s to the history file of cfg, keeping
+// the most recent snapshots, and sets s.History to the earlier ones
+func Record(cfg *config.Config, s *Stats, now time.Time) error {
+	path := filepath.Join(cfg.HomeDir, HistoryFileName)
+	history, err := loadHistory(path)
+	if err != nil {
+		return err
+	}
+	s.History = history
+
+	history = append(history, Snapshot{Time: now.UTC(), CacheBytes: s.CacheBytes, InstalledBytes: s.InstalledBytes()})
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+	}
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cfg.HomeDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", cfg.HomeDir, err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write stats history: %w", err)
+	}
+	return nil
+}
+
+// loadHistory reads the snapshots in the history file at path. A missing
+// file yields no history.
+func loadHistory(path string) ([]Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read stats history: %w", err)
+	}
+	var history []Snapshot
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("failed to parse stats history %s: %w", path, err)
+	}
+	return history, nil
+}
+
+// countPackages returns how many packages and package versions are
+// installed in dir. A package directory holds one directory per version,
+// or a single flat layout version.
+func countPackages(dir string) (int, int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, 0
+	}
+	packages, versions := 0, 0
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		packageDir := filepath.Join(dir, entry.Name())
+		if config.FlatVersion(packageDir) != "" {
+			packages++
+			versions++
+			continue
+		}
+		subdirs, err := os.ReadDir(packageDir)
+		if err != nil {
+			continue
+		}
+		count := 0
+		for _, v := range subdirs {
+			if v.IsDir() || v.Type()&os.ModeSymlink != 0 {
+				count++
+			}
+		}
+		if count > 0 {
+			packages++
+			versions += count
+		}
+	}
+	return packages, versions
+}
+
+// usage returns the number and combined size of the regular files below
+// dir, without following links
+func usage(dir string) (int, int64) {
+	files := 0
+	var bytes int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		files++
+		if info, err := d.Info(); err == nil {
+			bytes += info.Size()
+		}
+		return nil
+	})
+	return files, bytes
+}
@@ -0,0 +1,126 @@
+package stats
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/config"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func newTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	tempDir := t.TempDir()
+	cfg := config.NewWithHome(filepath.Join(tempDir, "home"))
+	cfg.ModulesDir = filepath.Join(tempDir, "project", "carrion_modules")
+	cfg.GlobalPackagesDir = filepath.Join(tempDir, "global")
+	return cfg
+}
+
+func TestCollect(t *testing.T) {
+	cfg := newTestConfig(t)
+	writeFile(t, filepath.Join(cfg.CacheDir, "json-utils-1.0.0.tar.gz"), "12345")
+	writeFile(t, filepath.Join(cfg.ModulesDir, "json-utils", "1.0.0", "src", "main.crl"), "123")
+	writeFile(t, filepath.Join(cfg.ModulesDir, "json-utils", "1.1.0", "src", "main.crl"), "123")
+	writeFile(t, filepath.Join(cfg.ModulesDir, "http-client", config.VersionFile), "2.0.0\n")
+	writeFile(t, filepath.Join(cfg.GlobalPackagesDir, "refs.json"), "{}")
+
+	s, err := Collect(cfg, "")
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if s.CacheFiles != 1 || s.CacheBytes != 5 {
+		t.Errorf("cache = %d files, %d bytes, want 1 file, 5 bytes", s.CacheFiles, s.CacheBytes)
+	}
+
+	want := []Location{
+		{Name: "project", Path: cfg.ModulesDir, Packages: 2, Versions: 3, Files: 3, Bytes: 12},
+		{Name: "user", Path: cfg.PackagesDir},
+		{Name: "global", Path: cfg.GlobalPackagesDir, Files: 1, Bytes: 2},
+	}
+	if !reflect.DeepEqual(s.Locations, want) {
+		t.Errorf("Locations = %+v, want %+v", s.Locations, want)
+	}
+	if s.InstalledBytes() != 14 {
+		t.Errorf("InstalledBytes() = %d, want 14", s.InstalledBytes())
+	}
+}
+
+func TestScanProjects(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "app", "Bifrost.lock"), `version = 1
+
+[[package]]
+name = "json-utils"
+version = "1.0.0"
+
+[[package]]
+name = "http"
+version = "2.0.0"
+package = "http-client"
+`)
+	writeFile(t, filepath.Join(root, "tools", "cli", "Bifrost.lock"), `version = 1
+
+[[package]]
+name = "json-utils"
+version = "1.1.0"
+`)
+	// Lockfiles of installed packages and hidden directories are not projects
+	writeFile(t, filepath.Join(root, "app", "carrion_modules", "json-utils", "1.0.0", "Bifrost.lock"), "version = 1\n")
+	writeFile(t, filepath.Join(root, ".trash", "Bifrost.lock"), "version = 1\n")
+	writeFile(t, filepath.Join(root, "broken", "Bifrost.lock"), "version = [")
+
+	projects, deps, err := ScanProjects(root, "carrion_modules")
+	if err != nil {
+		t.Fatalf("ScanProjects() error = %v", err)
+	}
+	if projects != 2 {
+		t.Errorf("projects = %d, want 2", projects)
+	}
+	want := []Dependency{
+		{Name: "json-utils", Projects: 2, Versions: []string{"1.0.0", "1.1.0"}},
+		{Name: "http-client", Projects: 1, Versions: []string{"2.0.0"}},
+	}
+	if !reflect.DeepEqual(deps, want) {
+		t.Errorf("ScanProjects() = %+v, want %+v", deps, want)
+	}
+
+	if _, _, err := ScanProjects(filepath.Join(root, "missing"), "carrion_modules"); err == nil {
+		t.Error("ScanProjects() of a missing directory succeeded")
+	}
+}
+
+func TestRecord(t *testing.T) {
+	cfg := newTestConfig(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < maxHistory+5; i++ {
+		s := &Stats{CacheBytes: int64(i)}
+		if err := Record(cfg, s, start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+		if want := min(i, maxHistory); len(s.History) != want {
+			t.Fatalf("run %d: len(History) = %d, want %d", i, len(s.History), want)
+		}
+	}
+
+	history, err := loadHistory(filepath.Join(cfg.HomeDir, HistoryFileName))
+	if err != nil {
+		t.Fatalf("loadHistory() error = %v", err)
+	}
+	if len(history) != maxHistory || history[0].CacheBytes != 5 || history[len(history)-1].CacheBytes != maxHistory+4 {
+		t.Errorf("history kept %d snapshots from %d to %d", len(history), history[0].CacheBytes, history[len(history)-1].CacheBytes)
+	}
+}
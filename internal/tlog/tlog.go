@@ -0,0 +1,318 @@
+// Package tlog looks up package checksums in a Rekor-style transparency
+// log, an append-only Merkle tree of signed entries anyone can audit, so a
+// registry cannot serve one archive to some users and another to the rest
+// without it showing in the log.
+//
+// An entry is only accepted when its body records the checksum and its
+// inclusion proof leads to the tree root the log reports. With the log's
+// public key, the log's signature over the entry is checked too; without
+// it, the root comes from the same response as the entry, and a lookup
+// only shows that the server answering claims to have logged it.
+package tlog
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/errcode"
+	"github.com/javanhut/bifrost/internal/registry"
+)
+
+// ErrNotLogged is returned for a checksum the log has no entry for
+var ErrNotLogged error = &errcode.Error{Code: errcode.UnloggedArchive, Err: errors.New("not in the transparency log")}
+
+// Entry is a verified log entry recording a checksum
+type Entry struct {
+	UUID           string    `json:"uuid"`
+	LogIndex       int64     `json:"log_index"`
+	IntegratedTime time.Time `json:"integrated_time"`
+	// TreeSize and RootHash are the tree the inclusion proof was checked
+	// against
+	TreeSize int64  `json:"tree_size"`
+	RootHash string `json:"root_hash"`
+}
+
+// Client queries a transparency log
+type Client struct {
+	url string
+	key crypto.PublicKey
+}
+
+// New returns a client of the log at url. With a key, entries must carry a
+// valid signed entry timestamp made with it. A nil key leaves entries
+// unauthenticated.
+func New(url string, key crypto.PublicKey) *Client {
+	return &Client{url: strings.TrimRight(url, "/"), key: key}
+}
+
+// LoadKey reads a PEM public key of a log, ECDSA or ed25519
+func LoadKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transparency log key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("transparency log key %s is not PEM encoded", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transparency log key %s: %w", path, err)
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("transparency log key %s is neither ECDSA nor ed25519", path)
+}
+
+// URL returns the log's base URL
+func (c *Client) URL() string {
+	return c.url
+}
+
+// Find returns the entry recording checksum, a "sha256:<hex>" archive
+// checksum. Entries that do not verify are errors rather than skipped, as
+// the log serving them is a problem in itself.
+func (c *Client) Find(checksum string) (*Entry, error) {
+	digest, ok := strings.CutPrefix(checksum, "sha256:")
+	if !ok || len(digest) != sha256.Size*2 {
+		return nil, fmt.Errorf("unsupported checksum %q", checksum)
+	}
+
+	var uuids []string
+	if err := c.post("/api/v1/index/retrieve", map[string]string{"hash": checksum}, &uuids); err != nil {
+		return nil, err
+	}
+	if len(uuids) == 0 {
+		return nil, fmt.Errorf("%s is %w", checksum, ErrNotLogged)
+	}
+	var errs []error
+	for _, uuid := range uuids {
+		entry, err := c.entry(uuid, digest)
+		if err == nil {
+			return entry, nil
+		}
+		errs = append(errs, fmt.Errorf("entry %s: %w", uuid, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// logEntry is an entry as the log serves it
+type logEntry struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+	Verification   struct {
+		InclusionProof *struct {
+			Hashes   []string `json:"hashes"`
+			LogIndex int64    `json:"logIndex"`
+			RootHash string   `json:"rootHash"`
+			TreeSize int64    `json:"treeSize"`
+		} `json:"inclusionProof"`
+		SignedEntryTimestamp string `json:"signedEntryTimestamp"`
+	} `json:"verification"`
+}
+
+// entryBody is the part of an entry's body naming the hashed artifact, as
+// in hashedrekord and rekord entries
+type entryBody struct {
+	Spec struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+	} `json:"spec"`
+}
+
+// entry fetches the entry uuid and verifies that it records digest
+func (c *Client) entry(uuid, digest string) (*Entry, error) {
+	var entries map[string]logEntry
+	if err := c.get("/api/v1/log/entries/"+uuid, &entries); err != nil {
+		return nil, err
+	}
+	e, ok := entries[uuid]
+	if !ok || len(entries) != 1 {
+		return nil, errors.New("log returned another entry than the one asked for")
+	}
+
+	body, err := base64.StdEncoding.DecodeString(e.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body: %w", err)
+	}
+	var recorded entryBody
+	if err := json.Unmarshal(body, &recorded); err != nil {
+		return nil, fmt.Errorf("invalid body: %w", err)
+	}
+	if hash := recorded.Spec.Data.Hash; hash.Algorithm != "sha256" || !strings.EqualFold(hash.Value, digest) {
+		return nil, fmt.Errorf("records %s:%s rather than the checksum looked up", hash.Algorithm, hash.Value)
+	}
+
+	proof := e.Verification.InclusionProof
+	if proof == nil {
+		return nil, errors.New("no inclusion proof")
+	}
+	leaf := leafHash(body)
+	// Entry UUIDs end in the leaf hash, after an optional tree ID
+	if len(uuid) < 64 || !strings.EqualFold(uuid[len(uuid)-64:], hex.EncodeToString(leaf)) {
+		return nil, errors.New("UUID does not match the entry body")
+	}
+	if err := verifyInclusion(leaf, proof.LogIndex, proof.TreeSize, proof.Hashes, proof.RootHash); err != nil {
+		return nil, err
+	}
+	if c.key != nil {
+		if err := c.verifyTimestamp(e); err != nil {
+			return nil, err
+		}
+	}
+	return &Entry{
+		UUID:           uuid,
+		LogIndex:       e.LogIndex,
+		IntegratedTime: time.Unix(e.IntegratedTime, 0).UTC(),
+		TreeSize:       proof.TreeSize,
+		RootHash:       proof.RootHash,
+	}, nil
+}
+
+// verifyTimestamp checks the log's signature over e, made over the
+// canonical JSON of its body, integration time, log ID and index
+func (c *Client) verifyTimestamp(e logEntry) error {
+	signature, err := base64.StdEncoding.DecodeString(e.Verification.SignedEntryTimestamp)
+	if err != nil || len(signature) == 0 {
+		return errors.New("no signed entry timestamp")
+	}
+	// Fields in key order, which is what canonical JSON needs
+	payload, err := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{e.Body, e.IntegratedTime, e.LogID, e.LogIndex})
+	if err != nil {
+		return err
+	}
+	var valid bool
+	switch key := c.key.(type) {
+	case *ecdsa.PublicKey:
+		sum := sha256.Sum256(payload)
+		valid = ecdsa.VerifyASN1(key, sum[:], signature)
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(key, payload, signature)
+	}
+	if !valid {
+		return errors.New("signed entry timestamp does not match the log key")
+	}
+	return nil
+}
+
+// leafHash returns the RFC 6962 hash of a leaf
+func leafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// nodeHash returns the RFC 6962 hash of an inner node
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// verifyInclusion checks that the audit path hashes lead from leaf, at
+// index in a tree of size leaves, to rootHash, as RFC 9162 section 2.1.3.2
+// describes
+func verifyInclusion(leaf []byte, index, size int64, hashes []string, rootHash string) error {
+	if index < 0 || index >= size {
+		return fmt.Errorf("inclusion proof index %d is outside the tree of %d", index, size)
+	}
+	fn, sn := index, size-1
+	r := leaf
+	for _, h := range hashes {
+		p, err := hex.DecodeString(h)
+		if err != nil {
+			return fmt.Errorf("invalid inclusion proof hash: %w", err)
+		}
+		if sn == 0 {
+			return errors.New("inclusion proof is longer than the tree is deep")
+		}
+		if fn%2 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn%2 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	root, err := hex.DecodeString(rootHash)
+	if err != nil {
+		return fmt.Errorf("invalid root hash: %w", err)
+	}
+	if sn != 0 || !bytes.Equal(r, root) {
+		return errors.New("inclusion proof does not lead to the tree root")
+	}
+	return nil
+}
+
+func (c *Client) get(path string, v any) error {
+	req, err := http.NewRequest(http.MethodGet, c.url+path, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, v)
+}
+
+func (c *Client) post(path string, body, v any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.url+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, v)
+}
+
+func (c *Client) do(req *http.Request, v any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := registry.HTTPClient(registry.OperationQuery).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach transparency log: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("transparency log returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid transparency log response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package tlog
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/errcode"
+	"github.com/javanhut/bifrost/internal/tlog/tlogtest"
+)
+
+func checksum(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// writeKey writes log's public key to a file and loads it
+func writeKey(t *testing.T, log *tlogtest.Log) crypto.PublicKey {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rekor.pub")
+	if err := os.WriteFile(path, log.PublicKeyPEM(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	key, err := LoadKey(path)
+	if err != nil {
+		t.Fatalf("LoadKey() error = %v", err)
+	}
+	return key
+}
+
+func TestClient_Find(t *testing.T) {
+	log := tlogtest.New()
+	// Enough entries for inclusion proofs of every shape
+	for n := 0; n < 7; n++ {
+		log.Add(checksum(fmt.Sprint(n)))
+	}
+	srv := httptest.NewServer(log)
+	defer srv.Close()
+
+	client := New(srv.URL, writeKey(t, log))
+	for n := 0; n < 7; n++ {
+		entry, err := client.Find(checksum(fmt.Sprint(n)))
+		if err != nil {
+			t.Fatalf("Find(%d) error = %v", n, err)
+		}
+		if entry.LogIndex != int64(n) || entry.TreeSize != 7 {
+			t.Errorf("Find(%d) = index %d in a tree of %d", n, entry.LogIndex, entry.TreeSize)
+		}
+	}
+
+	_, err := client.Find(checksum("unlogged"))
+	if !errors.Is(err, ErrNotLogged) || errcode.Of(err) != errcode.UnloggedArchive {
+		t.Errorf("Find() of an unlogged checksum error = %v, want %v", err, ErrNotLogged)
+	}
+
+	// Entries signed with another key are refused
+	other := New(srv.URL, writeKey(t, tlogtest.New()))
+	if _, err := other.Find(checksum("0")); err == nil || !strings.Contains(err.Error(), "log key") {
+		t.Errorf("Find() with another log's key error = %v", err)
+	}
+}
+
+func TestClient_FindTamperedProof(t *testing.T) {
+	log := tlogtest.New()
+	for n := 0; n < 3; n++ {
+		log.Add(checksum(fmt.Sprint(n)))
+	}
+	// A log claiming another tree root than its entries lead to
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		log.ServeHTTP(rec, r)
+		body := rec.Body.String()
+		if i := strings.Index(body, `"rootHash":"`); i >= 0 {
+			i += len(`"rootHash":"`)
+			body = body[:i] + strings.Repeat("0", 64) + body[i+64:]
+		}
+		w.WriteHeader(rec.Code)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL, nil).Find(checksum("1"))
+	if err == nil || !strings.Contains(err.Error(), "tree root") {
+		t.Errorf("Find() with a tampered proof error = %v", err)
+	}
+}
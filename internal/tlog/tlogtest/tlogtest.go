@@ -0,0 +1,186 @@
+// Package tlogtest provides an in-memory Rekor-style transparency log for
+// hermetic tests of code that looks archives up in one. Serve it with
+// httptest.NewServer:
+//
+//	log := tlogtest.New()
+//	log.Add("sha256:...")
+//	srv := httptest.NewServer(log)
+package tlogtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogID is the log ID the log signs its entries with
+const LogID = "c0d23d6ad406973f9559f3ba2d1ca01f84147d8ffc5b8445c224f98b9591801d"
+
+// Log is an append-only log of hashedrekord entries
+type Log struct {
+	mu     sync.Mutex
+	bodies [][]byte
+	times  []int64
+	key    *ecdsa.PrivateKey
+}
+
+// New returns an empty log with a fresh signing key
+func New() *Log {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return &Log{key: key}
+}
+
+// Add appends an entry recording checksum, a "sha256:<hex>" checksum
+func (l *Log) Add(checksum string) {
+	body, _ := json.Marshal(map[string]any{
+		"apiVersion": "0.0.1",
+		"kind":       "hashedrekord",
+		"spec": map[string]any{
+			"data": map[string]any{
+				"hash": map[string]string{"algorithm": "sha256", "value": strings.TrimPrefix(checksum, "sha256:")},
+			},
+		},
+	})
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bodies = append(l.bodies, body)
+	l.times = append(l.times, time.Now().Unix())
+}
+
+// PublicKeyPEM returns the PEM public key the log signs entries with
+func (l *Log) PublicKeyPEM() []byte {
+	der, err := x509.MarshalPKIXPublicKey(&l.key.PublicKey)
+	if err != nil {
+		panic(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func (l *Log) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/index/retrieve":
+		var req struct {
+			Hash string `json:"hash"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		uuids := []string{}
+		value := strings.TrimPrefix(req.Hash, "sha256:")
+		for _, body := range l.bodies {
+			if strings.Contains(string(body), `"value":"`+value+`"`) {
+				uuids = append(uuids, hex.EncodeToString(leafHash(body)))
+			}
+		}
+		json.NewEncoder(w).Encode(uuids)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/v1/log/entries/"):
+		uuid := strings.TrimPrefix(r.URL.Path, "/api/v1/log/entries/")
+		for index, body := range l.bodies {
+			if hex.EncodeToString(leafHash(body)) == uuid {
+				json.NewEncoder(w).Encode(map[string]any{uuid: l.entry(index)})
+				return
+			}
+		}
+		http.NotFound(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// entry returns the entry at index as the log serves it, with an inclusion
+// proof in the current tree and a signed entry timestamp
+func (l *Log) entry(index int) map[string]any {
+	body := base64.StdEncoding.EncodeToString(l.bodies[index])
+	payload, _ := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{body, l.times[index], LogID, int64(index)})
+	sum := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, l.key, sum[:])
+	if err != nil {
+		panic(err)
+	}
+
+	leaves := make([][]byte, len(l.bodies))
+	for i, b := range l.bodies {
+		leaves[i] = leafHash(b)
+	}
+	var hashes []string
+	for _, h := range path(index, leaves) {
+		hashes = append(hashes, hex.EncodeToString(h))
+	}
+	return map[string]any{
+		"body":           body,
+		"integratedTime": l.times[index],
+		"logID":          LogID,
+		"logIndex":       index,
+		"verification": map[string]any{
+			"inclusionProof": map[string]any{
+				"hashes":   hashes,
+				"logIndex": index,
+				"rootHash": hex.EncodeToString(root(leaves)),
+				"treeSize": len(leaves),
+			},
+			"signedEntryTimestamp": base64.StdEncoding.EncodeToString(signature),
+		},
+	}
+}
+
+func leafHash(data []byte) []byte {
+	sum := sha256.Sum256(append([]byte{0}, data...))
+	return sum[:]
+}
+
+func nodeHash(left, right []byte) []byte {
+	sum := sha256.Sum256(append(append([]byte{1}, left...), right...))
+	return sum[:]
+}
+
+// split returns the largest power of two smaller than n
+func split(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
+
+// root returns the RFC 6962 tree hash of leaves
+func root(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := split(len(leaves))
+	return nodeHash(root(leaves[:k]), root(leaves[k:]))
+}
+
+// path returns the RFC 6962 audit path of the leaf at index
+func path(index int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := split(len(leaves))
+	if index < k {
+		return append(path(index, leaves[:k]), root(leaves[k:]))
+	}
+	return append(path(index-k, leaves[k:]), root(leaves[:k]))
+}
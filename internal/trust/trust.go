@@ -0,0 +1,100 @@
+package trust
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/javanhut/bifrost/internal/fsutil"
+)
+
+// Decision is the answer given when a package version asked to run its
+// install scripts
+type Decision struct {
+	Package   string    `json:"package"`
+	Version   string    `json:"version"`
+	Allow     bool      `json:"allow"`
+	DecidedAt time.Time `json:"decided_at"`
+}
+
+// Store holds the remembered decisions, so installing the same package
+// version again does not ask again
+type Store struct {
+	Decisions []Decision `json:"decisions"`
+}
+
+// Load reads the decisions at path. A missing file yields none.
+func Load(path string) (*Store, error) {
+	s := &Store{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read trust decisions: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse trust decisions %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Save writes the decisions to path through a temporary file of its own, so
+// neither readers nor other saves see a partial file
+func (s *Store) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to write trust decisions: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write trust decisions: %w", err)
+	}
+	return nil
+}
+
+// Find returns the decision made for name@version, or nil when none was
+func (s *Store) Find(name, version string) *Decision {
+	for n := range s.Decisions {
+		if d := &s.Decisions[n]; d.Package == name && d.Version == version {
+			return d
+		}
+	}
+	return nil
+}
+
+// Set records d, replacing any earlier decision for the same package
+// version
+func (s *Store) Set(d Decision) {
+	if existing := s.Find(d.Package, d.Version); existing != nil {
+		*existing = d
+		return
+	}
+	s.Decisions = append(s.Decisions, d)
+	sort.Slice(s.Decisions, func(a, b int) bool {
+		if s.Decisions[a].Package != s.Decisions[b].Package {
+			return s.Decisions[a].Package < s.Decisions[b].Package
+		}
+		return s.Decisions[a].Version < s.Decisions[b].Version
+	})
+}
+
+// Revoke forgets the decisions for name@version, or for every version of
+// name when version is empty, and returns the ones it forgot
+func (s *Store) Revoke(name, version string) []Decision {
+	var kept, revoked []Decision
+	for _, d := range s.Decisions {
+		if d.Package == name && (version == "" || d.Version == version) {
+			revoked = append(revoked, d)
+		} else {
+			kept = append(kept, d)
+		}
+	}
+	s.Decisions = kept
+	return revoked
+}
@@ -0,0 +1,56 @@
+package trust
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore_SetFindRevoke(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "home", "trust.json")
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() of a missing file error = %v", err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	s.Set(Decision{Package: "json-utils", Version: "1.0.0", Allow: true, DecidedAt: now})
+	s.Set(Decision{Package: "json-utils", Version: "1.1.0", DecidedAt: now})
+	s.Set(Decision{Package: "http-client", Version: "2.0.0", Allow: true, DecidedAt: now})
+	// A new answer replaces the earlier one
+	s.Set(Decision{Package: "json-utils", Version: "1.0.0", DecidedAt: now})
+	if err := s.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	s, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(s.Decisions) != 3 || s.Decisions[0].Package != "http-client" {
+		t.Fatalf("Decisions = %+v, want 3 sorted by package", s.Decisions)
+	}
+	if d := s.Find("json-utils", "1.0.0"); d == nil || d.Allow || !d.DecidedAt.Equal(now) {
+		t.Errorf("Find(json-utils@1.0.0) = %+v, want a denial", d)
+	}
+	if d := s.Find("json-utils", "2.0.0"); d != nil {
+		t.Errorf("Find(json-utils@2.0.0) = %+v, want nil", d)
+	}
+
+	tests := []struct {
+		name, version string
+		want          int
+	}{
+		{"json-utils", "1.1.0", 1},
+		{"json-utils", "1.1.0", 0},
+		{"json-utils", "", 1},
+		{"http-client", "", 1},
+	}
+	for _, tt := range tests {
+		if got := s.Revoke(tt.name, tt.version); len(got) != tt.want {
+			t.Errorf("Revoke(%s, %q) = %+v, want %d decisions", tt.name, tt.version, got, tt.want)
+		}
+	}
+	if len(s.Decisions) != 0 {
+		t.Errorf("Decisions after revoking everything = %+v", s.Decisions)
+	}
+}
@@ -0,0 +1,88 @@
+package uninstall
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/javanhut/bifrost/internal/journal"
+	"github.com/javanhut/bifrost/internal/refs"
+)
+
+// PlanGC returns the global package versions GC would delete
+func (u *Uninstaller) PlanGC() ([]Removal, error) {
+	r, err := refs.Load(u.refsPath())
+	if err != nil {
+		return nil, err
+	}
+	r.Prune()
+	return u.unreferenced(r), nil
+}
+
+// GC deletes global package versions that no project references any more,
+// after dropping references from projects that no longer exist. Versions
+// installed before references were recorded are left alone.
+func (u *Uninstaller) GC() ([]Removal, error) {
+	if err := u.config.CheckStoreWrite(); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(u.config.GetSharedGlobalPackagesDir()); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	var removals []Removal
+	err := refs.Update(u.refsPath(), func(r *refs.Refs) error {
+		r.Prune()
+		removals = u.unreferenced(r)
+
+		for _, removal := range removals {
+			txn, err := journal.Open(u.config.JournalPath()).Begin(journal.OpUninstall, removal.Path)
+			if err != nil {
+				return err
+			}
+			if err := os.RemoveAll(removal.Path); err != nil {
+				return fmt.Errorf("failed to remove %s@%s: %w", removal.Package, removal.Version, err)
+			}
+			if err := txn.Commit(); err != nil {
+				return err
+			}
+			if err := deactivate(removal.Path); err != nil {
+				return err
+			}
+			packageDir := filepath.Dir(removal.Path)
+			if isEmpty, _ := u.isDirEmpty(packageDir); isEmpty {
+				os.Remove(packageDir)
+			}
+		}
+
+		// Versions already deleted by hand are forgotten too
+		for name, versions := range r.Unreferenced() {
+			for _, version := range versions {
+				r.Forget(name, version)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removals, nil
+}
+
+// unreferenced returns a removal for every tracked global version that is
+// installed and has no references
+func (u *Uninstaller) unreferenced(r *refs.Refs) []Removal {
+	unreferenced := r.Unreferenced()
+
+	var removals []Removal
+	for _, name := range sortedKeys(unreferenced) {
+		for _, version := range unreferenced[name] {
+			path := filepath.Join(u.config.GetSharedGlobalPackagesDir(), name, version)
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			removals = append(removals, newRemoval(name, version, path))
+		}
+	}
+	return removals
+}
@@ -0,0 +1,239 @@
+package uninstall
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/link"
+)
+
+// Location is where a package version is installed
+type Location string
+
+const (
+	// LocationLocal is the project's carrion_modules directory
+	LocationLocal Location = "local"
+	// LocationUser is the user package directory
+	LocationUser Location = "user"
+	// LocationGlobal is the shared global package directory
+	LocationGlobal Location = "global"
+	// LocationAll is every location a package is installed in
+	LocationAll Location = "all"
+)
+
+// ParseLocation parses a --location value
+func ParseLocation(s string) (Location, error) {
+	switch loc := Location(s); loc {
+	case LocationLocal, LocationUser, LocationGlobal, LocationAll:
+		return loc, nil
+	}
+	return "", fmt.Errorf("invalid location %q: expected local, user, global or all", s)
+}
+
+// Installation is a package version installed in one location
+type Installation struct {
+	Version  string   `json:"version"`
+	Location Location `json:"location"`
+	Path     string   `json:"path"`
+	// Link is a local entry linking to the package in another location,
+	// rather than a copy of its own
+	Link bool `json:"link,omitempty"`
+}
+
+// Installed returns every installed version of packageName, local ones
+// first, then those in the user and global package directories
+func (u *Uninstaller) Installed(packageName string) []Installation {
+	var installed []Installation
+	if version := u.flatVersion(packageName, false); version != "" {
+		path := u.config.LocalPackagePath(packageName, version)
+		installed = append(installed, Installation{Version: version, Location: LocationLocal, Path: path, Link: isLink(path)})
+	} else if u.config.Layout != config.LayoutFlat {
+		installed = append(installed, versionsIn(filepath.Join(u.config.ModulesDir, packageName), LocationLocal)...)
+	}
+	installed = append(installed, versionsIn(filepath.Join(u.config.PackagesDir, packageName), LocationUser)...)
+	installed = append(installed, versionsIn(filepath.Join(u.config.GetSharedGlobalPackagesDir(), packageName), LocationGlobal)...)
+	return installed
+}
+
+// searchOrder is the order imports search the locations packages are
+// installed in. A copy of a package in an earlier location shadows copies in
+// later ones.
+var searchOrder = []Location{LocationLocal, LocationUser, LocationGlobal}
+
+// InstalledPackage is a package version installed in one location
+type InstalledPackage struct {
+	Name string `json:"name"`
+	Installation
+	// ShadowedBy is the earlier location imports find the package in
+	// instead of this copy
+	ShadowedBy Location `json:"shadowed_by,omitempty"`
+}
+
+// InstalledAt returns every package version installed in loc, or in every
+// location for LocationAll, grouped by location in search order and sorted
+// by name within each
+func (u *Uninstaller) InstalledAt(loc Location) ([]InstalledPackage, error) {
+	names := make(map[string]bool)
+	for _, dir := range []string{u.config.ModulesDir, u.config.PackagesDir, u.config.GetSharedGlobalPackagesDir()} {
+		entries, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read packages directory: %w", err)
+		}
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), ".") {
+				names[entry.Name()] = true
+			}
+		}
+	}
+
+	var packages []InstalledPackage
+	for _, l := range searchOrder {
+		if loc != LocationAll && loc != l {
+			continue
+		}
+		for _, name := range sortedKeys(names) {
+			installed := u.Installed(name)
+			for _, in := range installed {
+				if in.Location == l {
+					packages = append(packages, InstalledPackage{Name: name, Installation: in, ShadowedBy: shadowedBy(installed, l)})
+				}
+			}
+		}
+	}
+	return packages, nil
+}
+
+// shadowedBy returns the first location before loc holding a copy of the
+// package of its own, empty when imports find the copy in loc. Links to a
+// copy elsewhere do not shadow it.
+func shadowedBy(installed []Installation, loc Location) Location {
+	for _, l := range searchOrder {
+		if l == loc {
+			return ""
+		}
+		for _, in := range installed {
+			if in.Location == l && !in.Link {
+				return l
+			}
+		}
+	}
+	return ""
+}
+
+// versionsIn returns the versions installed in a package directory
+func versionsIn(dir string, loc Location) []Installation {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var installed []Installation
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(path); err != nil || !info.IsDir() || entry.Name() == config.CurrentLink {
+			continue
+		}
+		installed = append(installed, Installation{Version: entry.Name(), Location: loc, Path: path, Link: isLink(path)})
+	}
+	return installed
+}
+
+// isLink reports whether path links to a package installed elsewhere
+func isLink(path string) bool {
+	return link.IsSymlink(path) || link.IsCopy(path)
+}
+
+// PrintInstalled writes where each version in installed is, marking those
+// that removals delete
+func PrintInstalled(w io.Writer, packageName string, installed []Installation, removals []Removal) {
+	removed := make(map[string]bool)
+	for _, r := range removals {
+		removed[r.Path] = true
+	}
+	fmt.Fprintf(w, "%s is installed in:\n", packageName)
+	for _, in := range installed {
+		line := fmt.Sprintf("  %-10s %-7s %s", in.Version, in.Location, in.Path)
+		if in.Link {
+			line += " (link)"
+		}
+		if removed[in.Path] {
+			line += " <- remove"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// UninstallAt uninstalls packageName, one version or with an empty version
+// every version, from loc. LocationAll uninstalls it from every location
+// it is installed in; an empty loc is the project's carrion_modules when
+// the package is there, or else the user package directory.
+func (u *Uninstaller) UninstallAt(packageName, version string, loc Location) error {
+	locs, err := u.locations(packageName, version, loc)
+	if err != nil {
+		return err
+	}
+	for _, l := range locs {
+		if err := u.at(l, func(global bool) error {
+			return u.UninstallPackage(packageName, version, global)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PlanAt returns what UninstallAt would delete, without deleting it
+func (u *Uninstaller) PlanAt(packageName, version string, loc Location) ([]Removal, error) {
+	locs, err := u.locations(packageName, version, loc)
+	if err != nil {
+		return nil, err
+	}
+	var removals []Removal
+	for _, l := range locs {
+		if err := u.at(l, func(global bool) error {
+			planned, err := u.PlanPackage(packageName, version, global)
+			removals = append(removals, planned...)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return removals, nil
+}
+
+// locations resolves loc to the locations an uninstall of packageName at
+// version, or every version, works through
+func (u *Uninstaller) locations(packageName, version string, loc Location) ([]Location, error) {
+	if loc != LocationAll {
+		return []Location{loc}, nil
+	}
+	var locs []Location
+	seen := make(map[Location]bool)
+	for _, in := range u.Installed(packageName) {
+		if (version == "" || in.Version == version) && !seen[in.Location] {
+			seen[in.Location] = true
+			locs = append(locs, in.Location)
+		}
+	}
+	if len(locs) == 0 {
+		if version != "" {
+			return nil, fmt.Errorf("package %s@%s is not installed", packageName, version)
+		}
+		return nil, fmt.Errorf("package %s is not installed", packageName)
+	}
+	return locs, nil
+}
+
+// at runs fn with the uninstaller restricted to loc
+func (u *Uninstaller) at(loc Location, fn func(global bool) error) error {
+	if loc == LocationGlobal {
+		return fn(true)
+	}
+	previous := u.location
+	u.location = loc
+	defer func() { u.location = previous }()
+	return fn(false)
+}
@@ -0,0 +1,147 @@
+package uninstall
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/javanhut/bifrost/internal/archive"
+	"github.com/javanhut/bifrost/internal/manifest"
+	"github.com/javanhut/bifrost/internal/refs"
+)
+
+// Removal is a directory or file an uninstall would delete
+type Removal struct {
+	Package string `json:"package,omitempty"`
+	Version string `json:"version,omitempty"`
+	Path    string `json:"path"`
+	Files   int    `json:"files"`
+	Bytes   int64  `json:"bytes"`
+	// Reason says why a stale entry found by gc is removed
+	Reason string `json:"reason,omitempty"`
+}
+
+// PlanPackage returns what UninstallPackage would delete, without deleting
+// it. Global versions other projects still use are left out.
+func (u *Uninstaller) PlanPackage(packageName string, version string, global bool) ([]Removal, error) {
+	paths := make(map[string]string)
+	if flat := u.flatVersion(packageName, global); version == "" && flat != "" {
+		version = flat
+	}
+	if version != "" {
+		packagePath, err := u.versionPath(packageName, version, global)
+		if err != nil {
+			return nil, err
+		}
+		paths[version] = packagePath
+	} else {
+		packageDir, versions, err := u.packageDir(packageName, global)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range versions {
+			paths[v.Name()] = filepath.Join(packageDir, v.Name())
+		}
+	}
+
+	var r *refs.Refs
+	if global {
+		var err error
+		if r, err = refs.Load(u.refsPath()); err != nil {
+			return nil, err
+		}
+	}
+
+	var removals []Removal
+	for _, v := range sortedKeys(paths) {
+		if r != nil && len(u.release(r, packageName, v)) > 0 {
+			continue
+		}
+		removals = append(removals, newRemoval(packageName, v, paths[v]))
+	}
+	return removals, nil
+}
+
+// PlanManifest returns what UninstallFromManifest would delete. Dependencies
+// that are not installed are left out, as UninstallFromManifest skips them.
+func (u *Uninstaller) PlanManifest(manifestPath string) ([]Removal, error) {
+	m, err := manifest.Load(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifest: %w", err)
+	}
+
+	allDeps := make(map[string]string)
+	for name, version := range m.Dependencies {
+		allDeps[name] = version
+	}
+	for name, version := range m.DevDependencies {
+		allDeps[name] = version
+	}
+
+	var removals []Removal
+	for _, name := range sortedKeys(allDeps) {
+		version := allDeps[name]
+		if removesAllVersions(version) {
+			version = ""
+		}
+		planned, err := u.PlanPackage(name, version, false)
+		if err != nil {
+			continue
+		}
+		removals = append(removals, planned...)
+	}
+	return removals, nil
+}
+
+// PlanCleanCache returns what CleanCache would delete
+func (u *Uninstaller) PlanCleanCache() ([]Removal, error) {
+	entries, err := os.ReadDir(u.config.CacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	var removals []Removal
+	for _, entry := range entries {
+		removals = append(removals, newRemoval("", "", filepath.Join(u.config.CacheDir, entry.Name())))
+	}
+	return removals, nil
+}
+
+// PrintRemovals writes one line per removal followed by the total size
+func PrintRemovals(w io.Writer, removals []Removal) {
+	var files int
+	var bytes int64
+	for _, r := range removals {
+		name := r.Path
+		if r.Package != "" && r.Reason == "" {
+			name = fmt.Sprintf("%s@%s (%s)", r.Package, r.Version, r.Path)
+		}
+		if r.Reason != "" {
+			name += " (" + r.Reason + ")"
+		}
+		fmt.Fprintf(w, "  %s: %d file(s), %s\n", name, r.Files, archive.FormatSize(r.Bytes))
+		files += r.Files
+		bytes += r.Bytes
+	}
+	fmt.Fprintf(w, "Total: %d file(s), %s\n", files, archive.FormatSize(bytes))
+}
+
+func newRemoval(packageName, version, path string) Removal {
+	r := Removal{Package: packageName, Version: version, Path: path}
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		r.Files++
+		if info, err := d.Info(); err == nil {
+			r.Bytes += info.Size()
+		}
+		return nil
+	})
+	return r
+}
@@ -0,0 +1,339 @@
+package uninstall
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/link"
+	"github.com/javanhut/bifrost/internal/refs"
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+)
+
+func newTestUninstaller(t *testing.T) (*Uninstaller, *config.Config) {
+	t.Helper()
+
+	cfg := config.NewWithHome(t.TempDir())
+	cfg.ModulesDir = filepath.Join(t.TempDir(), "carrion_modules")
+	if err := cfg.Init(); err != nil {
+		t.Fatalf("failed to init config: %v", err)
+	}
+
+	for _, pkg := range []struct{ name, version string }{
+		{"json-utils", "1.0.0"},
+		{"json-utils", "1.2.0"},
+		{"http-client", "2.0.0"},
+	} {
+		dir := cfg.LocalPackagePath(pkg.name, pkg.version)
+		os.MkdirAll(filepath.Join(dir, "src"), 0755)
+		os.WriteFile(filepath.Join(dir, "src", "main.crl"), []byte("grim Main:"), 0644)
+		os.WriteFile(filepath.Join(dir, "Bifrost.toml"), []byte("[package]"), 0644)
+	}
+	os.WriteFile(cfg.CachePath("json-utils-1.0.0.tar.gz"), []byte("archive"), 0644)
+
+	return New(cfg), cfg
+}
+
+func TestUninstaller_PlanPackage(t *testing.T) {
+	u, cfg := newTestUninstaller(t)
+
+	removals, err := u.PlanPackage("json-utils", "", false)
+	if err != nil {
+		t.Fatalf("PlanPackage() error = %v", err)
+	}
+	if len(removals) != 2 {
+		t.Fatalf("PlanPackage() = %+v, want both versions", removals)
+	}
+	for _, r := range removals {
+		if r.Files != 2 || r.Bytes != int64(len("grim Main:")+len("[package]")) {
+			t.Errorf("removal %+v has wrong size", r)
+		}
+	}
+
+	removals, err = u.PlanPackage("json-utils", "1.2.0", false)
+	if err != nil {
+		t.Fatalf("PlanPackage() error = %v", err)
+	}
+	if len(removals) != 1 || removals[0].Path != cfg.LocalPackagePath("json-utils", "1.2.0") {
+		t.Errorf("PlanPackage() = %+v", removals)
+	}
+
+	if _, err := u.PlanPackage("json-utils", "9.9.9", false); err == nil {
+		t.Error("expected an error for a version that is not installed")
+	}
+
+	// Planning never deletes anything
+	if _, err := os.Stat(cfg.LocalPackagePath("json-utils", "1.0.0")); err != nil {
+		t.Errorf("planning removed a package: %v", err)
+	}
+}
+
+func TestUninstaller_PlanManifest(t *testing.T) {
+	u, _ := newTestUninstaller(t)
+
+	manifestPath := filepath.Join(t.TempDir(), "Bifrost.toml")
+	os.WriteFile(manifestPath, []byte(`[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+json-utils = "^1.0.0"
+http-client = "2.0.0"
+missing = "1.0.0"
+`), 0644)
+
+	removals, err := u.PlanManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("PlanManifest() error = %v", err)
+	}
+
+	var got []string
+	for _, r := range removals {
+		got = append(got, r.Package+"@"+r.Version)
+	}
+	want := "http-client@2.0.0,json-utils@1.0.0,json-utils@1.2.0"
+	if strings.Join(got, ",") != want {
+		t.Errorf("PlanManifest() = %v, want %s", got, want)
+	}
+}
+
+func TestUninstaller_PlanCleanCache(t *testing.T) {
+	u, _ := newTestUninstaller(t)
+
+	removals, err := u.PlanCleanCache()
+	if err != nil {
+		t.Fatalf("PlanCleanCache() error = %v", err)
+	}
+	if len(removals) != 1 || removals[0].Bytes != int64(len("archive")) {
+		t.Errorf("PlanCleanCache() = %+v", removals)
+	}
+
+	var buf bytes.Buffer
+	PrintRemovals(&buf, removals)
+	if !strings.Contains(buf.String(), "Total: 1 file(s), 7 B") {
+		t.Errorf("PrintRemovals() = %q", buf.String())
+	}
+}
+
+func newGlobalPackage(t *testing.T, cfg *config.Config, name, version string, projects ...string) {
+	t.Helper()
+	dir := filepath.Join(cfg.GetSharedGlobalPackagesDir(), name, version)
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "main.crl"), []byte("grim Main:"), 0644)
+
+	err := refs.Update(filepath.Join(cfg.GetSharedGlobalPackagesDir(), refs.FileName), func(r *refs.Refs) error {
+		for _, p := range projects {
+			r.Add(name, version, p)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to record references: %v", err)
+	}
+}
+
+func newProject(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "Bifrost.toml"), []byte("[package]"), 0644)
+	return dir
+}
+
+func TestUninstaller_GlobalReferences(t *testing.T) {
+	u, cfg := newTestUninstaller(t)
+	cfg.GlobalPackagesDir = filepath.Join(t.TempDir(), "lib")
+	projectA, projectB := newProject(t), newProject(t)
+	newGlobalPackage(t, cfg, "json-utils", "1.0.0", projectA, projectB)
+	newGlobalPackage(t, cfg, "json-utils", "1.2.0", projectA)
+	installed := func(version string) bool {
+		_, err := os.Stat(filepath.Join(cfg.GetSharedGlobalPackagesDir(), "json-utils", version))
+		return err == nil
+	}
+
+	// Project A no longer needs either version, but B still uses 1.0.0
+	u.SetProject(projectA)
+	removals, err := u.PlanPackage("json-utils", "", true)
+	if err != nil {
+		t.Fatalf("PlanPackage() error = %v", err)
+	}
+	if len(removals) != 1 || removals[0].Version != "1.2.0" {
+		t.Errorf("PlanPackage() = %+v, want only 1.2.0", removals)
+	}
+	if err := u.UninstallPackage("json-utils", "", true); err != nil {
+		t.Fatalf("UninstallPackage() error = %v", err)
+	}
+	if !installed("1.0.0") || installed("1.2.0") {
+		t.Errorf("after uninstall from A: 1.0.0 installed = %v, 1.2.0 installed = %v", installed("1.0.0"), installed("1.2.0"))
+	}
+
+	// Once B is deleted, gc removes 1.0.0
+	os.Remove(filepath.Join(projectB, "Bifrost.toml"))
+	removals, err = u.PlanGC()
+	if err != nil || len(removals) != 1 || removals[0].Version != "1.0.0" {
+		t.Fatalf("PlanGC() = %+v, %v, want 1.0.0", removals, err)
+	}
+	if _, err := u.GC(); err != nil {
+		t.Fatalf("GC() error = %v", err)
+	}
+	if installed("1.0.0") {
+		t.Error("gc left the unreferenced version installed")
+	}
+}
+
+func TestUninstaller_GlobalForce(t *testing.T) {
+	u, cfg := newTestUninstaller(t)
+	cfg.GlobalPackagesDir = filepath.Join(t.TempDir(), "lib")
+	newGlobalPackage(t, cfg, "json-utils", "1.0.0", newProject(t))
+
+	if err := u.UninstallPackage("json-utils", "1.0.0", true); err != nil {
+		t.Fatalf("UninstallPackage() error = %v", err)
+	}
+	path := filepath.Join(cfg.GetSharedGlobalPackagesDir(), "json-utils", "1.0.0")
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal("version used by another project was removed without --force")
+	}
+
+	u.SetForce(true)
+	if err := u.UninstallPackage("json-utils", "1.0.0", true); err != nil {
+		t.Fatalf("UninstallPackage() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("forced uninstall left the version installed")
+	}
+}
+
+func TestUninstaller_FlatLayout(t *testing.T) {
+	cfg := config.NewWithHome(t.TempDir())
+	cfg.ModulesDir = filepath.Join(t.TempDir(), "carrion_modules")
+	cfg.Layout = config.LayoutFlat
+	if err := cfg.Init(); err != nil {
+		t.Fatalf("failed to init config: %v", err)
+	}
+	dir := cfg.LocalPackagePath("json-utils", "1.2.0")
+	os.MkdirAll(filepath.Join(dir, "src"), 0755)
+	os.WriteFile(filepath.Join(dir, "src", "main.crl"), []byte("grim Main:"), 0644)
+	os.WriteFile(filepath.Join(dir, config.VersionFile), []byte("1.2.0\n"), 0644)
+	u := New(cfg)
+
+	removals, err := u.PlanPackage("json-utils", "", false)
+	if err != nil {
+		t.Fatalf("PlanPackage() error = %v", err)
+	}
+	if len(removals) != 1 || removals[0].Version != "1.2.0" || removals[0].Path != dir {
+		t.Errorf("PlanPackage() = %+v, want json-utils@1.2.0 at %s", removals, dir)
+	}
+
+	if err := u.UninstallPackage("json-utils", "1.0.0", false); err == nil {
+		t.Error("UninstallPackage() removed a version that is not installed")
+	}
+	if err := u.UninstallPackage("json-utils", "", false); err != nil {
+		t.Fatalf("UninstallPackage() error = %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("flat package directory was not removed")
+	}
+}
+
+func TestUninstaller_PlanStale(t *testing.T) {
+	u, cfg := newTestUninstaller(t)
+	cfg.GlobalPackagesDir = filepath.Join(t.TempDir(), "lib")
+
+	// A link to a user package version removed since, and empty directories
+	// left behind by interrupted removals
+	if err := os.Symlink(cfg.PackagePath("yaml-utils", "1.0.0"), cfg.LocalPackagePath("http-client", "1.0.0")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	os.MkdirAll(cfg.PackagePath("yaml-utils", "2.0.0"), 0755)
+	os.MkdirAll(filepath.Join(cfg.GlobalPackagesDir, "json-utils"), 0755)
+
+	removals := u.PlanStale()
+	var got []string
+	for _, r := range removals {
+		got = append(got, fmt.Sprintf("%s@%s: %s", r.Package, r.Version, r.Reason))
+	}
+	want := []string{
+		"http-client@1.0.0: dangling link",
+		"yaml-utils@2.0.0: empty directory",
+		"yaml-utils@: empty directory",
+		"json-utils@: empty directory",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("PlanStale() = %q, want %q", got, want)
+	}
+
+	if n, err := u.RemoveStale(removals); n != len(want) || err != nil {
+		t.Fatalf("RemoveStale() = %d, %v", n, err)
+	}
+	if stale := u.PlanStale(); len(stale) != 0 {
+		t.Errorf("PlanStale() after RemoveStale() = %+v", stale)
+	}
+	if _, err := os.Stat(cfg.LocalPackagePath("http-client", "2.0.0")); err != nil {
+		t.Errorf("RemoveStale() removed an installed package: %v", err)
+	}
+}
+
+func TestUninstaller_PlanOrphanedCache(t *testing.T) {
+	u, cfg := newTestUninstaller(t)
+	reg := registrytest.New()
+	reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "1.0.0"}, []byte("archive"))
+	reg.AddPackage(registry.PackageInfo{Name: "http-client", Version: "2.0.0"}, []byte("archive"))
+	for _, name := range []string{"http-client-2.0.0-linux-amd64.tar.gz", "http-client-1.0.0.tar.zst", "left-pad-1.0.0.tar.gz", "@acme+utils-1.0.0.tar.gz"} {
+		os.WriteFile(cfg.CachePath(name), []byte("archive"), 0644)
+	}
+
+	removals, err := u.PlanOrphanedCache([]*registry.Client{reg.Client()})
+	if err != nil {
+		t.Fatalf("PlanOrphanedCache() error = %v", err)
+	}
+	var got []string
+	for _, r := range removals {
+		got = append(got, filepath.Base(r.Path))
+	}
+	if want := []string{"http-client-1.0.0.tar.zst", "left-pad-1.0.0.tar.gz"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PlanOrphanedCache() = %v, want %v", got, want)
+	}
+}
+
+func TestUninstaller_GlobalDeactivatesStdlib(t *testing.T) {
+	u, cfg := newTestUninstaller(t)
+	cfg.GlobalPackagesDir = filepath.Join(t.TempDir(), "lib")
+	newGlobalPackage(t, cfg, "collections", "1.0.0")
+	newGlobalPackage(t, cfg, "collections", "1.1.0")
+	packageDir := filepath.Join(cfg.GetSharedGlobalPackagesDir(), "collections")
+	currentPath := filepath.Join(packageDir, config.CurrentLink)
+	if _, err := link.Create(filepath.Join(packageDir, "1.1.0"), currentPath); err != nil {
+		t.Fatalf("link.Create() error = %v", err)
+	}
+
+	// The active version is not listed as a version of its own
+	installed, err := u.InstalledAt(LocationGlobal)
+	if err != nil {
+		t.Fatalf("InstalledAt() error = %v", err)
+	}
+	var versions []string
+	for _, pkg := range installed {
+		versions = append(versions, pkg.Installation.Version)
+	}
+	if want := []string{"1.0.0", "1.1.0"}; !reflect.DeepEqual(versions, want) {
+		t.Errorf("installed versions = %v, want %v", versions, want)
+	}
+
+	if err := u.UninstallPackage("collections", "1.0.0", true); err != nil {
+		t.Fatalf("UninstallPackage(1.0.0) error = %v", err)
+	}
+	if link.Source(currentPath) == "" {
+		t.Error("removing an inactive version removed the active link")
+	}
+	if err := u.UninstallPackage("collections", "1.1.0", true); err != nil {
+		t.Fatalf("UninstallPackage(1.1.0) error = %v", err)
+	}
+	if _, err := os.Lstat(packageDir); !os.IsNotExist(err) {
+		t.Errorf("package directory left behind after removing the active version: %v", err)
+	}
+}
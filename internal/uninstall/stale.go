@@ -0,0 +1,193 @@
+package uninstall
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/javanhut/bifrost/internal/archive"
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/errcode"
+	"github.com/javanhut/bifrost/internal/registry"
+	"github.com/javanhut/bifrost/internal/version"
+)
+
+// Reasons a stale entry is removed
+const (
+	ReasonDanglingLink  = "dangling link"
+	ReasonEmptyDir      = "empty directory"
+	ReasonNotInRegistry = "not in any registry"
+)
+
+// PlanStale returns the links in carrion_modules whose package version was
+// removed, and the package and version directories left empty in
+// carrion_modules and the user and global package directories
+func (u *Uninstaller) PlanStale() []Removal {
+	var removals []Removal
+	if u.config.Layout != config.LayoutFlat {
+		removals = append(removals, staleIn(u.config.ModulesDir, true)...)
+	} else {
+		entries, _ := os.ReadDir(u.config.ModulesDir)
+		for _, entry := range entries {
+			if path := filepath.Join(u.config.ModulesDir, entry.Name()); isDangling(path) {
+				removals = append(removals, staleRemoval(entry.Name(), "", path, ReasonDanglingLink))
+			}
+		}
+	}
+	removals = append(removals, staleIn(u.config.PackagesDir, false)...)
+	removals = append(removals, staleIn(u.config.GetSharedGlobalPackagesDir(), false)...)
+	return removals
+}
+
+// staleIn returns the dangling links, when links are expected, and empty
+// directories in a directory of package/version directories
+func staleIn(dir string, links bool) []Removal {
+	packages, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var removals []Removal
+	for _, pkg := range packages {
+		packageDir := filepath.Join(dir, pkg.Name())
+		if links && isDangling(packageDir) {
+			removals = append(removals, staleRemoval(pkg.Name(), "", packageDir, ReasonDanglingLink))
+			continue
+		}
+		if !pkg.IsDir() {
+			continue
+		}
+		versions, err := os.ReadDir(packageDir)
+		if err != nil {
+			continue
+		}
+		remaining := len(versions)
+		for _, v := range versions {
+			path := filepath.Join(packageDir, v.Name())
+			switch {
+			case links && isDangling(path):
+				removals = append(removals, staleRemoval(pkg.Name(), v.Name(), path, ReasonDanglingLink))
+				remaining--
+			case v.IsDir() && isEmptyDir(path):
+				removals = append(removals, staleRemoval(pkg.Name(), v.Name(), path, ReasonEmptyDir))
+				remaining--
+			}
+		}
+		// Removed after its versions, the package directory is then empty
+		if remaining == 0 {
+			removals = append(removals, staleRemoval(pkg.Name(), "", packageDir, ReasonEmptyDir))
+		}
+	}
+	return removals
+}
+
+// isDangling reports whether path is a symlink whose target is gone
+func isDangling(path string) bool {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return false
+	}
+	_, err = os.Stat(path)
+	return os.IsNotExist(err)
+}
+
+func isEmptyDir(path string) bool {
+	entries, err := os.ReadDir(path)
+	return err == nil && len(entries) == 0
+}
+
+func staleRemoval(packageName, version, path, reason string) Removal {
+	return Removal{Package: packageName, Version: version, Path: path, Reason: reason}
+}
+
+// PlanOrphanedCache returns the cached archives of package versions none of
+// clients has. Archives of scoped packages are left alone, since the
+// registry they came from may not be among clients.
+func (u *Uninstaller) PlanOrphanedCache(clients []*registry.Client) ([]Removal, error) {
+	entries, err := os.ReadDir(u.config.CacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	versions := make(map[string][]string)
+	var removals []Removal
+	for _, entry := range entries {
+		format, ok := archive.FormatOf(entry.Name())
+		if !ok || !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), "@") {
+			continue
+		}
+		stem := strings.TrimSuffix(entry.Name(), "."+string(format))
+		found, err := cachedVersionExists(stem, clients, versions)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			r := newRemoval("", "", filepath.Join(u.config.CacheDir, entry.Name()))
+			r.Reason = ReasonNotInRegistry
+			removals = append(removals, r)
+		}
+	}
+	return removals, nil
+}
+
+// cachedVersionExists reports whether a registry has the package version
+// of the cached archive named stem, "<name>-<version>" or, for a prebuilt
+// archive, "<name>-<version>-<target>". Names may contain "-" themselves,
+// so every split is tried. versions caches the versions of each name.
+func cachedVersionExists(stem string, clients []*registry.Client, versions map[string][]string) (bool, error) {
+	for n := strings.Index(stem, "-"); n > 0; n = nextDash(stem, n) {
+		name, rest := stem[:n], stem[n+1:]
+		if _, err := version.Parse(strings.SplitN(rest, "-", 2)[0]); err != nil {
+			continue
+		}
+		listed, ok := versions[name]
+		if !ok {
+			for _, client := range clients {
+				list, err := client.ListVersions(name)
+				if errcode.Of(err) == errcode.PackageNotFound {
+					continue
+				}
+				if err != nil {
+					return false, fmt.Errorf("failed to check %s: %w", name, err)
+				}
+				listed = append(listed, list...)
+			}
+			versions[name] = listed
+		}
+		for _, v := range listed {
+			if rest == v || strings.HasPrefix(rest, v+"-") {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// nextDash returns the index of the first "-" in s after n, or -1
+func nextDash(s string, n int) int {
+	next := strings.Index(s[n+1:], "-")
+	if next < 0 {
+		return -1
+	}
+	return n + 1 + next
+}
+
+// RemoveStale deletes the links, empty directories and cached archives of
+// removals planned by PlanStale or PlanOrphanedCache. Nothing is removed
+// recursively, so a directory that gained files since is kept.
+func (u *Uninstaller) RemoveStale(removals []Removal) (int, error) {
+	var errs []error
+	removed := 0
+	for _, r := range removals {
+		if err := os.Remove(r.Path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("failed to remove %s: %w", r.Path, err))
+			continue
+		}
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
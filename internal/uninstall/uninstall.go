@@ -1,17 +1,34 @@
 package uninstall
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/javanhut/bifrost/internal/color"
 	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/journal"
+	"github.com/javanhut/bifrost/internal/link"
+	"github.com/javanhut/bifrost/internal/lockfile"
+	"github.com/javanhut/bifrost/internal/locksign"
 	"github.com/javanhut/bifrost/internal/manifest"
+	"github.com/javanhut/bifrost/internal/refs"
+	"github.com/javanhut/bifrost/internal/warn"
 )
 
 type Uninstaller struct {
 	config *config.Config
+	// project is the directory of the project uninstalling global packages,
+	// empty outside a project
+	project string
+	// force removes global packages other projects still use
+	force bool
+	// location restricts local uninstalls to the project's carrion_modules
+	// or the user package directory, empty for whichever has the package
+	location Location
 }
 
 func New(cfg *config.Config) *Uninstaller {
@@ -20,6 +37,39 @@ func New(cfg *config.Config) *Uninstaller {
 	}
 }
 
+// SetProject sets the project whose references to global packages an
+// uninstall releases. Without a project the explicit reference recorded by a
+// global install from outside any project is released.
+func (u *Uninstaller) SetProject(dir string) {
+	u.project = dir
+}
+
+// SetForce makes global uninstalls delete versions that other projects still
+// reference
+func (u *Uninstaller) SetForce(force bool) {
+	u.force = force
+}
+
+// refsPath returns the reference file of the global packages directory
+func (u *Uninstaller) refsPath() string {
+	return filepath.Join(u.config.GetSharedGlobalPackagesDir(), refs.FileName)
+}
+
+// release drops this uninstaller's reference to a global package version and
+// returns the projects that still use it
+func (u *Uninstaller) release(r *refs.Refs, packageName, version string) []string {
+	reference := u.project
+	if reference == "" {
+		reference = refs.Explicit
+	}
+	r.Remove(packageName, version, reference)
+	r.Prune()
+	if u.force {
+		return nil
+	}
+	return r.Projects(packageName, version)
+}
+
 func (u *Uninstaller) UninstallPackage(packageName string, version string, global bool) error {
 	if version == "" {
 		return u.uninstallAllVersions(packageName, global)
@@ -27,43 +77,113 @@ func (u *Uninstaller) UninstallPackage(packageName string, version string, globa
 	return u.uninstallSpecificVersion(packageName, version, global)
 }
 
-func (u *Uninstaller) uninstallSpecificVersion(packageName string, version string, global bool) error {
+// versionPath returns the directory holding an installed package version
+func (u *Uninstaller) versionPath(packageName string, version string, global bool) (string, error) {
 	var packagePath string
-	
+
 	if global {
 		sharedDir := u.config.GetSharedGlobalPackagesDir()
 		packagePath = filepath.Join(sharedDir, packageName, version)
 	} else {
 		// Check local carrion_modules first, then user packages
-		localPath := u.config.LocalPackagePath(packageName, version)
-		if _, err := os.Stat(localPath); err == nil {
-			packagePath = localPath
+		if u.location == LocationLocal || (u.location == "" && u.config.LocalPackageInstalled(packageName, version)) {
+			packagePath = u.config.LocalPackagePath(packageName, version)
 		} else {
 			packagePath = u.config.PackagePath(packageName, version)
 		}
 	}
 
-	if _, err := os.Stat(packagePath); os.IsNotExist(err) {
-		installType := "locally"
-		if global {
-			installType = "globally"
+	if _, err := os.Stat(packagePath); os.IsNotExist(err) || (u.location == LocationLocal && !u.config.LocalPackageInstalled(packageName, version)) {
+		return "", fmt.Errorf("package %s@%s is not installed %s", packageName, version, u.installType(global))
+	}
+	return packagePath, nil
+}
+
+// installType describes where the uninstaller looks for packages, for
+// errors about ones that are not there
+func (u *Uninstaller) installType(global bool) string {
+	switch {
+	case global:
+		return "globally"
+	case u.location == LocationUser:
+		return "in the user package directory"
+	}
+	return "locally"
+}
+
+func (u *Uninstaller) uninstallSpecificVersion(packageName string, version string, global bool) error {
+	if !global {
+		unlinked, err := u.unlink(packageName, version)
+		if err != nil {
+			return err
 		}
-		return fmt.Errorf("package %s@%s is not installed %s", packageName, version, installType)
+		// The link was the project's copy of the user package
+		if unlinked && u.location == LocationLocal {
+			return nil
+		}
+	}
+	packagePath, err := u.versionPath(packageName, version, global)
+	if err != nil {
+		return err
+	}
+	if err := u.checkStoreWrite(packagePath); err != nil {
+		return err
+	}
+	if !global {
+		return u.removeVersion(packageName, version, packagePath, global)
 	}
 
+	// Global versions are shared, so only delete ones nothing else uses
+	return refs.Update(u.refsPath(), func(r *refs.Refs) error {
+		if users := u.release(r, packageName, version); len(users) > 0 {
+			fmt.Printf("Kept %s@%s (global), still used by: %s\n", packageName, version, strings.Join(users, ", "))
+			return nil
+		}
+		if err := u.removeVersion(packageName, version, packagePath, global); err != nil {
+			return err
+		}
+		r.Forget(packageName, version)
+		return nil
+	})
+}
+
+// checkStoreWrite refuses to remove path from the user or global package
+// directories while they are read-only; the project's own packages can
+// always be removed
+func (u *Uninstaller) checkStoreWrite(path string) error {
+	if rel, err := filepath.Rel(u.config.ModulesDir, path); err == nil && filepath.IsLocal(rel) {
+		return nil
+	}
+	return u.config.CheckStoreWrite()
+}
+
+// removeVersion deletes a single installed package version
+func (u *Uninstaller) removeVersion(packageName, version, packagePath string, global bool) error {
 	fmt.Printf("Removing %s@%s", packageName, version)
 	if global {
 		fmt.Print(" (global)")
 	}
 	fmt.Println("...")
 
+	txn, err := journal.Open(u.config.JournalPath()).Begin(journal.OpUninstall, packagePath)
+	if err != nil {
+		return err
+	}
 	if err := os.RemoveAll(packagePath); err != nil {
 		return fmt.Errorf("failed to remove package directory: %w", err)
 	}
+	if err := txn.Commit(); err != nil {
+		return err
+	}
 
 	u.cleanupSymlinks(packageName)
 
 	packageDir := filepath.Dir(packagePath)
+	if global {
+		if err := deactivate(packagePath); err != nil {
+			return err
+		}
+	}
 	if isEmpty, _ := u.isDirEmpty(packageDir); isEmpty {
 		os.Remove(packageDir)
 	}
@@ -77,16 +197,31 @@ func (u *Uninstaller) uninstallSpecificVersion(packageName string, version strin
 	return nil
 }
 
-func (u *Uninstaller) uninstallAllVersions(packageName string, global bool) error {
+// deactivate removes the link making the removed global version at
+// packagePath the active version of a standard library package
+func deactivate(packagePath string) error {
+	currentPath := filepath.Join(filepath.Dir(packagePath), config.CurrentLink)
+	if link.Source(currentPath) != packagePath {
+		return nil
+	}
+	if _, err := link.Remove(currentPath); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", currentPath, err)
+	}
+	return nil
+}
+
+// packageDir returns the directory holding every installed version of a
+// package, along with its entries
+func (u *Uninstaller) packageDir(packageName string, global bool) (string, []os.DirEntry, error) {
 	var packageDir string
-	
+
 	if global {
 		sharedDir := u.config.GetSharedGlobalPackagesDir()
 		packageDir = filepath.Join(sharedDir, packageName)
 	} else {
 		// Check local carrion_modules first, then user packages
 		localPackageDir := filepath.Join(u.config.ModulesDir, packageName)
-		if _, err := os.Stat(localPackageDir); err == nil {
+		if _, err := os.Stat(localPackageDir); u.location == LocationLocal || (u.location == "" && err == nil) {
 			packageDir = localPackageDir
 		} else {
 			packageDir = filepath.Join(u.config.PackagesDir, packageName)
@@ -94,37 +229,113 @@ func (u *Uninstaller) uninstallAllVersions(packageName string, global bool) erro
 	}
 
 	if _, err := os.Stat(packageDir); os.IsNotExist(err) {
-		installType := "locally"
-		if global {
-			installType = "globally"
-		}
-		return fmt.Errorf("package %s is not installed %s", packageName, installType)
+		return "", nil, fmt.Errorf("package %s is not installed %s", packageName, u.installType(global))
 	}
 
 	versions, err := os.ReadDir(packageDir)
 	if err != nil {
-		return fmt.Errorf("failed to read package directory: %w", err)
+		return "", nil, fmt.Errorf("failed to read package directory: %w", err)
 	}
 
 	if len(versions) == 0 {
-		return fmt.Errorf("no versions found for package %s", packageName)
+		return "", nil, fmt.Errorf("no versions found for package %s", packageName)
+	}
+	return packageDir, versions, nil
+}
+
+// flatVersion returns the version of packageName installed in a flat
+// layout modules directory, which is then the only local version
+func (u *Uninstaller) flatVersion(packageName string, global bool) string {
+	if global || u.location == LocationUser || u.config.Layout != config.LayoutFlat {
+		return ""
+	}
+	return config.FlatVersion(u.config.LocalPackagePath(packageName, ""))
+}
+
+func (u *Uninstaller) uninstallAllVersions(packageName string, global bool) error {
+	if !global {
+		unlinked, err := u.unlink(packageName, "")
+		if err != nil {
+			return err
+		}
+		if unlinked && u.location == LocationLocal {
+			return nil
+		}
+	}
+	if version := u.flatVersion(packageName, global); version != "" {
+		return u.uninstallSpecificVersion(packageName, version, global)
 	}
 
+	packageDir, versions, err := u.packageDir(packageName, global)
+	if err != nil {
+		return err
+	}
+	if err := u.checkStoreWrite(packageDir); err != nil {
+		return err
+	}
+	if !global {
+		return u.removeAllVersions(packageName, packageDir, versions, global)
+	}
+
+	// Global versions are shared, so only delete ones nothing else uses
+	return refs.Update(u.refsPath(), func(r *refs.Refs) error {
+		kept := make(map[string]bool)
+		for _, v := range versions {
+			if v.Name() == config.CurrentLink {
+				continue
+			}
+			if users := u.release(r, packageName, v.Name()); len(users) > 0 {
+				fmt.Printf("Kept %s@%s (global), still used by: %s\n", packageName, v.Name(), strings.Join(users, ", "))
+				kept[v.Name()] = true
+			}
+		}
+
+		if len(kept) == 0 {
+			if err := u.removeAllVersions(packageName, packageDir, versions, global); err != nil {
+				return err
+			}
+		}
+		for _, v := range versions {
+			if kept[v.Name()] || v.Name() == config.CurrentLink {
+				continue
+			}
+			if len(kept) > 0 {
+				if err := u.removeVersion(packageName, v.Name(), filepath.Join(packageDir, v.Name()), global); err != nil {
+					return err
+				}
+			}
+			r.Forget(packageName, v.Name())
+		}
+		return nil
+	})
+}
+
+// removeAllVersions deletes a package directory with every version in it
+func (u *Uninstaller) removeAllVersions(packageName, packageDir string, versions []os.DirEntry, global bool) error {
 	fmt.Printf("Removing all versions of %s", packageName)
 	if global {
 		fmt.Print(" (global)")
 	}
 	fmt.Println("...")
 
+	var versionPaths []string
 	for _, version := range versions {
 		if version.IsDir() {
 			fmt.Printf("  Removing %s@%s...\n", packageName, version.Name())
 		}
+		versionPaths = append(versionPaths, filepath.Join(packageDir, version.Name()))
 	}
 
+	txn, err := journal.Open(u.config.JournalPath()).Begin(journal.OpUninstall, versionPaths...)
+	if err != nil {
+		return err
+	}
 	if err := os.RemoveAll(packageDir); err != nil {
 		return fmt.Errorf("failed to remove package directory: %w", err)
 	}
+	if err := txn.Commit(); err != nil {
+		return err
+	}
 
 	u.cleanupSymlinks(packageName)
 
@@ -137,21 +348,57 @@ func (u *Uninstaller) uninstallAllVersions(packageName string, global bool) erro
 	return nil
 }
 
-func (u *Uninstaller) cleanupSymlinks(packageName string) {
-	linkPath := filepath.Join(u.config.LocalModulesPath(), packageName)
-	if _, err := os.Lstat(linkPath); err == nil {
-		if isSymlink, _ := u.isSymlink(linkPath); isSymlink {
-			os.Remove(linkPath)
+// unlink removes the project's link to a package installed in the user
+// package directory, when the project lockfile records one for version or,
+// with an empty version, for any version. The package itself is left for
+// the uninstall to remove from the user package directory. It reports
+// whether there was a link to remove.
+func (u *Uninstaller) unlink(packageName, version string) (bool, error) {
+	if u.project == "" {
+		return false, nil
+	}
+	lockPath := filepath.Join(u.project, lockfile.FileNameFor(u.config.Profile))
+	lock, err := lockfile.LoadIfExists(lockPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to load lockfile: %w", err)
+	}
+	if lock == nil {
+		return false, nil
+	}
+	locked := lock.Find(packageName)
+	if locked == nil || locked.Scope != lockfile.ScopeUser || (version != "" && locked.Version != version) {
+		return false, nil
+	}
+
+	// The link is a copy where symlinks were unavailable
+	linkPath := u.config.LocalPackagePath(packageName, locked.Version)
+	if err := os.RemoveAll(linkPath); err != nil {
+		return false, fmt.Errorf("failed to remove link %s: %w", linkPath, err)
+	}
+	if u.config.Layout != config.LayoutFlat {
+		if isEmpty, _ := u.isDirEmpty(filepath.Dir(linkPath)); isEmpty {
+			os.Remove(filepath.Dir(linkPath))
 		}
 	}
-}
+	fmt.Printf("Unlinked %s@%s from %s\n", packageName, locked.Version, u.config.LocalModulesPath())
 
-func (u *Uninstaller) isSymlink(path string) (bool, error) {
-	info, err := os.Lstat(path)
-	if err != nil {
-		return false, err
+	lock.Remove(packageName)
+	if err := lock.Save(lockPath); err != nil {
+		return true, fmt.Errorf("failed to write lockfile: %w", err)
+	}
+	if _, err := locksign.Resign(u.config, lockPath); err != nil {
+		if !errors.Is(err, locksign.ErrNoSigningKey) {
+			return true, err
+		}
+		warn.Printf(warn.Integrity, "%v; %s%s no longer matches the lockfile", err, lockfile.FileNameFor(u.config.Profile), locksign.SignatureSuffix)
 	}
-	return info.Mode()&os.ModeSymlink != 0, nil
+	return true, nil
+}
+
+// cleanupSymlinks removes the link to a package from the local modules
+// directory, whether a symlink or a copy made in its place
+func (u *Uninstaller) cleanupSymlinks(packageName string) {
+	link.Remove(filepath.Join(u.config.LocalModulesPath(), packageName))
 }
 
 func (u *Uninstaller) isDirEmpty(dir string) (bool, error) {
@@ -162,85 +409,61 @@ func (u *Uninstaller) isDirEmpty(dir string) (bool, error) {
 	return len(entries) == 0, nil
 }
 
-func (u *Uninstaller) ListInstalledPackages(global bool) error {
-	if global {
-		return u.listPackagesInDir(u.config.GetSharedGlobalPackagesDir(), "Global")
-	} else {
-		// List both local project and user packages for non-global mode
-		fmt.Println("Installed packages:")
-		
-		// Check local carrion_modules first
-		localFound := false
-		if _, err := os.Stat(u.config.ModulesDir); err == nil {
-			fmt.Println("\nLocal project packages (./carrion_modules/):")
-			if err := u.listPackagesInDir(u.config.ModulesDir, ""); err == nil {
-				localFound = true
-			}
-		}
-		
-		// Then check user packages
-		userFound := false
-		if _, err := os.Stat(u.config.PackagesDir); err == nil {
-			fmt.Println("\nUser packages (~/.carrion/packages/):")
-			if err := u.listPackagesInDir(u.config.PackagesDir, ""); err == nil {
-				userFound = true
-			}
-		}
-		
-		if !localFound && !userFound {
+// ListInstalledPackages prints the packages installed in loc, or in every
+// location for LocationAll, in the order imports search them, noting copies
+// an earlier location shadows
+func (u *Uninstaller) ListInstalledPackages(loc Location) error {
+	packages, err := u.InstalledAt(loc)
+	if err != nil {
+		return err
+	}
+	if len(packages) == 0 {
+		if loc == LocationAll {
 			fmt.Println("No packages installed")
+		} else {
+			fmt.Printf("No %s packages installed\n", loc)
 		}
-		
 		return nil
 	}
-}
 
-func (u *Uninstaller) listPackagesInDir(packagesDir string, installType string) error {
-	entries, err := os.ReadDir(packagesDir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			if installType != "" {
-				fmt.Printf("No %s packages installed\n", strings.ToLower(installType))
-			}
-			return err
+	fmt.Println("Installed packages:")
+	var current Location
+	for _, p := range packages {
+		if p.Location != current {
+			current = p.Location
+			fmt.Printf("\n%s\n", u.locationHeading(current))
 		}
-		return fmt.Errorf("failed to read packages directory: %w", err)
-	}
-
-	if len(entries) == 0 {
-		if installType != "" {
-			fmt.Printf("No %s packages installed\n", strings.ToLower(installType))
+		line := "  " + color.For(os.Stdout).Ref(p.Name, p.Version)
+		if p.Link {
+			line += " (link)"
 		}
-		return err
-	}
-
-	if installType != "" {
-		fmt.Printf("%s packages:\n", installType)
-	}
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			versionsDir := filepath.Join(packagesDir, entry.Name())
-			versions, err := os.ReadDir(versionsDir)
-			if err != nil {
-				continue
-			}
-			for _, version := range versions {
-				if version.IsDir() {
-					fmt.Printf("  %s@%s\n", entry.Name(), version.Name())
-				}
-			}
+		if p.ShadowedBy != "" {
+			line += fmt.Sprintf(" (shadowed by the %s copy)", p.ShadowedBy)
 		}
+		fmt.Println(line)
 	}
-
 	return nil
 }
 
+// locationHeading titles the packages listed from loc
+func (u *Uninstaller) locationHeading(loc Location) string {
+	switch loc {
+	case LocationLocal:
+		return fmt.Sprintf("Local project packages (%s):", u.config.ModulesDir)
+	case LocationUser:
+		return fmt.Sprintf("User packages (%s):", u.config.PackagesDir)
+	}
+	return fmt.Sprintf("Global packages (%s):", u.config.GetSharedGlobalPackagesDir())
+}
+
 func (u *Uninstaller) UninstallFromManifest(manifestPath string) error {
 	m, err := manifest.Load(manifestPath)
 	if err != nil {
 		return fmt.Errorf("failed to load manifest: %w", err)
 	}
+	if m, err = m.WithProfile(u.config.Profile); err != nil {
+		return err
+	}
 
 	fmt.Printf("Removing dependencies for %s...\n", m.Package.Name)
 
@@ -258,20 +481,20 @@ func (u *Uninstaller) UninstallFromManifest(manifestPath string) error {
 	}
 
 	for name, version := range allDeps {
-		if strings.Contains(version, "*") || strings.Contains(version, "^") || strings.Contains(version, "~") {
+		if removesAllVersions(version) {
 			if err := u.uninstallAllVersions(name, false); err != nil {
-				fmt.Printf("Warning: failed to remove %s: %v\n", name, err)
+				warn.Printf(warn.FileError(err), "failed to remove %s: %v", name, err)
 				continue
 			}
 		} else {
 			if err := u.uninstallSpecificVersion(name, version, false); err != nil {
-				fmt.Printf("Warning: failed to remove %s@%s: %v\n", name, version, err)
+				warn.Printf(warn.FileError(err), "failed to remove %s@%s: %v", name, version, err)
 				continue
 			}
 		}
 	}
 
-	modulesDir := filepath.Join(filepath.Dir(manifestPath), u.config.LocalModulesPath())
+	modulesDir := u.config.ProjectModulesDir(filepath.Dir(manifestPath))
 	if _, err := os.Stat(modulesDir); err == nil {
 		if isEmpty, _ := u.isDirEmpty(modulesDir); isEmpty {
 			os.Remove(modulesDir)
@@ -283,6 +506,22 @@ func (u *Uninstaller) UninstallFromManifest(manifestPath string) error {
 	return nil
 }
 
+// removesAllVersions reports whether uninstalling a manifest dependency with
+// this constraint removes every installed version rather than one
+func removesAllVersions(constraint string) bool {
+	return strings.Contains(constraint, "*") || strings.Contains(constraint, "^") || strings.Contains(constraint, "~")
+}
+
+// sortedKeys returns the keys of m in lexical order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func (u *Uninstaller) CleanCache() error {
 	fmt.Println("Cleaning package cache...")
 	
@@ -304,7 +543,7 @@ func (u *Uninstaller) CleanCache() error {
 	for _, entry := range entries {
 		cachePath := filepath.Join(u.config.CacheDir, entry.Name())
 		if err := os.RemoveAll(cachePath); err != nil {
-			fmt.Printf("Warning: failed to remove %s: %v\n", entry.Name(), err)
+			warn.Printf(warn.FileError(err), "failed to remove %s: %v", entry.Name(), err)
 			continue
 		}
 		fmt.Printf("  Removed %s\n", entry.Name())
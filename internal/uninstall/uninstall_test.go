@@ -0,0 +1,183 @@
+package uninstall
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/lockfile"
+)
+
+func TestUninstaller_UninstallPackageUnlinksUserPackage(t *testing.T) {
+	u, cfg := newTestUninstaller(t)
+
+	userPath := cfg.PackagePath("yaml-utils", "1.0.0")
+	os.MkdirAll(filepath.Join(userPath, "src"), 0755)
+	os.WriteFile(filepath.Join(userPath, "src", "main.crl"), []byte("grim Main:"), 0644)
+	linkPath := cfg.LocalPackagePath("yaml-utils", "1.0.0")
+	os.MkdirAll(filepath.Dir(linkPath), 0755)
+	if err := os.Symlink(userPath, linkPath); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	project := filepath.Dir(cfg.ModulesDir)
+	lockPath := filepath.Join(project, lockfile.FileName)
+	lock := lockfile.New()
+	lock.Set(lockfile.Package{Name: "yaml-utils", Version: "1.0.0", Scope: lockfile.ScopeUser})
+	lock.Set(lockfile.Package{Name: "http-client", Version: "2.0.0"})
+	if err := lock.Save(lockPath); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	u.SetProject(project)
+	if err := u.UninstallPackage("yaml-utils", "", false); err != nil {
+		t.Fatalf("UninstallPackage() error = %v", err)
+	}
+
+	if _, err := os.Lstat(filepath.Dir(linkPath)); !os.IsNotExist(err) {
+		t.Errorf("link to yaml-utils left in the modules directory: %v", err)
+	}
+	if _, err := os.Stat(userPath); !os.IsNotExist(err) {
+		t.Errorf("yaml-utils left in the user package directory: %v", err)
+	}
+	lock, err := lockfile.Load(lockPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if lock.Find("yaml-utils") != nil || lock.Find("http-client") == nil {
+		t.Errorf("lockfile packages = %+v, want only http-client", lock.Packages)
+	}
+}
+
+func TestUninstaller_UninstallAt(t *testing.T) {
+	u, cfg := newTestUninstaller(t)
+	cfg.GlobalPackagesDir = t.TempDir()
+	for _, dir := range []string{cfg.PackagePath("json-utils", "1.0.0"), filepath.Join(cfg.GlobalPackagesDir, "json-utils", "1.0.0")} {
+		os.MkdirAll(filepath.Join(dir, "src"), 0755)
+		os.WriteFile(filepath.Join(dir, "src", "main.crl"), []byte("grim Main:"), 0644)
+	}
+	u.SetForce(true)
+
+	installed := u.Installed("json-utils")
+	var got []string
+	for _, in := range installed {
+		got = append(got, in.Version+" "+string(in.Location))
+	}
+	if want := []string{"1.0.0 local", "1.2.0 local", "1.0.0 user", "1.0.0 global"}; strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("Installed() = %v, want %v", got, want)
+	}
+
+	// Only the user copy goes, although a local one exists
+	removals, err := u.PlanAt("json-utils", "1.0.0", LocationUser)
+	if err != nil || len(removals) != 1 || removals[0].Path != cfg.PackagePath("json-utils", "1.0.0") {
+		t.Fatalf("PlanAt(user) = %+v, %v", removals, err)
+	}
+	if err := u.UninstallAt("json-utils", "1.0.0", LocationUser); err != nil {
+		t.Fatalf("UninstallAt(user) error = %v", err)
+	}
+	if _, err := os.Stat(cfg.PackagePath("json-utils", "1.0.0")); !os.IsNotExist(err) {
+		t.Errorf("user copy left installed: %v", err)
+	}
+	if _, err := os.Stat(cfg.LocalPackagePath("json-utils", "1.0.0")); err != nil {
+		t.Errorf("local copy removed with --location user: %v", err)
+	}
+	if err := u.UninstallAt("json-utils", "1.0.0", LocationUser); err == nil || !strings.Contains(err.Error(), "user package directory") {
+		t.Errorf("UninstallAt(user) of a removed copy error = %v", err)
+	}
+
+	if err := u.UninstallAt("json-utils", "1.0.0", LocationAll); err != nil {
+		t.Fatalf("UninstallAt(all) error = %v", err)
+	}
+	got = got[:0]
+	for _, in := range u.Installed("json-utils") {
+		got = append(got, in.Version+" "+string(in.Location))
+	}
+	if want := "1.2.0 local"; strings.Join(got, ", ") != want {
+		t.Errorf("Installed() after UninstallAt(all) = %v, want %s", got, want)
+	}
+}
+
+func TestUninstaller_InstalledAt(t *testing.T) {
+	u, cfg := newTestUninstaller(t)
+	cfg.GlobalPackagesDir = t.TempDir()
+	for _, dir := range []string{
+		cfg.PackagePath("json-utils", "1.0.0"),
+		cfg.PackagePath("yaml-utils", "1.0.0"),
+		filepath.Join(cfg.GlobalPackagesDir, "yaml-utils", "0.9.0"),
+	} {
+		os.MkdirAll(filepath.Join(dir, "src"), 0755)
+	}
+
+	tests := []struct {
+		loc  Location
+		want []string
+	}{
+		{LocationAll, []string{
+			"http-client@2.0.0 local",
+			"json-utils@1.0.0 local",
+			"json-utils@1.2.0 local",
+			"json-utils@1.0.0 user shadowed by local",
+			"yaml-utils@1.0.0 user",
+			"yaml-utils@0.9.0 global shadowed by user",
+		}},
+		{LocationUser, []string{
+			"json-utils@1.0.0 user shadowed by local",
+			"yaml-utils@1.0.0 user",
+		}},
+		{LocationGlobal, []string{"yaml-utils@0.9.0 global shadowed by user"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.loc), func(t *testing.T) {
+			packages, err := u.InstalledAt(tt.loc)
+			if err != nil {
+				t.Fatalf("InstalledAt() error = %v", err)
+			}
+			var got []string
+			for _, p := range packages {
+				line := p.Name + "@" + p.Version + " " + string(p.Location)
+				if p.ShadowedBy != "" {
+					line += " shadowed by " + string(p.ShadowedBy)
+				}
+				got = append(got, line)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("InstalledAt() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestUninstaller_ReadOnlyStore(t *testing.T) {
+	u, cfg := newTestUninstaller(t)
+	cfg.GlobalPackagesDir = t.TempDir()
+	userPath := cfg.PackagePath("json-utils", "1.0.0")
+	globalPath := filepath.Join(cfg.GlobalPackagesDir, "json-utils", "1.0.0")
+	for _, dir := range []string{userPath, globalPath} {
+		os.MkdirAll(filepath.Join(dir, "src"), 0755)
+		os.WriteFile(filepath.Join(dir, "src", "main.crl"), []byte("grim Main:"), 0644)
+	}
+	u.SetForce(true)
+	cfg.ReadOnlyStore = true
+
+	for _, loc := range []Location{LocationUser, LocationGlobal} {
+		if err := u.UninstallAt("json-utils", "", loc); !errors.Is(err, config.ErrReadOnlyStore) {
+			t.Errorf("UninstallAt(%s) error = %v, want %v", loc, err, config.ErrReadOnlyStore)
+		}
+	}
+	if _, err := u.GC(); !errors.Is(err, config.ErrReadOnlyStore) {
+		t.Errorf("GC() error = %v, want %v", err, config.ErrReadOnlyStore)
+	}
+	for _, dir := range []string{userPath, globalPath} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("%s removed from the read-only store: %v", dir, err)
+		}
+	}
+
+	// The project's own packages are not part of the store
+	if err := u.UninstallAt("json-utils", "1.0.0", LocationLocal); err != nil {
+		t.Errorf("UninstallAt(local) error = %v", err)
+	}
+}
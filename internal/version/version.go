@@ -122,6 +122,11 @@ func ParseConstraint(s string) (Constraint, error) {
 		}, nil
 	}
 
+	// Compatible release (~=1.2.3), as written in Python requirements
+	if rest, ok := strings.CutPrefix(s, "~="); ok {
+		return parseCompatibleRelease(strings.TrimSpace(rest))
+	}
+
 	// Tilde constraint (~1.2.3)
 	if strings.HasPrefix(s, "~") {
 		v, err := Parse(s[1:])
@@ -199,3 +204,16 @@ func ParseConstraint(s string) (Constraint, error) {
 	}
 	return &ExactConstraint{version: v}, nil
 }
+
+// parseCompatibleRelease parses the version of a "~=" constraint. As in PEP
+// 440, the last component given may increase: ~=1.2.3 is ~1.2.3 and ~=1.2
+// is ^1.2.0.
+func parseCompatibleRelease(s string) (Constraint, error) {
+	switch strings.Count(s, ".") {
+	case 2:
+		return ParseConstraint("~" + s)
+	case 1:
+		return ParseConstraint("^" + s + ".0")
+	}
+	return nil, fmt.Errorf("invalid compatible release constraint ~=%s: give at least major.minor, as in ~=1.4 (>=1.4.0, <2.0.0) or ~=1.4.2 (>=1.4.2, <1.5.0)", s)
+}
@@ -1,6 +1,7 @@
 package version
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -509,4 +510,37 @@ func TestParseConstraint(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestParseConstraint_CompatibleRelease(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr string
+	}{
+		{input: "~=1.4.2", want: ">=1.4.2, <1.5.0"},
+		{input: "~=1.4", want: ">=1.4.0, <2.0.0"},
+		{input: "~= 1.4.2", want: ">=1.4.2, <1.5.0"},
+		{input: "~=v0.3", want: ">=0.3.0, <1.0.0"},
+		{input: "~=1", wantErr: "give at least major.minor"},
+		{input: "~=1.4.x", wantErr: "invalid version format"},
+		{input: "~=", wantErr: "give at least major.minor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			c, err := ParseConstraint(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseConstraint(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseConstraint(%q) error = %v", tt.input, err)
+			}
+			if got := c.String(); got != tt.want {
+				t.Errorf("ParseConstraint(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
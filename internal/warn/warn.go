@@ -0,0 +1,85 @@
+// Package warn is bifrost's warning channel. Warnings are written to
+// stderr, apart from the regular output on stdout, tagged with a category,
+// and counted so --fatal-warnings can fail a run that produced any.
+package warn
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// Category groups warnings by what they are about
+type Category string
+
+const (
+	// Network is a registry or mirror that could not be reached
+	Network Category = "network"
+	// Permissions is a file or directory bifrost may not read or change
+	Permissions Category = "permissions"
+	// Deprecation is a feature or setting that will be removed
+	Deprecation Category = "deprecation"
+	// Filesystem is a file operation that failed without failing the command
+	Filesystem Category = "filesystem"
+	// Integrity is a package that could not be fully verified
+	Integrity Category = "integrity"
+	// Package is a package or manifest that is incomplete or unusual
+	Package Category = "package"
+)
+
+// FileError returns the category of a failed file operation
+func FileError(err error) Category {
+	if errors.Is(err, fs.ErrPermission) {
+		return Permissions
+	}
+	return Filesystem
+}
+
+// Warning is one warning
+type Warning struct {
+	Category Category `json:"category"`
+	Message  string   `json:"message"`
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("Warning [%s]: %s", w.Category, w.Message)
+}
+
+var (
+	mu      sync.Mutex
+	out     io.Writer = os.Stderr
+	emitted []Warning
+)
+
+// SetOutput sets where warnings are written, stderr by default
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	out = w
+}
+
+// Printf writes a warning of category c and records it
+func Printf(c Category, format string, args ...interface{}) {
+	w := Warning{Category: c, Message: fmt.Sprintf(format, args...)}
+	mu.Lock()
+	defer mu.Unlock()
+	emitted = append(emitted, w)
+	fmt.Fprintln(out, w)
+}
+
+// Emitted returns the warnings written so far
+func Emitted() []Warning {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]Warning(nil), emitted...)
+}
+
+// Reset forgets the warnings written so far
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	emitted = nil
+}
@@ -0,0 +1,55 @@
+package warn
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestPrintf(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer SetOutput(os.Stderr)
+	Reset()
+	defer Reset()
+
+	Printf(Network, "could not reach %s", "mirror")
+	Printf(Deprecation, "old setting")
+
+	want := "Warning [network]: could not reach mirror\nWarning [deprecation]: old setting\n"
+	if got := buf.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	wantEmitted := []Warning{
+		{Category: Network, Message: "could not reach mirror"},
+		{Category: Deprecation, Message: "old setting"},
+	}
+	if got := Emitted(); !reflect.DeepEqual(got, wantEmitted) {
+		t.Errorf("Emitted() = %+v, want %+v", got, wantEmitted)
+	}
+
+	Reset()
+	if got := Emitted(); len(got) != 0 {
+		t.Errorf("Emitted() after Reset() = %+v", got)
+	}
+}
+
+func TestFileError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Category
+	}{
+		{err: &fs.PathError{Op: "remove", Path: "x", Err: fs.ErrPermission}, want: Permissions},
+		{err: fmt.Errorf("failed to remove: %w", fs.ErrPermission), want: Permissions},
+		{err: errors.New("device busy"), want: Filesystem},
+	}
+	for _, tt := range tests {
+		if got := FileError(tt.err); got != tt.want {
+			t.Errorf("FileError(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+// Package bifrost is the programmatic entry point to the Bifrost package
+// manager for editor plugins, build tools and other Go programs.
+//
+// The public API is split across a small set of packages:
+//
+//	pkg/bifrost   installer facade (this package)
+//	pkg/manifest  Bifrost.toml parsing
+//	pkg/lockfile  Bifrost.lock parsing
+//	pkg/version   semantic versions and constraints
+//	pkg/registry  registry HTTP client
+//
+// # Compatibility
+//
+// Packages under pkg/ follow semantic versioning together with the bifrost
+// module: exported identifiers are only removed or changed incompatibly in a
+// new major release. Everything under internal/ may change at any time and
+// is intentionally not importable.
+//
+// # Example
+//
+//	inst, err := bifrost.NewInstaller(bifrost.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	lock, err := inst.InstallManifest("Bifrost.toml")
+package bifrost
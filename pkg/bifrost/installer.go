@@ -0,0 +1,106 @@
+package bifrost
+
+import (
+	"github.com/javanhut/bifrost/internal/config"
+	"github.com/javanhut/bifrost/internal/install"
+	"github.com/javanhut/bifrost/pkg/lockfile"
+	"github.com/javanhut/bifrost/pkg/manifest"
+	"github.com/javanhut/bifrost/pkg/registry"
+	"github.com/javanhut/bifrost/pkg/version"
+)
+
+// Options configures an Installer. Zero values fall back to the defaults
+// used by the bifrost command.
+type Options struct {
+	// HomeDir is the Carrion home holding the package store and cache.
+	// Defaults to $CARRION_HOME or ~/.carrion.
+	HomeDir string
+	// RegistryURL is the registry to install from. Defaults to
+	// $CARRION_REGISTRY_URL, then the config file, then the public registry.
+	RegistryURL string
+	// ModulesDir is the project-local modules directory. Defaults to
+	// "carrion_modules" relative to the working directory.
+	ModulesDir string
+	// Layout arranges ModulesDir as "versioned" (<name>/<version>, the
+	// default) or "flat" (<name>).
+	Layout string
+	// Client overrides the registry client, for example one created with
+	// registry.WithTransport in tests.
+	Client *registry.Client
+}
+
+// Dependency is a package selected by dependency resolution
+type Dependency struct {
+	Name    string
+	Version *version.Version
+}
+
+// Installer installs Carrion packages
+type Installer struct {
+	inner *install.Installer
+}
+
+// NewInstaller returns an installer configured by opts, creating the Carrion
+// home directories if needed
+func NewInstaller(opts Options) (*Installer, error) {
+	var cfg *config.Config
+	if opts.HomeDir != "" {
+		cfg = config.NewWithHome(opts.HomeDir)
+	} else {
+		var err error
+		if cfg, err = config.New(); err != nil {
+			return nil, err
+		}
+	}
+	if opts.RegistryURL != "" {
+		if err := cfg.OverrideRegistryURL(opts.RegistryURL); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ModulesDir != "" {
+		cfg.ModulesDir = opts.ModulesDir
+	}
+	if opts.Layout != "" {
+		layout, err := config.ParseLayout(opts.Layout)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Layout = layout
+	}
+	if err := cfg.Init(); err != nil {
+		return nil, err
+	}
+
+	inner := install.New(cfg)
+	if opts.Client != nil {
+		inner.SetClient(opts.Client)
+	}
+	return &Installer{inner: inner}, nil
+}
+
+// Install installs a single package into the project modules directory.
+// spec may be empty or "latest", a full or partial version, or a constraint.
+func (i *Installer) Install(name, spec string) error {
+	return i.inner.InstallPackageByName(name, spec, false)
+}
+
+// Resolve selects versions for every dependency of m, returned in install
+// order (dependencies before their dependents)
+func (i *Installer) Resolve(m *manifest.Manifest) ([]Dependency, error) {
+	resolution, err := i.inner.ResolveManifest(m)
+	if err != nil {
+		return nil, err
+	}
+
+	var deps []Dependency
+	for _, pkg := range resolution.GetResolutionOrder() {
+		deps = append(deps, Dependency{Name: pkg.Name, Version: pkg.Version})
+	}
+	return deps, nil
+}
+
+// InstallManifest installs every dependency of the manifest at path and
+// writes the resulting lockfile next to it
+func (i *Installer) InstallManifest(path string) (*lockfile.Lockfile, error) {
+	return i.inner.InstallManifest(path)
+}
@@ -0,0 +1,49 @@
+package bifrost
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+	"github.com/javanhut/bifrost/pkg/manifest"
+	"github.com/javanhut/bifrost/pkg/registry"
+)
+
+func TestInstaller(t *testing.T) {
+	reg := registrytest.New()
+	archive, err := registrytest.Archive(map[string]string{"src/main.crl": "grim Json:"})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(registry.PackageInfo{Name: "json-utils", Version: "0.3.5"}, archive)
+
+	dir := t.TempDir()
+	inst, err := NewInstaller(Options{
+		HomeDir:    filepath.Join(dir, "home"),
+		ModulesDir: filepath.Join(dir, "carrion_modules"),
+		Client:     reg.Client(),
+	})
+	if err != nil {
+		t.Fatalf("NewInstaller() error = %v", err)
+	}
+
+	m := &manifest.Manifest{
+		Package:      manifest.Package{Name: "app", Version: "0.1.0"},
+		Dependencies: map[string]string{"json-utils": "^0.3.0"},
+	}
+	deps, err := inst.Resolve(m)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if len(deps) != 1 || deps[0].Name != "json-utils" || deps[0].Version.String() != "0.3.5" {
+		t.Errorf("Resolve() = %+v, want json-utils@0.3.5", deps)
+	}
+
+	if err := inst.Install("json-utils", "0.3"); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "carrion_modules", "json-utils", "0.3.5", "src", "main.crl")); err != nil {
+		t.Errorf("package not installed: %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+// Package lockfile reads and writes Bifrost.lock files, which record the exact
+// versions and archive checksums a project's dependencies resolved to.
+package lockfile
+
+import "github.com/javanhut/bifrost/internal/lockfile"
+
+// FileName is the name of the lockfile written next to Bifrost.toml
+const FileName = lockfile.FileName
+
+// FormatVersion is the lockfile format version written by this release
+const FormatVersion = lockfile.FormatVersion
+
+// Lockfile is the parsed contents of a Bifrost.lock file
+type Lockfile = lockfile.Lockfile
+
+// Package is a single locked dependency
+type Package = lockfile.Package
+
+// New returns an empty lockfile in the current format
+func New() *Lockfile {
+	return lockfile.New()
+}
+
+// Load parses the lockfile at path
+func Load(path string) (*Lockfile, error) {
+	return lockfile.Load(path)
+}
+
+// LoadIfExists parses the lockfile at path, returning nil without error when
+// the file does not exist
+func LoadIfExists(path string) (*Lockfile, error) {
+	return lockfile.LoadIfExists(path)
+}
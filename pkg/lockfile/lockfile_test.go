@@ -0,0 +1,43 @@
+package lockfile
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+
+	l := New()
+	l.Set(Package{Name: "json-utils", Version: "1.2.0", Checksum: "sha256:abc", Constraint: "^1.0.0"})
+	l.Set(Package{Name: "http-client", Version: "2.0.0", Dependencies: []string{"json-utils"}})
+	if err := l.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Version != FormatVersion {
+		t.Errorf("Version = %d, want %d", loaded.Version, FormatVersion)
+	}
+	if !reflect.DeepEqual(loaded.Packages, l.Packages) {
+		t.Errorf("round trip Packages = %+v, want %+v", loaded.Packages, l.Packages)
+	}
+	if pkg := loaded.Find("json-utils"); pkg == nil || pkg.Checksum != "sha256:abc" {
+		t.Errorf("Find(json-utils) = %+v", pkg)
+	}
+}
+
+func TestLoadIfExists(t *testing.T) {
+	dir := t.TempDir()
+	l, err := LoadIfExists(filepath.Join(dir, FileName))
+	if err != nil || l != nil {
+		t.Errorf("LoadIfExists() of a missing lockfile = %v, %v, want nil, nil", l, err)
+	}
+	if _, err := Load(filepath.Join(dir, FileName)); err == nil {
+		t.Error("Load() of a missing lockfile succeeded")
+	}
+}
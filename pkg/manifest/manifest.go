@@ -0,0 +1,32 @@
+// Package manifest reads and writes Bifrost.toml package manifests.
+package manifest
+
+import "github.com/javanhut/bifrost/internal/manifest"
+
+// FileName is the conventional name of a package manifest
+const FileName = manifest.FileName
+
+// Manifest is the parsed contents of a Bifrost.toml file
+type Manifest = manifest.Manifest
+
+// Package is the [package] table of a manifest
+type Package = manifest.Package
+
+// PackageMetadata is the [package.metadata] table of a manifest
+type PackageMetadata = manifest.PackageMetadata
+
+// Load parses the manifest at path
+func Load(path string) (*Manifest, error) {
+	return manifest.Load(path)
+}
+
+// Find returns the path of the nearest manifest in startDir or one of its
+// parent directories
+func Find(startDir string) (string, error) {
+	return manifest.Find(startDir)
+}
+
+// WriteDefault writes a starter manifest for a new package to path
+func WriteDefault(path, packageName, version string) error {
+	return manifest.WriteDefault(path, packageName, version)
+}
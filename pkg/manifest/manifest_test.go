@@ -0,0 +1,65 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteDefaultLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, FileName)
+	if err := WriteDefault(path, "json-utils", "1.0.0"); err != nil {
+		t.Fatalf("WriteDefault() error = %v", err)
+	}
+
+	m, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if m.Package.Name != "json-utils" || m.Package.Version != "1.0.0" {
+		t.Errorf("Package = %+v, want json-utils 1.0.0", m.Package)
+	}
+	if m.Package.Metadata.Main == "" {
+		t.Errorf("Metadata = %+v, want a main file", m.Package.Metadata)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	m := &Manifest{
+		Package:         Package{Name: "app", Version: "0.1.0"},
+		Dependencies:    map[string]string{"json-utils": "^1.2.0"},
+		DevDependencies: map[string]string{"test-kit": "~0.3.0"},
+	}
+	if err := m.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Package.Name != "app" || loaded.Dependencies["json-utils"] != "^1.2.0" || loaded.DevDependencies["test-kit"] != "~0.3.0" {
+		t.Errorf("round trip = %+v, want %+v", loaded, m)
+	}
+}
+
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+	if err := WriteDefault(filepath.Join(root, FileName), "app", "0.1.0"); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "src", "util")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := Find(sub)
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if want := filepath.Join(root, FileName); found != want {
+		t.Errorf("Find() = %s, want %s", found, want)
+	}
+}
@@ -0,0 +1,45 @@
+// Package registry is a client for the Bifrost package registry HTTP API.
+package registry
+
+import (
+	"net/http"
+
+	"github.com/javanhut/bifrost/internal/registry"
+)
+
+// DefaultURL is the public Carrion package registry
+const DefaultURL = "https://registry.carrionlang.com"
+
+// Client talks to a package registry
+type Client = registry.Client
+
+// Option customizes a Client created by NewClient
+type Option = registry.Option
+
+// PackageInfo is the metadata of a published package version
+type PackageInfo = registry.PackageInfo
+
+// SearchResult is a single package returned by Client.Search
+type SearchResult = registry.SearchResult
+
+// VersionList is the set of published versions of a package
+type VersionList = registry.VersionList
+
+// IndexEntry lists the published versions of a package in a registry
+// index, with the checksums and signatures of their archives
+type IndexEntry = registry.IndexEntry
+
+// NewClient returns a client for the registry at baseURL
+func NewClient(baseURL string, opts ...Option) *Client {
+	return registry.NewClient(baseURL, opts...)
+}
+
+// WithHTTPClient makes the client issue all requests through httpClient
+func WithHTTPClient(httpClient *http.Client) Option {
+	return registry.WithHTTPClient(httpClient)
+}
+
+// WithTransport replaces the transport of the client's HTTP client
+func WithTransport(transport http.RoundTripper) Option {
+	return registry.WithTransport(transport)
+}
@@ -0,0 +1,46 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/javanhut/bifrost/internal/registry/registrytest"
+)
+
+func TestNewClient(t *testing.T) {
+	reg := registrytest.New()
+	archive, err := registrytest.Archive(map[string]string{"src/main.crl": "grim Json:"})
+	if err != nil {
+		t.Fatalf("failed to build archive: %v", err)
+	}
+	reg.AddPackage(PackageInfo{Name: "json-utils", Version: "1.0.0", Description: "JSON helpers"}, archive)
+	reg.AddPackage(PackageInfo{Name: "json-utils", Version: "1.1.0"}, archive)
+
+	clients := map[string]*Client{
+		"transport": NewClient(registrytest.URL, WithTransport(reg)),
+	}
+	server := httptest.NewServer(reg)
+	defer server.Close()
+	clients["http client"] = NewClient(server.URL, WithHTTPClient(&http.Client{}))
+
+	for name, client := range clients {
+		t.Run(name, func(t *testing.T) {
+			info, err := client.GetPackageInfo("json-utils", "1.0.0")
+			if err != nil {
+				t.Fatalf("GetPackageInfo() error = %v", err)
+			}
+			if info.Name != "json-utils" || info.Version != "1.0.0" || info.Description != "JSON helpers" {
+				t.Errorf("GetPackageInfo() = %+v", info)
+			}
+			versions, err := client.ListVersions("json-utils")
+			if err != nil {
+				t.Fatalf("ListVersions() error = %v", err)
+			}
+			if want := []string{"1.0.0", "1.1.0"}; !reflect.DeepEqual(versions, want) {
+				t.Errorf("ListVersions() = %v, want %v", versions, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+// Package version implements semantic versions and the constraint syntax
+// used in Bifrost.toml dependency tables.
+package version
+
+import "github.com/javanhut/bifrost/internal/version"
+
+// Version is a MAJOR.MINOR.PATCH semantic version
+type Version = version.Version
+
+// Constraint matches the versions admitted by a dependency requirement such
+// as "^1.2.0" or ">=1.0.0, <2.0.0"
+type Constraint = version.Constraint
+
+// Parse parses a version string, accepting an optional leading "v"
+func Parse(v string) (*Version, error) {
+	return version.Parse(v)
+}
+
+// ParseConstraint parses a dependency requirement
+func ParseConstraint(s string) (Constraint, error) {
+	return version.ParseConstraint(s)
+}
@@ -0,0 +1,49 @@
+package version
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{"1.2.3", "v1.2.3"} {
+		v, err := Parse(s)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", s, err)
+		}
+		if v.String() != "1.2.3" {
+			t.Errorf("Parse(%q).String() = %q, want 1.2.3", s, v.String())
+		}
+		// The string form parses back to the same version
+		if again, err := Parse(v.String()); err != nil || again.Compare(v) != 0 {
+			t.Errorf("Parse(%q) = %v, %v, want %v", v.String(), again, err, v)
+		}
+	}
+	if _, err := Parse("not-a-version"); err == nil {
+		t.Error("Parse() of an invalid version succeeded")
+	}
+}
+
+func TestParseConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{"^1.2.0", "1.9.0", true},
+		{"^1.2.0", "2.0.0", false},
+		{">=1.0.0, <2.0.0", "1.5.0", true},
+		{"~=1.4", "1.9.0", true},
+		{"1.2.3", "1.2.4", false},
+	}
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Fatalf("ParseConstraint(%q) error = %v", tt.constraint, err)
+		}
+		v, err := Parse(tt.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.Satisfies(v); got != tt.want {
+			t.Errorf("%q satisfies %s = %v, want %v", tt.constraint, tt.version, got, tt.want)
+		}
+	}
+}